@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requireAdmin rejects requests that don't carry "Authorization: Bearer
+// <token>" or the dashboard's token cookie. Dashboard pages get the
+// sign-in form instead.
+func requireAdmin(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if adminAuthorized(r, token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == "/dashboard" || strings.HasPrefix(r.URL.Path, "/dashboard/") {
+			serveDashboardLogin(w, r, token)
+			return
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func adminAuthorized(r *http.Request, token string) bool {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1 {
+		return true
+	}
+	c, err := r.Cookie(adminCookie)
+	return err == nil && subtle.ConstantTimeCompare([]byte(c.Value), []byte(token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// adminHandler is the admin API, the dashboard and the debug endpoints,
+// all behind admin auth.
+func (b *Bot) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	registerDebugRoutes(mux, b)
+	registerAMARoutes(mux, b)
+	registerDuelRoutes(mux, b)
+	registerPersonaRoutes(mux, b)
+	registerControlRoutes(mux, b)
+	registerAnnouncementRoutes(mux, b)
+	registerDashboardRoutes(mux, b)
+	registerFailoverRoutes(mux, b)
+	registerBlockListRoutes(mux, b)
+	registerPollRoutes(mux, b)
+	registerPollGenerationRoutes(mux, b)
+	registerPollImageRoutes(mux, b)
+	registerCalendarRoutes(mux, b)
+	registerSessionRoutes(mux, b)
+	registerReprocessRoutes(mux, b)
+	registerExperimentRoutes(mux, b)
+	registerPollResultRoutes(mux, b)
+	registerCostRoutes(mux, b)
+	registerMetricsRoutes(mux, b)
+	registerStatsRoutes(mux, b)
+	registerPrizeRoutes(mux, b.prizes, func(ctx context.Context, userID string) (string, error) {
+		return b.pseudonyms.anonymize(ctx, b.client, b.cfg.Collections.Pseudonyms, userID)
+	})
+	mux.HandleFunc("GET /admin/degradation", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, b.ladder.status())
+	})
+	mux.HandleFunc("GET /admin/energy", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"level": string(b.energy.current())})
+	})
+	return requireAdmin(b.cfg.AdminToken, mux)
+}
+
+// serveAdmin serves adminHandler on cfg.AdminAddr.
+func (b *Bot) serveAdmin(ctx context.Context) error {
+	srv := &http.Server{Addr: b.cfg.AdminAddr, Handler: b.adminHandler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
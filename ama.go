@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// amaSession is an "ask me anything" window: while it is open the host
+// only takes questions about Topic. Sessions are replaced, never modified.
+type amaSession struct {
+	Topic    string    `json:"topic"`
+	OpenedAt time.Time `json:"openedAt"`
+	ClosesAt time.Time `json:"closesAt"`
+}
+
+func (s *amaSession) open(now time.Time) bool {
+	return s != nil && now.Before(s.ClosesAt)
+}
+
+var errAMAOpen = errors.New("an AMA session is already open")
+
+// openAMA starts an AMA on topic for d; the monitor announces it on its
+// next tick.
+func (b *Bot) openAMA(topic string, d time.Duration) (*amaSession, error) {
+	now := clock.Now()
+	s := &amaSession{Topic: topic, OpenedAt: now, ClosesAt: now.Add(d)}
+	for {
+		cur := b.room.ama.Load()
+		if cur.open(now) {
+			return nil, errAMAOpen
+		}
+		if b.room.ama.CompareAndSwap(cur, s) {
+			b.bus.Publish(Event{Kind: EventStateChanged, State: "ama", To: topic})
+			return s, nil
+		}
+	}
+}
+
+// closeAMA ends the open AMA early; the monitor wraps it up on its next
+// tick. It reports false if no AMA was open.
+func (b *Bot) closeAMA() bool {
+	now := clock.Now()
+	for {
+		cur := b.room.ama.Load()
+		if !cur.open(now) {
+			return false
+		}
+		closed := *cur
+		closed.ClosesAt = now
+		if b.room.ama.CompareAndSwap(cur, &closed) {
+			return true
+		}
+	}
+}
+
+// amaAnnouncements returns the AMA opening to announce, or, once the
+// window has passed, the wrap-up. The wrap-up's Done clears the session.
+// Only the monitor calls it.
+func (b *Bot) amaAnnouncements() []hostAnnouncement {
+	s := b.room.ama.Load()
+	if s == nil {
+		return nil
+	}
+	if !s.open(clock.Now()) {
+		return []hostAnnouncement{{
+			Kind: "ama-wrap-up",
+			Text: fmt.Sprintf("That's a wrap on our ask-me-anything about %s. Thank you for all the questions; the floor is open to every topic again!", s.Topic),
+			Done: func(ctx context.Context) error {
+				if b.room.ama.CompareAndSwap(s, nil) {
+					b.bus.Publish(Event{Kind: EventStateChanged, State: "ama", From: s.Topic})
+				}
+				return nil
+			},
+		}}
+	}
+	if b.amaAnnouncedAt.Equal(s.OpenedAt) {
+		return nil
+	}
+	return []hostAnnouncement{{
+		Kind: "ama-open",
+		Text: fmt.Sprintf("Ask me anything about %s! For the next %s I'll only take questions on %s.", s.Topic, s.ClosesAt.Sub(s.OpenedAt).Round(time.Minute), s.Topic),
+		Done: func(ctx context.Context) error {
+			b.amaAnnouncedAt = s.OpenedAt
+			return nil
+		},
+	}}
+}
+
+// amaContext adds the open AMA, if any, to the prompt context for an
+// audience message: on-topic questions are answered as usual, anything
+// else gets a gentle redirect back to the topic.
+func (b *Bot) amaContext(ctx context.Context, promptContext, text string) string {
+	s := b.room.ama.Load()
+	if !s.open(clock.Now()) {
+		return promptContext
+	}
+	if onTopic(ctx, b.ladderModel(), s.Topic, text) {
+		return fmt.Sprintf("%s\nAn ask-me-anything session about %s is running; this question is on topic.", promptContext, s.Topic)
+	}
+	return fmt.Sprintf("%s\nAn ask-me-anything session about %s is running and this message is off topic. Do not answer it: warmly, in character, invite the user to ask about %s instead.", promptContext, s.Topic, s.Topic)
+}
+
+// onTopic asks the model whether text belongs in an AMA about topic. If the
+// model is unavailable the message is let through rather than turned away.
+func onTopic(ctx context.Context, model ResponseGenerator, topic, text string) bool {
+	prompt := fmt.Sprintf(`An "ask me anything" session about %q is running at a live event.
+Is this audience message about that topic, or a greeting or reaction to it? Answer yes or no.
+Message: %s`, topic, text)
+	answer, err := model.Generate(ctx, prompt)
+	if err != nil {
+		return true
+	}
+	return !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "no")
+}
+
+func registerAMARoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/ama", func(w http.ResponseWriter, r *http.Request) {
+		s := b.room.ama.Load()
+		if !s.open(clock.Now()) {
+			writeJSON(w, http.StatusOK, map[string]any{"open": false})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"open": true, "session": s})
+	})
+
+	mux.HandleFunc("POST /admin/ama", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Topic    string   `json:"topic"`
+			Duration Duration `json:"duration"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if strings.TrimSpace(body.Topic) == "" {
+			writeError(w, http.StatusBadRequest, errors.New("topic is required"))
+			return
+		}
+		if body.Duration.Duration <= 0 {
+			body.Duration = b.cfg.Monitor.AMADuration
+		}
+		s, err := b.openAMA(strings.TrimSpace(body.Topic), body.Duration.Duration)
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, s)
+	})
+
+	mux.HandleFunc("DELETE /admin/ama", func(w http.ResponseWriter, r *http.Request) {
+		if !b.closeAMA() {
+			writeError(w, http.StatusNotFound, errors.New("no AMA session is open"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAMALifecycle(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	b := newTestBot(t, newMemoryStore(), generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "ok", nil
+	}))
+	if _, err := b.openAMA("Gemini", 10*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.openAMA("Flutter", 10*time.Minute); !errors.Is(err, errAMAOpen) {
+		t.Fatalf("second openAMA = %v, want %v", err, errAMAOpen)
+	}
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		close   bool
+		want    string // announcement kind, "" for none
+	}{
+		{"opening", 0, false, "ama-open"},
+		{"announced once", time.Minute, false, ""},
+		{"closed early", time.Minute, true, "ama-wrap-up"},
+		{"wrapped up once", time.Minute, false, ""},
+	}
+	for _, s := range steps {
+		vc.Advance(s.advance)
+		if s.close && !b.closeAMA() {
+			t.Fatalf("%s: closeAMA found no open session", s.name)
+		}
+		got := b.amaAnnouncements()
+		switch {
+		case s.want == "" && len(got) != 0:
+			t.Fatalf("%s: announcements = %+v, want none", s.name, got)
+		case s.want != "" && (len(got) != 1 || got[0].Kind != s.want):
+			t.Fatalf("%s: announcements = %+v, want %s", s.name, got, s.want)
+		}
+		for _, a := range got {
+			a.Done(context.Background())
+		}
+	}
+	if _, err := b.openAMA("Flutter", time.Minute); err != nil {
+		t.Errorf("openAMA after wrap-up = %v", err)
+	}
+}
+
+func TestAMAContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		verdict string
+		err     error
+		want    string
+	}{
+		{"on topic", "Yes", nil, "this question is on topic"},
+		{"off topic", "no.", nil, "invite the user to ask about Gemini instead"},
+		{"model unavailable", "", errors.New("quota"), "this question is on topic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBot(t, newMemoryStore(), generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+				return tt.verdict, tt.err
+			}))
+			if got := b.amaContext(context.Background(), "ctx", "what about cricket?"); got != "ctx" {
+				t.Fatalf("amaContext without a session = %q, want it unchanged", got)
+			}
+			b.openAMA("Gemini", time.Hour)
+			if got := b.amaContext(context.Background(), "ctx", "what about cricket?"); !strings.Contains(got, tt.want) {
+				t.Errorf("amaContext = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// announcementCheckInterval is how precisely scheduled announcements go out.
+const announcementCheckInterval = time.Second
+
+const (
+	announcementPending   = "pending"
+	announcementSent      = "sent"
+	announcementCancelled = "cancelled"
+)
+
+var (
+	errAnnouncementNotFound   = errors.New("announcement not found")
+	errAnnouncementNotPending = errors.New("announcement was already sent or cancelled")
+	errAnnouncementNotDue     = errors.New("announcement is not due yet")
+)
+
+// ScheduledAnnouncement is a message the host posts verbatim at At, without
+// the model, for announcements whose wording must not change. Message may
+// use the template variables of templatevars.go, filled in when it is sent.
+type ScheduledAnnouncement struct {
+	ID        string    `firestore:"id" json:"id"`
+	Message   string    `firestore:"message" json:"message"`
+	At        time.Time `firestore:"at" json:"at"`
+	Status    string    `firestore:"status" json:"status"`
+	CreatedAt time.Time `firestore:"createdAt" json:"createdAt"`
+	SentAt    time.Time `firestore:"sentAt,omitempty" json:"sentAt,omitempty"`
+}
+
+// AnnouncementStore keeps scheduled announcements.
+type AnnouncementStore interface {
+	SaveAnnouncement(ctx context.Context, a ScheduledAnnouncement) error
+	// Announcements lists the pending announcements, soonest first.
+	Announcements(ctx context.Context) ([]ScheduledAnnouncement, error)
+	// UpdateAnnouncement applies fn to announcement id atomically and
+	// returns the result; an error from fn aborts the update. It returns
+	// errAnnouncementNotFound for unknown IDs.
+	UpdateAnnouncement(ctx context.Context, id string, fn func(a *ScheduledAnnouncement) error) (*ScheduledAnnouncement, error)
+	// WatchAnnouncements calls fn with the pending announcements, soonest
+	// first, whenever they change, until ctx is done or the stream fails.
+	WatchAnnouncements(ctx context.Context, fn func(pending []ScheduledAnnouncement) error) error
+}
+
+// runAnnouncementScheduler posts each pending announcement once its time
+// has come. Only the primary runs it.
+func (b *Bot) runAnnouncementScheduler(ctx context.Context) error {
+	updates := make(chan []ScheduledAnnouncement, 1)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- b.metrics.listen(func() error {
+			return b.announcements.WatchAnnouncements(ctx, func(pending []ScheduledAnnouncement) error {
+				select {
+				case <-updates:
+				default:
+				}
+				updates <- pending
+				return nil
+			})
+		})
+	}()
+
+	ticker := clock.NewTicker(announcementCheckInterval)
+	defer ticker.Stop()
+	var pending []ScheduledAnnouncement
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watchErr:
+			return err
+		case pending = <-updates:
+		case <-ticker.C():
+			now := clock.Now()
+			for _, a := range pending {
+				if a.At.After(now) {
+					break
+				}
+				b.sendAnnouncement(ctx, a.ID)
+			}
+		}
+	}
+}
+
+// sendAnnouncement marks announcement id sent, if it is still pending and
+// due, and publishes it. If publishing fails it goes back to pending and
+// is retried on the next check.
+func (b *Bot) sendAnnouncement(ctx context.Context, id string) {
+	now := clock.Now()
+	a, err := b.announcements.UpdateAnnouncement(ctx, id, func(a *ScheduledAnnouncement) error {
+		switch {
+		case a.Status != announcementPending:
+			return errAnnouncementNotPending
+		case a.At.After(now):
+			return errAnnouncementNotDue
+		}
+		a.Status, a.SentAt = announcementSent, now
+		return nil
+	})
+	if errors.Is(err, errAnnouncementNotPending) || errors.Is(err, errAnnouncementNotDue) {
+		return
+	}
+	if err != nil {
+		slog.Error("error sending announcement", "announcement", id, "err", err)
+		return
+	}
+	text, err := b.renderMessage(a.Message, now)
+	if err != nil {
+		slog.Warn("error rendering announcement, sending it as written", "announcement", id, "err", err)
+	}
+	if err := b.publishReply(ctx, Message{ID: a.ID, Message: text, Context: "scheduled announcement"}); err != nil {
+		slog.Warn("error publishing announcement, will retry", "announcement", id, "err", err)
+		if _, err := b.announcements.UpdateAnnouncement(ctx, id, func(a *ScheduledAnnouncement) error {
+			a.Status, a.SentAt = announcementPending, time.Time{}
+			return nil
+		}); err != nil {
+			slog.Error("error putting back announcement", "announcement", id, "err", err)
+		}
+		return
+	}
+	b.room.lastResponseTime.StoreLater(clock.Now())
+}
+
+// announcementRequest is the body of POST and PATCH /admin/announcements:
+// the message and either an absolute time or an offset from now.
+type announcementRequest struct {
+	Message *string    `json:"message"`
+	At      *time.Time `json:"at"`
+	In      *Duration  `json:"in"`
+}
+
+// when returns the time the request asks for, if any.
+func (req announcementRequest) when(now time.Time) (time.Time, bool, error) {
+	switch {
+	case req.At != nil && req.In != nil:
+		return time.Time{}, false, errors.New("give either at or in, not both")
+	case req.In != nil:
+		if req.In.Duration < 0 {
+			return time.Time{}, false, errors.New("in must not be negative")
+		}
+		return now.Add(req.In.Duration), true, nil
+	case req.At != nil:
+		if req.At.Before(now) {
+			return time.Time{}, false, fmt.Errorf("at %s is in the past", req.At.Format(time.RFC3339))
+		}
+		return *req.At, true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+func registerAnnouncementRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/announcements", func(w http.ResponseWriter, r *http.Request) {
+		pending, err := b.announcements.Announcements(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"pending": pending})
+	})
+
+	mux.HandleFunc("POST /admin/announcements", func(w http.ResponseWriter, r *http.Request) {
+		var req announcementRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Message == nil || strings.TrimSpace(*req.Message) == "" {
+			writeError(w, http.StatusBadRequest, errors.New("message is required"))
+			return
+		}
+		if _, err := parseMessageTemplate(*req.Message); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid message template: %w", err))
+			return
+		}
+		now := clock.Now()
+		at, ok, err := req.when(now)
+		if err == nil && !ok {
+			err = errors.New("at or in is required")
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		a := ScheduledAnnouncement{ID: newID("announcement"), Message: *req.Message, At: at, Status: announcementPending, CreatedAt: now}
+		if err := b.announcements.SaveAnnouncement(r.Context(), a); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, a)
+	})
+
+	mux.HandleFunc("PATCH /admin/announcements/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req announcementRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Message != nil && strings.TrimSpace(*req.Message) == "" {
+			writeError(w, http.StatusBadRequest, errors.New("message must not be empty"))
+			return
+		}
+		if req.Message != nil {
+			if _, err := parseMessageTemplate(*req.Message); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid message template: %w", err))
+				return
+			}
+		}
+		at, reschedule, err := req.when(clock.Now())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		a, err := b.announcements.UpdateAnnouncement(r.Context(), r.PathValue("id"), func(a *ScheduledAnnouncement) error {
+			if a.Status != announcementPending {
+				return errAnnouncementNotPending
+			}
+			if req.Message != nil {
+				a.Message = *req.Message
+			}
+			if reschedule {
+				a.At = at
+			}
+			return nil
+		})
+		writeAnnouncement(w, a, err)
+	})
+
+	mux.HandleFunc("DELETE /admin/announcements/{id}", func(w http.ResponseWriter, r *http.Request) {
+		a, err := b.announcements.UpdateAnnouncement(r.Context(), r.PathValue("id"), func(a *ScheduledAnnouncement) error {
+			if a.Status != announcementPending {
+				return errAnnouncementNotPending
+			}
+			a.Status = announcementCancelled
+			return nil
+		})
+		writeAnnouncement(w, a, err)
+	})
+}
+
+func writeAnnouncement(w http.ResponseWriter, a *ScheduledAnnouncement, err error) {
+	switch {
+	case errors.Is(err, errAnnouncementNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errAnnouncementNotPending):
+		writeError(w, http.StatusConflict, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, a)
+	}
+}
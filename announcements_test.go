@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAnnouncementRequestWhen(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Hour), now.Add(-time.Minute)
+	tests := []struct {
+		name    string
+		req     announcementRequest
+		want    time.Time
+		wantOK  bool
+		wantErr bool
+	}{
+		{"neither", announcementRequest{}, time.Time{}, false, false},
+		{"absolute", announcementRequest{At: &later}, later, true, false},
+		{"relative", announcementRequest{In: &Duration{10 * time.Minute}}, now.Add(10 * time.Minute), true, false},
+		{"in the past", announcementRequest{At: &earlier}, time.Time{}, false, true},
+		{"both", announcementRequest{At: &later, In: &Duration{time.Minute}}, time.Time{}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := tt.req.when(now)
+			if (err != nil) != tt.wantErr || ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("when = %v, %v, %v; want %v, %v, error %v", got, ok, err, tt.want, tt.wantOK, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchedulerSendsDueAnnouncements(t *testing.T) {
+	store := newMemoryStore()
+	// Scheduled announcements never go through the model.
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "", errors.New("model down")
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := clock.Now()
+	for _, a := range []ScheduledAnnouncement{
+		{ID: "due", Message: "The fire exits are at the back of the hall.", At: now.Add(-time.Second), Status: announcementPending},
+		{ID: "later", Message: "Lunch is served at 1pm.", At: now.Add(time.Hour), Status: announcementPending},
+		{ID: "cancelled", Message: "Old news.", At: now.Add(-time.Second), Status: announcementCancelled},
+	} {
+		store.SaveAnnouncement(ctx, a)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.runAnnouncementScheduler(ctx) }()
+	waitFor(t, done, "the due announcement", func() bool {
+		_, ok := store.Reply("due")
+		return ok
+	})
+	if reply, _ := store.Reply("due"); reply.Message != "The fire exits are at the back of the hall." {
+		t.Errorf("announcement = %q, want it verbatim", reply.Message)
+	}
+	pending, _ := store.Announcements(ctx)
+	if len(pending) != 1 || pending[0].ID != "later" {
+		t.Errorf("pending = %+v, want only the later announcement", pending)
+	}
+	if _, ok := store.Reply("cancelled"); ok {
+		t.Error("cancelled announcement was published")
+	}
+	if _, err := store.UpdateAnnouncement(ctx, "nope", func(*ScheduledAnnouncement) error { return nil }); !errors.Is(err, errAnnouncementNotFound) {
+		t.Errorf("updating an unknown announcement = %v, want %v", err, errAnnouncementNotFound)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxAPIMessageRunes caps audience messages submitted over the API.
+	maxAPIMessageRunes = 500
+	// maxAPIResponses caps GET /responses.
+	maxAPIResponses = 100
+)
+
+// requireAPIKey rejects requests whose X-API-Key header is not one of keys.
+// Browsers can't set headers on an EventSource, so /stream also takes the
+// key as the "key" query parameter.
+func requireAPIKey(keys []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("X-API-Key"))
+		if len(got) == 0 && r.URL.Path == "/stream" {
+			got = []byte(r.URL.Query().Get("key"))
+		}
+		for _, key := range keys {
+			if len(got) > 0 && subtle.ConstantTimeCompare(got, []byte(key)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		writeError(w, http.StatusUnauthorized, errors.New("missing or unknown API key"))
+	})
+}
+
+// apiPollOption is a poll option with its eligible vote count; voters are
+// not exposed.
+type apiPollOption struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Text     string `json:"text"`
+	ImageURL string `json:"imageUrl,omitempty"`
+	Votes    int    `json:"votes"`
+}
+
+// pollOptions lists poll's options by key with their vote counts.
+func pollOptions(poll PollQuestion) []apiPollOption {
+	options := make([]apiPollOption, 0, len(poll.Options))
+	for key, opt := range poll.Options {
+		options = append(options, apiPollOption{Key: key, Label: opt.Label, Text: opt.OpText, ImageURL: opt.ImageURL, Votes: len(opt.Voters)})
+	}
+	sort.Slice(options, func(i, j int) bool { return options[i].Key < options[j].Key })
+	return options
+}
+
+// apiHandler is the public REST API for event apps that can't write to
+// Firestore themselves. Messages it accepts go into the user collection
+// and through the same listener as every other audience message.
+func (b *Bot) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /messages", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			UserID  string `json:"userId"`
+			Message string `json:"message"`
+			ReplyTo string `json:"replyTo"`
+			Section string `json:"section"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		body.Message = strings.TrimSpace(body.Message)
+		if body.Message == "" {
+			writeError(w, http.StatusBadRequest, errors.New("message is required"))
+			return
+		}
+		if n := len([]rune(body.Message)); n > maxAPIMessageRunes {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("message is %d characters, at most %d allowed", n, maxAPIMessageRunes))
+			return
+		}
+		msg := Message{
+			ID:        newID("api"),
+			UserID:    body.UserID,
+			Message:   body.Message,
+			Timestamp: clock.Now(),
+			ReplyTo:   body.ReplyTo,
+			Section:   body.Section,
+		}
+		if b.cfg.Shards.Count > 1 {
+			msg.Shard = messageShard(msg.ID, b.cfg.Shards.Count)
+		}
+		if err := b.retry.do(r.Context(), func(ctx context.Context) error { return b.messages.Submit(ctx, msg) }); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"id": msg.ID})
+	})
+
+	mux.HandleFunc("GET /messages/{id}/response", func(w http.ResponseWriter, r *http.Request) {
+		reply, private, err := b.messages.FindReply(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if reply == nil {
+			writeError(w, http.StatusNotFound, errors.New("no response yet"))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"id": reply.ID, "message": reply.Message, "question": reply.Question, "private": private, "timestamp": reply.Timestamp})
+	})
+
+	mux.HandleFunc("GET /responses", func(w http.ResponseWriter, r *http.Request) {
+		var since time.Time
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339, v); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid since: %w", err))
+				return
+			}
+		}
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				writeError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+				return
+			}
+			limit = min(n, maxAPIResponses)
+		}
+		replies, err := b.messages.RecentReplies(r.Context(), since, limit)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		out := make([]map[string]any, 0, len(replies))
+		for _, reply := range replies {
+			out = append(out, map[string]any{"id": reply.ID, "message": reply.Message, "question": reply.Question, "timestamp": reply.Timestamp})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"responses": out})
+	})
+
+	mux.HandleFunc("GET /transcript", func(w http.ResponseWriter, r *http.Request) {
+		var after time.Time
+		if v := r.URL.Query().Get("after"); v != "" {
+			var err error
+			if after, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid after: %w", err))
+				return
+			}
+		}
+		entries, err := b.messages.Transcript(r.Context(), after, maxTranscriptPage)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp := map[string]any{"entries": entries}
+		if len(entries) == maxTranscriptPage {
+			resp["next"] = entries[len(entries)-1].At.Format(time.RFC3339Nano)
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+
+	mux.HandleFunc("GET /stream", b.serveStream)
+	registerLeaderboardRoutes(mux, b)
+	registerBuzzerRoutes(mux, b)
+
+	mux.HandleFunc("GET /duel", func(w http.ResponseWriter, r *http.Request) {
+		d := b.duel.snapshot()
+		if d == nil {
+			writeError(w, http.StatusNotFound, errors.New("no duel has been played"))
+			return
+		}
+		writeJSON(w, http.StatusOK, duelBoard(d))
+	})
+
+	mux.HandleFunc("GET /poll", func(w http.ResponseWriter, r *http.Request) {
+		tally, err := b.tallyLivePoll(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		resp := map[string]any{"id": tally.ID, "question": tally.Poll.Question, "options": pollOptions(tally.Poll)}
+		switch {
+		case tally.Poll.numeric():
+			resp["kind"], resp["range"], resp["results"] = pollKindNumeric, tally.Poll.Range, numericResults(tally.Poll)
+		case tally.Poll.textual():
+			resp["kind"], resp["answers"], resp["themes"] = pollKindText, len(tally.Poll.TextAnswers), tally.Poll.Themes
+		}
+		if !tally.Poll.ClosesAt.IsZero() {
+			resp["closesAt"] = tally.Poll.ClosesAt
+		}
+		if closed, _ := pollClosed(tally.Poll, clock.Now()); closed {
+			resp["closed"] = true
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+
+	return requireAPIKey(b.cfg.APIKeys, mux)
+}
+
+// serveAPI serves the REST API on cfg.APIAddr.
+func (b *Bot) serveAPI(ctx context.Context) error {
+	srv := &http.Server{Addr: b.cfg.APIAddr, Handler: b.apiHandler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIMessageRoundTrip(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.APIKeys = []string{"app-key"}
+	srv := httptest.NewServer(b.apiHandler())
+	defer srv.Close()
+
+	do := func(method, path, key, body string) (int, map[string]any) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	if code, _ := do("POST", "/messages", "wrong-key", `{"message": "hi"}`); code != http.StatusUnauthorized {
+		t.Errorf("POST /messages with a wrong key = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := do("POST", "/messages", "app-key", `{"message": "   "}`); code != http.StatusBadRequest {
+		t.Errorf("POST /messages without a message = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	code, out := do("POST", "/messages", "app-key", `{"userId": "ann", "message": " what is Gemini? ", "section": "C"}`)
+	if code != http.StatusAccepted {
+		t.Fatalf("POST /messages = %d %v, want %d", code, out, http.StatusAccepted)
+	}
+	id, _ := out["id"].(string)
+	msg, ok := store.Message(id)
+	if !ok || msg.Processed || msg.Message != "what is Gemini?" || msg.Section != "C" {
+		t.Fatalf("stored message = %+v, %v; want it queued unprocessed", msg, ok)
+	}
+
+	if code, _ := do("GET", "/messages/"+id+"/response", "app-key", ""); code != http.StatusNotFound {
+		t.Errorf("GET response before the host answered = %d, want %d", code, http.StatusNotFound)
+	}
+	store.WritePrivateReply(context.Background(), Message{ID: id, Message: "A family of models, dost!"})
+	code, out = do("GET", "/messages/"+id+"/response", "app-key", "")
+	if code != http.StatusOK || out["message"] != "A family of models, dost!" || out["private"] != true {
+		t.Errorf("GET response = %d %v, want the private reply", code, out)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	eventbriteSyncInterval = time.Minute
+	eventbriteTimeout      = 30 * time.Second
+	// eventbriteBaseURL is where the Eventbrite API is served from.
+	eventbriteBaseURL = "https://www.eventbriteapi.com/v3"
+)
+
+// Profile is the audience member's profile document, keyed by user ID. Email
+// and AttendeeID link the app user to the registration system.
+type Profile struct {
+	DisplayName string `firestore:"displayName,omitempty"`
+	// Nickname is given by the backend to attendees without a display
+	// name; see nickname.go.
+	Nickname   string `firestore:"nickname,omitempty"`
+	Email      string `firestore:"email,omitempty"`
+	AttendeeID string `firestore:"attendeeId,omitempty"`
+}
+
+// Checkin marks an attendee as physically present. Check-in documents are
+// keyed by lowercased email, by "id-<attendee ID>", or by app user ID.
+type Checkin struct {
+	Email       string    `firestore:"email,omitempty"`
+	AttendeeID  string    `firestore:"attendeeId,omitempty"`
+	Source      string    `firestore:"source"`
+	CheckedInAt time.Time `firestore:"checkedInAt"`
+}
+
+// CheckinStore records check-ins from the registration system.
+type CheckinStore interface {
+	// SaveCheckin stores c under key, replacing any check-in there.
+	SaveCheckin(ctx context.Context, key string, c Checkin) error
+}
+
+func checkinKeys(userID string, p Profile) []string {
+	keys := []string{userID}
+	if p.Email != "" {
+		keys = append(keys, strings.ToLower(strings.TrimSpace(p.Email)))
+	}
+	if p.AttendeeID != "" {
+		keys = append(keys, "id-"+p.AttendeeID)
+	}
+	return keys
+}
+
+// checkedInUsers reports which of userIDs are checked in, resolving each
+// user's profile to the keys the check-in source uses.
+func checkedInUsers(ctx context.Context, r EligibilityReader, userIDs []string) (map[string]bool, error) {
+	present := map[string]bool{}
+	if len(userIDs) == 0 {
+		return present, nil
+	}
+
+	profiles, err := r.Profiles(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	var keys, owners []string
+	for i, p := range profiles {
+		if p == nil {
+			p = &Profile{}
+		}
+		for _, key := range checkinKeys(userIDs[i], *p) {
+			keys = append(keys, key)
+			owners = append(owners, userIDs[i])
+		}
+	}
+
+	found, err := r.Checkins(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, ok := range found {
+		if ok {
+			present[owners[i]] = true
+		}
+	}
+	return present, nil
+}
+
+type eventbriteAttendees struct {
+	Attendees []struct {
+		ID        string `json:"id"`
+		CheckedIn bool   `json:"checked_in"`
+		Profile   struct {
+			Email string `json:"email"`
+		} `json:"profile"`
+	} `json:"attendees"`
+	Pagination struct {
+		HasMoreItems bool   `json:"has_more_items"`
+		Continuation string `json:"continuation"`
+	} `json:"pagination"`
+}
+
+// eventbriteClient lists the attendees of one Eventbrite event from
+// baseURL, which tests point at their own server.
+type eventbriteClient struct {
+	baseURL string
+	token   string
+	eventID string
+	client  *http.Client
+}
+
+func newEventbriteClient(cfg EventbriteConfig) *eventbriteClient {
+	if cfg.Token == "" {
+		return nil
+	}
+	return &eventbriteClient{
+		baseURL: eventbriteBaseURL,
+		token:   cfg.Token,
+		eventID: cfg.EventID,
+		client:  &http.Client{Timeout: eventbriteTimeout},
+	}
+}
+
+// attendees returns the page of attending attendees after continuation,
+// the first page if it is "".
+func (c *eventbriteClient) attendees(ctx context.Context, continuation string) (*eventbriteAttendees, error) {
+	q := url.Values{"status": {"attending"}}
+	if continuation != "" {
+		q.Set("continuation", continuation)
+	}
+	endpoint := fmt.Sprintf("%s/events/%s/attendees/?%s", c.baseURL, url.PathEscape(c.eventID), q.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling Eventbrite: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("eventbrite returned %s", resp.Status)
+	}
+	var page eventbriteAttendees
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("error decoding Eventbrite attendees: %w", err)
+	}
+	return &page, nil
+}
+
+// syncEventbriteCheckins mirrors Eventbrite check-ins into the check-in
+// collection every minute.
+func (b *Bot) syncEventbriteCheckins(ctx context.Context) error {
+	ticker := clock.NewTicker(eventbriteSyncInterval)
+	defer ticker.Stop()
+
+	synced := map[string]bool{}
+	for {
+		added, err := pullEventbriteCheckins(ctx, b.eventbrite, b.checkins, synced)
+		if err != nil {
+			return err
+		}
+		if added > 0 {
+			slog.Info("synced Eventbrite check-ins", "added", added)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// pullEventbriteCheckins saves a check-in for every checked-in attendee
+// not yet in synced, under both their attendee ID and email keys, and
+// returns how many it added.
+func pullEventbriteCheckins(ctx context.Context, eb *eventbriteClient, store CheckinStore, synced map[string]bool) (int, error) {
+	added := 0
+	continuation := ""
+	for {
+		page, err := eb.attendees(ctx, continuation)
+		if err != nil {
+			return added, err
+		}
+
+		for _, a := range page.Attendees {
+			if !a.CheckedIn || synced[a.ID] {
+				continue
+			}
+			checkin := Checkin{
+				Email:       strings.ToLower(a.Profile.Email),
+				AttendeeID:  a.ID,
+				Source:      "eventbrite",
+				CheckedInAt: clock.Now(),
+			}
+			keys := []string{"id-" + a.ID}
+			if checkin.Email != "" {
+				keys = append(keys, checkin.Email)
+			}
+			for _, key := range keys {
+				if err := store.SaveCheckin(ctx, key, checkin); err != nil {
+					return added, fmt.Errorf("error writing check-in: %w", err)
+				}
+			}
+			synced[a.ID] = true
+			added++
+		}
+
+		if !page.Pagination.HasMoreItems {
+			return added, nil
+		}
+		continuation = page.Pagination.Continuation
+	}
+}
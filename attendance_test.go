@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckedInUsers(t *testing.T) {
+	store := newMemoryStore()
+	store.SetProfile("ann", Profile{Email: " Ann@Example.com "})
+	store.SetProfile("bob", Profile{AttendeeID: "42"})
+	store.SetProfile("cat", Profile{Email: "cat@example.com", AttendeeID: "43"})
+	store.SetCheckin("ann@example.com", Checkin{Source: "eventbrite"})
+	store.SetCheckin("id-42", Checkin{Source: "eventbrite"})
+	store.SetCheckin("dan", Checkin{Source: "desk"})
+
+	got, err := checkedInUsers(context.Background(), store, []string{"ann", "bob", "cat", "dan", "eve"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"ann": true, "bob": true, "dan": true}
+	if len(got) != len(want) {
+		t.Errorf("checked in = %v, want %v", got, want)
+	}
+	for user := range want {
+		if !got[user] {
+			t.Errorf("%s is not checked in, want checked in", user)
+		}
+	}
+}
+
+func TestPullEventbriteCheckins(t *testing.T) {
+	pages := map[string]string{
+		"": `{"attendees": [
+			{"id": "1", "checked_in": true, "profile": {"email": "Ann@Example.com"}},
+			{"id": "2", "checked_in": false, "profile": {"email": "bob@example.com"}}
+		], "pagination": {"has_more_items": true, "continuation": "page2"}}`,
+		"page2": `{"attendees": [
+			{"id": "3", "checked_in": true, "profile": {}}
+		], "pagination": {"has_more_items": false}}`,
+	}
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/events/ev1/attendees/" || r.URL.Query().Get("status") != "attending" {
+			t.Errorf("request for %s, want the attending attendees of ev1", r.URL)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q, want the token", got)
+		}
+		page, ok := pages[r.URL.Query().Get("continuation")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(json.RawMessage(page))
+	}))
+	defer srv.Close()
+
+	eb := &eventbriteClient{baseURL: srv.URL, token: "secret", eventID: "ev1", client: srv.Client()}
+	store := newMemoryStore()
+	synced := map[string]bool{}
+	added, err := pullEventbriteCheckins(context.Background(), eb, store, synced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 || requests != 2 {
+		t.Errorf("added %d check-ins in %d requests, want 2 in 2", added, requests)
+	}
+	for _, key := range []string{"id-1", "ann@example.com", "id-3"} {
+		if c, ok := store.Checkin(key); !ok || c.Source != "eventbrite" {
+			t.Errorf("check-in %s = %+v, %v, want one from Eventbrite", key, c, ok)
+		}
+	}
+	for _, key := range []string{"id-2", "bob@example.com", ""} {
+		if _, ok := store.Checkin(key); ok {
+			t.Errorf("check-in %q was written", key)
+		}
+	}
+
+	store.SetCheckin("id-1", Checkin{Source: "desk"})
+	added, err = pullEventbriteCheckins(context.Background(), eb, store, synced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 0 {
+		t.Errorf("second pull added %d check-ins, want 0", added)
+	}
+	if c, _ := store.Checkin("id-1"); c.Source != "desk" {
+		t.Errorf("check-in id-1 was rewritten by an attendee already synced")
+	}
+}
+
+func TestPullEventbriteCheckinsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	eb := &eventbriteClient{baseURL: srv.URL, token: "wrong", eventID: "ev1", client: srv.Client()}
+	if _, err := pullEventbriteCheckins(context.Background(), eb, newMemoryStore(), map[string]bool{}); err == nil {
+		t.Error("pull with a rejected token succeeded, want an error")
+	}
+}
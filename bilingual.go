@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// bilingual reports whether every host message is written in the two
+// languages of language.bilingual.
+func (b *Bot) bilingual() bool {
+	return len(b.cfg.Language.Bilingual) == 2
+}
+
+// bilingualInstruction asks the model for the reply in both languages at
+// once, as JSON keyed by language, each at most limit words.
+func bilingualInstruction(langs []string, limit int) string {
+	return fmt.Sprintf(`
+
+Write the reply twice, saying the same thing, once in %s and once in %s, each in at most %d words.
+Reply with only JSON of the form {%q: "...", %q: "..."}.`, languages[langs[0]], languages[langs[1]], limit, langs[0], langs[1])
+}
+
+// parseBilingual returns the texts of a bilingual reply, in the order of
+// langs, or an error if the reply isn't JSON or lacks either language.
+func parseBilingual(text string, langs []string) ([]string, error) {
+	var reply map[string]string
+	if err := json.Unmarshal([]byte(extractJSON(text)), &reply); err != nil {
+		return nil, fmt.Errorf("error parsing bilingual reply: %w", err)
+	}
+	texts := make([]string, len(langs))
+	for i, language := range langs {
+		if texts[i] = strings.TrimSpace(reply[language]); texts[i] == "" {
+			return nil, fmt.Errorf("bilingual reply has no %s text: %q", language, text)
+		}
+	}
+	return texts, nil
+}
+
+// bilingualReply splits a bilingual generation into its two texts, each
+// truncated to limit words and screened. The first is returned and the
+// second kept in ctx's pairedText for publishReply; an invalid generation
+// is returned as an error, for the caller to fall back as from a model
+// error.
+func (b *Bot) bilingualReply(ctx context.Context, userMessage, text string, limit int) (string, error) {
+	langs := b.cfg.Language.Bilingual
+	texts, err := parseBilingual(text, langs)
+	if err != nil {
+		b.metrics.bilingualInvalid.Add(1)
+		return "", err
+	}
+	for i, t := range texts {
+		if b.cfg.Length.Mode != lengthOff && limit > 0 && countWords(t) > limit {
+			b.metrics.overlongReplies.inc(lengthTruncate)
+			t = truncateWords(t, limit)
+		}
+		texts[i] = b.screenReply(ctx, userMessage, t)
+	}
+	b.ladder.remember(userMessage, texts[0])
+	if p, ok := ctx.Value(pairedKey{}).(*pairedText); ok {
+		*p = pairedText{language: langs[1], text: texts[1]}
+	}
+	return texts[0], nil
+}
+
+// pairedText is the second-language text of a bilingual host message,
+// left by generateResponse for the reply written with the same context.
+type pairedText struct {
+	language string
+	text     string
+}
+
+type pairedKey struct{}
+
+// withPairedText returns ctx with room for the second-language text of
+// the host message generated with it.
+func withPairedText(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pairedKey{}, &pairedText{})
+}
+
+// takePaired returns the second-language text generated with ctx, if any,
+// and clears it, so it goes with one reply only.
+func takePaired(ctx context.Context) (pairedText, bool) {
+	p, ok := ctx.Value(pairedKey{}).(*pairedText)
+	if !ok || p.text == "" {
+		return pairedText{}, false
+	}
+	paired := *p
+	*p = pairedText{}
+	return paired, true
+}
+
+// pairReply returns the ping carrying the second-language text of reply,
+// if ctx has one, and links the two by pairId.
+func (b *Bot) pairReply(ctx context.Context, reply *Message) (Message, bool) {
+	p, ok := takePaired(ctx)
+	if !ok {
+		return Message{}, false
+	}
+	paired := *reply
+	paired.ID = reply.ID + "-" + p.language
+	paired.Message, paired.Language, paired.PairID = p.text, p.language, reply.ID
+	reply.Language, reply.PairID = b.cfg.Language.Bilingual[0], paired.ID
+	return paired, true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseBilingual(t *testing.T) {
+	langs := []string{"english", "hindi"}
+	tests := []struct {
+		text    string
+		want    []string
+		wantErr bool
+	}{
+		{`{"english": "Welcome!", "hindi": "स्वागत है!"}`, []string{"Welcome!", "स्वागत है!"}, false},
+		{"Sure:\n```json\n{\"hindi\": \" स्वागत है! \", \"english\": \"Welcome!\"}\n```", []string{"Welcome!", "स्वागत है!"}, false},
+		{`{"english": "Welcome!", "hindi": ""}`, nil, true},
+		{`{"english": "Welcome!", "marathi": "स्वागत आहे!"}`, nil, true},
+		{"Welcome!", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseBilingual(tt.text, langs)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseBilingual(%q) error = %v, want error %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("parseBilingual(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBilingualReplies(t *testing.T) {
+	var mu sync.Mutex
+	var prompts []string
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		prompts = append(prompts, prompt)
+		if strings.Contains(prompt, "broken") {
+			return "Gemini is Google's model.", nil
+		}
+		return `{"english": "Gemini is Google's model.", "hindi": "जेमिनी गूगल का मॉडल है।"}`, nil
+	}))
+	b.cfg.Language.Bilingual = []string{"english", "hindi"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "What is Gemini?", Timestamp: time.Now()})
+	store.AddMessage(Message{ID: "m2", UserID: "bob", Message: "Is the broken demo fixed?", Timestamp: time.Now()})
+	waitFor(t, nil, "the replies", func() bool {
+		_, ok1 := store.Reply("m1")
+		_, ok2 := store.Reply("m2")
+		return ok1 && ok2
+	})
+
+	first, _ := store.Reply("m1")
+	second, ok := store.Reply("m1-hindi")
+	if !ok {
+		t.Fatal("no Hindi ping for m1")
+	}
+	if first.Message != "Gemini is Google's model." || first.Language != "english" || first.PairID != "m1-hindi" {
+		t.Errorf("first ping = %q in %q paired with %q, want the English text paired with m1-hindi", first.Message, first.Language, first.PairID)
+	}
+	if second.Message != "जेमिनी गूगल का मॉडल है।" || second.Language != "hindi" || second.PairID != "m1" {
+		t.Errorf("second ping = %q in %q paired with %q, want the Hindi text paired with m1", second.Message, second.Language, second.PairID)
+	}
+	if second.InReplyTo != "m1" || second.ThreadID != first.ThreadID {
+		t.Errorf("second ping answers %q in thread %q, want m1 in %q", second.InReplyTo, second.ThreadID, first.ThreadID)
+	}
+
+	// A generation without both languages falls back like a model error,
+	// to a single ping.
+	if reply, _ := store.Reply("m2"); reply.PairID != "" || reply.Message == "Gemini is Google's model." {
+		t.Errorf("invalid bilingual generation published %q paired with %q, want a fallback line alone", reply.Message, reply.PairID)
+	}
+	if _, ok := store.Reply("m2-hindi"); ok {
+		t.Error("invalid bilingual generation has a Hindi ping")
+	}
+	if n := b.metrics.bilingualInvalid.Load(); n != 1 {
+		t.Errorf("bilingualInvalid = %d, want 1", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	found := false
+	for _, p := range prompts {
+		if strings.Contains(p, `Reply with only JSON of the form {"english": "...", "hindi": "..."}`) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no prompt asked for both languages: %q", prompts)
+	}
+}
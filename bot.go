@@ -0,0 +1,961 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Bot hosts one event: it answers audience messages and speaks up on its
+// own from the monitor loop. Everything it needs is injected through NewBot,
+// so several bots can run side by side in one process. They do share the
+// process-wide clock and rng, so seed mode replays all of them on a single
+// timeline.
+type Bot struct {
+	cfg           *Config
+	client        *firestore.Client
+	model         ResponseGenerator
+	fallbackModel ResponseGenerator
+
+	// messages and polls are the stores the listener and monitor work
+	// through; the remaining features still use client directly.
+	messages MessageStore
+	polls    PollStore
+
+	// bus carries show events to subscribers such as the word cloud.
+	bus *eventBus
+	// words is the word cloud's subscription, taken in NewBot so that no
+	// message is missed before (or while) its worker is running.
+	words <-chan Event
+	// history is the conversation memory's subscription, for the same reason.
+	history <-chan Event
+	memory  *conversationMemory
+	// gaps is the knowledge gap recorder's subscription.
+	gaps <-chan Event
+	// failover names the active instance; promoted is closed, once, when
+	// a standby is promoted.
+	failover FailoverStore
+	promoted chan struct{}
+	promote  sync.Once
+	// flags is the moderation recorder's subscription.
+	flags     <-chan Event
+	moderator *moderator
+	// spam drops flooding senders; blockList holds the blocked ones.
+	spam      *spamFilter
+	blockList BlockListStore
+	// costs attributes model and Firestore use to features; costStore
+	// keeps the session's report.
+	costs     *costLedger
+	costStore CostStore
+	// counters batches increments to the counter documents in
+	// counterStore, such as the audience stats.
+	counters     *counterWriter
+	counterStore CounterStore
+	// pollGen remembers the polls the model wrote; imageGen draws their
+	// option images into images, nil without polls.imageBucket.
+	pollGen  pollGenerator
+	imageGen *imageGenerator
+	images   ImageStore
+	// showLog records the show for replaying, nil without Config.ShowLog;
+	// see showlog.go.
+	showLog *showRecorder
+	// calendar holds the content calendar of a multi-day event.
+	calendar CalendarStore
+	// leaderboard holds the players' points across quizzes.
+	leaderboard LeaderboardStore
+	// profiles holds attendee profiles; senderNames caches what the host
+	// calls each sender.
+	profiles    ProfileStore
+	senderNames sync.Map
+	// eligibility reads what poll eligibility rules are checked against.
+	eligibility EligibilityReader
+	// eventbrite lists Eventbrite attendees, whose check-ins are saved to
+	// checkins; nil unless an Eventbrite token is set.
+	eventbrite *eventbriteClient
+	checkins   CheckinStore
+	// prizes records the prizes awarded to winners and handed over.
+	prizes PrizeStore
+	// lifelines records the lifelines each player has used.
+	lifelines LifelineStore
+	// duel is the head-to-head duel running, if any.
+	duel duelState
+	// energy is how intense the host is at this point of the show; see
+	// energy.go.
+	energy energyState
+	// schedules holds the window of the session.
+	schedules ScheduleStore
+	// botState holds the checkpoint a restart resumes from.
+	botState BotStateStore
+	// catchUp holds the late answers to reprocessed messages.
+	catchUp CatchUpStore
+	// experiment picks the prompt variant of each audience reply, going by
+	// the reactions in feedback.
+	experiment *experiment
+	feedback   FeedbackStore
+	// sections counts recent messages per seating section, fed by
+	// sectionEvents.
+	sections      *sectionCounter
+	sectionEvents <-chan Event
+	// transcript is the transcript recorder's subscription.
+	transcript <-chan Event
+	// speech reads published replies out into audio, with its
+	// subscription in speechEvents; both are nil unless speech is enabled.
+	speech       Synthesizer
+	audio        ImageStore
+	speechEvents <-chan Event
+	// transcriber turns voice notes into text, nil unless transcription
+	// is enabled.
+	transcriber Transcriber
+	// drawings queues public replies to be drawn by imageGen; nil unless
+	// imageReplies.triggers are set.
+	drawings chan drawing
+	// queueStatus follows the listener's queue for attendees.
+	queueStatus *queueTracker
+	// sla times answers against the answer deadline.
+	sla *slaTracker
+	// summarize wakes the summarizer when the memory is full.
+	summarize chan struct{}
+	summaries SummaryStore
+	// announcements holds the admin's scheduled announcements.
+	announcements AnnouncementStore
+	summaryMu     sync.Mutex
+
+	// personas holds the characters the host can play.
+	personas *personaRegistry
+	// prompts renders the request text sent to the model.
+	prompts *template.Template
+	// retry covers transient Gemini and Firestore errors.
+	retry retryPolicy
+	// triage decides which audience messages get a public answer.
+	triage TriagePolicy
+
+	ladder     *degradationLadder
+	wordCloud  *wordCloudCounter
+	pseudonyms *pseudonymizer // nil unless anonymous mode is enabled
+
+	pacingMu sync.Mutex
+	pacing   Pacing
+
+	health     *runtimeHealth
+	supervisor *supervisor
+	metrics    *botMetrics
+	// pool is the listener's worker pool, nil until it starts.
+	pool atomic.Pointer[workerPool]
+
+	// highlightsSince is where the next automatic highlight reel starts,
+	// closedPolls the polls already announced as closed, pollResults
+	// the closed active poll whose results are yet to be announced, and
+	// buzzedIn the buzzer question whose owner is. Only the monitor
+	// goroutine touches them.
+	highlightsSince time.Time
+	closedPolls     map[string]bool
+	pollResults     *PollTally
+	buzzedIn        *PollTally
+	// amaAnnouncedAt is when the last AMA announced by the monitor opened,
+	// and sectionCalloutAt when it last called out a section.
+	amaAnnouncedAt   time.Time
+	sectionCalloutAt time.Time
+	idleTuner        idleTuner
+	// sponsorAt is when the monitor last gave a sponsor a shout-out, and
+	// sponsorNext the index of the day's sponsor to thank next.
+	sponsorAt   time.Time
+	sponsorNext int
+	// leaderboardScores are the quiz scores already carried over to the
+	// leaderboard, by quiz session and player; leaderboardStale is set when
+	// the room's copy of its top needs reloading.
+	leaderboardScores map[string]map[string]int
+	leaderboardStale  bool
+
+	// room is shared by the listener and the monitor without locking.
+	room *roomState
+}
+
+// NewBot returns a bot for cfg that reads and writes through client and
+// replies with model, falling back to fallbackModel when degraded. Its
+// message and poll stores are backed by client too; tests and local runs
+// may swap them for a memoryStore before starting the bot.
+func NewBot(cfg *Config, client *firestore.Client, model, fallbackModel ResponseGenerator) (*Bot, error) {
+	b := &Bot{
+		cfg:           cfg,
+		client:        client,
+		model:         model,
+		fallbackModel: fallbackModel,
+		ladder:        newDegradationLadder(cfg.Degradation),
+		queueStatus:   newQueueTracker(),
+		sla:           newSLATracker(cfg.SLA),
+		sections:      newSectionCounter(),
+		pacing:        normalPacing,
+		health:        newRuntimeHealth(),
+		supervisor:    newSupervisor(),
+		metrics:       newBotMetrics(),
+		room:          newRoomState(),
+		memory:        newConversationMemory(cfg.Monitor.HistoryTurns),
+		retry:         newRetryPolicy(cfg.Retry),
+		personas:      newPersonaRegistry(cfg.Personas, cfg.Persona),
+		summarize:     make(chan struct{}, 1),
+		triage:        newTriagePolicy(cfg.Triage),
+		moderator:     newModerator(cfg.Moderation),
+		spam:          newSpamFilter(cfg.RateLimit),
+		costs:         newCostLedger(cfg.Costs),
+		counters:      newCounterWriter(),
+		experiment:    newExperiment(cfg.Experiment),
+		promoted:      make(chan struct{}),
+		imageGen:      newImageGenerator(cfg.Polls.ImageGeneratorURL),
+		eventbrite:    newEventbriteClient(cfg.Eventbrite),
+
+		highlightsSince: clock.Now(),
+		energy:          energyState{started: clock.Now()},
+		closedPolls:     map[string]bool{},
+	}
+	b.wordCloud = newWordCloudCounter(b.moderator.blocked)
+	b.bus = newEventBus()
+	b.words, _ = b.bus.Subscribe(EventMessageReceived)
+	b.history, _ = b.bus.Subscribe(EventMessageReceived, EventResponsePublished)
+	b.gaps, _ = b.bus.Subscribe(EventKnowledgeGap)
+	b.flags, _ = b.bus.Subscribe(EventContentFlagged)
+	b.sectionEvents, _ = b.bus.Subscribe(EventMessageReceived)
+	b.transcript, _ = b.bus.Subscribe(EventResponsePublished)
+	if cfg.Speech.Enabled {
+		b.speechEvents, _ = b.bus.Subscribe(EventResponsePublished)
+	}
+	if len(cfg.ImageReplies.Triggers) > 0 {
+		b.drawings = make(chan drawing, drawingQueueSize)
+	}
+	b.ladder.notify = b.bus.Publish
+	prompts, err := loadPrompts(cfg.PromptsDir)
+	if err != nil {
+		return nil, err
+	}
+	b.prompts = prompts
+	b.room.controls.Store(&stageControls{
+		AutoTune:      cfg.Monitor.PromptReplyWindow.Duration > 0,
+		IdleThreshold: cfg.Monitor.IdleThreshold,
+		IdlePromptGap: cfg.Monitor.IdlePromptGap,
+		PollUpdateGap: cfg.Monitor.PollUpdateGap,
+	})
+	b.room.poll.Store(&activePoll{ID: cfg.Polls.IDs[0], Since: clock.Now()})
+	b.useStore(newFirestoreStore(client, cfg))
+	b.eligibility = newFirestoreEligibility(client, nil, cfg.Collections)
+	if cfg.AnonymousMode {
+		p, err := newPseudonymizer(cfg.pseudonymKey)
+		if err != nil {
+			return nil, fmt.Errorf("error enabling anonymous mode: %w", err)
+		}
+		b.pseudonyms = p
+	}
+	return b, nil
+}
+
+// useStore keeps all of the bot's state in s.
+func (b *Bot) useStore(s Store) {
+	b.messages = s
+	b.polls = s
+	b.summaries = s
+	b.announcements = s
+	b.failover = s
+	b.blockList = s
+	b.costStore = s
+	b.calendar = s
+	b.leaderboard = s
+	b.feedback = s
+	b.profiles = s
+	b.lifelines = s
+	b.schedules = s
+	b.botState = s
+	b.catchUp = s
+	b.counterStore = s
+	b.checkins = s
+	b.prizes = s
+}
+
+func (b *Bot) getPacing() Pacing {
+	b.pacingMu.Lock()
+	defer b.pacingMu.Unlock()
+	return b.pacing
+}
+
+func (b *Bot) setPacing(p Pacing) {
+	b.pacingMu.Lock()
+	defer b.pacingMu.Unlock()
+	if p.Slowdown != b.pacing.Slowdown || p.MaxWords != b.pacing.MaxWords {
+		b.bus.Publish(Event{
+			Kind:  EventStateChanged,
+			State: "pacing",
+			From:  b.pacing.String(),
+			To:    p.String(),
+		})
+	}
+	b.pacing = p
+}
+
+// notePollClosed publishes poll-closed the first time the monitor sees a
+// poll closed, at closedAt.
+func (b *Bot) notePollClosed(pollID string, closedAt time.Time) {
+	if clock.Now().Before(closedAt) || b.closedPolls[pollID] {
+		return
+	}
+	b.closedPolls[pollID] = true
+	b.bus.Publish(Event{Kind: EventPollClosed, PollID: pollID, At: closedAt})
+}
+
+// publishReply writes a host message, retrying transient errors, and
+// announces it on the bus. In bilingual mode the message generated with
+// ctx is written together with its second-language ping.
+func (b *Bot) publishReply(ctx context.Context, reply Message) error {
+	paired, bilingual := b.pairReply(ctx, &reply)
+	err := b.write(ctx, "write-reply", func(ctx context.Context) error {
+		if bilingual {
+			return b.messages.WriteReplyPair(ctx, reply, paired)
+		}
+		return b.messages.WriteReply(ctx, reply)
+	})
+	if err != nil {
+		return err
+	}
+	b.bus.Publish(Event{Kind: EventResponsePublished, MessageID: reply.ID, Text: reply.Message, Question: reply.Question, Language: reply.Language})
+	if bilingual {
+		b.bus.Publish(Event{Kind: EventResponsePublished, MessageID: paired.ID, Text: paired.Message, Question: paired.Question, Language: paired.Language, Pair: reply.ID})
+	}
+	return nil
+}
+
+// markProcessed marks an audience message processed, retrying transient
+// errors.
+func (b *Bot) markProcessed(ctx context.Context, id, userID string) error {
+	return b.write(ctx, "mark-processed", func(ctx context.Context) error { return b.messages.MarkProcessed(ctx, id, b.cfg.InstanceID, userID) })
+}
+
+// collectWordCloud feeds received audience messages into the word cloud.
+func (b *Bot) collectWordCloud(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-b.words:
+			b.wordCloud.add(e.Text)
+		}
+	}
+}
+
+// Mark all existing unprocessed messages as processed and skip them.
+func (b *Bot) markExistingMessagesAsProcessed(ctx context.Context) error {
+	messages, err := b.messages.Unprocessed(ctx)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		userID, err := b.pseudonyms.anonymize(ctx, b.client, b.cfg.Collections.Pseudonyms, msg.UserID)
+		if err != nil {
+			return fmt.Errorf("error anonymizing user: %w", err)
+		}
+
+		// Mark the message as processed immediately, unless another
+		// replica is answering it
+		err = b.markProcessed(ctx, msg.ID, userID)
+		if errors.Is(err, errClaimLost) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error marking message as processed: %w", err)
+		}
+
+		slog.Debug("existing message marked as processed", "messageId", msg.ID)
+	}
+
+	return nil
+}
+
+// This function listens for only new incoming user messages (already processed messages are skipped).
+// listenForNewUserMessages hands new audience messages to cfg.Workers
+// workers as they arrive; see processMessage. Each snapshot's new messages
+// are triaged together and queued in the order triage ranked them; those
+// the queue has no room for wait in the pool's backlog. It returns when
+// ctx is done or the snapshot stream fails, once the workers have
+// finished.
+func (b *Bot) listenForNewUserMessages(ctx context.Context) error {
+	ctx = b.costs.attribute(ctx, featureQA)
+	pool := newWorkerPool(b.cfg.Workers)
+	b.pool.Store(pool)
+	var wg sync.WaitGroup
+	for range b.cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range pool.jobs {
+				pool.busy.Add(1)
+				b.processMessage(ctx, pool, t)
+				pool.busy.Add(-1)
+				pool.fill()
+			}
+		}()
+	}
+	go pool.refill()
+
+	err := b.metrics.listen(func() error {
+		return b.messages.Watch(ctx, func(batch []*Message) error {
+			received := time.Now()
+			b.health.listenerLastSnapshot.Store(received.UnixNano())
+			b.queueStatus.observe(batch)
+			triaged := b.triageBatch(pool.claim(batch))
+			for i := range triaged {
+				triaged[i].Received = received
+			}
+			pool.queue(triaged)
+			return nil
+		})
+	})
+	pool.close()
+	wg.Wait()
+	return err
+}
+
+// handleUserMessage answers one audience message as decided by triage and
+// marks it processed.
+func (b *Bot) handleUserMessage(ctx context.Context, msg *Message, decision triageDecision) error {
+	return b.resumeUserMessage(ctx, msg, decision, &messageProgress{})
+}
+
+// messageProgress is what earlier attempts at one message got done, so a
+// retry picks up at the step that failed: the message is counted,
+// published and recorded once, and the model is not asked again for an
+// answer or question it already gave.
+type messageProgress struct {
+	received   bool
+	screened   bool
+	blocked    bool
+	duelAnswer bool
+	published  bool
+	dropped    bool
+	answered   bool
+	answer     string
+	context    string
+	silenced   bool
+	question   *string
+	paired     pairedText
+	replied    bool
+}
+
+// resumeUserMessage is handleUserMessage for an attempt that skips the
+// steps p records as done. msg must be the one earlier attempts were given,
+// as they rewrite it.
+func (b *Bot) resumeUserMessage(ctx context.Context, msg *Message, decision triageDecision, p *messageProgress) error {
+	if !p.received {
+		b.costs.item(featureQA)
+		b.recordShowInput(msg)
+		p.received = true
+	}
+	logger := loggerFrom(ctx)
+	logger.Debug("message received", "section", msg.Section, "decision", decision.String())
+	if b.cfg.Shards.Count > 1 && msg.Shard != messageShard(msg.ID, b.cfg.Shards.Count) {
+		logger.Warn("message has the wrong shard; check the client's shard hash", "shard", msg.Shard, "expected", messageShard(msg.ID, b.cfg.Shards.Count))
+	}
+
+	// Voice notes are answered, and screened, by what was said in them;
+	// queued ones were transcribed by the ingest worker.
+	if msg.Audio != "" && msg.Message == "" {
+		ok, err := b.transcribeMessage(ctx, msg)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := b.markProcessed(ctx, msg.ID, msg.UserID); err != nil {
+				return fmt.Errorf("error marking message as processed: %w", err)
+			}
+			b.health.messagesProcessed.Add(1)
+			return nil
+		}
+	}
+
+	// Queued messages were anonymized by the ingest worker.
+	var err error
+	if b.cfg.Role != roleResponder {
+		msg.UserID, err = b.pseudonyms.anonymize(ctx, b.client, b.cfg.Collections.Pseudonyms, msg.UserID)
+		if err != nil {
+			return fmt.Errorf("error anonymizing user: %w", err)
+		}
+		if !p.screened {
+			p.blocked = b.filterSpam(msg) || b.screenMessage(ctx, msg)
+			if p.blocked {
+				b.countStat(statScreened)
+			}
+			p.screened = true
+		}
+		if p.blocked {
+			if err := b.markProcessed(ctx, msg.ID, msg.UserID); err != nil {
+				return fmt.Errorf("error marking message as processed: %w", err)
+			}
+			b.health.messagesProcessed.Add(1)
+			return nil
+		}
+	}
+	if b.cfg.Role == roleIngest {
+		return b.enqueue(ctx, msg, decision)
+	}
+	if !p.published && !p.duelAnswer {
+		p.duelAnswer = b.recordDuelAnswer(msg)
+	}
+	if p.duelAnswer {
+		if err := b.markProcessed(ctx, msg.ID, msg.UserID); err != nil {
+			return fmt.Errorf("error marking message as processed: %w", err)
+		}
+		logger.Debug("duel answer recorded")
+		b.health.messagesProcessed.Add(1)
+		return nil
+	}
+	if lifeline := parseLifeline(msg.Message); lifeline != "" {
+		return b.handleLifeline(ctx, msg, lifeline)
+	}
+
+	if !p.published {
+		b.bus.Publish(Event{Kind: EventMessageReceived, MessageID: msg.ID, UserID: msg.UserID, Text: msg.Message, Section: msg.Section})
+		b.countStat(statMessages)
+		b.room.lastUserMessage.Store(clock.Now())
+		p.published = true
+	}
+
+	if !msg.Timestamp.IsZero() {
+		b.health.snapshotLagMillis.Store(time.Since(msg.Timestamp).Milliseconds())
+	}
+	b.health.messagesInFlight.Add(1)
+	defer b.health.messagesInFlight.Add(-1)
+
+	if decision == drop {
+		if !p.dropped {
+			b.countStat(statDropped)
+			p.dropped = true
+		}
+		if err := b.markProcessed(ctx, msg.ID, msg.UserID); err != nil {
+			return fmt.Errorf("error marking message as processed: %w", err)
+		}
+		b.health.messagesProcessed.Add(1)
+		return nil
+	}
+
+	// The answer's second language, in bilingual mode, is left in ctx, in
+	// room kept with the progress for a retry that writes the reply.
+	ctx = context.WithValue(ctx, pairedKey{}, &p.paired)
+
+	// Rephrase the question for the screen while the answer is generated
+	question := make(chan string, 1)
+	if p.question != nil {
+		question <- *p.question
+	} else if decision == answerPublic {
+		go func() { question <- rephraseQuestion(ctx, b.ladderModel(), msg.Message) }()
+	} else {
+		question <- ""
+	}
+
+	// Generate response
+	persona := b.personas.current().Name
+	variant := b.experiment.pick(persona)
+	language := b.replyLanguage(msg.Message)
+	reply := b.replyTo(ctx, msg, Message{Persona: persona, Variant: variant, Language: language})
+	if !p.answered {
+		var onText func(string)
+		if decision == answerPublic && b.cfg.Streaming.Enabled {
+			onText = b.replyStreamer(ctx, reply)
+		}
+		p.answer, p.context, err = b.composeAnswer(withLanguage(withVariant(ctx, variant), language), msg, onText)
+		if err != nil && !errors.Is(err, errSilenced) {
+			if p.question == nil {
+				q := <-question
+				p.question = &q
+			}
+			return fmt.Errorf("error generating response: %w", err)
+		}
+		p.answered, p.silenced = true, err != nil
+		logger.Debug("response generated", "persona", persona, "variant", variant, "language", language, "silenced", p.silenced)
+	}
+
+	// Write response to Firestore, unless the host has been silenced
+	if !p.silenced && !p.replied {
+		if p.question == nil {
+			q := <-question
+			p.question = &q
+		}
+		reply.Message, reply.Context, reply.Question = p.answer, p.context, *p.question
+		stat := statPublicReplies
+		if decision == answerPrivate {
+			stat = statPrivateReplies
+			// Only the sender sees a private reply, so it has both
+			// languages in one.
+			if paired, ok := takePaired(ctx); ok {
+				reply.Message += "\n\n" + paired.text
+			}
+			err = b.write(ctx, "write-private-reply", func(ctx context.Context) error { return b.messages.WritePrivateReply(ctx, reply) })
+		} else if err = b.publishReply(ctx, reply); err == nil {
+			b.queueDrawing(msg, reply.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("error writing response message: %w", err)
+		}
+		p.replied = true
+		b.countStat(stat)
+		b.metrics.replyLanguages.inc(language)
+		logger.Debug("response written", "replyId", reply.ID)
+		b.recordAnswer(msg)
+	}
+
+	// Mark the message as processed
+	if err := b.markProcessed(ctx, msg.ID, msg.UserID); err != nil {
+		return fmt.Errorf("error marking message as processed: %w", err)
+	}
+
+	// Update last response time
+	b.room.lastResponseTime.StoreLater(clock.Now())
+	logger.Info("message processed", "response", p.answer)
+	b.health.messagesProcessed.Add(1)
+	return nil
+}
+
+// composeAnswer builds the prompt context for an audience message and
+// generates the host's answer from it. A question the host can't answer
+// from what it knows is reported as a knowledge gap and sent to the info
+// desk instead.
+func (b *Bot) composeAnswer(ctx context.Context, msg *Message, onText func(string)) (answer, promptContext string, err error) {
+	summary := b.room.getSummary()
+	promptContext = b.userContext(ctx, summary, msg)
+	earlier := strings.TrimPrefix(promptContext, summary)
+	promptContext = b.nameContext(ctx, promptContext, msg)
+	promptContext = b.amaContext(ctx, promptContext, msg.Message)
+	beforeFAQ := promptContext
+	promptContext, grounded := b.groundQuestion(promptContext, msg.Message)
+	faq := strings.TrimPrefix(promptContext, beforeFAQ)
+	ctx = withPromptParts(ctx, promptParts{summary: summary, retrieved: []string{earlier, faq}})
+	answer, err = b.generateResponse(ctx, msg.Message, promptContext, onText)
+	if err != nil {
+		return "", promptContext, err
+	}
+	if reason := b.gapReason(msg.Message, answer, grounded); reason != "" {
+		b.bus.Publish(Event{Kind: EventKnowledgeGap, MessageID: msg.ID, Text: msg.Message, Reason: reason})
+		answer = b.infoDeskLine()
+		takePaired(ctx)
+	}
+	return answer, promptContext, nil
+}
+
+func (b *Bot) monitorAndRespond(ctx context.Context) error {
+	ctx = b.costs.attribute(ctx, featureMonitor)
+	ticker := clock.NewTicker(b.cfg.Monitor.TickInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			b.health.monitorLastTick.Store(time.Now().UnixNano())
+
+			if err := b.ladder.flushAlerts(ctx, b.client, b.cfg.Collections.Alerts); err != nil {
+				return fmt.Errorf("error writing moderator alerts: %w", err)
+			}
+
+			// The word cloud and pacing are cosmetic: a failed write or read
+			// is retried next tick rather than stopping the monitor.
+			shards, err := b.shardActivity(ctx)
+			if err != nil {
+				slog.Error("error reading shard activity", "err", err)
+			}
+			var shardTerms [][]WordCloudTerm
+			sectionLists := [][]SectionWeight{b.sections.snapshot(clock.Now())}
+			var shardLastMessage time.Time
+			for _, a := range shards {
+				shardTerms = append(shardTerms, a.Terms)
+				sectionLists = append(sectionLists, a.Sections)
+				if a.LastUserMessage.After(shardLastMessage) {
+					shardLastMessage = a.LastUserMessage
+				}
+			}
+
+			if err := b.wordCloud.write(ctx, b.client, b.cfg.Collections.WordCloud, shardTerms...); err != nil {
+				slog.Error("error writing word cloud", "err", err)
+			} else {
+				countOps(ctx, 0, 1)
+			}
+			sections := mergeSections(sectionLists...)
+			if len(sections) > 0 {
+				if err := writeSectionActivity(ctx, b.client, b.cfg.Collections.Sections, sections); err != nil {
+					slog.Error("error writing section activity", "err", err)
+				} else {
+					countOps(ctx, 0, 1)
+				}
+			}
+
+			pacing, err := updatePacing(ctx, b.client, b.cfg.Collections.Telemetry)
+			if err != nil {
+				slog.Error("error updating pacing, keeping the previous pace", "err", err)
+				pacing = b.getPacing()
+			}
+			b.setPacing(pacing)
+
+			quizAnnouncements, err := b.updateQuizSessions(ctx)
+			if err != nil {
+				return fmt.Errorf("error updating quiz sessions: %w", err)
+			}
+			if err := b.refreshLeaderboard(ctx); err != nil {
+				slog.Error("error refreshing leaderboard", "err", err)
+			}
+			if err := b.refreshSchedule(ctx); err != nil {
+				slog.Error("error refreshing schedule", "err", err)
+			}
+
+			currentTime := clock.Now()
+			b.advanceEnergy(currentTime)
+
+			pollCtx := b.costs.attribute(ctx, featurePollUpdate)
+			b.rotatePoll(ctx, currentTime)
+			pollSummary, err := b.fetchPollStatus(pollCtx)
+			if err != nil {
+				return fmt.Errorf("error fetching poll status: %w", err)
+			}
+
+			if pollSummary != b.room.getPollStatus() {
+				b.room.setPollStatus(pollSummary)
+				b.bus.Publish(Event{Kind: EventPollUpdated, PollID: b.activePollID(), Text: pollSummary})
+			}
+			b.refreshSummary()
+
+			live := b.sessionLive(currentTime)
+			announcements := append(b.sessionAnnouncements(currentTime), quizAnnouncements...)
+			announcements = append(announcements, b.amaAnnouncements()...)
+			announcements = append(announcements, b.duelAnnouncements(ctx)...)
+			if live {
+				announcements = append(announcements, b.sponsorAnnouncements()...)
+			}
+			announcements = append(announcements, b.buzzAnnouncements(ctx)...)
+			announcements = append(announcements, b.pollResultsAnnouncements()...)
+			for _, a := range append(announcements, b.sectionAnnouncements(sections)...) {
+				ctx := withPairedText(b.costs.attribute(ctx, featureAnnouncement))
+				b.costs.item(featureAnnouncement)
+				promptMessage, err := b.generateResponse(ctx, a.Kind, a.Text, nil)
+				if errors.Is(err, errSilenced) {
+					break
+				}
+				if err != nil {
+					return fmt.Errorf("error generating %s announcement: %w", a.Kind, err)
+				}
+
+				err = b.publishReply(ctx, hostPrompt(promptMessage, a.Text))
+				if err != nil {
+					return fmt.Errorf("error writing %s announcement: %w", a.Kind, err)
+				}
+				if a.Done != nil {
+					if err := a.Done(ctx); err != nil {
+						return fmt.Errorf("error recording %s announcement: %w", a.Kind, err)
+					}
+				}
+				b.room.lastResponseTime.StoreLater(clock.Now())
+			}
+
+			lastUserMessage := b.room.lastUserMessage.Load()
+			lastResponseTime := b.room.lastResponseTime.Load()
+			if shardLastMessage.After(lastUserMessage) {
+				lastUserMessage = shardLastMessage
+			}
+
+			// Outside the session the host stays quiet as if paused.
+			controls := b.room.controls.Load()
+			if !live {
+				paused := *controls
+				paused.Paused = true
+				controls = &paused
+			}
+			b.observeIdlePrompt(currentTime, lastUserMessage)
+			switch autoPrompt(controls, pacing, currentTime, lastUserMessage, lastResponseTime, b.room.announcePoll.Swap(false)) {
+			case "prompt":
+				ctx := withPairedText(b.costs.attribute(ctx, featureIdlePrompt))
+				b.costs.item(featureIdlePrompt)
+				summary := b.room.getSummary()
+				promptMessage, err := b.generateResponse(withPromptParts(ctx, promptParts{summary: summary}), "prompt", summary, nil)
+				if errors.Is(err, errSilenced) {
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("error generating prompt: %w", err)
+				}
+
+				err = b.publishReply(ctx, hostPrompt(promptMessage, summary))
+				if err != nil {
+					return fmt.Errorf("error writing prompt message: %w", err)
+				}
+				b.room.lastResponseTime.StoreLater(clock.Now())
+				b.metrics.autoPrompts.inc("prompt")
+				b.promptSent(currentTime)
+			case "poll-update":
+				ctx := withPairedText(pollCtx)
+				b.costs.item(featurePollUpdate)
+				updateMessage := fmt.Sprintf("Poll update: %s", pollSummary)
+
+				promptMessage, err := b.generateResponse(ctx, "poll-update", updateMessage, nil)
+				if errors.Is(err, errSilenced) {
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("error generating prompt: %w", err)
+				}
+
+				err = b.publishReply(ctx, hostPrompt(promptMessage, updateMessage))
+				if err != nil {
+					return fmt.Errorf("error writing prompt message: %w", err)
+				}
+				b.room.lastResponseTime.StoreLater(clock.Now())
+				b.metrics.autoPrompts.inc("poll-update")
+			}
+		}
+	}
+}
+
+// refreshSummary rebuilds the room's prompt context from the latest poll
+// status and conversation memory. Writers take summaryMu so that an older
+// rendering never overwrites a newer one; readers stay lock-free.
+func (b *Bot) refreshSummary() {
+	b.summaryMu.Lock()
+	defer b.summaryMu.Unlock()
+	b.room.setSummary(b.roomSummary(b.memory.render()))
+}
+
+// roomSummary is the state of the room the host's replies draw on, around
+// the conversation history.
+func (b *Bot) roomSummary(history string) string {
+	summary := fmt.Sprintf("Current poll status:\n%s\nConversation history:\n%s", b.room.getPollStatus(), history)
+	if top := b.room.leaderboard.Load(); top != nil {
+		if text := leaderboardText(*top); text != "" {
+			summary = text + "\n" + summary
+		}
+	}
+	if d := b.contentDay(); d != nil && d.Theme != "" {
+		summary = fmt.Sprintf("Today's theme: %s\n%s", d.Theme, summary)
+	}
+	return summary
+}
+
+// generate calls the model for level, the primary or the fallback one,
+// retrying transient errors, and feeds the outcome of every attempt to the
+// ladder. If onText is set and the model can stream, it is called with the
+// reply so far as it is generated; a retried attempt starts over.
+func (b *Bot) generate(ctx context.Context, level degradationLevel, prompt string, onText func(partial string)) (string, error) {
+	m := b.model
+	if level == levelCheapModel {
+		m = b.fallbackModel
+	}
+	ctx, span := startSpan(ctx, "model.generate", trace.WithAttributes(attribute.String("level", level.String())))
+	var text string
+	var attempts int
+	err := b.retry.do(ctx, func(ctx context.Context) error {
+		attempts++
+		start := time.Now()
+		var err error
+		if sm, ok := m.(streamingGenerator); ok && onText != nil {
+			text, err = sm.GenerateStream(ctx, prompt, onText)
+		} else {
+			text, err = m.Generate(ctx, prompt)
+		}
+		b.metrics.modelLatency.observe(time.Since(start))
+		// A safety block is the model working as intended.
+		if errors.Is(err, errSafetyBlocked) {
+			b.ladder.record(nil, time.Since(start))
+		} else {
+			b.ladder.record(err, time.Since(start))
+		}
+		return err
+	})
+	span.SetAttributes(attribute.Int("attempts", attempts), attribute.Bool("safety_blocked", errors.Is(err, errSafetyBlocked)))
+	if err != nil && !errors.Is(err, errSafetyBlocked) {
+		b.metrics.generationFailures.Add(1)
+		endSpan(span, err)
+	} else {
+		span.End()
+	}
+	return text, err
+}
+
+// ladderModel is the ResponseGenerator for structured output such as quiz
+// questions: it uses whichever model the ladder currently allows, and fails
+// below the model rungs since cached or canned text cannot stand in.
+func (b *Bot) ladderModel() ResponseGenerator {
+	return generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		level := b.ladder.current()
+		if level > levelCheapModel {
+			return "", fmt.Errorf("no model available at %s level", level)
+		}
+		return b.generate(ctx, level, prompt, nil)
+	})
+}
+
+// generateResponse produces the host's reply at the degradation ladder's
+// current level. A model call that still fails after retrying is answered
+// from the next rung down, ending with a canned host line, rather than
+// returned, so the show goes on. onText, if set, is passed to generate.
+func (b *Bot) generateResponse(ctx context.Context, userMessage, promptContext string, onText func(partial string)) (string, error) {
+	persona := b.personas.current()
+	maxWords := b.wordLimit(userMessage, b.getPacing(), persona)
+	language := languages[b.languageFrom(ctx)]
+	if b.bilingual() {
+		// Partial JSON is no use to the audience.
+		langs := b.cfg.Language.Bilingual
+		language, onText = languages[langs[0]]+" and "+languages[langs[1]], nil
+	}
+	requestText, err := b.fitPrompt(withGeneration(ctx, persona.Generation), promptData{
+		Persona:  persona,
+		MaxWords: maxWords,
+		Message:  userMessage,
+		Context:  promptContext,
+		History:  b.memory.render(),
+		Variant:  variantFrom(ctx),
+		Language: language,
+	})
+	if err != nil {
+		return "", err
+	}
+	if b.bilingual() {
+		requestText += bilingualInstruction(b.cfg.Language.Bilingual, maxWords)
+	}
+
+	level := b.ladder.current()
+	if level == levelSilent {
+		return "", errSilenced
+	}
+
+	if level <= levelCheapModel {
+		text, err := b.generate(withGeneration(ctx, persona.Generation), level, requestText, onText)
+		if errors.Is(err, errSafetyBlocked) {
+			b.bus.Publish(Event{Kind: EventContentFlagged, Question: userMessage, Stage: stageResponse, Action: moderationBlock, Reason: "model safety filters"})
+			return b.ladder.cannedLine(), nil
+		}
+		if err == nil && b.bilingual() {
+			if text, err = b.bilingualReply(ctx, userMessage, text, maxWords); err == nil {
+				return text, nil
+			}
+		} else if err == nil {
+			text = b.enforceLength(ctx, level, userMessage, requestText, text, maxWords)
+			text = b.screenReply(ctx, userMessage, text)
+			b.ladder.remember(userMessage, text)
+			return text, nil
+		}
+		loggerFrom(ctx).Warn("model error", "level", level.String(), "err", err)
+	}
+
+	if hostPromptKinds[userMessage] && userMessage != "prompt" {
+		return promptContext, nil
+	}
+	if level <= levelCached {
+		if answer, ok := b.ladder.cachedAnswer(userMessage); ok {
+			b.ladder.cacheHit()
+			return answer, nil
+		}
+		if level == levelCached {
+			b.ladder.cacheMiss()
+		}
+	}
+	return b.ladder.cannedLine(), nil
+}
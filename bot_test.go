@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestBot returns a bot on default config, backed by store and answering
+// with model, without any Firestore client.
+func newTestBot(t *testing.T, store *memoryStore, model ResponseGenerator) *Bot {
+	t.Helper()
+	var cfg Config
+	cfg.applyDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBot(&cfg, nil, model, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.useStore(store)
+	b.eligibility = store
+	return b
+}
+
+func TestListenerAnswersNewMessages(t *testing.T) {
+	store := newMemoryStore()
+	store.AddMessage(Message{ID: "old", UserID: "ann", Message: "hello from before the show"})
+
+	var mu sync.Mutex
+	var prompts []string
+	model := generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "Rephrase") {
+			return `"What is Gemini, exactly?"`, nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		prompts = append(prompts, prompt)
+		return "Namaste, devi aur sajjano!", nil
+	})
+	b := newTestBot(t, store, model)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := b.markExistingMessagesAsProcessed(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	store.AddMessage(Message{ID: "m1", UserID: "bob", Message: "What is Gemini?"})
+
+	deadline := time.After(5 * time.Second)
+	for {
+		if _, ok := store.Reply("m1"); ok {
+			break
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("listener stopped: %v", err)
+		case <-deadline:
+			t.Fatal("no reply to m1")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("listener returned %v after cancel", err)
+	}
+
+	if got := store.replyIDs(); len(got) != 1 || got[0] != "m1" {
+		t.Errorf("replies = %v, want only m1", got)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "What is Gemini?") {
+		t.Errorf("prompts = %q, want one prompt for m1", prompts)
+	}
+	if reply, _ := store.Reply("m1"); reply.Question != "What is Gemini, exactly?" {
+		t.Errorf("reply question = %q, want the rephrased question", reply.Question)
+	}
+	for _, id := range []string{"old", "m1"} {
+		if m, _ := store.Message(id); !m.Processed {
+			t.Errorf("message %s not marked processed", id)
+		}
+	}
+}
+
+func TestComposeAnswerPrompt(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.SetPoll("q1", PollQuestion{Question: "Chai or coffee?", Options: map[string]PollOption{
+		"a": {Label: "A", OpText: "Chai", Voters: []string{"ann", "bob"}},
+		"b": {Label: "B", OpText: "Coffee", Voters: []string{"cat"}},
+	}})
+	store.SetProfile("ann", Profile{DisplayName: "Ann"})
+	store.AddMessage(Message{ID: "m0", UserID: "ann", Message: "Is chai winning?"})
+	store.MarkProcessed(ctx, "m0", "", "ann")
+	var prompt string
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, p string) (string, error) {
+		prompt = p
+		return "Chai, by a kettle's length!", nil
+	}))
+	status, err := b.fetchPollStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.room.setPollStatus(status)
+	b.memory.add(conversationTurn{From: "Audience (bob)", Text: "Coffee forever"})
+	b.refreshSummary()
+
+	answer, _, err := b.composeAnswer(ctx, &Message{ID: "m1", UserID: "ann", Message: "And now?"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "Chai, by a kettle's length!" {
+		t.Errorf("answer = %q, want the model's", answer)
+	}
+	for _, want := range []string{
+		"Current poll status:\nQuestion: Chai or coffee?\nA - Chai: 2 votes\nB - Coffee: 1 votes\n",
+		"Conversation history:\nAudience (bob): Coffee forever",
+		"This user asked before, most recent first; refer back to it if this is a follow-up:\n- \"Is chai winning?\"",
+		"This user goes by \"Ann\"",
+		"User said: And now?",
+		"Use at most 30 words.",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt = %q, want it to contain %q", prompt, want)
+		}
+	}
+}
+
+func TestListenerAnswersInParallel(t *testing.T) {
+	const workers = 3
+	store := newMemoryStore()
+	for _, id := range []string{"m1", "m2", "m3"} {
+		store.AddMessage(Message{ID: id, Message: "question " + id + "?"})
+	}
+
+	// Every reply waits until all three are being generated at once.
+	started := make(chan struct{}, workers)
+	release := make(chan struct{})
+	model := generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "Rephrase") {
+			return "question?", nil
+		}
+		started <- struct{}{}
+		select {
+		case <-release:
+			return "answer", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	})
+	b := newTestBot(t, store, model)
+	b.cfg.Workers = workers
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	for range workers {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("replies were not generated in parallel")
+		}
+	}
+	close(release)
+
+	deadline := time.After(5 * time.Second)
+	for len(store.replyIDs()) < workers {
+		select {
+		case <-deadline:
+			t.Fatalf("replies = %v, want m1, m2 and m3", store.replyIDs())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("listener returned %v after cancel", err)
+	}
+}
+
+func TestListenerSkipsMessagesClaimedElsewhere(t *testing.T) {
+	store := newMemoryStore()
+	store.AddMessage(Message{ID: "theirs", Message: "hi"})
+	if ok, err := store.Claim(context.Background(), "theirs", "other-replica", time.Hour); !ok || err != nil {
+		t.Fatalf("Claim = %v, %v", ok, err)
+	}
+	store.AddMessage(Message{ID: "ours", Message: "hello"})
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "namaste", nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	deadline := time.After(5 * time.Second)
+	for {
+		if m, _ := store.Message("ours"); m.Processed {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("ours was never answered")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	if got := store.replyIDs(); len(got) != 1 || got[0] != "ours" {
+		t.Errorf("replies = %v, want only ours", got)
+	}
+	if m, _ := store.Message("theirs"); m.Processed {
+		t.Error("a message claimed by another replica was processed")
+	}
+}
+
+func TestListenerRenewsClaimWhileAnswering(t *testing.T) {
+	store := newMemoryStore()
+	store.AddMessage(Message{ID: "m1", Message: "hi"})
+	release := make(chan struct{})
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		<-release
+		return "hello", nil
+	}))
+	b.cfg.ClaimLease = Duration{60 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	waitFor(t, done, "m1 to be claimed", func() bool {
+		m, _ := store.Message("m1")
+		return m.ClaimedBy == b.cfg.InstanceID
+	})
+
+	// Well past the lease, the claim still holds.
+	time.Sleep(200 * time.Millisecond)
+	if ok, err := store.Claim(ctx, "m1", "other-replica", b.cfg.ClaimLease.Duration); ok || err != nil {
+		t.Errorf("another replica's Claim = %v, %v while m1 is answered, want false", ok, err)
+	}
+	close(release)
+	waitFor(t, done, "m1 to be answered", func() bool {
+		m, _ := store.Message("m1")
+		return m.Processed
+	})
+	cancel()
+	<-done
+}
+
+func TestMarkProcessedChecksClaim(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.AddMessage(Message{ID: "m1", Message: "hi"})
+	store.AddMessage(Message{ID: "m2", Message: "hello"})
+	store.Claim(ctx, "m1", "theirs", time.Hour)
+
+	if err := store.MarkProcessed(ctx, "m1", "ours", "ann"); !errors.Is(err, errClaimLost) {
+		t.Errorf("MarkProcessed of a message claimed by another owner = %v, want %v", err, errClaimLost)
+	}
+	if m, _ := store.Message("m1"); m.Processed {
+		t.Error("a message claimed by another owner was marked processed")
+	}
+	if err := store.MarkProcessed(ctx, "m1", "theirs", "ann"); err != nil {
+		t.Errorf("MarkProcessed by the owner = %v", err)
+	}
+	if err := store.MarkProcessed(ctx, "m2", "ours", "bob"); err != nil {
+		t.Errorf("MarkProcessed of an unclaimed message = %v", err)
+	}
+}
+
+func TestListenerDeadLettersFailingMessages(t *testing.T) {
+	store := newMemoryStore()
+	store.AddMessage(Message{ID: "m1", Message: "hi"})
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "hello", nil
+	}))
+	replies := &failingReplies{memoryStore: store}
+	replies.failing.Store(true)
+	b.messages = replies
+	b.cfg.DeadLetterAfter = 2
+	b.retry = retryPolicy{attempts: 1, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	go b.requeueDeadLetters(ctx)
+
+	waitFor(t, done, "m1 to be dead-lettered", func() bool {
+		_, ok := store.DeadLetterFor("m1")
+		return ok
+	})
+	dl, _ := store.DeadLetterFor("m1")
+	if dl.Attempts != 2 || !strings.Contains(dl.Error, errReplyFailed.Error()) || dl.Message != "hi" {
+		t.Errorf("dead letter = %+v, want 2 attempts failing with %q", dl, errReplyFailed)
+	}
+	if m, _ := store.Message("m1"); !m.Processed || !m.DeadLettered {
+		t.Errorf("message = %+v, want it processed and dead-lettered", m)
+	}
+
+	// An operator fixes the cause and flags the message for requeueing.
+	replies.failing.Store(false)
+	store.FlagRequeue("m1")
+	waitFor(t, done, "a reply to the requeued m1", func() bool {
+		_, ok := store.Reply("m1")
+		return ok
+	})
+	if _, ok := store.DeadLetterFor("m1"); ok {
+		t.Error("dead letter kept after requeueing")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("listener returned %v after cancel", err)
+	}
+}
+
+func TestListenerRetriesOnlyTheFailedStep(t *testing.T) {
+	store := newMemoryStore()
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "What is Gemini?"})
+	var answers, rephrasings atomic.Int32
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "Rephrase") {
+			rephrasings.Add(1)
+			return "What is Gemini?", nil
+		}
+		answers.Add(1)
+		return "A family of models.", nil
+	}))
+	replies := &failingReplies{memoryStore: store}
+	replies.failures.Store(2)
+	b.messages = replies
+	b.cfg.DeadLetterAfter = 3
+	b.retry = retryPolicy{attempts: 1, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+	received, unsubscribe := b.bus.Subscribe(EventMessageReceived)
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	waitFor(t, done, "a reply to m1", func() bool {
+		m, _ := store.Message("m1")
+		return m.Processed
+	})
+	cancel()
+	<-done
+
+	if _, ok := store.DeadLetterFor("m1"); ok {
+		t.Error("m1 was dead-lettered, want it answered on the third attempt")
+	}
+	if r, _ := store.Reply("m1"); r.Message != "A family of models." {
+		t.Errorf("reply = %q, want the answer", r.Message)
+	}
+	if n := len(received); n != 1 {
+		t.Errorf("message received published %d times, want once", n)
+	}
+	pending, _ := b.counters.take()
+	if got := pending[statsDoc]; got[statMessages] != 1 || got[statPublicReplies] != 1 {
+		t.Errorf("stats = %v, want the message and its reply counted once", got)
+	}
+	if answers.Load() != 1 || rephrasings.Load() != 1 {
+		t.Errorf("model asked for %d answers and %d rephrasings, want 1 each", answers.Load(), rephrasings.Load())
+	}
+}
+
+// waitFor polls cond until it holds, failing if the listener stops first.
+func waitFor(t *testing.T, listener <-chan error, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for !cond() {
+		select {
+		case err := <-listener:
+			t.Fatalf("listener stopped waiting for %s: %v", what, err)
+		case <-deadline:
+			t.Fatalf("timed out waiting for %s", what)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+var errReplyFailed = errors.New("reply failed")
+
+// failingReplies fails to write replies while failing is set, or for the
+// next failures writes.
+type failingReplies struct {
+	*memoryStore
+	failing  atomic.Bool
+	failures atomic.Int32
+}
+
+func (f *failingReplies) WriteReply(ctx context.Context, reply Message) error {
+	if f.failing.Load() || f.failures.Add(-1) >= 0 {
+		return errReplyFailed
+	}
+	return f.memoryStore.WriteReply(ctx, reply)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// botStateInterval is how often an instance checkpoints its state.
+const botStateInterval = 10 * time.Second
+
+// BotState is an instance's checkpoint in the bot-state collection, one
+// document per shard, so a restarted backend keeps its idle timers and the
+// conversation it was in the middle of.
+type BotState struct {
+	LastUserMessage  time.Time `firestore:"lastUserMessage"`
+	LastResponseTime time.Time `firestore:"lastResponseTime"`
+	// SummaryVersion is the conversation summary version in the summaries
+	// collection; Turns are the recent turns it does not cover yet.
+	SummaryVersion int                `firestore:"summaryVersion"`
+	Turns          []conversationTurn `firestore:"turns"`
+	SavedAt        time.Time          `firestore:"savedAt"`
+}
+
+// BotStateStore keeps this instance's checkpoint.
+type BotStateStore interface {
+	// BotState returns the checkpoint, or nil if there is none.
+	BotState(ctx context.Context) (*BotState, error)
+	SaveBotState(ctx context.Context, s BotState) error
+}
+
+// saveState checkpoints the idle timers and conversation memory.
+func (b *Bot) saveState(ctx context.Context) error {
+	s := BotState{
+		LastUserMessage:  b.room.lastUserMessage.Load(),
+		LastResponseTime: b.room.lastResponseTime.Load(),
+		SavedAt:          clock.Now(),
+	}
+	s.Turns, s.SummaryVersion = b.memory.snapshot()
+	return b.botState.SaveBotState(ctx, s)
+}
+
+// restoreState picks up the checkpoint of an earlier run, before the
+// listener and monitor start. The recent turns are only restored if no
+// summary has been written since the checkpoint, as one would already
+// cover some of them.
+func (b *Bot) restoreState(ctx context.Context) error {
+	s, err := b.botState.BotState(ctx)
+	if err != nil || s == nil {
+		return err
+	}
+	b.room.lastUserMessage.StoreLater(s.LastUserMessage)
+	b.room.lastResponseTime.StoreLater(s.LastResponseTime)
+
+	latest, err := b.summaries.LatestSummary(ctx)
+	if err != nil {
+		return err
+	}
+	version := 0
+	if latest != nil {
+		version = latest.Version
+	}
+	if s.SummaryVersion != version {
+		slog.Warn("not restoring conversation turns: they follow another summary version", "turns", len(s.Turns), "summaryVersion", s.SummaryVersion, "latestVersion", version)
+		return nil
+	}
+	b.memory.mirror(s.Turns, latest)
+	b.refreshSummary()
+	slog.Info("restored bot state", "savedAt", s.SavedAt, "turns", len(s.Turns))
+	return nil
+}
+
+// checkpointState saves the state every botStateInterval, and once more
+// on shutdown so a clean restart loses nothing.
+func (b *Bot) checkpointState(ctx context.Context) error {
+	ticker := clock.NewTicker(botStateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.saveState(context.WithoutCancel(ctx)); err != nil {
+				slog.Error("error checkpointing bot state on shutdown", "err", err)
+			}
+			return nil
+		case <-ticker.C():
+		}
+		if err := b.saveState(ctx); err != nil {
+			slog.Error("error checkpointing bot state", "err", err)
+		}
+	}
+}
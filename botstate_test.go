@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBotStateSurvivesRestart(t *testing.T) {
+	start := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	before := newTestBot(t, store, generatorFunc(nil))
+	before.room.lastUserMessage.Store(start)
+	before.room.lastResponseTime.Store(start.Add(time.Minute))
+	before.memory.add(conversationTurn{At: start, From: "Audience (ann)", Text: "Is the keynote recorded?"})
+	before.memory.add(conversationTurn{At: start, From: "Host", Text: "It is, on YouTube tonight."})
+	if err := before.saveState(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	after := newTestBot(t, store, generatorFunc(nil))
+	if err := after.restoreState(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := after.room.lastUserMessage.Load(); !got.Equal(start) {
+		t.Errorf("last user message = %s, want %s", got, start)
+	}
+	if got := after.room.lastResponseTime.Load(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("last response = %s, want %s", got, start.Add(time.Minute))
+	}
+	if turns, _ := after.memory.snapshot(); len(turns) != 2 || turns[1].Text != "It is, on YouTube tonight." {
+		t.Errorf("restored turns = %+v, want the two saved", turns)
+	}
+
+	// A summary written after the checkpoint already covers its turns.
+	if err := store.SaveSummary(ctx, SummaryVersion{Version: 1, Summary: "Ann asked about the recording.", Turns: 2}); err != nil {
+		t.Fatal(err)
+	}
+	again := newTestBot(t, store, generatorFunc(nil))
+	if err := again.restoreState(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if turns, _ := again.memory.snapshot(); len(turns) != 0 {
+		t.Errorf("restored turns = %+v, want none behind a newer summary", turns)
+	}
+	if got := again.room.lastUserMessage.Load(); !got.Equal(start) {
+		t.Errorf("last user message = %s, want %s", got, start)
+	}
+}
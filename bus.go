@@ -0,0 +1,131 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventKind names something that happened in the show.
+type EventKind string
+
+const (
+	// EventMessageReceived: an audience message was picked up for answering.
+	EventMessageReceived EventKind = "message-received"
+	// EventResponsePublished: a host message was written to the ping stream.
+	EventResponsePublished EventKind = "response-published"
+	// EventResponsePartial: the model has written Event.Text so far of a
+	// streamed reply.
+	EventResponsePartial EventKind = "response-partial"
+	// EventPollClosed: voting on a poll ended, by its closesAt passing, an
+	// organizer closing it or its maxVotes being reached.
+	EventPollClosed EventKind = "poll-closed"
+	// EventPollUpdated: the live poll's tally changed; Event.Text is the
+	// new poll status.
+	EventPollUpdated EventKind = "poll-updated"
+	// EventStateChanged: a piece of bot state changed, named by Event.State.
+	EventStateChanged EventKind = "state-changed"
+	// EventKnowledgeGap: the host sent a question to the info desk rather
+	// than guess; Event.Reason says why.
+	EventKnowledgeGap EventKind = "knowledge-gap"
+	// EventContentFlagged: moderation caught an audience message or a
+	// reply, at Event.Stage, and dealt with it by Event.Action.
+	EventContentFlagged EventKind = "content-flagged"
+)
+
+// eventBufferSize is how many events a subscriber may fall behind by before
+// further events to it are dropped.
+const eventBufferSize = 256
+
+// Event is published on the bus. Only the fields relevant to Kind are set.
+type Event struct {
+	Kind EventKind
+	At   time.Time
+
+	// MessageID is the audience message or host reply concerned.
+	MessageID string
+	UserID    string
+	Text      string
+	// Question is the rephrased audience question a published reply answers.
+	Question string
+	// Language is the language a published reply was written in, and Pair,
+	// on the second-language ping of a bilingual message, the ID of the
+	// first.
+	Language string
+	Pair     string
+
+	PollID string
+
+	// State is what changed ("degradation", "pacing"), with its old and
+	// new values.
+	State    string
+	From, To string
+
+	Reason string
+	// Stage and Action describe a content-flagged event.
+	Stage, Action string
+	// Section is the sender's seating section on message-received.
+	Section string
+}
+
+// eventBus fans events out to subscribers. Publishing never blocks: each
+// subscriber has its own buffered channel, and events to a subscriber that
+// is too far behind are dropped and counted, so a slow consumer can only
+// hurt itself, never the listener or the monitor.
+type eventBus struct {
+	mu      sync.RWMutex
+	subs    map[*subscription]bool
+	dropped atomic.Int64
+}
+
+type subscription struct {
+	kinds map[EventKind]bool
+	c     chan Event
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: map[*subscription]bool{}}
+}
+
+// Subscribe returns a channel receiving every future event of the given
+// kinds, or of every kind if none are given, and a function that ends the
+// subscription and closes the channel.
+func (bus *eventBus) Subscribe(kinds ...EventKind) (<-chan Event, func()) {
+	s := &subscription{kinds: map[EventKind]bool{}, c: make(chan Event, eventBufferSize)}
+	for _, k := range kinds {
+		s.kinds[k] = true
+	}
+	bus.mu.Lock()
+	bus.subs[s] = true
+	bus.mu.Unlock()
+
+	var once sync.Once
+	return s.c, func() {
+		once.Do(func() {
+			bus.mu.Lock()
+			delete(bus.subs, s)
+			bus.mu.Unlock()
+			close(s.c)
+		})
+	}
+}
+
+// Publish delivers e to every interested subscriber, stamping it with the
+// current time if At is unset.
+func (bus *eventBus) Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = clock.Now()
+	}
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	for s := range bus.subs {
+		if len(s.kinds) > 0 && !s.kinds[e.Kind] {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			bus.dropped.Add(1)
+		}
+	}
+}
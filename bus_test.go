@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := newEventBus()
+	all, cancelAll := bus.Subscribe()
+	defer cancelAll()
+	polls, cancelPolls := bus.Subscribe(EventPollClosed)
+
+	bus.Publish(Event{Kind: EventMessageReceived, MessageID: "m1"})
+	bus.Publish(Event{Kind: EventPollClosed, PollID: "q1"})
+
+	for _, want := range []EventKind{EventMessageReceived, EventPollClosed} {
+		select {
+		case e := <-all:
+			if e.Kind != want || e.At.IsZero() {
+				t.Errorf("got %+v, want a stamped %s event", e, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event", want)
+		}
+	}
+	if e := <-polls; e.PollID != "q1" {
+		t.Errorf("poll subscriber got %+v", e)
+	}
+	select {
+	case e := <-polls:
+		t.Errorf("poll subscriber got unexpected %+v", e)
+	default:
+	}
+
+	cancelPolls()
+	if _, ok := <-polls; ok {
+		t.Error("channel still open after cancel")
+	}
+	bus.Publish(Event{Kind: EventPollClosed, PollID: "q2"})
+	cancelPolls()
+}
+
+func TestEventBusDropsForSlowSubscribers(t *testing.T) {
+	bus := newEventBus()
+	_, cancel := bus.Subscribe()
+	defer cancel()
+
+	for i := 0; i < eventBufferSize+3; i++ {
+		bus.Publish(Event{Kind: EventMessageReceived})
+	}
+	if got := bus.dropped.Load(); got != 3 {
+		t.Errorf("dropped = %d, want 3", got)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// buzzRunnersUp is how many of the players who buzzed after the owner the
+// host names, with how far behind they were.
+const buzzRunnersUp = 2
+
+var (
+	errNotBuzzer    = errors.New("the poll is not a buzzer question")
+	errBuzzerClosed = errors.New("voting on the poll has closed")
+)
+
+// Buzz is a player's buzz on a buzzer question. Seq numbers the buzzes in
+// the order their transactions committed, and At is the server timestamp
+// of the commit, so the order never depends on the app's clock.
+// LatencyMillis is the network latency the app reported for the buzz, as
+// far as it is credited; see arbitrateBuzzes.
+type Buzz struct {
+	Seq           int       `firestore:"seq" json:"seq"`
+	At            time.Time `firestore:"at" json:"at"`
+	LatencyMillis int       `firestore:"latencyMs,omitempty" json:"latencyMs,omitempty"`
+}
+
+// pressed is when the player pressed the buzzer, as best the server can
+// tell: the commit less the latency credited.
+func (z Buzz) pressed() time.Time {
+	return z.At.Add(-time.Duration(z.LatencyMillis) * time.Millisecond)
+}
+
+// BuzzResult is what a buzz got its player: their place in the order, and
+// whether that made them the question's owner. While the fairness window
+// is open, Pending is set and the place is only the order of arrival.
+type BuzzResult struct {
+	Position int  `json:"position"`
+	First    bool `json:"first"`
+	Pending  bool `json:"pending,omitempty"`
+}
+
+// placeBuzz works out userID's buzz on poll at now, read inside the
+// transaction that records it: the next in the order, owning the question
+// if nobody buzzed before and there is no fairness window. With one, the
+// owner is decided by arbitrateBuzzes once it has passed, crediting the
+// buzz with latency. A player buzzing again keeps their place, and buzz is
+// nil. Buzzing isn't possible on other polls, or once voting has closed.
+func placeBuzz(poll PollQuestion, userID string, now time.Time, latency, window time.Duration) (result *BuzzResult, buzz *Buzz, err error) {
+	if !poll.Buzzer {
+		return nil, nil, errNotBuzzer
+	}
+	if closed, _ := pollClosed(poll, now); closed {
+		return nil, nil, errBuzzerClosed
+	}
+	pending := window > 0 && poll.BuzzOwner == ""
+	if prev, ok := poll.Buzzes[userID]; ok {
+		return &BuzzResult{Position: prev.Seq, First: poll.BuzzOwner == userID, Pending: pending}, nil, nil
+	}
+	buzz = &Buzz{Seq: len(poll.Buzzes) + 1, At: now}
+	if window > 0 {
+		buzz.LatencyMillis = int(latency.Milliseconds())
+		return &BuzzResult{Position: buzz.Seq, Pending: pending}, buzz, nil
+	}
+	return &BuzzResult{Position: buzz.Seq, First: poll.BuzzOwner == ""}, buzz, nil
+}
+
+// buzzOrder returns the players who buzzed, first first: by when they
+// pressed the buzzer, then by commit order for buzzes that tie.
+func buzzOrder(buzzes map[string]Buzz) []string {
+	players := make([]string, 0, len(buzzes))
+	for player := range buzzes {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		a, b := buzzes[players[i]], buzzes[players[j]]
+		if !a.pressed().Equal(b.pressed()) {
+			return a.pressed().Before(b.pressed())
+		}
+		return a.Seq < b.Seq
+	})
+	return players
+}
+
+// BuzzArbitration is how the owner of a buzzer question with a fairness
+// window was decided, logged so a disputed call can be checked.
+type BuzzArbitration struct {
+	PollID string
+	Window time.Duration
+	Winner string
+	// Counted are the players whose buzzes arrived within Window of the
+	// first, in the order decided, and Buzzes their buzzes; Late are the
+	// players who buzzed after it.
+	Counted []string
+	Buzzes  map[string]Buzz
+	Late    []string
+}
+
+// buzzWindowClosed reports whether the fairness window on poll has passed
+// at now without an owner being declared.
+func buzzWindowClosed(poll PollQuestion, window time.Duration, now time.Time) bool {
+	if !poll.Buzzer || window <= 0 || poll.BuzzOwner != "" || len(poll.Buzzes) == 0 {
+		return false
+	}
+	return !now.Before(poll.Buzzes[buzzOrderByArrival(poll.Buzzes)[0]].At.Add(window))
+}
+
+// buzzOrderByArrival returns the players who buzzed in commit order.
+func buzzOrderByArrival(buzzes map[string]Buzz) []string {
+	players := make([]string, 0, len(buzzes))
+	for player := range buzzes {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool { return buzzes[players[i]].Seq < buzzes[players[j]].Seq })
+	return players
+}
+
+// arbitrateBuzzes decides the owner of poll once its fairness window has
+// closed at now, or returns nil if it isn't due: of the buzzes that
+// arrived within window of the first, the one pressed earliest once each
+// is credited with its latency wins.
+func arbitrateBuzzes(id string, poll PollQuestion, window time.Duration, now time.Time) *BuzzArbitration {
+	if !buzzWindowClosed(poll, window, now) {
+		return nil
+	}
+	arrived := buzzOrderByArrival(poll.Buzzes)
+	closes := poll.Buzzes[arrived[0]].At.Add(window)
+	a := &BuzzArbitration{PollID: id, Window: window, Buzzes: map[string]Buzz{}}
+	for _, player := range arrived {
+		if z := poll.Buzzes[player]; z.At.After(closes) {
+			a.Late = append(a.Late, player)
+		} else {
+			a.Buzzes[player] = z
+		}
+	}
+	a.Counted = buzzOrder(a.Buzzes)
+	a.Winner = a.Counted[0]
+	return a
+}
+
+// LogValue lists every counted buzz with its arrival, latency credit and
+// the press time it was judged on.
+func (a *BuzzArbitration) LogValue() slog.Value {
+	counted := make([]string, len(a.Counted))
+	for i, player := range a.Counted {
+		z := a.Buzzes[player]
+		counted[i] = fmt.Sprintf("%s at %s less %dms = %s", player, z.At.Format(time.RFC3339Nano), z.LatencyMillis, z.pressed().Format(time.RFC3339Nano))
+	}
+	return slog.GroupValue(
+		slog.String("poll", a.PollID),
+		slog.Duration("window", a.Window),
+		slog.String("winner", a.Winner),
+		slog.Any("counted", counted),
+		slog.Any("late", a.Late),
+	)
+}
+
+// awardBuzz declares the owner of tally's buzzer question once its
+// fairness window has passed, logging how, and reports whether it did.
+// Only the monitor calls it.
+func (b *Bot) awardBuzz(ctx context.Context, tally *PollTally) bool {
+	window := b.cfg.Polls.BuzzWindow.Duration
+	if !buzzWindowClosed(tally.Poll, window, clock.Now()) {
+		return false
+	}
+	a, err := b.polls.AwardBuzz(ctx, tally.ID, window)
+	if err != nil {
+		slog.Error("error awarding buzzer question, will retry", "poll", tally.ID, "err", err)
+		return false
+	}
+	if a == nil {
+		return false
+	}
+	slog.Info("buzzer arbitration", "decision", a)
+	return true
+}
+
+// noteBuzz queues the announcement of who buzzed in first on the active
+// poll, once someone has and while it is still open. Only the monitor calls
+// it.
+func (b *Bot) noteBuzz(tally *PollTally) {
+	poll := tally.Poll
+	if closed, _ := pollClosed(poll, clock.Now()); !poll.Buzzer || poll.BuzzOwner == "" || poll.BuzzAnnounced || closed {
+		b.buzzedIn = nil
+		return
+	}
+	b.buzzedIn = tally
+}
+
+// buzzText announces that owner buzzed in first on poll, and how far
+// behind the next buzzes came. names maps the players to what the host
+// calls them.
+func buzzText(poll PollQuestion, owner string, names map[string]string) string {
+	lines := []string{fmt.Sprintf("%s buzzed in first on %q! The question is theirs, and only their answer counts.", names[owner], poll.Question)}
+	first := poll.Buzzes[owner]
+	var behind []string
+	for _, player := range buzzOrder(poll.Buzzes) {
+		if player == owner || len(behind) == buzzRunnersUp {
+			continue
+		}
+		behind = append(behind, fmt.Sprintf("%s by %.2f seconds", names[player], poll.Buzzes[player].pressed().Sub(first.pressed()).Seconds()))
+	}
+	if len(behind) > 0 {
+		lines = append(lines, "Beaten to the buzzer: "+strings.Join(behind, ", ")+".")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// buzzAnnouncements returns the queued announcement of who buzzed in
+// first, if any. Its Done records it on the poll document. Only the
+// monitor calls it.
+func (b *Bot) buzzAnnouncements(ctx context.Context) []hostAnnouncement {
+	tally := b.buzzedIn
+	if tally == nil {
+		return nil
+	}
+	owner := tally.Poll.BuzzOwner
+	players := []string{owner}
+	for _, player := range buzzOrder(tally.Poll.Buzzes) {
+		if player != owner && len(players) <= buzzRunnersUp {
+			players = append(players, player)
+		}
+	}
+	names := map[string]string{}
+	for i, name := range b.displayNames(ctx, players) {
+		names[players[i]] = name
+	}
+	return []hostAnnouncement{{
+		Kind: "buzz",
+		Text: buzzText(tally.Poll, owner, names),
+		Done: func(ctx context.Context) error {
+			b.buzzedIn = nil
+			return b.polls.MarkBuzzAnnounced(ctx, tally.ID)
+		},
+	}}
+}
+
+func registerBuzzerRoutes(mux *http.ServeMux, b *Bot) {
+	// Buzzes on the active poll, or the one named by "pollId". The order is
+	// decided on the server, whenever the request arrives, and within the
+	// fairness window, if any, by "latencyMs" too: the app's measure of how
+	// long its requests take to reach us.
+	mux.HandleFunc("POST /buzz", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			UserID    string `json:"userId"`
+			PollID    string `json:"pollId"`
+			LatencyMS int    `json:"latencyMs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.UserID == "" {
+			writeError(w, http.StatusBadRequest, errors.New("userId is required"))
+			return
+		}
+		if body.PollID == "" {
+			body.PollID = b.activePollID()
+		}
+		latency := min(max(time.Duration(body.LatencyMS)*time.Millisecond, 0), b.cfg.Polls.BuzzMaxLatency.Duration)
+		result, err := b.polls.Buzz(r.Context(), body.PollID, body.UserID, latency, b.cfg.Polls.BuzzWindow.Duration)
+		switch {
+		case errors.Is(err, errNotBuzzer) || errors.Is(err, errBuzzerClosed):
+			writeError(w, http.StatusConflict, err)
+			return
+		case status.Code(err) == codes.NotFound:
+			writeError(w, http.StatusNotFound, err)
+			return
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"pollId": body.PollID, "position": result.Position, "first": result.First, "pending": result.Pending})
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBuzzOrder(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.SetPoll("q1", PollQuestion{Question: "Capital of France?", Buzzer: true, Options: map[string]PollOption{
+		"A": {Label: "A", OpText: "Lyon"},
+		"B": {Label: "B", OpText: "Paris"},
+	}})
+
+	const players = 20
+	results := make([]*BuzzResult, players)
+	var wg sync.WaitGroup
+	for i := range players {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := store.Buzz(ctx, "q1", fmt.Sprintf("p%d", i), 0, 0)
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = r
+		}()
+	}
+	wg.Wait()
+
+	var owner string
+	seen := map[int]bool{}
+	for i, r := range results {
+		if seen[r.Position] {
+			t.Errorf("two players at position %d", r.Position)
+		}
+		seen[r.Position] = true
+		if r.First != (r.Position == 1) {
+			t.Errorf("p%d at position %d has first = %v", i, r.Position, r.First)
+		}
+		if r.First {
+			owner = fmt.Sprintf("p%d", i)
+		}
+	}
+	poll, _ := store.Poll(ctx, "q1")
+	if poll.BuzzOwner != owner || len(poll.AllowedVoters) != 1 || poll.AllowedVoters[0] != owner {
+		t.Errorf("owner = %q, allowed voters %v; want %q alone", poll.BuzzOwner, poll.AllowedVoters, owner)
+	}
+	if order := buzzOrder(poll.Buzzes); len(order) != players || order[0] != owner {
+		t.Errorf("order = %v, want %d players led by %s", order, players, owner)
+	}
+
+	if r, err := store.Buzz(ctx, "q1", owner, 0, 0); err != nil || r.Position != 1 || !r.First {
+		t.Errorf("buzzing again = %+v, %v; want the same place", r, err)
+	}
+	store.SetPoll("q2", PollQuestion{Question: "Chai or coffee?"})
+	if _, err := store.Buzz(ctx, "q2", "ann", 0, 0); !errors.Is(err, errNotBuzzer) {
+		t.Errorf("buzz on a poll = %v, want %v", err, errNotBuzzer)
+	}
+	store.ClosePoll(ctx, "q1")
+	if _, err := store.Buzz(ctx, "q1", "late", 0, 0); !errors.Is(err, errBuzzerClosed) {
+		t.Errorf("buzz after closing = %v, want %v", err, errBuzzerClosed)
+	}
+}
+
+func TestBuzzOrderBreaksTiesByCommit(t *testing.T) {
+	at := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	got := buzzOrder(map[string]Buzz{
+		"cat": {Seq: 3, At: at},
+		"bob": {Seq: 2, At: at},
+		"ann": {Seq: 1, At: at.Add(-time.Millisecond)},
+	})
+	if strings.Join(got, ",") != "ann,bob,cat" {
+		t.Errorf("order = %v, want ann, bob, cat", got)
+	}
+}
+
+func TestBuzzAnnouncedOnce(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+	ctx := context.Background()
+
+	store := newMemoryStore()
+	store.SetProfile("ann", Profile{DisplayName: "Ann"})
+	store.SetProfile("bob", Profile{DisplayName: "Bob"})
+	store.SetPoll("q1", PollQuestion{Question: "Capital of France?", Buzzer: true, Correct: "B", Options: map[string]PollOption{
+		"A": {Label: "A", OpText: "Lyon"},
+		"B": {Label: "B", OpText: "Paris"},
+	}})
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.APIKeys = []string{"app-key"}
+	srv := httptest.NewServer(b.apiHandler())
+	defer srv.Close()
+
+	buzz := func(user string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/buzz", strings.NewReader(`{"userId": "`+user+`"}`))
+		req.Header.Set("X-API-Key", "app-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if _, err := b.fetchPollStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.buzzAnnouncements(ctx); len(got) != 0 {
+		t.Fatalf("announcements before anyone buzzed = %v", got)
+	}
+	if code := buzz("ann"); code != http.StatusOK {
+		t.Fatalf("POST /buzz = %d", code)
+	}
+	vc.Advance(400 * time.Millisecond)
+	buzz("bob")
+
+	// Bob's vote doesn't count: the question is Ann's.
+	poll, _ := store.Poll(ctx, "q1")
+	poll.Options["A"] = PollOption{Label: "A", OpText: "Lyon", Voters: []string{"bob"}}
+	poll.Options["B"] = PollOption{Label: "B", OpText: "Paris", Voters: []string{"ann"}}
+	store.SetPoll("q1", *poll)
+	status, err := b.fetchPollStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(status, "(1 ineligible votes excluded)") {
+		t.Errorf("poll status = %q, want bob's vote excluded", status)
+	}
+	got := b.buzzAnnouncements(ctx)
+	if len(got) != 1 || got[0].Kind != "buzz" || !strings.Contains(got[0].Text, "Ann buzzed in first") || !strings.Contains(got[0].Text, "Bob by 0.40 seconds") {
+		t.Fatalf("announcements = %v, want Ann first and Bob behind", got)
+	}
+	if err := got[0].Done(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.fetchPollStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.buzzAnnouncements(ctx); len(got) != 0 {
+		t.Errorf("announcements after the buzz was announced = %v", got)
+	}
+}
+
+func TestBuzzFairnessWindow(t *testing.T) {
+	t0 := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	vc := newVirtualClock(t0)
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+	ctx := context.Background()
+
+	store := newMemoryStore()
+	for _, name := range []string{"Ann", "Bob", "Cat", "Dan"} {
+		store.SetProfile(strings.ToLower(name), Profile{DisplayName: name})
+	}
+	store.SetPoll("q1", PollQuestion{Question: "Capital of France?", Buzzer: true, Options: map[string]PollOption{
+		"A": {Label: "A", OpText: "Lyon"},
+		"B": {Label: "B", OpText: "Paris"},
+	}})
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.APIKeys = []string{"app-key"}
+	b.cfg.Polls.BuzzWindow = Duration{200 * time.Millisecond}
+	b.cfg.Polls.BuzzMaxLatency = Duration{100 * time.Millisecond}
+	srv := httptest.NewServer(b.apiHandler())
+	defer srv.Close()
+
+	buzz := func(user string, latencyMS int) BuzzResult {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/buzz", strings.NewReader(fmt.Sprintf(`{"userId": %q, "latencyMs": %d}`, user, latencyMS)))
+		req.Header.Set("X-API-Key", "app-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var r BuzzResult
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	// Ann's request arrives first, but Bob's took 100ms longer to get
+	// here. Dan claims more latency than is credited, and Cat is too late.
+	if r := buzz("ann", 10); r.First || !r.Pending || r.Position != 1 {
+		t.Errorf("ann's buzz = %+v, want first to arrive, pending", r)
+	}
+	vc.Advance(50 * time.Millisecond)
+	buzz("bob", 110)
+	vc.Advance(100 * time.Millisecond)
+	buzz("dan", 5000)
+	vc.Advance(100 * time.Millisecond)
+	buzz("cat", 0)
+
+	poll, _ := store.Poll(ctx, "q1")
+	a := arbitrateBuzzes("q1", *poll, b.cfg.Polls.BuzzWindow.Duration, clock.Now())
+	if a == nil || a.Winner != "bob" || strings.Join(a.Counted, ",") != "bob,ann,dan" || strings.Join(a.Late, ",") != "cat" {
+		t.Fatalf("arbitration = %+v, want bob ahead of ann and dan, cat late", a)
+	}
+	if poll.BuzzOwner != "" {
+		t.Fatalf("owner = %q before the monitor declared one", poll.BuzzOwner)
+	}
+
+	if _, err := b.fetchPollStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	poll, _ = store.Poll(ctx, "q1")
+	if poll.BuzzOwner != "bob" || len(poll.AllowedVoters) != 1 || poll.AllowedVoters[0] != "bob" {
+		t.Errorf("owner = %q, allowed voters %v; want bob alone", poll.BuzzOwner, poll.AllowedVoters)
+	}
+	got := b.buzzAnnouncements(ctx)
+	if len(got) != 1 || !strings.Contains(got[0].Text, "Bob buzzed in first") || !strings.Contains(got[0].Text, "Ann by 0.04 seconds") {
+		t.Errorf("announcements = %v, want Bob first and Ann behind", got)
+	}
+	if r := buzz("ann", 0); r.First || r.Pending {
+		t.Errorf("ann buzzing again = %+v, want settled and not first", r)
+	}
+}
+
+func TestBuzzWindowWaitsForTheFirstBuzz(t *testing.T) {
+	t0 := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	window := 200 * time.Millisecond
+	poll := PollQuestion{Buzzer: true}
+	if buzzWindowClosed(poll, window, t0) {
+		t.Error("window closed before anyone buzzed")
+	}
+	poll.Buzzes = map[string]Buzz{"ann": {Seq: 1, At: t0}}
+	if buzzWindowClosed(poll, window, t0.Add(window-time.Millisecond)) {
+		t.Error("window closed early")
+	}
+	if !buzzWindowClosed(poll, window, t0.Add(window)) {
+		t.Error("window still open once it had passed")
+	}
+	if buzzWindowClosed(poll, 0, t0.Add(time.Hour)) {
+		t.Error("window closed with fairness off")
+	}
+	poll.BuzzOwner = "ann"
+	if buzzWindowClosed(poll, window, t0.Add(time.Hour)) {
+		t.Error("window closed again after the owner was declared")
+	}
+}
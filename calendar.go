@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// calendarCheckInterval is how soon after its start a day's plan takes
+// effect.
+const calendarCheckInterval = 10 * time.Second
+
+// ContentDay is one day of a multi-day event's content plan, a document in
+// the calendar collection. From StartsAt until the next day starts the
+// host plays Persona, reports on the Polls question bank, runs the quiz
+// sessions in Quizzes and gives each of Sponsors a shout-out in turn.
+// Fields left empty keep what the day before (or the config) set.
+type ContentDay struct {
+	ID       string    `firestore:"-" json:"id"`
+	StartsAt time.Time `firestore:"startsAt" json:"startsAt"`
+	Theme    string    `firestore:"theme,omitempty" json:"theme,omitempty"`
+	Persona  string    `firestore:"persona,omitempty" json:"persona,omitempty"`
+	Polls    []string  `firestore:"polls,omitempty" json:"polls,omitempty"`
+	Quizzes  []string  `firestore:"quizzes,omitempty" json:"quizzes,omitempty"`
+	Sponsors []string  `firestore:"sponsors,omitempty" json:"sponsors,omitempty"`
+}
+
+// CalendarStore keeps the content calendar and starts and stops the quiz
+// sessions it schedules.
+type CalendarStore interface {
+	// WatchCalendar calls fn with every day of the calendar whenever it
+	// changes, until ctx is done or the stream fails.
+	WatchCalendar(ctx context.Context, fn func(days []ContentDay) error) error
+	// SetQuizActive sets the active flag of quiz session id.
+	SetQuizActive(ctx context.Context, id string, active bool) error
+}
+
+// currentDay is the day of days that has most recently started by now, or
+// nil if none has.
+func currentDay(days []ContentDay, now time.Time) *ContentDay {
+	var cur *ContentDay
+	for i, d := range days {
+		if d.StartsAt.After(now) {
+			continue
+		}
+		if cur == nil || d.StartsAt.After(cur.StartsAt) {
+			cur = &days[i]
+		}
+	}
+	return cur
+}
+
+// contentDay is the calendar day in effect, or nil.
+func (b *Bot) contentDay() *ContentDay {
+	return b.room.day.Load()
+}
+
+// pollRotation is the day's question bank, or polls.ids if the day has
+// none.
+func (b *Bot) pollRotation() []string {
+	if d := b.contentDay(); d != nil && len(d.Polls) > 0 {
+		return d.Polls
+	}
+	return b.cfg.Polls.IDs
+}
+
+// pollTheme is the day's theme, or polls.theme if the day has none.
+func (b *Bot) pollTheme() string {
+	if d := b.contentDay(); d != nil && d.Theme != "" {
+		return d.Theme
+	}
+	return b.cfg.Polls.Theme
+}
+
+// runCalendar starts each day of the content calendar as its time comes.
+// Only the primary runs it.
+func (b *Bot) runCalendar(ctx context.Context) error {
+	updates := make(chan []ContentDay, 1)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- b.metrics.listen(func() error {
+			return b.calendar.WatchCalendar(ctx, func(days []ContentDay) error {
+				select {
+				case <-updates:
+				default:
+				}
+				updates <- days
+				return nil
+			})
+		})
+	}()
+
+	ticker := clock.NewTicker(calendarCheckInterval)
+	defer ticker.Stop()
+	var days []ContentDay
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watchErr:
+			return err
+		case days = <-updates:
+		case <-ticker.C():
+		}
+		day := currentDay(days, clock.Now())
+		if day == nil {
+			continue
+		}
+		if err := b.startDay(ctx, *day); err != nil {
+			slog.Warn("error starting calendar day, will retry", "day", day.ID, "err", err)
+		}
+	}
+}
+
+// startDay reconfigures the host for day, unless it is already the day in
+// effect, in which case later edits to it are picked up without starting
+// it over. A standby that took over only knows the day's ID, so it does
+// not start the day again either.
+func (b *Bot) startDay(ctx context.Context, day ContentDay) error {
+	prev := b.contentDay()
+	if prev != nil && prev.ID == day.ID {
+		b.room.day.Store(&day)
+		return nil
+	}
+
+	var stopped []string
+	if prev != nil {
+		for _, id := range prev.Quizzes {
+			if !slices.Contains(day.Quizzes, id) {
+				stopped = append(stopped, id)
+			}
+		}
+	}
+	for _, id := range stopped {
+		if err := b.calendar.SetQuizActive(ctx, id, false); err != nil {
+			return fmt.Errorf("error stopping quiz %s: %w", id, err)
+		}
+	}
+	for _, id := range day.Quizzes {
+		if err := b.calendar.SetQuizActive(ctx, id, true); err != nil {
+			return fmt.Errorf("error starting quiz %s: %w", id, err)
+		}
+	}
+
+	if day.Persona != "" {
+		previous, err := b.personas.switchTo(day.Persona)
+		if err != nil {
+			slog.Error("error switching persona for calendar day", "day", day.ID, "err", err)
+		} else if previous != day.Persona {
+			b.bus.Publish(Event{Kind: EventStateChanged, State: "persona", From: previous, To: day.Persona})
+		}
+	}
+
+	b.room.day.Store(&day)
+	if len(day.Polls) > 0 && !slices.Contains(day.Polls, b.activePollID()) {
+		b.switchPoll(day.Polls[0])
+	}
+	var from string
+	if prev != nil {
+		from = prev.ID
+	}
+	slog.Info("starting calendar day", "day", day.ID, "theme", day.Theme)
+	b.bus.Publish(Event{Kind: EventStateChanged, State: "day", From: from, To: day.ID})
+	return nil
+}
+
+// sponsorAnnouncements returns a shout-out for the next of the day's
+// sponsors, at most one per calendar.sponsorEvery. Only the monitor calls
+// it.
+func (b *Bot) sponsorAnnouncements() []hostAnnouncement {
+	day := b.contentDay()
+	now := clock.Now()
+	if day == nil || len(day.Sponsors) == 0 || now.Sub(b.sponsorAt) < b.cfg.Calendar.SponsorEvery.Duration {
+		return nil
+	}
+	sponsor := day.Sponsors[b.sponsorNext%len(day.Sponsors)]
+	text := fmt.Sprintf("Thank %s, one of today's sponsors, for making the show possible, in one or two lines.", sponsor)
+	if day.Theme != "" {
+		text = fmt.Sprintf("%s Today's theme is %s.", text, day.Theme)
+	}
+	return []hostAnnouncement{{
+		Kind: "sponsor-shoutout",
+		Text: text,
+		Done: func(ctx context.Context) error {
+			b.sponsorAt = now
+			b.sponsorNext++
+			return nil
+		},
+	}}
+}
+
+func registerCalendarRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/calendar", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"day": b.contentDay(), "rotation": b.pollRotation(), "theme": b.pollTheme()})
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCurrentDay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	days := []ContentDay{
+		{ID: "day-2", StartsAt: start.Add(24 * time.Hour)},
+		{ID: "day-1", StartsAt: start},
+		{ID: "day-3", StartsAt: start.Add(48 * time.Hour)},
+	}
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{"before the event", start.Add(-time.Minute), ""},
+		{"first morning", start, "day-1"},
+		{"first evening", start.Add(12 * time.Hour), "day-1"},
+		{"second day", start.Add(25 * time.Hour), "day-2"},
+		{"after the last day", start.Add(100 * time.Hour), "day-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if d := currentDay(days, tt.now); d != nil {
+				got = d.ID
+			}
+			if got != tt.want {
+				t.Errorf("currentDay = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartDay(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.personas = newPersonaRegistry([]Persona{{Name: "rajini", Prompt: "You're Rajinikanth."}}, defaultPersona.Name)
+	ctx := context.Background()
+
+	day1 := ContentDay{ID: "day-1", Theme: "Android", Persona: "rajini", Polls: []string{"a1", "a2"}, Quizzes: []string{"android-trivia"}}
+	if err := b.startDay(ctx, day1); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.personas.current().Name; got != "rajini" {
+		t.Errorf("persona = %q, want rajini", got)
+	}
+	if got := b.activePollID(); got != "a1" {
+		t.Errorf("active poll = %q, want the day's first poll", got)
+	}
+	if next := b.nextPollID(); next != "a2" {
+		t.Errorf("next poll = %q, want a2 from the day's question bank", next)
+	}
+	if !store.QuizActive("android-trivia") {
+		t.Error("the day's quiz was not started")
+	}
+
+	// The same day again only picks up edits; a manual persona switch stays.
+	b.personas.switchTo(defaultPersona.Name)
+	day1.Sponsors = []string{"Acme"}
+	if err := b.startDay(ctx, day1); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.personas.current().Name; got != defaultPersona.Name {
+		t.Errorf("persona = %q after restarting the same day, want it left alone", got)
+	}
+	if got := b.contentDay().Sponsors; len(got) != 1 {
+		t.Errorf("sponsors = %v, want the edited day", got)
+	}
+
+	day2 := ContentDay{ID: "day-2", Theme: "Cloud", Quizzes: []string{"cloud-trivia"}}
+	if err := b.startDay(ctx, day2); err != nil {
+		t.Fatal(err)
+	}
+	if store.QuizActive("android-trivia") || !store.QuizActive("cloud-trivia") {
+		t.Error("quizzes not swapped for the second day")
+	}
+	if got := b.pollTheme(); got != "Cloud" {
+		t.Errorf("poll theme = %q, want the day's theme", got)
+	}
+	if got := b.pollRotation(); len(got) != 1 || got[0] != "q1" {
+		t.Errorf("rotation = %v, want polls.ids for a day without polls", got)
+	}
+}
+
+func TestSponsorAnnouncements(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC))
+	defer func(c Clock) { clock = c }(clock)
+	clock = vc
+
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	if got := b.sponsorAnnouncements(); len(got) != 0 {
+		t.Fatalf("announcements without a calendar day = %v", got)
+	}
+	b.room.day.Store(&ContentDay{ID: "day-1", Sponsors: []string{"Acme", "Globex"}})
+
+	var thanked []string
+	for range 3 {
+		got := b.sponsorAnnouncements()
+		if len(got) != 1 {
+			t.Fatalf("announcements = %v, want one shout-out", got)
+		}
+		thanked = append(thanked, strings.Fields(got[0].Text)[1])
+		if err := got[0].Done(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if again := b.sponsorAnnouncements(); len(again) != 0 {
+			t.Fatalf("second shout-out within sponsorEvery: %v", again)
+		}
+		vc.Advance(b.cfg.Calendar.SponsorEvery.Duration)
+	}
+	if got := strings.Join(thanked, " "); got != "Acme, Globex, Acme," {
+		t.Errorf("sponsors thanked = %q, want them in turn", got)
+	}
+}
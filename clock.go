@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the bot's source of time. Everything that reads the time or waits
+// on it (the monitor, schedulers, rate limiters, timers) goes through the
+// package-level clock, so tests and replays can swap in a virtualClock.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+	After(d time.Duration) <-chan time.Time
+}
+
+// Ticker is the subset of *time.Ticker the bot uses.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+var clock Clock = realClock{}
+
+// virtualClock only moves when advanced, either explicitly by tests via
+// Advance or continuously at a multiple of real time via Run. Tickers and
+// timers fire in deadline order as virtual time passes them.
+type virtualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*virtualTimer
+}
+
+type virtualTimer struct {
+	clock  *virtualClock
+	when   time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+func newVirtualClock(start time.Time) *virtualClock {
+	return &virtualClock{now: start}
+}
+
+func (c *virtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *virtualClock) NewTicker(d time.Duration) Ticker {
+	return c.addTimer(d, d)
+}
+
+func (c *virtualClock) After(d time.Duration) <-chan time.Time {
+	return c.addTimer(d, 0).c
+}
+
+func (c *virtualClock) addTimer(d, period time.Duration) *virtualTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &virtualTimer{clock: c, when: c.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *virtualTimer) C() <-chan time.Time { return t.c }
+
+func (t *virtualTimer) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.clock.removeLocked(t)
+}
+
+func (c *virtualClock) removeLocked(t *virtualTimer) {
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Advance moves virtual time forward by d, firing every timer whose deadline
+// falls inside the interval. Like time.Ticker, a tick is dropped if the
+// previous one hasn't been received yet.
+func (c *virtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := c.now.Add(d)
+	for {
+		sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].when.Before(c.timers[j].when) })
+		if len(c.timers) == 0 || c.timers[0].when.After(target) {
+			break
+		}
+		t := c.timers[0]
+		c.now = t.when
+		select {
+		case t.c <- t.when:
+		default:
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.removeLocked(t)
+		}
+	}
+	c.now = target
+}
+
+// Run advances virtual time at speed times the real rate until ctx is done,
+// so a replay at speed 360 covers an hour of event time in ten seconds.
+func (c *virtualClock) Run(ctx context.Context, speed float64) {
+	const resolution = 10 * time.Millisecond
+	ticker := time.NewTicker(resolution)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.Advance(time.Duration(float64(now.Sub(last)) * speed))
+			last = now
+		}
+	}
+}
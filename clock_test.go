@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVirtualClockAdvance(t *testing.T) {
+	start := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		advance     []time.Duration
+		tickerEvery time.Duration
+		afterIn     time.Duration
+		wantTicks   int // ticks received, at most one buffered per Advance
+		wantAfter   bool
+	}{
+		{"before any deadline", []time.Duration{30 * time.Second}, time.Minute, 2 * time.Minute, 0, false},
+		{"exactly on the deadline", []time.Duration{time.Minute}, time.Minute, time.Minute, 1, true},
+		{"ticks are dropped while unread", []time.Duration{5 * time.Minute}, time.Minute, 10 * time.Minute, 1, false},
+		{"one tick per step", []time.Duration{time.Minute, time.Minute, time.Minute}, time.Minute, 150 * time.Second, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newVirtualClock(start)
+			ticker := c.NewTicker(tt.tickerEvery)
+			defer ticker.Stop()
+			after := c.After(tt.afterIn)
+
+			ticks, fired := 0, false
+			var total time.Duration
+			for _, d := range tt.advance {
+				c.Advance(d)
+				total += d
+				select {
+				case <-ticker.C():
+					ticks++
+				default:
+				}
+				select {
+				case <-after:
+					fired = true
+				default:
+				}
+			}
+			if ticks != tt.wantTicks {
+				t.Errorf("ticks = %d, want %d", ticks, tt.wantTicks)
+			}
+			if fired != tt.wantAfter {
+				t.Errorf("After fired = %v, want %v", fired, tt.wantAfter)
+			}
+			if got := c.Now(); !got.Equal(start.Add(total)) {
+				t.Errorf("Now() = %s, want %s", got, start.Add(total))
+			}
+		})
+	}
+}
+
+func TestVirtualClockStoppedTicker(t *testing.T) {
+	c := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	ticker := c.NewTicker(time.Second)
+	ticker.Stop()
+	c.Advance(time.Minute)
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker fired")
+	default:
+	}
+}
@@ -0,0 +1,1228 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration that reads and writes as a string like "10s"
+// in JSON and YAML config files.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// Config is everything that changes from one event to the next. It is read
+// from the file named by CONFIG_FILE (JSON, or YAML for .yaml/.yml), then
+// overridden by environment variables, then filled in with defaults.
+type Config struct {
+	ServiceAccountPath string            `json:"serviceAccountPath" yaml:"serviceAccountPath"`
+	ProjectID          string            `json:"projectId" yaml:"projectId"`
+	Model              string            `json:"model" yaml:"model"`
+	Backend            BackendConfig     `json:"backend" yaml:"backend"`
+	Collections        Collections       `json:"collections" yaml:"collections"`
+	Monitor            MonitorConfig     `json:"monitor" yaml:"monitor"`
+	AnonymousMode      bool              `json:"anonymousMode" yaml:"anonymousMode"`
+	PseudonymKey       string            `json:"pseudonymKey" yaml:"pseudonymKey"`
+	Retention          string            `json:"retention" yaml:"retention"`
+	AdminAddr          string            `json:"adminAddr" yaml:"adminAddr"`
+	AdminToken         string            `json:"adminToken" yaml:"adminToken"`
+	Seed               *int64            `json:"seed" yaml:"seed"`
+	FakeClockStart     time.Time         `json:"fakeClockStart" yaml:"fakeClockStart"`
+	ClockSpeed         float64           `json:"clockSpeed" yaml:"clockSpeed"`
+	Eventbrite         EventbriteConfig  `json:"eventbrite" yaml:"eventbrite"`
+	Degradation        DegradationConfig `json:"degradation" yaml:"degradation"`
+	Retry              RetryConfig       `json:"retry" yaml:"retry"`
+	InfoDesk           InfoDeskConfig    `json:"infoDesk" yaml:"infoDesk"`
+	Streaming          StreamingConfig   `json:"streaming" yaml:"streaming"`
+	Moderation         ModerationConfig  `json:"moderation" yaml:"moderation"`
+	RateLimit          RateLimitConfig   `json:"rateLimit" yaml:"rateLimit"`
+	Polls              PollsConfig       `json:"polls" yaml:"polls"`
+	Costs              CostConfig        `json:"costs" yaml:"costs"`
+	Calendar           CalendarConfig    `json:"calendar" yaml:"calendar"`
+	Experiment         ExperimentConfig  `json:"experiment" yaml:"experiment"`
+	SLA                SLAConfig         `json:"sla" yaml:"sla"`
+	Log                LogConfig         `json:"log" yaml:"log"`
+	// Tracing exports OpenTelemetry spans; see tracing.go.
+	Tracing TracingConfig `json:"tracing" yaml:"tracing"`
+	// Room and Session, when Room is set, place the per-show collections
+	// under rooms/<room>/sessions/<session>/ instead of flat prefixed names.
+	Room    string `json:"room" yaml:"room"`
+	Session string `json:"session" yaml:"session"`
+	// APIAddr, if set, serves the REST API for event apps; every request
+	// needs an X-API-Key header with one of APIKeys.
+	APIAddr string   `json:"apiAddr" yaml:"apiAddr"`
+	APIKeys []string `json:"apiKeys" yaml:"apiKeys"`
+	// HealthAddr, if set, serves the unauthenticated /healthz and /readyz
+	// probes; see health.go. It defaults to :$PORT on Cloud Run.
+	HealthAddr string `json:"healthAddr" yaml:"healthAddr"`
+	// GopsAddr, if set, starts the gops agent there, for gops to inspect
+	// the running backend; keep it on localhost.
+	GopsAddr string `json:"gopsAddr" yaml:"gopsAddr"`
+	// Shards splits message processing across instances; see ShardConfig.
+	Shards ShardConfig `json:"shards" yaml:"shards"`
+	// Personas are the characters the host can play besides the default
+	// "amitabh"; Persona is the one it starts as. The admin API switches
+	// between them at runtime.
+	Personas []Persona `json:"personas" yaml:"personas"`
+	Persona  string    `json:"persona" yaml:"persona"`
+	// ModelTimeout bounds each call to Model. When Model fails, ModelChain
+	// is tried in order, each with its own timeout (ModelTimeout if unset).
+	ModelTimeout Duration     `json:"modelTimeout" yaml:"modelTimeout"`
+	ModelChain   []ChainModel `json:"modelChain" yaml:"modelChain"`
+	// Length holds replies to their word limits; see length.go.
+	Length LengthConfig `json:"length" yaml:"length"`
+	// Counters batches writes to running totals; see counters.go.
+	Counters CounterConfig `json:"counters" yaml:"counters"`
+	// ContextWindow keeps prompts inside the model's context window; see
+	// contextwindow.go.
+	ContextWindow ContextWindowConfig `json:"contextWindow" yaml:"contextWindow"`
+	// Language picks the language of replies; see language.go.
+	Language LanguageConfig `json:"language" yaml:"language"`
+	// Speech reads replies out for the PA; see speech.go.
+	Speech SpeechConfig `json:"speech" yaml:"speech"`
+	// Energy arcs the host's intensity across the show; see energy.go.
+	Energy EnergyConfig `json:"energy" yaml:"energy"`
+	// ImageReplies draws pictures for replies that ask for one; see
+	// imagereplies.go.
+	ImageReplies ImageRepliesConfig `json:"imageReplies" yaml:"imageReplies"`
+	// Transcription turns voice notes into text; see transcribe.go.
+	Transcription TranscriptionConfig `json:"transcription" yaml:"transcription"`
+	// Generation tunes every model call; a persona's own Generation
+	// overrides it while the host plays them. See generation.go.
+	Generation GenerationConfig `json:"generation" yaml:"generation"`
+	// Role is all (the default), or ingest or responder to split triage
+	// from answering across processes; see roles.go.
+	Role string `json:"role" yaml:"role"`
+	// Failover has the active instance publish its state every second for
+	// a warm standby; Standby starts this instance as that standby, which
+	// mirrors the active one until it is promoted. See failover.go.
+	Failover bool `json:"failover" yaml:"failover"`
+	Standby  bool `json:"standby" yaml:"standby"`
+	// PromptsDir holds *.tmpl prompt templates that replace the built-in
+	// ones of the same name; see prompts.go.
+	PromptsDir string `json:"promptsDir" yaml:"promptsDir"`
+	// Triage selects which messages this room's host answers, and how.
+	Triage TriageConfig `json:"triage" yaml:"triage"`
+	// Workers is how many audience messages are answered at once.
+	Workers int `json:"workers" yaml:"workers"`
+	// DeadLetterAfter is how many times a message is tried before it is
+	// moved to the dead-letter collection.
+	DeadLetterAfter int `json:"deadLetterAfter" yaml:"deadLetterAfter"`
+	// InstanceID names this instance in message claims; replicas of the
+	// same shard need distinct IDs. ClaimLease is how long a claim holds
+	// before another replica may take over the message; the owner renews
+	// it every third of the lease while answering.
+	InstanceID string   `json:"instanceId" yaml:"instanceId"`
+	ClaimLease Duration `json:"claimLease" yaml:"claimLease"`
+	// ShowLog, if set, is the file every input, state change and output
+	// of the show is appended to, for the replay command; see showlog.go.
+	ShowLog string `json:"showLog" yaml:"showLog"`
+
+	// Derived by validate.
+	retentionPolicies []RetentionPolicy
+	pseudonymKey      []byte
+	// legacyCollections holds the flat names the room collections had before
+	// the room/session layout, for the migrate command.
+	legacyCollections Collections
+}
+
+// Collections names every Firestore collection the bot uses. Names left
+// empty default to Prefix plus a fixed suffix, e.g. "devfest-chennai-user".
+type Collections struct {
+	Prefix           string `json:"prefix" yaml:"prefix"`
+	User             string `json:"user" yaml:"user"`
+	Ping             string `json:"ping" yaml:"ping"`
+	Poll             string `json:"poll" yaml:"poll"`
+	WordCloud        string `json:"wordCloud" yaml:"wordCloud"`
+	Quiz             string `json:"quiz" yaml:"quiz"`
+	Checkins         string `json:"checkins" yaml:"checkins"`
+	Profiles         string `json:"profiles" yaml:"profiles"`
+	Prizes           string `json:"prizes" yaml:"prizes"`
+	Telemetry        string `json:"telemetry" yaml:"telemetry"`
+	Highlights       string `json:"highlights" yaml:"highlights"`
+	Pseudonyms       string `json:"pseudonyms" yaml:"pseudonyms"`
+	RetentionReports string `json:"retentionReports" yaml:"retentionReports"`
+	Alerts           string `json:"alerts" yaml:"alerts"`
+	Shards           string `json:"shards" yaml:"shards"`
+	PrivateReplies   string `json:"privateReplies" yaml:"privateReplies"`
+	Summaries        string `json:"summaries" yaml:"summaries"`
+	DeadLetter       string `json:"deadLetter" yaml:"deadLetter"`
+	KnowledgeGaps    string `json:"knowledgeGaps" yaml:"knowledgeGaps"`
+	GapReports       string `json:"gapReports" yaml:"gapReports"`
+	Sections         string `json:"sections" yaml:"sections"`
+	Transcript       string `json:"transcript" yaml:"transcript"`
+	Announcements    string `json:"announcements" yaml:"announcements"`
+	Queue            string `json:"queue" yaml:"queue"`
+	Moderation       string `json:"moderation" yaml:"moderation"`
+	Failover         string `json:"failover" yaml:"failover"`
+	BlockedUsers     string `json:"blockedUsers" yaml:"blockedUsers"`
+	CostReports      string `json:"costReports" yaml:"costReports"`
+	Calendar         string `json:"calendar" yaml:"calendar"`
+	Leaderboard      string `json:"leaderboard" yaml:"leaderboard"`
+	Feedback         string `json:"feedback" yaml:"feedback"`
+	Lifelines        string `json:"lifelines" yaml:"lifelines"`
+	QueueStatus      string `json:"queueStatus" yaml:"queueStatus"`
+	Schedule         string `json:"schedule" yaml:"schedule"`
+	BotState         string `json:"botState" yaml:"botState"`
+	CatchUp          string `json:"catchUp" yaml:"catchUp"`
+	Stats            string `json:"stats" yaml:"stats"`
+}
+
+// roomCollections returns the collections that belong to one room and
+// session, keyed by their name within the session. The rest (check-ins,
+// profiles, prizes, ...) are shared by the whole event.
+func (cols *Collections) roomCollections() map[string]*string {
+	return map[string]*string{
+		"user":            &cols.User,
+		"pings":           &cols.Ping,
+		"poll":            &cols.Poll,
+		"wordcloud":       &cols.WordCloud,
+		"quiz":            &cols.Quiz,
+		"telemetry":       &cols.Telemetry,
+		"highlights":      &cols.Highlights,
+		"shards":          &cols.Shards,
+		"private-replies": &cols.PrivateReplies,
+		"summaries":       &cols.Summaries,
+		"dead-letter":     &cols.DeadLetter,
+		"sections":        &cols.Sections,
+		"transcript":      &cols.Transcript,
+		"announcements":   &cols.Announcements,
+		"response-queue":  &cols.Queue,
+		"moderation":      &cols.Moderation,
+		"failover":        &cols.Failover,
+		"cost-reports":    &cols.CostReports,
+		"leaderboard":     &cols.Leaderboard,
+		"lifelines":       &cols.Lifelines,
+		"queue-status":    &cols.QueueStatus,
+		"schedule":        &cols.Schedule,
+		"bot-state":       &cols.BotState,
+		"catch-up":        &cols.CatchUp,
+		"stats":           &cols.Stats,
+	}
+}
+
+// MonitorConfig controls when the monitor loop speaks up on its own.
+type MonitorConfig struct {
+	// TickInterval is how often the monitor wakes up.
+	TickInterval Duration `json:"tickInterval" yaml:"tickInterval"`
+	// IdleThreshold is how long the audience must be quiet before the host
+	// prompts them, provided IdlePromptGap has passed since its last message.
+	IdleThreshold Duration `json:"idleThreshold" yaml:"idleThreshold"`
+	IdlePromptGap Duration `json:"idlePromptGap" yaml:"idlePromptGap"`
+	// PromptReplyWindow is how long an idle prompt has to get the audience
+	// talking. Answered prompts shorten IdlePromptGap and ignored ones
+	// lengthen it, within IdlePromptGapMin and IdlePromptGapMax. Negative
+	// keeps IdlePromptGap fixed.
+	PromptReplyWindow Duration `json:"promptReplyWindow" yaml:"promptReplyWindow"`
+	IdlePromptGapMin  Duration `json:"idlePromptGapMin" yaml:"idlePromptGapMin"`
+	IdlePromptGapMax  Duration `json:"idlePromptGapMax" yaml:"idlePromptGapMax"`
+	// PollUpdateGap is the spacing of poll commentary while the audience is active.
+	PollUpdateGap Duration `json:"pollUpdateGap" yaml:"pollUpdateGap"`
+	// HistoryTurns is how many recent messages and replies the host sees
+	// verbatim; older ones are folded into a model-written summary.
+	HistoryTurns int `json:"historyTurns" yaml:"historyTurns"`
+	// UserHistoryTurns is how many of a user's own earlier questions the
+	// host is reminded of when they write again.
+	UserHistoryTurns int `json:"userHistoryTurns" yaml:"userHistoryTurns"`
+	// AMADuration is how long an ask-me-anything session stays open when
+	// the admin who opens it doesn't say.
+	AMADuration Duration `json:"amaDuration" yaml:"amaDuration"`
+	// SummaryInterval is the longest the summary goes without folding in
+	// new turns, even before HistoryTurns is reached.
+	SummaryInterval Duration `json:"summaryInterval" yaml:"summaryInterval"`
+	// SectionCalloutGap is the least time between two call-outs of a
+	// quiet or loud seating section.
+	SectionCalloutGap Duration `json:"sectionCalloutGap" yaml:"sectionCalloutGap"`
+	// RevealBeatGap is the least time between two beats of a quiz answer
+	// reveal, stretched by the pacing's slowdown.
+	RevealBeatGap Duration `json:"revealBeatGap" yaml:"revealBeatGap"`
+}
+
+// BackendConfig selects where the host's model runs. Provider is one of
+// googleai (default), vertexai, openai (any OpenAI-compatible endpoint) or
+// ollama.
+type BackendConfig struct {
+	Provider       string `json:"provider" yaml:"provider"`
+	VertexProject  string `json:"vertexProject" yaml:"vertexProject"`
+	VertexLocation string `json:"vertexLocation" yaml:"vertexLocation"`
+	OpenAIBaseURL  string `json:"openaiBaseUrl" yaml:"openaiBaseUrl"`
+	OpenAIAPIKey   string `json:"openaiApiKey" yaml:"openaiApiKey"`
+	OllamaAddress  string `json:"ollamaAddress" yaml:"ollamaAddress"`
+}
+
+// ChainModel is one fallback model in Config.ModelChain.
+type ChainModel struct {
+	Name    string   `json:"name" yaml:"name"`
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+}
+
+// DegradationConfig tunes when the host steps down the degradation ladder.
+type DegradationConfig struct {
+	// FallbackModel is the cheaper model used one rung below full AI.
+	FallbackModel string   `json:"fallbackModel" yaml:"fallbackModel"`
+	Window        Duration `json:"window" yaml:"window"`
+	MaxErrorRate  float64  `json:"maxErrorRate" yaml:"maxErrorRate"`
+	MaxLatency    Duration `json:"maxLatency" yaml:"maxLatency"`
+	// RecoverAfter is how long a level must hold before trying one rung up.
+	RecoverAfter Duration `json:"recoverAfter" yaml:"recoverAfter"`
+	// FAQ maps a keyword to the answer served at the cached level.
+	FAQ         map[string]string `json:"faq" yaml:"faq"`
+	CannedLines []string          `json:"cannedLines" yaml:"cannedLines"`
+	// MaxCacheMisses consecutive unanswerable messages at the cached rung
+	// step down to canned lines.
+	MaxCacheMisses int `json:"maxCacheMisses" yaml:"maxCacheMisses"`
+	// SilenceAfter is how long an outage may last at the canned rung before
+	// the host goes silent and moderators are alerted.
+	SilenceAfter Duration `json:"silenceAfter" yaml:"silenceAfter"`
+}
+
+// InfoDeskConfig controls when the host sends a question to the info desk
+// instead of answering it: when the model says it doesn't know, or when a
+// question mentions one of Keywords (event logistics such as "venue" or
+// "lunch"; a built-in list if empty) and degradation.faq has no entry for
+// it. Message replaces the answer; a default is used if empty.
+type InfoDeskConfig struct {
+	Message  string   `json:"message" yaml:"message"`
+	Keywords []string `json:"keywords" yaml:"keywords"`
+}
+
+// CostConfig prices model tokens and Firestore operations for the cost
+// report, per million. Unpriced models and operations are counted but
+// cost nothing.
+type CostConfig struct {
+	// Models maps model names to their token prices.
+	Models          map[string]ModelPrice `json:"models" yaml:"models"`
+	FirestoreReads  float64               `json:"firestoreReads" yaml:"firestoreReads"`
+	FirestoreWrites float64               `json:"firestoreWrites" yaml:"firestoreWrites"`
+	// ReportInterval is how often the report is written.
+	ReportInterval Duration `json:"reportInterval" yaml:"reportInterval"`
+}
+
+// ModelPrice is a model's price per million input and output tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input" yaml:"input"`
+	Output float64 `json:"output" yaml:"output"`
+}
+
+// PollsConfig lists the poll documents the host reports on, one at a time.
+type PollsConfig struct {
+	// IDs is the rotation, in order; the first starts as the active poll.
+	IDs []string `json:"ids" yaml:"ids"`
+	// RotateEvery, if set, moves on to the next poll after that long.
+	RotateEvery Duration `json:"rotateEvery" yaml:"rotateEvery"`
+	// Generate has the model write each next poll, on Theme, instead of
+	// taking it from IDs; see pollgen.go.
+	Generate bool   `json:"generate" yaml:"generate"`
+	Theme    string `json:"theme" yaml:"theme"`
+	// ImageBucket is the Cloud Storage bucket option images are uploaded
+	// to. ImageGeneratorURL, if set, is POSTed {"prompt"} for the options
+	// of generated polls the model wants a picture for, and answers with
+	// the image; see pollimages.go.
+	ImageBucket       string `json:"imageBucket" yaml:"imageBucket"`
+	ImageGeneratorURL string `json:"imageGeneratorUrl" yaml:"imageGeneratorUrl"`
+	// BuzzWindow, if set, holds off naming the owner of a buzzer question
+	// until that long after the first buzz, and then judges the buzzes in
+	// it by when they were pressed, crediting each with the latency the
+	// app reports, up to BuzzMaxLatency; see buzzer.go.
+	BuzzWindow     Duration `json:"buzzWindow" yaml:"buzzWindow"`
+	BuzzMaxLatency Duration `json:"buzzMaxLatency" yaml:"buzzMaxLatency"`
+}
+
+// CalendarConfig tunes the content calendar of a multi-day event; see
+// calendar.go.
+type CalendarConfig struct {
+	// SponsorEvery is the least time between two sponsor shout-outs.
+	SponsorEvery Duration `json:"sponsorEvery" yaml:"sponsorEvery"`
+}
+
+// SLAConfig is the answer deadline audience messages are held to: Percentile
+// of those answered within Window should be answered within Target of
+// arriving. Below MinSamples answers it is not judged; see sla.go.
+type SLAConfig struct {
+	Target     Duration `json:"target" yaml:"target"`
+	Percentile float64  `json:"percentile" yaml:"percentile"`
+	Window     Duration `json:"window" yaml:"window"`
+	MinSamples int      `json:"minSamples" yaml:"minSamples"`
+}
+
+// LogConfig sets what the process logs, and how: Level is debug, info,
+// warn or error, and Format text or json.
+type LogConfig struct {
+	Level  string `json:"level" yaml:"level"`
+	Format string `json:"format" yaml:"format"`
+}
+
+// TracingConfig sends OpenTelemetry traces of audience messages to the
+// OTLP/HTTP collector at Endpoint, such as http://localhost:4318, for
+// SampleRatio of the messages. It is off without Endpoint.
+type TracingConfig struct {
+	Endpoint    string  `json:"endpoint" yaml:"endpoint"`
+	ServiceName string  `json:"serviceName" yaml:"serviceName"`
+	SampleRatio float64 `json:"sampleRatio" yaml:"sampleRatio"`
+}
+
+// ExperimentConfig runs an A/B experiment on the prompt of audience
+// replies; see experiment.go. It is off without Variants.
+type ExperimentConfig struct {
+	// Variants are the names templates can branch on as .Variant.
+	Variants []string `json:"variants" yaml:"variants"`
+	// Explore is the share of replies given a variant at random rather
+	// than the best one so far; nil means the default, 0.1, and 0 always
+	// picks the best.
+	Explore *float64 `json:"explore" yaml:"explore"`
+	// FeedbackInterval is how often reactions are collected.
+	FeedbackInterval Duration `json:"feedbackInterval" yaml:"feedbackInterval"`
+}
+
+// RateLimitConfig limits how much of the host's attention one sender can
+// take. A negative PerMinute or DuplicateWindow turns that check off.
+type RateLimitConfig struct {
+	// PerMinute is how many messages a sender may send a minute on
+	// average, and Burst how many in a row.
+	PerMinute float64 `json:"perMinute" yaml:"perMinute"`
+	Burst     int     `json:"burst" yaml:"burst"`
+	// DuplicateWindow is how long a sender's repeat of the same text is
+	// dropped for.
+	DuplicateWindow Duration `json:"duplicateWindow" yaml:"duplicateWindow"`
+}
+
+// ModerationConfig controls the screening of audience messages and
+// generated replies. Action "block" (the default) drops a flagged message
+// and replaces a flagged reply with a canned host line; "mask" stars out
+// blocklisted words instead, though classifier and model safety flags are
+// always blocked. Blocklist adds words to the built-in profanity list.
+// ClassifierURL, if set, is POSTed {"text"} for every message and reply
+// and must answer {"flagged", "categories"} within ClassifierTimeout.
+type ModerationConfig struct {
+	Action            string   `json:"action" yaml:"action"`
+	Blocklist         []string `json:"blocklist" yaml:"blocklist"`
+	ClassifierURL     string   `json:"classifierUrl" yaml:"classifierUrl"`
+	ClassifierTimeout Duration `json:"classifierTimeout" yaml:"classifierTimeout"`
+}
+
+// StreamingConfig makes the host "type" public replies live: with Enabled,
+// the reply is written to its ping document as the model generates it, at
+// most once per Interval, and sent on the REST API's event stream as it
+// grows.
+type StreamingConfig struct {
+	Enabled  bool     `json:"enabled" yaml:"enabled"`
+	Interval Duration `json:"interval" yaml:"interval"`
+}
+
+// RetryConfig controls how transient Gemini and Firestore errors are
+// retried: up to MaxAttempts tries in all, waiting BaseDelay after the first
+// failure and doubling up to MaxDelay, each wait jittered by ±20%.
+type RetryConfig struct {
+	MaxAttempts int      `json:"maxAttempts" yaml:"maxAttempts"`
+	BaseDelay   Duration `json:"baseDelay" yaml:"baseDelay"`
+	MaxDelay    Duration `json:"maxDelay" yaml:"maxDelay"`
+}
+
+// TriageConfig picks the room's TriagePolicy: answer-all (default), top-k
+// (at most K public answers per Window, the most question-like first) or
+// vip-first (VIPs always answered publicly and first, everyone else as in
+// top-k). Messages over the budget are answered privately, or dropped if
+// Overflow is "drop".
+type TriageConfig struct {
+	Policy   string   `json:"policy" yaml:"policy"`
+	K        int      `json:"k" yaml:"k"`
+	Window   Duration `json:"window" yaml:"window"`
+	VIPs     []string `json:"vips" yaml:"vips"`
+	Overflow string   `json:"overflow" yaml:"overflow"`
+}
+
+// ShardConfig lets Count backend instances split the audience between them.
+// Clients write shard = fnv32a(message document ID) % Count on each message,
+// and the instance with Index only listens to its own shard. Index 0 is the
+// primary and also runs the monitor and background workers.
+type ShardConfig struct {
+	Count int `json:"count" yaml:"count"`
+	Index int `json:"index" yaml:"index"`
+}
+
+type EventbriteConfig struct {
+	Token   string `json:"token" yaml:"token"`
+	EventID string `json:"eventId" yaml:"eventId"`
+}
+
+func loadConfig() (*Config, error) {
+	cfg := &Config{}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := readConfigFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	cfg.applyDefaults()
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+func readConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	default:
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) applyEnv() error {
+	stringVars := map[string]*string{
+		"SERVICE_ACCOUNT_PATH":      &c.ServiceAccountPath,
+		"PROJECT_ID":                &c.ProjectID,
+		"MODEL":                     &c.Model,
+		"FALLBACK_MODEL":            &c.Degradation.FallbackModel,
+		"MODEL_BACKEND":             &c.Backend.Provider,
+		"VERTEX_PROJECT":            &c.Backend.VertexProject,
+		"VERTEX_LOCATION":           &c.Backend.VertexLocation,
+		"OPENAI_BASE_URL":           &c.Backend.OpenAIBaseURL,
+		"OPENAI_API_KEY":            &c.Backend.OpenAIAPIKey,
+		"OLLAMA_ADDRESS":            &c.Backend.OllamaAddress,
+		"COLLECTION_PREFIX":         &c.Collections.Prefix,
+		"USER_COLLECTION":           &c.Collections.User,
+		"PING_COLLECTION":           &c.Collections.Ping,
+		"POLL_COLLECTION":           &c.Collections.Poll,
+		"PSEUDONYM_KEY":             &c.PseudonymKey,
+		"RETENTION_POLICIES":        &c.Retention,
+		"ADMIN_ADDR":                &c.AdminAddr,
+		"ADMIN_TOKEN":               &c.AdminToken,
+		"API_ADDR":                  &c.APIAddr,
+		"EVENTBRITE_TOKEN":          &c.Eventbrite.Token,
+		"EVENTBRITE_EVENT_ID":       &c.Eventbrite.EventID,
+		"ROOM":                      &c.Room,
+		"SESSION":                   &c.Session,
+		"TRIAGE_POLICY":             &c.Triage.Policy,
+		"INSTANCE_ID":               &c.InstanceID,
+		"PERSONA":                   &c.Persona,
+		"PROMPTS_DIR":               &c.PromptsDir,
+		"ROLE":                      &c.Role,
+		"MODERATION_ACTION":         &c.Moderation.Action,
+		"MODERATION_CLASSIFIER_URL": &c.Moderation.ClassifierURL,
+		"POLL_THEME":                &c.Polls.Theme,
+		"POLL_IMAGE_BUCKET":         &c.Polls.ImageBucket,
+		"POLL_IMAGE_GENERATOR_URL":  &c.Polls.ImageGeneratorURL,
+		"LOG_LEVEL":                 &c.Log.Level,
+		"LOG_FORMAT":                &c.Log.Format,
+		// The OpenTelemetry SDK's own variables.
+		"OTEL_EXPORTER_OTLP_ENDPOINT": &c.Tracing.Endpoint,
+		"OTEL_SERVICE_NAME":           &c.Tracing.ServiceName,
+		"HEALTH_ADDR":                 &c.HealthAddr,
+		"GOPS_ADDR":                   &c.GopsAddr,
+		"SHOW_LOG":                    &c.ShowLog,
+		// Reply length.
+		"LENGTH_MODE": &c.Length.Mode,
+		// Reply language.
+		"LANGUAGE": &c.Language.Default,
+		// Text-to-speech.
+		"SPEECH_BUCKET":       &c.Speech.Bucket,
+		"TRANSCRIPTION_MODEL": &c.Transcription.Model,
+	}
+	for name, dst := range stringVars {
+		if v := os.Getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	// Cloud Run tells the container which port to listen on.
+	if v := os.Getenv("PORT"); v != "" && c.HealthAddr == "" {
+		c.HealthAddr = ":" + v
+	}
+	listVars := map[string]*[]string{
+		"API_KEYS":             &c.APIKeys,
+		"POLL_IDS":             &c.Polls.IDs,
+		"PROMPT_VARIANTS":      &c.Experiment.Variants,
+		"LANGUAGES":            &c.Language.Allowed,
+		"BILINGUAL":            &c.Language.Bilingual,
+		"IMAGE_REPLY_TRIGGERS": &c.ImageReplies.Triggers,
+		"MODERATION_BLOCKLIST": &c.Moderation.Blocklist,
+		"STOP_SEQUENCES":       &c.Generation.StopSequences,
+	}
+	for name, dst := range listVars {
+		if os.Getenv(name) != "" {
+			*dst = splitList(name)
+		}
+	}
+	if v := os.Getenv("MAX_WORDS"); v != "" {
+		limits, err := parseWordLimits(v)
+		if err != nil {
+			return fmt.Errorf("error parsing MAX_WORDS: %w", err)
+		}
+		c.Length.MaxWords = limits
+	}
+	if v := os.Getenv("SAFETY_SETTINGS"); v != "" {
+		safety, err := parseSafety(v)
+		if err != nil {
+			return fmt.Errorf("error parsing SAFETY_SETTINGS: %w", err)
+		}
+		c.Generation.Safety = safety
+	}
+	if v := os.Getenv("MODEL_CHAIN"); v != "" {
+		chain, err := parseModelChain(v)
+		if err != nil {
+			return fmt.Errorf("error parsing MODEL_CHAIN: %w", err)
+		}
+		c.ModelChain = chain
+	}
+
+	durations := map[string]*Duration{
+		"MONITOR_TICK":                  &c.Monitor.TickInterval,
+		"IDLE_THRESHOLD":                &c.Monitor.IdleThreshold,
+		"IDLE_PROMPT_GAP":               &c.Monitor.IdlePromptGap,
+		"IDLE_PROMPT_GAP_MIN":           &c.Monitor.IdlePromptGapMin,
+		"IDLE_PROMPT_GAP_MAX":           &c.Monitor.IdlePromptGapMax,
+		"PROMPT_REPLY_WINDOW":           &c.Monitor.PromptReplyWindow,
+		"POLL_UPDATE_GAP":               &c.Monitor.PollUpdateGap,
+		"SUMMARY_INTERVAL":              &c.Monitor.SummaryInterval,
+		"CLAIM_LEASE":                   &c.ClaimLease,
+		"AMA_DURATION":                  &c.Monitor.AMADuration,
+		"SECTION_CALLOUT_GAP":           &c.Monitor.SectionCalloutGap,
+		"REVEAL_BEAT_GAP":               &c.Monitor.RevealBeatGap,
+		"STREAM_INTERVAL":               &c.Streaming.Interval,
+		"MODEL_TIMEOUT":                 &c.ModelTimeout,
+		"MODERATION_CLASSIFIER_TIMEOUT": &c.Moderation.ClassifierTimeout,
+		"DUPLICATE_WINDOW":              &c.RateLimit.DuplicateWindow,
+		"POLL_ROTATE_EVERY":             &c.Polls.RotateEvery,
+		"COST_REPORT_INTERVAL":          &c.Costs.ReportInterval,
+		"SPONSOR_EVERY":                 &c.Calendar.SponsorEvery,
+		"FEEDBACK_INTERVAL":             &c.Experiment.FeedbackInterval,
+		"SLA_TARGET":                    &c.SLA.Target,
+		"SLA_WINDOW":                    &c.SLA.Window,
+		// Buzzer fairness.
+		"BUZZ_WINDOW":      &c.Polls.BuzzWindow,
+		"BUZZ_MAX_LATENCY": &c.Polls.BuzzMaxLatency,
+		// Counter batching.
+		"COUNTER_FLUSH_INTERVAL": &c.Counters.FlushInterval,
+		// Host energy.
+		"ENERGY_OPENING": &c.Energy.Opening,
+		"ENERGY_CLIMAX":  &c.Energy.Climax,
+		"ENERGY_CLOSING": &c.Energy.Closing,
+	}
+	for name, dst := range durations {
+		if v := os.Getenv(name); v != "" {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				return fmt.Errorf("error parsing %s: %w", name, err)
+			}
+		}
+	}
+
+	ints := map[string]*int{
+		"SHARD_COUNT":        &c.Shards.Count,
+		"SHARD_INDEX":        &c.Shards.Index,
+		"HISTORY_TURNS":      &c.Monitor.HistoryTurns,
+		"USER_HISTORY_TURNS": &c.Monitor.UserHistoryTurns,
+		"TRIAGE_K":           &c.Triage.K,
+		"WORKERS":            &c.Workers,
+		"DEAD_LETTER_AFTER":  &c.DeadLetterAfter,
+		"RETRY_MAX_ATTEMPTS": &c.Retry.MaxAttempts,
+		"RATE_LIMIT_BURST":   &c.RateLimit.Burst,
+		// Generation parameters.
+		"TOP_K":             &c.Generation.TopK,
+		"MAX_OUTPUT_TOKENS": &c.Generation.MaxOutputTokens,
+		// Counter batching.
+		"COUNTER_SHARDS": &c.Counters.Shards,
+		// Context window.
+		"CONTEXT_WINDOW_TOKENS": &c.ContextWindow.MaxTokens,
+	}
+	for name, dst := range ints {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("error parsing %s: %w", name, err)
+			}
+			*dst = n
+		}
+	}
+
+	if v := os.Getenv("ANONYMOUS_MODE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("error parsing ANONYMOUS_MODE: %w", err)
+		}
+		c.AnonymousMode = b
+	}
+	if v := os.Getenv("STREAM_REPLIES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("error parsing STREAM_REPLIES: %w", err)
+		}
+		c.Streaming.Enabled = b
+	}
+	if v := os.Getenv("SPEAK_REPLIES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("error parsing SPEAK_REPLIES: %w", err)
+		}
+		c.Speech.Enabled = b
+	}
+	if v := os.Getenv("TRANSCRIBE_VOICE_NOTES"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("error parsing TRANSCRIBE_VOICE_NOTES: %w", err)
+		}
+		c.Transcription.Enabled = b
+	}
+	if v := os.Getenv("POLL_GENERATE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("error parsing POLL_GENERATE: %w", err)
+		}
+		c.Polls.Generate = b
+	}
+	if v := os.Getenv("FAILOVER"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("error parsing FAILOVER: %w", err)
+		}
+		c.Failover = b
+	}
+	if v := os.Getenv("STANDBY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("error parsing STANDBY: %w", err)
+		}
+		c.Standby = b
+	}
+	if v := os.Getenv("SEED"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing SEED: %w", err)
+		}
+		c.Seed = &n
+	}
+	if v := os.Getenv("FAKE_CLOCK_START"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("error parsing FAKE_CLOCK_START: %w", err)
+		}
+		c.FakeClockStart = t
+	}
+	if v := os.Getenv("RATE_LIMIT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing RATE_LIMIT: %w", err)
+		}
+		c.RateLimit.PerMinute = f
+	}
+	if v := os.Getenv("SLA_PERCENTILE"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing SLA_PERCENTILE: %w", err)
+		}
+		c.SLA.Percentile = f
+	}
+	if v := os.Getenv("TRACE_SAMPLE_RATIO"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing TRACE_SAMPLE_RATIO: %w", err)
+		}
+		c.Tracing.SampleRatio = f
+	}
+	if v := os.Getenv("TEMPERATURE"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing TEMPERATURE: %w", err)
+		}
+		c.Generation.Temperature = &f
+	}
+	if v := os.Getenv("TOP_P"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing TOP_P: %w", err)
+		}
+		c.Generation.TopP = f
+	}
+	if v := os.Getenv("SPEAKING_RATE"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing SPEAKING_RATE: %w", err)
+		}
+		c.Speech.SpeakingRate = f
+	}
+	if v := os.Getenv("CLOCK_SPEED"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing CLOCK_SPEED: %w", err)
+		}
+		c.ClockSpeed = f
+	}
+	return nil
+}
+
+// splitList returns the comma-separated items of the environment variable
+// env, trimmed, without empty ones.
+func splitList(env string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(env), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// redacted returns a copy of c without its secrets, for writing out.
+func (c Config) redacted() *Config {
+	c.AdminToken, c.PseudonymKey, c.Backend.OpenAIAPIKey, c.Eventbrite.Token = "", "", "", ""
+	c.APIKeys = nil
+	return &c
+}
+
+func setDefault[T comparable](dst *T, v T) {
+	var zero T
+	if *dst == zero {
+		*dst = v
+	}
+}
+
+func (c *Config) applyDefaults() {
+	backend := &c.Backend
+	setDefault(&backend.VertexProject, c.ProjectID)
+	setDefault(&backend.Provider, "googleai")
+	setDefault(&backend.OpenAIBaseURL, "https://api.openai.com/v1")
+	setDefault(&backend.OllamaAddress, "http://localhost:11434")
+	switch backend.Provider {
+	case "openai":
+		setDefault(&c.Model, "gpt-4o-mini")
+	case "ollama":
+		setDefault(&c.Model, "llama3")
+	default:
+		setDefault(&c.Model, "gemini-1.5-flash")
+		setDefault(&c.Degradation.FallbackModel, "gemini-1.0-pro")
+	}
+	// Other backends have no obvious cheaper model, so they fall back to
+	// the same one unless told otherwise.
+	setDefault(&c.Degradation.FallbackModel, c.Model)
+	setDefault(&c.ModelTimeout, Duration{30 * time.Second})
+	setDefault(&c.Length.Mode, lengthTruncate)
+	if c.Generation.Temperature == nil {
+		temperature := 1.0
+		c.Generation.Temperature = &temperature
+	}
+	for i := range c.ModelChain {
+		setDefault(&c.ModelChain[i].Timeout, c.ModelTimeout)
+	}
+
+	cols := &c.Collections
+	setDefault(&cols.Prefix, "devfest-chennai")
+	for dst, suffix := range map[*string]string{
+		&cols.User:             "user",
+		&cols.Ping:             "pings",
+		&cols.Poll:             "poll",
+		&cols.WordCloud:        "wordcloud",
+		&cols.Quiz:             "quiz",
+		&cols.Checkins:         "checkins",
+		&cols.Profiles:         "profiles",
+		&cols.Prizes:           "prizes",
+		&cols.Telemetry:        "telemetry",
+		&cols.Highlights:       "highlights",
+		&cols.Pseudonyms:       "pseudonyms",
+		&cols.RetentionReports: "retention-reports",
+		&cols.Alerts:           "alerts",
+		&cols.Shards:           "shards",
+		&cols.PrivateReplies:   "private-replies",
+		&cols.Summaries:        "summaries",
+		&cols.DeadLetter:       "dead-letter",
+		&cols.KnowledgeGaps:    "knowledge-gaps",
+		&cols.GapReports:       "knowledge-gap-reports",
+		&cols.Sections:         "sections",
+		&cols.Transcript:       "transcript",
+		&cols.Announcements:    "announcements",
+		&cols.Queue:            "response-queue",
+		&cols.Moderation:       "moderation",
+		&cols.Failover:         "failover",
+		&cols.BlockedUsers:     "blocked-users",
+		&cols.CostReports:      "cost-reports",
+		&cols.Calendar:         "calendar",
+		&cols.Leaderboard:      "leaderboard",
+		&cols.Feedback:         "feedback",
+		&cols.Lifelines:        "lifelines",
+		&cols.QueueStatus:      "queue-status",
+		&cols.Schedule:         "schedule",
+		&cols.BotState:         "bot-state",
+		&cols.CatchUp:          "catch-up",
+		&cols.Stats:            "stats",
+	} {
+		setDefault(dst, cols.Prefix+"-"+suffix)
+	}
+
+	// In room mode the flat names above are only kept as the legacy source
+	// for migrate; the room collections move under the session document.
+	if c.Room != "" {
+		setDefault(&c.Session, "main")
+		c.legacyCollections = *cols
+		for name, dst := range cols.roomCollections() {
+			*dst = "rooms/" + c.Room + "/sessions/" + c.Session + "/" + name
+		}
+	}
+
+	setDefault(&c.Monitor.TickInterval, Duration{10 * time.Second})
+	setDefault(&c.Monitor.IdleThreshold, Duration{30 * time.Second})
+	setDefault(&c.Monitor.IdlePromptGap, Duration{10 * time.Second})
+	setDefault(&c.Monitor.PromptReplyWindow, Duration{30 * time.Second})
+	setDefault(&c.Monitor.IdlePromptGapMin, Duration{10 * time.Second})
+	setDefault(&c.Monitor.IdlePromptGapMax, Duration{2 * time.Minute})
+	setDefault(&c.Monitor.PollUpdateGap, Duration{15 * time.Second})
+	setDefault(&c.Monitor.HistoryTurns, 12)
+	setDefault(&c.Monitor.UserHistoryTurns, 3)
+	setDefault(&c.Monitor.SummaryInterval, Duration{2 * time.Minute})
+	setDefault(&c.Monitor.AMADuration, Duration{15 * time.Minute})
+	setDefault(&c.Monitor.SectionCalloutGap, Duration{5 * time.Minute})
+	setDefault(&c.Monitor.RevealBeatGap, Duration{10 * time.Second})
+	setDefault(&c.Streaming.Interval, Duration{time.Second})
+	setDefault(&c.Persona, defaultPersona.Name)
+	setDefault(&c.Language.Default, "english")
+	setDefault(&c.Speech.Bucket, c.Polls.ImageBucket)
+	setDefault(&c.Triage.Policy, "answer-all")
+	setDefault(&c.Role, roleAll)
+	setDefault(&c.Moderation.Action, moderationBlock)
+	setDefault(&c.Moderation.ClassifierTimeout, Duration{2 * time.Second})
+	setDefault(&c.Polls.BuzzMaxLatency, Duration{250 * time.Millisecond})
+	if len(c.Polls.IDs) == 0 {
+		c.Polls.IDs = []string{"q1"}
+	}
+	setDefault(&c.Costs.ReportInterval, Duration{5 * time.Minute})
+	setDefault(&c.Calendar.SponsorEvery, Duration{15 * time.Minute})
+	if c.Experiment.Explore == nil {
+		explore := 0.1
+		c.Experiment.Explore = &explore
+	}
+	setDefault(&c.Experiment.FeedbackInterval, Duration{time.Minute})
+	setDefault(&c.SLA.Target, Duration{20 * time.Second})
+	setDefault(&c.SLA.Percentile, 0.95)
+	setDefault(&c.SLA.Window, Duration{5 * time.Minute})
+	setDefault(&c.SLA.MinSamples, 10)
+	setDefault(&c.Log.Level, "info")
+	setDefault(&c.Log.Format, "text")
+	setDefault(&c.Tracing.ServiceName, "go-kbc-backend")
+	setDefault(&c.Tracing.SampleRatio, 1.0)
+	setDefault(&c.RateLimit.PerMinute, 6.0)
+	setDefault(&c.RateLimit.Burst, 3)
+	setDefault(&c.RateLimit.DuplicateWindow, Duration{5 * time.Minute})
+	setDefault(&c.Triage.K, 5)
+	setDefault(&c.Triage.Window, Duration{time.Minute})
+	setDefault(&c.Triage.Overflow, "private")
+
+	setDefault(&c.Degradation.Window, Duration{2 * time.Minute})
+	setDefault(&c.Degradation.MaxErrorRate, 0.5)
+	setDefault(&c.Degradation.MaxLatency, Duration{8 * time.Second})
+	setDefault(&c.Degradation.RecoverAfter, Duration{2 * time.Minute})
+	setDefault(&c.Degradation.MaxCacheMisses, 5)
+	setDefault(&c.Degradation.SilenceAfter, Duration{10 * time.Minute})
+
+	setDefault(&c.Retry.MaxAttempts, 3)
+	setDefault(&c.Retry.BaseDelay, Duration{200 * time.Millisecond})
+	setDefault(&c.Retry.MaxDelay, Duration{5 * time.Second})
+
+	setDefault(&c.Shards.Count, 1)
+	setDefault(&c.Counters.FlushInterval, Duration{2 * time.Second})
+	setDefault(&c.Energy.Opening, Duration{10 * time.Minute})
+	setDefault(&c.Energy.Climax, Duration{20 * time.Minute})
+	setDefault(&c.Energy.Closing, Duration{5 * time.Minute})
+	setDefault(&c.Counters.Shards, 4)
+	setDefault(&c.ContextWindow.MaxTokens, 32768)
+	setDefault(&c.Workers, 4)
+	setDefault(&c.DeadLetterAfter, 3)
+	setDefault(&c.ClaimLease, Duration{2 * time.Minute})
+	if c.InstanceID == "" {
+		host, _ := os.Hostname()
+		c.InstanceID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	setDefault(&c.FakeClockStart, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	setDefault(&c.ClockSpeed, 1.0)
+}
+
+func (c *Config) validate() error {
+	var errs []error
+
+	cols := c.Collections
+	seen := map[string]bool{}
+	for _, name := range []string{cols.User, cols.Ping, cols.Poll, cols.WordCloud, cols.Quiz, cols.Checkins,
+		cols.Profiles, cols.Prizes, cols.Telemetry, cols.Highlights, cols.Pseudonyms, cols.RetentionReports, cols.Alerts, cols.Shards, cols.PrivateReplies, cols.Summaries, cols.DeadLetter, cols.KnowledgeGaps, cols.GapReports, cols.Sections, cols.Transcript, cols.Announcements, cols.Queue, cols.Moderation, cols.Failover, cols.BlockedUsers, cols.CostReports, cols.Calendar, cols.Leaderboard, cols.Feedback, cols.Lifelines, cols.QueueStatus, cols.Schedule, cols.BotState, cols.CatchUp, cols.Stats} {
+		if segments := strings.Split(name, "/"); len(segments)%2 == 0 || slices.Contains(segments, "") {
+			errs = append(errs, fmt.Errorf("%q is not a collection path", name))
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("collection %q is used for more than one purpose", name))
+		}
+		seen[name] = true
+	}
+
+	for i, m := range c.ModelChain {
+		if m.Name == "" {
+			errs = append(errs, fmt.Errorf("modelChain[%d] has no name", i))
+		}
+		if m.Timeout.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("modelChain[%d].timeout must be positive", i))
+		}
+	}
+
+	if strings.Contains(c.Room, "/") || strings.Contains(c.Session, "/") {
+		errs = append(errs, errors.New("room and session must not contain '/'"))
+	}
+
+	for name, d := range map[string]Duration{
+		"monitor.tickInterval":         c.Monitor.TickInterval,
+		"monitor.idleThreshold":        c.Monitor.IdleThreshold,
+		"monitor.idlePromptGap":        c.Monitor.IdlePromptGap,
+		"monitor.idlePromptGapMin":     c.Monitor.IdlePromptGapMin,
+		"monitor.idlePromptGapMax":     c.Monitor.IdlePromptGapMax,
+		"monitor.pollUpdateGap":        c.Monitor.PollUpdateGap,
+		"monitor.summaryInterval":      c.Monitor.SummaryInterval,
+		"monitor.amaDuration":          c.Monitor.AMADuration,
+		"monitor.sectionCalloutGap":    c.Monitor.SectionCalloutGap,
+		"monitor.revealBeatGap":        c.Monitor.RevealBeatGap,
+		"streaming.interval":           c.Streaming.Interval,
+		"modelTimeout":                 c.ModelTimeout,
+		"moderation.classifierTimeout": c.Moderation.ClassifierTimeout,
+		"costs.reportInterval":         c.Costs.ReportInterval,
+		"calendar.sponsorEvery":        c.Calendar.SponsorEvery,
+		"experiment.feedbackInterval":  c.Experiment.FeedbackInterval,
+		"sla.target":                   c.SLA.Target,
+		"sla.window":                   c.SLA.Window,
+		"degradation.window":           c.Degradation.Window,
+		"degradation.maxLatency":       c.Degradation.MaxLatency,
+		"degradation.recoverAfter":     c.Degradation.RecoverAfter,
+		"degradation.silenceAfter":     c.Degradation.SilenceAfter,
+		"claimLease":                   c.ClaimLease,
+		"retry.baseDelay":              c.Retry.BaseDelay,
+		"retry.maxDelay":               c.Retry.MaxDelay,
+		"counters.flushInterval":       c.Counters.FlushInterval,
+		"energy.opening":               c.Energy.Opening,
+		"energy.climax":                c.Energy.Climax,
+		"energy.closing":               c.Energy.Closing,
+	} {
+		if d.Duration <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+
+	if c.Monitor.IdlePromptGapMin.Duration > c.Monitor.IdlePromptGapMax.Duration {
+		errs = append(errs, errors.New("monitor.idlePromptGapMin must not be more than idlePromptGapMax"))
+	}
+
+	if c.AnonymousMode {
+		key, err := base64.StdEncoding.DecodeString(c.PseudonymKey)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("pseudonymKey: %w", err))
+		case len(key) != 32:
+			errs = append(errs, fmt.Errorf("pseudonymKey must decode to 32 bytes, got %d", len(key)))
+		default:
+			c.pseudonymKey = key
+		}
+	}
+
+	if policies, err := parseRetentionPolicies(c.Retention); err != nil {
+		errs = append(errs, err)
+	} else {
+		c.retentionPolicies = policies
+	}
+
+	switch c.Backend.Provider {
+	case "googleai", "vertexai", "openai", "ollama":
+	default:
+		errs = append(errs, fmt.Errorf("backend.provider %q must be googleai, vertexai, openai or ollama", c.Backend.Provider))
+	}
+
+	switch c.Moderation.Action {
+	case moderationBlock, moderationMask:
+	default:
+		errs = append(errs, fmt.Errorf("moderation.action %q must be block or mask", c.Moderation.Action))
+	}
+
+	switch c.Role {
+	case roleAll, roleIngest, roleResponder:
+	default:
+		errs = append(errs, fmt.Errorf("role %q must be all, ingest or responder", c.Role))
+	}
+
+	for i, id := range c.Polls.IDs {
+		if id == "" {
+			errs = append(errs, fmt.Errorf("polls.ids[%d] is empty", i))
+		}
+	}
+	if c.Polls.RotateEvery.Duration < 0 {
+		errs = append(errs, errors.New("polls.rotateEvery must not be negative"))
+	}
+	if c.Polls.ImageGeneratorURL != "" && c.Polls.ImageBucket == "" {
+		errs = append(errs, errors.New("polls.imageGeneratorUrl needs polls.imageBucket to upload the images to"))
+	}
+	if c.Energy.Climax.Duration < c.Energy.Closing.Duration {
+		errs = append(errs, errors.New("energy.climax must be at least energy.closing, or the show never peaks"))
+	}
+	if c.Polls.BuzzWindow.Duration < 0 || c.Polls.BuzzMaxLatency.Duration < 0 {
+		errs = append(errs, errors.New("polls.buzzWindow and buzzMaxLatency must not be negative"))
+	}
+	for name, p := range c.Costs.Models {
+		if p.Input < 0 || p.Output < 0 {
+			errs = append(errs, fmt.Errorf("costs.models.%s prices must not be negative", name))
+		}
+	}
+	if c.Costs.FirestoreReads < 0 || c.Costs.FirestoreWrites < 0 {
+		errs = append(errs, errors.New("costs.firestoreReads and firestoreWrites must not be negative"))
+	}
+	if c.RateLimit.PerMinute > 0 && c.RateLimit.Burst < 1 {
+		errs = append(errs, errors.New("rateLimit.burst must be positive"))
+	}
+	if c.Standby && (!c.isPrimary() || c.Role == roleIngest) {
+		errs = append(errs, errors.New("standby is only supported on the primary shard, with role all or responder"))
+	}
+	if c.Standby && c.AdminAddr == "" {
+		errs = append(errs, errors.New("adminAddr must be set for a standby to be promoted"))
+	}
+
+	if c.AdminAddr != "" && c.AdminToken == "" {
+		errs = append(errs, errors.New("adminToken must be set to enable the admin API"))
+	}
+	if c.APIAddr != "" && len(c.APIKeys) == 0 {
+		errs = append(errs, errors.New("apiKeys must be set to enable the REST API"))
+	}
+	if c.HealthAddr != "" && (c.HealthAddr == c.AdminAddr || c.HealthAddr == c.APIAddr) {
+		errs = append(errs, fmt.Errorf("healthAddr %q must differ from adminAddr and apiAddr", c.HealthAddr))
+	}
+	if c.Eventbrite.Token != "" && c.Eventbrite.EventID == "" {
+		errs = append(errs, errors.New("eventbrite.eventId must be set to sync Eventbrite check-ins"))
+	}
+	if c.Degradation.MaxErrorRate <= 0 || c.Degradation.MaxErrorRate > 1 {
+		errs = append(errs, errors.New("degradation.maxErrorRate must be in (0, 1]"))
+	}
+	if e := c.Experiment.Explore; e != nil && (*e < 0 || *e > 1) {
+		errs = append(errs, errors.New("experiment.explore must be in [0, 1]"))
+	}
+	if c.SLA.Percentile <= 0 || c.SLA.Percentile > 1 {
+		errs = append(errs, errors.New("sla.percentile must be in (0, 1]"))
+	}
+	if c.SLA.MinSamples < 1 {
+		errs = append(errs, errors.New("sla.minSamples must be at least 1"))
+	}
+	if _, ok := logLevels[strings.ToLower(c.Log.Level)]; !ok {
+		errs = append(errs, fmt.Errorf("log.level %q must be debug, info, warn or error", c.Log.Level))
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log.format %q must be text or json", c.Log.Format))
+	}
+	if c.Tracing.Endpoint != "" && !strings.HasPrefix(c.Tracing.Endpoint, "http://") && !strings.HasPrefix(c.Tracing.Endpoint, "https://") {
+		errs = append(errs, fmt.Errorf("tracing.endpoint %q must be an http or https URL", c.Tracing.Endpoint))
+	}
+	if c.Tracing.SampleRatio <= 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sampleRatio must be in (0, 1]"))
+	}
+	if err := validatePersonas(c.Personas, c.Persona); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Generation.validate("generation"); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateLength(c.Length); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateTriage(c.Triage); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Monitor.HistoryTurns < 2 {
+		errs = append(errs, errors.New("monitor.historyTurns must be at least 2"))
+	}
+	if c.Monitor.UserHistoryTurns < 1 {
+		errs = append(errs, errors.New("monitor.userHistoryTurns must be positive"))
+	}
+	if c.Degradation.MaxCacheMisses < 1 {
+		errs = append(errs, errors.New("degradation.maxCacheMisses must be positive"))
+	}
+	if c.Shards.Count < 1 || c.Shards.Index < 0 || c.Shards.Index >= c.Shards.Count {
+		errs = append(errs, fmt.Errorf("shards.index must be in [0, %d)", c.Shards.Count))
+	}
+	if err := validateLanguage(c.Language.Default, "language.default"); err != nil {
+		errs = append(errs, err)
+	}
+	for _, name := range c.Language.Allowed {
+		if err := validateLanguage(name, "language.allowed"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if n := len(c.Language.Bilingual); n > 0 {
+		if n != 2 || c.Language.Bilingual[0] == c.Language.Bilingual[1] {
+			errs = append(errs, errors.New("language.bilingual must name two different languages"))
+		}
+		for _, name := range c.Language.Bilingual {
+			if err := validateLanguage(name, "language.bilingual"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if c.Speech.Enabled && c.Speech.Bucket == "" {
+		errs = append(errs, errors.New("speech.enabled needs speech.bucket or polls.imageBucket to upload the audio to"))
+	}
+	if r := c.Speech.SpeakingRate; r != 0 && (r < 0.25 || r > 4) {
+		errs = append(errs, errors.New("speech.speakingRate must be between 0.25 and 4"))
+	}
+	for _, name := range sortedKeys(c.Speech.Voices) {
+		if err := validateLanguage(name, "speech.voices"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(c.ImageReplies.Triggers) > 0 && (c.Polls.ImageGeneratorURL == "" || c.Polls.ImageBucket == "") {
+		errs = append(errs, errors.New("imageReplies.triggers need polls.imageGeneratorUrl to draw with and polls.imageBucket to upload to"))
+	}
+	for _, trigger := range c.ImageReplies.Triggers {
+		if trigger == "" || trigger != strings.ToLower(trigger) || strings.ContainsFunc(trigger, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			errs = append(errs, fmt.Errorf("imageReplies.triggers: %q must be a single lowercase word", trigger))
+		}
+	}
+	if c.ContextWindow.MaxTokens <= c.Generation.MaxOutputTokens {
+		errs = append(errs, errors.New("contextWindow.maxTokens must be more than generation.maxOutputTokens"))
+	}
+	if c.Counters.Shards < 1 {
+		errs = append(errs, errors.New("counters.shards must be positive"))
+	}
+	if c.Retry.MaxAttempts < 1 {
+		errs = append(errs, errors.New("retry.maxAttempts must be positive"))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, errors.New("workers must be positive"))
+	}
+	if c.DeadLetterAfter < 1 {
+		errs = append(errs, errors.New("deadLetterAfter must be positive"))
+	}
+	if c.ClockSpeed <= 0 {
+		errs = append(errs, errors.New("clockSpeed must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnvFallbackModel(t *testing.T) {
+	t.Setenv("FALLBACK_MODEL", "gemini-1.0-pro")
+	var c Config
+	if err := c.applyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Degradation.FallbackModel != "gemini-1.0-pro" {
+		t.Errorf("FallbackModel = %q, want %q", c.Degradation.FallbackModel, "gemini-1.0-pro")
+	}
+}
+
+func TestApplyEnvLists(t *testing.T) {
+	t.Setenv("LANGUAGES", " en, hi,,ta ")
+	t.Setenv("STOP_SEQUENCES", "END, ###")
+	var c Config
+	if err := c.applyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(c.Language.Allowed, "|"); got != "en|hi|ta" {
+		t.Errorf("Language.Allowed = %q, want en, hi and ta", c.Language.Allowed)
+	}
+	if got := strings.Join(c.Generation.StopSequences, "|"); got != "END|###" {
+		t.Errorf("Generation.StopSequences = %q, want END and ###", c.Generation.StopSequences)
+	}
+}
+
+func TestExperimentExploreZero(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("experiment:\n  explore: 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var c Config
+	if err := readConfigFile(path, &c); err != nil {
+		t.Fatal(err)
+	}
+	c.applyDefaults()
+	if c.Experiment.Explore == nil || *c.Experiment.Explore != 0 {
+		t.Errorf("explore set to 0 = %v, want 0 kept", c.Experiment.Explore)
+	}
+
+	var d Config
+	d.applyDefaults()
+	if d.Experiment.Explore == nil || *d.Experiment.Explore != 0.1 {
+		t.Errorf("explore unset = %v, want the default 0.1", d.Experiment.Explore)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"even collection path", func(c *Config) { c.Collections.User = "rooms/main" }, "not a collection path"},
+		{"room with slash", func(c *Config) { c.Room = "a/b" }, "room"},
+		{"unknown backend", func(c *Config) { c.Backend.Provider = "gpt-local" }, "backend"},
+		{"admin without token", func(c *Config) { c.AdminAddr = ":8081" }, "adminToken"},
+		{"API without keys", func(c *Config) { c.APIAddr = ":8082" }, "apiKeys"},
+		{"error rate out of range", func(c *Config) { c.Degradation.MaxErrorRate = 1.5 }, "maxErrorRate"},
+		{"shard index out of range", func(c *Config) { c.Shards.Count, c.Shards.Index = 2, 2 }, "shards.index"},
+		{"stopped clock", func(c *Config) { c.ClockSpeed = -1 }, "clockSpeed"},
+		{"no cache misses allowed", func(c *Config) { c.Degradation.MaxCacheMisses = -1 }, "maxCacheMisses"},
+		{"unknown triage policy", func(c *Config) { c.Triage.Policy = "loudest" }, "triage.policy"},
+		{"top-k without budget", func(c *Config) { c.Triage.Policy, c.Triage.K = "top-k", 0 }, "triage.k"},
+		{"bad retention", func(c *Config) { c.Retention = "user" }, "retention"},
+		{"unknown moderation action", func(c *Config) { c.Moderation.Action = "shout" }, "moderation.action"},
+		{"unknown role", func(c *Config) { c.Role = "generator" }, "role"},
+		{"health probes on the admin address", func(c *Config) { c.AdminAddr, c.AdminToken, c.HealthAddr = ":6060", "t", ":6060" }, "healthAddr"},
+		{"standby on a secondary shard", func(c *Config) { c.Standby, c.Shards.Count, c.Shards.Index = true, 2, 1 }, "standby is only"},
+		{"idle prompt gap bounds swapped", func(c *Config) { c.Monitor.IdlePromptGapMax = Duration{1} }, "idlePromptGapMin"},
+		{"unnamed chain model", func(c *Config) { c.ModelChain = []ChainModel{{Timeout: Duration{1}}} }, "modelChain[0]"},
+		{"unknown log level", func(c *Config) { c.Log.Level = "verbose" }, "log.level"},
+		{"tracing endpoint without scheme", func(c *Config) { c.Tracing.Endpoint = "localhost:4318" }, "tracing.endpoint"},
+		{"tracing sample ratio above one", func(c *Config) { c.Tracing.SampleRatio = 2 }, "tracing.sampleRatio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Config
+			c.applyDefaults()
+			tt.modify(&c)
+			err := c.validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("validate() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("validate() = %v, want error mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetentionOffByDefault(t *testing.T) {
+	var c Config
+	c.applyDefaults()
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.retentionPolicies) != 0 {
+		t.Errorf("retentionPolicies = %+v, want none unless configured", c.retentionPolicies)
+	}
+}
+
+func TestProjectIDFromEnv(t *testing.T) {
+	t.Setenv("PROJECT_ID", "kbc-prod")
+	var c Config
+	if err := c.applyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	c.applyDefaults()
+	if c.ProjectID != "kbc-prod" || c.Backend.VertexProject != "kbc-prod" {
+		t.Errorf("ProjectID = %q, VertexProject = %q, want both kbc-prod", c.ProjectID, c.Backend.VertexProject)
+	}
+}
+
+func TestServiceAccountFile(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	if got := serviceAccountFile(&Config{}); got != "" {
+		t.Errorf("serviceAccountFile without a key = %q, want Application Default Credentials", got)
+	}
+	if got := serviceAccountFile(&Config{ServiceAccountPath: "/secrets/sa.json"}); got != "/secrets/sa.json" {
+		t.Errorf("serviceAccountFile = %q, want the configured path", got)
+	}
+	if err := os.MkdirAll(filepath.Dir(defaultServiceAccountPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(defaultServiceAccountPath, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := serviceAccountFile(&Config{}); got != defaultServiceAccountPath {
+		t.Errorf("serviceAccountFile with the default key present = %q, want %q", got, defaultServiceAccountPath)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultOutputReserve is how many tokens of the context window are kept
+// for the reply when generation.maxOutputTokens is unset.
+const defaultOutputReserve = 1024
+
+// ContextWindowConfig keeps prompts inside the model's context window.
+// MaxTokens is the window, of which generation.maxOutputTokens (or 1024
+// tokens) are kept for the reply. A prompt that doesn't fit in the rest is
+// trimmed before it is sent, least important first: text retrieved for the
+// message (the sender's earlier questions, then FAQ entries), then the
+// conversation summary, then the oldest conversation turns, down to the
+// latest. Tokens are estimated at four bytes each.
+type ContextWindowConfig struct {
+	MaxTokens int `json:"maxTokens" yaml:"maxTokens"`
+}
+
+// promptParts are the parts of a prompt context the guard can trim: the
+// room summary it was built on, which is rebuilt around a shorter
+// conversation history, and text retrieved for the message, dropped in
+// order.
+type promptParts struct {
+	summary   string
+	retrieved []string
+}
+
+type promptPartsKey struct{}
+
+// withPromptParts returns ctx carrying the trimmable parts of the context
+// of the prompts rendered with it.
+func withPromptParts(ctx context.Context, parts promptParts) context.Context {
+	return context.WithValue(ctx, promptPartsKey{}, parts)
+}
+
+// promptBudget is how many tokens a prompt may have, leaving room for the
+// reply. A persona asking for more output than the window holds keeps at
+// least half of it for the prompt.
+func (b *Bot) promptBudget(ctx context.Context) int {
+	reserve := generationFrom(ctx, b.cfg.Generation).MaxOutputTokens
+	if reserve == 0 {
+		reserve = defaultOutputReserve
+	}
+	window := b.cfg.ContextWindow.MaxTokens
+	return max(window-reserve, window/2)
+}
+
+// fitPrompt renders data, trimmed to the prompt budget if it doesn't fit.
+// A prompt still too long once the history is down to the latest turn has
+// the start of its context cut off.
+func (b *Bot) fitPrompt(ctx context.Context, data promptData) (string, error) {
+	budget := b.promptBudget(ctx)
+	text, err := b.renderPrompt(data)
+	if err != nil || estimateTokens(text) <= budget {
+		return text, err
+	}
+	logger := loggerFrom(ctx).With("budget", budget, "tokens", estimateTokens(text))
+	parts, _ := ctx.Value(promptPartsKey{}).(promptParts)
+	fits := func(step string) bool {
+		if text, err = b.renderPrompt(data); err != nil {
+			return true
+		}
+		if estimateTokens(text) > budget {
+			return false
+		}
+		b.metrics.trimmedPrompts.inc(step)
+		logger.Warn("prompt trimmed to fit the context window", "step", step, "trimmedTokens", estimateTokens(text))
+		return true
+	}
+
+	for _, r := range parts.retrieved {
+		if r == "" || !strings.Contains(data.Context, r) {
+			continue
+		}
+		data.Context = strings.Replace(data.Context, r, "", 1)
+		if fits("retrieved") {
+			return text, err
+		}
+	}
+
+	summary, turns := b.memory.parts()
+	for keep := len(turns); keep >= min(1, len(turns)); keep-- {
+		history := renderHistory("", turns[len(turns)-keep:])
+		data.History = history
+		if parts.summary != "" && strings.Contains(data.Context, parts.summary) {
+			rebuilt := b.roomSummary(history)
+			data.Context = strings.Replace(data.Context, parts.summary, rebuilt, 1)
+			parts.summary = rebuilt
+		}
+		step := "turns"
+		if keep == len(turns) && summary != "" {
+			step = "summary"
+		}
+		if fits(step) {
+			return text, err
+		}
+	}
+
+	cut := min(len(data.Context), (estimateTokens(text)-budget)*4+len("…"))
+	for cut < len(data.Context) && !utf8.RuneStart(data.Context[cut]) {
+		cut++
+	}
+	if cut > 0 {
+		data.Context = "…" + data.Context[cut:]
+	}
+	if !fits("truncated") {
+		b.metrics.trimmedPrompts.inc("truncated")
+		logger.Error("prompt is over the context window even with its context cut", "trimmedTokens", estimateTokens(text))
+	}
+	return text, err
+}
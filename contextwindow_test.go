@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFitPrompt(t *testing.T) {
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	b.cfg.Generation.MaxOutputTokens = 100
+	var turns []conversationTurn
+	for i := range 5 {
+		turns = append(turns, conversationTurn{At: time.Now(), From: "Audience (ann)", Text: fmt.Sprintf("turn %d %s", i, strings.Repeat("x", 400))})
+	}
+	b.memory.mirror(turns, &SummaryVersion{Version: 1, Summary: strings.Repeat("s", 2000)})
+	b.refreshSummary()
+	summary := b.room.getSummary()
+	earlier := "\nThis user asked before: " + strings.Repeat("e", 4000)
+
+	tests := []struct {
+		name      string
+		window    int
+		want      []string
+		wantNot   []string
+		wantTrims string
+	}{
+		{"fits", 100000, []string{"eeee", "Earlier: ", "turn 0"}, nil, ""},
+		{"retrieved text dropped", 1600, []string{"Earlier: ", "turn 0", "turn 4"}, []string{"eeee"}, "retrieved"},
+		{"summary dropped", 1000, []string{"turn 0", "turn 4"}, []string{"eeee", "Earlier: "}, "summary"},
+		{"oldest turns dropped", 500, []string{"turn 4"}, []string{"eeee", "Earlier: ", "turn 0"}, "turns"},
+		{"context cut", 200, []string{"…", "User said: what is gemini?"}, []string{"eeee", "turn 0"}, "truncated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b.cfg.ContextWindow.MaxTokens = tt.window
+			b.metrics = newBotMetrics()
+			ctx := withPromptParts(context.Background(), promptParts{summary: summary, retrieved: []string{earlier}})
+			got, err := b.fitPrompt(ctx, promptData{
+				Persona:  defaultPersona,
+				MaxWords: 30,
+				Message:  "what is gemini?",
+				Context:  summary + earlier,
+				History:  b.memory.render(),
+				Language: languages["english"],
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tokens := estimateTokens(got); tokens > b.promptBudget(ctx) {
+				t.Errorf("prompt has %d tokens, over the budget of %d", tokens, b.promptBudget(ctx))
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("prompt lacks %q", s)
+				}
+			}
+			for _, s := range tt.wantNot {
+				if strings.Contains(got, s) {
+					t.Errorf("prompt still has %q", s)
+				}
+			}
+			trims := b.metrics.trimmedPrompts.snapshot()
+			if tt.wantTrims == "" && len(trims) > 0 || tt.wantTrims != "" && (len(trims) != 1 || trims[tt.wantTrims] != 1) {
+				t.Errorf("trimmed prompts = %v, want one at %q", trims, tt.wantTrims)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// stageControls are the monitor settings the on-stage host can change
+// during the show through the admin API. Paused stops idle prompts and
+// poll commentary; quiz and AMA announcements still go out. AutoTune lets
+// the monitor move IdlePromptGap with the audience's response; see
+// idletune.go.
+type stageControls struct {
+	Paused        bool     `json:"paused"`
+	AutoTune      bool     `json:"autoTune"`
+	IdleThreshold Duration `json:"idleThreshold"`
+	IdlePromptGap Duration `json:"idlePromptGap"`
+	PollUpdateGap Duration `json:"pollUpdateGap"`
+}
+
+// autoPrompt returns the host prompt kind the monitor should generate this
+// tick, "prompt" or "poll-update", or "" for neither. A forced poll
+// announcement goes out even while paused.
+func autoPrompt(c *stageControls, pacing Pacing, now, lastUserMessage, lastResponse time.Time, forcePoll bool) string {
+	switch {
+	case forcePoll:
+		return "poll-update"
+	case c.Paused:
+		return ""
+	case now.Sub(lastUserMessage) > pacing.scale(c.IdleThreshold.Duration) && now.Sub(lastResponse) >= pacing.scale(c.IdlePromptGap.Duration):
+		return "prompt"
+	case now.Sub(lastResponse) >= pacing.scale(c.PollUpdateGap.Duration):
+		return "poll-update"
+	}
+	return ""
+}
+
+func registerControlRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/control", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, b.room.controls.Load())
+	})
+
+	// PATCH changes only the fields present in the body. Setting
+	// idlePromptGap by hand turns auto-tuning off unless the same body
+	// turns it back on.
+	mux.HandleFunc("PATCH /admin/control", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		prev := b.room.controls.Load()
+		next := *prev
+		var set struct {
+			AutoTune *bool `json:"autoTune"`
+		}
+		if err := json.Unmarshal(body, &next); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		json.Unmarshal(body, &set)
+		if set.AutoTune == nil && next.IdlePromptGap != prev.IdlePromptGap {
+			next.AutoTune = false
+		}
+		if next.AutoTune && b.cfg.Monitor.PromptReplyWindow.Duration <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("auto-tuning is disabled by monitor.promptReplyWindow"))
+			return
+		}
+		for name, d := range map[string]Duration{"idleThreshold": next.IdleThreshold, "idlePromptGap": next.IdlePromptGap, "pollUpdateGap": next.PollUpdateGap} {
+			if d.Duration <= 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("%s must be positive", name))
+				return
+			}
+		}
+		if !b.room.controls.CompareAndSwap(prev, &next) {
+			writeError(w, http.StatusConflict, fmt.Errorf("controls changed concurrently, try again"))
+			return
+		}
+		if prev.Paused != next.Paused {
+			b.bus.Publish(Event{Kind: EventStateChanged, State: "auto-prompts", From: pausedName(prev.Paused), To: pausedName(next.Paused)})
+		}
+		writeJSON(w, http.StatusOK, &next)
+	})
+
+	mux.HandleFunc("POST /admin/control/poll-announcement", func(w http.ResponseWriter, r *http.Request) {
+		b.room.announcePoll.Store(true)
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// setPaused pauses or resumes auto-prompts, leaving the other controls as
+// they are.
+func (b *Bot) setPaused(paused bool) {
+	for {
+		prev := b.room.controls.Load()
+		if prev.Paused == paused {
+			return
+		}
+		next := *prev
+		next.Paused = paused
+		if b.room.controls.CompareAndSwap(prev, &next) {
+			b.bus.Publish(Event{Kind: EventStateChanged, State: "auto-prompts", From: pausedName(prev.Paused), To: pausedName(paused)})
+			return
+		}
+	}
+}
+
+func pausedName(paused bool) string {
+	if paused {
+		return "paused"
+	}
+	return "running"
+}
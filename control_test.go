@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAutoPrompt(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	controls := stageControls{IdleThreshold: Duration{30 * time.Second}, IdlePromptGap: Duration{10 * time.Second}, PollUpdateGap: Duration{15 * time.Second}}
+	paused := controls
+	paused.Paused = true
+	tuned := controls
+	tuned.IdleThreshold = Duration{2 * time.Minute}
+
+	tests := []struct {
+		name         string
+		controls     stageControls
+		lastUser     time.Duration
+		lastResponse time.Duration
+		force        bool
+		want         string
+	}{
+		{"idle room", controls, time.Minute, 20 * time.Second, false, "prompt"},
+		{"active room", controls, 5 * time.Second, 20 * time.Second, false, "poll-update"},
+		{"host just spoke", controls, time.Minute, 5 * time.Second, false, ""},
+		{"paused", paused, time.Minute, 20 * time.Second, false, ""},
+		{"forced while paused", paused, time.Minute, time.Second, true, "poll-update"},
+		{"raised idle threshold", tuned, time.Minute, 20 * time.Second, false, "poll-update"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := autoPrompt(&tt.controls, normalPacing, now, now.Add(-tt.lastUser), now.Add(-tt.lastResponse), tt.force)
+			if got != tt.want {
+				t.Errorf("autoPrompt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdlePromptGapTuning(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	gap := func() time.Duration { return b.room.controls.Load().IdlePromptGap.Duration }
+
+	// Ignored prompts slow the host down, up to the maximum.
+	now := start
+	var gaps []time.Duration
+	for range 6 {
+		b.promptSent(now)
+		now = now.Add(b.cfg.Monitor.PromptReplyWindow.Duration)
+		b.observeIdlePrompt(now, start)
+		gaps = append(gaps, gap())
+	}
+	if want := []time.Duration{15 * time.Second, 23 * time.Second, 35 * time.Second, 53 * time.Second, 80 * time.Second, 2 * time.Minute}; !slices.Equal(gaps, want) {
+		t.Errorf("gaps after ignored prompts = %v, want %v", gaps, want)
+	}
+
+	// A prompt that gets a reply, even before the window is up, speeds it
+	// back up.
+	b.promptSent(now)
+	b.observeIdlePrompt(now.Add(5*time.Second), now.Add(3*time.Second))
+	if g := gap(); g != 90*time.Second {
+		t.Errorf("gap after an answered prompt = %s, want 1m30s", g)
+	}
+	// Nothing is pending any more, so later ticks leave it alone.
+	b.observeIdlePrompt(now.Add(time.Hour), now)
+	if g := gap(); g != 90*time.Second {
+		t.Errorf("gap without a pending prompt = %s, want 1m30s", g)
+	}
+
+	// Prompting again before the window is up counts the last one as ignored.
+	b.promptSent(now)
+	b.promptSent(now.Add(time.Second))
+	if g := gap(); g != 2*time.Minute {
+		t.Errorf("gap after prompting twice = %s, want 2m", g)
+	}
+	if got := b.health.idlePromptsIgnored.Load(); got != 7 {
+		t.Errorf("idlePromptsIgnored = %d, want 7", got)
+	}
+}
+
+func TestIdlePromptGapOverride(t *testing.T) {
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	b.cfg.AdminToken = "s3cret"
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	patch := func(body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/admin/control", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if !b.room.controls.Load().AutoTune {
+		t.Fatal("auto-tuning is off by default")
+	}
+	if code := patch(`{"idlePromptGap": "45s"}`); code != http.StatusOK {
+		t.Fatalf("PATCH idlePromptGap = %d", code)
+	}
+	c := b.room.controls.Load()
+	if c.AutoTune || c.IdlePromptGap.Duration != 45*time.Second {
+		t.Errorf("controls after setting the gap = %+v, want it pinned at 45s", c)
+	}
+	b.promptSent(time.Now())
+	b.promptSent(time.Now())
+	if g := b.room.controls.Load().IdlePromptGap.Duration; g != 45*time.Second {
+		t.Errorf("pinned gap moved to %s", g)
+	}
+
+	if code := patch(`{"autoTune": true, "idlePromptGap": "20s"}`); code != http.StatusOK {
+		t.Fatalf("PATCH autoTune = %d", code)
+	}
+	if c := b.room.controls.Load(); !c.AutoTune || c.IdlePromptGap.Duration != 20*time.Second {
+		t.Errorf("controls after turning auto-tuning back on = %+v", c)
+	}
+
+	b.cfg.Monitor.PromptReplyWindow = Duration{-1}
+	if code := patch(`{"autoTune": true}`); code != http.StatusBadRequest {
+		t.Errorf("PATCH autoTune with tuning disabled = %d, want %d", code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Features that model tokens and Firestore operations are attributed to.
+const (
+	featureQA           = "qa"
+	featureIdlePrompt   = "idle-prompt"
+	featurePollUpdate   = "poll-update"
+	featureAnnouncement = "announcement"
+	featureSummary      = "summary"
+	featureMonitor      = "monitor"
+	// featurePollGeneration is the model writing new polls, and
+	// featurePollThemes it grouping open-text answers into themes.
+	featurePollGeneration = "poll-generation"
+	featurePollThemes     = "poll-themes"
+)
+
+// FeatureCost is what one feature used this session. Costs are in the
+// currency of the configured prices, normally US dollars.
+type FeatureCost struct {
+	// Items counts what the feature produced: messages handled, prompts
+	// and announcements sent, summaries written.
+	Items         int64   `firestore:"items" json:"items"`
+	ModelCalls    int64   `firestore:"modelCalls" json:"modelCalls"`
+	InputTokens   int64   `firestore:"inputTokens" json:"inputTokens"`
+	OutputTokens  int64   `firestore:"outputTokens" json:"outputTokens"`
+	Reads         int64   `firestore:"reads" json:"reads"`
+	Writes        int64   `firestore:"writes" json:"writes"`
+	ModelCost     float64 `firestore:"modelCost" json:"modelCost"`
+	FirestoreCost float64 `firestore:"firestoreCost" json:"firestoreCost"`
+	// CostPerItem is the feature's total cost divided by Items.
+	CostPerItem float64 `firestore:"costPerItem" json:"costPerItem"`
+}
+
+func (c *FeatureCost) add(o FeatureCost) {
+	c.Items += o.Items
+	c.ModelCalls += o.ModelCalls
+	c.InputTokens += o.InputTokens
+	c.OutputTokens += o.OutputTokens
+	c.Reads += o.Reads
+	c.Writes += o.Writes
+	c.ModelCost += o.ModelCost
+	c.FirestoreCost += o.FirestoreCost
+}
+
+// CostReport is one instance's cost breakdown for the session so far.
+type CostReport struct {
+	ID         string                 `firestore:"-" json:"id"`
+	InstanceID string                 `firestore:"instanceId" json:"instanceId"`
+	Room       string                 `firestore:"room,omitempty" json:"room,omitempty"`
+	Session    string                 `firestore:"session,omitempty" json:"session,omitempty"`
+	StartedAt  time.Time              `firestore:"startedAt" json:"startedAt"`
+	UpdatedAt  time.Time              `firestore:"updatedAt" json:"updatedAt"`
+	Features   map[string]FeatureCost `firestore:"features" json:"features"`
+	Total      FeatureCost            `firestore:"total" json:"total"`
+}
+
+// CostStore keeps the cost reports.
+type CostStore interface {
+	SaveCostReport(ctx context.Context, r CostReport) error
+}
+
+// costLedger adds up every feature's model tokens and Firestore
+// operations, priced by the configured rates.
+type costLedger struct {
+	cfg       CostConfig
+	id        string
+	startedAt time.Time
+
+	mu       sync.Mutex
+	features map[string]*FeatureCost
+}
+
+func newCostLedger(cfg CostConfig) *costLedger {
+	return &costLedger{cfg: cfg, id: newID("costs"), startedAt: clock.Now(), features: map[string]*FeatureCost{}}
+}
+
+type costScopeKey struct{}
+
+// costScope is the ledger and feature a context's costs go to.
+type costScope struct {
+	ledger  *costLedger
+	feature string
+}
+
+// attribute returns ctx with its model calls and Firestore operations
+// charged to feature.
+func (l *costLedger) attribute(ctx context.Context, feature string) context.Context {
+	return context.WithValue(ctx, costScopeKey{}, &costScope{ledger: l, feature: feature})
+}
+
+// item counts one thing feature produced.
+func (l *costLedger) item(feature string) {
+	l.update(feature, func(c *FeatureCost) { c.Items++ })
+}
+
+func (l *costLedger) update(feature string, fn func(c *FeatureCost)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c, ok := l.features[feature]
+	if !ok {
+		c = &FeatureCost{}
+		l.features[feature] = c
+	}
+	fn(c)
+}
+
+// countTokens charges a call to model to ctx's feature. Calls outside any
+// feature are not counted.
+func countTokens(ctx context.Context, model string, in, out int) {
+	s, _ := ctx.Value(costScopeKey{}).(*costScope)
+	if s == nil {
+		return
+	}
+	price := s.ledger.cfg.Models[model]
+	s.ledger.update(s.feature, func(c *FeatureCost) {
+		c.ModelCalls++
+		c.InputTokens += int64(in)
+		c.OutputTokens += int64(out)
+		c.ModelCost += (float64(in)*price.Input + float64(out)*price.Output) / 1e6
+	})
+}
+
+// countOps charges Firestore reads and writes to ctx's feature.
+func countOps(ctx context.Context, reads, writes int) {
+	s, _ := ctx.Value(costScopeKey{}).(*costScope)
+	if s == nil {
+		return
+	}
+	cfg := s.ledger.cfg
+	s.ledger.update(s.feature, func(c *FeatureCost) {
+		c.Reads += int64(reads)
+		c.Writes += int64(writes)
+		c.FirestoreCost += (float64(reads)*cfg.FirestoreReads + float64(writes)*cfg.FirestoreWrites) / 1e6
+	})
+}
+
+type tokenUsageKey struct{}
+
+// tokenUsage is where a generator reports the tokens a call used, when
+// its backend says.
+type tokenUsage struct{ in, out int }
+
+// reportTokens records the token counts the backend returned for the call
+// ctx belongs to.
+func reportTokens(ctx context.Context, in, out int) {
+	if u, _ := ctx.Value(tokenUsageKey{}).(*tokenUsage); u != nil {
+		u.in, u.out = in, out
+	}
+}
+
+// estimateTokens is the rough token count of text, about four characters
+// a token, for backends that don't report usage.
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// report is the breakdown so far.
+func (l *costLedger) report(cfg *Config) CostReport {
+	r := CostReport{
+		ID:         l.id,
+		InstanceID: cfg.InstanceID,
+		Room:       cfg.Room,
+		Session:    cfg.Session,
+		StartedAt:  l.startedAt,
+		UpdatedAt:  clock.Now(),
+		Features:   map[string]FeatureCost{},
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name, c := range l.features {
+		f := *c
+		if f.Items > 0 {
+			f.CostPerItem = (f.ModelCost + f.FirestoreCost) / float64(f.Items)
+		}
+		r.Features[name] = f
+		r.Total.add(f)
+	}
+	if r.Total.Items > 0 {
+		r.Total.CostPerItem = (r.Total.ModelCost + r.Total.FirestoreCost) / float64(r.Total.Items)
+	}
+	return r
+}
+
+// reportCosts writes the session's cost report every
+// costs.reportInterval, and a last time on shutdown.
+func (b *Bot) reportCosts(ctx context.Context) error {
+	ticker := clock.NewTicker(b.cfg.Costs.ReportInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := b.costStore.SaveCostReport(ctx, b.costs.report(b.cfg)); err != nil {
+				slog.Error("error writing the final cost report", "err", err)
+			}
+			return nil
+		case <-ticker.C():
+			if err := b.costStore.SaveCostReport(ctx, b.costs.report(b.cfg)); err != nil {
+				slog.Error("error writing cost report", "err", err)
+			}
+		}
+	}
+}
+
+func registerCostRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/costs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, b.costs.report(b.cfg))
+	})
+}
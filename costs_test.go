@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestCostLedger(t *testing.T) {
+	l := newCostLedger(CostConfig{
+		Models:          map[string]ModelPrice{"pro": {Input: 1, Output: 4}},
+		FirestoreReads:  0.5,
+		FirestoreWrites: 2,
+	})
+	reported := generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		reportTokens(ctx, 1000, 250)
+		return "A family of models, dost!", nil
+	})
+	silent := generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "12345678", nil
+	})
+	chain := modelChain{{name: "pro", model: reported}}
+	cheap := modelChain{{name: "flash", model: silent}}
+
+	qa := l.attribute(context.Background(), featureQA)
+	for range 2 {
+		l.item(featureQA)
+		if _, err := chain.Generate(qa, "What is Gemini?"); err != nil {
+			t.Fatal(err)
+		}
+		countOps(qa, 1, 3)
+	}
+	idle := l.attribute(context.Background(), featureIdlePrompt)
+	l.item(featureIdlePrompt)
+	if _, err := cheap.Generate(idle, "1234"); err != nil {
+		t.Fatal(err)
+	}
+	// Calls outside any feature are not counted.
+	if _, err := chain.Generate(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg Config
+	cfg.InstanceID = "blue"
+	r := l.report(&cfg)
+	approx := func(got, want float64) bool { return math.Abs(got-want) < 1e-12 }
+
+	got := r.Features[featureQA]
+	want := FeatureCost{Items: 2, ModelCalls: 2, InputTokens: 2000, OutputTokens: 500, Reads: 2, Writes: 6}
+	if got.Items != want.Items || got.ModelCalls != want.ModelCalls || got.InputTokens != want.InputTokens || got.OutputTokens != want.OutputTokens || got.Reads != want.Reads || got.Writes != want.Writes {
+		t.Errorf("qa counts = %+v, want %+v", got, want)
+	}
+	// 2000 input and 500 output tokens at 1 and 4 per million; 2 reads and
+	// 6 writes at 0.5 and 2 per million.
+	if !approx(got.ModelCost, 0.004) || !approx(got.FirestoreCost, 0.000013) || !approx(got.CostPerItem, 0.0020065) {
+		t.Errorf("qa costs = %v + %v (%v per item)", got.ModelCost, got.FirestoreCost, got.CostPerItem)
+	}
+
+	idleCost := r.Features[featureIdlePrompt]
+	if idleCost.InputTokens != 1 || idleCost.OutputTokens != 2 || idleCost.ModelCost != 0 {
+		t.Errorf("idle prompt = %+v, want estimated tokens of an unpriced model", idleCost)
+	}
+	if r.Total.Items != 3 || r.Total.ModelCalls != 3 || r.InstanceID != "blue" {
+		t.Errorf("report = %+v", r)
+	}
+}
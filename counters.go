@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync"
+)
+
+// statsDoc is the counter document of the session's audience stats.
+const statsDoc = "audience"
+
+// Fields of statsDoc.
+const (
+	statMessages       = "messages"
+	statScreened       = "screened"
+	statDropped        = "dropped"
+	statPublicReplies  = "publicReplies"
+	statPrivateReplies = "privateReplies"
+)
+
+// CounterConfig batches the running totals that change with nearly every
+// message, which would otherwise run into Firestore's limit of about one
+// write per second per document. Increments are added up in memory and
+// written every FlushInterval, each time to one of Shards shard documents
+// of the counter, so several instances flushing at once don't contend for
+// one document either. A counter's value is the sum of its shards.
+type CounterConfig struct {
+	FlushInterval Duration `json:"flushInterval" yaml:"flushInterval"`
+	Shards        int      `json:"shards" yaml:"shards"`
+}
+
+// CounterStore keeps sharded counter documents in the stats collection.
+type CounterStore interface {
+	// AddCounts adds deltas to the fields of shard shard of counter
+	// document doc, creating it if need be.
+	AddCounts(ctx context.Context, doc string, shard int, deltas map[string]int64) error
+	// Counts sums the fields of every shard of counter document doc.
+	Counts(ctx context.Context, doc string) (map[string]int64, error)
+}
+
+// counterWriter adds up increments to counter documents until they are
+// flushed.
+type counterWriter struct {
+	mu      sync.Mutex
+	pending map[string]map[string]int64
+	// flushes counts the flushes so far, to rotate through the shards.
+	flushes int
+}
+
+func newCounterWriter() *counterWriter {
+	return &counterWriter{pending: map[string]map[string]int64{}}
+}
+
+// add adds n to field of counter document doc.
+func (c *counterWriter) add(doc, field string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[doc] == nil {
+		c.pending[doc] = map[string]int64{}
+	}
+	c.pending[doc][field] += n
+}
+
+// take returns the pending increments, leaving none, and the number of the
+// flush they are for.
+func (c *counterWriter) take() (map[string]map[string]int64, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending := c.pending
+	c.pending = map[string]map[string]int64{}
+	c.flushes++
+	return pending, c.flushes
+}
+
+// putBack returns increments that could not be written, to go out with the
+// next flush.
+func (c *counterWriter) putBack(doc string, deltas map[string]int64) {
+	for field, n := range deltas {
+		c.add(doc, field, n)
+	}
+}
+
+// pendingCounts is a copy of the increments not yet flushed to doc.
+func (c *counterWriter) pendingCounts(doc string) map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.pending[doc])
+}
+
+// countStat adds one to field of the session's audience stats.
+func (b *Bot) countStat(field string) {
+	b.counters.add(statsDoc, field, 1)
+}
+
+// flushCounters writes the pending increments, each counter document's to
+// one of its shards. This instance starts at a shard of its own and moves
+// on to the next at every flush. Increments that fail to be written are
+// kept for the next flush.
+func (b *Bot) flushCounters(ctx context.Context) error {
+	pending, flush := b.counters.take()
+	shards := b.cfg.Counters.Shards
+	shard := (messageShard(b.cfg.InstanceID, shards) + flush) % shards
+	var firstErr error
+	for doc, deltas := range pending {
+		if err := b.counterStore.AddCounts(ctx, doc, shard, deltas); err != nil {
+			b.counters.putBack(doc, deltas)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// writeCounters flushes the counters every counters.flushInterval, and once
+// more on shutdown.
+func (b *Bot) writeCounters(ctx context.Context) error {
+	ticker := clock.NewTicker(b.cfg.Counters.FlushInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := b.flushCounters(context.WithoutCancel(ctx)); err != nil {
+				slog.Error("error flushing counters on shutdown", "err", err)
+			}
+			return nil
+		case <-ticker.C():
+		}
+		if err := b.flushCounters(ctx); err != nil {
+			slog.Error("error flushing counters", "err", err)
+		}
+	}
+}
+
+func registerStatsRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/stats", func(w http.ResponseWriter, r *http.Request) {
+		counts, err := b.counterStore.Counts(r.Context(), statsDoc)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"stats": counts, "pending": b.counters.pendingCounts(statsDoc)})
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// failingCounters is a CounterStore whose writes fail while fail is set.
+type failingCounters struct {
+	*memoryStore
+	fail bool
+}
+
+func (f *failingCounters) AddCounts(ctx context.Context, doc string, shard int, deltas map[string]int64) error {
+	if f.fail {
+		return errors.New("deadline exceeded")
+	}
+	return f.memoryStore.AddCounts(ctx, doc, shard, deltas)
+}
+
+func TestCounterWriter(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "Namaste!", nil
+	}))
+	counters := &failingCounters{memoryStore: store}
+	b.counterStore = counters
+	ctx := context.Background()
+
+	for range 5 {
+		b.countStat(statMessages)
+	}
+	b.countStat(statDropped)
+	if err := b.flushCounters(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.countStat(statMessages)
+	if err := b.flushCounters(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(store.counters[statsDoc]); n != 2 {
+		t.Errorf("two flushes wrote %d shards, want 2", n)
+	}
+
+	// A failed flush keeps its increments for the next one.
+	b.countStat(statMessages)
+	counters.fail = true
+	if err := b.flushCounters(ctx); err == nil {
+		t.Fatal("flushCounters succeeded with a failing store")
+	}
+	counters.fail = false
+	b.countStat(statPublicReplies)
+	if err := b.flushCounters(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Counts(ctx, statsDoc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{statMessages: 7, statDropped: 1, statPublicReplies: 1}
+	if len(got) != len(want) {
+		t.Errorf("counts = %v, want %v", got, want)
+	}
+	for field, n := range want {
+		if got[field] != n {
+			t.Errorf("%s = %d, want %d", field, got[field], n)
+		}
+	}
+	if shards := len(store.counters[statsDoc]); shards > b.cfg.Counters.Shards {
+		t.Errorf("wrote %d shards, want at most %d", shards, b.cfg.Counters.Shards)
+	}
+}
+
+func TestStatsRoute(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "Namaste!", nil
+	}))
+	b.cfg.AdminToken = "secret"
+	store.AddCounts(context.Background(), statsDoc, 0, map[string]int64{statMessages: 3})
+	store.AddCounts(context.Background(), statsDoc, 2, map[string]int64{statMessages: 4})
+	b.countStat(statScreened)
+
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/admin/stats", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Stats   map[string]int64 `json:"stats"`
+		Pending map[string]int64 `json:"pending"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Stats[statMessages] != 7 || body.Pending[statScreened] != 1 {
+		t.Errorf("GET /admin/stats = %+v, want 7 messages and 1 screened pending", body)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// dashboardTemplates is the embedded admin dashboard: a page that polls
+// fragments of itself with htmx, so small events need no admin frontend.
+//
+//go:embed dashboard/*.tmpl
+var dashboardTemplates embed.FS
+
+var dashboard = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"formatNumber": formatNumber,
+	"bucketLabel":  bucketLabel,
+}).ParseFS(dashboardTemplates, "dashboard/*.tmpl"))
+
+// dashboardPings is how many of the latest host messages the dashboard shows.
+const dashboardPings = 10
+
+// adminCookie carries the admin token for the dashboard, since a browser
+// navigating to a page can't send an Authorization header.
+const adminCookie = "admin-token"
+
+type dashboardStatus struct {
+	QueueDepth int
+	QueueErr   string
+	InFlight   int64
+	Processed  int64
+	Level      string
+	Persona    string
+	Paused     bool
+	// SLA sums up the answer deadline, and Breached flags a breach of it.
+	SLA      string
+	Breached bool
+}
+
+type dashboardPingList struct {
+	Replies []Message
+	Err     string
+}
+
+type dashboardPoll struct {
+	Question string
+	Options  []apiPollOption
+	Err      string
+	// Numeric is set for numeric polls, which have no options, and
+	// Answers and Themes for open-text ones.
+	Numeric *NumericResults
+	Text    bool
+	Answers int
+	Themes  []PollTheme
+}
+
+func (b *Bot) dashboardStatus(ctx context.Context) dashboardStatus {
+	s := dashboardStatus{
+		InFlight:  b.health.messagesInFlight.Load(),
+		Processed: b.health.messagesProcessed.Load(),
+		Level:     b.ladder.current().String(),
+		Persona:   b.personas.current().Name,
+		Paused:    b.room.controls.Load().Paused,
+	}
+	sla := b.sla.status(clock.Now())
+	s.Breached = sla.Breached
+	s.SLA = "no answers in the window"
+	if sla.Answered > 0 {
+		s.SLA = fmt.Sprintf("%.0f%% of %d within %s (target %.0f%%), p%.0f %s", sla.WithinTarget*100, sla.Answered, sla.Target, sla.Percentile*100, sla.Percentile*100, time.Duration(sla.LatencyMs)*time.Millisecond)
+	}
+	queued, err := b.messages.Unprocessed(ctx)
+	if err != nil {
+		s.QueueErr = err.Error()
+	}
+	s.QueueDepth = len(queued)
+	return s
+}
+
+func (b *Bot) dashboardPings(ctx context.Context) dashboardPingList {
+	replies, err := b.messages.RecentReplies(ctx, time.Time{}, dashboardPings)
+	if err != nil {
+		return dashboardPingList{Err: err.Error()}
+	}
+	return dashboardPingList{Replies: replies}
+}
+
+func (b *Bot) dashboardPoll(ctx context.Context) dashboardPoll {
+	tally, err := b.tallyLivePoll(ctx)
+	if err != nil {
+		return dashboardPoll{Err: err.Error()}
+	}
+	p := dashboardPoll{Question: tally.Poll.Question, Options: pollOptions(tally.Poll)}
+	if tally.Poll.numeric() {
+		res := numericResults(tally.Poll)
+		p.Numeric = &res
+	}
+	if tally.Poll.textual() {
+		p.Text, p.Answers, p.Themes = true, len(tally.Poll.TextAnswers), tally.Poll.Themes
+	}
+	return p
+}
+
+// renderDashboard writes the named template, logging failures since the
+// response may already have started.
+func renderDashboard(w http.ResponseWriter, status int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := dashboard.ExecuteTemplate(w, name, data); err != nil {
+		slog.Error("error rendering dashboard", "page", name, "err", err)
+	}
+}
+
+func registerDashboardRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /dashboard", func(w http.ResponseWriter, r *http.Request) {
+		renderDashboard(w, http.StatusOK, "page", map[string]any{
+			"Status": b.dashboardStatus(r.Context()),
+			"Pings":  b.dashboardPings(r.Context()),
+			"Poll":   b.dashboardPoll(r.Context()),
+		})
+	})
+	mux.HandleFunc("GET /dashboard/status", func(w http.ResponseWriter, r *http.Request) {
+		renderDashboard(w, http.StatusOK, "status", b.dashboardStatus(r.Context()))
+	})
+	mux.HandleFunc("GET /dashboard/pings", func(w http.ResponseWriter, r *http.Request) {
+		renderDashboard(w, http.StatusOK, "pings", b.dashboardPings(r.Context()))
+	})
+	mux.HandleFunc("GET /dashboard/poll", func(w http.ResponseWriter, r *http.Request) {
+		renderDashboard(w, http.StatusOK, "poll", b.dashboardPoll(r.Context()))
+	})
+	for path, paused := range map[string]bool{"POST /dashboard/pause": true, "POST /dashboard/resume": false} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			b.setPaused(paused)
+			renderDashboard(w, http.StatusOK, "status", b.dashboardStatus(r.Context()))
+		})
+	}
+	// Already signed in.
+	mux.HandleFunc("/dashboard/login", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	})
+}
+
+// serveDashboardLogin handles unauthenticated dashboard requests: a form
+// posting the admin token, which is then kept in an HTTP-only, same-site
+// cookie.
+func serveDashboardLogin(w http.ResponseWriter, r *http.Request, token string) {
+	if r.Method != http.MethodPost || r.URL.Path != "/dashboard/login" {
+		renderDashboard(w, http.StatusUnauthorized, "login", "")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.PostFormValue("token")), []byte(token)) != 1 {
+		renderDashboard(w, http.StatusUnauthorized, "login", "Wrong token.")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	store := newMemoryStore()
+	store.SetPoll("q1", PollQuestion{Question: "Favourite Gemini model?", Options: map[string]PollOption{
+		"a": {Label: "A", OpText: "Flash", Voters: []string{"ann", "bob"}},
+		"b": {Label: "B", OpText: "Pro", Voters: []string{"cat"}},
+	}})
+	store.AddMessage(Message{ID: "m2", Message: "still waiting"})
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.AdminToken = "s3cret"
+	if err := b.publishReply(context.Background(), Message{ID: "m1", Message: "A family of models, dost!", Question: "What is Gemini?"}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get("/dashboard"); code != http.StatusUnauthorized || !strings.Contains(body, `name="token"`) {
+		t.Fatalf("GET /dashboard signed out = %d %q, want the sign-in form", code, body)
+	}
+	if code, _ := get("/admin/control"); code != http.StatusUnauthorized {
+		t.Errorf("GET /admin/control signed out = %d, want %d", code, http.StatusUnauthorized)
+	}
+	resp, err := client.PostForm(srv.URL+"/dashboard/login", url.Values{"token": {"wrong"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("sign in with a wrong token = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+	resp, err = client.PostForm(srv.URL+"/dashboard/login", url.Values{"token": {"s3cret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/dashboard" {
+		t.Fatalf("sign in = %d at %s, want the dashboard", resp.StatusCode, resp.Request.URL.Path)
+	}
+
+	code, body := get("/dashboard")
+	if code != http.StatusOK {
+		t.Fatalf("GET /dashboard = %d", code)
+	}
+	for _, want := range []string{"1 waiting", "A family of models, dost!", "What is Gemini?", "Favourite Gemini model?", "<td>Flash</td><td>2</td>", "Pause"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("dashboard does not show %q:\n%s", want, body)
+		}
+	}
+	if code, _ := get("/admin/control"); code != http.StatusOK {
+		t.Errorf("GET /admin/control with the dashboard cookie = %d, want %d", code, http.StatusOK)
+	}
+
+	resp, err = client.Post(srv.URL+"/dashboard/pause", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !b.room.controls.Load().Paused || !strings.Contains(string(paused), "Resume") {
+		t.Errorf("after pause: controls %+v, fragment %q; want paused with a resume button", b.room.controls.Load(), paused)
+	}
+	resp, err = client.Post(srv.URL+"/dashboard/resume", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if b.room.controls.Load().Paused {
+		t.Error("resume left auto-prompts paused")
+	}
+}
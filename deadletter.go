@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DeadLetter is an audience message the host gave up on after
+// cfg.DeadLetterAfter failed attempts. The original message stays in the
+// user collection, marked processed and deadLettered; setting Requeue puts
+// it back in the queue.
+type DeadLetter struct {
+	ID       string    `firestore:"id"`
+	Message  string    `firestore:"message"`
+	Error    string    `firestore:"error"`
+	Attempts int       `firestore:"attempts"`
+	FailedAt time.Time `firestore:"failedAt"`
+	Requeue  bool      `firestore:"requeue"`
+}
+
+// processMessage claims and answers one triaged message, trying it up to
+// cfg.DeadLetterAfter times before dead-lettering it, so that a message
+// that keeps failing neither stops the listener nor is lost. Everything
+// logged along the way carries one correlation ID, and it is traced from
+// the snapshot that brought it in, time spent queued for a worker
+// included.
+func (b *Bot) processMessage(ctx context.Context, pool *workerPool, t triagedMessage) {
+	id := t.Msg.ID
+	received := t.Received
+	if received.IsZero() {
+		received = time.Now()
+	}
+	ctx, span := startSpan(ctx, "message", trace.WithTimestamp(received), trace.WithNewRoot(), trace.WithAttributes(
+		attribute.String("message.id", id),
+		attribute.String("triage.decision", t.Decision.String()),
+	))
+	defer span.End()
+	if !t.Msg.Timestamp.IsZero() {
+		// How long the message took to reach the listener.
+		span.SetAttributes(attribute.Int64("message.snapshot_lag_ms", received.Sub(t.Msg.Timestamp).Milliseconds()))
+	}
+	span.AddEvent("dequeued")
+	ctx = withCorrelation(ctx, t.Msg)
+	logger := loggerFrom(ctx)
+	var claimed bool
+	err := b.write(ctx, "claim", func(ctx context.Context) (err error) {
+		claimed, err = b.messages.Claim(ctx, id, b.cfg.InstanceID, b.cfg.ClaimLease.Duration)
+		return err
+	})
+	if err != nil {
+		logger.Warn("leaving message for a later snapshot", "err", err)
+		pool.finish(id, false)
+		return
+	}
+	if !claimed {
+		// Another replica is answering it.
+		pool.finish(id, true)
+		return
+	}
+	// Answers can take longer than the lease, so it is renewed until the
+	// message is done; work on a message whose lease was lost is stopped.
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	go b.renewClaim(ctx, id, stop)
+
+	// Each attempt resumes where the last one failed, so what the message
+	// set off, from its stats to the model's answer, happens once.
+	msg := *t.Msg // handleUserMessage rewrites the user ID
+	var progress messageProgress
+	backoff := b.retry.baseDelay
+	for attempt := 1; ; attempt++ {
+		attemptCtx, attemptSpan := startSpan(ctx, "handle", trace.WithAttributes(attribute.Int("attempt", attempt)))
+		err = b.resumeUserMessage(attemptCtx, &msg, t.Decision, &progress)
+		endSpan(attemptSpan, err)
+		if errors.Is(err, errClaimLost) {
+			logger.Warn("another replica took over the message", "err", err)
+			pool.finish(id, true)
+			return
+		}
+		if err == nil || ctx.Err() != nil {
+			if err == nil {
+				b.queueStatus.answered(clock.Now())
+			}
+			pool.finish(id, err == nil)
+			return
+		}
+		if attempt >= b.cfg.DeadLetterAfter {
+			logger.Error("dead-lettering message", "attempts", attempt, "err", err)
+			span.SetStatus(codes.Error, "dead-lettered")
+			dl := DeadLetter{ID: id, Message: t.Msg.Message, Error: err.Error(), Attempts: attempt, FailedAt: clock.Now()}
+			if err := b.retry.do(ctx, func(ctx context.Context) error { return b.messages.DeadLetter(ctx, dl) }); err != nil {
+				logger.Error("error dead-lettering message, leaving it for a later snapshot", "err", err)
+				pool.finish(id, false)
+				return
+			}
+			b.health.messagesDeadLettered.Add(1)
+			// Claim refuses it while dead-lettered; forgetting it lets a
+			// requeued message be picked up at once.
+			pool.finish(id, false)
+			return
+		}
+		logger.Warn("error handling message", "attempt", attempt, "maxAttempts", b.cfg.DeadLetterAfter, "err", err)
+		select {
+		case <-ctx.Done():
+			pool.finish(id, false)
+			return
+		case <-clock.After(jitter(backoff, 0.2)):
+		}
+		backoff = min(backoff*2, b.retry.maxDelay)
+	}
+}
+
+// renewClaim claims message id again every third of the lease until ctx is
+// done, calling lost if another replica has taken it over meanwhile.
+func (b *Bot) renewClaim(ctx context.Context, id string, lost func()) {
+	lease := b.cfg.ClaimLease.Duration
+	ticker := clock.NewTicker(lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+		claimed, err := b.messages.Claim(ctx, id, b.cfg.InstanceID, lease)
+		if err != nil {
+			if ctx.Err() == nil {
+				loggerFrom(ctx).Warn("error renewing claim, trying again", "err", err)
+			}
+			continue
+		}
+		if !claimed {
+			loggerFrom(ctx).Warn("claim lost to another replica, stopping")
+			lost()
+			return
+		}
+	}
+}
+
+// requeueDeadLetters puts dead letters an operator flagged with requeue
+// back in the queue of unprocessed messages.
+func (b *Bot) requeueDeadLetters(ctx context.Context) error {
+	return b.metrics.listen(func() error {
+		return b.messages.WatchRequeues(ctx, func(ids []string) error {
+			for _, id := range ids {
+				if err := b.retry.do(ctx, func(ctx context.Context) error { return b.messages.Requeue(ctx, id) }); err != nil {
+					slog.Error("error requeueing message", "messageId", id, "err", err)
+					continue
+				}
+				slog.Info("requeued dead-lettered message", "messageId", id)
+			}
+			return nil
+		})
+	})
+}
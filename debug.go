@@ -0,0 +1,190 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runtimeHealth is updated by a bot's listener and monitor loops so the
+// debug endpoint can tell a stalled loop from an idle one.
+type runtimeHealth struct {
+	startedAt            time.Time
+	listenerLastSnapshot atomic.Int64
+	monitorLastTick      atomic.Int64
+	messagesProcessed    atomic.Int64
+	messagesInFlight     atomic.Int64
+	messagesDeadLettered atomic.Int64
+	// messagesThrottled counts messages the spam filter dropped.
+	messagesThrottled atomic.Int64
+	// idlePromptsAnswered and idlePromptsIgnored count idle prompts that
+	// did and didn't get the audience talking.
+	idlePromptsAnswered atomic.Int64
+	idlePromptsIgnored  atomic.Int64
+	// snapshotLagMillis is how old the last message was when the listener
+	// got it.
+	snapshotLagMillis atomic.Int64
+}
+
+func newRuntimeHealth() *runtimeHealth {
+	return &runtimeHealth{startedAt: time.Now()}
+}
+
+// debugVars are the operational counters published through expvar and
+// served at /debug/vars, by name, each read from the bot at the time.
+var debugVars = map[string]func(b *Bot) any{
+	"messagesInFlight":     func(b *Bot) any { return b.health.messagesInFlight.Load() },
+	"messagesProcessed":    func(b *Bot) any { return b.health.messagesProcessed.Load() },
+	"messagesDeadLettered": func(b *Bot) any { return b.health.messagesDeadLettered.Load() },
+	"messagesThrottled":    func(b *Bot) any { return b.health.messagesThrottled.Load() },
+	"idlePromptsAnswered":  func(b *Bot) any { return b.health.idlePromptsAnswered.Load() },
+	"idlePromptsIgnored":   func(b *Bot) any { return b.health.idlePromptsIgnored.Load() },
+	"snapshotLagMs":        func(b *Bot) any { return b.health.snapshotLagMillis.Load() },
+	"mutexWaitSeconds":     func(b *Bot) any { return mutexWaitSeconds() },
+	"goroutines":           func(b *Bot) any { return runtime.NumGoroutine() },
+	"restarts":             func(b *Bot) any { return b.supervisor.restartCounts() },
+	"eventsDropped":        func(b *Bot) any { return b.bus.dropped.Load() },
+	"answerLatencyMs":      func(b *Bot) any { return b.sla.status(clock.Now()).LatencyMs },
+	"answersWithinSLA":     func(b *Bot) any { return b.sla.status(clock.Now()).WithinTarget },
+	"slaBreached":          func(b *Bot) any { return b.sla.status(clock.Now()).Breached },
+}
+
+// expvarBot is the bot whose counters expvar publishes. expvar's names are
+// process-wide and can only be published once, so they are published on
+// first use and read whichever bot registered its debug routes last.
+var (
+	expvarBot  atomic.Pointer[Bot]
+	expvarOnce sync.Once
+)
+
+// publishDebugVars publishes b's debugVars through expvar.
+func publishDebugVars(b *Bot) {
+	expvarBot.Store(b)
+	expvarOnce.Do(func() {
+		for name, read := range debugVars {
+			expvar.Publish(name, expvar.Func(func() any { return read(expvarBot.Load()) }))
+		}
+	})
+}
+
+// mutexWaitSeconds is how long goroutines have spent waiting on contended
+// sync.Mutex and sync.RWMutex locks since the backend started, as measured
+// by the runtime.
+func mutexWaitSeconds() float64 {
+	sample := []metrics.Sample{{Name: "/sync/mutex/wait/total:seconds"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64 {
+		return 0
+	}
+	return sample[0].Value.Float64()
+}
+
+// DebugStatus is the payload served at /debug/status.
+type DebugStatus struct {
+	Uptime      string            `json:"uptime"`
+	Goroutines  int               `json:"goroutines"`
+	HeapAlloc   uint64            `json:"heapAllocBytes"`
+	NumGC       uint32            `json:"numGC"`
+	Messages    MessageStatus     `json:"messages"`
+	Listener    LoopStatus        `json:"listener"`
+	Monitor     LoopStatus        `json:"monitor"`
+	Caches      map[string]int    `json:"caches"`
+	Pacing      Pacing            `json:"pacing"`
+	Degradation DegradationStatus `json:"degradation"`
+	Restarts    map[string]int    `json:"restarts"`
+	SLA         SLAStatus         `json:"sla"`
+}
+
+// MessageStatus counts audience messages and how busy the listener's
+// worker pool is. Up to Workers messages are answered at once, so InFlight
+// ranges from 0 to Workers. BusyWorkers at Workers with Queued at
+// QueueSize across polls means the pool is saturated: replies are stuck on
+// the model or Firestore, or the audience is outpacing the workers, and
+// Backlog counts the triaged messages waiting for room in the queue.
+type MessageStatus struct {
+	InFlight     int64 `json:"inFlight"`
+	Processed    int64 `json:"processed"`
+	DeadLettered int64 `json:"deadLettered"`
+	Workers      int   `json:"workers"`
+	BusyWorkers  int64 `json:"busyWorkers"`
+	Queued       int   `json:"queued"`
+	QueueSize    int   `json:"queueSize"`
+	Backlog      int   `json:"backlog"`
+}
+
+type LoopStatus struct {
+	LastActivity time.Time `json:"lastActivity"`
+	SecondsAgo   float64   `json:"secondsAgo"`
+}
+
+func loopStatus(unixNano int64) LoopStatus {
+	if unixNano == 0 {
+		return LoopStatus{SecondsAgo: -1}
+	}
+	t := time.Unix(0, unixNano)
+	return LoopStatus{LastActivity: t, SecondsAgo: time.Since(t).Seconds()}
+}
+
+func debugStatus(b *Bot) DebugStatus {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	health := b.health
+
+	caches := map[string]int{}
+	b.wordCloud.mu.Lock()
+	caches["wordCloudTerms"] = len(b.wordCloud.weights)
+	b.wordCloud.mu.Unlock()
+	if b.pseudonyms != nil {
+		b.pseudonyms.mu.Lock()
+		caches["pseudonyms"] = len(b.pseudonyms.recorded)
+		b.pseudonyms.mu.Unlock()
+	}
+
+	messages := MessageStatus{
+		InFlight:     health.messagesInFlight.Load(),
+		Processed:    health.messagesProcessed.Load(),
+		DeadLettered: health.messagesDeadLettered.Load(),
+		Workers:      b.cfg.Workers,
+	}
+	if pool := b.pool.Load(); pool != nil {
+		messages.BusyWorkers = pool.busy.Load()
+		messages.Queued, messages.QueueSize = len(pool.jobs), cap(pool.jobs)
+		messages.Backlog = pool.waiting()
+	}
+
+	return DebugStatus{
+		Uptime:      time.Since(health.startedAt).Round(time.Second).String(),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   mem.HeapAlloc,
+		NumGC:       mem.NumGC,
+		Messages:    messages,
+		Listener:    loopStatus(health.listenerLastSnapshot.Load()),
+		Monitor:     loopStatus(health.monitorLastTick.Load()),
+		Caches:      caches,
+		Pacing:      b.getPacing(),
+		Degradation: b.ladder.status(),
+		Restarts:    b.supervisor.restartCounts(),
+		SLA:         b.sla.status(clock.Now()),
+	}
+}
+
+// registerDebugRoutes adds pprof, expvar's /debug/vars and /debug/status
+// to the admin mux.
+func registerDebugRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	publishDebugVars(b)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, debugStatus(b))
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugVars(t *testing.T) {
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	b.cfg.AdminToken = "secret"
+	b.health.messagesInFlight.Store(2)
+	b.health.snapshotLagMillis.Store(150)
+
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/debug/vars", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var vars map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars["messagesInFlight"] != 2.0 || vars["snapshotLagMs"] != 150.0 {
+		t.Errorf("messagesInFlight, snapshotLagMs = %v, %v, want 2 and 150", vars["messagesInFlight"], vars["snapshotLagMs"])
+	}
+	if _, ok := vars["mutexWaitSeconds"].(float64); !ok {
+		t.Errorf("mutexWaitSeconds = %v, want the runtime's mutex wait time", vars["mutexWaitSeconds"])
+	}
+	if _, ok := vars["memstats"]; !ok {
+		t.Error("expvar's own memstats are missing")
+	}
+
+	req, _ = http.NewRequest("GET", srv.URL+"/debug/vars", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /debug/vars without a token = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestDebugStatusWorkers(t *testing.T) {
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	if got := debugStatus(b).Messages; got.Workers != b.cfg.Workers || got.BusyWorkers != 0 || got.QueueSize != 0 {
+		t.Errorf("messages before the listener starts = %+v, want only the worker count", got)
+	}
+
+	b.cfg.Workers = 2
+	pool := newWorkerPool(b.cfg.Workers)
+	pool.busy.Add(2)
+	pool.queue([]triagedMessage{{Msg: &Message{ID: "m1"}}, {Msg: &Message{ID: "m2"}}, {Msg: &Message{ID: "m3"}}})
+	b.pool.Store(pool)
+	want := MessageStatus{Workers: 2, BusyWorkers: 2, Queued: 2, QueueSize: 2, Backlog: 1}
+	if got := debugStatus(b).Messages; got != want {
+		t.Errorf("messages = %+v, want %+v", got, want)
+	}
+}
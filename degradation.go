@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// degradationLevel is a rung on the ladder the host steps down when the
+// model misbehaves: full AI, a cheaper model, cached/FAQ answers, canned
+// lines, and finally silence with an alert to the moderators.
+type degradationLevel int
+
+const (
+	levelFullAI degradationLevel = iota
+	levelCheapModel
+	levelCached
+	levelCanned
+	levelSilent
+)
+
+var levelNames = [...]string{"full-ai", "cheap-model", "cached", "canned", "silent"}
+
+func (l degradationLevel) String() string { return levelNames[l] }
+
+// errSilenced is returned by generateResponse when the ladder has reached
+// the silent level; callers skip publishing instead of failing.
+var errSilenced = errors.New("host is silenced by the degradation ladder")
+
+var defaultCannedLines = []string{
+	"Deviyon aur sajjanon, what a wonderful audience! Keep those questions coming.",
+	"Lock kiya jaye? Not yet, my friends. Stay with me, the best is yet to come.",
+	"Aap sab ka bahut bahut dhanyavaad. The game continues, so keep playing!",
+}
+
+// hostPromptKinds are the generateResponse inputs the bot itself produces.
+// Their replies depend on live state, so they are never served from cache.
+// Apart from the idle prompt, their context carries information the
+// audience needs (a tie-breaker question, the winner), so below the model
+// rungs it is shown verbatim instead of a canned line.
+var hostPromptKinds = map[string]bool{
+	"prompt":           true,
+	"poll-update":      true,
+	"bonus-round":      true,
+	"tie-breaker":      true,
+	"quiz-winner":      true,
+	"ama-open":         true,
+	"ama-wrap-up":      true,
+	"section-callout":  true,
+	"sponsor-shoutout": true,
+	"poll-results":     true,
+	"question-intro":   true,
+	"quiz-lock":        true,
+	"session-welcome":  true,
+	"session-closing":  true,
+	"quiz-answer":      true,
+	"quiz-suspense":    true,
+	"quiz-reaction":    true,
+
+	// Numeric and open-text polls announce their results with prompts of
+	// their own.
+	"numeric-poll-results": true,
+	"text-poll-results":    true,
+	// So do polls the audience wagered on.
+	"wager-results": true,
+	// Head-to-head duels; see duel.go.
+	"duel-start":    true,
+	"duel-question": true,
+	"duel-play":     true,
+	"duel-tiebreak": true,
+	"duel-winner":   true,
+	// Buzzer questions; see buzzer.go.
+	"buzz": true,
+}
+
+type generationOutcome struct {
+	at      time.Time
+	failed  bool
+	latency time.Duration
+}
+
+// ModeratorAlert is written to the alerts collection when the host goes silent.
+type ModeratorAlert struct {
+	Level     string    `firestore:"level"`
+	Reason    string    `firestore:"reason"`
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+type degradationLadder struct {
+	cfg DegradationConfig
+
+	mu        sync.Mutex
+	level     degradationLevel
+	changedAt time.Time
+	reason    string
+	outcomes  []generationOutcome
+	alerts    []ModeratorAlert
+	cache     map[string]string
+	// degradedSince is when the ladder last left the model rungs; it is
+	// cleared by the next successful model call, so brief recoveries that
+	// fail again still count as one sustained outage.
+	degradedSince time.Time
+	cacheMisses   int
+	// notify, if set, is told about every level change. It is called with
+	// the ladder locked and must not block.
+	notify func(Event)
+}
+
+func newDegradationLadder(cfg DegradationConfig) *degradationLadder {
+	return &degradationLadder{cfg: cfg, changedAt: clock.Now(), cache: map[string]string{}}
+}
+
+// current returns the active level. At the canned rung, an outage that has
+// lasted SilenceAfter silences the host and alerts moderators; otherwise a
+// level held for RecoverAfter steps back up one rung to try again.
+func (l *degradationLadder) current() degradationLevel {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := clock.Now()
+	switch {
+	case l.level == levelCanned && !l.degradedSince.IsZero() && now.Sub(l.degradedSince) >= l.cfg.SilenceAfter.Duration:
+		l.setLevelLocked(levelSilent, "no successful model call for "+now.Sub(l.degradedSince).Round(time.Second).String())
+	case l.level > levelFullAI && now.Sub(l.changedAt) >= l.cfg.RecoverAfter.Duration:
+		if l.level == levelSilent {
+			// Give the climb back to the model rungs a fresh SilenceAfter.
+			l.degradedSince = now
+		}
+		l.setLevelLocked(l.level-1, "recovering after "+l.cfg.RecoverAfter.String())
+	}
+	return l.level
+}
+
+// record feeds a model call's outcome into the ladder and steps down when
+// quota is exhausted, or when the error rate or average latency over the
+// window exceeds its limit.
+func (l *degradationLadder) record(err error, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := clock.Now()
+	if err == nil {
+		l.degradedSince = time.Time{}
+	}
+	l.outcomes = append(l.outcomes, generationOutcome{at: now, failed: err != nil, latency: latency})
+	cutoff := now.Add(-l.cfg.Window.Duration)
+	for len(l.outcomes) > 0 && l.outcomes[0].at.Before(cutoff) {
+		l.outcomes = l.outcomes[1:]
+	}
+	// Only the model rungs make model calls; an outcome arriving after the
+	// ladder already stepped below them has nothing left to decide.
+	if l.level > levelCheapModel {
+		return
+	}
+
+	if err != nil && isQuotaError(err) {
+		l.setLevelLocked(l.level+1, "quota exhausted: "+err.Error())
+		return
+	}
+
+	const minSamples = 4
+	if len(l.outcomes) < minSamples {
+		return
+	}
+	failed := 0
+	var total time.Duration
+	for _, o := range l.outcomes {
+		if o.failed {
+			failed++
+		}
+		total += o.latency
+	}
+	errorRate := float64(failed) / float64(len(l.outcomes))
+	avgLatency := total / time.Duration(len(l.outcomes))
+	switch {
+	case errorRate >= l.cfg.MaxErrorRate:
+		l.setLevelLocked(l.level+1, fmt.Sprintf("error rate %.0f%% over %s", errorRate*100, l.cfg.Window))
+	case avgLatency > l.cfg.MaxLatency.Duration:
+		l.setLevelLocked(l.level+1, fmt.Sprintf("average latency %s over %s", avgLatency.Round(time.Millisecond), l.cfg.Window))
+	}
+}
+
+// cacheMiss records that the cached rung had no answer for an audience
+// message. After MaxCacheMisses in a row the cache is clearly not covering
+// the conversation, and the ladder steps down to canned lines.
+func (l *degradationLadder) cacheMiss() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.level != levelCached {
+		return
+	}
+	l.cacheMisses++
+	if l.cacheMisses >= l.cfg.MaxCacheMisses {
+		l.setLevelLocked(levelCanned, fmt.Sprintf("%d cache misses in a row", l.cacheMisses))
+	}
+}
+
+func (l *degradationLadder) cacheHit() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cacheMisses = 0
+}
+
+func (l *degradationLadder) setLevelLocked(level degradationLevel, reason string) {
+	if level == l.level {
+		return
+	}
+	slog.Warn("degradation ladder moved", "from", l.level.String(), "to", level.String(), "reason", reason)
+	if l.notify != nil {
+		l.notify(Event{Kind: EventStateChanged, State: "degradation", From: l.level.String(), To: level.String(), Text: reason})
+	}
+	l.level = level
+	l.reason = reason
+	l.changedAt = clock.Now()
+	l.outcomes = nil
+	l.cacheMisses = 0
+	if level > levelCheapModel && l.degradedSince.IsZero() {
+		l.degradedSince = l.changedAt
+	}
+	if level == levelSilent {
+		l.alerts = append(l.alerts, ModeratorAlert{Level: level.String(), Reason: reason, CreatedAt: l.changedAt})
+	}
+}
+
+func isQuotaError(err error) bool {
+	return status.Code(err) == codes.ResourceExhausted || strings.Contains(err.Error(), "429")
+}
+
+func normalizeQuestion(text string) string {
+	return strings.Join(splitWords(text), " ")
+}
+
+func (l *degradationLadder) remember(userMessage, response string) {
+	if hostPromptKinds[userMessage] {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	const maxCached = 500
+	if len(l.cache) >= maxCached {
+		for k := range l.cache {
+			delete(l.cache, k)
+			break
+		}
+	}
+	l.cache[normalizeQuestion(userMessage)] = response
+}
+
+// cachedAnswer looks for a configured FAQ entry whose keyword appears in the
+// message, then for an earlier answer to the same question.
+func (l *degradationLadder) cachedAnswer(userMessage string) (string, bool) {
+	if hostPromptKinds[userMessage] {
+		return "", false
+	}
+	if answer, ok := l.faqAnswer(userMessage); ok {
+		return answer, true
+	}
+	normalized := normalizeQuestion(userMessage)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	answer, ok := l.cache[normalized]
+	return answer, ok
+}
+
+// faqAnswer returns the configured FAQ entry whose keyword appears in the
+// message, if any.
+func (l *degradationLadder) faqAnswer(userMessage string) (string, bool) {
+	normalized := normalizeQuestion(userMessage)
+	for keyword, answer := range l.cfg.FAQ {
+		if strings.Contains(normalized, normalizeQuestion(keyword)) {
+			return answer, true
+		}
+	}
+	return "", false
+}
+
+func (l *degradationLadder) cannedLine() string {
+	lines := l.cfg.CannedLines
+	if len(lines) == 0 {
+		lines = defaultCannedLines
+	}
+	return lines[rng.Intn(len(lines))]
+}
+
+// DegradationStatus is the admin view of the ladder.
+type DegradationStatus struct {
+	Level     string    `json:"level"`
+	Reason    string    `json:"reason,omitempty"`
+	ChangedAt time.Time `json:"changedAt"`
+	Samples   int       `json:"samples"`
+	ErrorRate float64   `json:"errorRate"`
+}
+
+func (l *degradationLadder) status() DegradationStatus {
+	level := l.current()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	failed := 0
+	for _, o := range l.outcomes {
+		if o.failed {
+			failed++
+		}
+	}
+	s := DegradationStatus{Level: level.String(), Reason: l.reason, ChangedAt: l.changedAt, Samples: len(l.outcomes)}
+	if len(l.outcomes) > 0 {
+		s.ErrorRate = float64(failed) / float64(len(l.outcomes))
+	}
+	return s
+}
+
+// flushAlerts writes pending alerts so moderators can step in.
+func (l *degradationLadder) flushAlerts(ctx context.Context, client *firestore.Client, alertCollection string) error {
+	l.mu.Lock()
+	alerts := l.alerts
+	l.alerts = nil
+	l.mu.Unlock()
+
+	for _, alert := range alerts {
+		if _, err := client.Collection(alertCollection).Doc(newID("alert")).Set(ctx, alert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDegradationLadderWalk(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	cfg := DegradationConfig{
+		Window:         Duration{2 * time.Minute},
+		MaxErrorRate:   0.5,
+		MaxLatency:     Duration{8 * time.Second},
+		RecoverAfter:   Duration{2 * time.Minute},
+		MaxCacheMisses: 3,
+		SilenceAfter:   Duration{10 * time.Minute},
+	}
+	l := newDegradationLadder(cfg)
+	boom := errors.New("boom")
+
+	steps := []struct {
+		name string
+		do   func()
+		want degradationLevel
+	}{
+		{"healthy", func() { l.record(nil, time.Second) }, levelFullAI},
+		{"error rate", func() {
+			for i := 0; i < 3; i++ {
+				l.record(boom, time.Second)
+			}
+		}, levelCheapModel},
+		{"quota", func() { l.record(status.Error(codes.ResourceExhausted, "quota"), 0) }, levelCached},
+		{"cache hits reset misses", func() {
+			l.cacheMiss()
+			l.cacheMiss()
+			l.cacheHit()
+			l.cacheMiss()
+		}, levelCached},
+		{"cache misses", func() {
+			l.cacheMiss()
+			l.cacheMiss()
+		}, levelCanned},
+		{"sustained outage", func() { vc.Advance(10 * time.Minute) }, levelSilent},
+		{"recover to canned", func() { vc.Advance(2 * time.Minute) }, levelCanned},
+		{"recover to cached", func() { vc.Advance(2 * time.Minute) }, levelCached},
+		{"recover to cheap model", func() { vc.Advance(2 * time.Minute) }, levelCheapModel},
+		{"cheap model works", func() { l.record(nil, time.Second) }, levelCheapModel},
+		{"recover to full", func() { vc.Advance(2 * time.Minute) }, levelFullAI},
+	}
+	for _, s := range steps {
+		s.do()
+		if got := l.current(); got != s.want {
+			t.Fatalf("%s: level = %s, want %s", s.name, got, s.want)
+		}
+	}
+
+	if len(l.alerts) != 1 || l.alerts[0].Level != levelSilent.String() {
+		t.Errorf("alerts = %+v, want one silent alert", l.alerts)
+	}
+}
+
+func TestDegradationSuccessEndsOutage(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	l := newDegradationLadder(DegradationConfig{
+		Window:         Duration{2 * time.Minute},
+		MaxErrorRate:   0.5,
+		MaxLatency:     Duration{8 * time.Second},
+		RecoverAfter:   Duration{2 * time.Minute},
+		MaxCacheMisses: 1,
+		SilenceAfter:   Duration{5 * time.Minute},
+	})
+	quota := status.Error(codes.ResourceExhausted, "quota")
+	l.record(quota, 0)
+	l.record(quota, 0)
+	vc.Advance(2 * time.Minute)
+	if got := l.current(); got != levelCheapModel {
+		t.Fatalf("level = %s, want %s", got, levelCheapModel)
+	}
+	l.record(nil, time.Second)
+	l.record(quota, 0)
+	l.cacheMiss()
+	// Six minutes since the first failure, but only four since the last
+	// success: the outage clock restarted and the host must not go silent.
+	vc.Advance(4 * time.Minute)
+	if got := l.current(); got == levelSilent {
+		t.Fatalf("level = %s four minutes after a successful call", got)
+	}
+}
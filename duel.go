@@ -0,0 +1,513 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	duelQuestions        = 5
+	duelAnswerTime       = 20 * time.Second
+	duelTieBreakDuration = 60 * time.Second
+	// duelSpeedBonus goes to the faster of two right answers.
+	duelSpeedBonus = 5
+)
+
+// duel is a head-to-head duel between two volunteers picked by the admin:
+// Questions rapid-fire questions, each open to their answers for
+// AnswerTime, narrated play by play. Players holds their stored IDs and
+// Names what the host calls them, in the same order. A duel that ends
+// level goes to the audience in a poll.
+type duel struct {
+	ID         string    `json:"id"`
+	Players    []string  `json:"players"`
+	Names      []string  `json:"names"`
+	Questions  int       `json:"questions"`
+	AnswerTime Duration  `json:"answerTime"`
+	StartedAt  time.Time `json:"startedAt"`
+	// Announced is set once the host has introduced the duel, and Round
+	// counts the questions asked.
+	Announced bool           `json:"announced"`
+	Round     int            `json:"round"`
+	Question  *duelQuestion  `json:"question,omitempty"`
+	Scores    map[string]int `json:"scores"`
+	// AnswerMillis adds up the time each player took over their right
+	// answers; the faster player wins a duel the audience poll can't
+	// settle.
+	AnswerMillis map[string]int64 `json:"answerMillis"`
+	Plays        []duelPlay       `json:"plays"`
+	TieBreakPoll string           `json:"tieBreakPoll,omitempty"`
+	Winner       string           `json:"winner,omitempty"`
+}
+
+// duelQuestion is the question being played and the answers in so far.
+type duelQuestion struct {
+	generatedQuestion
+	AskedAt time.Time             `json:"askedAt"`
+	Answers map[string]duelAnswer `json:"answers"`
+}
+
+// duelAnswer is a duellist's answer and how long after the question it came.
+type duelAnswer struct {
+	Option string `json:"option"`
+	Millis int64  `json:"ms"`
+}
+
+// duelPlay is how one question of a duel went.
+type duelPlay struct {
+	Round    int                   `json:"round"`
+	Question string                `json:"question"`
+	Correct  string                `json:"correct"`
+	Answers  map[string]duelAnswer `json:"answers"`
+	Points   map[string]int        `json:"points"`
+}
+
+func (d *duel) clone() *duel {
+	c := *d
+	c.Players, c.Names = slices.Clone(d.Players), slices.Clone(d.Names)
+	c.Scores, c.AnswerMillis = maps.Clone(d.Scores), maps.Clone(d.AnswerMillis)
+	c.Plays = slices.Clone(d.Plays)
+	if d.Question != nil {
+		q := *d.Question
+		q.Answers = maps.Clone(q.Answers)
+		c.Question = &q
+	}
+	return &c
+}
+
+// name is what the host calls player.
+func (d *duel) name(player string) string {
+	return d.Names[slices.Index(d.Players, player)]
+}
+
+// closesAt is when the question being played stops taking answers.
+func (d *duel) closesAt() time.Time {
+	return d.Question.AskedAt.Add(d.AnswerTime.Duration)
+}
+
+// duelState holds the current duel, nil if none. The monitor drives it
+// while the listener's workers record the duellists' answers, so it is
+// guarded by a mutex.
+type duelState struct {
+	mu  sync.Mutex
+	cur *duel
+}
+
+// snapshot returns a copy of the current duel, or nil.
+func (s *duelState) snapshot() *duel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur == nil {
+		return nil
+	}
+	return s.cur.clone()
+}
+
+// update applies fn to the current duel if it is still duel id.
+func (s *duelState) update(id string, fn func(d *duel)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur != nil && s.cur.ID == id {
+		fn(s.cur)
+	}
+}
+
+var errDuelRunning = errors.New("a duel is already running")
+
+// startDuel starts a duel of questions questions between the two players,
+// given by their user IDs; the monitor introduces it on its next tick.
+func (b *Bot) startDuel(ctx context.Context, players []string, questions int, answerTime time.Duration) (*duel, error) {
+	ids := make([]string, len(players))
+	for i, player := range players {
+		id, err := b.pseudonyms.anonymize(ctx, b.client, b.cfg.Collections.Pseudonyms, player)
+		if err != nil {
+			return nil, fmt.Errorf("error anonymizing user: %w", err)
+		}
+		ids[i] = id
+	}
+	d := &duel{
+		ID:           newID("duel"),
+		Players:      ids,
+		Names:        b.displayNames(ctx, ids),
+		Questions:    questions,
+		AnswerTime:   Duration{answerTime},
+		StartedAt:    clock.Now(),
+		Scores:       map[string]int{ids[0]: 0, ids[1]: 0},
+		AnswerMillis: map[string]int64{},
+		Plays:        []duelPlay{},
+	}
+
+	b.duel.mu.Lock()
+	defer b.duel.mu.Unlock()
+	if cur := b.duel.cur; cur != nil && cur.Winner == "" {
+		return nil, errDuelRunning
+	}
+	b.duel.cur = d
+	b.bus.Publish(Event{Kind: EventStateChanged, State: "duel", To: d.ID})
+	return d.clone(), nil
+}
+
+// stopDuel calls off the running duel. It reports false if none was
+// running.
+func (b *Bot) stopDuel() bool {
+	b.duel.mu.Lock()
+	defer b.duel.mu.Unlock()
+	cur := b.duel.cur
+	if cur == nil || cur.Winner != "" {
+		return false
+	}
+	b.duel.cur = nil
+	b.bus.Publish(Event{Kind: EventStateChanged, State: "duel", From: cur.ID})
+	return true
+}
+
+// parseDuelAnswer returns the option of options text picks, such as "b"
+// or "B.", or "" if it isn't an answer.
+func parseDuelAnswer(text string, options map[string]string) string {
+	key := strings.ToUpper(strings.TrimRight(strings.TrimSpace(text), ".)!"))
+	if _, ok := options[key]; !ok {
+		return ""
+	}
+	return key
+}
+
+// recordDuelAnswer records msg as its sender's answer to the duel
+// question being played, timed from when the host asked it. Only the
+// first answer counts, and one after the question closed is ignored. It
+// reports whether msg was a duel move, which gets no reply of its own.
+func (b *Bot) recordDuelAnswer(msg *Message) bool {
+	b.duel.mu.Lock()
+	defer b.duel.mu.Unlock()
+	d := b.duel.cur
+	if d == nil || d.Question == nil || !slices.Contains(d.Players, msg.UserID) {
+		return false
+	}
+	key := parseDuelAnswer(msg.Message, d.Question.Options)
+	if key == "" {
+		return false
+	}
+	at := msg.Timestamp
+	if at.IsZero() {
+		at = clock.Now()
+	}
+	if _, answered := d.Question.Answers[msg.UserID]; answered || at.After(d.closesAt()) {
+		return true
+	}
+	d.Question.Answers[msg.UserID] = duelAnswer{Option: key, Millis: max(at.Sub(d.Question.AskedAt).Milliseconds(), 0)}
+	return true
+}
+
+// scoreDuelQuestion scores the question of d: a right answer is worth
+// pointsPerCorrectAnswer, and duelSpeedBonus more if it beat the other
+// player's right answer.
+func scoreDuelQuestion(d *duel) duelPlay {
+	q := d.Question
+	play := duelPlay{Round: d.Round, Question: q.Question, Correct: q.Correct, Answers: q.Answers, Points: map[string]int{}}
+	var right []string
+	for _, player := range d.Players {
+		if a, ok := q.Answers[player]; ok && a.Option == q.Correct {
+			play.Points[player] = pointsPerCorrectAnswer
+			right = append(right, player)
+		}
+	}
+	if len(right) == 2 && q.Answers[right[0]].Millis != q.Answers[right[1]].Millis {
+		faster := right[0]
+		if q.Answers[right[1]].Millis < q.Answers[faster].Millis {
+			faster = right[1]
+		}
+		play.Points[faster] += duelSpeedBonus
+	}
+	return play
+}
+
+// duelPlayText narrates how play went and the score after it.
+func duelPlayText(d *duel, play duelPlay) string {
+	lines := []string{fmt.Sprintf("Duel question %d of %d: %q. The right answer is %s - %s.", play.Round, d.Questions, play.Question, play.Correct, d.Question.Options[play.Correct])}
+	var score []string
+	for _, player := range d.Players {
+		name := d.name(player)
+		a, ok := play.Answers[player]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("%s didn't answer in time.", name))
+		case a.Option == play.Correct:
+			lines = append(lines, fmt.Sprintf("%s answered %s in %.1f seconds: right, %d points.", name, a.Option, float64(a.Millis)/1000, play.Points[player]))
+		default:
+			lines = append(lines, fmt.Sprintf("%s answered %s in %.1f seconds: wrong.", name, a.Option, float64(a.Millis)/1000))
+		}
+		score = append(score, fmt.Sprintf("%s %d", name, d.Scores[player]+play.Points[player]))
+	}
+	return strings.Join(append(lines, "Score: "+strings.Join(score, ", ")+"."), "\n")
+}
+
+// duelLeader is the player ahead in d, or "" if they are level.
+func duelLeader(d *duel) string {
+	a, b := d.Players[0], d.Players[1]
+	switch {
+	case d.Scores[a] > d.Scores[b]:
+		return a
+	case d.Scores[b] > d.Scores[a]:
+		return b
+	}
+	return ""
+}
+
+// duelAnnouncements returns what the running duel needs announced next:
+// its introduction, the next question, the play-by-play of a question
+// once both players have answered or its time is up, the audience
+// tie-breaker and the winner. Each Done moves the duel on, so nothing is
+// announced twice. Only the monitor calls it.
+func (b *Bot) duelAnnouncements(ctx context.Context) []hostAnnouncement {
+	d := b.duel.snapshot()
+	if d == nil || d.Winner != "" {
+		return nil
+	}
+	var a *hostAnnouncement
+	var err error
+	switch {
+	case !d.Announced:
+		a = b.duelIntro(d)
+	case d.Question != nil:
+		a = b.duelPlayByPlay(d)
+	case d.Round < d.Questions:
+		a, err = b.duelNextQuestion(ctx, d)
+	case d.TieBreakPoll == "":
+		a, err = b.duelFinish(ctx, d)
+	default:
+		a, err = b.duelTieBreakResult(ctx, d)
+	}
+	if err != nil {
+		slog.Error("error running the duel", "duel", d.ID, "err", err)
+		return nil
+	}
+	if a == nil {
+		return nil
+	}
+	return []hostAnnouncement{*a}
+}
+
+func (b *Bot) duelIntro(d *duel) *hostAnnouncement {
+	return &hostAnnouncement{
+		Kind: "duel-start",
+		Text: fmt.Sprintf("Head-to-head duel! %s takes on %s over %d rapid-fire questions, %d seconds each. Duellists, answer with the letter of your option; the first answer is final. A right answer scores %d points, and the faster of two right answers %d more.",
+			d.Names[0], d.Names[1], d.Questions, int(d.AnswerTime.Seconds()), pointsPerCorrectAnswer, duelSpeedBonus),
+		Done: func(ctx context.Context) error {
+			b.duel.update(d.ID, func(d *duel) { d.Announced = true })
+			return nil
+		},
+	}
+}
+
+// duelNextQuestion has the model write the next question. The clock on it
+// starts once the host has asked it.
+func (b *Bot) duelNextQuestion(ctx context.Context, d *duel) (*hostAnnouncement, error) {
+	q, err := generateQuizQuestion(ctx, b.ladderModel(), "It is a rapid-fire head-to-head duel, so keep the question and its options short.")
+	if err != nil {
+		return nil, fmt.Errorf("error generating duel question: %w", err)
+	}
+	poll := q.toPoll()
+	keys := make([]string, 0, len(q.Options))
+	for key := range q.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return &hostAnnouncement{
+		Kind: "duel-question",
+		Text: fmt.Sprintf("Duel question %d of %d for %s and %s, %d seconds on the clock: %s\n%s",
+			d.Round+1, d.Questions, d.Names[0], d.Names[1], int(d.AnswerTime.Seconds()), q.Question, optionList(poll, keys)),
+		Done: func(ctx context.Context) error {
+			b.duel.update(d.ID, func(d *duel) {
+				d.Round++
+				d.Question = &duelQuestion{generatedQuestion: *q, AskedAt: clock.Now(), Answers: map[string]duelAnswer{}}
+			})
+			return nil
+		},
+	}, nil
+}
+
+// duelPlayByPlay scores the question being played once both players have
+// answered or its time is up.
+func (b *Bot) duelPlayByPlay(d *duel) *hostAnnouncement {
+	if len(d.Question.Answers) < len(d.Players) && clock.Now().Before(d.closesAt()) {
+		return nil
+	}
+	play := scoreDuelQuestion(d)
+	return &hostAnnouncement{
+		Kind: "duel-play",
+		Text: duelPlayText(d, play),
+		Done: func(ctx context.Context) error {
+			b.duel.update(d.ID, func(d *duel) {
+				for player, points := range play.Points {
+					d.Scores[player] += points
+					d.AnswerMillis[player] += play.Answers[player].Millis
+				}
+				d.Plays = append(d.Plays, play)
+				d.Question = nil
+			})
+			return nil
+		},
+	}
+}
+
+// duelFinish declares the leader the winner after the last question, or,
+// if the players are level, makes a poll for the audience to break the
+// tie the active poll.
+func (b *Bot) duelFinish(ctx context.Context, d *duel) (*hostAnnouncement, error) {
+	if leader := duelLeader(d); leader != "" {
+		return b.duelWinner(d, leader, ""), nil
+	}
+	id := d.ID + "-tiebreak"
+	closesAt := clock.Now().Add(duelTieBreakDuration)
+	poll := PollQuestion{
+		Question: fmt.Sprintf("%s and %s are level on %d points. Who should win the duel?", d.Names[0], d.Names[1], d.Scores[d.Players[0]]),
+		Options: map[string]PollOption{
+			"A": {Label: "A", OpText: d.Names[0], Voters: []string{}},
+			"B": {Label: "B", OpText: d.Names[1], Voters: []string{}},
+		},
+		ClosesAt: closesAt,
+		// The host announces the outcome as the duel's winner instead.
+		ResultsAnnounced: true,
+	}
+	if err := b.polls.SavePoll(ctx, id, poll); err != nil {
+		return nil, fmt.Errorf("error writing duel tie-breaker poll: %w", err)
+	}
+	return &hostAnnouncement{
+		Kind: "duel-tiebreak",
+		Text: fmt.Sprintf("After %d questions %s and %s are level on %d points! The audience decides: vote for your winner in the poll, %d seconds on the clock.",
+			d.Questions, d.Names[0], d.Names[1], d.Scores[d.Players[0]], int(duelTieBreakDuration.Seconds())),
+		Done: func(ctx context.Context) error {
+			b.duel.update(d.ID, func(d *duel) { d.TieBreakPoll = id })
+			b.switchPoll(id)
+			return nil
+		},
+	}, nil
+}
+
+// duelTieBreakResult declares the audience's pick the winner once the
+// tie-breaker poll has closed. If the vote is level too, the player who
+// answered right faster overall wins, and failing that the first named.
+func (b *Bot) duelTieBreakResult(ctx context.Context, d *duel) (*hostAnnouncement, error) {
+	tally, err := b.tallyPollDoc(ctx, d.TieBreakPoll)
+	if err != nil {
+		return nil, fmt.Errorf("error tallying duel tie-breaker poll: %w", err)
+	}
+	if closed, _ := pollClosed(tally.Poll, clock.Now()); !closed {
+		return nil, nil
+	}
+	votes := []int{len(tally.Poll.Options["A"].Voters), len(tally.Poll.Options["B"].Voters)}
+	first, second := d.Players[0], d.Players[1]
+	switch {
+	case votes[0] > votes[1]:
+		return b.duelWinner(d, first, fmt.Sprintf("The audience picked %s, %d votes to %d.", d.Names[0], votes[0], votes[1])), nil
+	case votes[1] > votes[0]:
+		return b.duelWinner(d, second, fmt.Sprintf("The audience picked %s, %d votes to %d.", d.Names[1], votes[1], votes[0])), nil
+	}
+	winner := first
+	if d.AnswerMillis[second] < d.AnswerMillis[first] {
+		winner = second
+	}
+	return b.duelWinner(d, winner, fmt.Sprintf("The audience was split too, %d votes each, so %s takes it for answering faster.", votes[0], d.name(winner))), nil
+}
+
+func (b *Bot) duelWinner(d *duel, winner, decided string) *hostAnnouncement {
+	loser := d.Players[0]
+	if loser == winner {
+		loser = d.Players[1]
+	}
+	text := fmt.Sprintf("%s wins the duel against %s, %d points to %d!", d.name(winner), d.name(loser), d.Scores[winner], d.Scores[loser])
+	if decided != "" {
+		text += " " + decided
+	}
+	return &hostAnnouncement{
+		Kind: "duel-winner",
+		Text: text,
+		Done: func(ctx context.Context) error {
+			b.duel.update(d.ID, func(d *duel) { d.Winner = winner })
+			b.bus.Publish(Event{Kind: EventStateChanged, State: "duel", From: d.ID})
+			return nil
+		},
+	}
+}
+
+// duelBoard is the running or last duel as shown to the audience: names
+// and scores, without user IDs or the right answer.
+func duelBoard(d *duel) map[string]any {
+	players := make([]map[string]any, len(d.Players))
+	for i, player := range d.Players {
+		players[i] = map[string]any{"name": d.Names[i], "score": d.Scores[player]}
+	}
+	board := map[string]any{"id": d.ID, "players": players, "round": d.Round, "questions": d.Questions}
+	if q := d.Question; q != nil {
+		answered := make([]string, 0, len(q.Answers))
+		for player := range q.Answers {
+			answered = append(answered, d.name(player))
+		}
+		sort.Strings(answered)
+		board["question"] = map[string]any{"question": q.Question, "options": q.Options, "closesAt": d.closesAt(), "answered": answered}
+	}
+	if d.TieBreakPoll != "" {
+		board["tieBreakPoll"] = d.TieBreakPoll
+	}
+	if d.Winner != "" {
+		board["winner"] = d.name(d.Winner)
+	}
+	return board
+}
+
+func registerDuelRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/duel", func(w http.ResponseWriter, r *http.Request) {
+		d := b.duel.snapshot()
+		writeJSON(w, http.StatusOK, map[string]any{"running": d != nil && d.Winner == "", "duel": d})
+	})
+
+	// Players are the user IDs of the two volunteers.
+	mux.HandleFunc("POST /admin/duel", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Players    []string `json:"players"`
+			Questions  int      `json:"questions"`
+			AnswerTime Duration `json:"answerTime"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(body.Players) != 2 || body.Players[0] == "" || body.Players[1] == "" || body.Players[0] == body.Players[1] {
+			writeError(w, http.StatusBadRequest, errors.New("players must be two different user IDs"))
+			return
+		}
+		if body.Questions <= 0 {
+			body.Questions = duelQuestions
+		}
+		if body.AnswerTime.Duration <= 0 {
+			body.AnswerTime.Duration = duelAnswerTime
+		}
+		d, err := b.startDuel(r.Context(), body.Players, body.Questions, body.AnswerTime.Duration)
+		if errors.Is(err, errDuelRunning) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, d)
+	})
+
+	mux.HandleFunc("DELETE /admin/duel", func(w http.ResponseWriter, r *http.Request) {
+		if !b.stopDuel() {
+			writeError(w, http.StatusNotFound, errors.New("no duel is running"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
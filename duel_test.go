@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDuelBot returns a test bot whose model writes duel questions with B
+// as the right answer, and a duel between Ann and Bob of questions
+// questions, 20 seconds each.
+func newDuelBot(t *testing.T, questions int) (*Bot, *memoryStore) {
+	t.Helper()
+	store := newMemoryStore()
+	store.SetProfile("ann", Profile{DisplayName: "Ann"})
+	store.SetProfile("bob", Profile{DisplayName: "Bob"})
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return `{"question": "Capital of France?", "options": {"A": "Lyon", "B": "Paris", "C": "Nice", "D": "Lille"}, "correct": "B"}`, nil
+	}))
+	if _, err := b.startDuel(context.Background(), []string{"ann", "bob"}, questions, 20*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	return b, store
+}
+
+// nextDuelStep returns the duel's next announcement, which must be of
+// kind, and records it as made.
+func nextDuelStep(t *testing.T, b *Bot, kind string) string {
+	t.Helper()
+	got := b.duelAnnouncements(context.Background())
+	if len(got) != 1 || got[0].Kind != kind {
+		t.Fatalf("announcements = %+v, want %s", got, kind)
+	}
+	if err := got[0].Done(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return got[0].Text
+}
+
+func TestDuel(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	b, _ := newDuelBot(t, 2)
+	if _, err := b.startDuel(context.Background(), []string{"cat", "dan"}, 2, time.Second); !errors.Is(err, errDuelRunning) {
+		t.Fatalf("second startDuel = %v, want %v", err, errDuelRunning)
+	}
+	nextDuelStep(t, b, "duel-start")
+	if text := nextDuelStep(t, b, "duel-question"); !strings.Contains(text, "Duel question 1 of 2") || !strings.Contains(text, "B - Paris") {
+		t.Errorf("question = %q", text)
+	}
+	if got := b.duelAnnouncements(context.Background()); len(got) != 0 {
+		t.Fatalf("announcements before anyone answered = %+v", got)
+	}
+
+	vc.Advance(2 * time.Second)
+	answer := func(user, text string) bool {
+		return b.recordDuelAnswer(&Message{UserID: user, Message: text, Timestamp: clock.Now()})
+	}
+	if !answer("ann", "b") {
+		t.Fatal("ann's answer was not taken")
+	}
+	vc.Advance(1500 * time.Millisecond)
+	if answer("cat", "B") {
+		t.Error("an answer from the audience was taken as a duel move")
+	}
+	if answer("bob", "What a question!") {
+		t.Error("a chat message from a duellist was taken as an answer")
+	}
+	answer("bob", "B.")
+	answer("bob", "C")
+	text := nextDuelStep(t, b, "duel-play")
+	for _, want := range []string{"Ann answered B in 2.0 seconds: right, 15 points", "Bob answered B in 3.5 seconds: right, 10 points", "Score: Ann 15, Bob 10."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("play-by-play = %q, want %q", text, want)
+		}
+	}
+
+	nextDuelStep(t, b, "duel-question")
+	vc.Advance(21 * time.Second)
+	answer("bob", "B")
+	if d := b.duel.snapshot(); len(d.Question.Answers) != 0 {
+		t.Error("an answer after the clock ran out was recorded")
+	}
+	if text := nextDuelStep(t, b, "duel-play"); !strings.Contains(text, "Ann didn't answer in time") {
+		t.Errorf("play-by-play = %q, want Ann out of time", text)
+	}
+	if text := nextDuelStep(t, b, "duel-winner"); text != "Ann wins the duel against Bob, 15 points to 10!" {
+		t.Errorf("winner = %q", text)
+	}
+	if got := b.duelAnnouncements(context.Background()); len(got) != 0 {
+		t.Errorf("announcements after the winner = %+v", got)
+	}
+	if _, err := b.startDuel(context.Background(), []string{"cat", "dan"}, 2, time.Second); err != nil {
+		t.Errorf("startDuel after the last duel ended = %v", err)
+	}
+}
+
+func TestDuelAudienceTieBreaker(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+	ctx := context.Background()
+
+	b, store := newDuelBot(t, 1)
+	nextDuelStep(t, b, "duel-start")
+	nextDuelStep(t, b, "duel-question")
+	vc.Advance(time.Second)
+	b.recordDuelAnswer(&Message{UserID: "ann", Message: "A"})
+	b.recordDuelAnswer(&Message{UserID: "bob", Message: "C"})
+	nextDuelStep(t, b, "duel-play")
+	if text := nextDuelStep(t, b, "duel-tiebreak"); !strings.Contains(text, "level on 0 points") {
+		t.Errorf("tie-breaker = %q", text)
+	}
+
+	d := b.duel.snapshot()
+	if b.activePollID() != d.TieBreakPoll {
+		t.Fatalf("active poll = %q, want the tie-breaker %q", b.activePollID(), d.TieBreakPoll)
+	}
+	poll, err := store.Poll(ctx, d.TieBreakPoll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll.Options["A"].OpText != "Ann" || poll.Options["B"].OpText != "Bob" || !poll.ResultsAnnounced {
+		t.Errorf("tie-breaker poll = %+v", poll)
+	}
+	poll.Options["B"] = PollOption{Label: "B", OpText: "Bob", Voters: []string{"cat", "dan"}}
+	store.SetPoll(d.TieBreakPoll, *poll)
+	if got := b.duelAnnouncements(ctx); len(got) != 0 {
+		t.Fatalf("announcements while the audience votes = %+v", got)
+	}
+
+	vc.Advance(duelTieBreakDuration)
+	if text := nextDuelStep(t, b, "duel-winner"); !strings.Contains(text, "Bob wins the duel") || !strings.Contains(text, "The audience picked Bob, 2 votes to 0.") {
+		t.Errorf("winner = %q", text)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+)
+
+// EligibilityRules restrict who may vote on a poll. Every rule that is set
+// must hold; votes from anyone else are kept on record but not counted.
+type EligibilityRules struct {
+	// CorrectOn is the ID of an earlier quiz question; only voters who
+	// answered it correctly are eligible.
+	CorrectOn string `firestore:"correctOn,omitempty"`
+	// CheckedIn limits voting to attendees present in the check-in collection,
+	// matched through the voter's profile.
+	CheckedIn bool `firestore:"checkedIn,omitempty"`
+}
+
+// IneligibleVote is recorded on the poll document for every excluded vote.
+type IneligibleVote struct {
+	Option string `firestore:"option"`
+	Reason string `firestore:"reason"`
+}
+
+// PollTally is a poll with only eligible voters left on each option.
+type PollTally struct {
+	// ID is the poll document's ID.
+	ID         string
+	Poll       PollQuestion
+	Ineligible map[string]IneligibleVote
+}
+
+// EligibilityReader reads what eligibility rules are checked against: the
+// earlier poll of a correctOn rule, and the profiles and check-ins of a
+// checkedIn rule.
+type EligibilityReader interface {
+	// EarlierPoll returns poll id, or nil if there is no such poll.
+	EarlierPoll(ctx context.Context, id string) (*PollQuestion, error)
+	// Profiles returns the profile of each user ID, nil where there is
+	// none.
+	Profiles(ctx context.Context, ids []string) ([]*Profile, error)
+	// Checkins reports, for each of keys, whether a check-in is stored
+	// under it.
+	Checkins(ctx context.Context, keys []string) ([]bool, error)
+}
+
+// docsGetter reads several documents at once, either directly through the
+// client or inside a transaction.
+type docsGetter func(refs []*firestore.DocumentRef) ([]*firestore.DocumentSnapshot, error)
+
+// firestoreEligibility reads eligibility from Firestore through getAll, so
+// a tally inside a transaction reads everything at the transaction's
+// snapshot. getAll carries its own context; nil reads directly through the
+// client with the context of each call.
+type firestoreEligibility struct {
+	client *firestore.Client
+	getAll docsGetter
+	cols   Collections
+}
+
+func newFirestoreEligibility(client *firestore.Client, getAll docsGetter, cols Collections) *firestoreEligibility {
+	return &firestoreEligibility{client: client, getAll: getAll, cols: cols}
+}
+
+func (e *firestoreEligibility) get(ctx context.Context, col string, ids []string) ([]*firestore.DocumentSnapshot, error) {
+	refs := make([]*firestore.DocumentRef, len(ids))
+	for i, id := range ids {
+		refs[i] = e.client.Collection(col).Doc(id)
+	}
+	if e.getAll == nil {
+		return e.client.GetAll(ctx, refs)
+	}
+	return e.getAll(refs)
+}
+
+func (e *firestoreEligibility) EarlierPoll(ctx context.Context, id string) (*PollQuestion, error) {
+	snaps, err := e.get(ctx, e.cols.Poll, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching poll %s: %w", id, err)
+	}
+	if !snaps[0].Exists() {
+		return nil, nil
+	}
+	var poll PollQuestion
+	if err := snaps[0].DataTo(&poll); err != nil {
+		return nil, fmt.Errorf("error converting document to PollQuestion: %w", err)
+	}
+	return &poll, nil
+}
+
+func (e *firestoreEligibility) Profiles(ctx context.Context, ids []string) ([]*Profile, error) {
+	snaps, err := e.get(ctx, e.cols.Profiles, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching profiles: %w", err)
+	}
+	profiles := make([]*Profile, len(snaps))
+	for i, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		var p Profile
+		if err := snap.DataTo(&p); err != nil {
+			return nil, fmt.Errorf("error converting document to Profile: %w", err)
+		}
+		profiles[i] = &p
+	}
+	return profiles, nil
+}
+
+func (e *firestoreEligibility) Checkins(ctx context.Context, keys []string) ([]bool, error) {
+	snaps, err := e.get(ctx, e.cols.Checkins, keys)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching check-ins: %w", err)
+	}
+	found := make([]bool, len(snaps))
+	for i, snap := range snaps {
+		found[i] = snap.Exists()
+	}
+	return found, nil
+}
+
+// idMapper maps a raw user ID to the identifier stored for it, a pseudonym in
+// anonymous mode.
+type idMapper func(userID string) (string, error)
+
+// tallyPoll applies the poll's allowed-voter list and eligibility rules,
+// reading what the rules need through r. Votes arrive under raw user IDs,
+// which the rules are checked against; the tally itself, and so everything
+// derived from it, carries the IDs anon maps them to.
+func tallyPoll(ctx context.Context, r EligibilityReader, anon idMapper, poll PollQuestion) (*PollTally, error) {
+	voters := map[string]string{}
+	for key, opt := range poll.Options {
+		for _, voter := range opt.Voters {
+			voters[voter] = key
+		}
+	}
+	for voter := range poll.Answers {
+		voters[voter] = pollAnswerKey
+	}
+	for voter := range poll.TextAnswers {
+		voters[voter] = pollAnswerKey
+	}
+
+	mapped := map[string]string{}
+	for voter := range voters {
+		id, err := anon(voter)
+		if err != nil {
+			return nil, err
+		}
+		mapped[voter] = id
+	}
+	// Wagers aren't votes, and no rule applies to them.
+	wagers, err := anonymizeWagers(poll.Wagers, anon)
+	if err != nil {
+		return nil, err
+	}
+	// Nor are buzzes.
+	var buzzes map[string]Buzz
+	if poll.Buzzes != nil {
+		buzzes = map[string]Buzz{}
+		for user, b := range poll.Buzzes {
+			id, err := anon(user)
+			if err != nil {
+				return nil, err
+			}
+			buzzes[id] = b
+		}
+	}
+	owner := poll.BuzzOwner
+	if owner != "" {
+		var err error
+		if owner, err = anon(owner); err != nil {
+			return nil, err
+		}
+	}
+
+	reasons := map[string]string{}
+	for voter, v := range poll.Answers {
+		if !poll.inRange(v) {
+			reasons[voter] = "answer out of range"
+		}
+	}
+	if poll.AllowedVoters != nil {
+		// Tie-breakers restrict voting to players by their stored IDs.
+		for voter := range voters {
+			if !slices.Contains(poll.AllowedVoters, voter) && !slices.Contains(poll.AllowedVoters, mapped[voter]) {
+				reasons[voter] = "not an allowed voter"
+			}
+		}
+	}
+
+	if rules := poll.Eligibility; rules != nil {
+		if rules.CorrectOn != "" {
+			previous, err := r.EarlierPoll(ctx, rules.CorrectOn)
+			if err != nil {
+				return nil, err
+			}
+			// A rule pointing at a poll that does not exist cannot be
+			// checked; it is ignored rather than excluding every voter.
+			if previous != nil {
+				correct := previous.Options[previous.Correct].Voters
+				if previous.numeric() {
+					correct = previous.exactGuessers()
+				}
+				for voter := range voters {
+					if _, ok := reasons[voter]; !ok && !slices.Contains(correct, voter) {
+						reasons[voter] = "did not answer " + rules.CorrectOn + " correctly"
+					}
+				}
+			} else {
+				slog.Warn("eligibility rule correctOn refers to a missing poll, ignoring it", "poll", rules.CorrectOn)
+			}
+		}
+
+		if rules.CheckedIn {
+			ids := make([]string, 0, len(voters))
+			for voter := range voters {
+				ids = append(ids, voter)
+			}
+			sort.Strings(ids)
+			present, err := checkedInUsers(ctx, r, ids)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range ids {
+				if _, ok := reasons[id]; !ok && !present[id] {
+					reasons[id] = "not checked in"
+				}
+			}
+		}
+	}
+
+	tally := &PollTally{Poll: poll, Ineligible: map[string]IneligibleVote{}}
+	tally.Poll.Wagers = wagers
+	tally.Poll.Buzzes, tally.Poll.BuzzOwner = buzzes, owner
+	tally.Poll.Options = map[string]PollOption{}
+	for key, opt := range poll.Options {
+		eligible := []string{}
+		for _, voter := range opt.Voters {
+			if reason, ok := reasons[voter]; ok {
+				tally.Ineligible[mapped[voter]] = IneligibleVote{Option: key, Reason: reason}
+				continue
+			}
+			eligible = append(eligible, mapped[voter])
+		}
+		opt.Voters = eligible
+		tally.Poll.Options[key] = opt
+	}
+	if poll.Answers != nil {
+		tally.Poll.Answers = map[string]float64{}
+		for voter, v := range poll.Answers {
+			if reason, ok := reasons[voter]; ok {
+				tally.Ineligible[mapped[voter]] = IneligibleVote{Option: pollAnswerKey, Reason: reason}
+				continue
+			}
+			tally.Poll.Answers[mapped[voter]] = v
+		}
+	}
+	if poll.TextAnswers != nil {
+		tally.Poll.TextAnswers = map[string]string{}
+		for voter, text := range poll.TextAnswers {
+			if reason, ok := reasons[voter]; ok {
+				tally.Ineligible[mapped[voter]] = IneligibleVote{Option: pollAnswerKey, Reason: reason}
+				continue
+			}
+			tally.Poll.TextAnswers[mapped[voter]] = text
+		}
+	}
+	return tally, nil
+}
+
+// ineligibleUpdate records the excluded votes on the poll document.
+func (t *PollTally) ineligibleUpdate() []firestore.Update {
+	return []firestore.Update{{Path: "ineligibleVotes", Value: t.Ineligible}}
+}
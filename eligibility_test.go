@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTallyPollAllowedVoters(t *testing.T) {
+	poll := PollQuestion{
+		Question: "Tie-breaker",
+		Options: map[string]PollOption{
+			"A": {Label: "A", Voters: []string{"ann", "eve"}},
+			"B": {Label: "B", Voters: []string{"bob"}},
+		},
+	}
+	identity := func(id string) (string, error) { return id, nil }
+	masked := func(id string) (string, error) { return "anon-" + strings.Repeat(id[:1], 12), nil }
+
+	tests := []struct {
+		name           string
+		allowed        []string
+		anon           idMapper
+		wantVoters     map[string][]string
+		wantIneligible map[string]IneligibleVote
+	}{
+		{
+			name:           "no restriction",
+			anon:           identity,
+			wantVoters:     map[string][]string{"A": {"ann", "eve"}, "B": {"bob"}},
+			wantIneligible: map[string]IneligibleVote{},
+		},
+		{
+			name:           "raw allowed voters",
+			allowed:        []string{"ann", "bob"},
+			anon:           identity,
+			wantVoters:     map[string][]string{"A": {"ann"}, "B": {"bob"}},
+			wantIneligible: map[string]IneligibleVote{"eve": {Option: "A", Reason: "not an allowed voter"}},
+		},
+		{
+			name:           "pseudonymous allowed voters",
+			allowed:        []string{"anon-aaaaaaaaaaaa"},
+			anon:           masked,
+			wantVoters:     map[string][]string{"A": {"anon-aaaaaaaaaaaa"}, "B": {}},
+			wantIneligible: map[string]IneligibleVote{"anon-eeeeeeeeeeee": {Option: "A", Reason: "not an allowed voter"}, "anon-bbbbbbbbbbbb": {Option: "B", Reason: "not an allowed voter"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := poll
+			p.AllowedVoters = tt.allowed
+			tally, err := tallyPoll(context.Background(), newMemoryStore(), tt.anon, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			voters := map[string][]string{}
+			for key, opt := range tally.Poll.Options {
+				voters[key] = opt.Voters
+			}
+			if !reflect.DeepEqual(voters, tt.wantVoters) {
+				t.Errorf("voters = %v, want %v", voters, tt.wantVoters)
+			}
+			if !reflect.DeepEqual(tally.Ineligible, tt.wantIneligible) {
+				t.Errorf("ineligible = %v, want %v", tally.Ineligible, tt.wantIneligible)
+			}
+		})
+	}
+}
+
+func TestTallyPollCorrectOn(t *testing.T) {
+	store := newMemoryStore()
+	store.SetPoll("q1", PollQuestion{
+		Question: "Who wrote Go?",
+		Correct:  "B",
+		Options: map[string]PollOption{
+			"A": {Label: "A", Voters: []string{"eve"}},
+			"B": {Label: "B", Voters: []string{"ann", "bob"}},
+		},
+	})
+	identity := func(id string) (string, error) { return id, nil }
+	poll := PollQuestion{
+		Question: "Final question",
+		Options: map[string]PollOption{
+			"A": {Label: "A", Voters: []string{"ann", "eve"}},
+			"B": {Label: "B", Voters: []string{"bob", "cid"}},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		correctOn      string
+		wantVoters     map[string][]string
+		wantIneligible map[string]IneligibleVote
+	}{
+		{
+			name:       "eligible and ineligible voters",
+			correctOn:  "q1",
+			wantVoters: map[string][]string{"A": {"ann"}, "B": {"bob"}},
+			wantIneligible: map[string]IneligibleVote{
+				"eve": {Option: "A", Reason: "did not answer q1 correctly"},
+				"cid": {Option: "B", Reason: "did not answer q1 correctly"},
+			},
+		},
+		{
+			name:           "missing previous question",
+			correctOn:      "q0",
+			wantVoters:     map[string][]string{"A": {"ann", "eve"}, "B": {"bob", "cid"}},
+			wantIneligible: map[string]IneligibleVote{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := poll
+			p.Eligibility = &EligibilityRules{CorrectOn: tt.correctOn}
+			tally, err := tallyPoll(context.Background(), store, identity, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			voters := map[string][]string{}
+			for key, opt := range tally.Poll.Options {
+				voters[key] = opt.Voters
+			}
+			if !reflect.DeepEqual(voters, tt.wantVoters) {
+				t.Errorf("voters = %v, want %v", voters, tt.wantVoters)
+			}
+			if !reflect.DeepEqual(tally.Ineligible, tt.wantIneligible) {
+				t.Errorf("ineligible = %v, want %v", tally.Ineligible, tt.wantIneligible)
+			}
+			update := tally.ineligibleUpdate()
+			if len(update) != 1 || update[0].Path != "ineligibleVotes" || !reflect.DeepEqual(update[0].Value, tt.wantIneligible) {
+				t.Errorf("ineligibleUpdate = %+v, want ineligibleVotes set to %v", update, tt.wantIneligible)
+			}
+		})
+	}
+}
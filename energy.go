@@ -0,0 +1,112 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// energyLevel is how intense the host is at this point of the show.
+type energyLevel string
+
+const (
+	energyOpening energyLevel = "opening"
+	energyMidShow energyLevel = "mid-show"
+	energyClimax  energyLevel = "climax"
+	energyClosing energyLevel = "closing"
+)
+
+// energyStyles are how the prompt asks for each energy level.
+var energyStyles = map[energyLevel]string{
+	energyOpening: "The show is just getting started: be warm and welcoming, and build up excitement for what's coming.",
+	energyMidShow: "The show is in full swing: keep it lively and conversational, and keep things moving.",
+	energyClimax:  "The show is at its peak: go big, with all the drama and excitement of a grand finale.",
+	energyClosing: "The show is winding down: be warm and reflective, and make the audience feel thanked.",
+}
+
+// EnergyConfig shapes the arc of the host's energy across a session. The
+// host opens for Opening after the session starts, builds to its climax
+// Climax before it ends and winds down Closing before the end; in between,
+// and in a session without an end, it is mid-show, rising to the climax
+// while a quiz or duel is being played.
+type EnergyConfig struct {
+	Opening Duration `json:"opening" yaml:"opening"`
+	Climax  Duration `json:"climax" yaml:"climax"`
+	Closing Duration `json:"closing" yaml:"closing"`
+}
+
+// showState is what the energy level follows: how far into the session
+// the show is, how long it has left (negative once over, unknown without
+// an end), and whether a game is being played.
+type showState struct {
+	sinceStart time.Duration
+	untilEnd   time.Duration
+	hasEnd     bool
+	game       bool
+}
+
+// nextEnergy is the energy state machine: the level to move to from cur
+// in show state s. The show moves forward from opening through mid-show
+// to closing and never back; climax comes and goes between the last two.
+func nextEnergy(cfg EnergyConfig, cur energyLevel, s showState) energyLevel {
+	switch {
+	case cur == energyClosing || s.hasEnd && s.untilEnd <= cfg.Closing.Duration:
+		return energyClosing
+	case s.game || s.hasEnd && s.untilEnd <= cfg.Climax.Duration:
+		return energyClimax
+	case cur == energyOpening && s.sinceStart < cfg.Opening.Duration:
+		return energyOpening
+	}
+	return energyMidShow
+}
+
+// energyState is the host's current energy level, with the start of the
+// session it belongs to: a new session starts over at the opening.
+// started is when the backend started, the start of a session without a
+// schedule.
+type energyState struct {
+	mu      sync.Mutex
+	level   energyLevel
+	session time.Time
+	started time.Time
+}
+
+func (e *energyState) current() energyLevel {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.level == "" {
+		return energyOpening
+	}
+	return e.level
+}
+
+// advanceEnergy moves the energy level on for the show's state at now.
+// Without a schedule, the session is taken to have started with the
+// backend and to have no end. Only the monitor calls it.
+func (b *Bot) advanceEnergy(now time.Time) {
+	start, s := b.energy.started, showState{}
+	if sched := b.room.schedule.Load(); sched != nil && !sched.StartsAt.IsZero() {
+		start = sched.StartsAt
+		if !sched.EndsAt.IsZero() {
+			s.hasEnd, s.untilEnd = true, sched.EndsAt.Sub(now)
+		}
+	}
+	s.sinceStart = now.Sub(start)
+	if d := b.duel.snapshot(); d != nil && d.Winner == "" {
+		s.game = true
+	}
+	s.game = s.game || b.room.quizLive.Load()
+
+	b.energy.mu.Lock()
+	defer b.energy.mu.Unlock()
+	from := b.energy.level
+	if from == "" || !start.Equal(b.energy.session) {
+		from, b.energy.session = energyOpening, start
+	}
+	to := nextEnergy(b.cfg.Energy, from, s)
+	if b.energy.level != "" && to != b.energy.level {
+		slog.Info("host energy changed", "from", b.energy.level, "to", to)
+		b.bus.Publish(Event{Kind: EventStateChanged, State: "energy", From: string(b.energy.level), To: string(to)})
+	}
+	b.energy.level = to
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextEnergy(t *testing.T) {
+	cfg := EnergyConfig{Opening: Duration{10 * time.Minute}, Climax: Duration{20 * time.Minute}, Closing: Duration{5 * time.Minute}}
+	tests := []struct {
+		name string
+		cur  energyLevel
+		s    showState
+		want energyLevel
+	}{
+		{"just started", energyOpening, showState{sinceStart: time.Minute}, energyOpening},
+		{"opening over", energyOpening, showState{sinceStart: 11 * time.Minute}, energyMidShow},
+		{"no going back to the opening", energyMidShow, showState{sinceStart: time.Minute}, energyMidShow},
+		{"game played", energyMidShow, showState{sinceStart: time.Hour, game: true}, energyClimax},
+		{"game over", energyClimax, showState{sinceStart: time.Hour}, energyMidShow},
+		{"game during the opening", energyOpening, showState{sinceStart: time.Minute, game: true}, energyClimax},
+		{"end nearing", energyMidShow, showState{sinceStart: time.Hour, untilEnd: 15 * time.Minute, hasEnd: true}, energyClimax},
+		{"end far off", energyMidShow, showState{sinceStart: time.Hour, untilEnd: time.Hour, hasEnd: true}, energyMidShow},
+		{"closing", energyClimax, showState{sinceStart: time.Hour, untilEnd: 5 * time.Minute, hasEnd: true, game: true}, energyClosing},
+		{"no going back from closing", energyClosing, showState{sinceStart: time.Hour, game: true}, energyClosing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextEnergy(cfg, tt.cur, tt.s); got != tt.want {
+				t.Errorf("nextEnergy(%s, %+v) = %s, want %s", tt.cur, tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvanceEnergy(t *testing.T) {
+	t0 := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	b.cfg.Energy = EnergyConfig{Opening: Duration{10 * time.Minute}, Climax: Duration{20 * time.Minute}, Closing: Duration{5 * time.Minute}}
+	events, unsubscribe := b.bus.Subscribe(EventStateChanged)
+	defer unsubscribe()
+	b.room.schedule.Store(&SessionSchedule{Title: "Keynote", StartsAt: t0, EndsAt: t0.Add(time.Hour)})
+
+	steps := []struct {
+		at   time.Duration
+		quiz bool
+		want energyLevel
+	}{
+		{time.Minute, false, energyOpening},
+		{15 * time.Minute, false, energyMidShow},
+		{20 * time.Minute, true, energyClimax},
+		{25 * time.Minute, false, energyMidShow},
+		{45 * time.Minute, false, energyClimax},
+		{56 * time.Minute, false, energyClosing},
+	}
+	from := energyOpening
+	for _, step := range steps {
+		b.room.quizLive.Store(step.quiz)
+		b.advanceEnergy(t0.Add(step.at))
+		if got := b.energy.current(); got != step.want {
+			t.Fatalf("energy %s in = %s, want %s", step.at, got, step.want)
+		}
+		if step.want == from {
+			continue
+		}
+		select {
+		case e := <-events:
+			if e.State != "energy" || e.From != string(from) || e.To != string(step.want) {
+				t.Errorf("event = %+v, want energy %s to %s", e, from, step.want)
+			}
+		default:
+			t.Errorf("no state change to %s", step.want)
+		}
+		from = step.want
+	}
+
+	b.room.schedule.Store(&SessionSchedule{Title: "Panel", StartsAt: t0.Add(2 * time.Hour), EndsAt: t0.Add(3 * time.Hour)})
+	b.advanceEnergy(t0.Add(2*time.Hour + time.Minute))
+	if got := b.energy.current(); got != energyOpening {
+		t.Errorf("energy at the start of the next session = %s, want %s", got, energyOpening)
+	}
+}
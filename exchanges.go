@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// answeredMessage pairs an audience message with the host reply written for it.
+// Replies share the document ID of the message they answer.
+type answeredMessage struct {
+	ID       string
+	Question Message
+	Response Message
+}
+
+// answeredMessages returns every host reply written since the given time
+// together with the audience message it answered. Host prompts, which
+// aren't replies to anyone, are skipped.
+func answeredMessages(ctx context.Context, client *firestore.Client, userCollection, pingCollection string, since time.Time) ([]answeredMessage, error) {
+	var answered []answeredMessage
+
+	iter := client.Collection(pingCollection).Where("timestamp", ">=", since).OrderBy("timestamp", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through pings: %w", err)
+		}
+
+		var ping Message
+		if err := doc.DataTo(&ping); err != nil {
+			return nil, fmt.Errorf("error converting document to message: %w", err)
+		}
+
+		userDoc, err := client.Collection(userCollection).Doc(doc.Ref.ID).Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error fetching user message: %w", err)
+		}
+		var question Message
+		if err := userDoc.DataTo(&question); err != nil {
+			return nil, fmt.Errorf("error converting document to message: %w", err)
+		}
+
+		answered = append(answered, answeredMessage{ID: doc.Ref.ID, Question: question, Response: ping})
+	}
+
+	return answered, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reactions the frontend counts as feedback on a host reply.
+const (
+	thumbsUp   = "👍"
+	thumbsDown = "👎"
+)
+
+// ArmFeedback is the audience's thumbs on the replies one prompt variant
+// gave as one persona.
+type ArmFeedback struct {
+	Variant string `firestore:"variant" json:"variant"`
+	Persona string `firestore:"persona" json:"persona"`
+	Up      int    `firestore:"up" json:"up"`
+	Down    int    `firestore:"down" json:"down"`
+}
+
+// score is the arm's share of thumbs up, starting from an even 1 in 2 so
+// an arm nobody has reacted to yet is neither favoured nor written off.
+func (a ArmFeedback) score() float64 {
+	return float64(a.Up+1) / float64(a.Up+a.Down+2)
+}
+
+// FeedbackReport is one session's feedback, a document in the event-wide
+// feedback collection, so the experiment learns across sessions.
+type FeedbackReport struct {
+	ID        string        `firestore:"-" json:"id"`
+	Room      string        `firestore:"room,omitempty" json:"room,omitempty"`
+	Session   string        `firestore:"session,omitempty" json:"session,omitempty"`
+	UpdatedAt time.Time     `firestore:"updatedAt" json:"updatedAt"`
+	Arms      []ArmFeedback `firestore:"arms" json:"arms"`
+}
+
+// FeedbackStore reads reactions on host replies and keeps the feedback
+// reports.
+type FeedbackStore interface {
+	// VariantReplies lists this session's host replies written with a
+	// prompt variant.
+	VariantReplies(ctx context.Context) ([]*Message, error)
+	SaveFeedback(ctx context.Context, r FeedbackReport) error
+	// Feedback returns the reports of every session.
+	Feedback(ctx context.Context) ([]FeedbackReport, error)
+}
+
+// experiment assigns a prompt variant to each audience reply. Variants
+// are arms of a bandit per persona: most replies go to the variant with
+// the best score so far, and explore of them to one picked at random so
+// the others keep being measured.
+type experiment struct {
+	variants []string
+	explore  float64
+
+	mu   sync.Mutex
+	arms map[[2]string]ArmFeedback
+}
+
+func newExperiment(cfg ExperimentConfig) *experiment {
+	e := &experiment{variants: cfg.Variants, arms: map[[2]string]ArmFeedback{}}
+	if cfg.Explore != nil {
+		e.explore = *cfg.Explore
+	}
+	return e
+}
+
+// pick returns the variant the next reply as persona uses, or "" if no
+// experiment is running. Ties go to the variant listed first.
+func (e *experiment) pick(persona string) string {
+	if len(e.variants) == 0 {
+		return ""
+	}
+	if rng.Float64() < e.explore {
+		return e.variants[rng.Intn(len(e.variants))]
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	best, bestScore := e.variants[0], -1.0
+	for _, v := range e.variants {
+		if s := e.arms[[2]string{v, persona}].score(); s > bestScore {
+			best, bestScore = v, s
+		}
+	}
+	return best
+}
+
+// update replaces the feedback the experiment goes by with the total of
+// reports.
+func (e *experiment) update(reports []FeedbackReport) {
+	arms := map[[2]string]ArmFeedback{}
+	for _, r := range reports {
+		for _, a := range r.Arms {
+			key := [2]string{a.Variant, a.Persona}
+			total := arms[key]
+			total.Variant, total.Persona = a.Variant, a.Persona
+			total.Up += a.Up
+			total.Down += a.Down
+			arms[key] = total
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.arms = arms
+}
+
+// snapshot lists the arms with feedback, best score first.
+func (e *experiment) snapshot() []ArmFeedback {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	arms := make([]ArmFeedback, 0, len(e.arms))
+	for _, a := range e.arms {
+		arms = append(arms, a)
+	}
+	sortArms(arms)
+	return arms
+}
+
+func sortArms(arms []ArmFeedback) {
+	sort.Slice(arms, func(i, j int) bool {
+		if si, sj := arms[i].score(), arms[j].score(); si != sj {
+			return si > sj
+		}
+		if arms[i].Persona != arms[j].Persona {
+			return arms[i].Persona < arms[j].Persona
+		}
+		return arms[i].Variant < arms[j].Variant
+	})
+}
+
+// aggregateFeedback totals the thumbs on replies by variant and persona.
+func aggregateFeedback(replies []*Message) []ArmFeedback {
+	byArm := map[[2]string]*ArmFeedback{}
+	for _, r := range replies {
+		if r.Variant == "" {
+			continue
+		}
+		key := [2]string{r.Variant, r.Persona}
+		a := byArm[key]
+		if a == nil {
+			a = &ArmFeedback{Variant: r.Variant, Persona: r.Persona}
+			byArm[key] = a
+		}
+		a.Up += r.Reactions[thumbsUp]
+		a.Down += r.Reactions[thumbsDown]
+	}
+	arms := make([]ArmFeedback, 0, len(byArm))
+	for _, a := range byArm {
+		arms = append(arms, *a)
+	}
+	sortArms(arms)
+	return arms
+}
+
+// feedbackReportID names this session's feedback report: the room and
+// session, or the collection prefix in the flat layout.
+func feedbackReportID(cfg *Config) string {
+	if cfg.Room != "" {
+		return cfg.Room + "-" + cfg.Session
+	}
+	return cfg.Collections.Prefix
+}
+
+// variantKey is the context key of the prompt variant of a reply.
+type variantKey struct{}
+
+// withVariant returns ctx carrying the prompt variant generateResponse
+// renders with.
+func withVariant(ctx context.Context, variant string) context.Context {
+	return context.WithValue(ctx, variantKey{}, variant)
+}
+
+func variantFrom(ctx context.Context) string {
+	v, _ := ctx.Value(variantKey{}).(string)
+	return v
+}
+
+// collectFeedback totals this session's reactions every
+// experiment.feedbackInterval, saves them and points the experiment at
+// the feedback of every session. Only the primary runs it.
+func (b *Bot) collectFeedback(ctx context.Context) error {
+	ticker := clock.NewTicker(b.cfg.Experiment.FeedbackInterval.Duration)
+	defer ticker.Stop()
+	for {
+		if err := b.updateFeedback(ctx); err != nil {
+			slog.Error("error collecting reply feedback", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+func (b *Bot) updateFeedback(ctx context.Context) error {
+	replies, err := b.feedback.VariantReplies(ctx)
+	if err != nil {
+		return err
+	}
+	report := FeedbackReport{ID: feedbackReportID(b.cfg), Room: b.cfg.Room, Session: b.cfg.Session, UpdatedAt: clock.Now(), Arms: aggregateFeedback(replies)}
+	if err := b.feedback.SaveFeedback(ctx, report); err != nil {
+		return err
+	}
+	reports, err := b.feedback.Feedback(ctx)
+	if err != nil {
+		return err
+	}
+	b.experiment.update(reports)
+	return nil
+}
+
+func registerExperimentRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/experiment", func(w http.ResponseWriter, r *http.Request) {
+		type arm struct {
+			ArmFeedback
+			Score float64 `json:"score"`
+		}
+		arms := []arm{}
+		for _, a := range b.experiment.snapshot() {
+			arms = append(arms, arm{a, a.score()})
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"variants": b.cfg.Experiment.Variants, "explore": b.cfg.Experiment.Explore, "arms": arms})
+	})
+}
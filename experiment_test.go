@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAggregateFeedback(t *testing.T) {
+	replies := []*Message{
+		{ID: "r1", Variant: "short", Persona: "rajini", Reactions: map[string]int{thumbsUp: 3, thumbsDown: 1, "🔥": 5}},
+		{ID: "r2", Variant: "short", Persona: "rajini", Reactions: map[string]int{thumbsUp: 1}},
+		{ID: "r3", Variant: "long", Persona: "rajini", Reactions: map[string]int{thumbsDown: 2}},
+		{ID: "r4", Persona: "rajini", Reactions: map[string]int{thumbsUp: 9}},
+	}
+	want := []ArmFeedback{
+		{Variant: "short", Persona: "rajini", Up: 4, Down: 1},
+		{Variant: "long", Persona: "rajini", Up: 0, Down: 2},
+	}
+	if got := aggregateFeedback(replies); !reflect.DeepEqual(got, want) {
+		t.Errorf("aggregateFeedback = %+v, want %+v", got, want)
+	}
+}
+
+func TestExperimentPick(t *testing.T) {
+	e := newExperiment(ExperimentConfig{Variants: []string{"long", "short"}})
+	if got := e.pick("rajini"); got != "long" {
+		t.Errorf("pick without feedback = %q, want the first variant", got)
+	}
+	// Feedback from two sessions adds up, per persona.
+	e.update([]FeedbackReport{
+		{ID: "s1", Arms: []ArmFeedback{{Variant: "short", Persona: "rajini", Up: 3}, {Variant: "long", Persona: "rajini", Down: 2}}},
+		{ID: "s2", Arms: []ArmFeedback{{Variant: "short", Persona: "rajini", Down: 1}, {Variant: "short", Persona: "kbc", Down: 4}}},
+	})
+	if got := e.pick("rajini"); got != "short" {
+		t.Errorf("pick for rajini = %q, want short", got)
+	}
+	if got := e.pick("kbc"); got != "long" {
+		t.Errorf("pick for kbc = %q, want long", got)
+	}
+	if got := newExperiment(ExperimentConfig{}).pick("rajini"); got != "" {
+		t.Errorf("pick without variants = %q, want none", got)
+	}
+}
+
+func TestReplyFeedbackLoop(t *testing.T) {
+	store := newMemoryStore()
+	var sent []string
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		sent = append(sent, prompt)
+		return "Vanakkam!", nil
+	}))
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "reply.tmpl"), []byte(`{{if eq .Variant "short"}}Be brief.{{else}}Take your time.{{end}} {{.Message}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prompts, err := loadPrompts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.prompts = prompts
+	b.cfg.Experiment = ExperimentConfig{Variants: []string{"long", "short"}}
+	b.experiment = newExperiment(b.cfg.Experiment)
+	ctx := context.Background()
+
+	reply, err := b.generateResponse(withVariant(ctx, "short"), "hi", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "Vanakkam!" || len(sent) != 1 || !strings.HasPrefix(sent[0], "Be brief.") {
+		t.Fatalf("prompts = %q, want the short variant", sent)
+	}
+
+	store.WriteReply(ctx, Message{ID: "r1", Message: reply, Persona: "kbc", Variant: "short"})
+	store.WriteReply(ctx, Message{ID: "r2", Message: reply, Persona: "kbc", Variant: "long"})
+	store.React("r1", thumbsUp, 2)
+	store.React("r2", thumbsDown, 1)
+	if err := b.updateFeedback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reports, _ := store.Feedback(ctx)
+	if len(reports) != 1 || len(reports[0].Arms) != 2 {
+		t.Fatalf("feedback reports = %+v, want this session's", reports)
+	}
+	if got := b.experiment.pick("kbc"); got != "short" {
+		t.Errorf("pick after feedback = %q, want short", got)
+	}
+}
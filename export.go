@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// TrainingExample is one line of the fine-tuning dataset.
+type TrainingExample struct {
+	MessageID    string           `json:"message_id"`
+	Timestamp    time.Time        `json:"timestamp"`
+	UserID       string           `json:"user_id,omitempty"`
+	Context      string           `json:"context"`
+	UserMessage  string           `json:"user_message"`
+	HostResponse string           `json:"host_response"`
+	Moderation   ModerationLabels `json:"moderation"`
+}
+
+type ModerationLabels struct {
+	UserFlagged     bool `json:"user_flagged"`
+	ResponseFlagged bool `json:"response_flagged"`
+}
+
+// runExport implements the "export" command, which writes a JSONL
+// fine-tuning dataset of (context, user message, host response) triples.
+func runExport(ctx context.Context, w io.Writer, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "-", "output file, or - for stdout")
+	since := fs.Duration("since", 24*time.Hour, "only export exchanges newer than this")
+	skipFlagged := fs.Bool("skip-flagged", false, "leave out exchanges with any moderation flag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := newFirestoreClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	answered, err := answeredMessages(ctx, client, cfg.Collections.User, cfg.Collections.Ping, clock.Now().Add(-*since))
+	if err != nil {
+		return err
+	}
+
+	dst := w
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("error creating export file: %w", err)
+		}
+		defer f.Close()
+		dst = f
+	}
+
+	written, err := writeTrainingExamples(dst, answered, *skipFlagged)
+	if err != nil {
+		return err
+	}
+
+	if *out != "-" {
+		fmt.Fprintf(w, "Exported %d examples to %s\n", written, *out)
+	}
+	return nil
+}
+
+// writeTrainingExamples writes answered as JSONL training examples,
+// labelled with whether either side has profanity, and returns how many it
+// wrote. With skipFlagged, labelled exchanges are left out.
+func writeTrainingExamples(w io.Writer, answered []answeredMessage, skipFlagged bool) (int, error) {
+	enc := json.NewEncoder(w)
+	written := 0
+	for _, a := range answered {
+		ex := TrainingExample{
+			MessageID:    a.ID,
+			Timestamp:    a.Question.Timestamp,
+			UserID:       a.Question.UserID,
+			Context:      a.Response.Context,
+			UserMessage:  a.Question.Message,
+			HostResponse: a.Response.Message,
+			Moderation: ModerationLabels{
+				UserFlagged:     containsProfanity(a.Question.Message),
+				ResponseFlagged: containsProfanity(a.Response.Message),
+			},
+		}
+		if skipFlagged && (ex.Moderation.UserFlagged || ex.Moderation.ResponseFlagged) {
+			continue
+		}
+		if err := enc.Encode(ex); err != nil {
+			return written, fmt.Errorf("error writing training example: %w", err)
+		}
+		written++
+	}
+	return written, nil
+}
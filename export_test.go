@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteTrainingExamples(t *testing.T) {
+	t0 := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	answered := []answeredMessage{
+		{ID: "q1", Question: Message{UserID: "ann", Message: "What is Gemini?", Timestamp: t0}, Response: Message{Message: "A family of models.", Context: "keynote"}},
+		{ID: "q2", Question: Message{UserID: "bob", Message: "what the fuck is this", Timestamp: t0.Add(time.Minute)}, Response: Message{Message: "Language, dost!"}},
+		{ID: "q3", Question: Message{UserID: "cat", Message: "Any tips?", Timestamp: t0.Add(2 * time.Minute)}, Response: Message{Message: "Shit happens, keep shipping."}},
+	}
+
+	var out bytes.Buffer
+	n, err := writeTrainingExamples(&out, answered, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if n != 3 || len(lines) != 3 {
+		t.Fatalf("wrote %d examples in %d lines, want 3 in 3", n, len(lines))
+	}
+	var got []TrainingExample
+	for _, line := range lines {
+		var ex TrainingExample
+		if err := json.Unmarshal([]byte(line), &ex); err != nil {
+			t.Fatalf("line %q is not a training example: %v", line, err)
+		}
+		got = append(got, ex)
+	}
+	want := TrainingExample{MessageID: "q1", Timestamp: t0, UserID: "ann", Context: "keynote", UserMessage: "What is Gemini?", HostResponse: "A family of models."}
+	if got[0] != want {
+		t.Errorf("first example = %+v, want %+v", got[0], want)
+	}
+	if !got[1].Moderation.UserFlagged || got[1].Moderation.ResponseFlagged {
+		t.Errorf("q2 labels = %+v, want only the user message flagged", got[1].Moderation)
+	}
+	if got[2].Moderation.UserFlagged || !got[2].Moderation.ResponseFlagged {
+		t.Errorf("q3 labels = %+v, want only the response flagged", got[2].Moderation)
+	}
+
+	out.Reset()
+	if n, err := writeTrainingExamples(&out, answered, true); err != nil || n != 1 || !strings.Contains(out.String(), `"message_id":"q1"`) {
+		t.Errorf("with skipFlagged wrote %d examples, %v:\n%s\nwant only q1", n, err, out.String())
+	}
+}
+
+func TestEmulatorExport(t *testing.T) {
+	b := newEmulatorBot(t, generatorFunc(nil))
+	ctx := context.Background()
+	now := time.Now()
+	for id, at := range map[string]time.Time{"recent": now.Add(-time.Hour), "stale": now.Add(-48 * time.Hour)} {
+		if _, err := b.client.Collection(b.cfg.Collections.User).Doc(id).Set(ctx, Message{UserID: "ann", Message: "Question " + id, Timestamp: at}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.client.Collection(b.cfg.Collections.Ping).Doc(id).Set(ctx, Message{Message: "Answer " + id, Timestamp: at.Add(time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "train.jsonl")
+	var out bytes.Buffer
+	if err := runExport(ctx, &out, []string{"-out", path}, b.cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Exported 1 examples") {
+		t.Errorf("output = %q, want 1 example exported", out.String())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"message_id":"recent"`) || strings.Contains(string(data), "stale") {
+		t.Errorf("export = %s, want only the exchange from the last day", data)
+	}
+}
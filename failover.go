@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// failoverInterval is how often the active instance writes its heartbeat
+// and a standby mirrors it, so a promotion takes effect within seconds.
+const failoverInterval = time.Second
+
+// errSuperseded is returned by the heartbeat once another instance has
+// become the active one.
+var errSuperseded = errors.New("another instance is active")
+
+// FailoverState is the single document naming the active instance, with
+// the state a warm standby mirrors so that it can take over mid-show.
+type FailoverState struct {
+	Active      string    `firestore:"active" json:"active"`
+	ActiveSince time.Time `firestore:"activeSince" json:"activeSince"`
+	HeartbeatAt time.Time `firestore:"heartbeatAt" json:"heartbeatAt"`
+	Persona     string    `firestore:"persona" json:"persona"`
+	ActivePoll  string    `firestore:"activePoll" json:"activePoll"`
+	// Day is the content calendar day in effect, if any.
+	Day string `firestore:"day,omitempty" json:"day,omitempty"`
+	// Paused and the durations are the stage controls.
+	Paused        bool          `firestore:"paused" json:"paused"`
+	AutoTune      bool          `firestore:"autoTune" json:"autoTune"`
+	IdleThreshold time.Duration `firestore:"idleThreshold" json:"idleThreshold"`
+	IdlePromptGap time.Duration `firestore:"idlePromptGap" json:"idlePromptGap"`
+	PollUpdateGap time.Duration `firestore:"pollUpdateGap" json:"pollUpdateGap"`
+	// SummaryVersion is the conversation summary version in the summaries
+	// collection; Turns are the recent turns it does not cover yet.
+	SummaryVersion int                `firestore:"summaryVersion" json:"summaryVersion"`
+	Turns          []conversationTurn `firestore:"turns" json:"turns"`
+}
+
+// FailoverStore keeps the failover document.
+type FailoverStore interface {
+	// Failover returns the failover document, or nil if there is none.
+	Failover(ctx context.Context) (*FailoverState, error)
+	// UpdateFailover applies fn to the document, a zero one if there is
+	// none, atomically; an error from fn aborts the update.
+	UpdateFailover(ctx context.Context, fn func(s *FailoverState) error) error
+}
+
+// becomeActive records this instance as the active one. The previous
+// active instance sees it on its next heartbeat and shuts down.
+func (b *Bot) becomeActive(ctx context.Context) error {
+	return b.failover.UpdateFailover(ctx, func(s *FailoverState) error {
+		if s.Active != b.cfg.InstanceID {
+			s.Active, s.ActiveSince = b.cfg.InstanceID, clock.Now()
+		}
+		b.mirrorTo(s)
+		return nil
+	})
+}
+
+// mirrorTo copies the state a standby needs into s.
+func (b *Bot) mirrorTo(s *FailoverState) {
+	c := b.room.controls.Load()
+	s.HeartbeatAt = clock.Now()
+	s.Persona = b.personas.current().Name
+	s.ActivePoll = b.activePollID()
+	s.Day = ""
+	if d := b.contentDay(); d != nil {
+		s.Day = d.ID
+	}
+	s.Paused, s.AutoTune = c.Paused, c.AutoTune
+	s.IdleThreshold, s.IdlePromptGap, s.PollUpdateGap = c.IdleThreshold.Duration, c.IdlePromptGap.Duration, c.PollUpdateGap.Duration
+	s.Turns, s.SummaryVersion = b.memory.snapshot()
+}
+
+// heartbeat keeps the failover document current while this instance is
+// the active one, and calls stop, shutting the process down, once another
+// instance has been promoted in its place. Only the primary runs it.
+func (b *Bot) heartbeat(ctx context.Context, stop func()) error {
+	if err := b.becomeActive(ctx); err != nil {
+		return fmt.Errorf("error recording the active instance: %w", err)
+	}
+	ticker := clock.NewTicker(failoverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+		err := b.failover.UpdateFailover(ctx, func(s *FailoverState) error {
+			if s.Active != b.cfg.InstanceID {
+				return fmt.Errorf("%w: %s", errSuperseded, s.Active)
+			}
+			b.mirrorTo(s)
+			return nil
+		})
+		if errors.Is(err, errSuperseded) {
+			slog.Warn("stepping down", "err", err)
+			stop()
+			return nil
+		}
+		if err != nil {
+			slog.Error("error writing failover heartbeat", "err", err)
+		}
+	}
+}
+
+// standBy mirrors the active instance's state every failoverInterval
+// until the admin API promotes this instance, then makes it the active
+// one. It returns early, with nil, if ctx is done.
+func (b *Bot) standBy(ctx context.Context) error {
+	slog.Info("standing by", "instance", b.cfg.InstanceID)
+	ticker := clock.NewTicker(failoverInterval)
+	defer ticker.Stop()
+	for {
+		s, err := b.failover.Failover(ctx)
+		if err != nil {
+			slog.Error("error reading failover state", "err", err)
+		} else if s != nil {
+			b.mirrorFrom(ctx, s)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.promoted:
+			if err := b.becomeActive(ctx); err != nil {
+				return fmt.Errorf("error taking over as the active instance: %w", err)
+			}
+			slog.Info("promoted to active", "instance", b.cfg.InstanceID)
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// mirrorFrom applies the active instance's state to this standby.
+func (b *Bot) mirrorFrom(ctx context.Context, s *FailoverState) {
+	if s.Persona != "" && s.Persona != b.personas.current().Name {
+		if _, err := b.personas.switchTo(s.Persona); err != nil {
+			slog.Error("error mirroring persona", "err", err)
+		}
+	}
+	if s.ActivePoll != "" && s.ActivePoll != b.activePollID() {
+		b.room.poll.Store(&activePoll{ID: s.ActivePoll, Since: clock.Now()})
+	}
+	// The calendar fills in the rest of the day once this instance runs it.
+	if d := b.contentDay(); s.Day != "" && (d == nil || d.ID != s.Day) {
+		b.room.day.Store(&ContentDay{ID: s.Day})
+	}
+	if s.IdleThreshold > 0 && s.IdlePromptGap > 0 && s.PollUpdateGap > 0 {
+		b.room.controls.Store(&stageControls{
+			Paused:        s.Paused,
+			AutoTune:      s.AutoTune,
+			IdleThreshold: Duration{s.IdleThreshold},
+			IdlePromptGap: Duration{s.IdlePromptGap},
+			PollUpdateGap: Duration{s.PollUpdateGap},
+		})
+	}
+	var summary *SummaryVersion
+	if _, version := b.memory.snapshot(); s.SummaryVersion > version {
+		latest, err := b.summaries.LatestSummary(ctx)
+		if err != nil || latest == nil {
+			slog.Error("error mirroring conversation summary", "summaryVersion", s.SummaryVersion, "err", err)
+			return
+		}
+		summary = latest
+	}
+	b.memory.mirror(s.Turns, summary)
+	b.refreshSummary()
+}
+
+func registerFailoverRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/failover", func(w http.ResponseWriter, r *http.Request) {
+		s, err := b.failover.Failover(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"instance": b.cfg.InstanceID, "standby": b.cfg.Standby, "state": s})
+	})
+
+	// Sent to the standby to make it take over.
+	mux.HandleFunc("POST /admin/failover/promote", func(w http.ResponseWriter, r *http.Request) {
+		if !b.cfg.Standby {
+			writeError(w, http.StatusConflict, errors.New("this instance is not a standby"))
+			return
+		}
+		promoted := false
+		b.promote.Do(func() { close(b.promoted); promoted = true })
+		if !promoted {
+			writeError(w, http.StatusConflict, errors.New("already promoted"))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStandbyPromotion(t *testing.T) {
+	store := newMemoryStore()
+	active := newTestBot(t, store, generatorFunc(nil))
+	active.cfg.InstanceID = "blue"
+	standby := newTestBot(t, store, generatorFunc(nil))
+	standby.cfg.InstanceID, standby.cfg.Standby, standby.cfg.AdminToken = "green", true, "s3cret"
+
+	active.memory.add(conversationTurn{From: "Audience (ann)", Text: "What is Gemini?"})
+	active.memory.add(conversationTurn{From: "Host", Text: "A family of models, dost!"})
+	active.setPaused(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var stopped atomic.Bool
+	heartbeat := make(chan error, 1)
+	go func() { heartbeat <- active.heartbeat(ctx, func() { stopped.Store(true) }) }()
+	waitFor(t, heartbeat, "the active instance", func() bool {
+		s, _ := store.Failover(ctx)
+		return s != nil && s.Active == "blue"
+	})
+
+	standing := make(chan error, 1)
+	go func() { standing <- standby.standBy(ctx) }()
+	waitFor(t, heartbeat, "the standby to mirror the conversation", func() bool {
+		turns, _ := standby.memory.snapshot()
+		return len(turns) == 2
+	})
+	if !standby.room.controls.Load().Paused {
+		t.Error("standby did not mirror the paused auto-prompts")
+	}
+
+	srv := httptest.NewServer(standby.adminHandler())
+	defer srv.Close()
+	promote := func() int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/failover/promote", nil)
+		req.Header.Set("Authorization", "Bearer "+standby.cfg.AdminToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := promote(); code != http.StatusAccepted {
+		t.Fatalf("promote = %d, want %d", code, http.StatusAccepted)
+	}
+	if code := promote(); code != http.StatusConflict {
+		t.Errorf("second promote = %d, want %d", code, http.StatusConflict)
+	}
+	select {
+	case err := <-standing:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("standBy did not return after promotion")
+	}
+	if s, _ := store.Failover(ctx); s.Active != "green" {
+		t.Errorf("active instance = %q, want green", s.Active)
+	}
+
+	waitFor(t, nil, "the old active instance to step down", stopped.Load)
+	if err := <-heartbeat; err != nil {
+		t.Errorf("heartbeat = %v", err)
+	}
+}
+
+func TestPromoteRequiresStandby(t *testing.T) {
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	mux := http.NewServeMux()
+	registerFailoverRoutes(mux, b)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/failover/promote", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("promote on the active instance = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
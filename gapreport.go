@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const gapReportInterval = time.Hour
+
+// GapReport is one day's knowledge gaps, grouped by question, for the
+// organizers to fill in the FAQ from. Days are in the backend's local time.
+type GapReport struct {
+	Day       string     `firestore:"day"`
+	Total     int        `firestore:"total"`
+	Topics    []GapTopic `firestore:"topics"`
+	UpdatedAt time.Time  `firestore:"updatedAt"`
+}
+
+// GapTopic is every gap with the same normalized question. Question is its
+// latest wording.
+type GapTopic struct {
+	Question   string    `firestore:"question"`
+	Count      int       `firestore:"count"`
+	Reasons    []string  `firestore:"reasons"`
+	FirstAsked time.Time `firestore:"firstAsked"`
+	LastAsked  time.Time `firestore:"lastAsked"`
+}
+
+// aggregateGaps groups gaps by normalized question, most asked first.
+func aggregateGaps(day string, gaps []KnowledgeGap) *GapReport {
+	report := &GapReport{Day: day, Total: len(gaps), UpdatedAt: clock.Now()}
+	byQuestion := map[string]*GapTopic{}
+	var order []string
+	for _, g := range gaps {
+		key := normalizeQuestion(g.Question)
+		t, ok := byQuestion[key]
+		if !ok {
+			t = &GapTopic{Question: g.Question, FirstAsked: g.At, LastAsked: g.At}
+			byQuestion[key] = t
+			order = append(order, key)
+		}
+		t.Count++
+		if !slices.Contains(t.Reasons, g.Reason) {
+			t.Reasons = append(t.Reasons, g.Reason)
+		}
+		if g.At.Before(t.FirstAsked) {
+			t.FirstAsked = g.At
+		}
+		if !g.At.Before(t.LastAsked) {
+			t.Question, t.LastAsked = g.Question, g.At
+		}
+	}
+	for _, key := range order {
+		t := byQuestion[key]
+		sort.Strings(t.Reasons)
+		report.Topics = append(report.Topics, *t)
+	}
+	sort.SliceStable(report.Topics, func(i, j int) bool { return report.Topics[i].Count > report.Topics[j].Count })
+	return report
+}
+
+// buildGapReport reads the knowledge gaps recorded on day and aggregates them.
+func buildGapReport(ctx context.Context, client *firestore.Client, collection string, day time.Time) (*GapReport, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	docs, err := client.Collection(collection).Where("at", ">=", start).Where("at", "<", start.AddDate(0, 0, 1)).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading knowledge gaps: %w", err)
+	}
+	gaps := make([]KnowledgeGap, 0, len(docs))
+	for _, doc := range docs {
+		var g KnowledgeGap
+		if err := doc.DataTo(&g); err != nil {
+			return nil, fmt.Errorf("error decoding knowledge gap %s: %w", doc.Ref.ID, err)
+		}
+		gaps = append(gaps, g)
+	}
+	return aggregateGaps(start.Format(time.DateOnly), gaps), nil
+}
+
+// runGapReports rebuilds yesterday's and today's gap reports every hour,
+// so yesterday's is complete once the day has turned.
+func (b *Bot) runGapReports(ctx context.Context) error {
+	ticker := clock.NewTicker(gapReportInterval)
+	defer ticker.Stop()
+
+	for {
+		now := clock.Now()
+		for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+			report, err := buildGapReport(ctx, b.client, b.cfg.Collections.KnowledgeGaps, day)
+			if err != nil {
+				return err
+			}
+			if report.Total == 0 {
+				continue
+			}
+			if _, err := b.client.Collection(b.cfg.Collections.GapReports).Doc(report.Day).Set(ctx, report); err != nil {
+				return fmt.Errorf("error writing gap report for %s: %w", report.Day, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// runGapReport prints the knowledge gaps of one day, today by default.
+func runGapReport(ctx context.Context, w io.Writer, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("gap-report", flag.ContinueOnError)
+	dayFlag := fs.String("day", "", "day to report, as YYYY-MM-DD (default today)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	day := clock.Now()
+	if *dayFlag != "" {
+		var err error
+		if day, err = time.ParseInLocation(time.DateOnly, *dayFlag, time.Local); err != nil {
+			return fmt.Errorf("invalid -day: %w", err)
+		}
+	}
+
+	client, err := newFirestoreClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	report, err := buildGapReport(ctx, client, cfg.Collections.KnowledgeGaps, day)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d questions sent to the info desk on %s\n\n", report.Total, report.Day)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COUNT\tQUESTION\tREASONS\tLAST ASKED")
+	for _, t := range report.Topics {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", t.Count, t.Question, strings.Join(t.Reasons, "; "), t.LastAsked.Format("15:04"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregateGaps(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2024, 1, 1, 10, minute, 0, 0, time.UTC) }
+	gaps := []KnowledgeGap{
+		{Question: "Where can I park?", Reason: `event question about "parking" not in the FAQ`, At: at(5)},
+		{Question: "who won the hackathon", Reason: "the host didn't know", At: at(1)},
+		{Question: "where can i PARK", Reason: `event question about "parking" not in the FAQ`, At: at(9)},
+		{Question: "Where can I park??", Reason: "the host didn't know", At: at(2)},
+	}
+
+	report := aggregateGaps("2024-01-01", gaps)
+	if report.Total != 4 || len(report.Topics) != 2 {
+		t.Fatalf("report = %+v, want 4 gaps in 2 topics", report)
+	}
+	park := report.Topics[0]
+	if park.Count != 3 || park.Question != "where can i PARK" || !park.FirstAsked.Equal(at(2)) || !park.LastAsked.Equal(at(9)) {
+		t.Errorf("top topic = %+v, want 3 parking questions from 10:02 to 10:09, latest wording", park)
+	}
+	if len(park.Reasons) != 2 {
+		t.Errorf("top topic reasons = %q, want both reasons once", park.Reasons)
+	}
+	if report.Topics[1].Count != 1 {
+		t.Errorf("second topic = %+v, want 1 question", report.Topics[1])
+	}
+}
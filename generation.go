@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	vgenai "cloud.google.com/go/vertexai/genai"
+	"github.com/google/generative-ai-go/genai"
+)
+
+// GenerationConfig tunes how the model writes. Unset fields are left to
+// the backend, except Temperature, which defaults to 1. StopSequences end
+// a reply where they first appear. Safety maps a Gemini harm category to
+// the lowest probability of harm that blocks a prompt or reply; it only
+// applies on the googleai and vertexai backends.
+type GenerationConfig struct {
+	Temperature     *float64          `json:"temperature,omitempty" yaml:"temperature"`
+	TopP            float64           `json:"topP,omitempty" yaml:"topP"`
+	TopK            int               `json:"topK,omitempty" yaml:"topK"`
+	MaxOutputTokens int               `json:"maxOutputTokens,omitempty" yaml:"maxOutputTokens"`
+	StopSequences   []string          `json:"stopSequences,omitempty" yaml:"stopSequences"`
+	Safety          map[string]string `json:"safety,omitempty" yaml:"safety"`
+}
+
+// safetyCategories are the harm categories Safety can set, in the terms of
+// the Google AI and Vertex AI SDKs.
+var safetyCategories = map[string]struct {
+	googleAI genai.HarmCategory
+	vertexAI vgenai.HarmCategory
+}{
+	"harassment":        {genai.HarmCategoryHarassment, vgenai.HarmCategoryHarassment},
+	"hate-speech":       {genai.HarmCategoryHateSpeech, vgenai.HarmCategoryHateSpeech},
+	"sexually-explicit": {genai.HarmCategorySexuallyExplicit, vgenai.HarmCategorySexuallyExplicit},
+	"dangerous-content": {genai.HarmCategoryDangerousContent, vgenai.HarmCategoryDangerousContent},
+}
+
+// safetyThresholds are the values Safety can set: block content from a low,
+// medium or high probability of harm up, or none at all.
+var safetyThresholds = map[string]struct {
+	googleAI genai.HarmBlockThreshold
+	vertexAI vgenai.HarmBlockThreshold
+}{
+	"low":    {genai.HarmBlockLowAndAbove, vgenai.HarmBlockLowAndAbove},
+	"medium": {genai.HarmBlockMediumAndAbove, vgenai.HarmBlockMediumAndAbove},
+	"high":   {genai.HarmBlockOnlyHigh, vgenai.HarmBlockOnlyHigh},
+	"none":   {genai.HarmBlockNone, vgenai.HarmBlockNone},
+}
+
+// with returns g with the fields set in override replacing its own, and
+// override's safety thresholds replacing those of the same category.
+func (g GenerationConfig) with(override *GenerationConfig) GenerationConfig {
+	if override == nil {
+		return g
+	}
+	if override.Temperature != nil {
+		g.Temperature = override.Temperature
+	}
+	if override.TopP != 0 {
+		g.TopP = override.TopP
+	}
+	if override.TopK != 0 {
+		g.TopK = override.TopK
+	}
+	if override.MaxOutputTokens != 0 {
+		g.MaxOutputTokens = override.MaxOutputTokens
+	}
+	if override.StopSequences != nil {
+		g.StopSequences = override.StopSequences
+	}
+	if len(override.Safety) > 0 {
+		safety := make(map[string]string, len(g.Safety)+len(override.Safety))
+		for category, threshold := range g.Safety {
+			safety[category] = threshold
+		}
+		for category, threshold := range override.Safety {
+			safety[category] = threshold
+		}
+		g.Safety = safety
+	}
+	return g
+}
+
+// validate checks g, naming it as where in errors.
+func (g *GenerationConfig) validate(where string) error {
+	if g == nil {
+		return nil
+	}
+	if t := g.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return fmt.Errorf("%s.temperature must be in [0, 2]", where)
+	}
+	if g.TopP < 0 || g.TopP > 1 {
+		return fmt.Errorf("%s.topP must be in [0, 1]", where)
+	}
+	if g.TopK < 0 || g.MaxOutputTokens < 0 {
+		return fmt.Errorf("%s.topK and %s.maxOutputTokens must not be negative", where, where)
+	}
+	for category, threshold := range g.Safety {
+		if _, ok := safetyCategories[category]; !ok {
+			return fmt.Errorf("%s.safety: unknown harm category %q, want harassment, hate-speech, sexually-explicit or dangerous-content", where, category)
+		}
+		if _, ok := safetyThresholds[threshold]; !ok {
+			return fmt.Errorf("%s.safety.%s must be low, medium, high or none, got %q", where, category, threshold)
+		}
+	}
+	return nil
+}
+
+// parseSafety parses SAFETY_SETTINGS, a comma-separated list of
+// category=threshold.
+func parseSafety(spec string) (map[string]string, error) {
+	safety := map[string]string{}
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		category, threshold, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not category=threshold", entry)
+		}
+		safety[strings.TrimSpace(category)] = strings.TrimSpace(threshold)
+	}
+	return safety, nil
+}
+
+// googleAISafety and vertexAISafety are g's safety settings for each SDK,
+// in category order. g has been validated.
+func (g GenerationConfig) googleAISafety() []*genai.SafetySetting {
+	var settings []*genai.SafetySetting
+	for _, category := range sortedKeys(g.Safety) {
+		settings = append(settings, &genai.SafetySetting{
+			Category:  safetyCategories[category].googleAI,
+			Threshold: safetyThresholds[g.Safety[category]].googleAI,
+		})
+	}
+	return settings
+}
+
+func (g GenerationConfig) vertexAISafety() []*vgenai.SafetySetting {
+	var settings []*vgenai.SafetySetting
+	for _, category := range sortedKeys(g.Safety) {
+		settings = append(settings, &vgenai.SafetySetting{
+			Category:  safetyCategories[category].vertexAI,
+			Threshold: safetyThresholds[g.Safety[category]].vertexAI,
+		})
+	}
+	return settings
+}
+
+type generationKey struct{}
+
+// withGeneration returns ctx carrying the generation settings that
+// override the configured ones for the model calls made with it, such as
+// the active persona's.
+func withGeneration(ctx context.Context, override *GenerationConfig) context.Context {
+	if override == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, generationKey{}, override)
+}
+
+// generationFrom is base with the override ctx carries, if any.
+func generationFrom(ctx context.Context, base GenerationConfig) GenerationConfig {
+	override, _ := ctx.Value(generationKey{}).(*GenerationConfig)
+	return base.with(override)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGenerationPersonaOverride(t *testing.T) {
+	var got []openAIChatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		got = append(got, req)
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Namaste!"}}]}`))
+	}))
+	defer srv.Close()
+
+	one, cold := 1.0, 0.2
+	base := GenerationConfig{Temperature: &one, TopP: 0.9, MaxOutputTokens: 200, Safety: map[string]string{"harassment": "low"}}
+	g := newOpenAIGenerator(BackendConfig{OpenAIBaseURL: srv.URL}, "gpt-4o-mini", base)
+	ctx := context.Background()
+	if _, err := g.Generate(ctx, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	persona := &GenerationConfig{Temperature: &cold, StopSequences: []string{"\n\n"}, Safety: map[string]string{"hate-speech": "high"}}
+	if _, err := g.Generate(withGeneration(ctx, persona), "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d requests, want 2", len(got))
+	}
+	if r := got[0]; r.Temperature == nil || *r.Temperature != 1 || r.TopP != 0.9 || r.MaxTokens != 200 || r.Stop != nil {
+		t.Errorf("request without a persona = %+v, want the configured parameters", r)
+	}
+	if r := got[1]; r.Temperature == nil || *r.Temperature != 0.2 || r.TopP != 0.9 || r.MaxTokens != 200 || len(r.Stop) != 1 {
+		t.Errorf("request with a persona = %+v, want its temperature and stop sequence over the rest", r)
+	}
+	merged := generationFrom(withGeneration(ctx, persona), base)
+	if len(merged.Safety) != 2 || merged.Safety["harassment"] != "low" || merged.Safety["hate-speech"] != "high" {
+		t.Errorf("merged safety = %v, want both categories", merged.Safety)
+	}
+	if settings := merged.googleAISafety(); len(settings) != 2 || settings[0].Category.String() != "HarmCategoryHarassment" {
+		t.Errorf("Google AI safety settings = %v", settings)
+	}
+	if base.Safety["hate-speech"] != "" {
+		t.Error("the persona's override changed the configured safety settings")
+	}
+}
+
+func TestGenerationConfigFromEnv(t *testing.T) {
+	t.Setenv("TEMPERATURE", "0.7")
+	t.Setenv("MAX_OUTPUT_TOKENS", "300")
+	t.Setenv("SAFETY_SETTINGS", "harassment=none, dangerous-content=medium")
+	var c Config
+	if err := c.applyEnv(); err != nil {
+		t.Fatal(err)
+	}
+	c.applyDefaults()
+	if c.Generation.Temperature == nil || *c.Generation.Temperature != 0.7 || c.Generation.MaxOutputTokens != 300 ||
+		c.Generation.Safety["harassment"] != "none" || c.Generation.Safety["dangerous-content"] != "medium" {
+		t.Errorf("generation = %+v", c.Generation)
+	}
+	if err := c.Generation.validate("generation"); err != nil {
+		t.Error(err)
+	}
+
+	c.Generation.Safety["violence"] = "low"
+	if err := c.Generation.validate("generation"); err == nil || !strings.Contains(err.Error(), "violence") {
+		t.Errorf("validate with an unknown category = %v", err)
+	}
+	hot := 3.0
+	p := Persona{Name: "shah", Prompt: "You're Shah Rukh.", Generation: &GenerationConfig{Temperature: &hot}}
+	if err := validatePersonas([]Persona{p}, "shah"); err == nil || !strings.Contains(err.Error(), "temperature") {
+		t.Errorf("validatePersonas with a hot persona = %v", err)
+	}
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	vgenai "cloud.google.com/go/vertexai/genai"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/plugins/ollama"
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// ResponseGenerator produces the model's text reply to a prompt. Every
+// model backend the host can run on implements it.
+type ResponseGenerator interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// streamingGenerator is a ResponseGenerator that can also report the reply
+// as it is generated: onText is called with the text so far after every
+// chunk.
+type streamingGenerator interface {
+	ResponseGenerator
+	GenerateStream(ctx context.Context, prompt string, onText func(partial string)) (string, error)
+}
+
+// generatorFunc adapts a function to ResponseGenerator.
+type generatorFunc func(ctx context.Context, prompt string) (string, error)
+
+func (f generatorFunc) Generate(ctx context.Context, prompt string) (string, error) {
+	return f(ctx, prompt)
+}
+
+// newGenerators initializes the configured backend and returns generators
+// for the main model, falling back along cfg.ModelChain, and the
+// degradation ladder's fallback model. Every call is made with
+// cfg.Generation, as overridden by its context; see withGeneration.
+func newGenerators(ctx context.Context, cfg *Config) (main, fallback ResponseGenerator, err error) {
+	backend := cfg.Backend
+	var newModel func(name string) ResponseGenerator
+	switch backend.Provider {
+	case "googleai":
+		// Gemini is called through its SDK rather than Genkit, whose
+		// plugins don't pass safety settings on.
+		apiKey := os.Getenv("GOOGLE_GENAI_API_KEY")
+		if apiKey == "" {
+			apiKey = os.Getenv("GOOGLE_API_KEY")
+		}
+		if apiKey == "" {
+			return nil, nil, errors.New("the googleai backend needs GOOGLE_GENAI_API_KEY or GOOGLE_API_KEY")
+		}
+		client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error initializing Google AI: %w", err)
+		}
+		newModel = func(name string) ResponseGenerator {
+			return googleAIGenerator{client: client, name: name, base: cfg.Generation}
+		}
+	case "vertexai":
+		project, location := backend.VertexProject, backend.VertexLocation
+		for _, env := range []string{"GCLOUD_PROJECT", "GOOGLE_CLOUD_PROJECT"} {
+			if project == "" {
+				project = os.Getenv(env)
+			}
+		}
+		if project == "" {
+			return nil, nil, errors.New("the vertexai backend needs VERTEX_PROJECT, PROJECT_ID or GOOGLE_CLOUD_PROJECT")
+		}
+		if location == "" {
+			location = "us-central1"
+		}
+		client, err := vgenai.NewClient(ctx, project, location, googleClientOptions(cfg)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error initializing Vertex AI: %w", err)
+		}
+		newModel = func(name string) ResponseGenerator {
+			return vertexAIGenerator{client: client, name: name, base: cfg.Generation}
+		}
+	case "ollama":
+		if err := ollama.Init(ctx, &ollama.Config{ServerAddress: backend.OllamaAddress}); err != nil {
+			return nil, nil, fmt.Errorf("error initializing Ollama: %w", err)
+		}
+		newModel = func(name string) ResponseGenerator {
+			model := ollama.Model(name)
+			if !ollama.IsDefinedModel(name) {
+				model = ollama.DefineModel(ollama.ModelDefinition{Name: name, Type: "chat"}, nil)
+			}
+			return genkitGenerator{model: model, base: cfg.Generation}
+		}
+	case "openai":
+		newModel = func(name string) ResponseGenerator {
+			return newOpenAIGenerator(backend, name, cfg.Generation)
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown model backend %q", backend.Provider)
+	}
+
+	var chain, cheap modelChain
+	for _, m := range append([]ChainModel{{Name: cfg.Model, Timeout: cfg.ModelTimeout}}, cfg.ModelChain...) {
+		chain = append(chain, chainLink{name: m.Name, timeout: m.Timeout.Duration, model: newModel(m.Name)})
+	}
+	cheap = modelChain{{name: cfg.Degradation.FallbackModel, timeout: cfg.ModelTimeout.Duration, model: newModel(cfg.Degradation.FallbackModel)}}
+	return chain, cheap, nil
+}
+
+// genkitGenerator adapts a Genkit model, for Ollama.
+type genkitGenerator struct {
+	model ai.Model
+	base  GenerationConfig
+}
+
+func (g genkitGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	return g.GenerateStream(ctx, prompt, nil)
+}
+
+func (g genkitGenerator) GenerateStream(ctx context.Context, prompt string, onText func(partial string)) (string, error) {
+	var cb ai.ModelStreamingCallback
+	if onText != nil {
+		var sofar strings.Builder
+		cb = func(ctx context.Context, chunk *ai.GenerateResponseChunk) error {
+			sofar.WriteString(chunk.Text())
+			onText(sofar.String())
+			return nil
+		}
+	}
+	gen := generationFrom(ctx, g.base)
+	config := &ai.GenerationCommonConfig{
+		MaxOutputTokens: gen.MaxOutputTokens,
+		StopSequences:   gen.StopSequences,
+		TopK:            gen.TopK,
+		TopP:            gen.TopP,
+	}
+	if gen.Temperature != nil {
+		config.Temperature = *gen.Temperature
+	}
+	resp, err := g.model.Generate(ctx, ai.NewGenerateRequest(config, ai.NewUserTextMessage(prompt)), cb)
+	if err == nil && len(resp.Candidates) > 0 && resp.Candidates[0].FinishReason == ai.FinishReasonBlocked {
+		return "", errSafetyBlocked
+	}
+	if err != nil {
+		return "", err
+	}
+	if resp.Usage != nil {
+		reportTokens(ctx, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+	}
+	return resp.Text(), nil
+}
+
+// googleAIGenerator calls a Gemini model through the Google AI SDK.
+type googleAIGenerator struct {
+	client *genai.Client
+	name   string
+	base   GenerationConfig
+}
+
+func (g googleAIGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	return g.GenerateStream(ctx, prompt, nil)
+}
+
+func (g googleAIGenerator) GenerateStream(ctx context.Context, prompt string, onText func(partial string)) (string, error) {
+	gen := generationFrom(ctx, g.base)
+	m := g.client.GenerativeModel(g.name)
+	if gen.Temperature != nil {
+		m.SetTemperature(float32(*gen.Temperature))
+	}
+	if gen.TopP != 0 {
+		m.SetTopP(float32(gen.TopP))
+	}
+	if gen.TopK != 0 {
+		m.SetTopK(int32(gen.TopK))
+	}
+	if gen.MaxOutputTokens != 0 {
+		m.SetMaxOutputTokens(int32(gen.MaxOutputTokens))
+	}
+	m.StopSequences = gen.StopSequences
+	m.SafetySettings = gen.googleAISafety()
+
+	var resp *genai.GenerateContentResponse
+	var err error
+	if onText == nil {
+		resp, err = m.GenerateContent(ctx, genai.Text(prompt))
+	} else {
+		var sofar strings.Builder
+		iter := m.GenerateContentStream(ctx, genai.Text(prompt))
+		for {
+			var chunk *genai.GenerateContentResponse
+			if chunk, err = iter.Next(); err != nil {
+				break
+			}
+			sofar.WriteString(googleAIText(chunk))
+			onText(sofar.String())
+		}
+		if err == iterator.Done {
+			resp, err = iter.MergedResponse(), nil
+		}
+	}
+	if blockedBySafety(err) {
+		return "", errSafetyBlocked
+	}
+	if err != nil {
+		return "", err
+	}
+	if u := resp.UsageMetadata; u != nil {
+		reportTokens(ctx, int(u.PromptTokenCount), int(u.CandidatesTokenCount))
+	}
+	return googleAIText(resp), nil
+}
+
+// googleAIText is the text of resp's first candidate.
+func googleAIText(resp *genai.GenerateContentResponse) string {
+	var text strings.Builder
+	if resp != nil && len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if t, ok := part.(genai.Text); ok {
+				text.WriteString(string(t))
+			}
+		}
+	}
+	return text.String()
+}
+
+// vertexAIGenerator calls a Gemini model through the Vertex AI SDK.
+type vertexAIGenerator struct {
+	client *vgenai.Client
+	name   string
+	base   GenerationConfig
+}
+
+func (g vertexAIGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	return g.GenerateStream(ctx, prompt, nil)
+}
+
+func (g vertexAIGenerator) GenerateStream(ctx context.Context, prompt string, onText func(partial string)) (string, error) {
+	gen := generationFrom(ctx, g.base)
+	m := g.client.GenerativeModel(g.name)
+	if gen.Temperature != nil {
+		m.SetTemperature(float32(*gen.Temperature))
+	}
+	if gen.TopP != 0 {
+		m.SetTopP(float32(gen.TopP))
+	}
+	if gen.TopK != 0 {
+		m.SetTopK(int32(gen.TopK))
+	}
+	if gen.MaxOutputTokens != 0 {
+		m.SetMaxOutputTokens(int32(gen.MaxOutputTokens))
+	}
+	m.StopSequences = gen.StopSequences
+	m.SafetySettings = gen.vertexAISafety()
+
+	var resp *vgenai.GenerateContentResponse
+	var err error
+	if onText == nil {
+		resp, err = m.GenerateContent(ctx, vgenai.Text(prompt))
+	} else {
+		var sofar strings.Builder
+		iter := m.GenerateContentStream(ctx, vgenai.Text(prompt))
+		for {
+			var chunk *vgenai.GenerateContentResponse
+			if chunk, err = iter.Next(); err != nil {
+				break
+			}
+			sofar.WriteString(vertexAIText(chunk))
+			onText(sofar.String())
+		}
+		if err == iterator.Done {
+			resp, err = iter.MergedResponse(), nil
+		}
+	}
+	if blockedBySafety(err) {
+		return "", errSafetyBlocked
+	}
+	if err != nil {
+		return "", err
+	}
+	if u := resp.UsageMetadata; u != nil {
+		reportTokens(ctx, int(u.PromptTokenCount), int(u.CandidatesTokenCount))
+	}
+	return vertexAIText(resp), nil
+}
+
+// vertexAIText is the text of resp's first candidate.
+func vertexAIText(resp *vgenai.GenerateContentResponse) string {
+	var text strings.Builder
+	if resp != nil && len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if t, ok := part.(vgenai.Text); ok {
+				text.WriteString(string(t))
+			}
+		}
+	}
+	return text.String()
+}
+
+// blockedBySafety reports whether err is Gemini refusing a prompt or reply
+// on safety grounds, from Google AI or Vertex AI.
+func blockedBySafety(err error) bool {
+	var gErr *genai.BlockedError
+	var vErr *vgenai.BlockedError
+	return errors.As(err, &gErr) || errors.As(err, &vErr)
+}
+
+// openAIGenerator calls the chat completions API of OpenAI or any
+// compatible server (vLLM, LM Studio, llama.cpp, ...).
+type openAIGenerator struct {
+	baseURL string
+	apiKey  string
+	model   string
+	base    GenerationConfig
+	client  *http.Client
+}
+
+func newOpenAIGenerator(backend BackendConfig, model string, base GenerationConfig) *openAIGenerator {
+	return &openAIGenerator{
+		baseURL: strings.TrimSuffix(backend.OpenAIBaseURL, "/"),
+		apiKey:  backend.OpenAIAPIKey,
+		model:   model,
+		base:    base,
+		client:  &http.Client{Timeout: time.Minute},
+	}
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChatRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	TopP        float64         `json:"top_p,omitempty"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	Stop        []string        `json:"stop,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		// Delta is set instead of Message on streamed chunks.
+		Delta openAIMessage `json:"delta"`
+	} `json:"choices"`
+	// Usage is only sent on replies that are not streamed.
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (g *openAIGenerator) Generate(ctx context.Context, prompt string) (string, error) {
+	return g.GenerateStream(ctx, prompt, nil)
+}
+
+// GenerateStream asks for a streamed completion when onText is set, read
+// as the server-sent "data: {chunk}" lines ending with "data: [DONE]".
+func (g *openAIGenerator) GenerateStream(ctx context.Context, prompt string, onText func(partial string)) (string, error) {
+	gen := generationFrom(ctx, g.base)
+	body, err := json.Marshal(openAIChatRequest{
+		Model:       g.model,
+		Messages:    []openAIMessage{{Role: "user", Content: prompt}},
+		Temperature: gen.Temperature,
+		TopP:        gen.TopP,
+		MaxTokens:   gen.MaxOutputTokens,
+		Stop:        gen.StopSequences,
+		Stream:      onText != nil,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("chat completions returned %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if onText != nil {
+		return readOpenAIStream(resp.Body, onText)
+	}
+
+	var out openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("error decoding chat completion: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return "", fmt.Errorf("chat completion had no choices")
+	}
+	reportTokens(ctx, out.Usage.PromptTokens, out.Usage.CompletionTokens)
+	return out.Choices[0].Message.Content, nil
+}
+
+func readOpenAIStream(r io.Reader, onText func(partial string)) (string, error) {
+	var sofar strings.Builder
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			return sofar.String(), nil
+		}
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("error decoding chat completion chunk: %w", err)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			sofar.WriteString(chunk.Choices[0].Delta.Content)
+			onText(sofar.String())
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return "", fmt.Errorf("error reading chat completion stream: %w", err)
+	}
+	return "", fmt.Errorf("chat completion stream ended early")
+}
+
+// extractJSON returns the outermost {...} in a reply, dropping the code
+// fences and chatter some models wrap JSON in.
+func extractJSON(text string) string {
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return text
+	}
+	return text[start : end+1]
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	vgenai "cloud.google.com/go/vertexai/genai"
+	"google.golang.org/api/option"
+)
+
+func TestOpenAIGenerator(t *testing.T) {
+	var got openAIChatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("request %s %s, want POST /v1/chat/completions", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer sk-test" {
+			t.Errorf("Authorization = %q, want the API key", auth)
+		}
+		got = openAIChatRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+			return
+		}
+		if got.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, part := range []string{"Namaste", ", devi", " aur sajjano!"} {
+				fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", part)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "Namaste!"}}], "usage": {"prompt_tokens": 12, "completion_tokens": 3}}`)
+	}))
+	defer srv.Close()
+
+	temperature := 0.7
+	g := newOpenAIGenerator(BackendConfig{OpenAIBaseURL: srv.URL + "/v1/", OpenAIAPIKey: "sk-test"}, "gpt-4o-mini", GenerationConfig{
+		Temperature:     &temperature,
+		TopP:            0.9,
+		MaxOutputTokens: 200,
+		StopSequences:   []string{"END"},
+	})
+	usage := &tokenUsage{}
+	ctx := context.WithValue(context.Background(), tokenUsageKey{}, usage)
+
+	text, err := g.Generate(ctx, "Greet the audience")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Namaste!" || usage.in != 12 || usage.out != 3 {
+		t.Errorf("Generate = %q with %d/%d tokens, want Namaste! with 12/3", text, usage.in, usage.out)
+	}
+	want := openAIChatRequest{Model: "gpt-4o-mini", Messages: []openAIMessage{{Role: "user", Content: "Greet the audience"}}, TopP: 0.9, MaxTokens: 200, Stop: []string{"END"}}
+	if got.Model != want.Model || !slices.Equal(got.Messages, want.Messages) || got.Temperature == nil || *got.Temperature != 0.7 ||
+		got.TopP != want.TopP || got.MaxTokens != want.MaxTokens || !slices.Equal(got.Stop, want.Stop) || got.Stream {
+		t.Errorf("request = %+v, want %+v at temperature 0.7", got, want)
+	}
+
+	// A persona's generation config overrides the base one.
+	hot := 1.5
+	var partials []string
+	text, err = g.GenerateStream(withGeneration(ctx, &GenerationConfig{Temperature: &hot}), "Greet the audience", func(partial string) {
+		partials = append(partials, partial)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Namaste, devi aur sajjano!" || len(partials) != 3 || partials[1] != "Namaste, devi" {
+		t.Errorf("GenerateStream = %q after partials %q, want the chunks joined", text, partials)
+	}
+	if !got.Stream || *got.Temperature != 1.5 {
+		t.Errorf("streamed request = %+v, want stream at temperature 1.5", got)
+	}
+}
+
+func TestOpenAIGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		stream  bool
+		wantErr string
+	}{
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+		}, false, "429: rate limited"},
+		{"no choices", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"choices": []}`)
+		}, false, "no choices"},
+		{"stream cut short", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {\"content\": \"Nam\"}}]}\n\n")
+		}, true, "ended early"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			g := newOpenAIGenerator(BackendConfig{OpenAIBaseURL: srv.URL}, "gpt-4o-mini", GenerationConfig{})
+			var onText func(string)
+			if tt.stream {
+				onText = func(string) {}
+			}
+			if _, err := g.GenerateStream(context.Background(), "hi", onText); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GenerateStream = %v, want an error mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestOllamaGenerator goes through newGenerators, as the Ollama plugin can
+// only be set up once per process.
+func TestOllamaGenerator(t *testing.T) {
+	var got struct {
+		Model    string
+		Messages []openAIMessage
+		Stream   bool
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("request for %s, want /api/chat", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+			return
+		}
+		if got.Stream {
+			for _, part := range []string{"Vanakkam", ", makkale!"} {
+				fmt.Fprintf(w, "{\"model\": \"llama3\", \"message\": {\"role\": \"assistant\", \"content\": %q}, \"done\": false}\n", part)
+			}
+			return
+		}
+		fmt.Fprint(w, `{"model": "llama3", "message": {"role": "assistant", "content": "Vanakkam!"}, "done": true}`)
+	}))
+	defer srv.Close()
+
+	var cfg Config
+	cfg.Backend.Provider, cfg.Backend.OllamaAddress = "ollama", srv.URL
+	cfg.applyDefaults()
+	model, _, err := newGenerators(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := model.Generate(context.Background(), "Greet the audience")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Vanakkam!" || got.Model != "llama3" || got.Stream || len(got.Messages) != 1 || got.Messages[0] != (openAIMessage{Role: "user", Content: "Greet the audience"}) {
+		t.Errorf("Generate = %q for request %+v, want Vanakkam! for the prompt as a user message to llama3", text, got)
+	}
+
+	var partials []string
+	text, err = model.(streamingGenerator).GenerateStream(context.Background(), "Greet the audience", func(partial string) {
+		partials = append(partials, partial)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Stream || text != "Vanakkam, makkale!" || !slices.Equal(partials, []string{"Vanakkam", "Vanakkam, makkale!"}) {
+		t.Errorf("GenerateStream = %q after partials %q, want the chunks joined", text, partials)
+	}
+}
+
+func TestVertexAIGenerator(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/projects/kbc/locations/us-central1/publishers/google/models/gemini-1.5-flash:generateContent") {
+			t.Errorf("request for %s, want generateContent of gemini-1.5-flash in kbc", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		got = nil
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(string(body), "insult") {
+			fmt.Fprint(w, `{"promptFeedback": {"blockReason": "SAFETY"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"candidates": [{"content": {"role": "model", "parts": [{"text": "Namaste, "}, {"text": "dost!"}]}, "finishReason": "STOP"}],
+			"usageMetadata": {"promptTokenCount": 9, "candidatesTokenCount": 4}}`)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	client, err := vgenai.NewClient(ctx, "kbc", "us-central1", vgenai.WithREST(), option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	temperature := 0.4
+	g := vertexAIGenerator{client: client, name: "gemini-1.5-flash", base: GenerationConfig{Temperature: &temperature, TopK: 20, StopSequences: []string{"END"}}}
+	usage := &tokenUsage{}
+
+	text, err := g.Generate(context.WithValue(ctx, tokenUsageKey{}, usage), "Greet the audience")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Namaste, dost!" || usage.in != 9 || usage.out != 4 {
+		t.Errorf("Generate = %q with %d/%d tokens, want Namaste, dost! with 9/4", text, usage.in, usage.out)
+	}
+	contents, _ := json.Marshal(got["contents"])
+	config, _ := json.Marshal(got["generationConfig"])
+	if !strings.Contains(string(contents), `"text":"Greet the audience"`) ||
+		!strings.Contains(string(config), `"temperature":0.4`) || !strings.Contains(string(config), `"topK":20`) || !strings.Contains(string(config), `"stopSequences":["END"]`) {
+		t.Errorf("request contents %s and config %s, want the prompt at temperature 0.4, topK 20, stopping at END", contents, config)
+	}
+
+	if _, err := g.Generate(ctx, "an insult"); !errors.Is(err, errSafetyBlocked) {
+		t.Errorf("Generate of a blocked prompt = %v, want %v", err, errSafetyBlocked)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds the Firestore check of /readyz, so a probe with
+// a short timeout gets an answer rather than hanging.
+const readinessTimeout = 2 * time.Second
+
+// Readiness is the payload served at /readyz. Checks maps each dependency
+// to "ok" or what is wrong with it.
+type Readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// readiness checks that Firestore answers and that the degradation ladder
+// still allows a model call. The model is judged from the outcomes of the
+// calls already made rather than called on every probe.
+func (b *Bot) readiness(ctx context.Context) Readiness {
+	r := Readiness{Ready: true, Checks: map[string]string{"firestore": "ok", "model": "ok"}}
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	if err := b.messages.Ping(ctx); err != nil {
+		r.Ready, r.Checks["firestore"] = false, err.Error()
+	}
+	if level := b.ladder.current(); level > levelCheapModel {
+		status := b.ladder.status()
+		r.Ready, r.Checks["model"] = false, fmt.Sprintf("degraded to %s: %s", status.Level, status.Reason)
+	}
+	return r
+}
+
+// healthHandler serves the probes, without auth: /healthz answers as long
+// as the process can serve requests, so an outage of Firestore or the model
+// doesn't get it restarted, and /readyz answers 503 while either is
+// unavailable.
+func (b *Bot) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "uptime": time.Since(b.health.startedAt).Round(time.Second).String()})
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		ready := b.readiness(r.Context())
+		status := http.StatusOK
+		if !ready.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, ready)
+	})
+	return mux
+}
+
+// serveHealth serves healthHandler on cfg.HealthAddr.
+func (b *Bot) serveHealth(ctx context.Context) error {
+	srv := &http.Server{Addr: b.cfg.HealthAddr, Handler: b.healthHandler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
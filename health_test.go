@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// unreachableStore is a memoryStore whose backend can't be reached.
+type unreachableStore struct{ *memoryStore }
+
+func (unreachableStore) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestHealthProbes(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(nil))
+	srv := httptest.NewServer(b.healthHandler())
+	defer srv.Close()
+
+	probe := func(path string) (int, Readiness) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var r Readiness
+		json.NewDecoder(resp.Body).Decode(&r)
+		return resp.StatusCode, r
+	}
+
+	if code, _ := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want 200", code)
+	}
+	if code, r := probe("/readyz"); code != http.StatusOK || !r.Ready {
+		t.Errorf("GET /readyz = %d %+v, want ready", code, r)
+	}
+
+	b.messages = unreachableStore{store}
+	quota := status.Error(codes.ResourceExhausted, "quota")
+	b.ladder.record(quota, 0)
+	b.ladder.record(quota, 0)
+	code, r := probe("/readyz")
+	if code != http.StatusServiceUnavailable || r.Ready || r.Checks["firestore"] != "connection refused" || r.Checks["model"] == "ok" {
+		t.Errorf("GET /readyz = %d %+v, want Firestore and the model reported unavailable", code, r)
+	}
+	if code, _ := probe("/healthz"); code != http.StatusOK {
+		t.Errorf("GET /healthz = %d during an outage, want 200", code)
+	}
+}
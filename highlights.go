@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// HighlightExchange is one audience message paired with the host's reply.
+type HighlightExchange struct {
+	MessageID  string    `firestore:"messageId"`
+	Question   string    `firestore:"question"`
+	AskedAt    time.Time `firestore:"askedAt"`
+	Response   string    `firestore:"response"`
+	AnsweredAt time.Time `firestore:"answeredAt"`
+	Reactions  int       `firestore:"reactions"`
+	FollowUps  int       `firestore:"followUps"`
+	Score      int       `firestore:"score"`
+}
+
+type Highlights struct {
+	Exchanges   []HighlightExchange `firestore:"exchanges"`
+	Transcript  string              `firestore:"transcript"`
+	Since       time.Time           `firestore:"since"`
+	GeneratedAt time.Time           `firestore:"generatedAt"`
+}
+
+// defaultHighlightCount is how many exchanges a reel keeps unless -n says otherwise.
+const defaultHighlightCount = 10
+
+// runHighlights implements the "highlights" command, for a reel covering a
+// different window than the one published automatically when a quiz ends.
+func runHighlights(ctx context.Context, w io.Writer, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("highlights", flag.ContinueOnError)
+	n := fs.Int("n", defaultHighlightCount, "number of exchanges to include")
+	since := fs.Duration("since", 3*time.Hour, "how far back the session started")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := newFirestoreClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	h, docID, err := publishHighlights(ctx, client, cfg.Collections, clock.Now().Add(-*since), *n)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Highlights written to %s/%s\n%s", cfg.Collections.Highlights, docID, h.Transcript)
+	return nil
+}
+
+// publishHighlights builds the reel for everything since the given time and
+// writes it to the highlights collection under a timestamp ID.
+func publishHighlights(ctx context.Context, client *firestore.Client, cols Collections, since time.Time, n int) (*Highlights, string, error) {
+	h, err := buildHighlights(ctx, client, cols.User, cols.Ping, since, n)
+	if err != nil {
+		return nil, "", err
+	}
+	docID := h.GeneratedAt.Format("20060102-150405")
+	if _, err := client.Collection(cols.Highlights).Doc(docID).Set(ctx, h); err != nil {
+		return nil, "", fmt.Errorf("error writing highlights: %w", err)
+	}
+	return h, docID, nil
+}
+
+// publishHighlightReel publishes the reel for everything since the last
+// one at the end of a show segment, named by after. Only the monitor calls
+// it. What ended is already recorded, so a failure here is only logged;
+// the command can still build the reel by hand. A bot without a Firestore
+// client, as in the in-memory tests, has nothing to build it from.
+func (b *Bot) publishHighlightReel(ctx context.Context, after string) {
+	if b.client == nil {
+		return
+	}
+	h, docID, err := publishHighlights(ctx, b.client, b.cfg.Collections, b.highlightsSince, defaultHighlightCount)
+	if err != nil {
+		slog.Error("error publishing highlights", "after", after, "err", err)
+		return
+	}
+	slog.Info("highlights written", "after", after, "collection", b.cfg.Collections.Highlights, "doc", docID)
+	b.highlightsSince = h.GeneratedAt
+}
+
+// buildHighlights ranks every answered message since the given time by
+// engagement (reactions on the host reply plus audience follow-ups to it)
+// and keeps the top n, in chronological order.
+func buildHighlights(ctx context.Context, client *firestore.Client, userCollection, pingCollection string, since time.Time, n int) (*Highlights, error) {
+	followUps := map[string]int{}
+	iter := client.Collection(userCollection).Where("timestamp", ">=", since).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through user messages: %w", err)
+		}
+
+		var msg Message
+		if err := doc.DataTo(&msg); err != nil {
+			return nil, fmt.Errorf("error converting document to message: %w", err)
+		}
+		if msg.ReplyTo != "" {
+			followUps[msg.ReplyTo]++
+		}
+	}
+
+	answered, err := answeredMessages(ctx, client, userCollection, pingCollection, since)
+	if err != nil {
+		return nil, err
+	}
+
+	exchanges := rankHighlights(answered, followUps, n)
+	return &Highlights{
+		Exchanges:   exchanges,
+		Transcript:  formatTranscript(exchanges),
+		Since:       since,
+		GeneratedAt: clock.Now(),
+	}, nil
+}
+
+// rankHighlights scores each answered message by the reactions on its reply
+// plus two for every follow-up to it, and returns the top n in the order
+// they were asked.
+func rankHighlights(answered []answeredMessage, followUps map[string]int, n int) []HighlightExchange {
+	var exchanges []HighlightExchange
+	for _, a := range answered {
+		reactions := 0
+		for _, count := range a.Response.Reactions {
+			reactions += count
+		}
+		exchanges = append(exchanges, HighlightExchange{
+			MessageID:  a.ID,
+			Question:   a.Question.Message,
+			AskedAt:    a.Question.Timestamp,
+			Response:   a.Response.Message,
+			AnsweredAt: a.Response.Timestamp,
+			Reactions:  reactions,
+			FollowUps:  followUps[a.ID],
+			Score:      reactions + 2*followUps[a.ID],
+		})
+	}
+
+	sort.SliceStable(exchanges, func(i, j int) bool { return exchanges[i].Score > exchanges[j].Score })
+	if len(exchanges) > n {
+		exchanges = exchanges[:n]
+	}
+	sort.SliceStable(exchanges, func(i, j int) bool { return exchanges[i].AskedAt.Before(exchanges[j].AskedAt) })
+	return exchanges
+}
+
+func formatTranscript(exchanges []HighlightExchange) string {
+	var b strings.Builder
+	for _, ex := range exchanges {
+		fmt.Fprintf(&b, "[%s] Audience: %s\n", ex.AskedAt.Format("15:04:05"), ex.Question)
+		fmt.Fprintf(&b, "[%s] Host: %s\n\n", ex.AnsweredAt.Format("15:04:05"), strings.TrimSpace(ex.Response))
+	}
+	return b.String()
+}
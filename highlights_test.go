@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRankHighlights(t *testing.T) {
+	t0 := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	exchange := func(id string, asked int, reactions map[string]int) answeredMessage {
+		at := t0.Add(time.Duration(asked) * time.Minute)
+		return answeredMessage{
+			ID:       id,
+			Question: Message{Message: "Question " + id, Timestamp: at},
+			Response: Message{Message: " Answer " + id + "\n", Timestamp: at.Add(10 * time.Second), Reactions: reactions},
+		}
+	}
+	answered := []answeredMessage{
+		exchange("quiet", 0, nil),
+		exchange("loved", 1, map[string]int{"👍": 2, "🔥": 1}),
+		exchange("debated", 2, map[string]int{"👍": 1}),
+		exchange("meh", 3, map[string]int{"👎": 1}),
+	}
+	// Two follow-ups outweigh three reactions.
+	followUps := map[string]int{"debated": 2, "quiet": 1}
+
+	got := rankHighlights(answered, followUps, 3)
+	var ids []string
+	for _, ex := range got {
+		ids = append(ids, ex.MessageID)
+	}
+	if strings.Join(ids, ",") != "quiet,loved,debated" {
+		t.Fatalf("highlights = %v, want the top 3 in the order asked: quiet, loved, debated", ids)
+	}
+	if ex := got[2]; ex.Reactions != 1 || ex.FollowUps != 2 || ex.Score != 5 {
+		t.Errorf("debated = %d reactions, %d follow-ups, score %d, want 1, 2 and 5", ex.Reactions, ex.FollowUps, ex.Score)
+	}
+	if got[1].Score != 3 || got[0].Score != 2 {
+		t.Errorf("scores of loved and quiet = %d and %d, want 3 and 2", got[1].Score, got[0].Score)
+	}
+
+	want := "[10:00:00] Audience: Question quiet\n[10:00:10] Host: Answer quiet\n\n"
+	if transcript := formatTranscript(got); !strings.HasPrefix(transcript, want) || strings.Count(transcript, "Audience:") != 3 {
+		t.Errorf("transcript = %q, want it to start with %q and hold 3 exchanges", transcript, want)
+	}
+}
+
+func TestEmulatorPublishHighlights(t *testing.T) {
+	b := newEmulatorBot(t, generatorFunc(nil))
+	ctx := context.Background()
+	now := time.Now()
+	cols := b.cfg.Collections
+	write := func(collection, id string, m Message) {
+		t.Helper()
+		if _, err := b.client.Collection(collection).Doc(id).Set(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(cols.User, "old", Message{Message: "Before the window", Timestamp: now.Add(-2 * time.Hour)})
+	write(cols.Ping, "old", Message{Message: "Old answer", Timestamp: now.Add(-2 * time.Hour), Reactions: map[string]int{"👍": 9}})
+	write(cols.User, "q1", Message{Message: "What is Gemini?", Timestamp: now.Add(-time.Minute)})
+	write(cols.Ping, "q1", Message{Message: "A family of models.", Timestamp: now.Add(-50 * time.Second), Reactions: map[string]int{"👍": 1}})
+	write(cols.User, "q2", Message{Message: "Is it free?", Timestamp: now.Add(-40 * time.Second)})
+	write(cols.Ping, "q2", Message{Message: "There is a free tier.", Timestamp: now.Add(-30 * time.Second)})
+	write(cols.User, "f1", Message{Message: "How free?", ReplyTo: "q2", Timestamp: now.Add(-20 * time.Second)})
+	write(cols.Ping, "prompt", Message{Message: "Any questions?", Timestamp: now.Add(-10 * time.Second)})
+
+	h, docID, err := publishHighlights(ctx, b.client, cols, now.Add(-time.Hour), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Exchanges) != 1 || h.Exchanges[0].MessageID != "q2" || h.Exchanges[0].FollowUps != 1 {
+		t.Fatalf("highlights = %+v, want only q2 with its follow-up", h.Exchanges)
+	}
+	snap, err := b.client.Collection(cols.Highlights).Doc(docID).Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Highlights
+	if err := snap.DataTo(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Transcript != h.Transcript || len(stored.Exchanges) != 1 {
+		t.Errorf("stored highlights = %+v, want the reel returned", stored)
+	}
+}
+
+func TestEmulatorSessionClosePublishesHighlights(t *testing.T) {
+	b := newEmulatorBot(t, generatorFunc(nil))
+	ctx := context.Background()
+	now := time.Now()
+	cols := b.cfg.Collections
+	if _, err := b.client.Collection(cols.User).Doc("q1").Set(ctx, Message{Message: "What is Gemini?", Timestamp: now}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.client.Collection(cols.Ping).Doc("q1").Set(ctx, Message{Message: "A family of models.", Timestamp: now.Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.schedules.SaveSchedule(ctx, SessionSchedule{StartsAt: now.Add(-time.Hour), EndsAt: now.Add(-time.Second), Welcomed: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.refreshSchedule(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got := b.sessionAnnouncements(clock.Now())
+	if len(got) != 1 || got[0].Kind != "session-closing" {
+		t.Fatalf("announcements = %+v, want the goodbye", got)
+	}
+	since := b.highlightsSince
+	if err := got[0].Done(ctx); err != nil {
+		t.Fatal(err)
+	}
+	docs, err := b.client.Collection(cols.Highlights).Documents(ctx).GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("%d highlights documents after closing, want 1", len(docs))
+	}
+	var h Highlights
+	if err := docs[0].DataTo(&h); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Exchanges) != 1 || h.Exchanges[0].MessageID != "q1" || !h.Since.Equal(since.Truncate(time.Microsecond)) {
+		t.Errorf("highlights = %+v, want q1 since the bot started", h)
+	}
+	// Firestore keeps timestamps to the microsecond.
+	if !b.highlightsSince.Truncate(time.Microsecond).Equal(h.GeneratedAt) {
+		t.Errorf("next reel starts at %v, want %v", b.highlightsSince, h.GeneratedAt)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// How far one idle prompt moves the gap to the next: out when the audience
+// ignored it, back in when it got them talking.
+const (
+	idleGapSlowdown = 1.5
+	idleGapSpeedup  = 0.75
+)
+
+// idleTuner watches whether idle prompts get the audience talking. Only the
+// monitor goroutine touches it.
+type idleTuner struct {
+	// pending is when the last idle prompt went out, zero once its outcome
+	// has been counted.
+	pending time.Time
+}
+
+// promptSent records an idle prompt going out at now. A prompt still
+// pending then went unanswered until the host had to prompt again.
+func (b *Bot) promptSent(now time.Time) {
+	if b.cfg.Monitor.PromptReplyWindow.Duration <= 0 {
+		return
+	}
+	if !b.idleTuner.pending.IsZero() {
+		b.tuneIdlePromptGap(false)
+	}
+	b.idleTuner.pending = now
+}
+
+// observeIdlePrompt counts the pending idle prompt as answered once a
+// message arrives after it, or as ignored once monitor.promptReplyWindow
+// passes without one. The monitor calls it every tick.
+func (b *Bot) observeIdlePrompt(now, lastUserMessage time.Time) {
+	sent := b.idleTuner.pending
+	switch {
+	case sent.IsZero():
+	case lastUserMessage.After(sent):
+		b.tuneIdlePromptGap(true)
+	case now.Sub(sent) >= b.cfg.Monitor.PromptReplyWindow.Duration:
+		b.tuneIdlePromptGap(false)
+	}
+}
+
+// tuneIdlePromptGap lengthens the idle prompt gap after an ignored prompt
+// and shortens it after an answered one, within monitor.idlePromptGapMin
+// and idlePromptGapMax, unless auto-tuning is off in the stage controls.
+func (b *Bot) tuneIdlePromptGap(answered bool) {
+	b.idleTuner.pending = time.Time{}
+	factor := idleGapSlowdown
+	if answered {
+		factor = idleGapSpeedup
+		b.health.idlePromptsAnswered.Add(1)
+	} else {
+		b.health.idlePromptsIgnored.Add(1)
+	}
+	for {
+		prev := b.room.controls.Load()
+		if !prev.AutoTune {
+			return
+		}
+		gap := time.Duration(float64(prev.IdlePromptGap.Duration) * factor).Round(time.Second)
+		gap = min(max(gap, b.cfg.Monitor.IdlePromptGapMin.Duration), b.cfg.Monitor.IdlePromptGapMax.Duration)
+		if gap == prev.IdlePromptGap.Duration {
+			return
+		}
+		next := *prev
+		next.IdlePromptGap = Duration{gap}
+		if b.room.controls.CompareAndSwap(prev, &next) {
+			slog.Info("idle prompt gap changed", "gap", gap)
+			b.bus.Publish(Event{Kind: EventStateChanged, State: "idle-prompt-gap", From: prev.IdlePromptGap.String(), To: next.IdlePromptGap.String()})
+			return
+		}
+	}
+}
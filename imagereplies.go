@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode"
+)
+
+// drawingQueueSize is how many image replies can wait to be drawn; more
+// are dropped, as the image generator is far slower than the audience.
+const drawingQueueSize = 16
+
+// ImageRepliesConfig has the host answer with a picture too when an
+// audience message asks for one: a message with one of Triggers, such as
+// "poster" or "meme", gets its reply as usual, and then an image drawn by
+// polls.imageGeneratorUrl, uploaded to polls.imageBucket and set on the
+// reply as imageUrl.
+type ImageRepliesConfig struct {
+	Triggers []string `json:"triggers" yaml:"triggers"`
+}
+
+// drawing is a public reply waiting for its image: what was asked for
+// (the trigger) and what the audience message said.
+type drawing struct {
+	replyID string
+	trigger string
+	message string
+}
+
+// imageTrigger returns the first of triggers that text has as a word, or
+// its plural, or "" if none.
+func imageTrigger(text string, triggers []string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, trigger := range triggers {
+		for _, w := range words {
+			if w == trigger || w == trigger+"s" {
+				return trigger
+			}
+		}
+	}
+	return ""
+}
+
+// drawingPrompt is what the image generator is asked to draw for d.
+func drawingPrompt(d drawing) string {
+	return fmt.Sprintf("A %s for the audience of a live tech event, about: %s", d.trigger, d.message)
+}
+
+// queueDrawing has the reply to msg drawn if msg asks for a picture. It
+// never blocks: with the queue full the drawing is dropped and the reply
+// keeps its text only.
+func (b *Bot) queueDrawing(msg *Message, replyID string) {
+	if b.drawings == nil {
+		return
+	}
+	trigger := imageTrigger(msg.Message, b.cfg.ImageReplies.Triggers)
+	if trigger == "" {
+		return
+	}
+	select {
+	case b.drawings <- drawing{replyID: replyID, trigger: trigger, message: msg.Message}:
+	default:
+		b.metrics.imageReplies.inc("dropped")
+	}
+}
+
+// drawReplies draws the image of every queued reply and stores its URL on
+// the reply. Replies are drawn after they are published, so the image
+// generator never holds up the text.
+func (b *Bot) drawReplies(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d := <-b.drawings:
+			if err := b.drawReply(ctx, d); err != nil {
+				b.metrics.imageReplies.inc("failed")
+				slog.Error("error drawing reply image", "messageId", d.replyID, "err", err)
+				continue
+			}
+			b.metrics.imageReplies.inc("drawn")
+		}
+	}
+}
+
+// drawReply has the image generator draw d, uploads the image and sets
+// its URL on the reply.
+func (b *Bot) drawReply(ctx context.Context, d drawing) error {
+	data, contentType, err := b.imageGen.generate(ctx, drawingPrompt(d))
+	if err != nil {
+		return fmt.Errorf("error generating image: %w", err)
+	}
+	mediaType, ext, err := optionImageType(contentType)
+	if err != nil {
+		return err
+	}
+	imageURL, err := b.images.PutImage(ctx, fmt.Sprintf("replies/%s%s", d.replyID, ext), mediaType, data)
+	if err != nil {
+		return fmt.Errorf("error uploading image: %w", err)
+	}
+	return b.write(ctx, "set-reply-image", func(ctx context.Context) error {
+		return b.messages.SetReplyImage(ctx, d.replyID, imageURL)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestImageTrigger(t *testing.T) {
+	triggers := []string{"poster", "meme"}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Make a poster of the keynote!", "poster"},
+		{"MEMES please", "meme"},
+		{"meme-worthy talk", "meme"},
+		{"Who is postering the hallway?", ""},
+		{"what is gemini?", ""},
+	}
+	for _, tt := range tests {
+		if got := imageTrigger(tt.text, triggers); got != tt.want {
+			t.Errorf("imageTrigger(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestImageReplies(t *testing.T) {
+	var mu sync.Mutex
+	var prompts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Prompt string `json:"prompt"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		prompts = append(prompts, body.Prompt)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("PNG"))
+	}))
+	defer srv.Close()
+
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "Here you go!", nil
+	}))
+	b.cfg.ImageReplies.Triggers = []string{"poster", "meme"}
+	b.imageGen, b.images = newImageGenerator(srv.URL), store
+	b.drawings = make(chan drawing, drawingQueueSize)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 2)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	go func() { done <- b.drawReplies(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+		<-done
+	}()
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "Make a meme about Gemini", Timestamp: time.Now()})
+	store.AddMessage(Message{ID: "m2", UserID: "bob", Message: "What is Gemini?", Timestamp: time.Now()})
+	waitFor(t, nil, "the meme to be drawn", func() bool {
+		m2, _ := store.Message("m2")
+		return b.metrics.imageReplies.snapshot()["drawn"] == 1 && m2.Processed
+	})
+
+	r1, _ := store.Reply("m1")
+	if r1.Message != "Here you go!" || r1.ImageURL == "" {
+		t.Errorf("reply to the meme request = %+v, want its text and an image URL", r1)
+	}
+	if image, ok := store.Image("replies/m1.png"); !ok || string(image) != "PNG" {
+		t.Errorf("replies/m1.png = %q, %v, want the drawn image", image, ok)
+	}
+	if r2, _ := store.Reply("m2"); r2.ImageURL != "" {
+		t.Errorf("reply that asked for no picture has image URL %q", r2.ImageURL)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(prompts) != 1 || prompts[0] != "A meme for the audience of a live tech event, about: Make a meme about Gemini" {
+		t.Errorf("image prompts = %q, want one for the meme", prompts)
+	}
+}
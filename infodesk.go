@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// defaultInfoDeskLine is what the host says instead of guessing.
+const defaultInfoDeskLine = "That one's best answered by the registration desk, they'll have the latest details for you!"
+
+// defaultEventKeywords mark questions about the event itself, which only
+// the FAQ can answer reliably.
+var defaultEventKeywords = []string{
+	"venue", "wifi", "wi-fi", "password", "lunch", "dinner", "snacks", "food", "schedule", "agenda",
+	"parking", "registration", "certificate", "swag", "goodies", "badge", "washroom", "restroom",
+	"toilet", "hall", "room", "track", "slides", "recording", "refund", "ticket",
+}
+
+// abstainPhrases mark replies where the model admits it doesn't know, or
+// hedges its way around the question.
+var abstainPhrases = []string{
+	"i don't know", "i do not know", "i'm not sure", "i am not sure", "not aware of",
+	"no information", "don't have information", "don't have details", "cannot say",
+	"can't say", "unable to answer", "i couldn't tell", "no idea",
+}
+
+// KnowledgeGap records a question the host routed to the info desk, so the
+// FAQ can be filled in.
+type KnowledgeGap struct {
+	MessageID string    `firestore:"messageId"`
+	Question  string    `firestore:"question"`
+	Reason    string    `firestore:"reason"`
+	Room      string    `firestore:"room,omitempty"`
+	At        time.Time `firestore:"at"`
+}
+
+// groundQuestion adds the FAQ answer for text, if there is one, to the
+// prompt context, and reports whether there was.
+func (b *Bot) groundQuestion(promptContext, text string) (string, bool) {
+	fact, ok := b.ladder.faqAnswer(text)
+	if !ok {
+		return promptContext, false
+	}
+	return fmt.Sprintf("%s\nFrom the event FAQ, use this and nothing else for event details: %s", promptContext, fact), true
+}
+
+// gapReason returns why answer should go to the info desk instead, or ""
+// if it can stand: the model abstained, or it answered a question about
+// the event that the FAQ doesn't cover, and so was guessing.
+func (b *Bot) gapReason(question, answer string, grounded bool) string {
+	lower := strings.ToLower(answer)
+	for _, p := range abstainPhrases {
+		if strings.Contains(lower, p) {
+			return "the host didn't know"
+		}
+	}
+	if grounded {
+		return ""
+	}
+	keywords := b.cfg.InfoDesk.Keywords
+	if len(keywords) == 0 {
+		keywords = defaultEventKeywords
+	}
+	for _, w := range splitWords(question) {
+		for _, k := range keywords {
+			if w == k {
+				return fmt.Sprintf("event question about %q not in the FAQ", k)
+			}
+		}
+	}
+	return ""
+}
+
+// infoDeskLine is the routing message that replaces a guess.
+func (b *Bot) infoDeskLine() string {
+	if b.cfg.InfoDesk.Message != "" {
+		return b.cfg.InfoDesk.Message
+	}
+	return defaultInfoDeskLine
+}
+
+// recordKnowledgeGaps writes every knowledge gap from the bus to
+// Firestore. A failed write is logged and the gap dropped.
+func (b *Bot) recordKnowledgeGaps(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-b.gaps:
+			gap := KnowledgeGap{MessageID: e.MessageID, Question: e.Text, Reason: e.Reason, Room: b.cfg.Room, At: e.At}
+			if _, err := b.client.Collection(b.cfg.Collections.KnowledgeGaps).Doc(newID("gap")).Set(ctx, gap); err != nil {
+				slog.Error("error recording knowledge gap", "messageId", e.MessageID, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestGapReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		keywords []string
+		question string
+		answer   string
+		grounded bool
+		want     bool
+	}{
+		{"general question", nil, "what is gemini?", "Gemini is a family of models, dost!", false, false},
+		{"event question without faq", nil, "where is lunch served?", "Lunch is on the third floor!", false, true},
+		{"event question with faq", nil, "where is lunch served?", "Lunch is in hall B!", true, false},
+		{"model abstains", nil, "who won the hackathon?", "I'm not sure about that one, dost.", false, true},
+		{"model abstains despite faq", nil, "what is the wifi password?", "I don't know the password.", true, true},
+		{"custom keywords", []string{"hackathon"}, "when does the hackathon start?", "At noon!", false, true},
+		{"custom keywords replace defaults", []string{"hackathon"}, "where is lunch?", "Third floor!", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bot{cfg: &Config{InfoDesk: InfoDeskConfig{Keywords: tt.keywords}}}
+			if got := b.gapReason(tt.question, tt.answer, tt.grounded); (got != "") != tt.want {
+				t.Errorf("gapReason = %q, want a gap: %v", got, tt.want)
+			}
+		})
+	}
+}
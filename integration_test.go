@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// These tests run the bot against the Firestore emulator, e.g.
+//
+//	gcloud emulators firestore start --host-port=localhost:8080
+//	FIRESTORE_EMULATOR_HOST=localhost:8080 go test -run Emulator ./...
+//
+// and are skipped when FIRESTORE_EMULATOR_HOST isn't set.
+
+// newEmulatorBot returns a bot on default config backed by the Firestore
+// emulator and answering with model. Its collections are prefixed with the
+// test's name and start time, so tests don't see each other's documents.
+func newEmulatorBot(t *testing.T, model ResponseGenerator) *Bot {
+	t.Helper()
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	var cfg Config
+	cfg.Collections.Prefix = fmt.Sprintf("%s-%d", strings.ToLower(t.Name()), time.Now().UnixNano())
+	cfg.Monitor.TickInterval = Duration{50 * time.Millisecond}
+	cfg.applyDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	client, err := newFirestoreClient(context.Background(), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	b, err := NewBot(&cfg, client, model, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestEmulatorMarksExistingMessages(t *testing.T) {
+	b := newEmulatorBot(t, generatorFunc(nil))
+	ctx := context.Background()
+	for _, id := range []string{"old1", "old2"} {
+		if err := b.messages.Submit(ctx, Message{ID: id, UserID: "ann", Message: "hello from before the show", Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.markExistingMessagesAsProcessed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	left, err := b.messages.Unprocessed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("%d messages left unprocessed, want none", len(left))
+	}
+	for _, id := range []string{"old1", "old2"} {
+		if _, found, _ := b.messages.FindReply(ctx, id); found {
+			t.Errorf("%s was answered", id)
+		}
+	}
+}
+
+func TestEmulatorListenerAnswersNewMessages(t *testing.T) {
+	b := newEmulatorBot(t, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "Rephrase") {
+			return `"What is Gemini, exactly?"`, nil
+		}
+		return "Namaste, devi aur sajjano!", nil
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := b.messages.Submit(ctx, Message{ID: "old", UserID: "ann", Message: "hello from before the show", Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.markExistingMessagesAsProcessed(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	if err := b.messages.Submit(ctx, Message{ID: "m1", UserID: "bob", Message: "What is Gemini?", Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var reply *Message
+	waitFor(t, done, "a reply to m1", func() bool {
+		reply, _, _ = b.messages.FindReply(ctx, "m1")
+		return reply != nil
+	})
+	if reply.Message != "Namaste, devi aur sajjano!" || reply.InReplyTo != "m1" || reply.RecipientID != "bob" {
+		t.Errorf("reply = %+v, want the model's answer to bob", reply)
+	}
+	waitFor(t, done, "m1 to be marked processed", func() bool {
+		left, err := b.messages.Unprocessed(ctx)
+		return err == nil && len(left) == 0
+	})
+	if _, found, _ := b.messages.FindReply(ctx, "old"); found {
+		t.Error("the message from before the show was answered")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("listener returned %v after cancel", err)
+	}
+}
+
+func TestEmulatorMonitorAnnouncesPollResults(t *testing.T) {
+	b := newEmulatorBot(t, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "And the winner is chai!", nil
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	if err := b.polls.SavePoll(ctx, "q1", PollQuestion{Question: "Chai or coffee?", Closed: true, Options: map[string]PollOption{
+		"A": {Label: "A", OpText: "Chai", Voters: []string{"ann", "bob"}},
+		"B": {Label: "B", OpText: "Coffee", Voters: []string{"cat"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- b.monitorAndRespond(ctx) }()
+	waitFor(t, done, "the results to be announced", func() bool {
+		poll, err := b.polls.Poll(ctx, "q1")
+		return err == nil && poll.ResultsAnnounced
+	})
+	replies, err := b.messages.RecentReplies(ctx, start, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var announced bool
+	for _, r := range replies {
+		announced = announced || r.Message == "And the winner is chai!" && strings.Contains(r.Context, "The winner is A - Chai")
+	}
+	if !announced {
+		t.Errorf("replies = %+v, want the poll results announced", replies)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("monitor returned %v after cancel", err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// LanguageConfig picks the language the host replies in. An audience
+// message in one of Allowed is answered in that language; anything else,
+// and every host prompt, is answered in the session's language: the
+// schedule's, if set, or Default. Bilingual, two languages, overrides
+// them all: every generated host message is written in both, in one model
+// call, and published as a pair of pings; see bilingual.go.
+type LanguageConfig struct {
+	Default   string   `json:"default" yaml:"default"`
+	Allowed   []string `json:"allowed" yaml:"allowed"`
+	Bilingual []string `json:"bilingual" yaml:"bilingual"`
+}
+
+// languages are the languages replies can be written in, by name, with
+// how the prompt asks for each.
+var languages = map[string]string{
+	"english":   "English",
+	"hindi":     "Hindi, in Devanagari script",
+	"marathi":   "Marathi, in Devanagari script",
+	"hinglish":  "Hinglish, Hindi and English mixed and written in the Latin alphabet, the way the audience writes it",
+	"tamil":     "Tamil, in Tamil script",
+	"telugu":    "Telugu, in Telugu script",
+	"kannada":   "Kannada, in Kannada script",
+	"malayalam": "Malayalam, in Malayalam script",
+	"bengali":   "Bengali, in Bengali script",
+	"gujarati":  "Gujarati, in Gujarati script",
+	"punjabi":   "Punjabi, in Gurmukhi script",
+}
+
+// scriptLanguages maps the scripts of Indian languages written in a
+// script of their own to the language. Devanagari is told apart by
+// words, in devanagariLanguage.
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Tamil, "tamil"},
+	{unicode.Telugu, "telugu"},
+	{unicode.Kannada, "kannada"},
+	{unicode.Malayalam, "malayalam"},
+	{unicode.Bengali, "bengali"},
+	{unicode.Gujarati, "gujarati"},
+	{unicode.Gurmukhi, "punjabi"},
+}
+
+// marathiWords and hindiWords are common words of one language that the
+// other doesn't use, to tell them apart in Devanagari.
+var (
+	marathiWords = wordSet("आहे आहेत नाही काय मला मी तुम्ही आणि होते होता केले कसे कसा आम्ही तुमचा माझा माझे आपण झाले")
+	hindiWords   = wordSet("है हैं नहीं क्या मुझे मैं आप और था थी किया कैसे कैसा हम आपका मेरा मेरे में हुआ")
+)
+
+// hinglishWords are Hindi words as written in the Latin alphabet, which an
+// English message hardly ever has.
+var hinglishWords = wordSet("hai hain kya kyu kyun kaise kaisa nahi nahin mujhe mera meri aap aapka tum tumhara bhai yaar accha acha achha kaun kab kahan bahut bohot hoga tha thi karna karo kar raha rahe wala wali bhi toh abhi sab kuch matlab samjha batao bata")
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// detectLanguage guesses the language of an audience message from its
+// script and, for Devanagari and the Latin alphabet, its words. It returns
+// "" for a message without letters.
+func detectLanguage(text string) string {
+	counts := map[string]int{}
+	devanagari, latin := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Devanagari, r):
+			devanagari++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		default:
+			for _, s := range scriptLanguages {
+				if unicode.Is(s.script, r) {
+					counts[s.language]++
+					break
+				}
+			}
+		}
+	}
+	best, most := "", 0
+	for _, s := range scriptLanguages {
+		if counts[s.language] > most {
+			best, most = s.language, counts[s.language]
+		}
+	}
+	switch {
+	case devanagari > most && devanagari >= latin:
+		return devanagariLanguage(text)
+	case most > 0 && most >= latin:
+		return best
+	case latin > 0:
+		return latinLanguage(text)
+	}
+	return ""
+}
+
+// devanagariLanguage tells Marathi from Hindi by their common words,
+// taking Hindi when it can't.
+func devanagariLanguage(text string) string {
+	marathi, hindi := 0, 0
+	for _, w := range messageWords(text) {
+		if marathiWords[w] {
+			marathi++
+		}
+		if hindiWords[w] {
+			hindi++
+		}
+	}
+	if marathi > hindi {
+		return "marathi"
+	}
+	return "hindi"
+}
+
+// latinLanguage tells Hinglish from English: two different Hindi words
+// make it Hinglish, or one in a message of three words or fewer.
+func latinLanguage(text string) string {
+	words := messageWords(strings.ToLower(text))
+	seen := map[string]bool{}
+	for _, w := range words {
+		if hinglishWords[w] {
+			seen[w] = true
+		}
+	}
+	if len(seen) >= 2 || len(seen) == 1 && len(words) <= 3 {
+		return "hinglish"
+	}
+	return "english"
+}
+
+// messageWords splits text into words, dropping punctuation. Devanagari
+// vowel signs are marks, not letters, so they are kept.
+func messageWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsMark(r) && !unicode.IsDigit(r)
+	})
+}
+
+// sessionLanguage is the language of host prompts, and of replies to
+// messages in a language that isn't allowed.
+func (b *Bot) sessionLanguage() string {
+	if s := b.room.schedule.Load(); s != nil && s.Language != "" {
+		return s.Language
+	}
+	return b.cfg.Language.Default
+}
+
+// replyLanguage is the language to answer message in: its own, if it is
+// allowed, else the session's. In bilingual mode it is the first of the
+// two.
+func (b *Bot) replyLanguage(message string) string {
+	if b.bilingual() {
+		return b.cfg.Language.Bilingual[0]
+	}
+	detected := detectLanguage(message)
+	if detected != "" && (detected == b.sessionLanguage() || slices.Contains(b.cfg.Language.Allowed, detected)) {
+		return detected
+	}
+	return b.sessionLanguage()
+}
+
+func validateLanguage(name, where string) error {
+	if _, ok := languages[name]; !ok {
+		return fmt.Errorf("%s: unknown language %q, want one of %s", where, name, strings.Join(sortedKeys(languages), ", "))
+	}
+	return nil
+}
+
+type languageKey struct{}
+
+// withLanguage returns ctx carrying the language the replies generated
+// with it are written in.
+func withLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, languageKey{}, language)
+}
+
+// languageFrom returns the language ctx carries, or the session's.
+func (b *Bot) languageFrom(ctx context.Context) string {
+	if language, _ := ctx.Value(languageKey{}).(string); language != "" {
+		return language
+	}
+	return b.sessionLanguage()
+}
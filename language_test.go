@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"What is Gemini?", "english"},
+		{"Is this the right hall for the keynote?", "english"},
+		{"Gemini kya hai bhai?", "hinglish"},
+		{"Yeh session kab khatam hoga, bahut maza aa raha hai", "hinglish"},
+		{"accha!", "hinglish"},
+		{"जेमिनी क्या है?", "hindi"},
+		{"मुझे अगला सत्र कब है यह जानना है", "hindi"},
+		{"जेमिनी काय आहे?", "marathi"},
+		{"मला पुढच्या सत्राबद्दल सांगा, ते कधी आहे?", "marathi"},
+		{"ஜெமினி என்றால் என்ன?", "tamil"},
+		{"Gemini ಎಂದರೇನು?", "kannada"},
+		{"🙏🙏", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage(tt.text); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestReplyLanguage(t *testing.T) {
+	var mu sync.Mutex
+	var prompts []string
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		prompts = append(prompts, prompt)
+		return "Namaste!", nil
+	}))
+	b.cfg.Language.Allowed = []string{"hindi", "hinglish"}
+
+	if got := b.replyLanguage("जेमिनी क्या है?"); got != "hindi" {
+		t.Errorf("allowed Hindi message answered in %q, want hindi", got)
+	}
+	if got := b.replyLanguage("ஜெமினி என்றால் என்ன?"); got != "english" {
+		t.Errorf("Tamil message, not allowed, answered in %q, want the default english", got)
+	}
+	if got := b.replyLanguage("🙏"); got != "english" {
+		t.Errorf("message without letters answered in %q, want the default english", got)
+	}
+	b.room.schedule.Store(&SessionSchedule{Language: "marathi"})
+	if got := b.replyLanguage("What is Gemini?"); got != "marathi" {
+		t.Errorf("English message, not allowed, answered in %q, want the session's marathi", got)
+	}
+	if got := b.replyLanguage("जेमिनी काय आहे?"); got != "marathi" {
+		t.Errorf("Marathi message answered in %q, want marathi, the session's language", got)
+	}
+	b.room.schedule.Store(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "जेमिनी क्या है?", Timestamp: time.Now()})
+	waitFor(t, nil, "the reply", func() bool {
+		_, ok := store.Reply("m1")
+		return ok
+	})
+	reply, _ := store.Reply("m1")
+	if reply.Language != "hindi" {
+		t.Errorf("reply language = %q, want hindi", reply.Language)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	found := false
+	for _, p := range prompts {
+		if strings.Contains(p, "Always reply in Hindi, in Devanagari script.") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no prompt asked for a reply in Hindi: %q", prompts)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// leaderboardSize is how many players GET /leaderboard returns by
+	// default, and the most the host's prompt context keeps.
+	leaderboardSize = 10
+	// leaderboardMentions is how many leaders the prompt context names.
+	leaderboardMentions = 3
+)
+
+// LeaderboardEntry is one player's standing across every quiz of the
+// session, a document in the leaderboard collection keyed by user ID.
+// Quizzes holds their score in each quiz session, Wagers what they won or
+// lost betting on polls, and Points the total.
+type LeaderboardEntry struct {
+	UserID      string         `firestore:"-" json:"userId"`
+	DisplayName string         `firestore:"displayName,omitempty" json:"displayName,omitempty"`
+	Points      int            `firestore:"points" json:"points"`
+	Quizzes     map[string]int `firestore:"quizzes" json:"quizzes"`
+	Wagers      int            `firestore:"wagers,omitempty" json:"wagers,omitempty"`
+	UpdatedAt   time.Time      `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// name is how the host calls the player out.
+func (e LeaderboardEntry) name() string {
+	if e.DisplayName != "" {
+		return e.DisplayName
+	}
+	return e.UserID
+}
+
+// LeaderboardStore keeps the players' cumulative points.
+type LeaderboardStore interface {
+	// RecordQuizScores sets each entry's Points as its score in quiz
+	// session quizID, and its DisplayName, and recomputes its total.
+	RecordQuizScores(ctx context.Context, quizID string, entries []LeaderboardEntry) error
+	// Leaderboard returns the n players with the most points, most first.
+	Leaderboard(ctx context.Context, n int) ([]LeaderboardEntry, error)
+	// SettleWagers settles the wagers on poll pollID, won by the options
+	// in outcome, with settleWagers, in one transaction: it reads the
+	// wagers, keyed by the user IDs anon maps their players to, updates
+	// the players' points and records the results on the poll. A poll
+	// already settled keeps its results, which are returned.
+	SettleWagers(ctx context.Context, pollID string, outcome []string, anon idMapper) ([]WagerResult, error)
+}
+
+// recordLeaderboard carries the scores of quiz session quizID that changed
+// since the last tick over to the leaderboard. Only the monitor calls it.
+func (b *Bot) recordLeaderboard(ctx context.Context, quizID string, scores map[string]int) error {
+	recorded := b.leaderboardScores[quizID]
+	var players []string
+	for player, score := range scores {
+		if prev, ok := recorded[player]; !ok || prev != score {
+			players = append(players, player)
+		}
+	}
+	if len(players) == 0 {
+		return nil
+	}
+
+	names := b.displayNames(ctx, players)
+	entries := make([]LeaderboardEntry, len(players))
+	for i, player := range players {
+		entries[i] = LeaderboardEntry{UserID: player, Points: scores[player]}
+		if names[i] != player {
+			entries[i].DisplayName = names[i]
+		}
+	}
+	if err := b.leaderboard.RecordQuizScores(ctx, quizID, entries); err != nil {
+		return fmt.Errorf("error updating the leaderboard: %w", err)
+	}
+
+	if recorded == nil {
+		if b.leaderboardScores == nil {
+			b.leaderboardScores = map[string]map[string]int{}
+		}
+		recorded = map[string]int{}
+		b.leaderboardScores[quizID] = recorded
+	}
+	for _, player := range players {
+		recorded[player] = scores[player]
+	}
+	b.leaderboardStale = true
+	return nil
+}
+
+// refreshLeaderboard reloads the top of the leaderboard for the prompt
+// context when scores changed. Only the monitor calls it.
+func (b *Bot) refreshLeaderboard(ctx context.Context) error {
+	if !b.leaderboardStale && b.room.leaderboard.Load() != nil {
+		return nil
+	}
+	top, err := b.leaderboard.Leaderboard(ctx, leaderboardSize)
+	if err != nil {
+		return fmt.Errorf("error reading the leaderboard: %w", err)
+	}
+	b.room.leaderboard.Store(&top)
+	b.leaderboardStale = false
+	return nil
+}
+
+// leaderboardText names the leaders for the host's prompt context, or is
+// empty while nobody has scored.
+func leaderboardText(top []LeaderboardEntry) string {
+	var leaders []string
+	for i, e := range top {
+		if i == leaderboardMentions || e.Points == 0 {
+			break
+		}
+		leaders = append(leaders, fmt.Sprintf("%d. %s (%d points)", i+1, e.name(), e.Points))
+	}
+	if len(leaders) == 0 {
+		return ""
+	}
+	return "Quiz leaderboard: " + strings.Join(leaders, ", ")
+}
+
+func registerLeaderboardRoutes(mux *http.ServeMux, b *Bot) {
+	// The live top of the leaderboard, leaderboardSize players unless "n"
+	// asks for up to maxAPIResponses.
+	mux.HandleFunc("GET /leaderboard", func(w http.ResponseWriter, r *http.Request) {
+		n := leaderboardSize
+		if s := r.URL.Query().Get("n"); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v <= 0 {
+				writeError(w, http.StatusBadRequest, errors.New("n must be a positive number"))
+				return
+			}
+			n = min(v, maxAPIResponses)
+		}
+		top, err := b.leaderboard.Leaderboard(r.Context(), n)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"leaders": top})
+	})
+}
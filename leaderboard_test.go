@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLeaderboard(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.APIKeys = []string{"app-key"}
+	ctx := context.Background()
+
+	store.RecordQuizScores(ctx, "round-1", []LeaderboardEntry{
+		{UserID: "ann", DisplayName: "Ann", Points: 20},
+		{UserID: "bob", Points: 30},
+		{UserID: "cat", Points: 0},
+	})
+	store.RecordQuizScores(ctx, "round-2", []LeaderboardEntry{{UserID: "ann", Points: 20}, {UserID: "dan", Points: 10}})
+	// A rescored round replaces the player's points for it.
+	store.RecordQuizScores(ctx, "round-2", []LeaderboardEntry{{UserID: "ann", Points: 30}})
+
+	if err := b.refreshLeaderboard(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.refreshSummary()
+	want := "Quiz leaderboard: 1. Ann (50 points), 2. bob (30 points), 3. dan (10 points)\n"
+	if got := b.room.getSummary(); !strings.HasPrefix(got, want) {
+		t.Errorf("summary = %q, want it to start with %q", got, want)
+	}
+
+	srv := httptest.NewServer(b.apiHandler())
+	defer srv.Close()
+	get := func(path string) (int, []LeaderboardEntry) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("X-API-Key", "app-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Leaders []LeaderboardEntry `json:"leaders"`
+		}
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out.Leaders
+	}
+	code, leaders := get("/leaderboard")
+	if code != http.StatusOK || len(leaders) != 4 || leaders[0].UserID != "ann" || leaders[0].Quizzes["round-1"] != 20 {
+		t.Fatalf("GET /leaderboard = %d %+v", code, leaders)
+	}
+	if _, leaders := get("/leaderboard?n=2"); len(leaders) != 2 || leaders[1].UserID != "bob" {
+		t.Errorf("GET /leaderboard?n=2 = %+v, want the top two", leaders)
+	}
+	if code, _ := get("/leaderboard?n=0"); code != http.StatusBadRequest {
+		t.Errorf("GET /leaderboard?n=0 = %d, want %d", code, http.StatusBadRequest)
+	}
+}
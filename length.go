@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Ways of enforcing LengthConfig.MaxWords on a reply that overruns it.
+const (
+	lengthTruncate   = "truncate"
+	lengthRegenerate = "regenerate"
+	lengthOff        = "off"
+)
+
+// replyKind is the LengthConfig.MaxWords key of audience replies.
+const replyKind = "reply"
+
+// LengthConfig holds replies to the word limit their prompt asks for,
+// which the model often overruns. MaxWords sets the limit of a message
+// type, "reply" for audience messages or a host prompt kind, at normal
+// pacing, instead of the pacing's; slower pacing scales it down in
+// proportion, and a persona's maxWords caps it. A reply over its limit is
+// cut after the last whole sentence that fits (Mode "truncate", the
+// default), asked for once more in so many words and cut only if it still
+// overruns ("regenerate"), or left as it is ("off").
+type LengthConfig struct {
+	Mode     string         `json:"mode" yaml:"mode"`
+	MaxWords map[string]int `json:"maxWords" yaml:"maxWords"`
+}
+
+func validateLength(cfg LengthConfig) error {
+	switch cfg.Mode {
+	case lengthTruncate, lengthRegenerate, lengthOff:
+	default:
+		return fmt.Errorf("length.mode must be truncate, regenerate or off, got %q", cfg.Mode)
+	}
+	for kind, n := range cfg.MaxWords {
+		if kind != replyKind && !hostPromptKinds[kind] {
+			return fmt.Errorf("length.maxWords: %q is neither reply nor a host prompt kind", kind)
+		}
+		if n < 1 {
+			return fmt.Errorf("length.maxWords.%s must be positive", kind)
+		}
+	}
+	return nil
+}
+
+// parseWordLimits parses MAX_WORDS, a comma-separated list of kind=words.
+func parseWordLimits(spec string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		kind, words, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not kind=words", entry)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(words))
+		if err != nil {
+			return nil, fmt.Errorf("invalid word limit in %q: %w", entry, err)
+		}
+		limits[strings.TrimSpace(kind)] = n
+	}
+	return limits, nil
+}
+
+// wordLimit is how many words a reply to userMessage may have at pacing
+// p, played as persona.
+func (b *Bot) wordLimit(userMessage string, p Pacing, persona Persona) int {
+	kind := replyKind
+	if hostPromptKinds[userMessage] {
+		kind = userMessage
+	}
+	limit := p.MaxWords
+	if n := b.cfg.Length.MaxWords[kind]; n > 0 {
+		limit = max(1, n*p.MaxWords/normalPacing.MaxWords)
+	}
+	if persona.MaxWords > 0 {
+		limit = min(limit, persona.MaxWords)
+	}
+	return limit
+}
+
+// countWords is the number of words in text.
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+// truncateWords cuts text down to limit words, after the last sentence
+// that ends within them, or mid-sentence with an ellipsis if even the
+// first sentence is too long.
+func truncateWords(text string, limit int) string {
+	words, cut, wordEnd := 0, -1, -1
+	inWord := false
+	for i, r := range text + " " {
+		switch {
+		case unicode.IsSpace(r) && inWord:
+			inWord = false
+			words++
+			wordEnd = i
+			if endsSentence(text[:i]) {
+				cut = i
+			}
+			if words == limit {
+				if cut < 0 {
+					return strings.TrimRight(text[:wordEnd], ",;:-–—") + "…"
+				}
+				return text[:cut]
+			}
+		case !unicode.IsSpace(r):
+			inWord = true
+		}
+	}
+	return text
+}
+
+// endsSentence reports whether text ends a sentence: with a full stop,
+// question or exclamation mark, or an ellipsis, perhaps inside quotes or
+// brackets.
+func endsSentence(text string) bool {
+	text = strings.TrimRight(text, `"'”’)]*`)
+	return strings.HasSuffix(text, ".") || strings.HasSuffix(text, "!") || strings.HasSuffix(text, "?") || strings.HasSuffix(text, "…")
+}
+
+// enforceLength holds text, the model's reply to requestText, to limit
+// words as the config says. userMessage is what it replies to, for the
+// log. In regenerate mode the model is asked again at level.
+func (b *Bot) enforceLength(ctx context.Context, level degradationLevel, userMessage, requestText, text string, limit int) string {
+	mode := b.cfg.Length.Mode
+	n := countWords(text)
+	if mode == lengthOff || limit <= 0 || n <= limit {
+		return text
+	}
+	b.metrics.overlongReplies.inc(mode)
+	logger := loggerFrom(ctx).With("words", n, "limit", limit, "mode", mode)
+	if mode == lengthRegenerate {
+		stricter := fmt.Sprintf("%s\n\nYour reply was %d words long:\n%s\nThat is too long. Say it again in at most %d words.", requestText, n, text, limit)
+		retry, err := b.generate(ctx, level, stricter, nil)
+		switch {
+		case err != nil:
+			logger.Warn("error regenerating overlong reply, truncating it", "err", err)
+		case countWords(retry) <= limit:
+			logger.Debug("regenerated overlong reply", "message", userMessage, "retryWords", countWords(retry))
+			return retry
+		default:
+			logger.Debug("regenerated reply still too long, truncating it", "message", userMessage, "retryWords", countWords(retry))
+			text = retry
+		}
+	}
+	logger.Debug("truncated overlong reply", "message", userMessage)
+	return truncateWords(text, limit)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTruncateWords(t *testing.T) {
+	for _, tt := range []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"Namaste! Gemini is Google's model.", 10, "Namaste! Gemini is Google's model."},
+		{"Namaste! Gemini is Google's model. Ask me more.", 6, "Namaste! Gemini is Google's model."},
+		{"Namaste! Gemini is Google's model. Ask me more.", 4, "Namaste!"},
+		{`He said "Lock kiya jaye?" and the crowd roared.`, 6, `He said "Lock kiya jaye?"`},
+		{"Gemini, Google's model, answers questions in many languages.", 3, "Gemini, Google's model…"},
+		{"Line one.\nLine two is here.\nLine three.", 7, "Line one.\nLine two is here."},
+	} {
+		if got := truncateWords(tt.text, tt.limit); got != tt.want {
+			t.Errorf("truncateWords(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestWordLimit(t *testing.T) {
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	b.cfg.Length.MaxWords = map[string]int{"poll-results": 60}
+	for _, tt := range []struct {
+		message string
+		pacing  Pacing
+		persona Persona
+		want    int
+	}{
+		{"What is Gemini?", normalPacing, defaultPersona, 30},
+		{"poll-results", normalPacing, defaultPersona, 60},
+		{"poll-results", pacingFor(3000), defaultPersona, 24},
+		{"poll-results", normalPacing, Persona{Name: "rajini", MaxWords: 20}, 20},
+		{"prompt", pacingFor(1000), defaultPersona, 20},
+	} {
+		if got := b.wordLimit(tt.message, tt.pacing, tt.persona); got != tt.want {
+			t.Errorf("wordLimit(%q, %d words, %s) = %d, want %d", tt.message, tt.pacing.MaxWords, tt.persona.Name, got, tt.want)
+		}
+	}
+}
+
+func TestEnforceLengthRegenerates(t *testing.T) {
+	long := strings.Repeat("Kaun Banega Crorepati is on. ", 10)
+	var prompts []string
+	model := generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		if strings.Contains(prompt, "That is too long") {
+			return "Namaste! Gemini is Google's model.", nil
+		}
+		return long, nil
+	})
+	b := newTestBot(t, newMemoryStore(), model)
+	b.cfg.Length.Mode = lengthRegenerate
+	ctx := context.Background()
+
+	got, err := b.generateResponse(ctx, "What is Gemini?", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Namaste! Gemini is Google's model." || len(prompts) != 2 || !strings.Contains(prompts[1], "at most 30 words") {
+		t.Errorf("reply = %q after prompts %q, want the regenerated one", got, prompts)
+	}
+
+	b.cfg.Length.Mode = lengthTruncate
+	if got, _ := b.generateResponse(ctx, "What is Gemini?", "", nil); countWords(got) != 30 || !strings.HasSuffix(got, "on.") {
+		t.Errorf("truncated reply = %q, want six whole sentences", got)
+	}
+	b.cfg.Length.Mode = lengthOff
+	if got, _ := b.generateResponse(ctx, "What is Gemini?", "", nil); got != long {
+		t.Errorf("reply with length enforcement off = %q, want it as it was", got)
+	}
+	if got := b.metrics.overlongReplies.snapshot(); got[lengthRegenerate] != 1 || got[lengthTruncate] != 1 {
+		t.Errorf("overlong replies = %v, want one regenerated and one truncated", got)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lifelines an audience member can call on the active quiz question, once
+// each per session.
+const (
+	lifelineFiftyFifty   = "fifty-fifty"
+	lifelineAudiencePoll = "audience-poll"
+	lifelinePhoneAFriend = "phone-a-friend"
+)
+
+// lifelineCommands maps the message commands to the lifeline they call.
+var lifelineCommands = map[string]string{
+	"/50:50":          lifelineFiftyFifty,
+	"/50-50":          lifelineFiftyFifty,
+	"/5050":           lifelineFiftyFifty,
+	"/fifty-fifty":    lifelineFiftyFifty,
+	"/audience":       lifelineAudiencePoll,
+	"/audience-poll":  lifelineAudiencePoll,
+	"/poll":           lifelineAudiencePoll,
+	"/phone":          lifelinePhoneAFriend,
+	"/friend":         lifelinePhoneAFriend,
+	"/phone-a-friend": lifelinePhoneAFriend,
+}
+
+// lifelineNames are how the host names each lifeline.
+var lifelineNames = map[string]string{
+	lifelineFiftyFifty:   "50:50",
+	lifelineAudiencePoll: "audience poll",
+	lifelinePhoneAFriend: "phone-a-friend",
+}
+
+// friendBusyLine stands in for the friend when no model is available.
+const friendBusyLine = "Sorry yaar, the line is breaking up and I really can't say. Go with your gut!"
+
+// parseLifeline returns the lifeline text calls, or "" if it isn't a
+// lifeline command.
+func parseLifeline(text string) string {
+	return lifelineCommands[strings.ToLower(strings.TrimSpace(text))]
+}
+
+// LifelineStore records who has used which lifeline this session.
+type LifelineStore interface {
+	// UseLifeline records that user called lifeline, reporting false if
+	// they already had.
+	UseLifeline(ctx context.Context, user, lifeline string) (bool, error)
+}
+
+// fiftyFifty removes two wrong options of poll at random, or all but one
+// if it has fewer, and returns the keys left, sorted.
+func fiftyFifty(poll PollQuestion) []string {
+	var wrong []string
+	for key := range poll.Options {
+		if key != poll.Correct {
+			wrong = append(wrong, key)
+		}
+	}
+	sort.Strings(wrong)
+	remove := min(2, len(wrong)-1)
+	for i := 0; i < remove; i++ {
+		j := rng.Intn(len(wrong))
+		wrong = append(wrong[:j], wrong[j+1:]...)
+	}
+	left := append(wrong, poll.Correct)
+	sort.Strings(left)
+	return left
+}
+
+// optionList renders keys of poll as "A - text" lines.
+func optionList(poll PollQuestion, keys []string) string {
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = fmt.Sprintf("%s - %s", poll.Options[key].Label, poll.Options[key].OpText)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// audiencePollText summarizes the eligible votes on poll so far.
+func audiencePollText(poll PollQuestion) string {
+	results, total := pollResults(poll)
+	if total == 0 {
+		return fmt.Sprintf("Audience poll: nobody has voted on %q yet.", poll.Question)
+	}
+	parts := make([]string, len(results))
+	for i, r := range results {
+		parts[i] = fmt.Sprintf("%s - %s: %g%%", r.Label, r.Text, r.Percent)
+	}
+	return fmt.Sprintf("Audience poll on %q, %d votes: %s.", poll.Question, total, strings.Join(parts, ", "))
+}
+
+// phoneAFriend has the model play the caller's friend, who picks an
+// answer and says how sure they are; they are not told the right one.
+func (b *Bot) phoneAFriend(ctx context.Context, poll PollQuestion) string {
+	keys := make([]string, 0, len(poll.Options))
+	for key := range poll.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	prompt := fmt.Sprintf(`You are the friend a contestant on Kaun Banega Crorepati has phoned for help, with 30 seconds on the clock. The question is %q and the options are:
+%s
+In at most 30 words, in English, say which option you would pick and how sure you are, like a friend on the phone. Do not say anything that can be taken as abusive.`, poll.Question, optionList(poll, keys))
+	text, err := b.ladderModel().Generate(ctx, prompt)
+	if err != nil || strings.TrimSpace(text) == "" || containsProfanity(text) {
+		return friendBusyLine
+	}
+	return "Your friend on the line: " + strings.TrimSpace(text)
+}
+
+// lifelineResult works out what lifeline called by msg's sender shows on
+// the active poll, and uses it up if it applies.
+func (b *Bot) lifelineResult(ctx context.Context, msg *Message, lifeline string) (string, error) {
+	user := msg.UserID
+	if user == "" && msg.SessionID != "" {
+		user = "session-" + msg.SessionID
+	}
+	if user == "" {
+		return "Sign in to use your lifelines.", nil
+	}
+	tally, err := b.tallyLivePoll(ctx)
+	if err != nil {
+		return "", err
+	}
+	poll := tally.Poll
+	if poll.Correct == "" {
+		return "Lifelines only work on quiz questions, and this poll has no right answer.", nil
+	}
+	if closed, _ := pollClosed(poll, clock.Now()); closed {
+		return fmt.Sprintf("Voting has closed on %q, so your %s is safe for the next question.", poll.Question, lifelineNames[lifeline]), nil
+	}
+	fresh, err := b.lifelines.UseLifeline(ctx, user, lifeline)
+	if err != nil {
+		return "", fmt.Errorf("error recording lifeline: %w", err)
+	}
+	if !fresh {
+		return fmt.Sprintf("You have already used your %s lifeline.", lifelineNames[lifeline]), nil
+	}
+
+	switch lifeline {
+	case lifelineFiftyFifty:
+		return fmt.Sprintf("50:50! Two wrong answers to %q are gone. Left:\n%s", poll.Question, optionList(poll, fiftyFifty(poll))), nil
+	case lifelineAudiencePoll:
+		return audiencePollText(poll), nil
+	default:
+		return b.phoneAFriend(ctx, poll), nil
+	}
+}
+
+// handleLifeline answers a lifeline command on the ping collection and
+// marks it processed. Lifelines are game moves, so triage does not apply.
+func (b *Bot) handleLifeline(ctx context.Context, msg *Message, lifeline string) error {
+	text, err := b.lifelineResult(ctx, msg, lifeline)
+	if err != nil {
+		return fmt.Errorf("error calling %s lifeline: %w", lifeline, err)
+	}
+	if err := b.publishReply(ctx, b.replyTo(ctx, msg, Message{Message: text, Question: msg.Message, Lifeline: lifeline})); err != nil {
+		return fmt.Errorf("error writing lifeline result: %w", err)
+	}
+	b.recordAnswer(msg)
+	if err := b.markProcessed(ctx, msg.ID, msg.UserID); err != nil {
+		return fmt.Errorf("error marking message as processed: %w", err)
+	}
+	b.room.lastResponseTime.StoreLater(clock.Now())
+	loggerFrom(ctx).Info("lifeline answered", "lifeline", lifeline, "response", text)
+	b.health.messagesProcessed.Add(1)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseLifeline(t *testing.T) {
+	for text, want := range map[string]string{
+		"/50:50":    lifelineFiftyFifty,
+		" /5050 ":   lifelineFiftyFifty,
+		"/Phone":    lifelinePhoneAFriend,
+		"/poll":     lifelineAudiencePoll,
+		"50:50":     "",
+		"/phone me": "",
+	} {
+		if got := parseLifeline(text); got != want {
+			t.Errorf("parseLifeline(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestFiftyFifty(t *testing.T) {
+	poll := PollQuestion{Correct: "C", Options: map[string]PollOption{"A": {}, "B": {}, "C": {}, "D": {}}}
+	for range 20 {
+		left := fiftyFifty(poll)
+		if len(left) != 2 || (left[0] != "C" && left[1] != "C") {
+			t.Fatalf("fiftyFifty = %v, want the right answer and one wrong one", left)
+		}
+	}
+	poll.Options = map[string]PollOption{"A": {}, "C": {}}
+	if left := fiftyFifty(poll); len(left) != 2 {
+		t.Errorf("fiftyFifty of two options = %v, want both kept", left)
+	}
+}
+
+func TestLifelines(t *testing.T) {
+	store := newMemoryStore()
+	store.SetPoll("q1", PollQuestion{Question: "Who created Go?", Correct: "B", Options: map[string]PollOption{
+		"A": {Label: "A", OpText: "Guido", Voters: []string{"cat"}},
+		"B": {Label: "B", OpText: "Rob Pike", Voters: []string{"dan", "eve", "fay"}},
+		"C": {Label: "C", OpText: "Linus"},
+		"D": {Label: "D", OpText: "Bjarne"},
+	}})
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		if !strings.Contains(prompt, "Rob Pike") {
+			t.Errorf("friend prompt = %q, want the options", prompt)
+		}
+		return "Pretty sure it's B, Rob Pike. 80 percent!", nil
+	}))
+	ctx := context.Background()
+
+	call := func(id, user, text string) Message {
+		t.Helper()
+		msg := Message{ID: id, UserID: user, Message: text}
+		store.AddMessage(msg)
+		if err := b.handleUserMessage(ctx, &msg, answerPublic); err != nil {
+			t.Fatal(err)
+		}
+		reply, ok := store.Reply(id)
+		if !ok {
+			t.Fatalf("no reply to %q", text)
+		}
+		return reply
+	}
+
+	got := call("m1", "ann", "/50:50")
+	if got.Lifeline != lifelineFiftyFifty || !strings.Contains(got.Message, "B - Rob Pike") || strings.Count(got.Message, " - ") != 2 {
+		t.Errorf("50:50 reply = %+v, want two options left", got)
+	}
+	if got := call("m2", "ann", "/5050"); !strings.Contains(got.Message, "already used") {
+		t.Errorf("second 50:50 = %q, want it refused", got.Message)
+	}
+	if got := call("m3", "ann", "/audience"); !strings.Contains(got.Message, "B - Rob Pike: 75%") {
+		t.Errorf("audience poll = %q, want the vote shares", got.Message)
+	}
+	if got := call("m4", "bob", "/phone"); got.Message != "Your friend on the line: Pretty sure it's B, Rob Pike. 80 percent!" {
+		t.Errorf("phone-a-friend = %q", got.Message)
+	}
+	if msg, _ := store.Message("m4"); !msg.Processed {
+		t.Error("lifeline command not marked processed")
+	}
+
+	store.SetPoll("q1", PollQuestion{Question: "Tabs or spaces?", Options: map[string]PollOption{"A": {Label: "A"}}})
+	if got := call("m5", "cat", "/phone"); !strings.Contains(got.Message, "only work on quiz questions") {
+		t.Errorf("lifeline on a plain poll = %q, want it refused", got.Message)
+	}
+}
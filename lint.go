@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// lintInput is the show's configuration as organizers set it up: the
+// personas and poll rotation from the config file, the prompt templates,
+// and what is stored in Firestore.
+type lintInput struct {
+	Personas      []Persona
+	Persona       string
+	PollIDs       []string
+	Prompts       *template.Template
+	Polls         map[string]PollQuestion
+	Quizzes       map[string]QuizSession
+	Calendar      []ContentDay
+	Schedule      *SessionSchedule
+	Announcements []ScheduledAnnouncement
+}
+
+// lintProblem is something wrong with the configuration: Where names the
+// document, persona or template, as "kind id".
+type lintProblem struct {
+	Where   string
+	Problem string
+}
+
+func (p lintProblem) String() string {
+	return p.Where + ": " + p.Problem
+}
+
+// lintSampleData is a promptData with every field set, so rendering a
+// template with it takes the branches the zero value skips.
+var lintSampleData = promptData{
+	Persona:    defaultPersona,
+	MaxWords:   50,
+	Kind:       "prompt",
+	Message:    "What is Gemini?",
+	Context:    "Poll status: A - 3 votes",
+	PollStatus: "A - 3 votes",
+	History:    "ann: hello",
+	Variant:    "b",
+	Language:   languages["hindi"],
+	Vars: templateVars{
+		Leader: "Ann", LeaderPoints: 120, ActivePollID: "q1", Persona: defaultPersona.Name, Theme: "AI",
+		Session: "Keynote", NextSessionIn: "15 minutes", SessionEndsIn: "1 hour",
+	},
+}
+
+// lintConfig checks in against what the backend expects of it at now,
+// returning the problems sorted by where they are.
+func lintConfig(in lintInput, now time.Time) []lintProblem {
+	var problems []lintProblem
+	report := func(where, format string, args ...any) {
+		problems = append(problems, lintProblem{Where: where, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	personas := map[string]bool{defaultPersona.Name: true}
+	defined := map[string]bool{}
+	for _, p := range in.Personas {
+		where := "persona " + p.Name
+		switch {
+		case p.Name == "":
+			report("persona", "has no name")
+		case defined[p.Name]:
+			report(where, "is defined twice")
+		}
+		defined[p.Name] = true
+		if p.Prompt == "" {
+			report(where, "has no prompt")
+		}
+		if p.MaxWords < 0 {
+			report(where, "maxWords must not be negative")
+		}
+		if err := p.Generation.validate("generation"); err != nil {
+			report(where, "%v", err)
+		}
+		personas[p.Name] = true
+	}
+	if in.Persona != "" && !personas[in.Persona] {
+		report("config", "active persona %q is not configured", in.Persona)
+	}
+
+	if in.Prompts != nil {
+		for _, t := range in.Prompts.Templates() {
+			name := t.Name()
+			if name == "prompts" {
+				continue
+			}
+			kind := strings.TrimSuffix(name, ".tmpl")
+			if name != "reply.tmpl" && !hostPromptKinds[kind] {
+				report("template "+name, "is never used: %q is not a host prompt kind", kind)
+			}
+			if err := t.Execute(io.Discard, lintSampleData); err != nil {
+				report("template "+name, "%v", err)
+			}
+		}
+	}
+
+	for _, id := range sortedKeys(in.Polls) {
+		lintPoll(id, in.Polls[id], report)
+	}
+	for _, id := range in.PollIDs {
+		if _, ok := in.Polls[id]; !ok {
+			report("config", "poll rotation names poll %q, which does not exist", id)
+		}
+	}
+
+	for _, id := range sortedKeys(in.Quizzes) {
+		q := in.Quizzes[id]
+		where := "quiz " + id
+		if q.Title == "" {
+			report(where, "has no title")
+		}
+		if len(q.Questions) == 0 {
+			report(where, "has no questions")
+		}
+		for _, pollID := range q.Questions {
+			if poll, ok := in.Polls[pollID]; !ok {
+				report(where, "question %q does not exist", pollID)
+			} else if poll.Correct == "" && poll.Kind == "" {
+				report(where, "question %q has no correct answer", pollID)
+			}
+		}
+		if q.Current != "" && !slices.Contains(q.Questions, q.Current) {
+			report(where, "current question %q is not one of its questions", q.Current)
+		}
+	}
+
+	starts := map[time.Time]string{}
+	for _, d := range in.Calendar {
+		where := "calendar " + d.ID
+		if d.StartsAt.IsZero() {
+			report(where, "has no start time")
+		} else if other, ok := starts[d.StartsAt]; ok {
+			report(where, "starts at the same time as %s", other)
+		}
+		starts[d.StartsAt] = d.ID
+		if d.Persona != "" && !personas[d.Persona] {
+			report(where, "persona %q is not configured", d.Persona)
+		}
+		for _, pollID := range d.Polls {
+			if _, ok := in.Polls[pollID]; !ok {
+				report(where, "poll %q does not exist", pollID)
+			}
+		}
+		for _, quizID := range d.Quizzes {
+			if _, ok := in.Quizzes[quizID]; !ok {
+				report(where, "quiz %q does not exist", quizID)
+			}
+		}
+	}
+
+	if s := in.Schedule; s != nil {
+		if _, ok := languages[s.Language]; s.Language != "" && !ok {
+			report("schedule live", "unknown language %q", s.Language)
+		}
+		switch {
+		case s.StartsAt.IsZero():
+			report("schedule live", "has no start time")
+		case !s.EndsAt.IsZero() && !s.EndsAt.After(s.StartsAt):
+			report("schedule live", "ends at %s, before it starts", s.EndsAt.Format(time.RFC3339))
+		case !s.EndsAt.IsZero() && !now.Before(s.EndsAt):
+			report("schedule live", "ended at %s", s.EndsAt.Format(time.RFC3339))
+		}
+	}
+
+	for _, a := range in.Announcements {
+		where := "announcement " + a.ID
+		if strings.TrimSpace(a.Message) == "" {
+			report(where, "has no message")
+		} else if _, err := parseMessageTemplate(a.Message); err != nil {
+			report(where, "%v", err)
+		}
+		if a.At.Before(now) {
+			report(where, "was due at %s and will go out as soon as the host starts", a.At.Format(time.RFC3339))
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Where < problems[j].Where })
+	return problems
+}
+
+// lintPoll checks question bank entry id against its kind.
+func lintPoll(id string, poll PollQuestion, report func(where, format string, args ...any)) {
+	where := "poll " + id
+	if strings.TrimSpace(poll.Question) == "" {
+		report(where, "has no question")
+	}
+	if poll.MaxVotes < 0 {
+		report(where, "maxVotes must not be negative")
+	}
+	switch poll.Kind {
+	case "numeric":
+		switch r := poll.Range; {
+		case r == nil:
+			report(where, "numeric poll has no range")
+		case r.Min >= r.Max:
+			report(where, "range min %g is not below max %g", r.Min, r.Max)
+		case r.Answer != nil && (*r.Answer < r.Min || *r.Answer > r.Max):
+			report(where, "answer %g is outside the range", *r.Answer)
+		}
+	case "text":
+	case "":
+		if len(poll.Options) < 2 {
+			report(where, "has %d options, want at least 2", len(poll.Options))
+		}
+		for _, key := range sortedKeys(poll.Options) {
+			if strings.TrimSpace(poll.Options[key].OpText) == "" {
+				report(where, "option %s has no text", key)
+			}
+		}
+		if _, ok := poll.Options[poll.Correct]; poll.Correct != "" && !ok {
+			report(where, "correct answer %q is not an option", poll.Correct)
+		}
+	default:
+		report(where, "unknown kind %q", poll.Kind)
+	}
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readDocs decodes every document of collection, by ID.
+func readDocs[T any](ctx context.Context, client *firestore.Client, collection string) (map[string]T, error) {
+	docs := map[string]T{}
+	iter := client.Collection(collection).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", collection, err)
+		}
+		var v T
+		if err := doc.DataTo(&v); err != nil {
+			return nil, fmt.Errorf("error decoding %s/%s: %w", collection, doc.Ref.ID, err)
+		}
+		docs[doc.Ref.ID] = v
+	}
+}
+
+// runLint implements the "lint" command, which checks the personas, prompt
+// templates, question bank, quiz sessions, calendar, schedule and scheduled
+// announcements for mistakes and references to things that don't exist,
+// so they can be fixed before the show starts. It fails if any are found.
+func runLint(ctx context.Context, w io.Writer, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	in := lintInput{Personas: cfg.Personas, Persona: cfg.Persona, PollIDs: cfg.Polls.IDs}
+	var problems []lintProblem
+	prompts, err := loadPrompts(cfg.PromptsDir)
+	if err != nil {
+		problems = append(problems, lintProblem{Where: "templates", Problem: err.Error()})
+	}
+	in.Prompts = prompts
+
+	client, err := newFirestoreClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	store := newFirestoreStore(client, cfg)
+
+	if in.Polls, err = readDocs[PollQuestion](ctx, client, cfg.Collections.Poll); err != nil {
+		return err
+	}
+	if in.Quizzes, err = readDocs[QuizSession](ctx, client, cfg.Collections.Quiz); err != nil {
+		return err
+	}
+	days, err := readDocs[ContentDay](ctx, client, cfg.Collections.Calendar)
+	if err != nil {
+		return err
+	}
+	for _, id := range sortedKeys(days) {
+		d := days[id]
+		d.ID = id
+		in.Calendar = append(in.Calendar, d)
+	}
+	if in.Schedule, err = store.Schedule(ctx); err != nil {
+		return err
+	}
+	if in.Announcements, err = store.Announcements(ctx); err != nil {
+		return err
+	}
+
+	problems = append(problems, lintConfig(in, clock.Now())...)
+	fmt.Fprintf(w, "%d personas, %d polls, %d quiz sessions, %d calendar days, %d pending announcements\n",
+		len(in.Personas)+1, len(in.Polls), len(in.Quizzes), len(in.Calendar), len(in.Announcements))
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "no problems found")
+		return nil
+	}
+	fmt.Fprintln(w)
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	return fmt.Errorf("%d problems found", len(problems))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestLintConfig(t *testing.T) {
+	now := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	prompts := template.Must(template.New("prompts").Parse(`{{define "reply.tmpl"}}{{.Message}}{{end}}` +
+		`{{define "poll-update.tmpl"}}{{if .PollStatus}}{{.Polls}}{{end}}{{end}}` +
+		`{{define "pol-results.tmpl"}}{{.Context}}{{end}}`))
+	in := lintInput{
+		Personas: []Persona{{Name: "shah", Prompt: "You're Shah Rukh."}, {Name: "shah", Prompt: "Again."}},
+		Persona:  "amitabh",
+		PollIDs:  []string{"q1", "q9"},
+		Prompts:  prompts,
+		Polls: map[string]PollQuestion{
+			"q1": {Question: "Capital of France?", Correct: "B", Options: map[string]PollOption{
+				"A": {OpText: "Lyon"}, "B": {OpText: "Paris"},
+			}},
+			"q2": {Question: "Chai or coffee?", Correct: "C", Options: map[string]PollOption{"A": {OpText: "Chai"}}},
+			"q3": {Question: "How many?", Kind: "numeric"},
+		},
+		Quizzes: map[string]QuizSession{
+			"round1": {Title: "Round 1", Questions: []string{"q1", "q4"}, Current: "q2"},
+		},
+		Calendar: []ContentDay{
+			{ID: "day1", StartsAt: now, Persona: "shah", Polls: []string{"q1"}, Quizzes: []string{"round1"}},
+			{ID: "day2", StartsAt: now.Add(24 * time.Hour), Persona: "bachchan", Quizzes: []string{"round2"}},
+		},
+		Schedule:      &SessionSchedule{StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)},
+		Announcements: []ScheduledAnnouncement{{ID: "a1", Message: "Lunch!", At: now.Add(-time.Minute)}},
+	}
+
+	var got []string
+	for _, p := range lintConfig(in, now) {
+		got = append(got, p.String())
+	}
+	want := []string{
+		`announcement a1: was due at 2024-12-07T09:59:00Z`,
+		`calendar day2: persona "bachchan" is not configured`,
+		`calendar day2: quiz "round2" does not exist`,
+		`config: poll rotation names poll "q9", which does not exist`,
+		`persona shah: is defined twice`,
+		`poll q2: has 1 options, want at least 2`,
+		`poll q2: correct answer "C" is not an option`,
+		`poll q3: numeric poll has no range`,
+		`quiz round1: question "q4" does not exist`,
+		`quiz round1: current question "q2" is not one of its questions`,
+		`schedule live: ended at 2024-12-07T09:00:00Z`,
+		`template pol-results.tmpl: is never used`,
+		`template poll-update.tmpl: `,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("problems =\n%s\nwant %d", strings.Join(got, "\n"), len(want))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("problem %d = %q, want %q...", i, got[i], want[i])
+		}
+	}
+	if !strings.Contains(got[len(got)-1], "can't evaluate field Polls") {
+		t.Errorf("template problem = %q, want the misspelt field", got[len(got)-1])
+	}
+}
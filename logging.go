@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logLevels are the names log.level accepts.
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// setupLogging makes the process log structured records to stderr at
+// cfg.Level, as text or as JSON for log collectors. validate has already
+// checked the level and format.
+func setupLogging(cfg LogConfig) {
+	opts := &slog.HandlerOptions{Level: logLevels[strings.ToLower(cfg.Level)]}
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if cfg.Format == "json" {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// fatal logs msg as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+type loggerKey struct{}
+
+// withLogger returns ctx carrying l, for loggerFrom.
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// loggerFrom returns the logger ctx carries, or the default one. Work done
+// for one audience message logs through it, so every record of the message
+// has its correlation ID.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// withCorrelation returns ctx with a logger for handling msg, tagged with
+// the message, a new correlation ID and the trace ctx is part of, if any.
+func withCorrelation(ctx context.Context, msg *Message) context.Context {
+	l := slog.Default().With("correlationId", newID("corr"), "messageId", msg.ID)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsSampled() {
+		l = l.With("traceId", sc.TraceID().String())
+	}
+	return withLogger(ctx, l)
+}
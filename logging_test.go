@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestMessageRecordsShareCorrelationID(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "It is.", nil
+	}))
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "Is the keynote recorded?"})
+	msg, _ := store.Message("m1")
+	if err := b.handleUserMessage(withCorrelation(context.Background(), &msg), &msg, answerPublic); err != nil {
+		t.Fatal(err)
+	}
+
+	var correlationID string
+	stages := map[string]bool{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var rec struct {
+			Msg           string `json:"msg"`
+			CorrelationID string `json:"correlationId"`
+			MessageID     string `json:"messageId"`
+		}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.CorrelationID == "" || rec.MessageID != "m1" {
+			continue
+		}
+		if correlationID != "" && rec.CorrelationID != correlationID {
+			t.Errorf("record %q has correlation ID %s, want %s", rec.Msg, rec.CorrelationID, correlationID)
+		}
+		correlationID = rec.CorrelationID
+		stages[rec.Msg] = true
+	}
+	for _, stage := range []string{"message received", "response generated", "response written", "message processed"} {
+		if !stages[stage] {
+			t.Errorf("no %q record for the message; got %v", stage, stages)
+		}
+	}
+}
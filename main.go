@@ -3,322 +3,593 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"sort"
 	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
-	"github.com/firebase/genkit/go/ai"
-	"github.com/firebase/genkit/go/plugins/googleai"
+	"github.com/google/gops/agent"
 	"github.com/joho/godotenv"
-	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 type Message struct {
 	ID        string    `firestore:"id"`
+	UserID    string    `firestore:"userId,omitempty"`
 	Message   string    `firestore:"message"`
 	Timestamp time.Time `firestore:"timestamp"`
 	Processed bool      `firestore:"processed"`
+	// ReplyTo is set by clients when a message follows up on a host reply.
+	ReplyTo string `firestore:"replyTo,omitempty"`
+	// Reactions is maintained by the frontend on host replies (emoji -> count).
+	Reactions map[string]int `firestore:"reactions,omitempty"`
+	// Context is the conversation summary a host reply was generated from.
+	Context string `firestore:"context,omitempty"`
+	// Question is the audience question a host reply answers, rephrased
+	// for display.
+	Question string `firestore:"question,omitempty"`
+	// Shard is written by clients when the backend is sharded.
+	Shard int `firestore:"shard,omitempty"`
+	// ClaimedBy and ClaimedAt are the lease of the instance answering the
+	// message; see MessageStore.Claim.
+	ClaimedBy string    `firestore:"claimedBy,omitempty"`
+	ClaimedAt time.Time `firestore:"claimedAt,omitempty"`
+	// DeadLettered is set on messages moved to the dead-letter collection.
+	DeadLettered bool `firestore:"deadLettered,omitempty"`
+	// Section is the seating section the sender is in, if the app knows.
+	Section string `firestore:"section,omitempty"`
+	// Triage is the ingest worker's decision on a message in the response
+	// queue: public, private or drop.
+	Triage string `firestore:"triage,omitempty"`
+	// Streaming is set on a host reply while the model is still writing it.
+	Streaming bool `firestore:"streaming,omitempty"`
+	// SessionID is written by clients for signed-out audience members, so
+	// they are rate limited like everyone else.
+	SessionID string `firestore:"sessionId,omitempty"`
+	// Persona and Variant are the persona and prompt variant a host reply
+	// was written with; see experiment.go.
+	Persona string `firestore:"persona,omitempty"`
+	Variant string `firestore:"variant,omitempty"`
+	// Language is the language a host reply was written in; see
+	// language.go.
+	Language string `firestore:"language,omitempty"`
+	// Audio is written by clients on a voice note, the URL of its
+	// recording, with Message left empty for the backend to fill in with
+	// what was said; see transcribe.go.
+	Audio string `firestore:"audio,omitempty"`
+	// PairID links the two pings of a bilingual host message, each to the
+	// other; see bilingual.go.
+	PairID string `firestore:"pairId,omitempty"`
+	// AudioURL is a host reply read out for the PA; see speech.go.
+	AudioURL string `firestore:"audioUrl,omitempty"`
+	// ImageURL is a picture drawn for a host reply to an audience message
+	// that asked for one; see imagereplies.go.
+	ImageURL string `firestore:"imageUrl,omitempty"`
+	// Lifeline is set on the result of a lifeline command; see
+	// lifeline.go.
+	Lifeline string `firestore:"lifeline,omitempty"`
+	// InReplyTo, RecipientID and ThreadID place a host reply in its thread;
+	// see thread.go.
+	InReplyTo   string `firestore:"inReplyTo,omitempty"`
+	RecipientID string `firestore:"recipientId,omitempty"`
+	ThreadID    string `firestore:"threadId,omitempty"`
 }
 
 type PollOption struct {
 	OpText string   `firestore:"text"`
 	Label  string   `firestore:"label"`
 	Voters []string `firestore:"voters"`
+	// ImageURL is a picture shown with the option, for visual questions;
+	// see pollimages.go.
+	ImageURL string `firestore:"imageUrl,omitempty"`
 }
 
 type PollQuestion struct {
 	Question string                `firestore:"question"`
 	Options  map[string]PollOption `firestore:"options"`
+	// Correct is the options key of the right answer, for quiz questions.
+	Correct string `firestore:"correct,omitempty"`
+	// AllowedVoters, when set, restricts whose votes count.
+	AllowedVoters []string          `firestore:"allowedVoters,omitempty"`
+	Eligibility   *EligibilityRules `firestore:"eligibility,omitempty"`
+	ClosesAt      time.Time         `firestore:"closesAt,omitempty"`
+	// Generated is set on polls the model wrote; see pollgen.go.
+	Generated bool `firestore:"generated,omitempty"`
+	// Closed is set by organizers to end voting; MaxVotes, if set, ends it
+	// once that many eligible votes are in. ResultsAnnounced is set once
+	// the host has announced the results; see pollresults.go.
+	Closed           bool `firestore:"closed,omitempty"`
+	MaxVotes         int  `firestore:"maxVotes,omitempty"`
+	ResultsAnnounced bool `firestore:"resultsAnnounced,omitempty"`
+
+	// Kind is "numeric" for a poll answered with a number in Range instead
+	// of an option; Answers holds each voter's number. See pollnumeric.go.
+	Kind    string             `firestore:"kind,omitempty"`
+	Range   *NumericRange      `firestore:"range,omitempty"`
+	Answers map[string]float64 `firestore:"answers,omitempty"`
+	// An open-text poll, of kind "text", has each voter's words in
+	// TextAnswers, and the Themes the model found in them once it closes.
+	// See pollthemes.go.
+	TextAnswers map[string]string `firestore:"textAnswers,omitempty"`
+	Themes      []PollTheme       `firestore:"themes,omitempty"`
+	// Wagers are the leaderboard points players bet on the outcome, settled
+	// into WagerResults once it closes. See wagers.go.
+	Wagers        map[string]Wager `firestore:"wagers,omitempty"`
+	WagersSettled bool             `firestore:"wagersSettled,omitempty"`
+	WagerResults  []WagerResult    `firestore:"wagerResults,omitempty"`
+	// A Buzzer question belongs to the first player to buzz in, the
+	// BuzzOwner, whose answer alone counts. Buzzes holds every buzz by
+	// player. See buzzer.go.
+	Buzzer        bool            `firestore:"buzzer,omitempty"`
+	Buzzes        map[string]Buzz `firestore:"buzzes,omitempty"`
+	BuzzOwner     string          `firestore:"buzzOwner,omitempty"`
+	BuzzAnnounced bool            `firestore:"buzzAnnounced,omitempty"`
 }
 
-var (
-	lastUserMessage     time.Time
-	conversationSummary string
-	lastResponseTime    time.Time
-	mu                  sync.Mutex
-	model               ai.Model
-)
-
 func main() {
 	godotenv.Load()
 
-	serviceAccountPath := ".keys/serviceAccountKey.json"
-	userCollection := "devfest-chennai-user"
-	pingCollection := "devfest-chennai-pings"
-	pollCollection := "devfest-chennai-poll"
-
-	ctx := context.Background()
-
-	// Initialize Google AI once
-	if err := googleai.Init(ctx, nil); err != nil {
-		log.Fatalf("Error initializing Google AI: %v", err)
-	}
-	model = googleai.Model("gemini-1.5-flash")
-	if model == nil {
-		log.Fatalf("Could not find Gemini model")
+	cfg, err := loadConfig()
+	if err != nil {
+		fatal("error loading config", "err", err)
 	}
+	setupLogging(cfg.Log)
+	shutdownTracing := setupTracing(cfg.Tracing)
+	defer func() {
+		// Flush the spans of the last messages answered.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("error flushing traces", "err", err)
+		}
+	}()
 
-	var wg sync.WaitGroup
-	wg.Add(2)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	go func() {
-		defer wg.Done()
-		err := markExistingMessagesAsProcessed(ctx, serviceAccountPath, userCollection)
-		if err != nil {
-			log.Fatalf("Error marking existing messages: %v", err)
-		}
+	if cfg.Seed != nil {
+		vc := enableSeedMode(*cfg.Seed, cfg.FakeClockStart)
+		go vc.Run(ctx, cfg.ClockSpeed)
+	}
 
-		err = listenForNewUserMessages(ctx, os.Stdout, serviceAccountPath, userCollection, pingCollection)
-		if err != nil {
-			log.Fatalf("Error listening for new user messages: %v", err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "highlights":
+			err = runHighlights(ctx, os.Stdout, os.Args[2:], cfg)
+		case "export":
+			err = runExport(ctx, os.Stdout, os.Args[2:], cfg)
+		case "prizes-report":
+			err = runPrizesReport(ctx, os.Stdout, os.Args[2:], cfg)
+		case "sponsor-report":
+			err = runSponsorReport(ctx, os.Stdout, os.Args[2:], cfg)
+		case "gap-report":
+			err = runGapReport(ctx, os.Stdout, os.Args[2:], cfg)
+		case "migrate":
+			err = runMigrate(ctx, os.Stdout, os.Args[2:], cfg)
+		case "replay":
+			err = runReplay(ctx, os.Stdout, os.Args[2:], cfg)
+		case "lint":
+			err = runLint(ctx, os.Stdout, os.Args[2:], cfg)
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
 		}
-	}()
-
-	go func() {
-		defer wg.Done()
-		err := monitorAndRespond(ctx, os.Stdout, serviceAccountPath, userCollection, pingCollection, pollCollection)
 		if err != nil {
-			log.Fatalf("Error monitoring and responding: %v", err)
+			fatal("error running command", "command", os.Args[1], "err", err)
 		}
-	}()
-
-	wg.Wait()
-}
+		return
+	}
 
-// Mark all existing unprocessed messages as processed and skip them.
-func markExistingMessagesAsProcessed(ctx context.Context, serviceAccountPath, userCollection string) error {
-	sa := option.WithCredentialsFile(serviceAccountPath)
-	app, err := firebase.NewApp(ctx, nil, sa)
+	// Initialize the model backend once
+	model, fallbackModel, err := newGenerators(ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("error initializing app: %w", err)
+		fatal("error initializing model backend", "err", err)
 	}
 
-	client, err := app.Firestore(ctx)
+	// The show-log records the model's every reply, for replaying with.
+	var showLog *showRecorder
+	if cfg.ShowLog != "" {
+		if showLog, err = openShowLog(cfg.ShowLog); err != nil {
+			fatal("error opening show-log", "err", err)
+		}
+		defer showLog.Close()
+		// Random choices are replayed from the same seed.
+		seed := time.Now().UnixNano()
+		if cfg.Seed != nil {
+			seed = *cfg.Seed
+		} else {
+			seedRand(seed)
+		}
+		showLog.record(ShowLogEntry{Kind: showStart, Config: cfg.redacted(), Seed: seed})
+		model = recordedModel{name: "model", model: model, log: showLog}
+		fallbackModel = recordedModel{name: "fallback", model: fallbackModel, log: showLog}
+	}
+
+	client, err := newFirestoreClient(ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("error initializing Firestore: %w", err)
+		fatal("error initializing Firestore", "err", err)
 	}
 	defer client.Close()
 
-	iter := client.Collection(userCollection).Where("processed", "==", false).Documents(ctx)
-	defer iter.Stop()
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
+	bot, err := NewBot(cfg, client, model, fallbackModel)
+	if err != nil {
+		fatal("error creating bot", "err", err)
+	}
+	bot.showLog = showLog
+	if cfg.Polls.ImageBucket != "" {
+		images, err := newStorageImages(ctx, cfg, cfg.Polls.ImageBucket)
+		if err != nil {
+			fatal("error initializing poll images", "err", err)
 		}
+		bot.images = images
+	}
+	if cfg.Transcription.Enabled {
+		transcriber, err := newCloudTranscriber(ctx, cfg)
 		if err != nil {
-			return fmt.Errorf("error iterating through unprocessed messages: %w", err)
+			fatal("error initializing transcription", "err", err)
 		}
-
-		// Mark the message as processed immediately
-		_, err = doc.Ref.Update(ctx, []firestore.Update{
-			{Path: "processed", Value: true},
-		})
+		bot.transcriber = transcriber
+	}
+	if cfg.Speech.Enabled {
+		speech, err := newCloudSpeech(ctx, cfg)
 		if err != nil {
-			return fmt.Errorf("error marking message as processed: %w", err)
+			fatal("error initializing speech", "err", err)
 		}
+		audio, err := newStorageImages(ctx, cfg, cfg.Speech.Bucket)
+		if err != nil {
+			fatal("error initializing speech audio", "err", err)
+		}
+		bot.speech, bot.audio = speech, audio
+	}
 
-		fmt.Printf("Existing message marked as processed: %s\n", doc.Ref.ID)
+	// Each worker is restarted with backoff if it fails; SIGINT/SIGTERM
+	// cancels ctx, which stops the listeners and tickers, and main returns
+	// once they have all wound down.
+	var wg sync.WaitGroup
+	start := func(name string, fn func(ctx context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bot.supervisor.supervise(ctx, name, fn)
+		}()
 	}
 
-	return nil
-}
+	// Secondary shards only answer their share of messages.
+	primary := cfg.isPrimary()
 
-// This function listens for only new incoming user messages (already processed messages are skipped).
-func listenForNewUserMessages(ctx context.Context, w io.Writer, serviceAccountPath, userCollection, pingCollection string) error {
-	sa := option.WithCredentialsFile(serviceAccountPath)
-	app, err := firebase.NewApp(ctx, nil, sa)
-	if err != nil {
-		return fmt.Errorf("error initializing app: %w", err)
+	if cfg.AdminAddr != "" {
+		start("admin API", func(ctx context.Context) error {
+			return bot.serveAdmin(ctx)
+		})
 	}
-
-	client, err := app.Firestore(ctx)
-	if err != nil {
-		return fmt.Errorf("error initializing Firestore: %w", err)
+	if cfg.APIAddr != "" {
+		start("REST API", func(ctx context.Context) error {
+			return bot.serveAPI(ctx)
+		})
+	}
+	if cfg.HealthAddr != "" {
+		start("health probes", func(ctx context.Context) error {
+			return bot.serveHealth(ctx)
+		})
+	}
+	if cfg.GopsAddr != "" {
+		if err := agent.Listen(agent.Options{Addr: cfg.GopsAddr}); err != nil {
+			fatal("error starting the gops agent", "err", err)
+		}
+		defer agent.Close()
 	}
-	defer client.Close()
 
-	// Listen for new unprocessed messages
-	it := client.Collection(userCollection).Where("processed", "==", false).Snapshots(ctx)
-	for {
-		snap, err := it.Next()
-		if status.Code(err) == codes.DeadlineExceeded {
-			fmt.Fprintln(w, "Timeout reached")
-			return nil
+	// A standby mirrors the active instance and does nothing else until it
+	// is promoted; it then answers the messages left pending rather than
+	// skipping them.
+	if cfg.Standby {
+		if err := bot.standBy(ctx); err != nil {
+			fatal("error standing by", "err", err)
 		}
-		if err != nil {
-			return fmt.Errorf("Snapshots.Next: %w", err)
+		if ctx.Err() != nil {
+			wg.Wait()
+			slog.Info("shut down cleanly")
+			return
 		}
+	}
 
-		for {
-			doc, err := snap.Documents.Next()
-			if err == iterator.Done {
-				break
-			}
-			if err != nil {
-				return fmt.Errorf("Documents.Next: %w", err)
-			}
+	// A restart picks up where the last run left off; a promoted standby
+	// already mirrors the active instance instead.
+	if !cfg.Standby {
+		if err := bot.restoreState(ctx); err != nil {
+			slog.Error("error restoring bot state, starting afresh", "err", err)
+		}
+	}
 
-			var msg Message
-			err = doc.DataTo(&msg)
-			if err != nil {
-				return fmt.Errorf("error converting document to message: %w", err)
+	// Existing messages are skipped once at startup, not on every restart,
+	// so messages that arrive while the listener is backing off get answered.
+	// Responders skip nothing: queued messages were already accepted.
+	skippedExisting := cfg.Role == roleResponder || cfg.Standby
+	start("message listener", func(ctx context.Context) error {
+		if !skippedExisting {
+			if err := bot.markExistingMessagesAsProcessed(ctx); err != nil {
+				return fmt.Errorf("error marking existing messages: %w", err)
 			}
+			skippedExisting = true
+		}
+		return bot.listenForNewUserMessages(ctx)
+	})
 
-			// Lock the entire message processing flow
-			mu.Lock()
-			lastUserMessage = time.Now()
-
-			// Generate response
-			responseMessage, err := generateResponse(ctx, msg.Message, conversationSummary)
-			if err != nil {
-				mu.Unlock()
-				return fmt.Errorf("error generating response: %w", err)
-			}
+	if showLog != nil {
+		start("show-log", func(ctx context.Context) error {
+			return bot.recordShow(ctx)
+		})
+	}
+	start("moderation recorder", func(ctx context.Context) error {
+		return bot.recordModerationFlags(ctx)
+	})
+	start("cost reporter", func(ctx context.Context) error {
+		return bot.reportCosts(ctx)
+	})
+	start("counters", func(ctx context.Context) error {
+		return bot.writeCounters(ctx)
+	})
+	if cfg.Role != roleResponder {
+		start("block list", func(ctx context.Context) error {
+			return bot.watchBlockList(ctx)
+		})
+	}
 
-			// Write response to Firestore
-			err = writeMessage(ctx, client, pingCollection, doc.Ref.ID, responseMessage)
-			if err != nil {
-				mu.Unlock()
-				return fmt.Errorf("error writing response message: %w", err)
-			}
+	// Ingest workers only triage messages into the response queue.
+	if cfg.Role == roleIngest {
+		wg.Wait()
+		slog.Info("shut down cleanly")
+		return
+	}
 
-			// Mark the message as processed
-			_, err = doc.Ref.Update(ctx, []firestore.Update{
-				{Path: "processed", Value: true},
-			})
-			if err != nil {
-				mu.Unlock()
-				return fmt.Errorf("error marking message as processed: %w", err)
-			}
+	start("word cloud", func(ctx context.Context) error {
+		return bot.collectWordCloud(ctx)
+	})
+	start("queue status", func(ctx context.Context) error {
+		return bot.publishQueueStatus(ctx)
+	})
+	start("answer SLA", func(ctx context.Context) error {
+		return bot.monitorSLA(ctx)
+	})
+	start("conversation memory", func(ctx context.Context) error {
+		return bot.rememberConversation(ctx)
+	})
+	start("conversation summarizer", func(ctx context.Context) error {
+		return bot.summarizeConversation(ctx)
+	})
+	start("state checkpoint", func(ctx context.Context) error {
+		return bot.checkpointState(ctx)
+	})
+	start("section activity", func(ctx context.Context) error {
+		return bot.collectSectionActivity(ctx)
+	})
+	start("transcript", func(ctx context.Context) error {
+		return bot.recordTranscript(ctx)
+	})
+	if cfg.Speech.Enabled {
+		start("speech", func(ctx context.Context) error {
+			return bot.speakReplies(ctx)
+		})
+	}
+	if bot.drawings != nil {
+		start("reply images", func(ctx context.Context) error {
+			return bot.drawReplies(ctx)
+		})
+	}
+	start("knowledge gap recorder", func(ctx context.Context) error {
+		return bot.recordKnowledgeGaps(ctx)
+	})
 
-			// Update last response time
-			lastResponseTime = time.Now()
-			fmt.Fprintf(w, "Response written: %v\n", responseMessage)
+	if primary && (cfg.Failover || cfg.Standby) {
+		start("failover heartbeat", func(ctx context.Context) error {
+			return bot.heartbeat(ctx, stop)
+		})
+	}
+	if primary {
+		start("monitor", func(ctx context.Context) error {
+			return bot.monitorAndRespond(ctx)
+		})
+	} else {
+		start("shard activity reporter", func(ctx context.Context) error {
+			return bot.reportShardActivity(ctx)
+		})
+	}
 
-			// Unlock after everything is complete
-			mu.Unlock()
+	if primary {
+		start("dead-letter requeue", func(ctx context.Context) error {
+			return bot.requeueDeadLetters(ctx)
+		})
+		start("announcement scheduler", func(ctx context.Context) error {
+			return bot.runAnnouncementScheduler(ctx)
+		})
+		start("content calendar", func(ctx context.Context) error {
+			return bot.runCalendar(ctx)
+		})
+		if len(cfg.Experiment.Variants) > 0 {
+			start("reply feedback", func(ctx context.Context) error {
+				return bot.collectFeedback(ctx)
+			})
 		}
 	}
-}
 
-func monitorAndRespond(ctx context.Context, w io.Writer, serviceAccountPath, userCollection, pingCollection, pollCollection string) error {
-	sa := option.WithCredentialsFile(serviceAccountPath)
-	app, err := firebase.NewApp(ctx, nil, sa)
-	if err != nil {
-		return fmt.Errorf("error initializing app: %w", err)
+	if primary {
+		start("gap reports", func(ctx context.Context) error {
+			return bot.runGapReports(ctx)
+		})
 	}
 
-	client, err := app.Firestore(ctx)
-	if err != nil {
-		return fmt.Errorf("error initializing Firestore: %w", err)
+	if primary && bot.eventbrite != nil {
+		start("Eventbrite sync", func(ctx context.Context) error {
+			return bot.syncEventbriteCheckins(ctx)
+		})
 	}
-	defer client.Close()
 
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			mu.Lock()
-			currentTime := time.Now()
+	if primary && len(cfg.retentionPolicies) > 0 {
+		start("retention worker", func(ctx context.Context) error {
+			return bot.runRetentionWorker(ctx)
+		})
+	}
 
-			pollSummary, err := fetchPollStatus(ctx, client, pollCollection)
-			if err != nil {
-				mu.Unlock()
-				return fmt.Errorf("error fetching poll status: %w", err)
-			}
+	wg.Wait()
+	slog.Info("shut down cleanly")
+}
 
-			updateConversationSummary(pollSummary)
-
-			if currentTime.Sub(lastUserMessage) > 30*time.Second && currentTime.Sub(lastResponseTime) >= 10*time.Second {
-				promptMessage, err := generateResponse(ctx, "prompt", conversationSummary)
-				if err != nil {
-					mu.Unlock()
-					return fmt.Errorf("error generating prompt: %w", err)
-				}
-
-				err = writeMessage(ctx, client, pingCollection, "host-prompt", promptMessage)
-				if err != nil {
-					mu.Unlock()
-					return fmt.Errorf("error writing prompt message: %w", err)
-				}
-				lastResponseTime = currentTime
-			} else if currentTime.Sub(lastResponseTime) >= 15*time.Second {
-				updateMessage := fmt.Sprintf("Poll update: %s", pollSummary)
-
-				promptMessage, err := generateResponse(ctx, "poll-update", updateMessage)
-				if err != nil {
-					mu.Unlock()
-					return fmt.Errorf("error generating prompt: %w", err)
-				}
-
-				err = writeMessage(ctx, client, pingCollection, "host-prompt", promptMessage)
-				if err != nil {
-					mu.Unlock()
-					return fmt.Errorf("error writing prompt message: %w", err)
-				}
-				lastResponseTime = currentTime
-			}
+// emulatorProject is the project the Firestore emulator is used under
+// when neither ProjectID nor GOOGLE_CLOUD_PROJECT is set. The "demo-"
+// prefix is what the Firebase emulators expect of a project that doesn't
+// exist.
+const emulatorProject = "demo-kbc"
+
+// defaultServiceAccountPath is the key file used when ServiceAccountPath
+// isn't set, if it exists.
+const defaultServiceAccountPath = ".keys/serviceAccountKey.json"
+
+// serviceAccountFile returns the service account key file to authenticate
+// with: ServiceAccountPath, or the default key file if that exists. It is
+// empty when there is none, and Application Default Credentials are used
+// instead: workload identity on Cloud Run and GKE, or gcloud's login on a
+// laptop.
+func serviceAccountFile(cfg *Config) string {
+	if cfg.ServiceAccountPath != "" {
+		return cfg.ServiceAccountPath
+	}
+	if _, err := os.Stat(defaultServiceAccountPath); err == nil {
+		return defaultServiceAccountPath
+	}
+	return ""
+}
 
-			mu.Unlock()
-		}
+// googleClientOptions are the options for every Google Cloud client: the
+// service account key, if there is one.
+func googleClientOptions(cfg *Config) []option.ClientOption {
+	if path := serviceAccountFile(cfg); path != "" {
+		return []option.ClientOption{option.WithCredentialsFile(path)}
 	}
+	return nil
 }
 
-func fetchPollStatus(ctx context.Context, client *firestore.Client, pollCollection string) (string, error) {
-	doc, err := client.Collection(pollCollection).Doc("q1").Get(ctx)
-	if err != nil {
-		return "", fmt.Errorf("error fetching poll document: %w", err)
+// newFirestoreClient opens the one Firestore client a process uses, shared
+// by the bot and all its workers, or by a CLI command. When
+// FIRESTORE_EMULATOR_HOST is set it connects to the emulator there, which
+// needs no credentials. The project is ProjectID if set, or else taken from
+// GOOGLE_CLOUD_PROJECT, the key file or the ambient credentials.
+func newFirestoreClient(ctx context.Context, cfg *Config) (*firestore.Client, error) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") != "" {
+		project := cfg.ProjectID
+		if project == "" {
+			project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+		}
+		if project == "" {
+			project = emulatorProject
+		}
+		client, err := firestore.NewClient(ctx, project)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting to the Firestore emulator: %w", err)
+		}
+		return client, nil
 	}
 
-	var pollQuestion PollQuestion
-	if err := doc.DataTo(&pollQuestion); err != nil {
-		return "", fmt.Errorf("error converting document to PollQuestion: %w", err)
+	var appConfig *firebase.Config
+	if cfg.ProjectID != "" {
+		appConfig = &firebase.Config{ProjectID: cfg.ProjectID}
+	}
+	app, err := firebase.NewApp(ctx, appConfig, googleClientOptions(cfg)...)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing app: %w", err)
 	}
 
-	var summary string
-	summary += fmt.Sprintf("Question: %s\n", pollQuestion.Question)
-	for _, opt := range pollQuestion.Options {
-		summary += fmt.Sprintf("%s - %s: %d votes\n", opt.Label, opt.OpText, len(opt.Voters))
+	client, err := app.Firestore(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Firestore: %w", err)
 	}
-	return summary, nil
+	return client, nil
 }
 
-func updateConversationSummary(pollSummary string) {
-	conversationSummary = fmt.Sprintf("Current poll status:\n%s\nConversation history: [Add relevant conversation history here]", pollSummary)
+// tallyLivePoll reads the active poll and counts its eligible votes.
+func (b *Bot) tallyLivePoll(ctx context.Context) (*PollTally, error) {
+	return b.tallyPollDoc(ctx, b.activePollID())
 }
 
-func generateResponse(ctx context.Context, userMessage, conversationSummary string) (string, error) {
-	requestText := fmt.Sprintf("Always reply in English. You're Amitabh Bachchan, hosting Kaun Banega Crorepati. Current status:\n%s\nUser said: %s\nRespond in Amitabh's style, max 30 words. Be witty and professional. Do not say anything that can be taken as abusive.", conversationSummary, userMessage)
-
-	resp, err := model.Generate(ctx,
-		ai.NewGenerateRequest(
-			&ai.GenerationCommonConfig{Temperature: 1},
-			ai.NewUserTextMessage(requestText)),
-		nil)
+// tallyPollDoc reads poll id and counts its eligible votes.
+func (b *Bot) tallyPollDoc(ctx context.Context, id string) (*PollTally, error) {
+	pollQuestion, err := b.polls.Poll(ctx, id)
 	if err != nil {
-		return "", fmt.Errorf("gemini model error: %w", err)
+		return nil, err
 	}
+	anon := b.pseudonyms.mapper(ctx, b.client, b.cfg.Collections.Pseudonyms)
+	tally, err := tallyPoll(ctx, b.eligibility, anon, *pollQuestion)
+	if err != nil {
+		return nil, fmt.Errorf("error tallying poll: %w", err)
+	}
+	tally.ID = id
+	return tally, nil
+}
 
-	return resp.Text(), nil
+// fetchPollStatus summarizes the active poll, and only it, for the host's prompt context.
+// Eligibility rules that look at other polls, profiles or check-ins are
+// still read from Firestore.
+func (b *Bot) fetchPollStatus(ctx context.Context) (string, error) {
+	b.metrics.pollFetches.Add(1)
+	tally, err := b.tallyLivePoll(ctx)
+	if err == nil && b.awardBuzz(ctx, tally) {
+		// The question has just got its owner, whose vote alone counts.
+		tally, err = b.tallyLivePoll(ctx)
+	}
+	if err != nil {
+		b.metrics.pollFetchFailures.Add(1)
+		return "", err
+	}
+	if err := b.clusterPollAnswers(ctx, tally); err != nil {
+		slog.Error("error grouping poll answers into themes, will retry", "poll", tally.ID, "err", err)
+	}
+	if err := b.settlePollWagers(ctx, tally); err != nil {
+		slog.Error("error settling poll wagers, will retry", "poll", tally.ID, "err", err)
+	}
+	b.notePollResults(tally)
+	b.noteBuzz(tally)
+	if len(tally.Ineligible) > 0 {
+		if err := b.polls.RecordIneligible(ctx, tally.ID, tally.Ineligible); err != nil {
+			return "", fmt.Errorf("error recording ineligible votes: %w", err)
+		}
+	}
+	return pollSummary(tally, clock.Now()), nil
 }
 
-func writeMessage(ctx context.Context, client *firestore.Client, collection, id, message string) error {
-	_, err := client.Collection(collection).Doc(id).Set(ctx, Message{
-		ID:        id,
-		Message:   message,
-		Timestamp: time.Now(),
-		Processed: false,
-	})
-	return err
+// pollSummary is the host's view of tally at now: the question, every
+// option's votes in key order, whatever the poll's kind adds, and notes on
+// excluded votes and closing.
+func pollSummary(tally *PollTally, now time.Time) string {
+	pollQuestion := &tally.Poll
+	keys := make([]string, 0, len(pollQuestion.Options))
+	for key := range pollQuestion.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var summary string
+	summary += fmt.Sprintf("Question: %s\n", pollQuestion.Question)
+	for _, key := range keys {
+		opt := pollQuestion.Options[key]
+		summary += fmt.Sprintf("%s - %s: %d votes\n", opt.Label, opt.OpText, len(opt.Voters))
+	}
+	if pollQuestion.numeric() {
+		summary += numericSummary(*pollQuestion)
+	}
+	if pollQuestion.textual() {
+		summary += textSummary(*pollQuestion)
+	}
+	if !pollQuestion.WagersSettled {
+		summary += wagerSummary(*pollQuestion)
+	}
+	if len(tally.Ineligible) > 0 {
+		summary += fmt.Sprintf("(%d ineligible votes excluded)\n", len(tally.Ineligible))
+	}
+	if closed, _ := pollClosed(tally.Poll, now); closed {
+		summary += "(voting has closed)\n"
+	}
+	return summary
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// conversationTurn is one audience message or host reply.
+type conversationTurn struct {
+	At   time.Time `firestore:"at" json:"at"`
+	From string    `firestore:"from" json:"from"` // "Audience (<user ID>)" or "Host"
+	Text string    `firestore:"text" json:"text"`
+}
+
+// conversationMemory keeps the most recent turns verbatim and folds older
+// ones into a running summary written by the model, so the host's prompt
+// stays bounded however long the show runs.
+type conversationMemory struct {
+	maxTurns int
+
+	mu      sync.Mutex
+	turns   []conversationTurn
+	summary string
+	version int // of summary; 0 until the first one is written
+}
+
+func newConversationMemory(maxTurns int) *conversationMemory {
+	return &conversationMemory{maxTurns: maxTurns}
+}
+
+// add records a turn and reports whether the memory now holds more than
+// maxTurns, i.e. is due to be summarized.
+func (m *conversationMemory) add(t conversationTurn) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.turns = append(m.turns, t)
+	return len(m.turns) > m.maxTurns
+}
+
+// overflow returns the oldest turns to summarize, leaving half of maxTurns
+// so summarizing happens in batches, together with the current summary and
+// its version. It returns nothing while the memory holds at most maxTurns,
+// or with force, at most half of them. The turns stay in the memory, so the
+// host still sees them, until fold replaces them with the new summary.
+func (m *conversationMemory) overflow(force bool) (summary string, version int, old []conversationTurn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keep := m.maxTurns / 2
+	if len(m.turns) <= m.maxTurns && (!force || len(m.turns) <= keep) {
+		return "", 0, nil
+	}
+	old = append([]conversationTurn(nil), m.turns[:len(m.turns)-keep]...)
+	return m.summary, m.version, old
+}
+
+// fold drops the n oldest turns, which summary version now covers.
+func (m *conversationMemory) fold(summary string, version, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.turns = append([]conversationTurn(nil), m.turns[n:]...)
+	m.summary, m.version = summary, version
+}
+
+// restore picks up a summary persisted by an earlier run.
+func (m *conversationMemory) restore(v SummaryVersion) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.summary, m.version = v.Summary, v.Version
+}
+
+// snapshot returns a copy of the recent turns and the summary version.
+func (m *conversationMemory) snapshot() ([]conversationTurn, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]conversationTurn(nil), m.turns...), m.version
+}
+
+// mirror replaces the recent turns, and the summary too if v is set, with
+// those of the active instance.
+func (m *conversationMemory) mirror(turns []conversationTurn, v *SummaryVersion) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.turns = append([]conversationTurn(nil), turns...)
+	if v != nil {
+		m.summary, m.version = v.Summary, v.Version
+	}
+}
+
+// render is the conversation history for the host's prompt.
+func (m *conversationMemory) render() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.summary == "" && len(m.turns) == 0 {
+		return "(nothing yet, the show has just started)"
+	}
+	return renderHistory(m.summary, m.turns)
+}
+
+// parts returns the summary and a copy of the recent turns, for the
+// context guard to render less of them.
+func (m *conversationMemory) parts() (summary string, turns []conversationTurn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.summary, append([]conversationTurn(nil), m.turns...)
+}
+
+// renderHistory renders a summary, if any, and the turns after it.
+func renderHistory(summary string, turns []conversationTurn) string {
+	var b strings.Builder
+	if summary != "" {
+		fmt.Fprintf(&b, "Earlier: %s\n", summary)
+	}
+	formatTurns(&b, turns)
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func formatTurns(b *strings.Builder, turns []conversationTurn) {
+	for _, t := range turns {
+		fmt.Fprintf(b, "%s: %s\n", t.From, strings.TrimSpace(t.Text))
+	}
+}
+
+// summarizeTurns asks the model to fold old turns into the running summary.
+func summarizeTurns(ctx context.Context, model ResponseGenerator, summary string, old []conversationTurn) (string, error) {
+	var b strings.Builder
+	formatTurns(&b, old)
+	prompt := fmt.Sprintf(`You keep notes for the host of a live audience Q&A. Update the notes with the new part of the conversation.
+Keep them under 80 words: running jokes, questions asked more than once, and who asked what if it matters. Reply with the notes only.
+Notes so far: %s
+New conversation:
+%s`, summary, b.String())
+	text, err := model.Generate(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// rememberConversation records every audience message and host reply from
+// the bus, waking the summarizer when the memory is full.
+func (b *Bot) rememberConversation(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-b.history:
+			// The host said it once; its translation is left out.
+			if e.Pair != "" {
+				continue
+			}
+			turn := conversationTurn{At: e.At, From: "Host", Text: e.Text}
+			if e.Kind == EventMessageReceived {
+				turn.From = "Audience"
+				if e.UserID != "" {
+					turn.From = fmt.Sprintf("Audience (%s)", e.UserID)
+				}
+			}
+			if b.memory.add(turn) {
+				select {
+				case b.summarize <- struct{}{}:
+				default: // already pending
+				}
+			}
+			b.refreshSummary()
+		}
+	}
+}
+
+// summarizeConversation folds old turns into the conversation summary in
+// the background, whenever the memory fills up and at least every
+// SummaryInterval, and persists each new version. It resumes from the last
+// persisted version, so a restarted host remembers the show so far.
+func (b *Bot) summarizeConversation(ctx context.Context) error {
+	latest, err := b.summaries.LatestSummary(ctx)
+	if err != nil {
+		slog.Error("error loading conversation summary, starting afresh", "err", err)
+	} else if latest != nil {
+		b.memory.restore(*latest)
+		b.refreshSummary()
+	}
+
+	ticker := clock.NewTicker(b.cfg.Monitor.SummaryInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.summarize:
+			b.foldConversation(ctx, false)
+		case <-ticker.C():
+			b.foldConversation(ctx, true)
+		}
+	}
+}
+
+// foldConversation summarizes the memory's overflow through the ladder's
+// model; with force, it does so even though the memory is not yet full. If
+// the model is unavailable a full memory's overflow is dropped and the
+// previous summary kept.
+func (b *Bot) foldConversation(ctx context.Context, force bool) {
+	summary, version, old := b.memory.overflow(force)
+	if len(old) == 0 {
+		return
+	}
+	ctx = b.costs.attribute(ctx, featureSummary)
+	b.costs.item(featureSummary)
+	updated, err := summarizeTurns(ctx, b.ladderModel(), summary, old)
+	if err != nil {
+		if !force {
+			slog.Error("error summarizing conversation, dropping old turns", "turns", len(old), "err", err)
+			b.memory.fold(summary, version, len(old))
+			b.refreshSummary()
+		}
+		return
+	}
+
+	v := SummaryVersion{Version: version + 1, Summary: updated, Turns: len(old), CreatedAt: clock.Now()}
+	b.memory.fold(v.Summary, v.Version, v.Turns)
+	b.refreshSummary()
+	if err := b.summaries.SaveSummary(ctx, v); err != nil {
+		slog.Error("error saving conversation summary", "summaryVersion", v.Version, "err", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConversationMemoryOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		turns    int
+		force    bool
+		wantOld  int
+		wantFull bool
+	}{
+		{"within bounds", 4, false, 0, false},
+		{"full", 5, false, 3, true},
+		{"forced below half", 2, true, 0, false},
+		{"forced above half", 3, true, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newConversationMemory(4)
+			var full bool
+			for i := 1; i <= tt.turns; i++ {
+				full = m.add(conversationTurn{From: "Host", Text: fmt.Sprint(i)})
+			}
+			if full != tt.wantFull {
+				t.Errorf("add reported full = %v, want %v", full, tt.wantFull)
+			}
+			if _, _, old := m.overflow(tt.force); len(old) != tt.wantOld || (len(old) > 0 && old[0].Text != "1") {
+				t.Errorf("overflow = %v, want the first %d turns", old, tt.wantOld)
+			}
+		})
+	}
+}
+
+func TestConversationMemoryFold(t *testing.T) {
+	m := newConversationMemory(4)
+	for i := 1; i <= 5; i++ {
+		m.add(conversationTurn{From: "Host", Text: fmt.Sprint(i)})
+	}
+	_, _, old := m.overflow(false)
+	m.add(conversationTurn{From: "Host", Text: "6"}) // arrives while summarizing
+	m.fold("counted to three", 1, len(old))
+	if got, want := m.render(), "Earlier: counted to three\nHost: 4\nHost: 5\nHost: 6"; got != want {
+		t.Errorf("render = %q, want %q", got, want)
+	}
+	if summary, version, _ := m.overflow(true); summary != "counted to three" || version != 1 {
+		t.Errorf("summary = %q version %d, want version 1", summary, version)
+	}
+}
+
+func TestSummarizerPersistsVersions(t *testing.T) {
+	summarized := make(chan string, 1)
+	model := generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		summarized <- prompt
+		return "ann asked about Gemini twice", nil
+	})
+	store := newMemoryStore()
+	store.SaveSummary(context.Background(), SummaryVersion{Version: 3, Summary: "the show opened with a quiz"})
+	b := newTestBot(t, store, model)
+	b.memory = newConversationMemory(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.rememberConversation(ctx)
+	go b.summarizeConversation(ctx)
+
+	b.bus.Publish(Event{Kind: EventMessageReceived, UserID: "ann", Text: "What is Gemini?"})
+	b.bus.Publish(Event{Kind: EventResponsePublished, MessageID: "m1", Text: "A model, devi ji."})
+	b.bus.Publish(Event{Kind: EventMessageReceived, UserID: "ann", Text: "No really, what is Gemini?"})
+
+	select {
+	case prompt := <-summarized:
+		for _, want := range []string{"Notes so far: the show opened with a quiz", "Audience (ann): What is Gemini?", "Host: A model, devi ji."} {
+			if !strings.Contains(prompt, want) {
+				t.Errorf("summary prompt missing %q:\n%s", want, prompt)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("memory never summarized")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		latest, _ := store.LatestSummary(ctx)
+		if latest.Version == 4 {
+			if latest.Summary != "ann asked about Gemini twice" || latest.Turns != 2 {
+				t.Errorf("saved version = %+v, want the model's summary of 2 turns", latest)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("latest summary = %+v, want version 4", latest)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := b.room.getSummary(); !strings.Contains(got, "Earlier: ann asked about Gemini twice\nAudience (ann): No really, what is Gemini?") {
+		t.Errorf("prompt context = %q, want the new summary and the latest turn", got)
+	}
+}
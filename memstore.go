@@ -0,0 +1,1128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore is an in-process implementation of every store for local runs
+// and tests. Messages are delivered to watchers in the order they were added.
+type memoryStore struct {
+	mu       sync.Mutex
+	messages map[string]*Message
+	order    []string
+	replies  map[string]*Message
+	// private holds replies written with WritePrivateReply, by message ID.
+	private map[string]*Message
+	polls   map[string]*PollQuestion
+	// deadLetters holds what DeadLetter stored, by message ID.
+	deadLetters map[string]*DeadLetter
+	// summaries holds every saved summary version, oldest first.
+	summaries []SummaryVersion
+	// announcements holds every scheduled announcement, by ID.
+	announcements map[string]*ScheduledAnnouncement
+	// queue holds what Enqueue stored, by message ID.
+	queue map[string]*Message
+	// failover is the failover document, nil until it is first written.
+	failover *FailoverState
+	// costReports holds the last SaveCostReport for each report ID.
+	costReports map[string]CostReport
+	// blocked holds what BlockUser stored, by user ID.
+	blocked map[string]BlockedUser
+	// transcript holds every appended transcript entry, in order.
+	transcript []TranscriptEntry
+	// ineligible holds what RecordIneligible stored, by poll ID.
+	ineligible map[string]map[string]IneligibleVote
+	// calendar holds the content calendar days, by ID, and quizActive
+	// what SetQuizActive stored, by quiz ID.
+	calendar   map[string]ContentDay
+	quizActive map[string]bool
+	// leaderboard holds every player's entry, by user ID.
+	leaderboard map[string]LeaderboardEntry
+	// feedback holds what SaveFeedback stored, by report ID.
+	feedback map[string]FeedbackReport
+	// profiles holds attendee profiles, by user ID.
+	profiles map[string]Profile
+	// checkins holds check-ins, by key; see Checkin.
+	checkins map[string]Checkin
+	// lifelines holds the lifelines used, by user and lifeline.
+	lifelines map[[2]string]bool
+	// schedule is the session schedule, nil until it is first saved.
+	schedule *SessionSchedule
+	// botState is the checkpoint, nil until it is first saved.
+	botState *BotState
+	// catchUp holds the late answers, by audience message ID.
+	catchUp map[string]*Message
+	// counters holds the counter documents' shards, by document and shard.
+	counters map[string]map[int]map[string]int64
+	// images holds what PutImage stored, by name.
+	images map[string][]byte
+	// prizes holds what SavePrize stored, by ID.
+	prizes map[string]Prize
+	// changed is closed and replaced whenever a message is added or
+	// processed, waking every watcher.
+	changed chan struct{}
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		messages:      map[string]*Message{},
+		replies:       map[string]*Message{},
+		private:       map[string]*Message{},
+		deadLetters:   map[string]*DeadLetter{},
+		announcements: map[string]*ScheduledAnnouncement{},
+		queue:         map[string]*Message{},
+		blocked:       map[string]BlockedUser{},
+		costReports:   map[string]CostReport{},
+		polls:         map[string]*PollQuestion{},
+		ineligible:    map[string]map[string]IneligibleVote{},
+		calendar:      map[string]ContentDay{},
+		quizActive:    map[string]bool{},
+		leaderboard:   map[string]LeaderboardEntry{},
+		feedback:      map[string]FeedbackReport{},
+		profiles:      map[string]Profile{},
+		checkins:      map[string]Checkin{},
+		lifelines:     map[[2]string]bool{},
+		catchUp:       map[string]*Message{},
+		counters:      map[string]map[int]map[string]int64{},
+		images:        map[string][]byte{},
+		prizes:        map[string]Prize{},
+		changed:       make(chan struct{}),
+	}
+}
+
+// AddMessage stores an audience message as unprocessed.
+func (s *memoryStore) AddMessage(msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.messages[msg.ID]; !ok {
+		s.order = append(s.order, msg.ID)
+	}
+	msg.Processed = false
+	s.messages[msg.ID] = &msg
+	s.notifyLocked()
+}
+
+func (s *memoryStore) notifyLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// SetPoll stores or replaces a poll.
+func (s *memoryStore) SetPoll(id string, poll PollQuestion) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polls[id] = &poll
+}
+
+// Reply returns the host message stored under id, if any.
+func (s *memoryStore) Reply(id string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.replies[id]
+	if !ok {
+		return Message{}, false
+	}
+	return *m, true
+}
+
+// PrivateReply returns the private reply to audience message id, if any.
+func (s *memoryStore) PrivateReply(id string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.private[id]
+	if !ok {
+		return Message{}, false
+	}
+	return *m, true
+}
+
+// Message returns the audience message stored under id, if any.
+func (s *memoryStore) Message(id string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return Message{}, false
+	}
+	return *m, true
+}
+
+func (s *memoryStore) unprocessedLocked() []*Message {
+	var out []*Message
+	for _, id := range s.order {
+		if m := s.messages[id]; !m.Processed {
+			copied := *m
+			out = append(out, &copied)
+		}
+	}
+	return out
+}
+
+func (s *memoryStore) Unprocessed(ctx context.Context) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unprocessedLocked(), nil
+}
+
+// Watch delivers every unprocessed message each time the set changes, like
+// a snapshot listener on the unprocessed-messages query.
+func (s *memoryStore) Watch(ctx context.Context, fn func(batch []*Message) error) error {
+	for {
+		s.mu.Lock()
+		batch := s.unprocessedLocked()
+		changed := s.changed
+		s.mu.Unlock()
+
+		if err := fn(batch); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+func (s *memoryStore) Claim(ctx context.Context, id, owner string, lease time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return false, fmt.Errorf("message %s not found", id)
+	}
+	now := clock.Now()
+	if !claimable(m, owner, lease, now) {
+		return false, nil
+	}
+	m.ClaimedBy, m.ClaimedAt = owner, now
+	return true, nil
+}
+
+// FlagRequeue sets the requeue flag on a dead letter, as an operator would.
+func (s *memoryStore) FlagRequeue(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dl, ok := s.deadLetters[id]; ok {
+		dl.Requeue = true
+		s.notifyLocked()
+	}
+}
+
+// DeadLetterFor returns the dead letter of message id, if any.
+func (s *memoryStore) DeadLetterFor(id string) (DeadLetter, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dl, ok := s.deadLetters[id]
+	if !ok {
+		return DeadLetter{}, false
+	}
+	return *dl, true
+}
+
+func (s *memoryStore) DeadLetter(ctx context.Context, dl DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[dl.ID]
+	if !ok {
+		return fmt.Errorf("message %s not found", dl.ID)
+	}
+	m.Processed, m.DeadLettered = true, true
+	s.deadLetters[dl.ID] = &dl
+	s.notifyLocked()
+	return nil
+}
+
+func (s *memoryStore) WatchRequeues(ctx context.Context, fn func(ids []string) error) error {
+	for {
+		s.mu.Lock()
+		var ids []string
+		for id, dl := range s.deadLetters {
+			if dl.Requeue {
+				ids = append(ids, id)
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		sort.Strings(ids)
+		if err := fn(ids); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+func (s *memoryStore) Requeue(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return fmt.Errorf("message %s not found", id)
+	}
+	m.Processed, m.DeadLettered = false, false
+	m.ClaimedBy, m.ClaimedAt = "", time.Time{}
+	delete(s.deadLetters, id)
+	s.notifyLocked()
+	return nil
+}
+
+func (s *memoryStore) MarkProcessed(ctx context.Context, id, owner, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return fmt.Errorf("message %s not found", id)
+	}
+	if !ownsClaim(m, owner) {
+		return errClaimLost
+	}
+	m.Processed = true
+	m.UserID = userID
+	s.notifyLocked()
+	return nil
+}
+
+func (s *memoryStore) SaveTranscript(ctx context.Context, id, transcript string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return fmt.Errorf("message %s not found", id)
+	}
+	m.Message = transcript
+	return nil
+}
+
+func (s *memoryStore) UserHistory(ctx context.Context, userID string, limit int) ([]answeredMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var history []answeredMessage
+	for i := len(s.order) - 1; i >= 0 && len(history) < limit; i-- {
+		m := s.messages[s.order[i]]
+		if m.UserID != userID || !m.Processed {
+			continue
+		}
+		a := answeredMessage{ID: m.ID, Question: *m}
+		if r, ok := s.replies[m.ID]; ok {
+			a.Response = *r
+		}
+		history = append(history, a)
+	}
+	return history, nil
+}
+
+func (s *memoryStore) WriteReply(ctx context.Context, reply Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply.Timestamp, reply.Processed = clock.Now(), false
+	s.replies[reply.ID] = &reply
+	return nil
+}
+
+func (s *memoryStore) WriteReplyPair(ctx context.Context, reply, paired Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := clock.Now()
+	for _, m := range []Message{reply, paired} {
+		m.Timestamp, m.Processed = now, false
+		s.replies[m.ID] = &m
+	}
+	return nil
+}
+
+func (s *memoryStore) WritePrivateReply(ctx context.Context, reply Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply.Timestamp, reply.Processed = clock.Now(), false
+	s.private[reply.ID] = &reply
+	return nil
+}
+
+func (s *memoryStore) Submit(ctx context.Context, msg Message) error {
+	s.AddMessage(msg)
+	return nil
+}
+
+func (s *memoryStore) Enqueue(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg.Processed = false
+	s.queue[msg.ID] = &msg
+	return nil
+}
+
+// Queued returns the message Enqueue stored under id, if any.
+func (s *memoryStore) Queued(id string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.queue[id]
+	if !ok {
+		return Message{}, false
+	}
+	return *m, true
+}
+
+func (s *memoryStore) FindReply(ctx context.Context, id string) (*Message, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.replies[id]; ok {
+		reply := *r
+		return &reply, false, nil
+	}
+	if r, ok := s.private[id]; ok {
+		reply := *r
+		return &reply, true, nil
+	}
+	return nil, false, nil
+}
+
+func (s *memoryStore) SetReplyAudio(ctx context.Context, id, audioURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply, ok := s.replies[id]
+	if !ok {
+		return fmt.Errorf("reply %s not found", id)
+	}
+	reply.AudioURL = audioURL
+	return nil
+}
+
+func (s *memoryStore) SetReplyImage(ctx context.Context, id, imageURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply, ok := s.replies[id]
+	if !ok {
+		return fmt.Errorf("reply %s not found", id)
+	}
+	reply.ImageURL = imageURL
+	return nil
+}
+
+func (s *memoryStore) RecentReplies(ctx context.Context, since time.Time, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var replies []Message
+	for _, r := range s.replies {
+		if r.Timestamp.After(since) {
+			replies = append(replies, *r)
+		}
+	}
+	sort.SliceStable(replies, func(i, j int) bool { return replies[i].Timestamp.After(replies[j].Timestamp) })
+	if len(replies) > limit {
+		replies = replies[:limit]
+	}
+	return replies, nil
+}
+
+func (s *memoryStore) AppendTranscript(ctx context.Context, entry TranscriptEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transcript = append(s.transcript, entry)
+	return nil
+}
+
+func (s *memoryStore) Transcript(ctx context.Context, after time.Time, limit int) ([]TranscriptEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []TranscriptEntry
+	for _, e := range s.transcript {
+		if e.At.After(after) && len(entries) < limit {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (s *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *memoryStore) Failover(ctx context.Context) (*FailoverState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failover == nil {
+		return nil, nil
+	}
+	state := *s.failover
+	state.Turns = append([]conversationTurn(nil), state.Turns...)
+	return &state, nil
+}
+
+func (s *memoryStore) UpdateFailover(ctx context.Context, fn func(s *FailoverState) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var state FailoverState
+	if s.failover != nil {
+		state = *s.failover
+	}
+	if err := fn(&state); err != nil {
+		return err
+	}
+	s.failover = &state
+	return nil
+}
+
+func (s *memoryStore) SaveCostReport(ctx context.Context, r CostReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.costReports[r.ID] = r
+	return nil
+}
+
+func (s *memoryStore) BlockUser(ctx context.Context, u BlockedUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked[u.UserID] = u
+	s.notifyLocked()
+	return nil
+}
+
+func (s *memoryStore) UnblockUser(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blocked, userID)
+	s.notifyLocked()
+	return nil
+}
+
+func (s *memoryStore) WatchBlockedUsers(ctx context.Context, fn func(blocked []BlockedUser) error) error {
+	for {
+		s.mu.Lock()
+		blocked := make([]BlockedUser, 0, len(s.blocked))
+		for _, u := range s.blocked {
+			blocked = append(blocked, u)
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if err := fn(blocked); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+// SetCalendarDay stores or replaces a content calendar day.
+func (s *memoryStore) SetCalendarDay(day ContentDay) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calendar[day.ID] = day
+	s.notifyLocked()
+}
+
+// QuizActive reports what SetQuizActive last stored for quiz id.
+func (s *memoryStore) QuizActive(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quizActive[id]
+}
+
+func (s *memoryStore) WatchCalendar(ctx context.Context, fn func(days []ContentDay) error) error {
+	for {
+		s.mu.Lock()
+		days := make([]ContentDay, 0, len(s.calendar))
+		for _, d := range s.calendar {
+			days = append(days, d)
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if err := fn(days); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+func (s *memoryStore) SetQuizActive(ctx context.Context, id string, active bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quizActive[id] = active
+	return nil
+}
+
+func (s *memoryStore) RecordQuizScores(ctx context.Context, quizID string, entries []LeaderboardEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range entries {
+		cur := s.leaderboard[e.UserID]
+		cur.UserID = e.UserID
+		quizzes := map[string]int{quizID: e.Points}
+		for id, points := range cur.Quizzes {
+			if id != quizID {
+				quizzes[id] = points
+			}
+		}
+		cur.Quizzes, cur.Points = quizzes, cur.Wagers
+		for _, points := range quizzes {
+			cur.Points += points
+		}
+		if e.DisplayName != "" {
+			cur.DisplayName = e.DisplayName
+		}
+		cur.UpdatedAt = clock.Now()
+		s.leaderboard[e.UserID] = cur
+	}
+	return nil
+}
+
+func (s *memoryStore) SettleWagers(ctx context.Context, pollID string, outcome []string, anon idMapper) ([]WagerResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	poll, ok := s.polls[pollID]
+	if !ok {
+		return nil, fmt.Errorf("poll %s not found", pollID)
+	}
+	if poll.WagersSettled {
+		return poll.WagerResults, nil
+	}
+	wagers, err := anonymizeWagers(poll.Wagers, anon)
+	if err != nil {
+		return nil, err
+	}
+	results := settleWagers(wagers, poll.Options, outcome, s.leaderboard)
+	for _, r := range results {
+		if r.Net == 0 {
+			continue
+		}
+		cur := s.leaderboard[r.UserID]
+		cur.UserID = r.UserID
+		cur.Wagers += r.Net
+		cur.Points += r.Net
+		cur.UpdatedAt = clock.Now()
+		s.leaderboard[r.UserID] = cur
+	}
+	poll.WagersSettled, poll.WagerResults = true, results
+	return results, nil
+}
+
+func (s *memoryStore) Leaderboard(ctx context.Context, n int) ([]LeaderboardEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	top := make([]LeaderboardEntry, 0, len(s.leaderboard))
+	for _, e := range s.leaderboard {
+		top = append(top, e)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Points == top[j].Points {
+			return top[i].UserID < top[j].UserID
+		}
+		return top[i].Points > top[j].Points
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top, nil
+}
+
+// React adds count reactions of emoji to host reply id.
+func (s *memoryStore) React(id, emoji string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.replies[id]; ok {
+		if r.Reactions == nil {
+			r.Reactions = map[string]int{}
+		}
+		r.Reactions[emoji] += count
+	}
+}
+
+func (s *memoryStore) VariantReplies(ctx context.Context) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Message
+	for _, r := range s.replies {
+		if r.Variant != "" {
+			c := *r
+			out = append(out, &c)
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryStore) SaveFeedback(ctx context.Context, r FeedbackReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feedback[r.ID] = r
+	return nil
+}
+
+func (s *memoryStore) Feedback(ctx context.Context) ([]FeedbackReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]FeedbackReport, 0, len(s.feedback))
+	for _, r := range s.feedback {
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// SetProfile stores or replaces the profile of user id.
+func (s *memoryStore) SetProfile(id string, p Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profiles[id] = p
+}
+
+// Profile returns the profile of user id, if any.
+func (s *memoryStore) Profile(id string) (Profile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.profiles[id]
+	return p, ok
+}
+
+func (s *memoryStore) Profiles(ctx context.Context, ids []string) ([]*Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*Profile, len(ids))
+	for i, id := range ids {
+		if p, ok := s.profiles[id]; ok {
+			out[i] = &p
+		}
+	}
+	return out, nil
+}
+
+// EarlierPoll returns poll id, or nil if there is none.
+func (s *memoryStore) EarlierPoll(ctx context.Context, id string) (*PollQuestion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.polls[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *p
+	return &copied, nil
+}
+
+// SetCheckin stores a check-in under key.
+func (s *memoryStore) SetCheckin(key string, c Checkin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkins[key] = c
+}
+
+func (s *memoryStore) SaveCheckin(ctx context.Context, key string, c Checkin) error {
+	s.SetCheckin(key, c)
+	return nil
+}
+
+// Checkin returns the check-in stored under key, if any.
+func (s *memoryStore) Checkin(key string) (Checkin, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.checkins[key]
+	return c, ok
+}
+
+func (s *memoryStore) Checkins(ctx context.Context, keys []string) ([]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		_, found[i] = s.checkins[key]
+	}
+	return found, nil
+}
+
+func (s *memoryStore) SavePrize(ctx context.Context, id string, p Prize) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prizes[id] = p
+	return nil
+}
+
+func (s *memoryStore) ClaimPrize(ctx context.Context, id, staff string) (*Prize, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.prizes[id]
+	if !ok {
+		return nil, errPrizeNotFound
+	}
+	if p.Status == prizeClaimed {
+		return nil, errPrizeClaimed
+	}
+	p.Status, p.ClaimedAt, p.HandedOverBy = prizeClaimed, clock.Now(), staff
+	s.prizes[id] = p
+	return &p, nil
+}
+
+func (s *memoryStore) Prizes(ctx context.Context, status string) ([]prizeWithID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prizes := []prizeWithID{}
+	for id, p := range s.prizes {
+		if status == "" || p.Status == status {
+			prizes = append(prizes, prizeWithID{ID: id, Prize: p})
+		}
+	}
+	sort.Slice(prizes, func(i, j int) bool { return prizes[i].AwardedAt.Before(prizes[j].AwardedAt) })
+	return prizes, nil
+}
+
+func (s *memoryStore) SetNickname(ctx context.Context, id, nickname string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.profiles[id]
+	p.Nickname = nickname
+	s.profiles[id] = p
+	return nil
+}
+
+func (s *memoryStore) UseLifeline(ctx context.Context, user, lifeline string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{user, lifeline}
+	if s.lifelines[key] {
+		return false, nil
+	}
+	s.lifelines[key] = true
+	return true, nil
+}
+
+func (s *memoryStore) Schedule(ctx context.Context) (*SessionSchedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.schedule == nil {
+		return nil, nil
+	}
+	sched := *s.schedule
+	return &sched, nil
+}
+
+func (s *memoryStore) SaveSchedule(ctx context.Context, sched SessionSchedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule = &sched
+	return nil
+}
+
+func (s *memoryStore) MessagesBetween(ctx context.Context, from, to time.Time, limit int) ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []*Message
+	for _, id := range s.order {
+		m := s.messages[id]
+		if !m.Timestamp.Before(from) && m.Timestamp.Before(to) {
+			msg := *m
+			out = append(out, &msg)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *memoryStore) CatchUp(ctx context.Context, id string) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.catchUp[id]
+	if !ok {
+		return nil, nil
+	}
+	reply := *r
+	return &reply, nil
+}
+
+func (s *memoryStore) WriteCatchUp(ctx context.Context, reply Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reply.Timestamp, reply.Processed = clock.Now(), false
+	s.catchUp[reply.ID] = &reply
+	return nil
+}
+
+func (s *memoryStore) BotState(ctx context.Context) (*BotState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.botState == nil {
+		return nil, nil
+	}
+	state := *s.botState
+	state.Turns = append([]conversationTurn(nil), state.Turns...)
+	return &state, nil
+}
+
+func (s *memoryStore) SaveBotState(ctx context.Context, state BotState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state.Turns = append([]conversationTurn(nil), state.Turns...)
+	s.botState = &state
+	return nil
+}
+
+func (s *memoryStore) AddCounts(ctx context.Context, doc string, shard int, deltas map[string]int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counters[doc] == nil {
+		s.counters[doc] = map[int]map[string]int64{}
+	}
+	if s.counters[doc][shard] == nil {
+		s.counters[doc][shard] = map[string]int64{}
+	}
+	for field, n := range deltas {
+		s.counters[doc][shard][field] += n
+	}
+	return nil
+}
+
+func (s *memoryStore) Counts(ctx context.Context, doc string) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := map[string]int64{}
+	for _, shard := range s.counters[doc] {
+		for field, n := range shard {
+			counts[field] += n
+		}
+	}
+	return counts, nil
+}
+
+func (s *memoryStore) SaveAnnouncement(ctx context.Context, a ScheduledAnnouncement) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.announcements[a.ID] = &a
+	s.notifyLocked()
+	return nil
+}
+
+func (s *memoryStore) pendingAnnouncementsLocked() []ScheduledAnnouncement {
+	var out []ScheduledAnnouncement
+	for _, a := range s.announcements {
+		if a.Status == announcementPending {
+			out = append(out, *a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out
+}
+
+func (s *memoryStore) Announcements(ctx context.Context) ([]ScheduledAnnouncement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pendingAnnouncementsLocked(), nil
+}
+
+func (s *memoryStore) UpdateAnnouncement(ctx context.Context, id string, fn func(a *ScheduledAnnouncement) error) (*ScheduledAnnouncement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.announcements[id]
+	if !ok {
+		return nil, errAnnouncementNotFound
+	}
+	a := *stored
+	if err := fn(&a); err != nil {
+		return nil, err
+	}
+	s.announcements[id] = &a
+	s.notifyLocked()
+	return &a, nil
+}
+
+func (s *memoryStore) WatchAnnouncements(ctx context.Context, fn func(pending []ScheduledAnnouncement) error) error {
+	for {
+		s.mu.Lock()
+		pending := s.pendingAnnouncementsLocked()
+		changed := s.changed
+		s.mu.Unlock()
+
+		if err := fn(pending); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+func (s *memoryStore) Poll(ctx context.Context, id string) (*PollQuestion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.polls[id]
+	if !ok {
+		return nil, fmt.Errorf("poll %s not found", id)
+	}
+	copied := *p
+	return &copied, nil
+}
+
+func (s *memoryStore) SavePoll(ctx context.Context, id string, poll PollQuestion) error {
+	s.SetPoll(id, poll)
+	return nil
+}
+
+func (s *memoryStore) RecordIneligible(ctx context.Context, id string, votes map[string]IneligibleVote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.polls[id]; !ok {
+		return fmt.Errorf("poll %s not found", id)
+	}
+	s.ineligible[id] = votes
+	return nil
+}
+
+func (s *memoryStore) ClosePoll(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.polls[id]
+	if !ok {
+		return fmt.Errorf("poll %s not found", id)
+	}
+	p.Closed = true
+	return nil
+}
+
+func (s *memoryStore) SetOptionImage(ctx context.Context, id, key, imageURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.polls[id]
+	if !ok {
+		return fmt.Errorf("poll %s not found", id)
+	}
+	opt, ok := p.Options[key]
+	if !ok {
+		return fmt.Errorf("poll %s has no option %q", id, key)
+	}
+	opt.ImageURL = imageURL
+	p.Options[key] = opt
+	return nil
+}
+
+// PutImage keeps the image in memory; the URL is only good for finding it
+// again with Image.
+func (s *memoryStore) PutImage(ctx context.Context, name, contentType string, data []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.images[name] = append([]byte(nil), data...)
+	return "memory:///" + name, nil
+}
+
+// Image returns the image PutImage stored under name, if any.
+func (s *memoryStore) Image(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.images[name]
+	return data, ok
+}
+
+func (s *memoryStore) SetPollThemes(ctx context.Context, id string, themes []PollTheme) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.polls[id]
+	if !ok {
+		return fmt.Errorf("poll %s not found", id)
+	}
+	p.Themes = append([]PollTheme(nil), themes...)
+	return nil
+}
+
+func (s *memoryStore) MarkResultsAnnounced(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.polls[id]
+	if !ok {
+		return fmt.Errorf("poll %s not found", id)
+	}
+	p.ResultsAnnounced = true
+	return nil
+}
+
+func (s *memoryStore) Buzz(ctx context.Context, id, userID string, latency, window time.Duration) (*BuzzResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.polls[id]
+	if !ok {
+		return nil, fmt.Errorf("poll %s not found", id)
+	}
+	result, buzz, err := placeBuzz(*p, userID, clock.Now(), latency, window)
+	if err != nil || buzz == nil {
+		return result, err
+	}
+	if p.Buzzes == nil {
+		p.Buzzes = map[string]Buzz{}
+	}
+	p.Buzzes[userID] = *buzz
+	if result.First {
+		p.BuzzOwner, p.AllowedVoters = userID, []string{userID}
+	}
+	return result, nil
+}
+
+func (s *memoryStore) AwardBuzz(ctx context.Context, id string, window time.Duration) (*BuzzArbitration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.polls[id]
+	if !ok {
+		return nil, fmt.Errorf("poll %s not found", id)
+	}
+	a := arbitrateBuzzes(id, *p, window, clock.Now())
+	if a != nil {
+		p.BuzzOwner, p.AllowedVoters = a.Winner, []string{a.Winner}
+	}
+	return a, nil
+}
+
+func (s *memoryStore) MarkBuzzAnnounced(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.polls[id]
+	if !ok {
+		return fmt.Errorf("poll %s not found", id)
+	}
+	p.BuzzAnnounced = true
+	return nil
+}
+
+func (s *memoryStore) LatestSummary(ctx context.Context) (*SummaryVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.summaries) == 0 {
+		return nil, nil
+	}
+	v := s.summaries[len(s.summaries)-1]
+	return &v, nil
+}
+
+func (s *memoryStore) SaveSummary(ctx context.Context, v SummaryVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.summaries); n > 0 && s.summaries[n-1].Version >= v.Version {
+		return fmt.Errorf("summary version %d already exists", v.Version)
+	}
+	s.summaries = append(s.summaries, v)
+	return nil
+}
+
+// replyIDs lists the IDs of every stored host message, sorted.
+func (s *memoryStore) replyIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.replies))
+	for id := range s.replies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// metricsPrefix starts the name of every metric the bot exports.
+const metricsPrefix = "kbc_"
+
+var (
+	// modelLatencyBuckets are the upper bounds, in seconds, of the model
+	// latency histogram: a streamed answer can take tens of seconds.
+	modelLatencyBuckets = []float64{0.25, 0.5, 1, 2, 4, 8, 16, 32}
+	// firestoreLatencyBuckets are those of the Firestore write histogram.
+	firestoreLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+)
+
+// histogram counts observations into cumulative buckets, as Prometheus
+// histograms do.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // counts[i] observations up to bounds[i]; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// labeledCounter is a counter with one label.
+type labeledCounter struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func (c *labeledCounter) inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = map[string]uint64{}
+	}
+	c.counts[value]++
+}
+
+func (c *labeledCounter) snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]uint64, len(c.counts))
+	for k, v := range c.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// botMetrics are the measurements served at /metrics that the debug
+// counters in runtimeHealth don't already cover.
+type botMetrics struct {
+	modelLatency       *histogram
+	firestoreWrites    *histogram
+	generationFailures atomic.Int64
+	autoPrompts        labeledCounter
+	pollFetches        atomic.Int64
+	pollFetchFailures  atomic.Int64
+	// listeners counts the Firestore snapshot listeners open now.
+	listeners atomic.Int64
+	// overlongReplies counts replies over their word limit, by the
+	// length mode that dealt with them.
+	overlongReplies labeledCounter
+	// replyLanguages counts audience replies by the language they were
+	// written in.
+	replyLanguages labeledCounter
+	// trimmedPrompts counts prompts trimmed to fit the context window, by
+	// the last step it took.
+	trimmedPrompts labeledCounter
+	// spokenReplies counts replies read out over the PA, by whether their
+	// audio was stored.
+	spokenReplies labeledCounter
+	// bilingualInvalid counts bilingual generations that lacked either
+	// language.
+	bilingualInvalid atomic.Int64
+	// voiceNotes counts voice notes, by whether they were transcribed.
+	voiceNotes labeledCounter
+	// imageReplies counts replies drawn for audience messages that asked
+	// for a picture, by result.
+	imageReplies labeledCounter
+}
+
+func newBotMetrics() *botMetrics {
+	return &botMetrics{
+		modelLatency:    newHistogram(modelLatencyBuckets),
+		firestoreWrites: newHistogram(firestoreLatencyBuckets),
+	}
+}
+
+// listen counts a snapshot listener as active while watch runs.
+func (m *botMetrics) listen(watch func() error) error {
+	m.listeners.Add(1)
+	defer m.listeners.Add(-1)
+	return watch()
+}
+
+// write runs the Firestore write op of the message pipeline, retrying
+// transient errors, and times every attempt. The write is traced as one
+// span.
+func (b *Bot) write(ctx context.Context, op string, fn func(ctx context.Context) error) error {
+	ctx, span := startSpan(ctx, "firestore."+op)
+	var attempts int
+	err := b.retry.do(ctx, func(ctx context.Context) error {
+		attempts++
+		start := time.Now()
+		err := fn(ctx)
+		b.metrics.firestoreWrites.observe(time.Since(start))
+		return err
+	})
+	span.SetAttributes(attribute.Int("attempts", attempts))
+	endSpan(span, err)
+	return err
+}
+
+// writeMetrics writes b's metrics in the Prometheus text format.
+func writeMetrics(w io.Writer, b *Bot) {
+	m, health := b.metrics, b.health
+	writeCounter(w, "messages_processed_total", "Audience messages answered or dropped and marked processed.", health.messagesProcessed.Load())
+	writeCounter(w, "messages_dead_lettered_total", "Audience messages given up on after repeated failures.", health.messagesDeadLettered.Load())
+	writeGauge(w, "messages_in_flight", "Audience messages being answered now.", float64(health.messagesInFlight.Load()))
+	writeHistogram(w, "model_request_duration_seconds", "Time taken by each model call, retries counted separately.", m.modelLatency)
+	writeCounter(w, "generation_failures_total", "Model calls that still failed after retries.", m.generationFailures.Load())
+	writeHistogram(w, "firestore_write_duration_seconds", "Time taken by each reply, claim and processed-flag write.", m.firestoreWrites)
+
+	writeLabeledCounter(w, "auto_prompts_total", "Host messages the monitor sent unprompted, by kind.", "kind", &m.autoPrompts)
+	writeLabeledCounter(w, "replies_over_length_total", "Replies longer than their word limit, by how they were shortened.", "mode", &m.overlongReplies)
+	writeLabeledCounter(w, "replies_by_language_total", "Audience replies, by the language they were asked for in.", "language", &m.replyLanguages)
+	writeLabeledCounter(w, "prompts_trimmed_total", "Prompts trimmed to fit the context window, by how far they had to be trimmed.", "step", &m.trimmedPrompts)
+	writeLabeledCounter(w, "replies_spoken_total", "Replies read out with Text-to-Speech, by result.", "result", &m.spokenReplies)
+	writeLabeledCounter(w, "voice_notes_total", "Voice notes sent to Speech-to-Text, by result.", "result", &m.voiceNotes)
+	writeLabeledCounter(w, "reply_images_total", "Pictures drawn for replies to audience messages that asked for one, by result.", "result", &m.imageReplies)
+	writeCounter(w, "bilingual_invalid_total", "Bilingual generations without both languages, answered as if the model had failed.", m.bilingualInvalid.Load())
+	writeCounter(w, "poll_fetches_total", "Reads of the active poll for the host's context.", m.pollFetches.Load())
+	writeCounter(w, "poll_fetch_failures_total", "Reads of the active poll that failed.", m.pollFetchFailures.Load())
+	writeGauge(w, "snapshot_listeners", "Firestore snapshot listeners open now.", float64(m.listeners.Load()))
+}
+
+func writeCounter(w io.Writer, name, help string, v int64) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %[1]s%[2]s counter\n%[1]s%[2]s %[4]d\n", metricsPrefix, name, help, v)
+}
+
+// writeLabeledCounter writes c with one sample per value of label, in
+// order.
+func writeLabeledCounter(w io.Writer, name, help, label string, c *labeledCounter) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %[1]s%[2]s counter\n", metricsPrefix, name, help)
+	counts := c.snapshot()
+	for _, value := range sortedKeys(counts) {
+		fmt.Fprintf(w, "%s%s{%s=%q} %d\n", metricsPrefix, name, label, value, counts[value])
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %[1]s%[2]s gauge\n%[1]s%[2]s %[4]s\n", metricsPrefix, name, help, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %[1]s%[2]s histogram\n", metricsPrefix, name, help)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s%s_bucket{le=\"%s\"} %d\n", metricsPrefix, name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s%s_bucket{le=\"+Inf\"} %d\n", metricsPrefix, name, h.count)
+	fmt.Fprintf(w, "%s%s_sum %s\n%[1]s%[2]s_count %[4]d\n", metricsPrefix, name, strconv.FormatFloat(h.sum, 'g', -1, 64), h.count)
+}
+
+func registerMetricsRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, b)
+	})
+}
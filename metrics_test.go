@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	store := newMemoryStore()
+	failing := false
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		if failing {
+			return "", errors.New("model down")
+		}
+		return "It is.", nil
+	}))
+	b.cfg.AdminToken = "s3cret"
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "Is the keynote recorded?"})
+	msg, _ := store.Message("m1")
+	if err := b.handleUserMessage(context.Background(), &msg, answerPrivate); err != nil {
+		t.Fatal(err)
+	}
+	failing = true
+	b.generate(context.Background(), levelFullAI, "hello", nil)
+	b.metrics.modelLatency.observe(3 * time.Second)
+	b.metrics.autoPrompts.inc("poll-update")
+
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/metrics", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("GET /metrics = %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{
+		"# TYPE kbc_messages_processed_total counter\nkbc_messages_processed_total 1\n",
+		"kbc_generation_failures_total 1\n",
+		`kbc_model_request_duration_seconds_bucket{le="2"} 2`,
+		`kbc_model_request_duration_seconds_bucket{le="4"} 3`,
+		`kbc_model_request_duration_seconds_bucket{le="+Inf"} 3`,
+		"kbc_model_request_duration_seconds_count 3\n",
+		"kbc_firestore_write_duration_seconds_count 2\n",
+		`kbc_auto_prompts_total{kind="poll-update"} 1`,
+		"kbc_snapshot_listeners 0\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const migrateProgressEvery = 200
+
+// runMigrate implements the "migrate" command, which copies the room
+// collections from their legacy flat names (e.g. gccdpune-user) into the
+// room/session layout configured by Room and Session. Documents keep their
+// IDs and contents, and ones already at their new path are not overwritten,
+// so re-running it is safe. Legacy documents are only deleted with -delete,
+// and only those whose copy is confirmed at the new path.
+func runMigrate(ctx context.Context, w io.Writer, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be copied without writing")
+	deleteLegacy := fs.Bool("delete", false, "delete legacy documents once copied and verified")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if cfg.Room == "" {
+		return errors.New("set room (ROOM) to the room to migrate into")
+	}
+
+	client, err := newFirestoreClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	legacy := cfg.legacyCollections.roomCollections()
+	current := cfg.Collections.roomCollections()
+	names := make([]string, 0, len(legacy))
+	for name := range legacy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	total := 0
+	for _, name := range names {
+		from, to := *legacy[name], *current[name]
+		copied, err := migrateCollection(ctx, w, client, from, to, *dryRun, *deleteLegacy)
+		if err != nil {
+			return fmt.Errorf("error migrating %s: %w", from, err)
+		}
+		total += copied
+	}
+
+	if *dryRun {
+		fmt.Fprintf(w, "Dry run: %d documents would be migrated\n", total)
+	} else {
+		fmt.Fprintf(w, "Migrated %d documents\n", total)
+	}
+	return nil
+}
+
+// migrateCollection copies the documents of from into to. A document
+// already in to, copied by an earlier run or written there since, is not
+// overwritten; see sortCopies.
+func migrateCollection(ctx context.Context, w io.Writer, client *firestore.Client, from, to string, dryRun, deleteLegacy bool) (int, error) {
+	var docs []*firestore.DocumentSnapshot
+	var jobs []*firestore.BulkWriterJob
+	bw := client.BulkWriter(ctx)
+	iter := client.Collection(from).Documents(ctx)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			iter.Stop()
+			bw.End()
+			return 0, err
+		}
+		docs = append(docs, doc)
+		if !dryRun {
+			job, err := bw.Create(client.Collection(to).Doc(doc.Ref.ID), doc.Data())
+			if err != nil {
+				iter.Stop()
+				bw.End()
+				return 0, err
+			}
+			jobs = append(jobs, job)
+		}
+		if len(docs)%migrateProgressEvery == 0 {
+			fmt.Fprintf(w, "  %s: %d documents...\n", from, len(docs))
+		}
+	}
+	iter.Stop()
+	bw.End()
+
+	if dryRun || len(docs) == 0 {
+		fmt.Fprintf(w, "%s -> %s: %d documents\n", from, to, len(docs))
+		return len(docs), nil
+	}
+
+	// Check every document arrived before anything is deleted.
+	created := make([]error, len(jobs))
+	var existingRefs []*firestore.DocumentRef
+	for i, job := range jobs {
+		_, created[i] = job.Results()
+		if status.Code(created[i]) == codes.AlreadyExists {
+			existingRefs = append(existingRefs, client.Collection(to).Doc(docs[i].Ref.ID))
+		}
+	}
+	existing := map[string]*firestore.DocumentSnapshot{}
+	if len(existingRefs) > 0 {
+		snaps, err := client.GetAll(ctx, existingRefs)
+		if err != nil {
+			return 0, fmt.Errorf("error verifying %s: %w", to, err)
+		}
+		for _, snap := range snaps {
+			if snap.Exists() {
+				existing[snap.Ref.ID] = snap
+			}
+		}
+	}
+	result, err := sortCopies(docs, created, existing)
+	if err != nil {
+		return 0, fmt.Errorf("error copying %s to %s: %w", from, to, err)
+	}
+	fmt.Fprintf(w, "%s -> %s: %d documents copied, %d already there\n", from, to, result.copied, result.kept)
+	if len(result.stale) > 0 {
+		fmt.Fprintf(w, "%s: %d documents left in place, as %s has older versions of them: %s\n", from, len(result.stale), to, strings.Join(result.stale, ", "))
+	}
+
+	if deleteLegacy && len(result.done) > 0 {
+		bw := client.BulkWriter(ctx)
+		jobs := make([]*firestore.BulkWriterJob, 0, len(result.done))
+		for _, ref := range result.done {
+			job, err := bw.Delete(ref)
+			if err != nil {
+				bw.End()
+				return 0, err
+			}
+			jobs = append(jobs, job)
+		}
+		bw.End()
+		deleted, err := confirmedWrites(jobs)
+		fmt.Fprintf(w, "%s: %d legacy documents deleted\n", from, deleted)
+		if err != nil {
+			return len(docs), fmt.Errorf("%d legacy documents in %s were not deleted: %w", len(result.done)-deleted, from, err)
+		}
+	}
+	return len(docs), nil
+}
+
+// migrationResult sorts the legacy documents of a collection by what became
+// of their copies.
+type migrationResult struct {
+	// copied counts the documents created at the new path, and kept those
+	// already there in a version at least as new.
+	copied, kept int
+	// stale lists the IDs of documents already at the new path in an
+	// older version than the legacy one, which is left in place.
+	stale []string
+	// done are the legacy documents that are safely copied, and may be
+	// deleted.
+	done []*firestore.DocumentRef
+}
+
+// sortCopies works out the migrationResult of the legacy documents in
+// sources, given the result of creating each at the new path and, by ID,
+// the documents that exist there. A document already there only
+// counts as copied if it was updated no earlier than the legacy one: an
+// earlier run copied it, or the app has written to it since. It fails if
+// any copy failed for another reason.
+func sortCopies(sources []*firestore.DocumentSnapshot, created []error, existing map[string]*firestore.DocumentSnapshot) (migrationResult, error) {
+	var result migrationResult
+	var failed int
+	var lastErr error
+	for i, src := range sources {
+		err := created[i]
+		switch {
+		case err == nil:
+			result.copied++
+		case status.Code(err) == codes.AlreadyExists:
+			target, ok := existing[src.Ref.ID]
+			if !ok || target.UpdateTime.Before(src.UpdateTime) {
+				result.stale = append(result.stale, src.Ref.ID)
+				continue
+			}
+			result.kept++
+		default:
+			failed++
+			lastErr = err
+			continue
+		}
+		result.done = append(result.done, src.Ref)
+	}
+	if failed > 0 {
+		return result, fmt.Errorf("%d documents were not copied: %w", failed, lastErr)
+	}
+	return result, nil
+}
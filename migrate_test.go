@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSortCopies(t *testing.T) {
+	t0 := time.Date(2024, 11, 16, 10, 0, 0, 0, time.UTC)
+	doc := func(id string, updated time.Time) *firestore.DocumentSnapshot {
+		return &firestore.DocumentSnapshot{Ref: &firestore.DocumentRef{ID: id}, UpdateTime: updated}
+	}
+	exists := status.Error(codes.AlreadyExists, "exists")
+	sources := []*firestore.DocumentSnapshot{doc("new", t0), doc("recopied", t0), doc("newer", t0), doc("older", t0)}
+	existing := map[string]*firestore.DocumentSnapshot{
+		"recopied": doc("recopied", t0.Add(time.Hour)),
+		"newer":    doc("newer", t0.Add(2*time.Hour)),
+		"older":    doc("older", t0.Add(-time.Hour)),
+	}
+
+	got, err := sortCopies(sources, []error{nil, exists, exists, exists}, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done []string
+	for _, ref := range got.done {
+		done = append(done, ref.ID)
+	}
+	if got.copied != 1 || got.kept != 2 || strings.Join(done, ",") != "new,recopied,newer" || strings.Join(got.stale, ",") != "older" {
+		t.Errorf("sortCopies = %d copied, %d kept, done %v, stale %v; want 1, 2, new,recopied,newer and older", got.copied, got.kept, done, got.stale)
+	}
+
+	failed := errors.New("deadline exceeded")
+	if _, err := sortCopies(sources, []error{nil, failed, exists, exists}, existing); !errors.Is(err, failed) {
+		t.Errorf("sortCopies with a failed copy = %v, want %v", err, failed)
+	}
+}
+
+func TestEmulatorMigrateCollection(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+	ctx := context.Background()
+	var cfg Config
+	cfg.applyDefaults()
+	client, err := newFirestoreClient(ctx, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	prefix := fmt.Sprintf("migrate-%d", time.Now().UnixNano())
+	from, to := prefix+"-user", prefix+"-rooms/main/sessions/s1/user"
+
+	// The new layout has an older "stale" and a newer "kept".
+	set := func(col, id, text string) {
+		t.Helper()
+		if _, err := client.Collection(col).Doc(id).Set(ctx, map[string]any{"message": text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set(to, "stale", "before the legacy edit")
+	set(from, "stale", "edited")
+	set(from, "copied", "hello")
+	set(from, "kept", "legacy")
+	set(to, "kept", "newer")
+
+	var out bytes.Buffer
+	if n, err := migrateCollection(ctx, &out, client, from, to, false, true); err != nil || n != 3 {
+		t.Fatalf("migrateCollection = %d, %v; output:\n%s", n, err, out.String())
+	}
+	want := map[string]string{"copied": "hello", "kept": "newer", "stale": "before the legacy edit"}
+	for id, text := range want {
+		snap, err := client.Collection(to).Doc(id).Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := snap.DataAt("message"); got != text {
+			t.Errorf("%s at the new path = %q, want %q", id, got, text)
+		}
+	}
+	left, err := client.Collection(from).Documents(ctx).GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].Ref.ID != "stale" {
+		t.Errorf("%d legacy documents left, want only stale", len(left))
+	}
+}
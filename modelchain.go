@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// modelChain is a ResponseGenerator that tries its models in order, each
+// under its own timeout, and returns the first reply, so an overloaded or
+// rate-limited model is passed over without the audience noticing. It
+// fails only if every model does, with all of their errors.
+type modelChain []chainLink
+
+// chainLink is one model in a modelChain.
+type chainLink struct {
+	name    string
+	timeout time.Duration
+	model   ResponseGenerator
+}
+
+func (c modelChain) Generate(ctx context.Context, prompt string) (string, error) {
+	return c.GenerateStream(ctx, prompt, nil)
+}
+
+// GenerateStream streams from models that can; a model that fails after
+// sending partial text is followed by the next one starting over.
+func (c modelChain) GenerateStream(ctx context.Context, prompt string, onText func(partial string)) (string, error) {
+	var errs []error
+	for i, link := range c {
+		text, err := link.generate(ctx, prompt, onText)
+		if err == nil {
+			return text, nil
+		}
+		errs = append(errs, fmt.Errorf("model %s: %w", link.name, err))
+		// Another model would only be asked the same unsafe question.
+		if ctx.Err() != nil || errors.Is(err, errSafetyBlocked) {
+			break
+		}
+		if i+1 < len(c) {
+			loggerFrom(ctx).Warn("model failed, falling back", "model", link.name, "fallback", c[i+1].name, "err", err)
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+// generate calls the link's model and charges the tokens of a successful
+// call to ctx's feature: as the backend reported them, or estimated from
+// the text if it did not.
+func (l chainLink) generate(ctx context.Context, prompt string, onText func(partial string)) (string, error) {
+	callCtx := ctx
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+	usage := &tokenUsage{}
+	callCtx = context.WithValue(callCtx, tokenUsageKey{}, usage)
+	var text string
+	var err error
+	if sm, ok := l.model.(streamingGenerator); ok && onText != nil {
+		text, err = sm.GenerateStream(callCtx, prompt, onText)
+	} else {
+		text, err = l.model.Generate(callCtx, prompt)
+	}
+	if err != nil {
+		return "", err
+	}
+	if usage.in == 0 && usage.out == 0 {
+		usage.in, usage.out = estimateTokens(prompt), estimateTokens(text)
+	}
+	countTokens(ctx, l.name, usage.in, usage.out)
+	return text, nil
+}
+
+// parseModelChain parses MODEL_CHAIN: comma-separated "model" or
+// "model=timeout" entries, e.g. "gemini-1.5-pro=20s,gemini-1.0-pro".
+// Entries without a timeout get Config.ModelTimeout.
+func parseModelChain(spec string) ([]ChainModel, error) {
+	var chain []ChainModel
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, timeout, ok := strings.Cut(entry, "=")
+		m := ChainModel{Name: strings.TrimSpace(name)}
+		if ok {
+			d, err := time.ParseDuration(strings.TrimSpace(timeout))
+			if err != nil {
+				return nil, fmt.Errorf("invalid model timeout in %q: %w", entry, err)
+			}
+			m.Timeout = Duration{d}
+		}
+		chain = append(chain, m)
+	}
+	return chain, nil
+}
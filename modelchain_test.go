@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestModelChainFallsBack(t *testing.T) {
+	overloaded := errors.New("429 resource exhausted")
+	reply := func(text string, err error) ResponseGenerator {
+		return generatorFunc(func(ctx context.Context, prompt string) (string, error) { return text, err })
+	}
+	hang := generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+
+	tests := []struct {
+		name     string
+		chain    modelChain
+		want     string
+		wantErrs []string
+	}{
+		{
+			name:  "first model answers",
+			chain: modelChain{{name: "flash", model: reply("flash reply", nil)}, {name: "pro", model: reply("pro reply", nil)}},
+			want:  "flash reply",
+		},
+		{
+			name:  "overloaded model is skipped",
+			chain: modelChain{{name: "flash", model: reply("", overloaded)}, {name: "pro", model: reply("pro reply", nil)}},
+			want:  "pro reply",
+		},
+		{
+			name:  "slow model times out",
+			chain: modelChain{{name: "flash", timeout: time.Millisecond, model: hang}, {name: "backup", model: reply("backup reply", nil)}},
+			want:  "backup reply",
+		},
+		{
+			name:     "every model fails",
+			chain:    modelChain{{name: "flash", model: reply("", overloaded)}, {name: "pro", timeout: time.Millisecond, model: hang}},
+			wantErrs: []string{"model flash: 429", "model pro: context deadline exceeded"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.chain.Generate(context.Background(), "hi")
+			if tt.wantErrs != nil {
+				if err == nil {
+					t.Fatalf("Generate = %q, want an error", got)
+				}
+				for _, want := range tt.wantErrs {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q does not mention %q", err, want)
+					}
+				}
+				if !errors.Is(err, overloaded) || !isQuotaError(err) {
+					t.Errorf("error %v hides the models' errors from the ladder", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Generate = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelChainStopsWhenCallerGivesUp(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	next := false
+	chain := modelChain{
+		{name: "flash", model: generatorFunc(func(ctx context.Context, prompt string) (string, error) { return "", ctx.Err() })},
+		{name: "pro", model: generatorFunc(func(ctx context.Context, prompt string) (string, error) { next = true; return "pro reply", nil })},
+	}
+	if _, err := chain.Generate(ctx, "hi"); !errors.Is(err, context.Canceled) || next {
+		t.Errorf("Generate after cancel = %v, next model called %v; want context.Canceled without falling back", err, next)
+	}
+}
+
+func TestParseModelChain(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []ChainModel
+		wantErr bool
+	}{
+		{spec: "gemini-1.5-pro=20s, gemini-1.0-pro", want: []ChainModel{{Name: "gemini-1.5-pro", Timeout: Duration{20 * time.Second}}, {Name: "gemini-1.0-pro"}}},
+		{spec: " ,llama3,", want: []ChainModel{{Name: "llama3"}}},
+		{spec: "gemini-1.5-pro=soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseModelChain(tt.spec)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseModelChain(%q) = %+v, %v; want %+v (error %v)", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errSafetyBlocked is returned by a model whose own safety filters refused
+// to answer (Gemini's finish reason SAFETY). It is a moderation outcome, not
+// an outage: it is neither retried nor counted by the degradation ladder.
+var errSafetyBlocked = errors.New("reply blocked by the model's safety filters")
+
+// Moderation stages and their outcomes, as recorded in ModerationFlag.
+const (
+	stageMessage  = "message"
+	stageResponse = "response"
+
+	moderationBlock = "block"
+	moderationMask  = "mask"
+)
+
+// ModerationFlag records audience or host text the moderation stage caught.
+type ModerationFlag struct {
+	MessageID string `firestore:"messageId,omitempty"`
+	UserID    string `firestore:"userId,omitempty"`
+	// Stage is "message" for audience messages, "response" for host replies.
+	Stage string `firestore:"stage"`
+	Text  string `firestore:"text"`
+	// Question is the audience message a flagged reply answered.
+	Question string `firestore:"question,omitempty"`
+	Reason   string `firestore:"reason"`
+	// Action is "block" or "mask": the message was dropped or the reply
+	// replaced by a canned line, or the offending words were starred out.
+	Action string    `firestore:"action"`
+	At     time.Time `firestore:"at"`
+}
+
+// moderator screens audience messages and generated replies against the
+// profanity list, the configured extra words and, optionally, an external
+// classifier.
+type moderator struct {
+	action    string
+	blocklist map[string]bool
+	// classifierURL is POSTed {"text"} and answers {"flagged",
+	// "categories"}; empty disables the classifier.
+	classifierURL string
+	client        *http.Client
+}
+
+func newModerator(cfg ModerationConfig) *moderator {
+	m := &moderator{
+		action:        cfg.Action,
+		blocklist:     map[string]bool{},
+		classifierURL: cfg.ClassifierURL,
+		client:        &http.Client{Timeout: cfg.ClassifierTimeout.Duration},
+	}
+	for _, w := range cfg.Blocklist {
+		m.blocklist[strings.ToLower(w)] = true
+	}
+	return m
+}
+
+// blocked reports whether word is on the profanity list or the extra words.
+func (m *moderator) blocked(word string) bool {
+	return isProfane(word) || m.blocklist[strings.ToLower(word)]
+}
+
+// containsBlocked reports whether text has a blocked word.
+func (m *moderator) containsBlocked(text string) bool {
+	for _, w := range splitWords(text) {
+		if m.blocked(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// verdict is the moderation result for one piece of text.
+type verdict struct {
+	// reasons is empty if the text is clean.
+	reasons []string
+	// maskable is set if only blocklisted words were found, so starring
+	// them out makes the text acceptable.
+	maskable bool
+}
+
+// screen checks text against the blocklist and the classifier. A
+// classifier that fails or times out is logged and ignored, so moderation
+// never stops the show.
+func (m *moderator) screen(ctx context.Context, text string) (v verdict) {
+	ctx, span := startSpan(ctx, "moderation.screen", trace.WithAttributes(attribute.Bool("classifier", m.classifierURL != "")))
+	defer func() {
+		span.SetAttributes(attribute.StringSlice("reasons", v.reasons))
+		span.End()
+	}()
+	if m.containsBlocked(text) {
+		v.reasons, v.maskable = []string{"profanity"}, true
+	}
+	if m.classifierURL == "" {
+		return v
+	}
+	categories, err := m.classify(ctx, text)
+	if err != nil {
+		loggerFrom(ctx).Warn("moderation classifier failed, using the blocklist only", "err", err)
+		return v
+	}
+	if categories != nil {
+		v.reasons, v.maskable = append(v.reasons, categories...), false
+	}
+	return v
+}
+
+// classify asks the classifier about text. It returns the flagged
+// categories, not nil but possibly empty if the text was flagged, or nil if
+// it was not.
+func (m *moderator) classify(ctx context.Context, text string) ([]string, error) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.classifierURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("classifier returned %d", resp.StatusCode)
+	}
+	var out struct {
+		Flagged    bool     `json:"flagged"`
+		Categories []string `json:"categories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("error decoding classifier response: %w", err)
+	}
+	if !out.Flagged {
+		return nil, nil
+	}
+	if len(out.Categories) == 0 {
+		return []string{"classifier"}, nil
+	}
+	return out.Categories, nil
+}
+
+// mask replaces every letter and digit of blocked words in text with '*',
+// leaving the rest as it was.
+func (m *moderator) mask(text string) string {
+	runes := []rune(text)
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	for i := 0; i < len(runes); {
+		if !isWord(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWord(runes[j]) {
+			j++
+		}
+		if m.blocked(string(runes[i:j])) {
+			for k := i; k < j; k++ {
+				runes[k] = '*'
+			}
+		}
+		i = j
+	}
+	return string(runes)
+}
+
+// screenMessage moderates an incoming audience message before it is
+// answered or counted anywhere. It masks the message in place when it may,
+// and reports whether it must be dropped instead.
+func (b *Bot) screenMessage(ctx context.Context, msg *Message) (blocked bool) {
+	v := b.moderator.screen(ctx, msg.Message)
+	if len(v.reasons) == 0 {
+		return false
+	}
+	action := moderationBlock
+	if v.maskable && b.moderator.action == moderationMask {
+		action = moderationMask
+	}
+	b.bus.Publish(Event{Kind: EventContentFlagged, MessageID: msg.ID, UserID: msg.UserID, Text: msg.Message, Stage: stageMessage, Action: action, Reason: strings.Join(v.reasons, ", ")})
+	if action == moderationMask {
+		msg.Message = b.moderator.mask(msg.Message)
+		return false
+	}
+	return true
+}
+
+// screenReply moderates a generated reply to userMessage and returns the
+// text to publish: the reply, masked, or a canned host line.
+func (b *Bot) screenReply(ctx context.Context, userMessage, reply string) string {
+	v := b.moderator.screen(ctx, reply)
+	if len(v.reasons) == 0 {
+		return reply
+	}
+	action := moderationBlock
+	if v.maskable && b.moderator.action == moderationMask {
+		action = moderationMask
+	}
+	b.bus.Publish(Event{Kind: EventContentFlagged, Question: userMessage, Text: reply, Stage: stageResponse, Action: action, Reason: strings.Join(v.reasons, ", ")})
+	if action == moderationMask {
+		return b.moderator.mask(reply)
+	}
+	return b.ladder.cannedLine()
+}
+
+// recordModerationFlags writes every moderation flag from the bus to
+// Firestore. A failed write is logged and the flag dropped.
+func (b *Bot) recordModerationFlags(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-b.flags:
+			flag := ModerationFlag{MessageID: e.MessageID, UserID: e.UserID, Stage: e.Stage, Text: e.Text, Question: e.Question, Reason: e.Reason, Action: e.Action, At: e.At}
+			if _, err := b.client.Collection(b.cfg.Collections.Moderation).Doc(newID("flag")).Set(ctx, flag); err != nil {
+				slog.Error("error recording moderation flag", "stage", e.Stage, "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestModeratorScreen(t *testing.T) {
+	classifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ Text string }
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch in.Text {
+		case "you people are worthless":
+			w.Write([]byte(`{"flagged": true, "categories": ["harassment"]}`))
+		case "crash":
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"flagged": false}`))
+		}
+	}))
+	defer classifier.Close()
+
+	var cfg Config
+	cfg.applyDefaults()
+	cfg.Moderation.Blocklist = []string{"Bakwaas"}
+	cfg.Moderation.ClassifierURL = classifier.URL
+	m := newModerator(cfg.Moderation)
+
+	tests := []struct {
+		text         string
+		wantReasons  []string
+		wantMaskable bool
+	}{
+		{"What is Gemini?", nil, false},
+		{"what the FUCK is this", []string{"profanity"}, true},
+		{"total bakwaas", []string{"profanity"}, true},
+		{"you people are worthless", []string{"harassment"}, false},
+		{"crash", nil, false},
+	}
+	for _, tt := range tests {
+		v := m.screen(context.Background(), tt.text)
+		if len(v.reasons) != len(tt.wantReasons) || (len(v.reasons) > 0 && v.reasons[0] != tt.wantReasons[0]) || v.maskable != tt.wantMaskable {
+			t.Errorf("screen(%q) = %+v, want reasons %v, maskable %v", tt.text, v, tt.wantReasons, tt.wantMaskable)
+		}
+	}
+
+	if got, want := m.mask("What the fuck, this is shit! Bakwaas."), "What the ****, this is ****! *******."; got != want {
+		t.Errorf("mask = %q, want %q", got, want)
+	}
+}
+
+func TestBlockedMessageIsNotAnswered(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		t.Errorf("model called with %q", prompt)
+		return "", nil
+	}))
+	events, unsubscribe := b.bus.Subscribe(EventContentFlagged, EventMessageReceived)
+	defer unsubscribe()
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "this show is shit"})
+
+	msg, _ := store.Message("m1")
+	if err := b.handleUserMessage(context.Background(), &msg, answerPublic); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Message("m1"); !got.Processed {
+		t.Error("blocked message was left unprocessed")
+	}
+	if _, ok := store.Reply("m1"); ok {
+		t.Error("blocked message was answered")
+	}
+	select {
+	case e := <-events:
+		if e.Kind != EventContentFlagged || e.Stage != stageMessage || e.Action != moderationBlock || e.MessageID != "m1" {
+			t.Errorf("event = %+v, want a blocked message flag", e)
+		}
+	default:
+		t.Fatal("no moderation flag")
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v after the flag", e)
+	default:
+	}
+}
+
+func TestMaskedMessageIsAnswered(t *testing.T) {
+	store := newMemoryStore()
+	var prompt string
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, p string) (string, error) {
+		prompt = p
+		return "Shabaash!", nil
+	}))
+	b.moderator.action = moderationMask
+	msg := Message{ID: "m1", UserID: "ann", Message: "holy shit, Gemini is fast"}
+	store.AddMessage(msg)
+
+	if err := b.handleUserMessage(context.Background(), &msg, answerPrivate); err != nil {
+		t.Fatal(err)
+	}
+	if want := "holy ****, Gemini is fast"; msg.Message != want || !strings.Contains(prompt, want) {
+		t.Errorf("answered %q with prompt %q, want the masked message %q", msg.Message, prompt, want)
+	}
+}
+
+func TestGeneratedRepliesAreScreened(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		err   error
+		mask  bool
+		want  string
+	}{
+		{name: "clean reply", reply: "Namaste, dost!", want: "Namaste, dost!"},
+		{name: "profane reply masked", reply: "Holy shit, what a question!", mask: true, want: "Holy ****, what a question!"},
+		{name: "profane reply replaced", reply: "Holy shit, what a question!", want: "canned"},
+		{name: "model safety block", err: errSafetyBlocked, want: "canned"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBot(t, newMemoryStore(), generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+				return tt.reply, tt.err
+			}))
+			b.cfg.Degradation.CannedLines = []string{"canned"}
+			b.ladder = newDegradationLadder(b.cfg.Degradation)
+			if tt.mask {
+				b.moderator.action = moderationMask
+			}
+			flags, unsubscribe := b.bus.Subscribe(EventContentFlagged)
+			defer unsubscribe()
+
+			got, err := b.generateResponse(context.Background(), "what is Gemini?", "", nil)
+			if err != nil || got != tt.want {
+				t.Errorf("generateResponse = %q, %v; want %q", got, err, tt.want)
+			}
+			if lvl := b.ladder.current(); lvl != levelFullAI {
+				t.Errorf("ladder level = %s, want full AI", lvl)
+			}
+			select {
+			case e := <-flags:
+				if tt.want == tt.reply {
+					t.Errorf("clean reply flagged: %+v", e)
+				}
+			default:
+				if tt.want != tt.reply {
+					t.Error("no moderation flag")
+				}
+			}
+		})
+	}
+}
+
+func TestModelChainStopsOnSafetyBlock(t *testing.T) {
+	next := false
+	chain := modelChain{
+		{name: "flash", model: generatorFunc(func(ctx context.Context, prompt string) (string, error) { return "", errSafetyBlocked })},
+		{name: "pro", model: generatorFunc(func(ctx context.Context, prompt string) (string, error) { next = true; return "pro reply", nil })},
+	}
+	if _, err := chain.Generate(context.Background(), "hi"); !errors.Is(err, errSafetyBlocked) || next {
+		t.Errorf("Generate = %v, next model called %v; want the safety block without falling back", err, next)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Nicknames are an adjective and a noun from these lists, so the host can
+// address people without a display name without showing their user ID.
+var (
+	nicknameAdjectives = []string{
+		"Brave", "Cheerful", "Cosmic", "Curious", "Dancing", "Dazzling", "Fearless", "Golden", "Jolly", "Lucky",
+		"Mighty", "Nimble", "Quick", "Sparkling", "Spicy", "Sunny", "Swift", "Turbo", "Witty", "Zesty",
+	}
+	nicknameNouns = []string{
+		"Biryani", "Chai", "Coder", "Comet", "Dosa", "Elephant", "Falcon", "Gopher", "Kite", "Lotus",
+		"Mango", "Monsoon", "Panda", "Peacock", "Pixel", "Robot", "Rocket", "Samosa", "Tabla", "Tiger",
+	}
+)
+
+// fallbackNickname is used if no safe nickname turns up.
+const fallbackNickname = "Friend of the Show"
+
+// safeNickname reports whether name can go on the stage display: none of
+// its words, nor the words run together, is on the profanity list.
+func safeNickname(name string) bool {
+	return !containsProfanity(name) && !isProfane(strings.Join(splitWords(name), ""))
+}
+
+// newNickname picks a random safe nickname.
+func newNickname() string {
+	for range 10 {
+		name := nicknameAdjectives[rng.Intn(len(nicknameAdjectives))] + " " + nicknameNouns[rng.Intn(len(nicknameNouns))]
+		if safeNickname(name) {
+			return name
+		}
+	}
+	return fallbackNickname
+}
+
+// ProfileStore reads attendee profiles and stores the nicknames given to
+// those without a display name.
+type ProfileStore interface {
+	// Profiles returns the profile of each user ID, nil where there is
+	// none.
+	Profiles(ctx context.Context, ids []string) ([]*Profile, error)
+	// SetNickname stores nickname on the profile of id, creating it if
+	// need be.
+	SetNickname(ctx context.Context, id, nickname string) error
+}
+
+// profileID is the ID the profile of user is keyed by: in anonymous mode
+// the pseudonym is resolved to the real user ID, or kept if that fails.
+func (b *Bot) profileID(ctx context.Context, user string) string {
+	if !b.pseudonyms.isPseudonym(user) {
+		return user
+	}
+	realID, err := b.pseudonyms.reveal(ctx, b.client, b.cfg.Collections.Pseudonyms, user)
+	if err != nil {
+		loggerFrom(ctx).Error("error resolving user for its profile", "user", user, "err", err)
+		return user
+	}
+	return realID
+}
+
+// profileName is what the host calls the owner of profile p, keyed by id:
+// their display name, else their nickname, else a new nickname stored on
+// the profile. A nickname that cannot be stored is still used, and another
+// is picked next time.
+func (b *Bot) profileName(ctx context.Context, id string, p *Profile) string {
+	if p != nil && p.DisplayName != "" {
+		return p.DisplayName
+	}
+	if p != nil && p.Nickname != "" {
+		return p.Nickname
+	}
+	nickname := newNickname()
+	if err := b.profiles.SetNickname(ctx, id, nickname); err != nil {
+		loggerFrom(ctx).Error("error storing nickname", "profile", id, "err", err)
+	}
+	return nickname
+}
+
+// senderName is what the host calls user, remembered for the rest of the
+// run. It is empty if the profile cannot be read.
+func (b *Bot) senderName(ctx context.Context, user string) string {
+	if name, ok := b.senderNames.Load(user); ok {
+		return name.(string)
+	}
+	id := b.profileID(ctx, user)
+	profiles, err := b.profiles.Profiles(ctx, []string{id})
+	if err != nil {
+		loggerFrom(ctx).Error("error fetching profile", "user", user, "err", err)
+		return ""
+	}
+	name := b.profileName(ctx, id, profiles[0])
+	b.senderNames.Store(user, name)
+	return name
+}
+
+// nameContext tells the host what to call the sender of msg.
+func (b *Bot) nameContext(ctx context.Context, promptContext string, msg *Message) string {
+	if msg.UserID == "" {
+		return promptContext
+	}
+	name := b.senderName(ctx, msg.UserID)
+	if name == "" {
+		return promptContext
+	}
+	return fmt.Sprintf("%s\nThis user goes by %q; address them by it.", promptContext, name)
+}
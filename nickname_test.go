@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSafeNickname(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Witty Tiger", true},
+		{"Saala Tiger", false},
+		{"Ass Hole", false},
+		{"Mighty Dick", false},
+	}
+	for _, tt := range tests {
+		if got := safeNickname(tt.name); got != tt.want {
+			t.Errorf("safeNickname(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	for range 50 {
+		if name := newNickname(); !safeNickname(name) || len(strings.Fields(name)) != 2 {
+			t.Fatalf("newNickname = %q, want a safe adjective and noun", name)
+		}
+	}
+}
+
+func TestSenderName(t *testing.T) {
+	store := newMemoryStore()
+	store.SetProfile("ann", Profile{DisplayName: "Ann"})
+	b := newTestBot(t, store, generatorFunc(nil))
+	ctx := context.Background()
+
+	if got := b.nameContext(ctx, "ctx", &Message{UserID: "ann"}); got != "ctx\nThis user goes by \"Ann\"; address them by it." {
+		t.Errorf("nameContext = %q, want the display name", got)
+	}
+
+	name := b.senderName(ctx, "bob")
+	p, ok := store.Profile("bob")
+	if !ok || p.Nickname != name || name == "" || strings.Contains(name, "bob") {
+		t.Fatalf("senderName = %q, profile = %+v; want a nickname stored on the profile", name, p)
+	}
+	store.SetNickname(ctx, "bob", "Changed Behind Our Back")
+	if again := b.senderName(ctx, "bob"); again != name {
+		t.Errorf("senderName = %q the second time, want the remembered %q", again, name)
+	}
+	if got := b.displayNames(ctx, []string{"ann", "bob"}); got[0] != "Ann" || got[1] != "Changed Behind Our Back" {
+		t.Errorf("displayNames = %q, want the display name and the stored nickname", got)
+	}
+	if got := b.nameContext(ctx, "ctx", &Message{SessionID: "s1"}); got != "ctx" {
+		t.Errorf("nameContext for a signed-out sender = %q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+const telemetryWindow = time.Minute
+
+// TelemetryPing is written by display clients to report how far behind
+// they are rendering host messages.
+type TelemetryPing struct {
+	ClientID  string    `firestore:"clientId"`
+	LatencyMs float64   `firestore:"latencyMs"`
+	Timestamp time.Time `firestore:"timestamp"`
+}
+
+// Pacing scales how often the host speaks and how long it talks. Slowdown
+// multiplies the idle and spacing thresholds of the monitor.
+type Pacing struct {
+	Slowdown     float64 `json:"slowdown"`
+	MaxWords     int     `json:"maxWords"`
+	LatencyP90Ms float64 `json:"latencyP90Ms"`
+	Clients      int     `json:"clients"`
+}
+
+var normalPacing = Pacing{Slowdown: 1, MaxWords: 30}
+
+// pacingFor maps the observed display latency to a pacing level.
+func pacingFor(p90Ms float64) Pacing {
+	switch {
+	case p90Ms >= 3000:
+		return Pacing{Slowdown: 2.5, MaxWords: 12}
+	case p90Ms >= 1000:
+		return Pacing{Slowdown: 1.5, MaxWords: 20}
+	default:
+		return normalPacing
+	}
+}
+
+// updatePacing recomputes pacing from the latest ping of every client seen in
+// the last minute, using the 90th percentile of their latencies. It is
+// interpolated between neighbouring clients, so with ten screens a single
+// slow one moves it a tenth of the way towards its latency instead of
+// setting it outright; with only a couple of screens it mostly follows the
+// slower one.
+func updatePacing(ctx context.Context, client *firestore.Client, telemetryCollection string) (Pacing, error) {
+	latest := map[string]TelemetryPing{}
+	iter := client.Collection(telemetryCollection).Where("timestamp", ">=", clock.Now().Add(-telemetryWindow)).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return Pacing{}, fmt.Errorf("error iterating through telemetry: %w", err)
+		}
+		var ping TelemetryPing
+		if err := doc.DataTo(&ping); err != nil {
+			return Pacing{}, fmt.Errorf("error converting document to TelemetryPing: %w", err)
+		}
+		if prev, ok := latest[ping.ClientID]; !ok || ping.Timestamp.After(prev.Timestamp) {
+			latest[ping.ClientID] = ping
+		}
+	}
+
+	latencies := make([]float64, 0, len(latest))
+	for _, ping := range latest {
+		latencies = append(latencies, ping.LatencyMs)
+	}
+	sort.Float64s(latencies)
+
+	p := normalPacing
+	if len(latencies) > 0 {
+		p90 := percentile(latencies, 0.9)
+		p = pacingFor(p90)
+		p.LatencyP90Ms = p90
+	}
+	p.Clients = len(latencies)
+	return p, nil
+}
+
+// percentile returns the q-th quantile of sorted, interpolating linearly
+// between the closest ranks.
+func percentile(sorted []float64, q float64) float64 {
+	rank := q * float64(len(sorted)-1)
+	lo := int(rank)
+	if lo+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (rank-float64(lo))*(sorted[lo+1]-sorted[lo])
+}
+
+func (p Pacing) String() string {
+	return fmt.Sprintf("%gx slower, %d words", p.Slowdown, p.MaxWords)
+}
+
+func (p Pacing) scale(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * p.Slowdown)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		sorted []float64
+		want   float64
+	}{
+		{"one client", []float64{400}, 400},
+		{"two clients", []float64{100, 1100}, 1000},
+		{"one slow screen of ten", []float64{100, 100, 100, 100, 100, 100, 100, 100, 100, 5100}, 600},
+		{"two slow screens of ten", []float64{100, 100, 100, 100, 100, 100, 100, 100, 5100, 5100}, 5100},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, 0.9); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: percentile = %g, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPacingFor(t *testing.T) {
+	tests := []struct {
+		p90Ms float64
+		want  Pacing
+	}{
+		{0, normalPacing},
+		{999, normalPacing},
+		{1000, Pacing{Slowdown: 1.5, MaxWords: 20}},
+		{2999, Pacing{Slowdown: 1.5, MaxWords: 20}},
+		{3000, Pacing{Slowdown: 2.5, MaxWords: 12}},
+	}
+	for _, tt := range tests {
+		if got := pacingFor(tt.p90Ms); got != tt.want {
+			t.Errorf("pacingFor(%g) = %+v, want %+v", tt.p90Ms, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Persona is a character the host can play. Prompt introduces the
+// character to the model and Style says how it talks; MaxWords, if set,
+// caps replies below the pacing's limit. Generation, if set, overrides
+// the configured generation parameters for the persona's replies.
+type Persona struct {
+	Name       string            `json:"name" yaml:"name"`
+	Prompt     string            `json:"prompt" yaml:"prompt"`
+	Style      string            `json:"style" yaml:"style"`
+	MaxWords   int               `json:"maxWords,omitempty" yaml:"maxWords"`
+	Generation *GenerationConfig `json:"generation,omitempty" yaml:"generation"`
+}
+
+// defaultPersona is the host the show was built around.
+var defaultPersona = Persona{
+	Name:   "amitabh",
+	Prompt: "You're Amitabh Bachchan, hosting Kaun Banega Crorepati.",
+	Style:  "Respond in Amitabh's style. Be witty and professional.",
+}
+
+// personaRegistry holds the configured personas and which one is active.
+type personaRegistry struct {
+	mu       sync.Mutex
+	personas map[string]Persona
+	active   string
+}
+
+// newPersonaRegistry returns a registry of defaultPersona and extra, which
+// may replace it, with active selected; validate has already checked it.
+func newPersonaRegistry(extra []Persona, active string) *personaRegistry {
+	r := &personaRegistry{personas: map[string]Persona{defaultPersona.Name: defaultPersona}, active: active}
+	for _, p := range extra {
+		r.personas[p.Name] = p
+	}
+	return r
+}
+
+func (r *personaRegistry) current() Persona {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.personas[r.active]
+}
+
+var errUnknownPersona = errors.New("unknown persona")
+
+// switchTo makes the named persona active and returns the previous one.
+func (r *personaRegistry) switchTo(name string) (previous string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.personas[name]; !ok {
+		return "", fmt.Errorf("%w %q", errUnknownPersona, name)
+	}
+	previous, r.active = r.active, name
+	return previous, nil
+}
+
+// list returns every persona, sorted by name, and the active one's name.
+func (r *personaRegistry) list() ([]Persona, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Persona, 0, len(r.personas))
+	for _, p := range r.personas {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, r.active
+}
+
+// validatePersonas checks the configured personas and that active names
+// one of them or the default.
+func validatePersonas(personas []Persona, active string) error {
+	known := map[string]bool{defaultPersona.Name: true}
+	for _, p := range personas {
+		if p.Name == "" || p.Prompt == "" {
+			return errors.New("personas need a name and a prompt")
+		}
+		if p.MaxWords < 0 {
+			return fmt.Errorf("persona %q: maxWords must not be negative", p.Name)
+		}
+		if err := p.Generation.validate(fmt.Sprintf("persona %q: generation", p.Name)); err != nil {
+			return err
+		}
+		known[p.Name] = true
+	}
+	if !known[active] {
+		return fmt.Errorf("persona %q is not configured", active)
+	}
+	return nil
+}
+
+func registerPersonaRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/personas", func(w http.ResponseWriter, r *http.Request) {
+		personas, active := b.personas.list()
+		writeJSON(w, http.StatusOK, map[string]any{"active": active, "personas": personas})
+	})
+
+	mux.HandleFunc("PUT /admin/persona", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		previous, err := b.personas.switchTo(body.Name)
+		if errors.Is(err, errUnknownPersona) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if previous != body.Name {
+			b.bus.Publish(Event{Kind: EventStateChanged, State: "persona", From: previous, To: body.Name})
+		}
+		writeJSON(w, http.StatusOK, b.personas.current())
+	})
+}
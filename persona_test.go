@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePersonas(t *testing.T) {
+	tests := []struct {
+		name     string
+		personas []Persona
+		active   string
+		wantErr  string
+	}{
+		{"default only", nil, "amitabh", ""},
+		{"configured persona", []Persona{{Name: "rajini", Prompt: "You're Rajinikanth."}}, "rajini", ""},
+		{"unknown active", nil, "rajini", "not configured"},
+		{"missing prompt", []Persona{{Name: "rajini"}}, "amitabh", "name and a prompt"},
+		{"negative word cap", []Persona{{Name: "rajini", Prompt: "p", MaxWords: -1}}, "amitabh", "maxWords"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePersonas(tt.personas, tt.active)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("validatePersonas = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("validatePersonas = %v, want error mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPersonaSwitching(t *testing.T) {
+	var prompt string
+	b := newTestBot(t, newMemoryStore(), generatorFunc(func(ctx context.Context, p string) (string, error) {
+		prompt = p
+		return "ok", nil
+	}))
+	b.personas = newPersonaRegistry([]Persona{{Name: "rajini", Prompt: "You're Rajinikanth.", Style: "Punch dialogues only.", MaxWords: 10}}, "amitabh")
+
+	tests := []struct {
+		persona string
+		want    []string
+	}{
+		{"amitabh", []string{"You're Amitabh Bachchan", "at most 30 words"}},
+		{"rajini", []string{"You're Rajinikanth.", "Punch dialogues only.", "at most 10 words"}},
+	}
+	for _, tt := range tests {
+		if _, err := b.personas.switchTo(tt.persona); err != nil {
+			t.Fatal(err)
+		}
+		b.generateResponse(context.Background(), "hello", "", nil)
+		for _, want := range tt.want {
+			if !strings.Contains(prompt, want) {
+				t.Errorf("%s: prompt = %q, want it to contain %q", tt.persona, prompt, want)
+			}
+		}
+	}
+	if _, err := b.personas.switchTo("shah-rukh"); !errors.Is(err, errUnknownPersona) {
+		t.Errorf("switchTo unknown persona = %v, want %v", err, errUnknownPersona)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxRecentGeneratedPolls is how many generated questions the model is
+// asked not to repeat.
+const maxRecentGeneratedPolls = 20
+
+// generatedPoll is the JSON shape the model is asked to produce.
+type generatedPoll struct {
+	Question string            `json:"question"`
+	Options  map[string]string `json:"options"`
+	// Images describes the picture to show with each option, when the
+	// model may ask for them.
+	Images map[string]string `json:"images,omitempty"`
+}
+
+// generatePoll asks the model for an audience poll on theme with two to
+// four options keyed A to D, none of the questions in avoid. With images,
+// the model may describe a picture for each option, for visual questions.
+func generatePoll(ctx context.Context, model ResponseGenerator, theme string, avoid []string, images bool) (*generatedPoll, error) {
+	if theme == "" {
+		theme = "a developer community event"
+	}
+	var avoidText string
+	if len(avoid) > 0 {
+		avoidText = "\nDon't repeat any of these questions:\n- " + strings.Join(avoid, "\n- ")
+	}
+	requestText := fmt.Sprintf(`Write one fun opinion poll for the live audience of %s, with two to four short options and no right answer.%s
+Reply with only JSON of the form {"question": "...", "options": {"A": "...", "B": "...", "C": "...", "D": "..."}}.`, theme, avoidText)
+	if images {
+		requestText += `
+If the question is about something visual, such as which logo or design people like best, also add "images": {"A": "...", ...} describing the picture to show with each option.`
+	}
+
+	text, err := model.Generate(ctx, requestText)
+	if err != nil {
+		return nil, fmt.Errorf("model error: %w", err)
+	}
+	var p generatedPoll
+	if err := json.Unmarshal([]byte(extractJSON(text)), &p); err != nil {
+		return nil, fmt.Errorf("error parsing generated poll: %w", err)
+	}
+	p.Question = strings.TrimSpace(p.Question)
+	if p.Question == "" || len(p.Options) < 2 || len(p.Options) > 4 {
+		return nil, fmt.Errorf("model returned an incomplete poll: %q", text)
+	}
+	for key, option := range p.Options {
+		if !strings.Contains("ABCD", key) || len(key) != 1 || strings.TrimSpace(option) == "" {
+			return nil, fmt.Errorf("model returned an invalid option %q: %q", key, text)
+		}
+	}
+	return &p, nil
+}
+
+func (p *generatedPoll) toPoll() PollQuestion {
+	poll := PollQuestion{Question: p.Question, Options: map[string]PollOption{}, Generated: true}
+	for key, text := range p.Options {
+		poll.Options[key] = PollOption{OpText: strings.TrimSpace(text), Label: key, Voters: []string{}}
+	}
+	return poll
+}
+
+// pollGenerator remembers the questions generated this session so the
+// model doesn't ask the audience the same thing twice.
+type pollGenerator struct {
+	mu     sync.Mutex
+	recent []string
+}
+
+func (g *pollGenerator) remember(question string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.recent = append(g.recent, question)
+	if len(g.recent) > maxRecentGeneratedPolls {
+		g.recent = g.recent[len(g.recent)-maxRecentGeneratedPolls:]
+	}
+}
+
+func (g *pollGenerator) avoid() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.recent...)
+}
+
+// createPoll has the model write a poll on theme, the day's theme or
+// polls.theme if empty, screens it and saves it to the poll collection
+// under a new ID.
+func (b *Bot) createPoll(ctx context.Context, theme string) (string, *PollQuestion, error) {
+	if theme == "" {
+		theme = b.pollTheme()
+	}
+	ctx = b.costs.attribute(ctx, featurePollGeneration)
+	b.costs.item(featurePollGeneration)
+	generated, err := generatePoll(ctx, b.ladderModel(), theme, b.pollGen.avoid(), b.imageGen != nil && b.images != nil)
+	if err != nil {
+		return "", nil, err
+	}
+	poll := generated.toPoll()
+	texts := []string{poll.Question}
+	for _, o := range poll.Options {
+		texts = append(texts, o.OpText)
+	}
+	for _, description := range generated.Images {
+		texts = append(texts, description)
+	}
+	if b.moderator.containsBlocked(strings.Join(texts, " ")) {
+		return "", nil, fmt.Errorf("generated poll %q failed moderation", poll.Question)
+	}
+	id := newID("poll")
+	b.drawOptionImages(ctx, id, &poll, generated.Images)
+	if err := b.polls.SavePoll(ctx, id, poll); err != nil {
+		return "", nil, fmt.Errorf("error saving generated poll: %w", err)
+	}
+	b.pollGen.remember(poll.Question)
+	slog.Info("generated poll", "poll", id, "question", poll.Question)
+	return id, &poll, nil
+}
+
+func registerPollGenerationRoutes(mux *http.ServeMux, b *Bot) {
+	// Writes a new poll and, with "activate", makes it the active one.
+	mux.HandleFunc("POST /admin/polls/generate", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Theme    string `json:"theme"`
+			Activate bool   `json:"activate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		id, poll, err := b.createPoll(r.Context(), body.Theme)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		if body.Activate {
+			b.switchPoll(id)
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"id": id, "question": poll.Question, "options": pollOptions(*poll)})
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeneratePoll(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		wantErr bool
+	}{
+		{"plain", `{"question": "Tabs or spaces?", "options": {"A": "Tabs", "B": "Spaces"}}`, false},
+		{"fenced", "```json\n{\"question\": \"Chai or coffee?\", \"options\": {\"A\": \"Chai\", \"B\": \"Coffee\", \"C\": \"Both\"}}\n```", false},
+		{"not json", "Here's a fun poll!", true},
+		{"one option", `{"question": "Tabs?", "options": {"A": "Yes"}}`, true},
+		{"no question", `{"question": " ", "options": {"A": "Tabs", "B": "Spaces"}}`, true},
+		{"bad key", `{"question": "Tabs or spaces?", "options": {"A": "Tabs", "E": "Spaces"}}`, true},
+		{"empty option", `{"question": "Tabs or spaces?", "options": {"A": "Tabs", "B": ""}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+				return tt.reply, nil
+			})
+			p, err := generatePoll(context.Background(), model, "DevFest Pune", nil, false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("generatePoll = %v, %v; wantErr %v", p, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGeneratePollFromAdmin(t *testing.T) {
+	store := newMemoryStore()
+	var prompts []string
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		if len(prompts) > 2 {
+			return "", errors.New("quota exhausted")
+		}
+		return `{"question": "Favourite Gemini model?", "options": {"A": "Flash", "B": "Pro"}}`, nil
+	}))
+	b.cfg.AdminToken = "s3cret"
+	b.cfg.Polls.Theme = "Build with AI"
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	generate := func(body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/polls/generate", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	code, out := generate("")
+	if code != http.StatusCreated {
+		t.Fatalf("POST /admin/polls/generate = %d %v", code, out)
+	}
+	id, _ := out["id"].(string)
+	poll, err := store.Poll(context.Background(), id)
+	if err != nil {
+		t.Fatalf("generated poll %q not saved: %v", id, err)
+	}
+	if !poll.Generated || poll.Options["B"].OpText != "Pro" {
+		t.Errorf("saved poll = %+v", poll)
+	}
+	if !strings.Contains(prompts[0], "Build with AI") {
+		t.Errorf("prompt %q does not have the configured theme", prompts[0])
+	}
+	if b.activePollID() == id {
+		t.Error("generated poll was activated without asking")
+	}
+
+	code, out = generate(`{"theme": "Go", "activate": true}`)
+	if code != http.StatusCreated {
+		t.Fatalf("POST /admin/polls/generate activate = %d %v", code, out)
+	}
+	if got := b.activePollID(); got != out["id"] {
+		t.Errorf("active poll = %q, want the generated %v", got, out["id"])
+	}
+	if !strings.Contains(prompts[1], "Go") || !strings.Contains(prompts[1], "Favourite Gemini model?") {
+		t.Errorf("prompt %q does not have the theme and the question to avoid", prompts[1])
+	}
+
+	if code, _ := generate(""); code != http.StatusBadGateway {
+		t.Errorf("POST /admin/polls/generate with the model down = %d, want %d", code, http.StatusBadGateway)
+	}
+}
+
+func TestRotateToGeneratedPoll(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return `{"question": "Chai or coffee?", "options": {"A": "Chai", "B": "Coffee"}}`, nil
+	}))
+	b.cfg.Polls = PollsConfig{IDs: []string{"q1"}, RotateEvery: Duration{10 * time.Minute}, Generate: true}
+	b.room.poll.Store(&activePoll{ID: "q1", Since: start})
+
+	b.rotatePoll(context.Background(), start.Add(10*time.Minute))
+	id := b.activePollID()
+	if id == "q1" {
+		t.Fatal("did not rotate to a generated poll")
+	}
+	if poll, err := store.Poll(context.Background(), id); err != nil || poll.Question != "Chai or coffee?" {
+		t.Errorf("active poll %q = %+v, %v", id, poll, err)
+	}
+}
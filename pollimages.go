@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// maxOptionImageBytes caps an uploaded or generated option image.
+const maxOptionImageBytes = 5 << 20
+
+// imageGeneratorTimeout is how long the image generator has to draw one
+// option.
+const imageGeneratorTimeout = time.Minute
+
+// optionImageTypes are the image types poll options can show, with the
+// extension they are stored under.
+var optionImageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// errNoImageBucket is returned when an option image is uploaded without
+// polls.imageBucket set.
+var errNoImageBucket = errors.New("no image bucket is configured (polls.imageBucket)")
+
+// ImageStore keeps poll option images where the audience's app can load
+// them.
+type ImageStore interface {
+	// PutImage stores data under name and returns the URL it is served from.
+	PutImage(ctx context.Context, name, contentType string, data []byte) (string, error)
+}
+
+// storageImages keeps images, and the audio of spoken replies, in a Cloud
+// Storage bucket and serves them through Firebase Storage download URLs,
+// so the bucket can stay private.
+type storageImages struct {
+	name   string
+	bucket *storage.BucketHandle
+}
+
+func newStorageImages(ctx context.Context, cfg *Config, bucket string) (*storageImages, error) {
+	client, err := storage.NewClient(ctx, googleClientOptions(cfg)...)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Cloud Storage: %w", err)
+	}
+	return &storageImages{name: bucket, bucket: client.Bucket(bucket)}, nil
+}
+
+func (s *storageImages) PutImage(ctx context.Context, name, contentType string, data []byte) (string, error) {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw[:])
+	w := s.bucket.Object(name).NewWriter(ctx)
+	w.ContentType = contentType
+	w.Metadata = map[string]string{"firebaseStorageDownloadTokens": token}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://firebasestorage.googleapis.com/v0/b/%s/o/%s?alt=media&token=%s", s.name, url.PathEscape(name), token), nil
+}
+
+// imageGenerator draws option images for generated polls: url is POSTed
+// {"prompt"} and answers with the image itself.
+type imageGenerator struct {
+	url    string
+	client *http.Client
+}
+
+func newImageGenerator(url string) *imageGenerator {
+	if url == "" {
+		return nil
+	}
+	return &imageGenerator{url: url, client: &http.Client{Timeout: imageGeneratorTimeout}}
+}
+
+// generate returns an image of prompt and its content type.
+func (g *imageGenerator) generate(ctx context.Context, prompt string) ([]byte, string, error) {
+	body, err := json.Marshal(map[string]string{"prompt": prompt})
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("image generator returned %d", resp.StatusCode)
+	}
+	data, err := readOptionImage(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// readOptionImage reads an image of at most maxOptionImageBytes.
+func readOptionImage(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxOptionImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxOptionImageBytes {
+		return nil, fmt.Errorf("image is larger than %d MB", maxOptionImageBytes>>20)
+	}
+	return data, nil
+}
+
+// storeOptionImage uploads the image of option key of poll id and returns
+// its URL.
+func (b *Bot) storeOptionImage(ctx context.Context, id, key, contentType string, data []byte) (string, error) {
+	if b.images == nil {
+		return "", errNoImageBucket
+	}
+	mediaType, ext, err := optionImageType(contentType)
+	if err != nil {
+		return "", err
+	}
+	return b.images.PutImage(ctx, fmt.Sprintf("polls/%s/%s%s", id, key, ext), mediaType, data)
+}
+
+// optionImageType returns the media type and extension of contentType, if
+// options can show it.
+func optionImageType(contentType string) (mediaType, ext string, err error) {
+	mediaType, _, _ = mime.ParseMediaType(contentType)
+	ext, ok := optionImageTypes[mediaType]
+	if !ok {
+		return "", "", fmt.Errorf("unsupported image type %q", contentType)
+	}
+	return mediaType, ext, nil
+}
+
+// drawOptionImages has the image generator draw the options of generated
+// poll id that the model described a picture for. An option whose image
+// fails is left without one.
+func (b *Bot) drawOptionImages(ctx context.Context, id string, poll *PollQuestion, descriptions map[string]string) {
+	if b.imageGen == nil || b.images == nil {
+		return
+	}
+	for key, description := range descriptions {
+		opt, ok := poll.Options[key]
+		if !ok || description == "" {
+			continue
+		}
+		data, contentType, err := b.imageGen.generate(ctx, description)
+		if err == nil {
+			opt.ImageURL, err = b.storeOptionImage(ctx, id, key, contentType, data)
+		}
+		if err != nil {
+			slog.Error("error drawing poll option image", "poll", id, "option", key, "err", err)
+			continue
+		}
+		poll.Options[key] = opt
+	}
+}
+
+func registerPollImageRoutes(mux *http.ServeMux, b *Bot) {
+	// Creates a poll written by an organizer; options may carry an
+	// imageUrl, or get an image uploaded afterwards. A numeric poll has a
+	// range instead of options.
+	mux.HandleFunc("POST /admin/polls", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ID       string `json:"id"`
+			Question string `json:"question"`
+			Options  map[string]struct {
+				Text     string `json:"text"`
+				ImageURL string `json:"imageUrl"`
+			} `json:"options"`
+			Kind     string        `json:"kind"`
+			Range    *NumericRange `json:"range"`
+			Activate bool          `json:"activate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		poll := PollQuestion{Question: body.Question, Options: map[string]PollOption{}}
+		if err := checkNewPoll(body.Question, body.Kind, body.Range, len(body.Options)); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		poll.Kind, poll.Range = body.Kind, body.Range
+		for key, o := range body.Options {
+			if key == "" || o.Text == "" {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("option %q needs a key and text", key))
+				return
+			}
+			poll.Options[key] = PollOption{OpText: o.Text, Label: key, Voters: []string{}, ImageURL: o.ImageURL}
+		}
+		if body.ID == "" {
+			body.ID = newID("poll")
+		}
+		if err := b.polls.SavePoll(r.Context(), body.ID, poll); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if body.Activate {
+			b.switchPoll(body.ID)
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{"id": body.ID, "question": poll.Question, "options": pollOptions(poll)})
+	})
+
+	// The body is the image itself, PNG, JPEG, GIF or WebP, with its
+	// Content-Type.
+	mux.HandleFunc("PUT /admin/polls/{id}/options/{key}/image", func(w http.ResponseWriter, r *http.Request) {
+		id, key := r.PathValue("id"), r.PathValue("key")
+		poll, err := b.polls.Poll(r.Context(), id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if _, ok := poll.Options[key]; !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("poll %s has no option %q", id, key))
+			return
+		}
+		if b.images == nil {
+			writeError(w, http.StatusServiceUnavailable, errNoImageBucket)
+			return
+		}
+		if _, _, err := optionImageType(r.Header.Get("Content-Type")); err != nil {
+			writeError(w, http.StatusUnsupportedMediaType, err)
+			return
+		}
+		data, err := readOptionImage(r.Body)
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		imageURL, err := b.storeOptionImage(r.Context(), id, key, r.Header.Get("Content-Type"), data)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		if err := b.polls.SetOptionImage(r.Context(), id, key, imageURL); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"imageUrl": imageURL})
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func TestGeneratedPollGetsOptionImages(t *testing.T) {
+	var drawn []string
+	generator := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Prompt string }
+		json.NewDecoder(r.Body).Decode(&req)
+		drawn = append(drawn, req.Prompt)
+		if strings.Contains(req.Prompt, "broken") {
+			http.Error(w, "no", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngHeader)
+	}))
+	defer generator.Close()
+
+	store := newMemoryStore()
+	var prompt string
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, p string) (string, error) {
+		prompt = p
+		return `{"question": "Which is the real Go gopher?", "options": {"A": "This one", "B": "That one", "C": "Neither"},
+			"images": {"A": "a blue gopher mascot", "B": "a broken drawing of a gopher"}}`, nil
+	}))
+	b.images, b.imageGen = store, newImageGenerator(generator.URL)
+
+	id, poll, err := b.createPoll(context.Background(), "Go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, `"images"`) {
+		t.Errorf("prompt doesn't offer images: %s", prompt)
+	}
+	if len(drawn) != 2 {
+		t.Errorf("drew %q, want the two described options", drawn)
+	}
+	saved, err := store.Poll(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Options["A"].ImageURL; got != "memory:///polls/"+id+"/A.png" || got != poll.Options["A"].ImageURL {
+		t.Errorf("option A image = %q, want the uploaded one", got)
+	}
+	if _, ok := store.Image("polls/" + id + "/A.png"); !ok {
+		t.Error("option A's image was not uploaded")
+	}
+	if saved.Options["B"].ImageURL != "" || saved.Options["C"].ImageURL != "" {
+		t.Errorf("options = %+v, want no image where drawing failed or none was described", saved.Options)
+	}
+}
+
+func TestCreatePollWithUploadedImage(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.AdminToken = "s3cret"
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	do := func(method, path, contentType, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out map[string]any
+		json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	code, _ := do(http.MethodPost, "/admin/polls", "application/json", `{"id": "logos", "question": "Which logo is real?",
+		"options": {"A": {"text": "Left", "imageUrl": "https://example.com/left.png"}, "B": {"text": "Right"}}}`)
+	if code != http.StatusCreated {
+		t.Fatalf("POST /admin/polls = %d", code)
+	}
+	if code, _ := do(http.MethodPut, "/admin/polls/logos/options/B/image", "image/png", string(pngHeader)); code != http.StatusServiceUnavailable {
+		t.Errorf("upload without a bucket = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	b.images = store
+	if code, _ := do(http.MethodPut, "/admin/polls/logos/options/B/image", "text/plain", "hello"); code != http.StatusUnsupportedMediaType {
+		t.Errorf("upload of text = %d, want %d", code, http.StatusUnsupportedMediaType)
+	}
+	if code, _ := do(http.MethodPut, "/admin/polls/logos/options/Z/image", "image/png", string(pngHeader)); code != http.StatusNotFound {
+		t.Errorf("upload for a missing option = %d, want %d", code, http.StatusNotFound)
+	}
+	code, out := do(http.MethodPut, "/admin/polls/logos/options/B/image", "image/png", string(pngHeader))
+	if code != http.StatusOK || out["imageUrl"] != "memory:///polls/logos/B.png" {
+		t.Fatalf("upload = %d %v", code, out)
+	}
+	poll, err := store.Poll(context.Background(), "logos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll.Options["A"].ImageURL != "https://example.com/left.png" || poll.Options["B"].ImageURL != "memory:///polls/logos/B.png" {
+		t.Errorf("options = %+v, want both images", poll.Options)
+	}
+}
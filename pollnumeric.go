@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// pollKindNumeric is the kind of poll answered with a number, such as
+// guess the number or a rating from 1 to 10, rather than by picking an
+// option.
+const pollKindNumeric = "numeric"
+
+// pollAnswerKey stands in for the option of the answers to numeric and
+// open-text polls, in the voters eligibility rules look at and in
+// ineligible votes.
+const pollAnswerKey = "answer"
+
+// numericBuckets is how many bars the distribution of a numeric poll has
+// when its range holds more whole numbers than that.
+const numericBuckets = 10
+
+// NumericRange bounds the answers to a numeric poll; answers outside it are
+// excluded as ineligible.
+type NumericRange struct {
+	Min float64 `firestore:"min" json:"min"`
+	Max float64 `firestore:"max" json:"max"`
+	// Answer is the right number, for guess-the-number polls.
+	Answer *float64 `firestore:"answer,omitempty" json:"answer,omitempty"`
+}
+
+// NumericBucket counts the answers from From to To, To excluded except in
+// the last bucket.
+type NumericBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+// NumericResults aggregates the answers to a numeric poll.
+type NumericResults struct {
+	Count   int             `json:"count"`
+	Mean    float64         `json:"mean"`
+	Median  float64         `json:"median"`
+	Min     float64         `json:"min"`
+	Max     float64         `json:"max"`
+	Buckets []NumericBucket `json:"buckets"`
+	// Exact counts the answers equal to the range's Answer, and Closest is
+	// the answer nearest to it, given by ClosestCount voters.
+	Exact        int      `json:"exact,omitempty"`
+	Closest      *float64 `json:"closest,omitempty"`
+	ClosestCount int      `json:"closestCount,omitempty"`
+}
+
+// numeric reports whether poll is answered with a number.
+func (p PollQuestion) numeric() bool {
+	return p.Kind == pollKindNumeric
+}
+
+// inRange reports whether v is a valid answer to poll.
+func (p PollQuestion) inRange(v float64) bool {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return false
+	}
+	return p.Range == nil || (v >= p.Range.Min && v <= p.Range.Max)
+}
+
+// exactGuessers lists the voters who answered a numeric poll with its
+// right answer, for eligibility rules on later polls.
+func (p PollQuestion) exactGuessers() []string {
+	voters := []string{}
+	if p.Range == nil || p.Range.Answer == nil {
+		return voters
+	}
+	for voter, v := range p.Answers {
+		if v == *p.Range.Answer {
+			voters = append(voters, voter)
+		}
+	}
+	return voters
+}
+
+// pollVotes counts the votes, or answers, cast on poll.
+func pollVotes(poll PollQuestion) int {
+	votes := len(poll.Answers) + len(poll.TextAnswers)
+	for _, opt := range poll.Options {
+		votes += len(opt.Voters)
+	}
+	return votes
+}
+
+// numericResults aggregates the answers to poll. Without a range, the
+// distribution spans the answers given.
+func numericResults(poll PollQuestion) NumericResults {
+	values := make([]float64, 0, len(poll.Answers))
+	for _, v := range poll.Answers {
+		values = append(values, v)
+	}
+	sort.Float64s(values)
+	res := NumericResults{Count: len(values)}
+	if len(values) == 0 {
+		return res
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	res.Mean = sum / float64(len(values))
+	res.Median = values[len(values)/2]
+	if len(values)%2 == 0 {
+		res.Median = (values[len(values)/2-1] + values[len(values)/2]) / 2
+	}
+	res.Min, res.Max = values[0], values[len(values)-1]
+
+	lo, hi := res.Min, res.Max
+	if poll.Range != nil {
+		lo, hi = poll.Range.Min, poll.Range.Max
+	}
+	res.Buckets = numericDistribution(values, lo, hi)
+
+	if poll.Range != nil && poll.Range.Answer != nil {
+		answer := *poll.Range.Answer
+		best := math.Inf(1)
+		for _, v := range values {
+			switch d := math.Abs(v - answer); {
+			case d < best:
+				best, res.ClosestCount = d, 1
+				closest := v
+				res.Closest = &closest
+			case d == best && v == *res.Closest:
+				res.ClosestCount++
+			}
+			if v == answer {
+				res.Exact++
+			}
+		}
+	}
+	return res
+}
+
+// numericDistribution buckets sorted values between lo and hi: one bucket
+// per whole number for a small whole-number range, such as a 1 to 10
+// rating, and numericBuckets equal ones otherwise.
+func numericDistribution(values []float64, lo, hi float64) []NumericBucket {
+	if hi <= lo {
+		return []NumericBucket{{From: lo, To: hi, Count: len(values)}}
+	}
+	var buckets []NumericBucket
+	whole := lo == math.Trunc(lo) && hi == math.Trunc(hi) && hi-lo < numericBuckets
+	if whole {
+		for v := lo; v <= hi; v++ {
+			buckets = append(buckets, NumericBucket{From: v, To: v})
+		}
+	} else {
+		width := (hi - lo) / numericBuckets
+		for i := range numericBuckets {
+			buckets = append(buckets, NumericBucket{From: lo + float64(i)*width, To: lo + float64(i+1)*width})
+		}
+		buckets[len(buckets)-1].To = hi
+	}
+	for _, v := range values {
+		var i int
+		if whole {
+			i = int(math.Round(v - lo))
+		} else {
+			i = int((v - lo) / (hi - lo) * numericBuckets)
+		}
+		buckets[min(max(i, 0), len(buckets)-1)].Count++
+	}
+	return buckets
+}
+
+// numericSummary describes the answers to poll so far for the prompt
+// context: how many, their mean, median and spread, and where they bunch
+// up.
+func numericSummary(poll PollQuestion) string {
+	res := numericResults(poll)
+	if res.Count == 0 {
+		return "No answers yet.\n"
+	}
+	lines := []string{
+		fmt.Sprintf("%d answers: mean %s, median %s, lowest %s, highest %s", res.Count, formatNumber(res.Mean), formatNumber(res.Median), formatNumber(res.Min), formatNumber(res.Max)),
+	}
+	var bars []string
+	for _, b := range res.Buckets {
+		bars = append(bars, fmt.Sprintf("%s: %d", bucketLabel(b), b.Count))
+	}
+	lines = append(lines, "Distribution: "+strings.Join(bars, ", "))
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// numericResultsText is the results announcement of a closed numeric poll:
+// the aggregates, the busiest part of the distribution and, for a guess,
+// the right answer and how close the audience came.
+func numericResultsText(poll PollQuestion) string {
+	res := numericResults(poll)
+	if res.Count == 0 {
+		return fmt.Sprintf("Voting has closed on %q, and nobody answered.", poll.Question)
+	}
+	text := fmt.Sprintf("Voting has closed on %q, a question answered with a number.\n%s", poll.Question, numericSummary(poll))
+	busiest := res.Buckets[0]
+	for _, b := range res.Buckets[1:] {
+		if b.Count > busiest.Count {
+			busiest = b
+		}
+	}
+	text += fmt.Sprintf("Most answers, %d of %d, were %s.", busiest.Count, res.Count, bucketLabel(busiest))
+	if res.Closest != nil {
+		text += fmt.Sprintf("\nThe right answer is %s. ", formatNumber(*poll.Range.Answer))
+		if res.Exact > 0 {
+			text += fmt.Sprintf("%d got it exactly right.", res.Exact)
+		} else {
+			text += fmt.Sprintf("Nobody got it exactly; the closest guess was %s, from %d voters.", formatNumber(*res.Closest), res.ClosestCount)
+		}
+	}
+	return text
+}
+
+// bucketLabel reads out the values b covers.
+func bucketLabel(b NumericBucket) string {
+	if b.From == b.To {
+		return formatNumber(b.From)
+	}
+	return formatNumber(b.From) + " to " + formatNumber(b.To)
+}
+
+// formatNumber writes v with at most one decimal.
+func formatNumber(v float64) string {
+	return fmt.Sprintf("%g", math.Round(v*10)/10)
+}
+
+// checkNewPoll checks a poll written by hand: a question, and either at
+// least two options, nothing more for an open-text poll, or for a numeric
+// poll a range holding its answer.
+func checkNewPoll(question, kind string, r *NumericRange, options int) error {
+	switch {
+	case question == "":
+		return errors.New("a question is required")
+	case kind != "" && kind != pollKindNumeric && kind != pollKindText:
+		return fmt.Errorf("unknown poll kind %q", kind)
+	case kind == "" && options < 2:
+		return errors.New("at least two options are required")
+	case kind == "":
+		return nil
+	case options > 0:
+		return fmt.Errorf("a %s poll has no options", kind)
+	case kind == pollKindText && r != nil:
+		return errors.New("an open-text poll has no range")
+	case kind == pollKindText:
+		return nil
+	case r == nil || r.Max <= r.Min:
+		return errors.New("a numeric poll needs a range with max above min")
+	case r.Answer != nil && (*r.Answer < r.Min || *r.Answer > r.Max):
+		return errors.New("the answer must be within the range")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNumericResults(t *testing.T) {
+	rating := PollQuestion{Kind: pollKindNumeric, Range: &NumericRange{Min: 1, Max: 10}, Answers: map[string]float64{
+		"ann": 8, "bob": 9, "cat": 8, "dan": 3,
+	}}
+	res := numericResults(rating)
+	if res.Count != 4 || res.Mean != 7 || res.Median != 8 || res.Min != 3 || res.Max != 9 {
+		t.Errorf("results = %+v, want 4 answers, mean 7 and median 8", res)
+	}
+	if len(res.Buckets) != 10 || res.Buckets[7] != (NumericBucket{From: 8, To: 8, Count: 2}) || res.Buckets[2].Count != 1 {
+		t.Errorf("buckets = %+v, want one per rating", res.Buckets)
+	}
+
+	answer := 1947.0
+	guess := PollQuestion{Kind: pollKindNumeric, Range: &NumericRange{Min: 1900, Max: 2000, Answer: &answer}, Answers: map[string]float64{
+		"ann": 1950, "bob": 1950, "cat": 1900, "dan": 2000,
+	}}
+	res = numericResults(guess)
+	if res.Median != 1950 || len(res.Buckets) != numericBuckets || res.Buckets[0].Count != 1 || res.Buckets[5].Count != 2 || res.Buckets[9].Count != 1 {
+		t.Errorf("results = %+v, want ten buckets of ten years", res)
+	}
+	if res.Exact != 0 || res.Closest == nil || *res.Closest != 1950 || res.ClosestCount != 2 {
+		t.Errorf("results = %+v, want 1950 closest, from two voters", res)
+	}
+	got := numericResultsText(guess)
+	for _, want := range []string{"4 answers: mean 1950, median 1950", "Most answers, 2 of 4, were 1950 to 1960.", "The right answer is 1947.", "closest guess was 1950, from 2 voters"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("results = %q, want %q in it", got, want)
+		}
+	}
+}
+
+func TestTallyNumericPoll(t *testing.T) {
+	poll := PollQuestion{Kind: pollKindNumeric, Range: &NumericRange{Min: 1, Max: 10}, MaxVotes: 2, Answers: map[string]float64{
+		"ann": 7, "bob": 11, "eve": 4,
+	}}
+	identity := func(id string) (string, error) { return id, nil }
+	tally, err := tallyPoll(context.Background(), newMemoryStore(), identity, poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]float64{"ann": 7, "eve": 4}; !reflect.DeepEqual(tally.Poll.Answers, want) {
+		t.Errorf("answers = %v, want %v", tally.Poll.Answers, want)
+	}
+	if want := map[string]IneligibleVote{"bob": {Option: pollAnswerKey, Reason: "answer out of range"}}; !reflect.DeepEqual(tally.Ineligible, want) {
+		t.Errorf("ineligible = %v, want %v", tally.Ineligible, want)
+	}
+	if closed, _ := pollClosed(tally.Poll, clock.Now()); !closed {
+		t.Error("poll with maxVotes answers is still open")
+	}
+}
+
+func TestNumericPollAnnouncesItsOwnResults(t *testing.T) {
+	store := newMemoryStore()
+	store.SetPoll("q1", PollQuestion{Question: "Rate the keynote", Kind: pollKindNumeric, Range: &NumericRange{Min: 1, Max: 10}, Closed: true,
+		Answers: map[string]float64{"ann": 9, "bob": 7}})
+	b := newTestBot(t, store, generatorFunc(nil))
+
+	status, err := b.fetchPollStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(status, "2 answers: mean 8, median 8") || !strings.Contains(status, "Distribution: 1: 0") {
+		t.Errorf("poll status = %q, want the aggregates", status)
+	}
+	got := b.pollResultsAnnouncements()
+	if len(got) != 1 || got[0].Kind != "numeric-poll-results" || !strings.Contains(got[0].Text, "2 answers") {
+		t.Fatalf("announcements = %v, want the numeric results", got)
+	}
+	if b.prompts.Lookup("numeric-poll-results.tmpl") == nil {
+		t.Error("no prompt for numeric poll results")
+	}
+}
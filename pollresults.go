@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PollResult is one option of a closed poll with its share of the votes.
+type PollResult struct {
+	Key     string  `json:"key"`
+	Label   string  `json:"label"`
+	Text    string  `json:"text"`
+	Votes   int     `json:"votes"`
+	Percent float64 `json:"percent"`
+}
+
+// pollClosed reports whether voting on poll is over at now, and since when:
+// an organizer set closed, closesAt has passed, or maxVotes eligible votes
+// are in. Closing by flag or vote count is dated now.
+func pollClosed(poll PollQuestion, now time.Time) (bool, time.Time) {
+	if !poll.ClosesAt.IsZero() && !now.Before(poll.ClosesAt) {
+		return true, poll.ClosesAt
+	}
+	if poll.Closed {
+		return true, now
+	}
+	if poll.MaxVotes > 0 && pollVotes(poll) >= poll.MaxVotes {
+		return true, now
+	}
+	return false, time.Time{}
+}
+
+// pollResults lists poll's options, most votes first, with their share of
+// total, the votes cast, rounded to a tenth of a percent.
+func pollResults(poll PollQuestion) (results []PollResult, total int) {
+	for key, opt := range poll.Options {
+		results = append(results, PollResult{Key: key, Label: opt.Label, Text: opt.OpText, Votes: len(opt.Voters)})
+		total += len(opt.Voters)
+	}
+	for i := range results {
+		if total > 0 {
+			results[i].Percent = math.Round(float64(results[i].Votes)*1000/float64(total)) / 10
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Votes == results[j].Votes {
+			return results[i].Key < results[j].Key
+		}
+		return results[i].Votes > results[j].Votes
+	})
+	return results, total
+}
+
+// pollResultsText is the results announcement the host dramatizes: the
+// question, every option's percentage and the winner, or the tied
+// leaders.
+func pollResultsText(poll PollQuestion) string {
+	results, total := pollResults(poll)
+	if total == 0 {
+		return fmt.Sprintf("Voting has closed on %q, and nobody voted.", poll.Question)
+	}
+	var lines []string
+	var winners []string
+	for _, r := range results {
+		lines = append(lines, fmt.Sprintf("%s - %s: %g%% (%d votes)", r.Label, r.Text, r.Percent, r.Votes))
+		if r.Votes == results[0].Votes {
+			winners = append(winners, fmt.Sprintf("%s - %s", r.Label, r.Text))
+		}
+	}
+	winner := "The winner is " + winners[0]
+	if len(winners) > 1 {
+		winner = "It's a tie between " + strings.Join(winners, " and ")
+	}
+	return fmt.Sprintf("Voting has closed on %q with %d votes.\n%s\n%s.", poll.Question, total, strings.Join(lines, "\n"), winner)
+}
+
+// notePollResults queues the results announcement of the active poll once
+// it closes, unless they were already announced. Only the monitor calls
+// it.
+func (b *Bot) notePollResults(tally *PollTally) {
+	closed, at := pollClosed(tally.Poll, clock.Now())
+	if !closed {
+		return
+	}
+	b.notePollClosed(tally.ID, at)
+	// Open-text results wait for their themes, and wagered ones for the
+	// wagers to be settled.
+	if !tally.Poll.ResultsAnnounced && !tally.Poll.awaitingThemes() && !tally.Poll.awaitingSettlement() {
+		b.pollResults = tally
+	}
+}
+
+// pollResultsAnnouncements returns the queued results announcement, if
+// any, with numeric and open-text polls, and polls wagered on, getting
+// prompts of their own. Its Done records them announced on the poll
+// document. Only the monitor calls it.
+func (b *Bot) pollResultsAnnouncements() []hostAnnouncement {
+	tally := b.pollResults
+	if tally == nil {
+		return nil
+	}
+	kind, text := "poll-results", pollResultsText(tally.Poll)
+	switch {
+	case tally.Poll.numeric():
+		kind, text = "numeric-poll-results", numericResultsText(tally.Poll)
+	case tally.Poll.textual():
+		kind, text = "text-poll-results", textResultsText(tally.Poll)
+	case len(tally.Poll.WagerResults) > 0:
+		kind, text = "wager-results", text+"\n"+wagerResultsText(tally.Poll)
+	}
+	return []hostAnnouncement{{
+		Kind: kind,
+		Text: text,
+		Done: func(ctx context.Context) error {
+			b.pollResults = nil
+			return b.polls.MarkResultsAnnounced(ctx, tally.ID)
+		},
+	}}
+}
+
+func registerPollResultRoutes(mux *http.ServeMux, b *Bot) {
+	// Closes the active poll, or the one named by "id"; the host announces
+	// the results on the next monitor tick if it is the active one.
+	mux.HandleFunc("POST /admin/poll/close", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.ID == "" {
+			body.ID = b.activePollID()
+		}
+		if _, err := b.polls.Poll(r.Context(), body.ID); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err := b.polls.ClosePoll(r.Context(), body.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"id": body.ID, "closed": true})
+	})
+}
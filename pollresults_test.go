@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollClosed(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	votes := map[string]PollOption{
+		"A": {Label: "A", Voters: []string{"ann", "bob"}},
+		"B": {Label: "B", Voters: []string{"cat"}},
+	}
+	tests := []struct {
+		name string
+		poll PollQuestion
+		want bool
+	}{
+		{"open", PollQuestion{Options: votes}, false},
+		{"closed by organizer", PollQuestion{Options: votes, Closed: true}, true},
+		{"timer running", PollQuestion{Options: votes, ClosesAt: now.Add(time.Second)}, false},
+		{"timer up", PollQuestion{Options: votes, ClosesAt: now}, true},
+		{"under threshold", PollQuestion{Options: votes, MaxVotes: 4}, false},
+		{"threshold reached", PollQuestion{Options: votes, MaxVotes: 3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := pollClosed(tt.poll, now); got != tt.want {
+				t.Errorf("pollClosed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPollResultsText(t *testing.T) {
+	poll := PollQuestion{Question: "Tabs or spaces?", Options: map[string]PollOption{
+		"A": {Label: "A", OpText: "Tabs", Voters: []string{"ann"}},
+		"B": {Label: "B", OpText: "Spaces", Voters: []string{"bob", "cat"}},
+		"C": {Label: "C", OpText: "Both", Voters: []string{}},
+	}}
+	got := pollResultsText(poll)
+	for _, want := range []string{"3 votes", "B - Spaces: 66.7% (2 votes)", "A - Tabs: 33.3% (1 votes)", "C - Both: 0% (0 votes)", "The winner is B - Spaces."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("results = %q, want %q in it", got, want)
+		}
+	}
+	if i, j := strings.Index(got, "Spaces:"), strings.Index(got, "Tabs:"); i > j {
+		t.Errorf("results = %q, want the most votes first", got)
+	}
+
+	poll.Options["A"] = PollOption{Label: "A", OpText: "Tabs", Voters: []string{"ann", "dan"}}
+	if got := pollResultsText(poll); !strings.Contains(got, "tie between A - Tabs and B - Spaces") {
+		t.Errorf("results = %q, want a tie", got)
+	}
+	if got := pollResultsText(PollQuestion{Question: "Anyone?"}); !strings.Contains(got, "nobody voted") {
+		t.Errorf("results = %q, want nobody voted", got)
+	}
+}
+
+func TestPollResultsAnnouncedOnce(t *testing.T) {
+	store := newMemoryStore()
+	store.SetPoll("q1", PollQuestion{Question: "Chai or coffee?", Options: map[string]PollOption{
+		"A": {Label: "A", OpText: "Chai", Voters: []string{"ann"}},
+		"B": {Label: "B", OpText: "Coffee"},
+	}})
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.AdminToken = "s3cret"
+	events, unsubscribe := b.bus.Subscribe(EventPollClosed)
+	defer unsubscribe()
+	ctx := context.Background()
+
+	if _, err := b.fetchPollStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.pollResultsAnnouncements(); len(got) != 0 {
+		t.Fatalf("announcements for an open poll = %v", got)
+	}
+
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/poll/close", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /admin/poll/close = %d", resp.StatusCode)
+	}
+
+	status, err := b.fetchPollStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(status, "voting has closed") {
+		t.Errorf("poll status = %q, want it marked closed", status)
+	}
+	got := b.pollResultsAnnouncements()
+	if len(got) != 1 || got[0].Kind != "poll-results" || !strings.Contains(got[0].Text, "The winner is A - Chai") {
+		t.Fatalf("announcements = %v, want the results", got)
+	}
+	select {
+	case e := <-events:
+		if e.PollID != "q1" {
+			t.Errorf("poll-closed for %q, want q1", e.PollID)
+		}
+	default:
+		t.Error("no poll-closed event")
+	}
+	if err := got[0].Done(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.fetchPollStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.pollResultsAnnouncements(); len(got) != 0 {
+		t.Errorf("announcements after the results went out = %v", got)
+	}
+}
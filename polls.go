@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// activePoll is the poll document the host reports on and since when.
+type activePoll struct {
+	ID    string    `json:"id"`
+	Since time.Time `json:"since"`
+}
+
+// activePollID is the poll the host is reporting on now.
+func (b *Bot) activePollID() string {
+	return b.room.poll.Load().ID
+}
+
+// switchPoll makes id the active poll. The host announces it on the next
+// monitor tick, and only it is reported in the prompt context from then on.
+func (b *Bot) switchPoll(id string) {
+	prev := b.room.poll.Swap(&activePoll{ID: id, Since: clock.Now()})
+	if prev.ID == id {
+		return
+	}
+	slog.Info("switching the live poll", "from", prev.ID, "to", id)
+	b.room.announcePoll.Store(true)
+	b.bus.Publish(Event{Kind: EventStateChanged, State: "poll", From: prev.ID, To: id})
+}
+
+// nextPollID is the poll after the active one in the rotation, or the
+// first if the active poll was picked by hand from outside it.
+func (b *Bot) nextPollID() string {
+	ids := b.pollRotation()
+	i := slices.Index(ids, b.activePollID())
+	return ids[(i+1)%len(ids)]
+}
+
+// rotatePoll moves on once the active poll has run for polls.rotateEvery:
+// to a newly generated poll with polls.generate, or else, or if that
+// fails, to the next poll in the rotation. The monitor calls it every tick.
+func (b *Bot) rotatePoll(ctx context.Context, now time.Time) {
+	every := b.cfg.Polls.RotateEvery.Duration
+	if every <= 0 || (len(b.pollRotation()) < 2 && !b.cfg.Polls.Generate) {
+		return
+	}
+	active := b.room.poll.Load()
+	if now.Sub(active.Since) < every {
+		return
+	}
+	if b.cfg.Polls.Generate {
+		id, _, err := b.createPoll(ctx, "")
+		if err == nil {
+			b.switchPoll(id)
+			return
+		}
+		slog.Error("error generating the next poll", "err", err)
+		if len(b.pollRotation()) < 2 {
+			// Nothing to rotate to; try again after another rotateEvery.
+			b.room.poll.CompareAndSwap(active, &activePoll{ID: active.ID, Since: now})
+			return
+		}
+	}
+	b.switchPoll(b.nextPollID())
+}
+
+func registerPollRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/polls", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"active": b.room.poll.Load(), "rotation": b.pollRotation(), "rotateEvery": b.cfg.Polls.RotateEvery})
+	})
+
+	// Any poll document can be made active, in the rotation or not.
+	mux.HandleFunc("PUT /admin/poll", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.ID == "" {
+			writeError(w, http.StatusBadRequest, errors.New("id is required"))
+			return
+		}
+		if _, err := b.polls.Poll(r.Context(), body.ID); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		b.switchPoll(body.ID)
+		writeJSON(w, http.StatusOK, b.room.poll.Load())
+	})
+
+	mux.HandleFunc("POST /admin/poll/next", func(w http.ResponseWriter, r *http.Request) {
+		b.switchPoll(b.nextPollID())
+		writeJSON(w, http.StatusOK, b.room.poll.Load())
+	})
+}
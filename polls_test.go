@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatePoll(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		ids     []string
+		every   time.Duration
+		elapsed time.Duration
+		want    string
+	}{
+		{"not yet", []string{"q1", "q2"}, 10 * time.Minute, 9 * time.Minute, "q1"},
+		{"due", []string{"q1", "q2"}, 10 * time.Minute, 10 * time.Minute, "q2"},
+		{"rotation off", []string{"q1", "q2"}, 0, time.Hour, "q1"},
+		{"single poll", []string{"q1"}, 10 * time.Minute, time.Hour, "q1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+			b.cfg.Polls = PollsConfig{IDs: tt.ids, RotateEvery: Duration{tt.every}}
+			b.room.poll.Store(&activePoll{ID: tt.ids[0], Since: start})
+			b.rotatePoll(context.Background(), start.Add(tt.elapsed))
+			if got := b.activePollID(); got != tt.want {
+				t.Errorf("active poll = %q, want %q", got, tt.want)
+			}
+			if got := b.room.announcePoll.Load(); got != (tt.want != tt.ids[0]) {
+				t.Errorf("announcePoll = %v after rotating to %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwitchPollFromAdmin(t *testing.T) {
+	store := newMemoryStore()
+	store.SetPoll("q1", PollQuestion{Question: "Favourite Gemini model?", Options: map[string]PollOption{"a": {Label: "A", OpText: "Flash"}}})
+	store.SetPoll("q2", PollQuestion{Question: "Tabs or spaces?", Options: map[string]PollOption{"a": {Label: "A", OpText: "Tabs", Voters: []string{"ann"}}}})
+	store.SetPoll("bonus", PollQuestion{Question: "Chai or coffee?", Options: map[string]PollOption{"a": {Label: "A", OpText: "Chai"}}})
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.AdminToken = "s3cret"
+	b.cfg.Polls.IDs = []string{"q1", "q2"}
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	do := func(method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	status := func() string {
+		t.Helper()
+		s, err := b.fetchPollStatus(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	if s := status(); !strings.Contains(s, "Favourite Gemini model?") {
+		t.Errorf("poll status = %q, want the first poll", s)
+	}
+	if code := do(http.MethodPost, "/admin/poll/next", ""); code != http.StatusOK {
+		t.Fatalf("POST /admin/poll/next = %d", code)
+	}
+	if s := status(); !strings.Contains(s, "Tabs or spaces?") || strings.Contains(s, "Gemini") {
+		t.Errorf("poll status = %q, want only the second poll", s)
+	}
+	if code := do(http.MethodPut, "/admin/poll", `{"id": "missing"}`); code != http.StatusNotFound {
+		t.Errorf("PUT /admin/poll missing = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := do(http.MethodPut, "/admin/poll", `{"id": "bonus"}`); code != http.StatusOK {
+		t.Fatalf("PUT /admin/poll bonus = %d", code)
+	}
+	if s := status(); !strings.Contains(s, "Chai or coffee?") {
+		t.Errorf("poll status = %q, want the bonus poll", s)
+	}
+	if next := b.nextPollID(); next != "q1" {
+		t.Errorf("next poll after one outside the rotation = %q, want q1", next)
+	}
+}
+
+func TestPollSummary(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	options := map[string]PollOption{
+		"c": {Label: "C", OpText: "Neither"},
+		"a": {Label: "A", OpText: "Chai", Voters: []string{"ann", "bob"}},
+		"b": {Label: "B", OpText: "Coffee", Voters: []string{"cat"}},
+	}
+	tests := []struct {
+		name  string
+		tally PollTally
+		want  string
+	}{
+		{"open", PollTally{Poll: PollQuestion{Question: "Chai or coffee?", Options: options}},
+			"Question: Chai or coffee?\nA - Chai: 2 votes\nB - Coffee: 1 votes\nC - Neither: 0 votes\n"},
+		{"ineligible votes", PollTally{Poll: PollQuestion{Question: "Chai or coffee?", Options: options}, Ineligible: map[string]IneligibleVote{"dan": {}, "eve": {}}},
+			"Question: Chai or coffee?\nA - Chai: 2 votes\nB - Coffee: 1 votes\nC - Neither: 0 votes\n(2 ineligible votes excluded)\n"},
+		{"closed", PollTally{Poll: PollQuestion{Question: "Chai or coffee?", Options: options, Closed: true}},
+			"Question: Chai or coffee?\nA - Chai: 2 votes\nB - Coffee: 1 votes\nC - Neither: 0 votes\n(voting has closed)\n"},
+		{"no options", PollTally{Poll: PollQuestion{Question: "Anything to ask?"}}, "Question: Anything to ask?\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Option order must not depend on map iteration, or the
+			// monitor would see the status change every tick.
+			for range 10 {
+				if got := pollSummary(&tt.tally, now); got != tt.want {
+					t.Fatalf("pollSummary = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
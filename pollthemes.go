@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// pollKindText is the kind of poll answered in the audience's own words.
+// Its answers are grouped into themes by the model once voting closes.
+const pollKindText = "text"
+
+const (
+	// maxPollThemes is how many themes of an open-text poll are published.
+	maxPollThemes = 5
+	// maxClusteredAnswers caps the answers sent to the model, and
+	// maxAnswerRunes each answer.
+	maxClusteredAnswers = 300
+	maxAnswerRunes      = 200
+)
+
+// PollTheme is one theme in the answers to an open-text poll.
+type PollTheme struct {
+	Theme string `firestore:"theme" json:"theme"`
+	// Summary says what the answers in it said, as "most of you said..."
+	Summary string `firestore:"summary" json:"summary"`
+	Count   int    `firestore:"count" json:"count"`
+}
+
+// textual reports whether poll is answered in free text.
+func (p PollQuestion) textual() bool {
+	return p.Kind == pollKindText
+}
+
+// awaitingThemes reports whether poll is an open-text poll whose answers
+// are yet to be grouped into themes.
+func (p PollQuestion) awaitingThemes() bool {
+	return p.textual() && len(p.TextAnswers) > 0 && len(p.Themes) == 0
+}
+
+// clusterAnswers has model group the answers to question into at most
+// maxPollThemes themes, the most common first.
+func clusterAnswers(ctx context.Context, model ResponseGenerator, question string, answers []string) ([]PollTheme, error) {
+	lines := make([]string, 0, len(answers))
+	for _, a := range answers[:min(len(answers), maxClusteredAnswers)] {
+		a = strings.Join(strings.Fields(a), " ")
+		if r := []rune(a); len(r) > maxAnswerRunes {
+			a = string(r[:maxAnswerRunes])
+		}
+		lines = append(lines, "- "+a)
+	}
+	requestText := fmt.Sprintf(`The live audience answered the question %q in their own words. Their answers:
+%s
+Group the answers into at most %d themes, the most common first. For each, give a short name, a one-sentence summary of what those answers said, phrased for the host to read out such as "most of you said...", and how many answers belong to it.
+Reply with only JSON of the form {"themes": [{"theme": "...", "summary": "...", "count": 3}]}.`, question, strings.Join(lines, "\n"), maxPollThemes)
+
+	text, err := model.Generate(ctx, requestText)
+	if err != nil {
+		return nil, fmt.Errorf("model error: %w", err)
+	}
+	var out struct {
+		Themes []PollTheme `json:"themes"`
+	}
+	if err := json.Unmarshal([]byte(extractJSON(text)), &out); err != nil {
+		return nil, fmt.Errorf("error parsing answer themes: %w", err)
+	}
+	var themes []PollTheme
+	for _, t := range out.Themes {
+		t.Theme, t.Summary = strings.TrimSpace(t.Theme), strings.TrimSpace(t.Summary)
+		if t.Theme == "" || t.Summary == "" || t.Count < 1 {
+			continue
+		}
+		themes = append(themes, t)
+	}
+	if len(themes) == 0 {
+		return nil, fmt.Errorf("model returned no usable themes: %q", text)
+	}
+	sort.SliceStable(themes, func(i, j int) bool { return themes[i].Count > themes[j].Count })
+	return themes[:min(len(themes), maxPollThemes)], nil
+}
+
+// clusterPollAnswers groups the answers to the closed open-text poll of
+// tally into themes and saves them to the poll, so they are published as
+// its result. Answers caught by the blocklist are left out, and themes
+// that would need masking fail; the monitor tries again next tick. It does
+// nothing for other polls, open ones, or ones already clustered.
+func (b *Bot) clusterPollAnswers(ctx context.Context, tally *PollTally) error {
+	if closed, _ := pollClosed(tally.Poll, clock.Now()); !closed || !tally.Poll.awaitingThemes() {
+		return nil
+	}
+	voters := make([]string, 0, len(tally.Poll.TextAnswers))
+	for voter := range tally.Poll.TextAnswers {
+		voters = append(voters, voter)
+	}
+	sort.Strings(voters)
+	var answers []string
+	for _, voter := range voters {
+		if a := tally.Poll.TextAnswers[voter]; strings.TrimSpace(a) != "" && !b.moderator.containsBlocked(a) {
+			answers = append(answers, a)
+		}
+	}
+	if len(answers) == 0 {
+		// Nothing fit to publish: announce it as unanswered.
+		tally.Poll.TextAnswers = nil
+		return nil
+	}
+
+	ctx = b.costs.attribute(ctx, featurePollThemes)
+	b.costs.item(featurePollThemes)
+	themes, err := clusterAnswers(ctx, b.ladderModel(), tally.Poll.Question, answers)
+	if err != nil {
+		return err
+	}
+	for _, t := range themes {
+		if b.moderator.containsBlocked(t.Theme + " " + t.Summary) {
+			return fmt.Errorf("answer theme %q failed moderation", t.Theme)
+		}
+	}
+	if err := b.polls.SetPollThemes(ctx, tally.ID, themes); err != nil {
+		return fmt.Errorf("error saving answer themes: %w", err)
+	}
+	tally.Poll.Themes = themes
+	return nil
+}
+
+// textSummary describes the answers to an open-text poll for the prompt
+// context.
+func textSummary(poll PollQuestion) string {
+	summary := fmt.Sprintf("%d answers in the audience's own words so far.\n", len(poll.TextAnswers))
+	for _, t := range poll.Themes {
+		summary += fmt.Sprintf("%s (%d answers): %s\n", t.Theme, t.Count, t.Summary)
+	}
+	return summary
+}
+
+// textResultsText is the results announcement of a closed open-text poll:
+// its top themes, with what each said and how many said it.
+func textResultsText(poll PollQuestion) string {
+	if len(poll.Themes) == 0 {
+		return fmt.Sprintf("Voting has closed on %q, and nobody answered.", poll.Question)
+	}
+	lines := make([]string, len(poll.Themes))
+	for i, t := range poll.Themes {
+		lines[i] = fmt.Sprintf("%d. %s (%d answers): %s", i+1, t.Theme, t.Count, t.Summary)
+	}
+	return fmt.Sprintf("Voting has closed on %q, answered in the audience's own words by %d people. The top themes:\n%s",
+		poll.Question, len(poll.TextAnswers), strings.Join(lines, "\n"))
+}
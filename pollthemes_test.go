@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClusterAnswers(t *testing.T) {
+	var prompt string
+	model := generatorFunc(func(ctx context.Context, p string) (string, error) {
+		prompt = p
+		return "```json\n" + `{"themes": [
+			{"theme": "Snacks", "summary": "A few of you wanted better snacks.", "count": 1},
+			{"theme": "", "summary": "Unnamed", "count": 4},
+			{"theme": "Pace", "summary": "Most of you said the talks ran too fast.", "count": 2}
+		]}` + "\n```", nil
+	})
+	got, err := clusterAnswers(context.Background(), model, "What should we change?", []string{"slower  talks", "too fast", "more snacks"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PollTheme{
+		{Theme: "Pace", Summary: "Most of you said the talks ran too fast.", Count: 2},
+		{Theme: "Snacks", Summary: "A few of you wanted better snacks.", Count: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("themes = %+v, want %+v", got, want)
+	}
+	if !strings.Contains(prompt, "- slower talks\n") {
+		t.Errorf("prompt = %q, want the answers listed", prompt)
+	}
+
+	if _, err := clusterAnswers(context.Background(), generatorFunc(func(ctx context.Context, p string) (string, error) {
+		return `{"themes": []}`, nil
+	}), "Q", []string{"a"}); err == nil {
+		t.Error("no themes did not fail")
+	}
+}
+
+func TestTallyTextPoll(t *testing.T) {
+	poll := PollQuestion{Kind: pollKindText, TextAnswers: map[string]string{"ann": "more breaks", "bob": "louder mics"}}
+	identity := func(id string) (string, error) { return id, nil }
+	tally, err := tallyPoll(context.Background(), newMemoryStore(), identity, poll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tally.Poll.TextAnswers, poll.TextAnswers) {
+		t.Errorf("answers = %v, want %v", tally.Poll.TextAnswers, poll.TextAnswers)
+	}
+	if !tally.Poll.awaitingThemes() {
+		t.Error("unclustered text poll is not awaiting themes")
+	}
+}
+
+func TestTextPollAnnouncesItsThemes(t *testing.T) {
+	store := newMemoryStore()
+	store.SetPoll("q1", PollQuestion{Question: "What should we change?", Kind: pollKindText, Closed: true,
+		TextAnswers: map[string]string{"ann": "slower talks", "bob": "talks too fast", "cat": "more snacks"}})
+	var calls int
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		calls++
+		return `{"themes": [{"theme": "Pace", "summary": "Most of you said the talks ran too fast.", "count": 2},
+			{"theme": "Snacks", "summary": "Some of you wanted more snacks.", "count": 1}]}`, nil
+	}))
+
+	status, err := b.fetchPollStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(status, "Pace (2 answers): Most of you said the talks ran too fast.") {
+		t.Errorf("poll status = %q, want the themes", status)
+	}
+	if p, _ := store.Poll(context.Background(), "q1"); p == nil || len(p.Themes) != 2 {
+		t.Errorf("saved poll = %+v, want two themes", p)
+	}
+	got := b.pollResultsAnnouncements()
+	if len(got) != 1 || got[0].Kind != "text-poll-results" || !strings.Contains(got[0].Text, "1. Pace (2 answers)") {
+		t.Fatalf("announcements = %v, want the themes", got)
+	}
+	if b.prompts.Lookup("text-poll-results.tmpl") == nil {
+		t.Error("no prompt for open-text poll results")
+	}
+
+	if _, err := b.fetchPollStatus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("model called %d times, want the themes clustered once", calls)
+	}
+}
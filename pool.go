@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// claimRetention is how long a finished message stays claimed, so that a
+// snapshot taken before it was marked processed doesn't answer it again.
+const claimRetention = time.Minute
+
+// backlogInterval is how often messages waiting for room in the queue are
+// retried, so they don't wait for the next snapshot, which only comes when
+// a message arrives or changes.
+const backlogInterval = 250 * time.Millisecond
+
+// workerPool queues triaged messages for a fixed number of workers and
+// remembers which messages are already claimed, since every snapshot lists
+// all unprocessed messages, including those still being answered.
+type workerPool struct {
+	jobs chan triagedMessage
+	// busy counts the workers handling a message.
+	busy atomic.Int64
+
+	mu sync.Mutex
+	// claimed maps message IDs to when they finished, or the zero time
+	// while they are waiting, queued or in flight.
+	claimed map[string]time.Time
+	// backlog holds triaged messages, in the order to answer them, that
+	// did not fit in the queue yet.
+	backlog []triagedMessage
+	closed  bool
+	done    chan struct{}
+}
+
+func newWorkerPool(workers int) *workerPool {
+	return &workerPool{
+		jobs:    make(chan triagedMessage, workers),
+		claimed: map[string]time.Time{},
+		done:    make(chan struct{}),
+	}
+}
+
+// claim returns the messages in batch that no worker has claimed yet and
+// claims them. They are to be triaged as a whole and handed to queue, so
+// the best of the batch are answered first however little room the queue
+// has.
+func (p *workerPool) claim(batch []*Message) []*Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := clock.Now()
+	for id, finished := range p.claimed {
+		if !finished.IsZero() && now.Sub(finished) > claimRetention {
+			delete(p.claimed, id)
+		}
+	}
+	var fresh []*Message
+	for _, m := range batch {
+		if _, ok := p.claimed[m.ID]; ok {
+			continue
+		}
+		p.claimed[m.ID] = time.Time{}
+		fresh = append(fresh, m)
+	}
+	return fresh
+}
+
+// queue adds triaged messages to the backlog and queues as many of the
+// backlog as there is room for, in order.
+func (p *workerPool) queue(triaged []triagedMessage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backlog = append(p.backlog, triaged...)
+	p.fillLocked()
+}
+
+// fill queues as much of the backlog as there is room for. It never blocks.
+func (p *workerPool) fill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fillLocked()
+}
+
+func (p *workerPool) fillLocked() {
+	for !p.closed && len(p.backlog) > 0 {
+		select {
+		case p.jobs <- p.backlog[0]:
+			p.backlog[0] = triagedMessage{}
+			p.backlog = p.backlog[1:]
+		default:
+			return
+		}
+	}
+}
+
+// waiting returns how many messages are in the backlog.
+func (p *workerPool) waiting() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.backlog)
+}
+
+// refill retries the backlog every backlogInterval until the pool is
+// closed.
+func (p *workerPool) refill() {
+	ticker := clock.NewTicker(backlogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C():
+			p.fill()
+		}
+	}
+}
+
+// close stops queueing and lets the workers finish what is queued; the
+// backlog is dropped, along with its claims, for the next listener.
+func (p *workerPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.backlog = nil
+	close(p.jobs)
+	close(p.done)
+}
+
+// finish releases a worker's claim on id. A message that failed is
+// unclaimed at once so that the next snapshot retries it.
+func (p *workerPool) finish(id string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ok {
+		p.claimed[id] = clock.Now()
+	} else {
+		delete(p.claimed, id)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolTriagesBeforeQueueing(t *testing.T) {
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	b.triage = newTriagePolicy(TriageConfig{Policy: "top-k", K: 1, Window: Duration{time.Minute}, Overflow: "private"})
+	pool := newWorkerPool(1)
+
+	batch := []*Message{
+		{ID: "wow", Message: "wow"},
+		{ID: "q", Message: "What is Gemini and how do I try it?"},
+		{ID: "nice", Message: "nice talk"},
+	}
+	pool.queue(b.triageBatch(pool.claim(batch)))
+	first := <-pool.jobs
+	if first.Msg.ID != "q" || first.Decision != answerPublic {
+		t.Errorf("first queued = %s %s, want the question, public", first.Msg.ID, first.Decision)
+	}
+	if got := pool.claim(batch); len(got) != 0 {
+		t.Errorf("claim of a batch waiting in the backlog = %d messages, want none", len(got))
+	}
+
+	var rest []string
+	for range 2 {
+		pool.fill()
+		t := <-pool.jobs
+		rest = append(rest, t.Msg.ID+" "+t.Decision.String())
+	}
+	if rest[0] != "nice private" || rest[1] != "wow private" {
+		t.Errorf("backlog queued as %q, want the rest in ranked order, private", rest)
+	}
+}
+
+func TestWorkerPoolRefillsBacklog(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	pool := newWorkerPool(1)
+	go pool.refill()
+	defer pool.close()
+	pool.queue([]triagedMessage{{Msg: &Message{ID: "m1"}}, {Msg: &Message{ID: "m2"}}})
+	<-pool.jobs
+
+	waitFor(t, nil, "the refill ticker", func() bool {
+		vc.Advance(backlogInterval)
+		return len(pool.jobs) == 1
+	})
+	if got := <-pool.jobs; got.Msg.ID != "m2" || pool.waiting() != 0 {
+		t.Errorf("refilled %s with %d waiting, want m2 and none", got.Msg.ID, pool.waiting())
+	}
+}
+
+func TestWorkerPoolClaimRetention(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	pool := newWorkerPool(1)
+	batch := []*Message{{ID: "done"}, {ID: "failed"}}
+	pool.claim(batch)
+	pool.finish("done", true)
+	pool.finish("failed", false)
+
+	if got := pool.claim(batch); len(got) != 1 || got[0].ID != "failed" {
+		t.Errorf("claim right after finishing = %v, want only the failed message back", got)
+	}
+	vc.Advance(claimRetention + time.Second)
+	if got := pool.claim(batch); len(got) != 1 || got[0].ID != "done" {
+		t.Errorf("claim after the retention = %v, want the finished message released", got)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	prizeAwarded = "awarded"
+	prizeClaimed = "claimed"
+)
+
+// Prize records what a winner won and whether it has been handed over.
+type Prize struct {
+	WinnerID     string    `firestore:"winnerId" json:"winnerId"`
+	Prize        string    `firestore:"prize" json:"prize"`
+	Reason       string    `firestore:"reason,omitempty" json:"reason,omitempty"`
+	Status       string    `firestore:"status" json:"status"`
+	AwardedAt    time.Time `firestore:"awardedAt" json:"awardedAt"`
+	ClaimedAt    time.Time `firestore:"claimedAt,omitempty" json:"claimedAt,omitempty"`
+	HandedOverBy string    `firestore:"handedOverBy,omitempty" json:"handedOverBy,omitempty"`
+}
+
+var (
+	errPrizeClaimed  = errors.New("prize already claimed")
+	errPrizeNotFound = errors.New("prize not found")
+)
+
+type prizeWithID struct {
+	ID string `json:"id"`
+	Prize
+}
+
+// PrizeStore keeps the prizes awarded to winners.
+type PrizeStore interface {
+	SavePrize(ctx context.Context, id string, p Prize) error
+	// ClaimPrize marks prize id handed over by staff. It fails with
+	// errPrizeClaimed if the prize was already claimed, so the same prize
+	// can't be handed out twice, and errPrizeNotFound for unknown IDs.
+	ClaimPrize(ctx context.Context, id, staff string) (*Prize, error)
+	// Prizes lists the prizes with the given status, or all of them if it
+	// is empty, in the order they were awarded.
+	Prizes(ctx context.Context, status string) ([]prizeWithID, error)
+}
+
+func awardPrize(ctx context.Context, prizes PrizeStore, winnerID, prize, reason string) (string, error) {
+	id := newID("prize")
+	err := prizes.SavePrize(ctx, id, Prize{
+		WinnerID:  winnerID,
+		Prize:     prize,
+		Reason:    reason,
+		Status:    prizeAwarded,
+		AwardedAt: clock.Now(),
+	})
+	return id, err
+}
+
+// registerPrizeRoutes adds the prize admin API:
+//
+//	GET  /admin/prizes?status=awarded|claimed
+//	POST /admin/prizes             {"winnerId", "prize", "reason"}
+//	POST /admin/prizes/{id}/claim  {"staff"}
+//
+// anon maps the winner ID before it is stored, so prizes only ever record
+// pseudonyms in anonymous mode.
+func registerPrizeRoutes(mux *http.ServeMux, prizes PrizeStore, anon func(ctx context.Context, userID string) (string, error)) {
+	mux.HandleFunc("GET /admin/prizes", func(w http.ResponseWriter, r *http.Request) {
+		list, err := prizes.Prizes(r.Context(), r.URL.Query().Get("status"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	mux.HandleFunc("POST /admin/prizes", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			WinnerID string `json:"winnerId"`
+			Prize    string `json:"prize"`
+			Reason   string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.WinnerID == "" || body.Prize == "" {
+			writeError(w, http.StatusBadRequest, errors.New("winnerId and prize are required"))
+			return
+		}
+		winnerID, err := anon(r.Context(), body.WinnerID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		id, err := awardPrize(r.Context(), prizes, winnerID, body.Prize, body.Reason)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+	})
+
+	mux.HandleFunc("POST /admin/prizes/{id}/claim", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Staff string `json:"staff"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if body.Staff == "" {
+			writeError(w, http.StatusBadRequest, errors.New("staff is required"))
+			return
+		}
+		prize, err := prizes.ClaimPrize(r.Context(), r.PathValue("id"), body.Staff)
+		switch {
+		case errors.Is(err, errPrizeNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case errors.Is(err, errPrizeClaimed):
+			writeError(w, http.StatusConflict, err)
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err)
+		default:
+			writeJSON(w, http.StatusOK, prize)
+		}
+	})
+}
+
+// runPrizesReport implements the "prizes-report" command, which lists every
+// prize that hasn't been handed over yet.
+func runPrizesReport(ctx context.Context, w io.Writer, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("prizes-report", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := newFirestoreClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return writePrizesReport(ctx, w, newFirestoreStore(client, cfg))
+}
+
+// writePrizesReport writes a table of the prizes not handed over yet.
+func writePrizesReport(ctx context.Context, w io.Writer, prizes PrizeStore) error {
+	unclaimed, err := prizes.Prizes(ctx, prizeAwarded)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d unclaimed prizes\n\n", len(unclaimed))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tWINNER\tPRIZE\tREASON\tAWARDED")
+	for _, p := range unclaimed {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.ID, p.WinnerID, p.Prize.Prize, p.Reason, p.AwardedAt.Format("2006-01-02 15:04"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrizeRoutes(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	store := newMemoryStore()
+	mux := http.NewServeMux()
+	registerPrizeRoutes(mux, store, func(ctx context.Context, userID string) (string, error) {
+		return "anon-" + userID, nil
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	do := func(method, path, body string, out any) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var created struct{ ID string }
+	if code := do(http.MethodPost, "/admin/prizes", `{"winnerId": "ann", "prize": "T-shirt", "reason": "quiz winner"}`, &created); code != http.StatusCreated || created.ID == "" {
+		t.Fatalf("POST /admin/prizes = %d, %+v, want 201 with an ID", code, created)
+	}
+	vc.Advance(time.Minute)
+	var second struct{ ID string }
+	do(http.MethodPost, "/admin/prizes", `{"winnerId": "bob", "prize": "Mug"}`, &second)
+	if code := do(http.MethodPost, "/admin/prizes", `{"winnerId": "bob"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("POST without a prize = %d, want 400", code)
+	}
+
+	var all []prizeWithID
+	do(http.MethodGet, "/admin/prizes", "", &all)
+	if len(all) != 2 || all[0].ID != created.ID || all[0].WinnerID != "anon-ann" || all[0].Status != prizeAwarded {
+		t.Fatalf("GET /admin/prizes = %+v, want ann's prize first, awarded to her pseudonym", all)
+	}
+
+	var claimed Prize
+	if code := do(http.MethodPost, "/admin/prizes/"+created.ID+"/claim", `{"staff": "desk-1"}`, &claimed); code != http.StatusOK {
+		t.Fatalf("claim = %d, want 200", code)
+	}
+	if claimed.Status != prizeClaimed || claimed.HandedOverBy != "desk-1" || !claimed.ClaimedAt.Equal(clock.Now()) {
+		t.Errorf("claimed prize = %+v, want it handed over by desk-1 now", claimed)
+	}
+	tests := []struct {
+		name, path, body string
+		want             int
+	}{
+		{"twice", "/admin/prizes/" + created.ID + "/claim", `{"staff": "desk-2"}`, http.StatusConflict},
+		{"unknown prize", "/admin/prizes/nope/claim", `{"staff": "desk-1"}`, http.StatusNotFound},
+		{"without staff", "/admin/prizes/" + second.ID + "/claim", `{}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code := do(http.MethodPost, tt.path, tt.body, nil); code != tt.want {
+			t.Errorf("claim %s = %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	var unclaimed []prizeWithID
+	do(http.MethodGet, "/admin/prizes?status=awarded", "", &unclaimed)
+	if len(unclaimed) != 1 || unclaimed[0].ID != second.ID {
+		t.Errorf("GET ?status=awarded = %+v, want only bob's prize", unclaimed)
+	}
+}
+
+func TestPrizesReport(t *testing.T) {
+	store := newMemoryStore()
+	ctx := context.Background()
+	t0 := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	store.SavePrize(ctx, "p2", Prize{WinnerID: "bob", Prize: "Mug", Status: prizeAwarded, AwardedAt: t0.Add(time.Hour)})
+	store.SavePrize(ctx, "p1", Prize{WinnerID: "ann", Prize: "T-shirt", Reason: "quiz winner", Status: prizeAwarded, AwardedAt: t0})
+	store.SavePrize(ctx, "p3", Prize{WinnerID: "cat", Prize: "Stickers", Status: prizeClaimed, AwardedAt: t0})
+
+	var out bytes.Buffer
+	if err := writePrizesReport(ctx, &out, store); err != nil {
+		t.Fatal(err)
+	}
+	want := `2 unclaimed prizes
+
+ID  WINNER  PRIZE    REASON       AWARDED
+p1  ann     T-shirt  quiz winner  2024-12-07 10:00
+p2  bob     Mug                   2024-12-07 11:00
+`
+	if out.String() != want {
+		t.Errorf("report =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// profanityList is a deliberately small blocklist of terms that must never be
+// shown on the stage display. Matching is done on lowercased whole words.
+var profanityList = map[string]bool{
+	"fuck":      true,
+	"fucking":   true,
+	"shit":      true,
+	"bitch":     true,
+	"bastard":   true,
+	"asshole":   true,
+	"dick":      true,
+	"cunt":      true,
+	"slut":      true,
+	"whore":     true,
+	"chutiya":   true,
+	"bhenchod":  true,
+	"madarchod": true,
+	"gandu":     true,
+	"harami":    true,
+	"kutta":     true,
+	"saala":     true,
+}
+
+// splitWords lowercases text and splits it on anything that isn't a letter or digit.
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func isProfane(word string) bool {
+	return profanityList[strings.ToLower(word)]
+}
+
+func containsProfanity(text string) bool {
+	for _, w := range splitWords(text) {
+		if isProfane(w) {
+			return true
+		}
+	}
+	return false
+}
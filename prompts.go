@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultPrompts are the built-in prompt templates. reply.tmpl renders the
+// request for an audience message; a template named after a host prompt
+// kind, such as poll-update.tmpl, replaces it for that kind.
+//
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+// promptData is what every prompt template receives.
+type promptData struct {
+	Persona  Persona
+	MaxWords int
+	// Kind is the host prompt kind ("prompt", "poll-update", ...), empty
+	// for audience messages.
+	Kind    string
+	Message string
+	// Context is everything the reply should draw on: the poll status and
+	// conversation history, plus the sender's earlier questions, any open
+	// AMA and FAQ entries for audience messages, or the announcement text
+	// for host prompts. PollStatus and History are the first two alone.
+	Context    string
+	PollStatus string
+	History    string
+	// Variant is the prompt variant of the A/B experiment an audience
+	// reply takes part in, if any; see experiment.go.
+	Variant string
+	// Language is the language to reply in, as the prompt asks for it,
+	// like "Hindi, in Devanagari script"; see language.go.
+	Language string
+	// Vars are the computed template variables; see templatevars.go.
+	Vars templateVars
+	// EnergyLevel is how intense the host is at this point of the show,
+	// and Energy how the prompt asks for it; see energy.go.
+	EnergyLevel string
+	Energy      string
+}
+
+// loadPrompts parses the built-in templates and then every *.tmpl in dir,
+// if set, which replace built-ins of the same name. Each template is tried
+// once so a typo in a field name fails at startup, not mid-show.
+func loadPrompts(dir string) (*template.Template, error) {
+	t, err := template.New("prompts").ParseFS(defaultPrompts, "prompts/*.tmpl")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing built-in prompts: %w", err)
+	}
+	if dir != "" {
+		if t, err = t.ParseGlob(filepath.Join(dir, "*.tmpl")); err != nil {
+			return nil, fmt.Errorf("error parsing prompts in %s: %w", dir, err)
+		}
+	}
+	for _, tt := range t.Templates() {
+		if tt.Name() == "prompts" {
+			continue
+		}
+		if err := tt.Execute(&bytes.Buffer{}, promptData{}); err != nil {
+			return nil, fmt.Errorf("error in prompt template %s: %w", tt.Name(), err)
+		}
+	}
+	return t, nil
+}
+
+// renderPrompt renders the request text for data.Message, a host prompt
+// kind or an audience message, filling in the poll status, computed
+// variables, energy level and kind.
+func (b *Bot) renderPrompt(data promptData) (string, error) {
+	data.PollStatus = b.room.getPollStatus()
+	data.Vars = b.templateVars(clock.Now())
+	level := b.energy.current()
+	data.EnergyLevel, data.Energy = string(level), energyStyles[level]
+	name := "reply.tmpl"
+	if hostPromptKinds[data.Message] {
+		data.Kind = data.Message
+		if b.prompts.Lookup(data.Message+".tmpl") != nil {
+			name = data.Message + ".tmpl"
+		}
+	}
+	var buf strings.Builder
+	if err := b.prompts.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("error rendering prompt %s: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
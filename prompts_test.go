@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "poll-update.tmpl"), []byte("{{.Persona.Name}} announces: {{.Context}}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	var err error
+	if b.prompts, err = loadPrompts(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		context string
+		want    string
+	}{
+		{"audience message", "what is gemini?", "Current poll status:\nnone", "Always reply in English. You're Amitabh Bachchan, hosting Kaun Banega Crorepati. The show is just getting started: be warm and welcoming, and build up excitement for what's coming. Current status:\nCurrent poll status:\nnone\nUser said: what is gemini?\nRespond in Amitabh's style. Be witty and professional. Use at most 30 words. Do not say anything that can be taken as abusive."},
+		{"kind with its own template", "poll-update", "Poll update: A leads", "amitabh announces: Poll update: A leads"},
+		{"kind without a template", "prompt", "quiet room", "Always reply in English. You're Amitabh Bachchan, hosting Kaun Banega Crorepati. The show is just getting started: be warm and welcoming, and build up excitement for what's coming. Current status:\nquiet room\nUser said: prompt\nRespond in Amitabh's style. Be witty and professional. Use at most 30 words. Do not say anything that can be taken as abusive."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.renderPrompt(promptData{Persona: defaultPersona, MaxWords: 30, Message: tt.message, Context: tt.context, Language: languages["english"]})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("renderPrompt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPromptsRejectsUnknownFields(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "reply.tmpl"), []byte("{{.Persona.Voice}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPrompts(dir); err == nil || !strings.Contains(err.Error(), "reply.tmpl") {
+		t.Errorf("loadPrompts = %v, want an error naming reply.tmpl", err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"golang.org/x/crypto/hkdf"
+)
+
+// PseudonymMapping links a pseudonym back to the real user ID. The real ID is
+// only ever stored AES-GCM encrypted, in its own collection.
+type PseudonymMapping struct {
+	EncryptedUserID string    `firestore:"encryptedUserId"`
+	CreatedAt       time.Time `firestore:"createdAt"`
+}
+
+// pseudonymizer derives stable pseudonyms with an HMAC over the user ID, so
+// the same user always maps to the same pseudonym for a given key. The
+// HMAC and the encryption of the mappings use separate subkeys of the
+// configured key.
+type pseudonymizer struct {
+	key  []byte
+	aead cipher.AEAD
+
+	mu       sync.Mutex
+	recorded map[string]bool
+}
+
+// pseudonymPrefix starts every pseudonym; it is followed by pseudonymHashLen
+// hex digits of the user ID's HMAC and pseudonymTagLen of a tag over them.
+const (
+	pseudonymPrefix  = "anon-"
+	pseudonymHashLen = 12
+	pseudonymTagLen  = 8
+)
+
+func newPseudonymizer(key []byte) (*pseudonymizer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("pseudonym key must be 32 bytes, got %d", len(key))
+	}
+	macKey, err := deriveKey(key, "pseudonym")
+	if err != nil {
+		return nil, err
+	}
+	encKey, err := deriveKey(key, "mapping")
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &pseudonymizer{key: macKey, aead: aead, recorded: map[string]bool{}}, nil
+}
+
+// deriveKey derives the 32-byte subkey of key for label with HKDF.
+func deriveKey(key []byte, label string) ([]byte, error) {
+	sub := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte(label)), sub); err != nil {
+		return nil, fmt.Errorf("error deriving %s key: %w", label, err)
+	}
+	return sub, nil
+}
+
+// mac returns the hex HMAC of kind and data; kind keeps the MACs of user
+// IDs and of pseudonym tags apart.
+func (p *pseudonymizer) mac(kind, data string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *pseudonymizer) pseudonym(userID string) string {
+	hash := p.mac("id", userID)[:pseudonymHashLen]
+	return pseudonymPrefix + hash + p.mac("tag", hash)[:pseudonymTagLen]
+}
+
+// isPseudonym reports whether id is a pseudonym p issued, so documents that
+// are processed twice don't get pseudonyms of pseudonyms. The tag cannot be
+// made without the key, so a real ID that merely looks like a pseudonym is
+// still replaced. It is false for every ID when p is nil.
+func (p *pseudonymizer) isPseudonym(id string) bool {
+	if p == nil || len(id) != len(pseudonymPrefix)+pseudonymHashLen+pseudonymTagLen || !strings.HasPrefix(id, pseudonymPrefix) {
+		return false
+	}
+	hash, tag := id[len(pseudonymPrefix):len(id)-pseudonymTagLen], id[len(id)-pseudonymTagLen:]
+	return hmac.Equal([]byte(tag), []byte(p.mac("tag", hash)[:pseudonymTagLen]))
+}
+
+// seal encrypts userID for the mapping of alias. The alias is bound in as
+// additional data, so a mapping copied to another pseudonym fails to open.
+func (p *pseudonymizer) seal(alias, userID string) (string, error) {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(p.aead.Seal(nonce, nonce, []byte(userID), []byte(alias))), nil
+}
+
+// open decrypts the user ID seal stored for alias.
+func (p *pseudonymizer) open(alias, encrypted string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < p.aead.NonceSize() {
+		return "", fmt.Errorf("malformed pseudonym mapping for %s", alias)
+	}
+	nonce, ciphertext := sealed[:p.aead.NonceSize()], sealed[p.aead.NonceSize():]
+	userID, err := p.aead.Open(nil, nonce, ciphertext, []byte(alias))
+	if err != nil {
+		return "", fmt.Errorf("error decrypting pseudonym mapping for %s: %w", alias, err)
+	}
+	return string(userID), nil
+}
+
+// anonymize returns the identifier to use for userID everywhere in
+// processing and storage. Outside anonymous mode, when p is nil, it is the
+// ID itself.
+func (p *pseudonymizer) anonymize(ctx context.Context, client *firestore.Client, pseudonymCollection, userID string) (string, error) {
+	if p == nil || userID == "" || p.isPseudonym(userID) {
+		return userID, nil
+	}
+	alias := p.pseudonym(userID)
+
+	// The lock only guards the cache: two messages from a new user may
+	// both store the mapping, which is harmless, but no one waits on
+	// Firestore for another user's mapping.
+	p.mu.Lock()
+	recorded := p.recorded[alias]
+	p.mu.Unlock()
+	if recorded {
+		return alias, nil
+	}
+
+	encrypted, err := p.seal(alias, userID)
+	if err != nil {
+		return "", fmt.Errorf("error encrypting user ID: %w", err)
+	}
+	_, err = client.Collection(pseudonymCollection).Doc(alias).Set(ctx, PseudonymMapping{
+		EncryptedUserID: encrypted,
+		CreatedAt:       clock.Now(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error storing pseudonym mapping: %w", err)
+	}
+	p.mu.Lock()
+	p.recorded[alias] = true
+	p.mu.Unlock()
+	return alias, nil
+}
+
+// mapper binds anonymize to ctx, for code that maps many IDs as it goes.
+func (p *pseudonymizer) mapper(ctx context.Context, client *firestore.Client, pseudonymCollection string) idMapper {
+	return func(userID string) (string, error) {
+		return p.anonymize(ctx, client, pseudonymCollection, userID)
+	}
+}
+
+// recordedMapper maps user IDs to their pseudonyms without touching
+// Firestore, so it can run inside a transaction, and adds to unrecorded
+// the IDs whose mapping this instance has not stored. A transaction that
+// finds any should give up and be tried again once anonymize has stored
+// them, so nothing refers to a pseudonym that cannot be revealed. Outside
+// anonymous mode every ID maps to itself.
+func (p *pseudonymizer) recordedMapper(unrecorded map[string]bool) idMapper {
+	return func(userID string) (string, error) {
+		if p == nil || userID == "" || p.isPseudonym(userID) {
+			return userID, nil
+		}
+		alias := p.pseudonym(userID)
+		p.mu.Lock()
+		recorded := p.recorded[alias]
+		p.mu.Unlock()
+		if !recorded {
+			unrecorded[userID] = true
+		}
+		return alias, nil
+	}
+}
+
+// reveal decrypts the real user ID behind alias from its stored mapping.
+func (p *pseudonymizer) reveal(ctx context.Context, client *firestore.Client, pseudonymCollection, alias string) (string, error) {
+	doc, err := client.Collection(pseudonymCollection).Doc(alias).Get(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error fetching pseudonym mapping: %w", err)
+	}
+	var mapping PseudonymMapping
+	if err := doc.DataTo(&mapping); err != nil {
+		return "", fmt.Errorf("error converting document to PseudonymMapping: %w", err)
+	}
+	return p.open(alias, mapping.EncryptedUserID)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestPseudonymRoundTrip(t *testing.T) {
+	p, err := newPseudonymizer(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alias := p.pseudonym("ann")
+	sealed, err := p.seal(alias, "ann")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := p.open(alias, sealed); err != nil || got != "ann" {
+		t.Errorf("open(seal(ann)) = %q, %v, want ann", got, err)
+	}
+	again, _ := p.seal(alias, "ann")
+	if again == sealed {
+		t.Error("sealing twice gave the same ciphertext, want a fresh nonce each time")
+	}
+}
+
+func TestPseudonymStable(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	p1, _ := newPseudonymizer(key)
+	p2, _ := newPseudonymizer(key)
+	other, _ := newPseudonymizer(bytes.Repeat([]byte{2}, 32))
+
+	alias := p1.pseudonym("ann")
+	if got := p2.pseudonym("ann"); got != alias {
+		t.Errorf("pseudonym of ann = %q on another instance, want %q", got, alias)
+	}
+	if got := other.pseudonym("ann"); got == alias {
+		t.Errorf("pseudonym of ann = %q under another key, want a different one", got)
+	}
+	if p1.pseudonym("bob") == alias {
+		t.Error("ann and bob have the same pseudonym")
+	}
+
+	sealed, _ := p1.seal(alias, "ann")
+	if got, err := p2.open(alias, sealed); err != nil || got != "ann" {
+		t.Errorf("mapping sealed on one instance opened on another = %q, %v, want ann", got, err)
+	}
+	if _, err := other.open(alias, sealed); err == nil {
+		t.Error("mapping opened under another key, want an error")
+	}
+}
+
+func TestIsPseudonym(t *testing.T) {
+	p, _ := newPseudonymizer(bytes.Repeat([]byte{1}, 32))
+	other, _ := newPseudonymizer(bytes.Repeat([]byte{2}, 32))
+	alias := p.pseudonym("ann")
+
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{alias, true},
+		{other.pseudonym("ann"), false},
+		{alias[:len(alias)-1] + "x", false},
+		{"anon-0123456789ab", false},
+		{"anon-0123456789ab01234567", false},
+		{"ann", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := p.isPseudonym(tt.id); got != tt.want {
+			t.Errorf("isPseudonym(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+
+	var off *pseudonymizer
+	if off.isPseudonym(alias) {
+		t.Error("isPseudonym outside anonymous mode = true, want false")
+	}
+}
+
+func TestPseudonymTamper(t *testing.T) {
+	p, _ := newPseudonymizer(bytes.Repeat([]byte{1}, 32))
+	alias := p.pseudonym("ann")
+	sealed, _ := p.seal(alias, "ann")
+
+	raw, _ := base64.StdEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	if _, err := p.open(alias, base64.StdEncoding.EncodeToString(raw)); err == nil {
+		t.Error("tampered mapping opened, want an error")
+	}
+	if _, err := p.open(p.pseudonym("bob"), sealed); err == nil {
+		t.Error("mapping of ann opened as bob's, want an error")
+	}
+	if _, err := p.open(alias, "not base64!"); err == nil {
+		t.Error("malformed mapping opened, want an error")
+	}
+}
+
+func TestRecordedMapper(t *testing.T) {
+	p, _ := newPseudonymizer(bytes.Repeat([]byte{1}, 32))
+	p.recorded[p.pseudonym("ann")] = true
+	unrecorded := map[string]bool{}
+	anon := p.recordedMapper(unrecorded)
+
+	for _, id := range []string{"ann", "bob", p.pseudonym("cat")} {
+		got, err := anon(id)
+		want := p.pseudonym(id)
+		if p.isPseudonym(id) {
+			want = id
+		}
+		if err != nil || got != want {
+			t.Errorf("anon(%q) = %q, %v, want %q", id, got, err, want)
+		}
+	}
+	if len(unrecorded) != 1 || !unrecorded["bob"] {
+		t.Errorf("unrecorded = %v, want only bob", unrecorded)
+	}
+
+	var off *pseudonymizer
+	if got, _ := off.recordedMapper(unrecorded)("dan"); got != "dan" || unrecorded["dan"] {
+		t.Errorf("outside anonymous mode dan maps to %q, want dan itself", got)
+	}
+}
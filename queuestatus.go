@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// queueStatusInterval is how often the queue status document is
+	// rewritten while the queue changes.
+	queueStatusInterval = 5 * time.Second
+	// queueStatusMaxPositions caps the messages listed in the document, to
+	// keep it well under Firestore's document size limit.
+	queueStatusMaxPositions = 500
+	// queueRateWindow is how far back answers count towards the answer rate.
+	queueRateWindow = 5 * time.Minute
+)
+
+// QueuePosition is where one waiting audience message stands: Ahead
+// messages are to be answered before it, in about ETASeconds. ETASeconds
+// is left out until the instance has answered something to go by.
+type QueuePosition struct {
+	Ahead      int `firestore:"ahead" json:"ahead"`
+	ETASeconds int `firestore:"etaSeconds,omitempty" json:"etaSeconds,omitempty"`
+}
+
+// QueueStatus is the public document attendees read to see that their
+// question is waiting its turn, keyed by queueStatusDocID. Positions is
+// keyed by message ID, which only the sender's client knows.
+type QueueStatus struct {
+	Waiting   int                      `firestore:"waiting" json:"waiting"`
+	PerMinute float64                  `firestore:"perMinute" json:"perMinute"`
+	Positions map[string]QueuePosition `firestore:"positions" json:"positions"`
+	UpdatedAt time.Time                `firestore:"updatedAt" json:"updatedAt"`
+}
+
+// queueTracker follows the unprocessed messages the listener sees and how
+// fast they are answered.
+type queueTracker struct {
+	mu      sync.Mutex
+	waiting []*Message
+	// answers are the times of the answers within queueRateWindow, oldest
+	// first, and since when the tracker has counted them.
+	answers []time.Time
+	since   time.Time
+	changed bool
+}
+
+func newQueueTracker() *queueTracker {
+	return &queueTracker{since: clock.Now(), changed: true}
+}
+
+// observe records the unprocessed messages of a snapshot, oldest first.
+func (q *queueTracker) observe(batch []*Message) {
+	waiting := append([]*Message(nil), batch...)
+	sort.SliceStable(waiting, func(i, j int) bool {
+		if !waiting[i].Timestamp.Equal(waiting[j].Timestamp) {
+			return waiting[i].Timestamp.Before(waiting[j].Timestamp)
+		}
+		return waiting[i].ID < waiting[j].ID
+	})
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.waiting = waiting
+	q.changed = true
+}
+
+// answered records that a message was answered at now.
+func (q *queueTracker) answered(now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.answers = append(q.answers, now)
+	q.changed = true
+}
+
+// touch has the next status call report a change, so a status that could
+// not be written is retried.
+func (q *queueTracker) touch() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.changed = true
+}
+
+// status returns the queue at now, and whether it changed since the last
+// call.
+func (q *queueTracker) status(now time.Time) (QueueStatus, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	cutoff := now.Add(-queueRateWindow)
+	for len(q.answers) > 0 && !q.answers[0].After(cutoff) {
+		q.answers = q.answers[1:]
+	}
+	// Before a full window has passed the rate is over the time so far,
+	// but at least a minute, so the first answer does not promise a rush.
+	window := min(max(now.Sub(q.since), time.Minute), queueRateWindow)
+	perSecond := float64(len(q.answers)) / window.Seconds()
+
+	s := QueueStatus{
+		Waiting:   len(q.waiting),
+		PerMinute: math.Round(perSecond*60*10) / 10,
+		Positions: map[string]QueuePosition{},
+		UpdatedAt: now,
+	}
+	for i, msg := range q.waiting {
+		if i == queueStatusMaxPositions {
+			break
+		}
+		p := QueuePosition{Ahead: i}
+		if perSecond > 0 {
+			p.ETASeconds = int(math.Ceil(float64(i+1) / perSecond))
+		}
+		s.Positions[msg.ID] = p
+	}
+	changed := q.changed
+	q.changed = false
+	return s, changed
+}
+
+// queueStatusDocID is the queue status document of this instance: "live",
+// or one per shard, which attendees find from their message's shard.
+func queueStatusDocID(cfg *Config) string {
+	if cfg.Shards.Count > 1 {
+		return fmt.Sprintf("shard-%d", cfg.Shards.Index)
+	}
+	return "live"
+}
+
+// publishQueueStatus rewrites the queue status document every
+// queueStatusInterval while the queue changes. Like the word cloud it is
+// cosmetic, so a failed write is only logged.
+func (b *Bot) publishQueueStatus(ctx context.Context) error {
+	ticker := clock.NewTicker(queueStatusInterval)
+	defer ticker.Stop()
+	ref := b.client.Collection(b.cfg.Collections.QueueStatus).Doc(queueStatusDocID(b.cfg))
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			status, changed := b.queueStatus.status(clock.Now())
+			if !changed {
+				continue
+			}
+			if _, err := ref.Set(ctx, status); err != nil {
+				slog.Error("error writing queue status", "err", err)
+				b.queueStatus.touch()
+			}
+		}
+	}
+}
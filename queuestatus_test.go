@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueueStatus(t *testing.T) {
+	start := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	q := newQueueTracker()
+	q.since = start
+
+	q.observe([]*Message{
+		{ID: "late", Timestamp: start.Add(2 * time.Second)},
+		{ID: "early", Timestamp: start},
+		{ID: "middle", Timestamp: start.Add(time.Second)},
+	})
+	s, changed := q.status(start.Add(10 * time.Second))
+	if !changed || s.Waiting != 3 || s.PerMinute != 0 {
+		t.Fatalf("status = %+v (changed %v), want 3 waiting and no rate yet", s, changed)
+	}
+	if got := s.Positions["late"]; got != (QueuePosition{Ahead: 2}) {
+		t.Errorf("position of the latest message = %+v, want 2 ahead and no ETA", got)
+	}
+	if _, changed := q.status(start.Add(15 * time.Second)); changed {
+		t.Error("status reported a change with none since")
+	}
+
+	// Three answers in the first minute is three a minute, one every 20s.
+	for i := range 3 {
+		q.answered(start.Add(time.Duration(10*i) * time.Second))
+	}
+	q.observe([]*Message{{ID: "middle", Timestamp: start.Add(time.Second)}, {ID: "late", Timestamp: start.Add(2 * time.Second)}})
+	s, _ = q.status(start.Add(30 * time.Second))
+	if s.PerMinute != 3 || s.Positions["middle"] != (QueuePosition{Ahead: 0, ETASeconds: 20}) || s.Positions["late"] != (QueuePosition{Ahead: 1, ETASeconds: 40}) {
+		t.Errorf("status = %+v, want 3 a minute and ETAs of 20s and 40s", s)
+	}
+	if _, ok := s.Positions["early"]; ok {
+		t.Error("an answered message is still listed")
+	}
+
+	// Answers older than the window no longer count.
+	s, _ = q.status(start.Add(queueRateWindow + time.Minute))
+	if s.PerMinute != 0 || s.Positions["late"].ETASeconds != 0 {
+		t.Errorf("status = %+v, want the old answers forgotten", s)
+	}
+}
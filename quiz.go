@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const pointsPerCorrectAnswer = 10
+
+// QuizSession aggregates every question of a quiz round into one document,
+// so frontends can render the whole scoreboard from a single read. Organizers
+// create it with Title, Questions and Active; the backend fills in the rest.
+type QuizSession struct {
+	Title     string       `firestore:"title"`
+	Questions []string     `firestore:"questions"`
+	Active    bool         `firestore:"active"`
+	Rules     ScoringRules `firestore:"rules"`
+	// Current is the poll ID being played right now, advanced by organizers.
+	Current        string   `firestore:"current"`
+	BonusAnnounced []string `firestore:"bonusAnnounced"`
+	// LockedIn, Teased, Revealed and Reacted list the closed questions
+	// whose lock-in confirmation, pause before the answer, correct answer
+	// and reaction the host has announced, the latest at RevealBeatAt;
+	// see quizgame.go.
+	LockedIn     []string  `firestore:"lockedIn"`
+	Teased       []string  `firestore:"teased"`
+	Revealed     []string  `firestore:"revealed"`
+	Reacted      []string  `firestore:"reacted"`
+	RevealBeatAt time.Time `firestore:"revealBeatAt"`
+	// Sponsor, if set, makes the session a sponsored trivia pack: the host
+	// credits them when introducing each question, counting Impressions;
+	// see sponsorpacks.go.
+	Sponsor     string   `firestore:"sponsor,omitempty"`
+	Introduced  []string `firestore:"introduced"`
+	Impressions int      `firestore:"impressions"`
+	// Ended is set by organizers after the last question; the backend then
+	// settles any tie and fills in Winners.
+	Ended      bool                     `firestore:"ended"`
+	TieBreaker *TieBreaker              `firestore:"tieBreaker,omitempty"`
+	Winners    []string                 `firestore:"winners,omitempty"`
+	Stats      map[string]QuestionStats `firestore:"stats"`
+	Scores     map[string]int           `firestore:"scores"`
+	Streaks    map[string]int           `firestore:"streaks"`
+	UpdatedAt  time.Time                `firestore:"updatedAt"`
+}
+
+// hostAnnouncement is something the host needs to announce, such as a quiz
+// bonus round or an AMA opening. Kind is passed to the model as the prompt
+// type; Done, if set, runs once the announcement has been written.
+type hostAnnouncement struct {
+	Kind string
+	Text string
+	Done func(ctx context.Context) error
+}
+
+type QuestionStats struct {
+	Question     string         `firestore:"question"`
+	Correct      string         `firestore:"correct"`
+	Votes        map[string]int `firestore:"votes"`
+	TotalVotes   int            `firestore:"totalVotes"`
+	CorrectVotes int            `firestore:"correctVotes"`
+	// CorrectText is the text of the right option and CorrectVoters the
+	// players who picked it.
+	CorrectText   string   `firestore:"correctText"`
+	CorrectVoters []string `firestore:"correctVoters"`
+	// Closed is set once voting on the question is over; see pollClosed.
+	Closed bool `firestore:"closed"`
+	// IneligibleVotes counts votes excluded by the poll's eligibility rules.
+	IneligibleVotes int `firestore:"ineligibleVotes"`
+}
+
+// updateQuizSessions recomputes the aggregate document of every active
+// quiz, carries its scores over to the leaderboard, and returns what the
+// host should announce next: bonus rounds going live, sponsored question
+// intros, locked-in and revealed answers, tie-breakers and winners. A
+// session that fails to update is logged and retried next tick without
+// holding up the others.
+func (b *Bot) updateQuizSessions(ctx context.Context) ([]hostAnnouncement, error) {
+	iter := b.client.Collection(b.cfg.Collections.Quiz).Where("active", "==", true).Documents(ctx)
+	defer iter.Stop()
+
+	var announcements []hostAnnouncement
+	live := false
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			b.room.quizLive.Store(live)
+			return announcements, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through quiz sessions: %w", err)
+		}
+
+		if winners, err := doc.DataAt("winners"); err == nil && winners != nil {
+			continue
+		}
+
+		session, announcement, err := updateQuizSession(ctx, b.client, b.pseudonyms, doc.Ref, b.cfg.Collections)
+		if err != nil {
+			slog.Error("error updating quiz session", "session", doc.Ref.ID, "err", err)
+			continue
+		}
+		live = live || !session.Ended
+		if announcement != nil {
+			announcements = append(announcements, *announcement)
+		}
+		if err := b.recordLeaderboard(ctx, doc.Ref.ID, session.Scores); err != nil {
+			slog.Error("error recording quiz session on the leaderboard", "session", doc.Ref.ID, "err", err)
+		}
+		if announcement := sponsorIntroAnnouncement(doc.Ref, session); announcement != nil {
+			announcements = append(announcements, *announcement)
+		}
+		if announcement := b.quizGameAnnouncement(ctx, doc.Ref, session); announcement != nil {
+			announcements = append(announcements, *announcement)
+		}
+
+		if session.Ended {
+			announcement, err := b.advanceQuizEnding(ctx, doc.Ref, session)
+			if err != nil {
+				slog.Error("error ending quiz session", "session", doc.Ref.ID, "err", err)
+				continue
+			}
+			if announcement != nil {
+				announcements = append(announcements, *announcement)
+			}
+		}
+	}
+}
+
+// updateQuizSession rebuilds stats and scores from the poll documents inside
+// a transaction, so the aggregate never mixes reads from different moments.
+// Recomputing from scratch keeps the update idempotent across retries, and
+// the session is only written when the aggregate changed. It returns the
+// session as updated and a bonus round announcement, if due. Questions
+// whose poll document does not exist (yet) are left out.
+//
+// Storing a pseudonym mapping is a write of its own, so none is made in
+// the transaction: one that meets voters whose mappings are not stored
+// gives up, and is tried again once they are.
+func updateQuizSession(ctx context.Context, client *firestore.Client, pseudonyms *pseudonymizer, ref *firestore.DocumentRef, cols Collections) (*QuizSession, *hostAnnouncement, error) {
+	unrecorded := map[string]bool{}
+	anon := pseudonyms.recordedMapper(unrecorded)
+	for attempt := 1; ; attempt++ {
+		var session *QuizSession
+		var announcement *hostAnnouncement
+		err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) (err error) {
+			clear(unrecorded)
+			session, announcement, err = quizSessionTx(ctx, client, tx, anon, unrecorded, ref, cols)
+			return err
+		})
+		if !errors.Is(err, errUnrecordedPseudonyms) || attempt == maxQuizUpdateAttempts {
+			return session, announcement, err
+		}
+		for userID := range unrecorded {
+			if _, err := pseudonyms.anonymize(ctx, client, cols.Pseudonyms, userID); err != nil {
+				return nil, nil, fmt.Errorf("error anonymizing user: %w", err)
+			}
+		}
+	}
+}
+
+// maxQuizUpdateAttempts bounds how often updateQuizSession stores new
+// pseudonyms and tries again before leaving the session for the next tick.
+const maxQuizUpdateAttempts = 3
+
+// errUnrecordedPseudonyms aborts a quiz session transaction that met
+// voters whose pseudonym mappings are not stored yet.
+var errUnrecordedPseudonyms = errors.New("pseudonym mappings not stored yet")
+
+// quizSessionTx is the transaction of updateQuizSession. It fails with
+// errUnrecordedPseudonyms, before writing anything, if anon added to
+// unrecorded.
+func quizSessionTx(ctx context.Context, client *firestore.Client, tx *firestore.Transaction, anon idMapper, unrecorded map[string]bool, ref *firestore.DocumentRef, cols Collections) (*QuizSession, *hostAnnouncement, error) {
+	snap, err := tx.Get(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	var session QuizSession
+	if err := snap.DataTo(&session); err != nil {
+		return nil, nil, err
+	}
+
+	stats := map[string]QuestionStats{}
+	var questions []scoredQuestion
+	ineligible := map[*firestore.DocumentRef]*PollTally{}
+	for _, questionID := range session.Questions {
+		pollSnap, err := tx.Get(client.Collection(cols.Poll).Doc(questionID))
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		var raw PollQuestion
+		if err := pollSnap.DataTo(&raw); err != nil {
+			return nil, nil, err
+		}
+		tally, err := tallyPoll(ctx, newFirestoreEligibility(client, tx.GetAll, cols), anon, raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tally.Ineligible) > 0 {
+			ineligible[pollSnap.Ref] = tally
+		}
+		poll := tally.Poll
+
+		closed, _ := pollClosed(poll, clock.Now())
+		qs := QuestionStats{Question: poll.Question, Correct: poll.Correct, Votes: map[string]int{}, CorrectVoters: []string{}, Closed: closed, IneligibleVotes: len(tally.Ineligible)}
+		sq := scoredQuestion{ID: questionID, Correct: poll.Correct, Answers: map[string]string{}}
+		for key, opt := range poll.Options {
+			qs.Votes[key] = len(opt.Voters)
+			qs.TotalVotes += len(opt.Voters)
+			if key == poll.Correct {
+				qs.CorrectVotes = len(opt.Voters)
+				qs.CorrectText = opt.OpText
+				qs.CorrectVoters = append(qs.CorrectVoters, opt.Voters...)
+			}
+			for _, voter := range opt.Voters {
+				sq.Answers[voter] = key
+			}
+		}
+		stats[questionID] = qs
+		questions = append(questions, sq)
+	}
+
+	if len(unrecorded) > 0 {
+		return nil, nil, errUnrecordedPseudonyms
+	}
+
+	var announcement *hostAnnouncement
+	rules := session.Rules.withDefaults()
+	if rules.isBonus(session.Current) && !slices.Contains(session.BonusAnnounced, session.Current) {
+		questionID := session.Current
+		announcement = &hostAnnouncement{
+			Kind: "bonus-round",
+			Text: fmt.Sprintf("Bonus round! The next question is worth %g times the points: %s", rules.BonusMultiplier, stats[questionID].Question),
+			Done: func(ctx context.Context) error {
+				_, err := ref.Update(ctx, []firestore.Update{
+					{Path: "bonusAnnounced", Value: firestore.ArrayUnion(questionID)},
+				})
+				return err
+			},
+		}
+	}
+
+	for pollRef, tally := range ineligible {
+		if err := tx.Update(pollRef, tally.ineligibleUpdate()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	scores, streaks := scoreQuestions(questions, session.Rules)
+	if session.aggregateEqual(stats, scores, streaks) {
+		return &session, announcement, nil
+	}
+	session.Stats, session.Scores, session.Streaks = stats, scores, streaks
+	err = tx.Set(ref, map[string]interface{}{
+		"stats":     stats,
+		"scores":    scores,
+		"streaks":   streaks,
+		"updatedAt": clock.Now(),
+	}, firestore.MergeAll)
+	return &session, announcement, err
+}
+
+// aggregateEqual reports whether stats, scores and streaks are what s has
+// stored. Firestore reads empty arrays back as nil, so those are equal to
+// empty ones.
+func (s *QuizSession) aggregateEqual(stats map[string]QuestionStats, scores, streaks map[string]int) bool {
+	if len(stats) != len(s.Stats) || !maps.Equal(scores, s.Scores) || !maps.Equal(streaks, s.Streaks) {
+		return false
+	}
+	for id, qs := range stats {
+		stored, ok := s.Stats[id]
+		if !ok || !maps.Equal(qs.Votes, stored.Votes) || !slices.Equal(qs.CorrectVoters, stored.CorrectVoters) {
+			return false
+		}
+		qs.Votes, qs.CorrectVoters = nil, nil
+		stored.Votes, stored.CorrectVoters = nil, nil
+		if !reflect.DeepEqual(qs, stored) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestQuizAggregateEqual(t *testing.T) {
+	stats := map[string]QuestionStats{"q1": {Question: "Who?", Correct: "A", Votes: map[string]int{"A": 0}, CorrectVoters: []string{}, Closed: true}}
+	scores, streaks := map[string]int{}, map[string]int{}
+	// As read back from Firestore: empty arrays and maps are nil.
+	stored := QuizSession{Stats: map[string]QuestionStats{"q1": {Question: "Who?", Correct: "A", Votes: map[string]int{"A": 0}, Closed: true}}}
+	if !stored.aggregateEqual(stats, scores, streaks) {
+		t.Error("aggregate as stored is not equal, want it equal")
+	}
+
+	changed := []struct {
+		name    string
+		stats   map[string]QuestionStats
+		scores  map[string]int
+		streaks map[string]int
+	}{
+		{"vote", map[string]QuestionStats{"q1": {Question: "Who?", Correct: "A", Votes: map[string]int{"A": 1}, TotalVotes: 1, CorrectVotes: 1, CorrectVoters: []string{"ann"}, Closed: true}}, scores, streaks},
+		{"closed", map[string]QuestionStats{"q1": {Question: "Who?", Correct: "A", Votes: map[string]int{"A": 0}}}, scores, streaks},
+		{"question added", map[string]QuestionStats{"q1": stats["q1"], "q2": {Question: "What?"}}, scores, streaks},
+		{"score", stats, map[string]int{"ann": 10}, streaks},
+		{"streak", stats, scores, map[string]int{"ann": 1}},
+	}
+	for _, tt := range changed {
+		if stored.aggregateEqual(tt.stats, tt.scores, tt.streaks) {
+			t.Errorf("aggregate with a changed %s is equal, want it different", tt.name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// maxNamedCorrect caps how many correct players the host names on a reveal.
+const maxNamedCorrect = 5
+
+// revealBeat is one beat of the reveal of a quiz answer: the host prompt
+// kind it is announced as and the session field recording the questions
+// it has been announced for, which announced reads. A crowd beat is about
+// the audience's answers, so it is skipped on a question nobody answered.
+type revealBeat struct {
+	kind      string
+	field     string
+	announced func(*QuizSession) []string
+	crowd     bool
+}
+
+// revealBeats are the beats of the reveal, in order, KBC style: the "lock
+// kiya jaye" confirmation, the pause before the answer, the answer and
+// the host's reaction to how the room did.
+var revealBeats = []revealBeat{
+	{kind: "quiz-lock", field: "lockedIn", announced: func(s *QuizSession) []string { return s.LockedIn }},
+	{kind: "quiz-suspense", field: "teased", announced: func(s *QuizSession) []string { return s.Teased }, crowd: true},
+	{kind: "quiz-answer", field: "revealed", announced: func(s *QuizSession) []string { return s.Revealed }},
+	{kind: "quiz-reaction", field: "reacted", announced: func(s *QuizSession) []string { return s.Reacted }, crowd: true},
+}
+
+// quizStep is the beat the host still owes the audience on the question
+// being played, once its voting has closed, or nil. Each beat goes out on
+// a tick of its own, at least gap after the one before, which gives the
+// reveal its rhythm; the first goes out at once.
+func quizStep(session *QuizSession, now time.Time, gap time.Duration) *revealBeat {
+	qs, ok := session.Stats[session.Current]
+	if session.Current == "" || !ok || !qs.Closed || qs.Correct == "" || session.TieBreaker != nil {
+		return nil
+	}
+	// A beat is due after the last one announced, so a session that
+	// skipped some, such as one revealed before they existed, never goes
+	// back to them.
+	next := 0
+	for i, beat := range revealBeats {
+		if slices.Contains(beat.announced(session), session.Current) {
+			next = i + 1
+		}
+	}
+	for next < len(revealBeats) && revealBeats[next].crowd && qs.TotalVotes == 0 {
+		next++
+	}
+	if next == len(revealBeats) || next > 0 && now.Before(session.RevealBeatAt.Add(gap)) {
+		return nil
+	}
+	return &revealBeats[next]
+}
+
+// lockInText confirms the answers are locked without giving away the
+// right one.
+func lockInText(qs QuestionStats) string {
+	if qs.TotalVotes == 0 {
+		return fmt.Sprintf("Time is up on %q and nobody locked in an answer.", qs.Question)
+	}
+	return fmt.Sprintf("Time is up on %q. Lock kiya jaye? %d answers are locked in. Computer ji, lock kar diya jaye!", qs.Question, qs.TotalVotes)
+}
+
+// suspenseText holds the answer back a moment: how the audience split,
+// without a word on which answer is right.
+func suspenseText(qs QuestionStats) string {
+	var split []string
+	for _, key := range sortedKeys(qs.Votes) {
+		split = append(split, fmt.Sprintf("%s: %d", key, qs.Votes[key]))
+	}
+	return fmt.Sprintf("The moment of truth for %q. The audience went %s. Is the crowd right? Computer ji, the answer please...", qs.Question, strings.Join(split, ", "))
+}
+
+// answerRevealText reveals the correct answer of a closed question, how
+// many got it right, up to maxNamedCorrect of them by name, and who leads
+// the quiz.
+func answerRevealText(qs QuestionStats, correct, leaders []string) string {
+	answer := qs.Correct
+	if qs.CorrectText != "" {
+		answer += " - " + qs.CorrectText
+	}
+	lines := []string{fmt.Sprintf("The correct answer to %q is %s.", qs.Question, answer)}
+	switch {
+	case qs.CorrectVotes == 0:
+		lines = append(lines, "Nobody got it right.")
+	case len(correct) < qs.CorrectVotes:
+		lines = append(lines, fmt.Sprintf("%d of %d got it right, including %s.", qs.CorrectVotes, qs.TotalVotes, strings.Join(correct, ", ")))
+	default:
+		lines = append(lines, fmt.Sprintf("%d of %d got it right: %s.", qs.CorrectVotes, qs.TotalVotes, strings.Join(correct, ", ")))
+	}
+	if len(leaders) > 0 {
+		lines = append(lines, fmt.Sprintf("Leading the quiz: %s.", strings.Join(leaders, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// reactionText is the host's reaction to how the room did on a revealed
+// question: the share who got it right, and whether the crowd's favourite
+// answer was the right one.
+func reactionText(qs QuestionStats) string {
+	var mood string
+	share := qs.CorrectVotes * 100 / qs.TotalVotes
+	switch {
+	case qs.CorrectVotes == 0:
+		mood = "Not a single right answer: that one stumped the whole room."
+	case share >= 75:
+		mood = "The room nailed it."
+	case share < 25:
+		mood = "Only the sharpest got that one."
+	default:
+		mood = "The room was split on that one."
+	}
+	lines := []string{fmt.Sprintf("%d%% got %q right. %s", share, qs.Question, mood)}
+	favourite := ""
+	for _, key := range sortedKeys(qs.Votes) {
+		if favourite == "" || qs.Votes[key] > qs.Votes[favourite] {
+			favourite = key
+		}
+	}
+	if favourite != qs.Correct {
+		lines = append(lines, fmt.Sprintf("Most of you went for %s, but the answer was %s.", favourite, qs.Correct))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quizGameAnnouncement returns the beat of the answer reveal due on
+// session's current question, if any. Its Done records it on the session,
+// so each is announced once, and when, to time the next.
+func (b *Bot) quizGameAnnouncement(ctx context.Context, ref *firestore.DocumentRef, session *QuizSession) *hostAnnouncement {
+	beat := quizStep(session, clock.Now(), b.getPacing().scale(b.cfg.Monitor.RevealBeatGap.Duration))
+	if beat == nil {
+		return nil
+	}
+	questionID := session.Current
+	qs := session.Stats[questionID]
+	var text string
+	switch beat.kind {
+	case "quiz-lock":
+		text = lockInText(qs)
+	case "quiz-suspense":
+		text = suspenseText(qs)
+	case "quiz-answer":
+		correct := append([]string(nil), qs.CorrectVoters...)
+		sort.Strings(correct)
+		if len(correct) > maxNamedCorrect {
+			correct = correct[:maxNamedCorrect]
+		}
+		text = answerRevealText(qs, b.displayNames(ctx, correct), b.displayNames(ctx, topPlayers(session.Scores)))
+	case "quiz-reaction":
+		text = reactionText(qs)
+	}
+	return &hostAnnouncement{
+		Kind: beat.kind,
+		Text: text,
+		Done: func(ctx context.Context) error {
+			_, err := ref.Update(ctx, []firestore.Update{
+				{Path: beat.field, Value: firestore.ArrayUnion(questionID)},
+				{Path: "revealBeatAt", Value: clock.Now()},
+			})
+			return err
+		},
+	}
+}
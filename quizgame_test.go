@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuizStep(t *testing.T) {
+	t0 := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	closed := map[string]QuestionStats{"q1": {Question: "Who?", Correct: "A", Closed: true, TotalVotes: 3}}
+	unanswered := map[string]QuestionStats{"q1": {Question: "Who?", Correct: "A", Closed: true}}
+	q1 := []string{"q1"}
+	tests := []struct {
+		name    string
+		session QuizSession
+		want    string
+	}{
+		{"no current question", QuizSession{Stats: closed}, ""},
+		{"still open", QuizSession{Current: "q1", Stats: map[string]QuestionStats{"q1": {Correct: "A"}}}, ""},
+		{"no correct answer", QuizSession{Current: "q1", Stats: map[string]QuestionStats{"q1": {Closed: true}}}, ""},
+		{"closed", QuizSession{Current: "q1", Stats: closed, RevealBeatAt: t0}, "quiz-lock"},
+		{"locked in", QuizSession{Current: "q1", Stats: closed, LockedIn: q1, RevealBeatAt: t0.Add(-10 * time.Second)}, "quiz-suspense"},
+		{"locked in just now", QuizSession{Current: "q1", Stats: closed, LockedIn: q1, RevealBeatAt: t0.Add(-5 * time.Second)}, ""},
+		{"teased", QuizSession{Current: "q1", Stats: closed, LockedIn: q1, Teased: q1, RevealBeatAt: t0.Add(-time.Minute)}, "quiz-answer"},
+		{"revealed", QuizSession{Current: "q1", Stats: closed, LockedIn: q1, Teased: q1, Revealed: q1, RevealBeatAt: t0.Add(-time.Minute)}, "quiz-reaction"},
+		{"reacted", QuizSession{Current: "q1", Stats: closed, LockedIn: q1, Teased: q1, Revealed: q1, Reacted: q1}, ""},
+		{"revealed without a pause", QuizSession{Current: "q1", Stats: closed, LockedIn: q1, Revealed: q1, Reacted: q1}, ""},
+		{"nobody answered", QuizSession{Current: "q1", Stats: unanswered, LockedIn: q1, RevealBeatAt: t0.Add(-time.Minute)}, "quiz-answer"},
+		{"nobody answered, revealed", QuizSession{Current: "q1", Stats: unanswered, LockedIn: q1, Revealed: q1}, ""},
+		{"tie-breaker running", QuizSession{Current: "q1", Stats: closed, TieBreaker: &TieBreaker{PollID: "tb1"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if beat := quizStep(&tt.session, t0, 10*time.Second); beat != nil {
+				got = beat.kind
+			}
+			if got != tt.want {
+				t.Errorf("quizStep = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevealBeatFields(t *testing.T) {
+	// Each beat must read the session field it writes.
+	typ := reflect.TypeFor[QuizSession]()
+	for _, beat := range revealBeats {
+		var session QuizSession
+		for i := range typ.NumField() {
+			if typ.Field(i).Tag.Get("firestore") == beat.field {
+				reflect.ValueOf(&session).Elem().Field(i).Set(reflect.ValueOf([]string{"q1"}))
+			}
+		}
+		if got := beat.announced(&session); len(got) != 1 || got[0] != "q1" {
+			t.Errorf("%s beat reads %q from a session with %s set, want [q1]", beat.kind, got, beat.field)
+		}
+	}
+}
+
+func TestAnswerRevealText(t *testing.T) {
+	qs := QuestionStats{Question: "Who wrote Go?", Correct: "B", CorrectText: "Pike", TotalVotes: 9, CorrectVotes: 2}
+	got := answerRevealText(qs, []string{"Ann", "Bob"}, []string{"Ann"})
+	for _, want := range []string{"is B - Pike.", "2 of 9 got it right: Ann, Bob.", "Leading the quiz: Ann."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("reveal = %q, want %q in it", got, want)
+		}
+	}
+
+	qs.CorrectVotes = 7
+	if got := answerRevealText(qs, []string{"Ann", "Bob"}, nil); !strings.Contains(got, "7 of 9 got it right, including Ann, Bob.") || strings.Contains(got, "Leading") {
+		t.Errorf("reveal = %q, want the named players marked as a sample and no leader", got)
+	}
+	qs.CorrectVotes = 0
+	if got := answerRevealText(qs, nil, nil); !strings.Contains(got, "Nobody got it right.") {
+		t.Errorf("reveal = %q, want nobody", got)
+	}
+	if got := lockInText(qs); !strings.Contains(got, "Lock kiya jaye? 9 answers are locked in.") || strings.Contains(got, "Pike") {
+		t.Errorf("lock-in = %q, want the count and no answer", got)
+	}
+}
+
+func TestRevealBeatTexts(t *testing.T) {
+	qs := QuestionStats{Question: "Who wrote Go?", Correct: "B", CorrectText: "Pike", Votes: map[string]int{"A": 6, "B": 3, "C": 1}, TotalVotes: 10, CorrectVotes: 3}
+	if got := suspenseText(qs); !strings.Contains(got, "The audience went A: 6, B: 3, C: 1.") || strings.Contains(got, "Pike") {
+		t.Errorf("suspense = %q, want the split and no answer", got)
+	}
+	got := reactionText(qs)
+	for _, want := range []string{"30% got \"Who wrote Go?\" right. The room was split on that one.", "Most of you went for A, but the answer was B."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("reaction = %q, want %q in it", got, want)
+		}
+	}
+
+	qs.Votes, qs.CorrectVotes = map[string]int{"A": 1, "B": 9}, 9
+	if got := reactionText(qs); got != "90% got \"Who wrote Go?\" right. The room nailed it." {
+		t.Errorf("reaction = %q, want the room to have nailed it", got)
+	}
+}
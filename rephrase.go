@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// maxQuestionRunes bounds the rephrased question shown on screen next to
+// the host's answer.
+const maxQuestionRunes = 120
+
+// rephraseQuestion turns an audience message into a short, neutral
+// question for the stage display. If the model is unavailable, or its
+// rephrasing is unusable, the original is shown, trimmed to fit.
+func rephraseQuestion(ctx context.Context, model ResponseGenerator, text string) string {
+	prompt := fmt.Sprintf(`Rephrase this audience message from a live Q&A as one short question for the big screen.
+Neutral tone, at most 15 words, no greeting, no names unless they are the subject. Reply with the question only.
+Message: %s`, text)
+	rephrased, err := model.Generate(ctx, prompt)
+	rephrased = strings.Trim(strings.TrimSpace(rephrased), `"`)
+	if err != nil || rephrased == "" || containsProfanity(rephrased) {
+		rephrased = text
+	}
+	return clipRunes(strings.Join(strings.Fields(rephrased), " "), maxQuestionRunes)
+}
+
+// clipRunes shortens s to at most n runes, ending it with an ellipsis if
+// anything was cut.
+func clipRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(r[:n-1])) + "…"
+}
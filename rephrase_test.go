@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRephraseQuestion(t *testing.T) {
+	long := strings.Repeat("very ", 40) + "long question?"
+	tests := []struct {
+		name  string
+		reply string
+		err   error
+		text  string
+		want  string
+	}{
+		{"model rephrasing", `"How does Gemini handle images?"`, nil, "sir how does gemini do images??", "How does Gemini handle images?"},
+		{"model unavailable", "", errors.New("quota"), "  what   is  Gemini? ", "what is Gemini?"},
+		{"profane rephrasing", "What the fuck is Gemini?", nil, "what is Gemini?", "what is Gemini?"},
+		{"clipped to fit", "", errors.New("quota"), long, string([]rune(long)[:maxQuestionRunes-1]) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := generatorFunc(func(ctx context.Context, prompt string) (string, error) { return tt.reply, tt.err })
+			got := rephraseQuestion(context.Background(), model, tt.text)
+			if got != strings.TrimSpace(tt.want) {
+				t.Errorf("rephraseQuestion = %q, want %q", got, tt.want)
+			}
+			if n := len([]rune(got)); n > maxQuestionRunes {
+				t.Errorf("rephrased question is %d runes, want at most %d", n, maxQuestionRunes)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// unrecordedReply is what the replayed model answers a prompt the show-log
+// has no reply to, usually because a pipeline change altered the prompt.
+const unrecordedReply = "[no recorded reply to this prompt]"
+
+// replayModels serves the model replies recorded in a show-log: each
+// prompt gets the replies it got in the show, in the same order.
+type replayModels struct {
+	mu      sync.Mutex
+	replies map[string][]ShowLogEntry
+	misses  int
+}
+
+func newReplayModels(entries []ShowLogEntry) *replayModels {
+	r := &replayModels{replies: map[string][]ShowLogEntry{}}
+	for _, e := range entries {
+		if e.Kind == showModel {
+			key := e.Model + "\x00" + e.Prompt
+			r.replies[key] = append(r.replies[key], e)
+		}
+	}
+	return r
+}
+
+// model returns the ResponseGenerator replaying the calls recorded as
+// name. A recorded error is returned again, as errSafetyBlocked if it was
+// one so the host handles it the same way.
+func (r *replayModels) model(name string) ResponseGenerator {
+	return generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		key := name + "\x00" + prompt
+		queue := r.replies[key]
+		if len(queue) == 0 {
+			r.misses++
+			return unrecordedReply, nil
+		}
+		e := queue[0]
+		r.replies[key] = queue[1:]
+		switch {
+		case e.Error == errSafetyBlocked.Error():
+			return "", errSafetyBlocked
+		case e.Error != "":
+			return "", errors.New(e.Error)
+		}
+		return e.Response, nil
+	})
+}
+
+// unrecorded is how many prompts had no recorded reply.
+func (r *replayModels) unrecorded() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.misses
+}
+
+// replaySeed is the seed the recorded show ran with, the configured one
+// for a log without it, or else 1.
+func replaySeed(entries []ShowLogEntry, cfg *Config) int64 {
+	for _, e := range entries {
+		if e.Kind == showStart && e.Seed != 0 {
+			return e.Seed
+		}
+	}
+	if cfg.Seed != nil {
+		return *cfg.Seed
+	}
+	return 1
+}
+
+// replayPoll is the poll document to save for a recorded one: as the
+// audience and organizers left it, but with what the host itself writes
+// (announcements, settlements, themes) as it is in the replay so far.
+func replayPoll(recorded PollQuestion, current *PollQuestion) PollQuestion {
+	var host PollQuestion
+	if current != nil {
+		host = *current
+	}
+	recorded.ResultsAnnounced = host.ResultsAnnounced
+	recorded.Themes = host.Themes
+	recorded.WagersSettled, recorded.WagerResults = host.WagersSettled, host.WagerResults
+	recorded.BuzzAnnounced = host.BuzzAnnounced
+	return recorded
+}
+
+// replayInputs plays the inputs of a show-log back at the times they were
+// recorded, by the package clock: audience messages are submitted afresh,
+// poll documents saved and the organizers' state changes (persona,
+// auto-prompts, live poll) made again. Outputs are left for the bot to
+// re-render. It returns after tail more has passed since the last entry.
+func (b *Bot) replayInputs(ctx context.Context, entries []ShowLogEntry, tail time.Duration) error {
+	wait := func(until time.Time) error {
+		if d := until.Sub(clock.Now()); d > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-clock.After(d):
+			}
+		}
+		return nil
+	}
+	for _, e := range entries {
+		if err := wait(e.At); err != nil {
+			return err
+		}
+		switch {
+		case e.Kind == showMessage && e.Message != nil:
+			msg := *e.Message
+			msg.Processed, msg.ClaimedBy, msg.ClaimedAt, msg.Timestamp = false, "", time.Time{}, clock.Now()
+			if err := b.messages.Submit(ctx, msg); err != nil {
+				return fmt.Errorf("error submitting message %s: %w", msg.ID, err)
+			}
+		case e.Kind == showPoll && e.Poll != nil:
+			current, err := b.polls.Poll(ctx, e.PollID)
+			if err != nil {
+				current = nil
+			}
+			if err := b.polls.SavePoll(ctx, e.PollID, replayPoll(*e.Poll, current)); err != nil {
+				return fmt.Errorf("error saving poll %s: %w", e.PollID, err)
+			}
+		case e.Kind == showEvent && e.Event != nil && e.Event.Kind == EventStateChanged:
+			switch e.Event.State {
+			case "persona":
+				if _, err := b.personas.switchTo(e.Event.To); err != nil {
+					slog.Warn("replayed persona switch failed", "persona", e.Event.To, "err", err)
+				}
+			case "auto-prompts":
+				b.setPaused(e.Event.To == pausedName(true))
+			case "poll":
+				b.switchPoll(e.Event.To)
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return wait(entries[len(entries)-1].At.Add(tail))
+}
+
+// runReplay implements the "replay" command, which plays a show-log back
+// into fresh collections on the Firestore emulator, with the recorded
+// model replies unless -live-model is set, and writes the re-rendered show
+// as a new show-log. Time runs on a seeded virtual clock from the start of
+// the recording, so replaying the same log twice renders the same show,
+// and a pipeline change shows up as a difference between the two.
+func runReplay(ctx context.Context, w io.Writer, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	in := fs.String("log", "", "show-log to replay")
+	out := fs.String("out", "-", "file to write the replayed show-log to, or - for stdout")
+	prefix := fs.String("prefix", "", "collection prefix to replay into (default replay-<time>)")
+	speed := fs.Float64("speed", 10, "how many times faster than real time to replay")
+	tail := fs.Duration("tail", time.Minute, "how long to keep the show running after the last entry")
+	liveModel := fs.Bool("live-model", false, "call the configured model instead of replaying the recorded replies")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return errors.New("-log is required")
+	}
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		return errors.New("replay only runs against the Firestore emulator; set FIRESTORE_EMULATOR_HOST")
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return fmt.Errorf("error opening show-log: %w", err)
+	}
+	entries, err := readShowLog(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("show-log %s is empty", *in)
+	}
+
+	// The replay runs on the current config, so config changes can be
+	// tested against a recorded show too, in collections of its own and
+	// serving nothing.
+	rcfg := *cfg
+	if *prefix == "" {
+		*prefix = fmt.Sprintf("replay-%d", time.Now().Unix())
+	}
+	rcfg.Collections = Collections{Prefix: *prefix}
+	rcfg.Room, rcfg.ShowLog = "", ""
+	rcfg.AdminAddr, rcfg.APIAddr, rcfg.HealthAddr = "", "", ""
+	rcfg.applyDefaults()
+	if err := rcfg.validate(); err != nil {
+		return fmt.Errorf("invalid replay config: %w", err)
+	}
+
+	vc := enableSeedMode(replaySeed(entries, cfg), entries[0].At)
+
+	recorded := newReplayModels(entries)
+	model, fallbackModel := recorded.model("model"), recorded.model("fallback")
+	if *liveModel {
+		if model, fallbackModel, err = newGenerators(ctx, &rcfg); err != nil {
+			return err
+		}
+	}
+
+	dst := w
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("error creating replay file: %w", err)
+		}
+		defer f.Close()
+		dst = f
+	}
+	showLog := newShowRecorder(dst)
+	showLog.record(ShowLogEntry{Kind: showStart, Config: rcfg.redacted(), Seed: replaySeed(entries, cfg)})
+	model = recordedModel{name: "model", model: model, log: showLog}
+	fallbackModel = recordedModel{name: "fallback", model: fallbackModel, log: showLog}
+
+	client, err := newFirestoreClient(ctx, &rcfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	b, err := NewBot(&rcfg, client, model, fallbackModel)
+	if err != nil {
+		return err
+	}
+	b.showLog = showLog
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	for name, fn := range map[string]func(context.Context) error{
+		"message listener":        b.listenForNewUserMessages,
+		"monitor":                 b.monitorAndRespond,
+		"conversation memory":     b.rememberConversation,
+		"conversation summarizer": b.summarizeConversation,
+		"transcript":              b.recordTranscript,
+		"show-log":                b.recordShow,
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.supervisor.supervise(ctx, name, fn)
+		}()
+	}
+	go vc.Run(ctx, *speed)
+
+	slog.Info("replaying show", "entries", len(entries), "from", entries[0].At, "prefix", *prefix)
+	err = b.replayInputs(ctx, entries, *tail)
+	cancel()
+	wg.Wait()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	slog.Info("replay finished", "prefix", *prefix, "unrecordedPrompts", recorded.unrecorded())
+	return nil
+}
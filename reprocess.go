@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// reprocessLimit is how many messages one reprocess request goes through;
+// a longer window is picked up again from the Next it returns.
+const reprocessLimit = 200
+
+// catchUpPreamble opens every late answer.
+const catchUpPreamble = "Sorry for the wait, this question got stuck while we had technical trouble earlier. "
+
+// CatchUpStore holds the late answers to messages the host missed, such as
+// those sent during an outage.
+type CatchUpStore interface {
+	// MessagesBetween returns up to limit audience messages sent at or
+	// after from and before to, processed or not, oldest first.
+	MessagesBetween(ctx context.Context, from, to time.Time, limit int) ([]*Message, error)
+	// CatchUp returns the late answer to audience message id, or nil if
+	// there is none.
+	CatchUp(ctx context.Context, id string) (*Message, error)
+	// WriteCatchUp stores a late answer under reply.ID.
+	WriteCatchUp(ctx context.Context, reply Message) error
+}
+
+// ReprocessResult is what a reprocess request did with the messages in its
+// window.
+type ReprocessResult struct {
+	Answered int `json:"answered"`
+	// Skipped counts the messages already answered, still waiting for the
+	// listener, dead-lettered, or dropped by moderation or triage.
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+	// Next is set when the window held more than reprocessLimit messages:
+	// reprocess from it to carry on.
+	Next *time.Time `json:"next,omitempty"`
+}
+
+// reprocess answers the messages sent between from and to that never got
+// an answer, through the same moderation, triage and prompt as new ones.
+// Public answers go to the catch-up collection and private ones to the
+// sender, both opening with catchUpPreamble. It stops early if the host has
+// been silenced.
+func (b *Bot) reprocess(ctx context.Context, from, to time.Time) (ReprocessResult, error) {
+	var res ReprocessResult
+	messages, err := b.catchUp.MessagesBetween(ctx, from, to, reprocessLimit)
+	if err != nil {
+		return res, fmt.Errorf("error reading messages: %w", err)
+	}
+	if len(messages) == reprocessLimit {
+		next := messages[len(messages)-1].Timestamp.Add(time.Nanosecond)
+		res.Next = &next
+	}
+
+	var missed []*Message
+	for _, msg := range messages {
+		answered, err := b.answeredLate(ctx, msg)
+		if err != nil {
+			slog.Error("error checking message for an answer", "messageId", msg.ID, "err", err)
+			res.Failed++
+			continue
+		}
+		// Unprocessed messages are still the listener's to answer.
+		if answered || !msg.Processed || msg.DeadLettered || b.screenMessage(ctx, msg) {
+			res.Skipped++
+			continue
+		}
+		missed = append(missed, msg)
+	}
+
+	for _, t := range b.triageBatch(missed) {
+		if t.Decision == drop {
+			res.Skipped++
+			continue
+		}
+		msgCtx := withCorrelation(ctx, t.Msg)
+		err := b.answerLate(msgCtx, t.Msg, t.Decision)
+		if errors.Is(err, errSilenced) {
+			return res, err
+		}
+		if err != nil {
+			loggerFrom(msgCtx).Error("error reprocessing message", "err", err)
+			res.Failed++
+			continue
+		}
+		res.Answered++
+	}
+	return res, nil
+}
+
+// answeredLate reports whether msg already has an answer, on time or late.
+func (b *Bot) answeredLate(ctx context.Context, msg *Message) (bool, error) {
+	reply, _, err := b.messages.FindReply(ctx, msg.ID)
+	if err != nil || reply != nil {
+		return reply != nil, err
+	}
+	late, err := b.catchUp.CatchUp(ctx, msg.ID)
+	return late != nil, err
+}
+
+// answerLate writes the late answer to one missed message.
+func (b *Bot) answerLate(ctx context.Context, msg *Message, decision triageDecision) error {
+	b.costs.item(featureQA)
+	persona := b.personas.current().Name
+	variant := b.experiment.pick(persona)
+	answer, promptContext, err := b.composeAnswer(withVariant(ctx, variant), msg, nil)
+	if err != nil {
+		return err
+	}
+	reply := b.replyTo(ctx, msg, Message{Persona: persona, Variant: variant})
+	reply.Message, reply.Context = catchUpPreamble+answer, promptContext
+	if decision == answerPrivate {
+		return b.write(ctx, "write-private-reply", func(ctx context.Context) error { return b.messages.WritePrivateReply(ctx, reply) })
+	}
+	reply.Question = rephraseQuestion(ctx, b.ladderModel(), msg.Message)
+	return b.retry.do(ctx, func(ctx context.Context) error { return b.catchUp.WriteCatchUp(ctx, reply) })
+}
+
+func registerReprocessRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("POST /admin/reprocess", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			From time.Time `json:"from"`
+			To   time.Time `json:"to"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.From.IsZero() || req.To.IsZero() {
+			writeError(w, http.StatusBadRequest, errors.New("from and to are required"))
+			return
+		}
+		if !req.To.After(req.From) {
+			writeError(w, http.StatusBadRequest, errors.New("to must be after from"))
+			return
+		}
+		res, err := b.reprocess(r.Context(), req.From, req.To)
+		if errors.Is(err, errSilenced) {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"error": "the host is silenced", "result": res})
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		slog.Info("reprocessed messages", "from", req.From, "to", req.To, "answered", res.Answered, "skipped", res.Skipped, "failed", res.Failed)
+		writeJSON(w, http.StatusOK, res)
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReprocessAnswersMissedMessagesOnce(t *testing.T) {
+	start := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	store := newMemoryStore()
+	for _, m := range []Message{
+		{ID: "answered", UserID: "ann", Message: "When is lunch?", Timestamp: start.Add(time.Minute)},
+		{ID: "missed", UserID: "bob", Message: "Is the keynote recorded?", Timestamp: start.Add(2 * time.Minute)},
+		{ID: "pending", UserID: "cat", Message: "Where is hall B?", Timestamp: start.Add(3 * time.Minute)},
+		{ID: "later", UserID: "dan", Message: "Any swag left?", Timestamp: start.Add(time.Hour)},
+	} {
+		store.AddMessage(m)
+	}
+	for _, id := range []string{"answered", "missed", "later"} {
+		if err := store.MarkProcessed(ctx, id, "", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.WriteReply(ctx, Message{ID: "answered", Message: "At one."}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "Yes, it goes up tonight.", nil
+	}))
+	b.cfg.AdminToken = "s3cret"
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	reprocess := func() ReprocessResult {
+		t.Helper()
+		body := `{"from": "2024-12-07T10:00:00Z", "to": "2024-12-07T10:30:00Z"}`
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/reprocess", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST /admin/reprocess = %d", resp.StatusCode)
+		}
+		var res ReprocessResult
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := reprocess(); res.Answered != 1 || res.Skipped != 2 || res.Failed != 0 || res.Next != nil {
+		t.Errorf("result = %+v, want the missed message answered and the answered and pending ones skipped", res)
+	}
+	late, err := store.CatchUp(ctx, "missed")
+	if err != nil || late == nil {
+		t.Fatalf("catch-up answer = %v, %v", late, err)
+	}
+	if !strings.HasPrefix(late.Message, catchUpPreamble) || !strings.HasSuffix(late.Message, "Yes, it goes up tonight.") || late.InReplyTo != "missed" {
+		t.Errorf("catch-up answer = %+v, want the apology and the answer", late)
+	}
+	if _, ok := store.Reply("missed"); ok {
+		t.Error("the late answer was also posted to the ping stream")
+	}
+
+	if res := reprocess(); res.Answered != 0 || res.Skipped != 3 {
+		t.Errorf("second run = %+v, want everything skipped", res)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+const retentionInterval = time.Hour
+
+// RetentionPolicy deletes documents of Collection whose Field is older than MaxAge.
+type RetentionPolicy struct {
+	Collection string
+	Field      string
+	MaxAge     time.Duration
+}
+
+type RetentionReport struct {
+	RanAt  time.Time        `firestore:"ranAt"`
+	Purged []RetentionPurge `firestore:"purged"`
+}
+
+type RetentionPurge struct {
+	Collection string    `firestore:"collection"`
+	Cutoff     time.Time `firestore:"cutoff"`
+	Deleted    int       `firestore:"deleted"`
+}
+
+// parseRetentionPolicies parses a comma-separated list of
+// "collection=maxAge" or "collection/field=maxAge" entries, e.g.
+// "devfest-chennai-user=720h,devfest-chennai-pseudonyms/createdAt=8760h".
+// Collections may be nested paths such as rooms/main/sessions/main/user; a
+// trailing segment that makes the path even-length is the field, which
+// defaults to "timestamp".
+func parseRetentionPolicies(spec string) ([]RetentionPolicy, error) {
+	var policies []RetentionPolicy
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target, age, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid retention policy %q", entry)
+		}
+		maxAge, err := time.ParseDuration(age)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention age in %q: %w", entry, err)
+		}
+		collection, field := target, "timestamp"
+		if segments := strings.Split(target, "/"); len(segments)%2 == 0 {
+			collection, field = strings.Join(segments[:len(segments)-1], "/"), segments[len(segments)-1]
+		}
+		policies = append(policies, RetentionPolicy{Collection: collection, Field: field, MaxAge: maxAge})
+	}
+	return policies, nil
+}
+
+// runRetentionWorker enforces the policies once an hour and records each
+// purge in the report collection. It is only started when retention
+// policies are configured.
+func (b *Bot) runRetentionWorker(ctx context.Context) error {
+	ticker := clock.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		report, err := enforceRetention(ctx, b.client, b.cfg.retentionPolicies)
+		if err != nil {
+			return err
+		}
+		if len(report.Purged) > 0 {
+			if _, err := b.client.Collection(b.cfg.Collections.RetentionReports).Doc(newID("purge")).Set(ctx, report); err != nil {
+				return fmt.Errorf("error writing retention report: %w", err)
+			}
+			for _, p := range report.Purged {
+				slog.Info("retention purged documents", "collection", p.Collection, "deleted", p.Deleted, "cutoff", p.Cutoff)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+func enforceRetention(ctx context.Context, client *firestore.Client, policies []RetentionPolicy) (*RetentionReport, error) {
+	report := &RetentionReport{RanAt: clock.Now()}
+
+	for _, policy := range policies {
+		cutoff := report.RanAt.Add(-policy.MaxAge)
+		bw := client.BulkWriter(ctx)
+		var jobs []*firestore.BulkWriterJob
+
+		iter := client.Collection(policy.Collection).Where(policy.Field, "<", cutoff).Documents(ctx)
+		for {
+			doc, err := iter.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				iter.Stop()
+				bw.End()
+				return nil, fmt.Errorf("error iterating through %s: %w", policy.Collection, err)
+			}
+			job, err := bw.Delete(doc.Ref)
+			if err != nil {
+				iter.Stop()
+				bw.End()
+				return nil, fmt.Errorf("error deleting from %s: %w", policy.Collection, err)
+			}
+			jobs = append(jobs, job)
+		}
+		iter.Stop()
+		bw.End()
+
+		deleted, err := confirmedWrites(jobs)
+		if err != nil {
+			slog.Error("retention deletes failed", "collection", policy.Collection, "failed", len(jobs)-deleted, "of", len(jobs), "err", err)
+		}
+
+		if deleted > 0 {
+			report.Purged = append(report.Purged, RetentionPurge{
+				Collection: policy.Collection,
+				Cutoff:     cutoff,
+				Deleted:    deleted,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// confirmedWrites counts the jobs Firestore acknowledged. It must be called
+// after the BulkWriter's End, when every job has a result; the error is the
+// last failure, if any.
+func confirmedWrites(jobs []*firestore.BulkWriterJob) (int, error) {
+	confirmed := 0
+	var lastErr error
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			lastErr = err
+			continue
+		}
+		confirmed++
+	}
+	return confirmed, lastErr
+}
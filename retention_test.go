@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRetentionPolicies(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []RetentionPolicy
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "user=720h", want: []RetentionPolicy{{Collection: "user", Field: "timestamp", MaxAge: 720 * time.Hour}}},
+		{spec: "reports/ranAt=8760h, pings=168h", want: []RetentionPolicy{
+			{Collection: "reports", Field: "ranAt", MaxAge: 8760 * time.Hour},
+			{Collection: "pings", Field: "timestamp", MaxAge: 168 * time.Hour},
+		}},
+		{spec: "rooms/main/sessions/main/user=24h", want: []RetentionPolicy{
+			{Collection: "rooms/main/sessions/main/user", Field: "timestamp", MaxAge: 24 * time.Hour},
+		}},
+		{spec: "rooms/main/sessions/main/user/createdAt=24h", want: []RetentionPolicy{
+			{Collection: "rooms/main/sessions/main/user", Field: "createdAt", MaxAge: 24 * time.Hour},
+		}},
+		{spec: "user", wantErr: true},
+		{spec: "user=a month", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRetentionPolicies(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRetentionPolicies(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRetentionPolicies(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// retryPolicy retries transient Gemini and Firestore errors with jittered
+// exponential backoff.
+type retryPolicy struct {
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+func newRetryPolicy(cfg RetryConfig) retryPolicy {
+	return retryPolicy{attempts: cfg.MaxAttempts, baseDelay: cfg.BaseDelay.Duration, maxDelay: cfg.MaxDelay.Duration}
+}
+
+// do calls fn until it succeeds, fails with an error that is not
+// transient, or has been tried p.attempts times, and returns its last
+// error. It gives up early, with fn's last error, if ctx is done.
+func (p retryPolicy) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := p.baseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.attempts || !isTransient(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-clock.After(jitter(backoff, 0.2)):
+		}
+		backoff = min(backoff*2, p.maxDelay)
+	}
+}
+
+// isTransient reports whether err is worth retrying: the service was
+// briefly unavailable or overloaded, not a bad request. Quota errors are
+// left to the degradation ladder.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= http.StatusInternalServerError
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.Internal:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "try again")
+	tests := []struct {
+		name         string
+		errs         []error // returned by successive attempts; nil after
+		wantAttempts int
+		wantErr      error
+	}{
+		{"first try", nil, 1, nil},
+		{"transient then success", []error{unavailable, unavailable}, 3, nil},
+		{"gives up after max attempts", []error{unavailable, unavailable, unavailable, unavailable}, 3, unavailable},
+		{"server error from the Gemini API", []error{&googleapi.Error{Code: 503}}, 2, nil},
+		{"bad request is not retried", []error{&googleapi.Error{Code: 400}}, 1, &googleapi.Error{Code: 400}},
+		{"quota is left to the ladder", []error{status.Error(codes.ResourceExhausted, "quota")}, 1, status.Error(codes.ResourceExhausted, "quota")},
+		{"cancelled is not retried", []error{context.Canceled}, 1, context.Canceled},
+	}
+	p := retryPolicy{attempts: 3, baseDelay: time.Millisecond, maxDelay: 4 * time.Millisecond}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := p.do(context.Background(), func(ctx context.Context) error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if (err == nil) != (tt.wantErr == nil) || (err != nil && err.Error() != tt.wantErr.Error()) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateResponseFallsBackAfterRetries(t *testing.T) {
+	calls := 0
+	b := newTestBot(t, newMemoryStore(), generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		calls++
+		return "", status.Error(codes.Unavailable, "overloaded")
+	}))
+	b.retry = retryPolicy{attempts: 3, baseDelay: time.Millisecond, maxDelay: time.Millisecond}
+
+	text, err := b.generateResponse(context.Background(), "hello", "", nil)
+	if err != nil || text == "" {
+		t.Fatalf("generateResponse = %q, %v, want a canned line", text, err)
+	}
+	if calls != 3 {
+		t.Errorf("model called %d times, want 3", calls)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Process roles. The default runs everything in one process; a large event
+// can instead run ingest workers, which triage audience messages into the
+// response queue, and responders, which answer queued messages and run the
+// monitor, each deployed, scaled and restarted on its own.
+const (
+	roleAll       = "all"
+	roleIngest    = "ingest"
+	roleResponder = "responder"
+)
+
+// inbox is the collection this instance answers messages from: the
+// response queue for responders, the audience messages otherwise.
+func (c *Config) inbox() string {
+	if c.Role == roleResponder {
+		return c.Collections.Queue
+	}
+	return c.Collections.User
+}
+
+// triageBatch decides how to handle a batch of new messages. Queued
+// messages were triaged by the ingest worker and keep its decision.
+func (b *Bot) triageBatch(batch []*Message) []triagedMessage {
+	if b.cfg.Role != roleResponder {
+		return b.triage.Triage(batch)
+	}
+	out := make([]triagedMessage, 0, len(batch))
+	for _, msg := range batch {
+		decision, ok := parseTriageDecision(msg.Triage)
+		if !ok {
+			decision = answerPublic
+		}
+		out = append(out, triagedMessage{Msg: msg, Decision: decision})
+	}
+	return out
+}
+
+// enqueue hands a triaged, anonymized audience message on to the
+// responders and marks the original processed.
+func (b *Bot) enqueue(ctx context.Context, msg *Message, decision triageDecision) error {
+	queued := *msg
+	queued.Triage = decision.String()
+	queued.ClaimedBy, queued.ClaimedAt = "", time.Time{}
+	if err := b.retry.do(ctx, func(ctx context.Context) error { return b.messages.Enqueue(ctx, queued) }); err != nil {
+		return fmt.Errorf("error queueing message: %w", err)
+	}
+	if err := b.markProcessed(ctx, msg.ID, msg.UserID); err != nil {
+		return fmt.Errorf("error marking message as processed: %w", err)
+	}
+	b.health.messagesProcessed.Add(1)
+	return nil
+}
+
+// parseTriageDecision is the inverse of triageDecision.String.
+func parseTriageDecision(s string) (triageDecision, bool) {
+	for d := answerPublic; d <= drop; d++ {
+		if d.String() == s {
+			return d, true
+		}
+	}
+	return 0, false
+}
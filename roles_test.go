@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIngestQueuesTriagedMessages(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		t.Errorf("ingest worker called the model with %q", prompt)
+		return "", nil
+	}))
+	b.cfg.Role = roleIngest
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "Is the keynote recorded?", Section: "C"})
+
+	msg, _ := store.Message("m1")
+	if err := b.handleUserMessage(context.Background(), &msg, answerPrivate); err != nil {
+		t.Fatal(err)
+	}
+	if orig, _ := store.Message("m1"); !orig.Processed {
+		t.Errorf("original message = %+v, want it processed", orig)
+	}
+	queued, ok := store.Queued("m1")
+	if !ok || queued.Processed || queued.Triage != "private" || queued.Message != msg.Message || queued.Section != "C" {
+		t.Fatalf("queued message = %+v, %v; want it unprocessed with the private decision", queued, ok)
+	}
+	if _, ok := store.Reply("m1"); ok {
+		t.Error("ingest worker published a reply")
+	}
+
+	b.cfg.Role = roleResponder
+	got := b.triageBatch([]*Message{&queued, {ID: "m2", Triage: "bogus"}})
+	if len(got) != 2 || got[0].Decision != answerPrivate || got[1].Decision != answerPublic {
+		t.Errorf("responder triage = %+v, want the queued decision and public for an unknown one", got)
+	}
+}
+
+func TestParseTriageDecision(t *testing.T) {
+	for _, d := range []triageDecision{answerPublic, answerPrivate, drop} {
+		if got, ok := parseTriageDecision(d.String()); !ok || got != d {
+			t.Errorf("parseTriageDecision(%q) = %v, %v; want %v", d, got, ok, d)
+		}
+	}
+	if _, ok := parseTriageDecision(""); ok {
+		t.Error("parseTriageDecision accepted an empty decision")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// roomState is the live conversation state of one room. The listener and
+// the monitor both read and update it while generating replies, so every
+// field is atomic: neither loop ever waits for the other, and a slow model
+// call on one side cannot hold up the other.
+type roomState struct {
+	lastUserMessage  atomicTime
+	lastResponseTime atomicTime
+	// summary is the prompt context built from pollStatus and the
+	// conversation memory; see Bot.refreshSummary.
+	summary    atomic.Pointer[string]
+	pollStatus atomic.Pointer[string]
+	// ama is the current ask-me-anything session, nil if none.
+	ama atomic.Pointer[amaSession]
+	// controls are the live monitor settings; announcePoll asks the next
+	// monitor tick for a poll announcement.
+	controls     atomic.Pointer[stageControls]
+	announcePoll atomic.Bool
+	// poll is the active poll; see polls.go.
+	poll atomic.Pointer[activePoll]
+	// day is the content calendar day in effect, nil if none; see
+	// calendar.go.
+	day atomic.Pointer[ContentDay]
+	// leaderboard is the top of the quiz leaderboard, nil until the
+	// monitor first reads it; see leaderboard.go.
+	leaderboard atomic.Pointer[[]LeaderboardEntry]
+	// schedule is the session's schedule as the monitor last read it, nil
+	// if it has none; see session.go.
+	schedule atomic.Pointer[SessionSchedule]
+	// quizLive is set while a quiz is being played, as the monitor last
+	// saw; see quiz.go.
+	quizLive atomic.Bool
+}
+
+func newRoomState() *roomState {
+	r := &roomState{}
+	r.setSummary("")
+	r.setPollStatus("")
+	return r
+}
+
+func (r *roomState) getPollStatus() string {
+	return *r.pollStatus.Load()
+}
+
+func (r *roomState) setPollStatus(s string) {
+	r.pollStatus.Store(&s)
+}
+
+func (r *roomState) getSummary() string {
+	return *r.summary.Load()
+}
+
+func (r *roomState) setSummary(s string) {
+	r.summary.Store(&s)
+}
+
+// atomicTime is a time.Time that can be read and written concurrently. The
+// zero value holds the zero time.
+type atomicTime struct {
+	nanos atomic.Int64
+}
+
+func (t *atomicTime) Load() time.Time {
+	n := t.nanos.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+func (t *atomicTime) Store(v time.Time) {
+	if v.IsZero() {
+		t.nanos.Store(0)
+		return
+	}
+	t.nanos.Store(v.UnixNano())
+}
+
+// StoreLater stores v unless t already holds a later time, so that writers
+// racing each other never move t back.
+func (t *atomicTime) StoreLater(v time.Time) {
+	if v.IsZero() {
+		return
+	}
+	n := v.UnixNano()
+	for {
+		old := t.nanos.Load()
+		if old >= n || t.nanos.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAtomicTimeStoreLater(t *testing.T) {
+	start := time.Date(2024, 11, 16, 10, 0, 0, 0, time.UTC)
+	var at atomicTime
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			at.StoreLater(start.Add(time.Duration(i) * time.Second))
+		}()
+	}
+	wg.Wait()
+	if got, want := at.Load(), start.Add(49*time.Second); !got.Equal(want) {
+		t.Errorf("after racing writers = %v, want the latest, %v", got, want)
+	}
+
+	at.StoreLater(start)
+	at.StoreLater(time.Time{})
+	if got, want := at.Load(), start.Add(49*time.Second); !got.Equal(want) {
+		t.Errorf("after earlier and zero times = %v, want %v kept", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import "math"
+
+// ScoringRules are configured per quiz session. Zero values fall back to the
+// defaults: 10 base points, no streak bonus, bonus questions worth double.
+type ScoringRules struct {
+	BasePoints int `firestore:"basePoints"`
+	// StreakThreshold is how many consecutive correct answers a player needs
+	// before StreakMultiplier applies to each further correct answer.
+	StreakThreshold  int     `firestore:"streakThreshold"`
+	StreakMultiplier float64 `firestore:"streakMultiplier"`
+	// BonusQuestions lists poll IDs worth BonusMultiplier times the points.
+	BonusQuestions  []string `firestore:"bonusQuestions"`
+	BonusMultiplier float64  `firestore:"bonusMultiplier"`
+}
+
+func (r ScoringRules) withDefaults() ScoringRules {
+	if r.BasePoints == 0 {
+		r.BasePoints = pointsPerCorrectAnswer
+	}
+	if r.StreakMultiplier == 0 {
+		r.StreakMultiplier = 1
+	}
+	if r.BonusMultiplier == 0 {
+		r.BonusMultiplier = 2
+	}
+	return r
+}
+
+func (r ScoringRules) isBonus(questionID string) bool {
+	for _, id := range r.BonusQuestions {
+		if id == questionID {
+			return true
+		}
+	}
+	return false
+}
+
+// scoredQuestion is what the scoring engine needs to know about one question.
+type scoredQuestion struct {
+	ID      string
+	Correct string
+	// Answers maps each voter to the options key they picked.
+	Answers map[string]string
+}
+
+// scoreQuestions applies the rules to the questions in play order and returns
+// cumulative points and the current streak of every player. Answering wrong
+// or skipping a question resets the streak.
+func scoreQuestions(questions []scoredQuestion, rules ScoringRules) (scores, streaks map[string]int) {
+	rules = rules.withDefaults()
+	scores = map[string]int{}
+	streaks = map[string]int{}
+
+	for _, q := range questions {
+		if q.Correct == "" {
+			continue
+		}
+		multiplier := 1.0
+		if rules.isBonus(q.ID) {
+			multiplier = rules.BonusMultiplier
+		}
+
+		for player := range streaks {
+			if _, answered := q.Answers[player]; !answered {
+				streaks[player] = 0
+			}
+		}
+		for player, answer := range q.Answers {
+			if answer != q.Correct {
+				// Still list the player on the scoreboard.
+				streaks[player] = 0
+				if _, ok := scores[player]; !ok {
+					scores[player] = 0
+				}
+				continue
+			}
+			streaks[player]++
+			points := float64(rules.BasePoints) * multiplier
+			if rules.StreakThreshold > 0 && streaks[player] > rules.StreakThreshold {
+				points *= rules.StreakMultiplier
+			}
+			scores[player] += int(math.Round(points))
+		}
+	}
+	return scores, streaks
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScoreQuestions(t *testing.T) {
+	q := func(id, correct string, answers map[string]string) scoredQuestion {
+		return scoredQuestion{ID: id, Correct: correct, Answers: answers}
+	}
+	tests := []struct {
+		name        string
+		questions   []scoredQuestion
+		rules       ScoringRules
+		wantScores  map[string]int
+		wantStreaks map[string]int
+	}{
+		{
+			name:        "default points",
+			questions:   []scoredQuestion{q("q1", "A", map[string]string{"ann": "A", "bob": "B"})},
+			wantScores:  map[string]int{"ann": 10, "bob": 0},
+			wantStreaks: map[string]int{"ann": 1, "bob": 0},
+		},
+		{
+			name: "unanswered questions are not scored",
+			questions: []scoredQuestion{
+				q("q1", "", map[string]string{"ann": "A"}),
+				q("q2", "B", map[string]string{"ann": "B"}),
+			},
+			wantScores:  map[string]int{"ann": 10},
+			wantStreaks: map[string]int{"ann": 1},
+		},
+		{
+			name: "streak multiplier after the threshold",
+			questions: []scoredQuestion{
+				q("q1", "A", map[string]string{"ann": "A"}),
+				q("q2", "A", map[string]string{"ann": "A"}),
+				q("q3", "A", map[string]string{"ann": "A"}),
+			},
+			rules:       ScoringRules{BasePoints: 10, StreakThreshold: 2, StreakMultiplier: 1.5},
+			wantScores:  map[string]int{"ann": 35},
+			wantStreaks: map[string]int{"ann": 3},
+		},
+		{
+			name: "skipping a question resets the streak",
+			questions: []scoredQuestion{
+				q("q1", "A", map[string]string{"ann": "A", "bob": "A"}),
+				q("q2", "A", map[string]string{"bob": "A"}),
+				q("q3", "A", map[string]string{"ann": "A", "bob": "A"}),
+			},
+			rules:       ScoringRules{StreakThreshold: 1, StreakMultiplier: 2},
+			wantScores:  map[string]int{"ann": 20, "bob": 50},
+			wantStreaks: map[string]int{"ann": 1, "bob": 3},
+		},
+		{
+			name:        "bonus question",
+			questions:   []scoredQuestion{q("q1", "C", map[string]string{"ann": "C"})},
+			rules:       ScoringRules{BonusQuestions: []string{"q1"}, BonusMultiplier: 3},
+			wantScores:  map[string]int{"ann": 30},
+			wantStreaks: map[string]int{"ann": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores, streaks := scoreQuestions(tt.questions, tt.rules)
+			if !reflect.DeepEqual(scores, tt.wantScores) {
+				t.Errorf("scores = %v, want %v", scores, tt.wantScores)
+			}
+			if !reflect.DeepEqual(streaks, tt.wantStreaks) {
+				t.Errorf("streaks = %v, want %v", streaks, tt.wantStreaks)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	sectionDocID    = "live"
+	sectionHalfLife = 5 * time.Minute
+	// maxSections bounds how many distinct sections are tracked, so a
+	// misbehaving client cannot grow the map without limit.
+	maxSections = 50
+	// sectionCalloutMinWeight is how much recent activity the room needs
+	// before sections are compared at all.
+	sectionCalloutMinWeight = 10
+)
+
+// SectionWeight is the recent activity of one seating section.
+type SectionWeight struct {
+	Section string  `firestore:"section"`
+	Weight  float64 `firestore:"weight"`
+}
+
+// SectionActivity is the live document the frontend can render as a heat map.
+type SectionActivity struct {
+	Sections  []SectionWeight `firestore:"sections"`
+	UpdatedAt time.Time       `firestore:"updatedAt"`
+}
+
+// sectionCounter keeps exponentially decaying message counts per section.
+// Unlike word cloud terms, sections are never dropped once seen: a section
+// that has gone silent is exactly the one the host should call out.
+type sectionCounter struct {
+	mu        sync.Mutex
+	weights   map[string]float64
+	lastDecay time.Time
+}
+
+func newSectionCounter() *sectionCounter {
+	return &sectionCounter{weights: map[string]float64{}}
+}
+
+func (c *sectionCounter) add(section string) {
+	if section == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.weights[section]; !ok && len(c.weights) >= maxSections {
+		return
+	}
+	c.weights[section]++
+}
+
+// snapshot decays the weights to now and returns them, heaviest first.
+func (c *sectionCounter) snapshot(now time.Time) []SectionWeight {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.lastDecay.IsZero() {
+		factor := math.Pow(0.5, now.Sub(c.lastDecay).Seconds()/sectionHalfLife.Seconds())
+		for s, w := range c.weights {
+			c.weights[s] = w * factor
+		}
+	}
+	c.lastDecay = now
+	out := make([]SectionWeight, 0, len(c.weights))
+	for s, w := range c.weights {
+		out = append(out, SectionWeight{Section: s, Weight: w})
+	}
+	return sortSections(out)
+}
+
+// mergeSections adds up the section weights of several shards.
+func mergeSections(lists ...[]SectionWeight) []SectionWeight {
+	weights := map[string]float64{}
+	for _, list := range lists {
+		for _, s := range list {
+			weights[s.Section] += s.Weight
+		}
+	}
+	out := make([]SectionWeight, 0, len(weights))
+	for s, w := range weights {
+		out = append(out, SectionWeight{Section: s, Weight: w})
+	}
+	return sortSections(out)
+}
+
+func sortSections(sections []SectionWeight) []SectionWeight {
+	for i := range sections {
+		sections[i].Weight = math.Round(sections[i].Weight*100) / 100
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		if sections[i].Weight == sections[j].Weight {
+			return sections[i].Section < sections[j].Section
+		}
+		return sections[i].Weight > sections[j].Weight
+	})
+	return sections
+}
+
+// sectionCallout returns what the host should say about the room's
+// sections, sorted heaviest first: the quietest section if it has fallen
+// below a quarter of the average, else the loudest if it is over twice the
+// average. It returns "" with fewer than two sections or too little
+// activity to compare.
+func sectionCallout(sections []SectionWeight) string {
+	if len(sections) < 2 {
+		return ""
+	}
+	var total float64
+	for _, s := range sections {
+		total += s.Weight
+	}
+	if total < sectionCalloutMinWeight {
+		return ""
+	}
+	mean := total / float64(len(sections))
+	loudest, quietest := sections[0], sections[len(sections)-1]
+	switch {
+	case quietest.Weight < mean/4:
+		return fmt.Sprintf("Section %s has gone quiet while section %s is buzzing. Call out section %s by name and get them talking!", quietest.Section, loudest.Section, quietest.Section)
+	case loudest.Weight > 2*mean:
+		return fmt.Sprintf("Section %s is the loudest in the house right now. Give them a shout-out and challenge the other sections to beat them!", loudest.Section)
+	}
+	return ""
+}
+
+// sectionAnnouncements returns a section call-out to make, at most one per
+// Monitor.SectionCalloutGap. Only the monitor calls it.
+func (b *Bot) sectionAnnouncements(sections []SectionWeight) []hostAnnouncement {
+	now := clock.Now()
+	if now.Sub(b.sectionCalloutAt) < b.cfg.Monitor.SectionCalloutGap.Duration {
+		return nil
+	}
+	text := sectionCallout(sections)
+	if text == "" {
+		return nil
+	}
+	return []hostAnnouncement{{
+		Kind: "section-callout",
+		Text: text,
+		Done: func(ctx context.Context) error {
+			b.sectionCalloutAt = now
+			return nil
+		},
+	}}
+}
+
+// collectSectionActivity counts received audience messages per section.
+func (b *Bot) collectSectionActivity(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-b.sectionEvents:
+			b.sections.add(e.Section)
+		}
+	}
+}
+
+func writeSectionActivity(ctx context.Context, client *firestore.Client, collection string, sections []SectionWeight) error {
+	_, err := client.Collection(collection).Doc(sectionDocID).Set(ctx, SectionActivity{Sections: sections, UpdatedAt: clock.Now()})
+	return err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSectionCallout(t *testing.T) {
+	tests := []struct {
+		name     string
+		sections []SectionWeight
+		want     string
+	}{
+		{"one section", []SectionWeight{{"A", 40}}, ""},
+		{"too quiet to compare", []SectionWeight{{"A", 6}, {"C", 0.5}}, ""},
+		{"even room", []SectionWeight{{"A", 12}, {"B", 10}, {"C", 8}}, ""},
+		{"quiet section", []SectionWeight{{"A", 20}, {"B", 15}, {"C", 1}}, "Call out section C"},
+		{"loud section", []SectionWeight{{"A", 40}, {"B", 5}, {"C", 5}, {"D", 4}}, "Section A is the loudest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sectionCallout(tt.sections)
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("sectionCallout = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSectionCounterDecays(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	c := newSectionCounter()
+	for range 8 {
+		c.add("A")
+	}
+	c.add("B")
+	c.add("")
+	c.snapshot(start)
+
+	got := mergeSections(c.snapshot(start.Add(sectionHalfLife)), []SectionWeight{{"B", 1}, {"C", 2}})
+	want := []SectionWeight{{"A", 4}, {"C", 2}, {"B", 1.5}}
+	if len(got) != len(want) {
+		t.Fatalf("sections = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("sections[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
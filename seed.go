@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// seededRand guards a *rand.Rand, which isn't safe for concurrent use. All
+// random choices (canned lines, restart jitter, document and correlation
+// IDs, shuffled picks) go through it so a fixed seed replays them exactly.
+type seededRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+var rng = &seededRand{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// enableSeedMode makes randomness and time deterministic for tests and
+// rehearsal replays. The returned clock starts at start and must be driven
+// by the caller.
+func enableSeedMode(seed int64, start time.Time) *virtualClock {
+	seedRand(seed)
+	vc := newVirtualClock(start)
+	clock = vc
+	return vc
+}
+
+// seedRand reseeds the process-wide rng, leaving the clock as it is.
+func seedRand(seed int64) {
+	rng = &seededRand{r: rand.New(rand.NewSource(seed))}
+}
+
+func (s *seededRand) Intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Intn(n)
+}
+
+func (s *seededRand) Float64() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Float64()
+}
+
+func (s *seededRand) Shuffle(n int, swap func(i, j int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.r.Shuffle(n, swap)
+}
+
+// jitter returns d randomly stretched or shrunk by up to frac of itself.
+func jitter(d time.Duration, frac float64) time.Duration {
+	return d + time.Duration((rng.Float64()*2-1)*frac*float64(d))
+}
+
+// newID returns a random document ID with the given prefix.
+func newID(prefix string) string {
+	rng.mu.Lock()
+	defer rng.mu.Unlock()
+	return fmt.Sprintf("%s-%016x", prefix, rng.r.Uint64())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSeedModeReplays(t *testing.T) {
+	defer func(prev Clock) { clock = prev }(clock)
+	defer seedRand(time.Now().UnixNano())
+	start := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+
+	draw := func() []any {
+		order := []int{1, 2, 3, 4, 5}
+		rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		return []any{rng.Intn(1000), rng.Float64(), newID("msg"), jitter(time.Minute, 0.5), fmt.Sprint(order)}
+	}
+	vc := enableSeedMode(42, start)
+	first := draw()
+	if !clock.Now().Equal(start) {
+		t.Errorf("clock in seed mode = %v, want it stopped at %v", clock.Now(), start)
+	}
+	vc.Advance(time.Second)
+	if !clock.Now().Equal(start.Add(time.Second)) {
+		t.Errorf("clock after Advance = %v, want %v", clock.Now(), start.Add(time.Second))
+	}
+
+	enableSeedMode(42, start)
+	second := draw()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("draw %d = %v, then %v with the same seed, want the same", i, first[i], second[i])
+		}
+	}
+	seedRand(43)
+	if id := newID("msg"); id == first[2] {
+		t.Errorf("newID = %s under another seed, want a different ID", id)
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	defer seedRand(time.Now().UnixNano())
+	seedRand(7)
+	lo, hi := time.Hour, time.Duration(0)
+	for range 1000 {
+		d := jitter(10*time.Second, 0.2)
+		if d < 8*time.Second || d > 12*time.Second {
+			t.Fatalf("jitter(10s, 0.2) = %v, want within 8s to 12s", d)
+		}
+		lo, hi = min(lo, d), max(hi, d)
+	}
+	// Both directions are used.
+	if lo >= 9*time.Second || hi <= 11*time.Second {
+		t.Errorf("jitter(10s, 0.2) ranged over %v to %v, want it spread over 8s to 12s", lo, hi)
+	}
+	if d := jitter(10*time.Second, 0); d != 10*time.Second {
+		t.Errorf("jitter(10s, 0) = %v, want 10s", d)
+	}
+}
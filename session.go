@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sessionCloseGrace is how long after a session ends the host still says
+// goodbye; a backend started later than that stays quiet.
+const sessionCloseGrace = 15 * time.Minute
+
+// SessionSchedule is the window of the show, the live document of the
+// schedule collection. Outside it the host still answers the audience but
+// does not speak up on its own. A zero EndsAt keeps the session open until
+// it is stopped. Language, if set, replaces the configured default language
+// for the session; see language.go. Welcomed and Closed are set by the
+// backend once the host has opened and closed the session.
+type SessionSchedule struct {
+	Title    string    `firestore:"title,omitempty" json:"title,omitempty"`
+	Language string    `firestore:"language,omitempty" json:"language,omitempty"`
+	StartsAt time.Time `firestore:"startsAt" json:"startsAt"`
+	EndsAt   time.Time `firestore:"endsAt,omitempty" json:"endsAt,omitempty"`
+	Welcomed bool      `firestore:"welcomed,omitempty" json:"welcomed"`
+	Closed   bool      `firestore:"closed,omitempty" json:"closed"`
+}
+
+// live reports whether the session is on at now. Without a schedule it
+// always is, as before sessions were scheduled.
+func (s *SessionSchedule) live(now time.Time) bool {
+	if s == nil {
+		return true
+	}
+	return !s.StartsAt.IsZero() && !now.Before(s.StartsAt) && (s.EndsAt.IsZero() || now.Before(s.EndsAt))
+}
+
+// ScheduleStore holds the session's schedule.
+type ScheduleStore interface {
+	// Schedule returns the schedule, or nil if the session has none.
+	Schedule(ctx context.Context) (*SessionSchedule, error)
+	SaveSchedule(ctx context.Context, s SessionSchedule) error
+}
+
+// refreshSchedule reloads the schedule for the monitor, keeping the last
+// one read if that fails.
+func (b *Bot) refreshSchedule(ctx context.Context) error {
+	s, err := b.schedules.Schedule(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading the session schedule: %w", err)
+	}
+	b.room.schedule.Store(s)
+	return nil
+}
+
+// sessionLive reports whether the session is on at now, going by the
+// schedule the monitor last read.
+func (b *Bot) sessionLive(now time.Time) bool {
+	return b.room.schedule.Load().live(now)
+}
+
+// markSession sets the flag mark sets on the stored schedule, reading it
+// afresh so edits made since the monitor read it are kept.
+func (b *Bot) markSession(ctx context.Context, mark func(s *SessionSchedule)) error {
+	s, err := b.schedules.Schedule(ctx)
+	if err != nil || s == nil {
+		return err
+	}
+	mark(s)
+	if err := b.schedules.SaveSchedule(ctx, *s); err != nil {
+		return err
+	}
+	b.room.schedule.Store(s)
+	return nil
+}
+
+// sessionAnnouncements returns the welcome once the session starts, and
+// the goodbye once it ends, after which the session's highlight reel is
+// published. Only the monitor calls it.
+func (b *Bot) sessionAnnouncements(now time.Time) []hostAnnouncement {
+	s := b.room.schedule.Load()
+	if s == nil {
+		return nil
+	}
+	title := s.Title
+	if title == "" {
+		title = "The session"
+	}
+	switch {
+	case s.live(now) && !s.Welcomed:
+		return []hostAnnouncement{{
+			Kind: "session-welcome",
+			Text: fmt.Sprintf("%s is starting now. Welcome the audience, tell them to send in their questions and vote in the polls, and get them excited for the show.", title),
+			Done: func(ctx context.Context) error {
+				return b.markSession(ctx, func(s *SessionSchedule) { s.Welcomed = true })
+			},
+		}}
+	case !s.EndsAt.IsZero() && !now.Before(s.EndsAt) && !s.Closed && now.Sub(s.EndsAt) < sessionCloseGrace:
+		return []hostAnnouncement{{
+			Kind: "session-closing",
+			Text: fmt.Sprintf("%s has come to an end. Thank the audience for their questions and votes, and say goodbye until next time.", title),
+			Done: func(ctx context.Context) error {
+				if err := b.markSession(ctx, func(s *SessionSchedule) { s.Closed = true }); err != nil {
+					return err
+				}
+				b.publishHighlightReel(ctx, "session")
+				return nil
+			},
+		}}
+	}
+	return nil
+}
+
+func registerSessionRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/session", func(w http.ResponseWriter, r *http.Request) {
+		s, err := b.schedules.Schedule(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"schedule": s, "live": s.live(clock.Now())})
+	})
+
+	// PUT replaces the schedule; the host welcomes the audience again when
+	// it starts.
+	mux.HandleFunc("PUT /admin/session", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Title    string    `json:"title"`
+			Language string    `json:"language"`
+			StartsAt time.Time `json:"startsAt"`
+			EndsAt   time.Time `json:"endsAt"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.StartsAt.IsZero() {
+			writeError(w, http.StatusBadRequest, errors.New("startsAt is required"))
+			return
+		}
+		if !req.EndsAt.IsZero() && !req.EndsAt.After(req.StartsAt) {
+			writeError(w, http.StatusBadRequest, errors.New("endsAt must be after startsAt"))
+			return
+		}
+		if req.Language != "" {
+			if err := validateLanguage(req.Language, "language"); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		s := SessionSchedule{Title: req.Title, Language: req.Language, StartsAt: req.StartsAt, EndsAt: req.EndsAt}
+		if err := b.schedules.SaveSchedule(r.Context(), s); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s)
+	})
+
+	// start opens the session now, keeping its end if that is still to
+	// come; stop ends it now.
+	mux.HandleFunc("POST /admin/session/start", func(w http.ResponseWriter, r *http.Request) {
+		now := clock.Now()
+		s, err := b.schedules.Schedule(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		next := SessionSchedule{StartsAt: now}
+		if s != nil {
+			next.Title, next.Language = s.Title, s.Language
+			if s.EndsAt.After(now) {
+				next.EndsAt = s.EndsAt
+			}
+			next.Welcomed = s.live(now) && s.Welcomed
+		}
+		if err := b.schedules.SaveSchedule(r.Context(), next); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, next)
+	})
+	mux.HandleFunc("POST /admin/session/stop", func(w http.ResponseWriter, r *http.Request) {
+		now := clock.Now()
+		s, err := b.schedules.Schedule(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if s == nil || !s.live(now) {
+			writeError(w, http.StatusConflict, errors.New("no session is running"))
+			return
+		}
+		s.EndsAt = now
+		if err := b.schedules.SaveSchedule(r.Context(), *s); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s)
+	})
+}
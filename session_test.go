@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionLive(t *testing.T) {
+	start := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	s := &SessionSchedule{StartsAt: start, EndsAt: start.Add(2 * time.Hour)}
+	for _, tc := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{start.Add(-time.Minute), false},
+		{start, true},
+		{start.Add(time.Hour), true},
+		{start.Add(2 * time.Hour), false},
+	} {
+		if got := s.live(tc.at); got != tc.want {
+			t.Errorf("live at %s = %v, want %v", tc.at.Format(time.Kitchen), got, tc.want)
+		}
+	}
+	if !(*SessionSchedule)(nil).live(start) {
+		t.Error("a session without a schedule is not live")
+	}
+	if (&SessionSchedule{}).live(start) {
+		t.Error("a schedule without a start is live")
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 9, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.AdminToken = "s3cret"
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	do := func(method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	ctx := context.Background()
+	tick := func() []hostAnnouncement {
+		t.Helper()
+		if err := b.refreshSchedule(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return b.sessionAnnouncements(clock.Now())
+	}
+
+	if code := do(http.MethodPut, "/admin/session", `{"title": "DevFest Chennai keynote", "startsAt": "2024-12-07T10:00:00Z", "endsAt": "2024-12-07T12:00:00Z"}`); code != http.StatusOK {
+		t.Fatalf("PUT /admin/session = %d", code)
+	}
+	if got := tick(); len(got) != 0 || b.sessionLive(clock.Now()) {
+		t.Fatalf("before the session: live %v, announcements %+v, want quiet", b.sessionLive(clock.Now()), got)
+	}
+
+	vc.Advance(time.Hour)
+	got := tick()
+	if len(got) != 1 || got[0].Kind != "session-welcome" || !strings.Contains(got[0].Text, "DevFest Chennai keynote") {
+		t.Fatalf("at the start: %+v, want the welcome", got)
+	}
+	if err := got[0].Done(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := tick(); len(got) != 0 || !b.sessionLive(clock.Now()) {
+		t.Errorf("once welcomed: %+v, want a quiet live session", got)
+	}
+
+	vc.Advance(30 * time.Minute)
+	if code := do(http.MethodPost, "/admin/session/stop", ""); code != http.StatusOK {
+		t.Fatalf("stop = %d", code)
+	}
+	got = tick()
+	if len(got) != 1 || got[0].Kind != "session-closing" || b.sessionLive(clock.Now()) {
+		t.Fatalf("after stopping: %+v, want the goodbye", got)
+	}
+	if err := got[0].Done(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := tick(); len(got) != 0 {
+		t.Errorf("once closed: %+v, want nothing", got)
+	}
+	if code := do(http.MethodPost, "/admin/session/stop", ""); code != http.StatusConflict {
+		t.Errorf("stopping a stopped session = %d, want %d", code, http.StatusConflict)
+	}
+
+	if code := do(http.MethodPost, "/admin/session/start", ""); code != http.StatusOK {
+		t.Fatalf("start = %d", code)
+	}
+	if got := tick(); len(got) != 1 || got[0].Kind != "session-welcome" {
+		t.Errorf("after starting again: %+v, want a new welcome", got)
+	}
+}
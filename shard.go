@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// ShardActivity is what a secondary shard reports to the primary every
+// monitor tick, so idle detection and the word cloud cover the whole
+// audience rather than shard 0's slice of it.
+type ShardActivity struct {
+	Index           int             `firestore:"index"`
+	LastUserMessage time.Time       `firestore:"lastUserMessage"`
+	Terms           []WordCloudTerm `firestore:"terms"`
+	Sections        []SectionWeight `firestore:"sections,omitempty"`
+	UpdatedAt       time.Time       `firestore:"updatedAt"`
+}
+
+// shardActivityMaxAge is how many monitor ticks a report stays valid; older
+// ones belong to shards that stopped and are ignored.
+const shardActivityMaxAge = 3
+
+// messageShard is the shard a message with the given document ID belongs to.
+// Clients must compute the same value when they write a message.
+func messageShard(id string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(count))
+}
+
+// unprocessedMessages is the query for this instance's unprocessed messages.
+func unprocessedMessages(client *firestore.Client, cfg *Config) firestore.Query {
+	q := client.Collection(cfg.inbox()).Where("processed", "==", false)
+	if cfg.Shards.Count > 1 {
+		q = q.Where("shard", "==", cfg.Shards.Index)
+	}
+	return q
+}
+
+// isPrimary reports whether this instance runs the monitor and background
+// workers, which must only run once per event.
+func (c *Config) isPrimary() bool {
+	return c.Shards.Index == 0
+}
+
+// reportShardActivity runs on secondary shards in place of the monitor. It
+// decays the local word cloud and publishes its top terms and section
+// activity together with the time of the last audience message this shard
+// received.
+func (b *Bot) reportShardActivity(ctx context.Context) error {
+	ticker := clock.NewTicker(b.cfg.Monitor.TickInterval.Duration)
+	defer ticker.Stop()
+
+	ref := b.client.Collection(b.cfg.Collections.Shards).Doc(fmt.Sprintf("shard-%d", b.cfg.Shards.Index))
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+			now := clock.Now()
+			b.wordCloud.decay(now)
+			_, err := ref.Set(ctx, ShardActivity{
+				Index:           b.cfg.Shards.Index,
+				LastUserMessage: b.room.lastUserMessage.Load(),
+				Terms:           b.wordCloud.top(wordCloudMaxTerms),
+				Sections:        b.sections.snapshot(now),
+				UpdatedAt:       now,
+			})
+			if err != nil {
+				slog.Error("error reporting shard activity", "err", err)
+			}
+		}
+	}
+}
+
+// shardActivity reads the current reports of the secondary shards.
+func (b *Bot) shardActivity(ctx context.Context) ([]ShardActivity, error) {
+	if b.cfg.Shards.Count < 2 {
+		return nil, nil
+	}
+	cutoff := clock.Now().Add(-shardActivityMaxAge * b.cfg.Monitor.TickInterval.Duration)
+	iter := b.client.Collection(b.cfg.Collections.Shards).Where("updatedAt", ">=", cutoff).Documents(ctx)
+	defer iter.Stop()
+
+	var reports []ShardActivity
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return reports, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through shard activity: %w", err)
+		}
+		var a ShardActivity
+		if err := doc.DataTo(&a); err != nil {
+			slog.Warn("skipping shard activity", "doc", doc.Ref.ID, "err", err)
+			continue
+		}
+		if a.Index != b.cfg.Shards.Index {
+			reports = append(reports, a)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMessageShard(t *testing.T) {
+	// Clients compute the same FNV-1a hash, so these values are part of
+	// the contract with them and must not change.
+	tests := []struct {
+		id    string
+		count int
+		want  int
+	}{
+		{"abc", 1, 0},
+		{"abc", 4, 3},
+		{"abc", 3, 2},
+		{"msg-1", 4, 0},
+		{"msg-2", 4, 1},
+		{"", 3, 1},
+	}
+	for _, tt := range tests {
+		if got := messageShard(tt.id, tt.count); got != tt.want {
+			t.Errorf("messageShard(%q, %d) = %d, want %d", tt.id, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestMergeTerms(t *testing.T) {
+	primary := []WordCloudTerm{{Text: "gemini", Weight: 3}, {Text: "flutter", Weight: 1}}
+	secondary := []WordCloudTerm{{Text: "flutter", Weight: 2.5}, {Text: "firebase", Weight: 0.5}}
+
+	got := mergeTerms(2, primary, secondary)
+	want := []WordCloudTerm{{Text: "flutter", Weight: 3.5}, {Text: "gemini", Weight: 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeTerms = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Kinds of show-log entries. Messages, polls and state changes are the
+// show's inputs, which the replay command plays back; replies, events and
+// model calls are its outputs, which it re-renders.
+const (
+	showStart   = "start"   // the show started, with Config and Seed
+	showMessage = "message" // an audience message was picked up: Message
+	showPoll    = "poll"    // the live poll's tally changed: PollID, Poll
+	showEvent   = "event"   // a state change, closed poll, flag or gap: Event
+	showReply   = "reply"   // a host message was published: Event
+	showModel   = "model"   // Model was called: Prompt, Response, Error
+)
+
+// ShowLogEntry is one line of a show-log. Only the fields for Kind are set.
+type ShowLogEntry struct {
+	At      time.Time     `json:"at"`
+	Kind    string        `json:"kind"`
+	Config  *Config       `json:"config,omitempty"`
+	Seed    int64         `json:"seed,omitempty"`
+	Message *Message      `json:"message,omitempty"`
+	PollID  string        `json:"pollId,omitempty"`
+	Poll    *PollQuestion `json:"poll,omitempty"`
+	Event   *Event        `json:"event,omitempty"`
+	// Model is "model" or "fallback".
+	Model    string `json:"model,omitempty"`
+	Prompt   string `json:"prompt,omitempty"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// showRecorder appends entries to a show-log as JSON lines. A nil
+// recorder records nothing.
+type showRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+func newShowRecorder(w io.Writer) *showRecorder {
+	r := &showRecorder{enc: json.NewEncoder(w)}
+	r.c, _ = w.(io.Closer)
+	return r
+}
+
+// openShowLog opens the show-log at path for appending, so a restarted
+// process carries on the same log.
+func openShowLog(path string) (*showRecorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening show-log: %w", err)
+	}
+	return newShowRecorder(f), nil
+}
+
+// record appends e, stamped with the current time if At is unset. A
+// failed write is logged rather than interrupting the show.
+func (r *showRecorder) record(e ShowLogEntry) {
+	if r == nil {
+		return
+	}
+	if e.At.IsZero() {
+		e.At = clock.Now()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.enc.Encode(e); err != nil {
+		slog.Error("error writing show-log", "kind", e.Kind, "err", err)
+	}
+}
+
+func (r *showRecorder) Close() error {
+	if r == nil || r.c == nil {
+		return nil
+	}
+	return r.c.Close()
+}
+
+// readShowLog reads every entry of a show-log.
+func readShowLog(r io.Reader) ([]ShowLogEntry, error) {
+	var entries []ShowLogEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var e ShowLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("error parsing show-log line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// recordedModel is a ResponseGenerator that logs every call to model, and
+// its outcome, on a show-log as name.
+type recordedModel struct {
+	name  string
+	model ResponseGenerator
+	log   *showRecorder
+}
+
+func (m recordedModel) Generate(ctx context.Context, prompt string) (string, error) {
+	return m.GenerateStream(ctx, prompt, nil)
+}
+
+func (m recordedModel) GenerateStream(ctx context.Context, prompt string, onText func(partial string)) (string, error) {
+	var text string
+	var err error
+	if sm, ok := m.model.(streamingGenerator); ok && onText != nil {
+		text, err = sm.GenerateStream(ctx, prompt, onText)
+	} else {
+		text, err = m.model.Generate(ctx, prompt)
+	}
+	e := ShowLogEntry{Kind: showModel, Model: m.name, Prompt: prompt, Response: text}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	m.log.record(e)
+	return text, err
+}
+
+// recordShowInput logs an audience message as it was picked up, before
+// anything is done to it.
+func (b *Bot) recordShowInput(msg *Message) {
+	if b.showLog == nil {
+		return
+	}
+	m := *msg
+	b.showLog.record(ShowLogEntry{Kind: showMessage, Message: &m})
+}
+
+// recordShow logs the show's state changes and outputs as they are
+// published, and the live poll's document whenever its tally changes.
+func (b *Bot) recordShow(ctx context.Context) error {
+	events, unsubscribe := b.bus.Subscribe(EventResponsePublished, EventPollUpdated, EventPollClosed, EventStateChanged, EventKnowledgeGap, EventContentFlagged)
+	defer unsubscribe()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-events:
+			switch e.Kind {
+			case EventResponsePublished:
+				b.showLog.record(ShowLogEntry{At: e.At, Kind: showReply, Event: &e})
+			case EventPollUpdated:
+				poll, err := b.polls.Poll(ctx, e.PollID)
+				if err != nil {
+					slog.Error("error reading poll for the show-log", "poll", e.PollID, "err", err)
+					continue
+				}
+				b.showLog.record(ShowLogEntry{At: e.At, Kind: showPoll, PollID: e.PollID, Poll: poll})
+			default:
+				b.showLog.record(ShowLogEntry{At: e.At, Kind: showEvent, Event: &e})
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runShowLogBot answers messages with b's listener and records the show
+// until the returned stop is called.
+func runShowLogBot(t *testing.T, b *Bot) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 2)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	go func() { done <- b.recordShow(ctx) }()
+	return func() {
+		cancel()
+		for range 2 {
+			if err := <-done; err != nil {
+				t.Errorf("worker returned %v after cancel", err)
+			}
+		}
+	}
+}
+
+func TestShowLogReplay(t *testing.T) {
+	t0 := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = newVirtualClock(t0)
+
+	// Record a show in which ann asks one question. The host makes up a
+	// nickname for her, so the replay must draw the same one.
+	defer seedRand(time.Now().UnixNano())
+	seedRand(42)
+	var recording bytes.Buffer
+	showLog := newShowRecorder(&recording)
+	model := recordedModel{name: "model", log: showLog, model: generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "Rephrase") {
+			return `"What is Gemini, exactly?"`, nil
+		}
+		return "Namaste! Gemini is Google's model.", nil
+	})}
+	store := newMemoryStore()
+	b := newTestBot(t, store, model)
+	b.showLog = showLog
+	stop := runShowLogBot(t, b)
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "What is Gemini?"})
+	waitFor(t, nil, "the reply to be recorded", func() bool {
+		showLog.mu.Lock()
+		defer showLog.mu.Unlock()
+		return strings.Contains(recording.String(), `"kind":"reply"`)
+	})
+	stop()
+
+	entries, err := readShowLog(&recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]int{}
+	for _, e := range entries {
+		kinds[e.Kind]++
+	}
+	if kinds[showMessage] != 1 || kinds[showModel] != 2 || kinds[showReply] != 1 {
+		t.Fatalf("recorded entry kinds = %v, want a message, two model calls and a reply", kinds)
+	}
+
+	// Replay it into a fresh store, with the recorded model replies.
+	clock = newVirtualClock(entries[0].At)
+	seedRand(42)
+	recorded := newReplayModels(entries)
+	var replayed bytes.Buffer
+	replayStore := newMemoryStore()
+	rb := newTestBot(t, replayStore, recorded.model("model"))
+	rb.showLog = newShowRecorder(&replayed)
+	stop = runShowLogBot(t, rb)
+	if err := rb.replayInputs(context.Background(), entries, 0); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, nil, "the replayed reply", func() bool {
+		_, ok := replayStore.Reply("m1")
+		return ok
+	})
+	stop()
+
+	reply, _ := replayStore.Reply("m1")
+	if reply.Message != "Namaste! Gemini is Google's model." || reply.Question != "What is Gemini, exactly?" {
+		t.Errorf("replayed reply = %q to %q, want the recorded one", reply.Message, reply.Question)
+	}
+	if n := recorded.unrecorded(); n != 0 {
+		t.Errorf("%d prompts had no recorded reply, want none", n)
+	}
+}
+
+func TestReplayModels(t *testing.T) {
+	recorded := newReplayModels([]ShowLogEntry{
+		{Kind: showModel, Model: "model", Prompt: "hi", Response: "first"},
+		{Kind: showModel, Model: "model", Prompt: "hi", Response: "second"},
+		{Kind: showModel, Model: "model", Prompt: "rude", Error: errSafetyBlocked.Error()},
+		{Kind: showModel, Model: "fallback", Prompt: "hi", Error: "quota exceeded"},
+	})
+	ctx := context.Background()
+	model, fallback := recorded.model("model"), recorded.model("fallback")
+
+	for _, want := range []string{"first", "second", unrecordedReply} {
+		if got, err := model.Generate(ctx, "hi"); got != want || err != nil {
+			t.Errorf("Generate(hi) = %q, %v; want %q", got, err, want)
+		}
+	}
+	if _, err := model.Generate(ctx, "rude"); !errors.Is(err, errSafetyBlocked) {
+		t.Errorf("Generate(rude) = %v, want %v", err, errSafetyBlocked)
+	}
+	if _, err := fallback.Generate(ctx, "hi"); err == nil || err.Error() != "quota exceeded" {
+		t.Errorf("fallback Generate(hi) = %v, want the recorded error", err)
+	}
+	if n := recorded.unrecorded(); n != 1 {
+		t.Errorf("unrecorded = %d, want 1", n)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SLAStatus is how this instance is doing against the answer deadline over
+// the last sla.window.
+type SLAStatus struct {
+	Target     string  `json:"target"`
+	Percentile float64 `json:"percentile"`
+	// Answered counts the messages answered in the window, and
+	// WithinTarget the share of them answered within Target.
+	Answered     int     `json:"answered"`
+	WithinTarget float64 `json:"withinTarget"`
+	// LatencyMs is the Percentile-th answer time, the figure held to
+	// Target.
+	LatencyMs int64 `json:"latencyMs"`
+	// Breached is set while too few answers make the deadline, once there
+	// are at least sla.minSamples of them.
+	Breached bool `json:"breached"`
+}
+
+// slaSample is one answered message: when it was answered, and how long
+// after it arrived.
+type slaSample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// slaTracker keeps the answer times of the last sla.window.
+type slaTracker struct {
+	cfg SLAConfig
+
+	mu       sync.Mutex
+	samples  []slaSample
+	breached bool
+}
+
+func newSLATracker(cfg SLAConfig) *slaTracker {
+	return &slaTracker{cfg: cfg}
+}
+
+// record adds a message answered at at, latency after it arrived.
+func (t *slaTracker) record(at time.Time, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples = append(t.samples, slaSample{at, latency})
+}
+
+// status returns the SLA over the window ending at now.
+func (t *slaTracker) status(now time.Time) SLAStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.statusLocked(now)
+}
+
+func (t *slaTracker) statusLocked(now time.Time) SLAStatus {
+	cutoff := now.Add(-t.cfg.Window.Duration)
+	i := 0
+	for i < len(t.samples) && !t.samples[i].at.After(cutoff) {
+		i++
+	}
+	t.samples = t.samples[i:]
+
+	s := SLAStatus{Target: t.cfg.Target.String(), Percentile: t.cfg.Percentile, Answered: len(t.samples)}
+	if s.Answered == 0 {
+		return s
+	}
+	latencies := make([]time.Duration, len(t.samples))
+	within := 0
+	for i, sample := range t.samples {
+		latencies[i] = sample.latency
+		if sample.latency <= t.cfg.Target.Duration {
+			within++
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	rank := int(float64(len(latencies))*t.cfg.Percentile+0.5) - 1
+	s.LatencyMs = latencies[min(max(rank, 0), len(latencies)-1)].Milliseconds()
+	s.WithinTarget = float64(within) / float64(s.Answered)
+	s.Breached = s.Answered >= t.cfg.MinSamples && s.WithinTarget < t.cfg.Percentile
+	return s
+}
+
+// check returns the SLA at now and whether it changed between met and
+// breached since the last check.
+func (t *slaTracker) check(now time.Time) (SLAStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.statusLocked(now)
+	changed := s.Breached != t.breached
+	t.breached = s.Breached
+	return s, changed
+}
+
+// recordAnswer counts the answer to msg, published now, towards the SLA.
+// Messages without a timestamp can't be timed.
+func (b *Bot) recordAnswer(msg *Message) {
+	if msg.Timestamp.IsZero() {
+		return
+	}
+	now := clock.Now()
+	b.sla.record(now, now.Sub(msg.Timestamp))
+}
+
+// monitorSLA checks the answer deadline every monitor tick. A breach
+// publishes a state-changed event and alerts the moderators; a recovery
+// only publishes the event.
+func (b *Bot) monitorSLA(ctx context.Context) error {
+	ticker := clock.NewTicker(b.cfg.Monitor.TickInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+		s, changed := b.sla.check(clock.Now())
+		if !changed {
+			continue
+		}
+		if !s.Breached {
+			slog.Info("answer SLA met again", "withinTarget", s.WithinTarget, "answers", s.Answered, "target", s.Target)
+			b.bus.Publish(Event{Kind: EventStateChanged, State: "sla", From: "breached", To: "met"})
+			continue
+		}
+		reason := fmt.Sprintf("only %.0f%% of the last %d answers went out within %s (target %.0f%%); the %.0fth percentile took %s",
+			s.WithinTarget*100, s.Answered, s.Target, s.Percentile*100, s.Percentile*100, time.Duration(s.LatencyMs)*time.Millisecond)
+		slog.Warn("answer SLA breached", "reason", reason)
+		b.bus.Publish(Event{Kind: EventStateChanged, State: "sla", From: "met", To: "breached", Reason: reason})
+		alert := ModeratorAlert{Level: "sla", Reason: reason, CreatedAt: clock.Now()}
+		if _, err := b.client.Collection(b.cfg.Collections.Alerts).Doc(newID("alert")).Set(ctx, alert); err != nil {
+			slog.Error("error writing SLA alert", "err", err)
+		}
+	}
+}
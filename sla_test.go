@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSLATracker(t *testing.T) {
+	start := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	tr := newSLATracker(SLAConfig{Target: Duration{20 * time.Second}, Percentile: 0.9, Window: Duration{5 * time.Minute}, MinSamples: 5})
+
+	for i := range 4 {
+		tr.record(start.Add(time.Duration(i)*time.Second), 30*time.Second)
+	}
+	if s, changed := tr.check(start.Add(time.Minute)); s.Breached || changed {
+		t.Errorf("status with 4 late answers = %+v, want it not judged below minSamples", s)
+	}
+
+	for i := range 6 {
+		tr.record(start.Add(time.Minute+time.Duration(i)*time.Second), 5*time.Second)
+	}
+	s, changed := tr.check(start.Add(2 * time.Minute))
+	if !s.Breached || !changed || s.Answered != 10 || s.WithinTarget != 0.6 || s.LatencyMs != 30000 {
+		t.Errorf("status = %+v (changed %v), want a breach with 60%% within target and p90 30s", s, changed)
+	}
+	if _, changed := tr.check(start.Add(2 * time.Minute)); changed {
+		t.Error("a breach was reported twice")
+	}
+
+	// Once the late answers leave the window the SLA is met again.
+	s, changed = tr.check(start.Add(5*time.Minute + 30*time.Second))
+	if s.Breached || !changed || s.Answered != 6 || s.LatencyMs != 5000 {
+		t.Errorf("status = %+v (changed %v), want the SLA met with only the fast answers", s, changed)
+	}
+}
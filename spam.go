@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Why a message was dropped by the spam filter.
+const (
+	spamBlocked     = "blocked sender"
+	spamDuplicate   = "duplicate"
+	spamRateLimited = "rate limited"
+)
+
+// spamSweepInterval is how often idle senders are forgotten.
+const spamSweepInterval = time.Minute
+
+// BlockedUser is a sender whose messages are dropped unread.
+type BlockedUser struct {
+	UserID    string    `firestore:"userId" json:"userId"`
+	Reason    string    `firestore:"reason,omitempty" json:"reason,omitempty"`
+	BlockedAt time.Time `firestore:"blockedAt" json:"blockedAt"`
+}
+
+// BlockListStore keeps the senders blocked by moderators, one document per
+// user ID.
+type BlockListStore interface {
+	BlockUser(ctx context.Context, u BlockedUser) error
+	UnblockUser(ctx context.Context, userID string) error
+	// WatchBlockedUsers calls fn with every blocked user now and whenever
+	// the list changes, until ctx is done or fn fails.
+	WatchBlockedUsers(ctx context.Context, fn func(blocked []BlockedUser) error) error
+}
+
+// spamFilter keeps one sender from monopolizing the host: a token bucket
+// per sender, a window in which the same sender's repeated text is
+// dropped, and the block list. Limits are per instance; with shards or
+// replicas each one allows a sender its own rate.
+type spamFilter struct {
+	// perSecond and burst are the token bucket; perSecond <= 0 disables it.
+	perSecond float64
+	burst     float64
+	// window is how long a sender's text is remembered; <= 0 disables it.
+	window time.Duration
+
+	// blocked is the latest block list, by user ID.
+	blocked atomic.Pointer[map[string]BlockedUser]
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	seen      map[string]time.Time // sender + "\x00" + normalized text
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+func newSpamFilter(cfg RateLimitConfig) *spamFilter {
+	f := &spamFilter{
+		perSecond: cfg.PerMinute / 60,
+		burst:     float64(cfg.Burst),
+		window:    cfg.DuplicateWindow.Duration,
+		buckets:   map[string]*tokenBucket{},
+		seen:      map[string]time.Time{},
+	}
+	f.blocked.Store(&map[string]BlockedUser{})
+	return f
+}
+
+// senderKey is who msg is from for rate limiting: the user ID, or for
+// signed-out audience members the session ID their client sends. Messages
+// with neither are not limited.
+func senderKey(msg *Message) string {
+	if msg.UserID != "" {
+		return "user:" + msg.UserID
+	}
+	if msg.SessionID != "" {
+		return "session:" + msg.SessionID
+	}
+	return ""
+}
+
+// check returns why msg must be dropped, or "" to let it through, and
+// counts it against its sender if it is let through.
+func (f *spamFilter) check(msg *Message, now time.Time) string {
+	if _, ok := (*f.blocked.Load())[msg.UserID]; ok && msg.UserID != "" {
+		return spamBlocked
+	}
+	sender := senderKey(msg)
+	if sender == "" {
+		return ""
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now.Sub(f.lastSweep) >= spamSweepInterval {
+		f.sweepLocked(now)
+	}
+	text := sender + "\x00" + strings.Join(splitWords(strings.ToLower(msg.Message)), " ")
+	if f.window > 0 {
+		if at, ok := f.seen[text]; ok && now.Sub(at) < f.window {
+			return spamDuplicate
+		}
+	}
+	if f.perSecond > 0 {
+		b, ok := f.buckets[sender]
+		if !ok {
+			b = &tokenBucket{tokens: f.burst, at: now}
+			f.buckets[sender] = b
+		}
+		b.tokens = min(f.burst, b.tokens+now.Sub(b.at).Seconds()*f.perSecond)
+		b.at = now
+		if b.tokens < 1 {
+			return spamRateLimited
+		}
+		b.tokens--
+	}
+	if f.window > 0 {
+		f.seen[text] = now
+	}
+	return ""
+}
+
+// sweepLocked forgets senders whose bucket has refilled and texts older
+// than the window, so the maps don't grow with the audience.
+func (f *spamFilter) sweepLocked(now time.Time) {
+	f.lastSweep = now
+	for sender, b := range f.buckets {
+		if b.tokens+now.Sub(b.at).Seconds()*f.perSecond >= f.burst {
+			delete(f.buckets, sender)
+		}
+	}
+	for text, at := range f.seen {
+		if now.Sub(at) >= f.window {
+			delete(f.seen, text)
+		}
+	}
+}
+
+// setBlocked replaces the block list.
+func (f *spamFilter) setBlocked(users []BlockedUser) {
+	blocked := make(map[string]BlockedUser, len(users))
+	for _, u := range users {
+		blocked[u.UserID] = u
+	}
+	f.blocked.Store(&blocked)
+}
+
+// blockedUsers lists the block list, most recently blocked first.
+func (f *spamFilter) blockedUsers() []BlockedUser {
+	blocked := *f.blocked.Load()
+	out := make([]BlockedUser, 0, len(blocked))
+	for _, u := range blocked {
+		out = append(out, u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].BlockedAt.After(out[j].BlockedAt) })
+	return out
+}
+
+// filterSpam reports whether msg must be dropped because its sender is
+// blocked, repeated themselves or is over their rate.
+func (b *Bot) filterSpam(msg *Message) bool {
+	reason := b.spam.check(msg, clock.Now())
+	if reason == "" {
+		return false
+	}
+	slog.Info("dropping message", "messageId", msg.ID, "user", msg.UserID, "reason", reason)
+	b.health.messagesThrottled.Add(1)
+	return true
+}
+
+// watchBlockList keeps the spam filter's block list in sync with the
+// store.
+func (b *Bot) watchBlockList(ctx context.Context) error {
+	return b.metrics.listen(func() error {
+		return b.blockList.WatchBlockedUsers(ctx, func(blocked []BlockedUser) error {
+			b.spam.setBlocked(blocked)
+			return nil
+		})
+	})
+}
+
+func registerBlockListRoutes(mux *http.ServeMux, b *Bot) {
+	mux.HandleFunc("GET /admin/blocked", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, b.spam.blockedUsers())
+	})
+
+	// The user ID is the one on the audience's messages: in anonymous mode,
+	// the pseudonym.
+	mux.HandleFunc("PUT /admin/blocked/{user}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		u := BlockedUser{UserID: r.PathValue("user"), Reason: body.Reason, BlockedAt: clock.Now()}
+		if err := b.blockList.BlockUser(r.Context(), u); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, u)
+	})
+
+	mux.HandleFunc("DELETE /admin/blocked/{user}", func(w http.ResponseWriter, r *http.Request) {
+		if err := b.blockList.UnblockUser(r.Context(), r.PathValue("user")); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpamFilter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	cfg := RateLimitConfig{PerMinute: 6, Burst: 2, DuplicateWindow: Duration{time.Minute}}
+
+	type send struct {
+		at   time.Duration
+		msg  Message
+		want string
+	}
+	tests := []struct {
+		name  string
+		cfg   RateLimitConfig
+		sends []send
+	}{
+		{"burst then refill", cfg, []send{
+			{0, Message{UserID: "ann", Message: "one"}, ""},
+			{time.Second, Message{UserID: "ann", Message: "two"}, ""},
+			{2 * time.Second, Message{UserID: "ann", Message: "three"}, spamRateLimited},
+			{2 * time.Second, Message{UserID: "bob", Message: "three"}, ""},
+			{12 * time.Second, Message{UserID: "ann", Message: "four"}, ""},
+		}},
+		{"duplicates within the window", cfg, []send{
+			{0, Message{UserID: "ann", Message: "What is Gemini?"}, ""},
+			{20 * time.Second, Message{UserID: "ann", Message: "what is GEMINI"}, spamDuplicate},
+			{20 * time.Second, Message{UserID: "bob", Message: "What is Gemini?"}, ""},
+			{time.Minute, Message{UserID: "ann", Message: "What is Gemini?"}, ""},
+		}},
+		{"signed-out senders by session", cfg, []send{
+			{0, Message{SessionID: "s1", Message: "one"}, ""},
+			{0, Message{SessionID: "s1", Message: "two"}, ""},
+			{0, Message{SessionID: "s1", Message: "three"}, spamRateLimited},
+			{0, Message{SessionID: "s2", Message: "three"}, ""},
+			{0, Message{Message: "anonymous"}, ""},
+			{0, Message{Message: "anonymous"}, ""},
+			{0, Message{Message: "anonymous"}, ""},
+		}},
+		{"checks off", RateLimitConfig{PerMinute: -1, DuplicateWindow: Duration{-1}}, []send{
+			{0, Message{UserID: "ann", Message: "again"}, ""},
+			{0, Message{UserID: "ann", Message: "again"}, ""},
+			{0, Message{UserID: "ann", Message: "again"}, ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSpamFilter(tt.cfg)
+			for i, s := range tt.sends {
+				if got := f.check(&s.msg, start.Add(s.at)); got != s.want {
+					t.Errorf("send %d (%q) = %q, want %q", i, s.msg.Message, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBlockList(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(nil))
+	b.cfg.AdminToken = "s3cret"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watching := make(chan error, 1)
+	go func() { watching <- b.watchBlockList(ctx) }()
+
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	do := func(method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := do(http.MethodPut, "/admin/blocked/troll", `{"reason": "flooding"}`); code != http.StatusOK {
+		t.Fatalf("PUT /admin/blocked/troll = %d", code)
+	}
+	waitFor(t, watching, "the block list", func() bool { return len(b.spam.blockedUsers()) == 1 })
+	if !b.filterSpam(&Message{ID: "m1", UserID: "troll", Message: "hi"}) {
+		t.Error("message from a blocked user was let through")
+	}
+	if b.filterSpam(&Message{ID: "m2", UserID: "ann", Message: "hi"}) {
+		t.Error("message from ann was dropped")
+	}
+
+	if code := do(http.MethodDelete, "/admin/blocked/troll", ""); code != http.StatusNoContent {
+		t.Fatalf("DELETE /admin/blocked/troll = %d", code)
+	}
+	waitFor(t, watching, "the unblock", func() bool { return len(b.spam.blockedUsers()) == 0 })
+	if b.filterSpam(&Message{ID: "m3", UserID: "troll", Message: "sorry"}) {
+		t.Error("message from an unblocked user was dropped")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/api/texttospeech/v1"
+)
+
+// SpeechConfig has host replies read out over the venue's PA. Each
+// published reply is synthesized with Cloud Text-to-Speech in the language
+// it was written in, uploaded to Bucket (polls.imageBucket if unset) and
+// its URL stored on the reply as audioUrl. Voices picks the voice by
+// language; a language without one is read by the default voice for its
+// language code.
+type SpeechConfig struct {
+	Enabled      bool              `json:"enabled" yaml:"enabled"`
+	Bucket       string            `json:"bucket" yaml:"bucket"`
+	Voices       map[string]string `json:"voices" yaml:"voices"`
+	SpeakingRate float64           `json:"speakingRate" yaml:"speakingRate"`
+}
+
+// speechLanguageCodes are the Text-to-Speech language codes replies are
+// read in, by reply language. Hinglish is written in the Latin alphabet,
+// which the Indian English voices read best.
+var speechLanguageCodes = map[string]string{
+	"english":   "en-IN",
+	"hindi":     "hi-IN",
+	"marathi":   "mr-IN",
+	"hinglish":  "en-IN",
+	"tamil":     "ta-IN",
+	"telugu":    "te-IN",
+	"kannada":   "kn-IN",
+	"malayalam": "ml-IN",
+	"bengali":   "bn-IN",
+	"gujarati":  "gu-IN",
+	"punjabi":   "pa-IN",
+}
+
+// Synthesizer turns text into speech.
+type Synthesizer interface {
+	// Synthesize reads text in languageCode, with voice if set, and
+	// returns it as MP3 audio.
+	Synthesize(ctx context.Context, text, languageCode, voice string) ([]byte, error)
+}
+
+// cloudSpeech synthesizes speech with Cloud Text-to-Speech.
+type cloudSpeech struct {
+	service *texttospeech.Service
+	rate    float64
+}
+
+func newCloudSpeech(ctx context.Context, cfg *Config) (*cloudSpeech, error) {
+	service, err := texttospeech.NewService(ctx, googleClientOptions(cfg)...)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Text-to-Speech: %w", err)
+	}
+	return &cloudSpeech{service: service, rate: cfg.Speech.SpeakingRate}, nil
+}
+
+func (s *cloudSpeech) Synthesize(ctx context.Context, text, languageCode, voice string) ([]byte, error) {
+	resp, err := s.service.Text.Synthesize(&texttospeech.SynthesizeSpeechRequest{
+		Input:       &texttospeech.SynthesisInput{Text: text},
+		Voice:       &texttospeech.VoiceSelectionParams{LanguageCode: languageCode, Name: voice},
+		AudioConfig: &texttospeech.AudioConfig{AudioEncoding: "MP3", SpeakingRate: s.rate},
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.AudioContent)
+}
+
+// speakReplies reads out every published host reply and stores the URL
+// of the audio on it. Replies are spoken after they are published, so a
+// slow synthesis never holds up the text.
+func (b *Bot) speakReplies(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-b.speechEvents:
+			if err := b.speakReply(ctx, e); err != nil {
+				b.metrics.spokenReplies.inc("failed")
+				slog.Error("error reading out reply", "messageId", e.MessageID, "err", err)
+				continue
+			}
+			b.metrics.spokenReplies.inc("spoken")
+		}
+	}
+}
+
+// speakReply synthesizes the reply e published, uploads the audio and
+// sets its URL on the reply.
+func (b *Bot) speakReply(ctx context.Context, e Event) error {
+	language := e.Language
+	if language == "" {
+		language = b.sessionLanguage()
+	}
+	audio, err := b.speech.Synthesize(ctx, e.Text, speechLanguageCodes[language], b.cfg.Speech.Voices[language])
+	if err != nil {
+		return fmt.Errorf("error synthesizing speech: %w", err)
+	}
+	audioURL, err := b.audio.PutImage(ctx, fmt.Sprintf("speech/%s.mp3", e.MessageID), "audio/mpeg", audio)
+	if err != nil {
+		return fmt.Errorf("error uploading audio: %w", err)
+	}
+	return b.write(ctx, "set-reply-audio", func(ctx context.Context) error {
+		return b.messages.SetReplyAudio(ctx, e.MessageID, audioURL)
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// synthesizerFunc adapts a function to Synthesizer.
+type synthesizerFunc func(ctx context.Context, text, languageCode, voice string) ([]byte, error)
+
+func (f synthesizerFunc) Synthesize(ctx context.Context, text, languageCode, voice string) ([]byte, error) {
+	return f(ctx, text, languageCode, voice)
+}
+
+func TestSpeakReplies(t *testing.T) {
+	var mu sync.Mutex
+	var spoken []string
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "Namaste!", nil
+	}))
+	b.cfg.Speech.Voices = map[string]string{"hindi": "hi-IN-Wavenet-A"}
+	b.speech = synthesizerFunc(func(ctx context.Context, text, languageCode, voice string) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		spoken = append(spoken, text+"|"+languageCode+"|"+voice)
+		if text == "broken" {
+			return nil, errors.New("quota exceeded")
+		}
+		return []byte("ID3" + text), nil
+	})
+	b.audio = store
+	b.speechEvents, _ = b.bus.Subscribe(EventResponsePublished)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.speakReplies(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	for _, reply := range []Message{
+		{ID: "r1", Message: "नमस्ते!", Language: "hindi"},
+		{ID: "r2", Message: "broken", Language: "english"},
+		{ID: "r3", Message: "Welcome back!"},
+	} {
+		if err := b.publishReply(ctx, reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, nil, "the replies to be read out", func() bool {
+		spoken := b.metrics.spokenReplies.snapshot()
+		return spoken["spoken"]+spoken["failed"] == 3
+	})
+
+	r1, _ := store.Reply("r1")
+	if r1.AudioURL == "" {
+		t.Fatal("r1 has no audio URL")
+	}
+	if audio, ok := store.Image("speech/r1.mp3"); !ok || string(audio) != "ID3नमस्ते!" {
+		t.Errorf("speech/r1.mp3 = %q, %v, want the synthesized reply", audio, ok)
+	}
+	if r2, _ := store.Reply("r2"); r2.AudioURL != "" {
+		t.Errorf("reply that failed to synthesize has audio URL %q", r2.AudioURL)
+	}
+	if r3, _ := store.Reply("r3"); r3.AudioURL == "" {
+		t.Error("r3 has no audio URL")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"नमस्ते!|hi-IN|hi-IN-Wavenet-A", "broken|en-IN|", "Welcome back!|en-IN|"}
+	if len(spoken) != len(want) {
+		t.Fatalf("synthesized %q, want %q", spoken, want)
+	}
+	for i := range want {
+		if spoken[i] != want[i] {
+			t.Errorf("synthesis %d = %q, want %q", i, spoken[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"text/tabwriter"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+)
+
+// sponsorIntroQuestion returns the question of a sponsored quiz session
+// whose intro, crediting the sponsor, the host still owes: the current one,
+// once, before its answers are locked in.
+func sponsorIntroQuestion(session *QuizSession) string {
+	if session.Sponsor == "" || session.Current == "" || session.TieBreaker != nil {
+		return ""
+	}
+	qs, ok := session.Stats[session.Current]
+	if !ok || qs.Closed || slices.Contains(session.Introduced, session.Current) {
+		return ""
+	}
+	return session.Current
+}
+
+// sponsorIntroAnnouncement returns the intro of the current question of a
+// sponsored pack, if due. Each intro is an impression for the sponsor; its
+// Done counts it on the session.
+func sponsorIntroAnnouncement(ref *firestore.DocumentRef, session *QuizSession) *hostAnnouncement {
+	questionID := sponsorIntroQuestion(session)
+	if questionID == "" {
+		return nil
+	}
+	return &hostAnnouncement{
+		Kind: "question-intro",
+		Text: fmt.Sprintf("Introduce the next question, brought to you by %s, and credit them by name: %s", session.Sponsor, session.Stats[questionID].Question),
+		Done: func(ctx context.Context) error {
+			_, err := ref.Update(ctx, []firestore.Update{
+				{Path: "introduced", Value: firestore.ArrayUnion(questionID)},
+				{Path: "impressions", Value: firestore.Increment(1)},
+			})
+			return err
+		},
+	}
+}
+
+// SponsorFulfillment is what one sponsor got out of its trivia packs.
+type SponsorFulfillment struct {
+	Sponsor string
+	Packs   int
+	// Questions counts the questions introduced on their behalf and
+	// Impressions every time the host credited them.
+	Questions   int
+	Impressions int
+	// Players is how many distinct players answered their questions, and
+	// Votes how many answers they gave in all.
+	Players int
+	Votes   int
+}
+
+// sponsorFulfillment totals sessions by sponsor, most impressions first.
+// Sessions without a sponsor are left out.
+func sponsorFulfillment(sessions []QuizSession) []SponsorFulfillment {
+	bySponsor := map[string]*SponsorFulfillment{}
+	players := map[string]map[string]bool{}
+	for _, s := range sessions {
+		if s.Sponsor == "" {
+			continue
+		}
+		f := bySponsor[s.Sponsor]
+		if f == nil {
+			f = &SponsorFulfillment{Sponsor: s.Sponsor}
+			bySponsor[s.Sponsor] = f
+			players[s.Sponsor] = map[string]bool{}
+		}
+		f.Packs++
+		f.Questions += len(s.Introduced)
+		f.Impressions += s.Impressions
+		for _, qs := range s.Stats {
+			f.Votes += qs.TotalVotes
+		}
+		for player := range s.Scores {
+			players[s.Sponsor][player] = true
+		}
+	}
+
+	report := make([]SponsorFulfillment, 0, len(bySponsor))
+	for sponsor, f := range bySponsor {
+		f.Players = len(players[sponsor])
+		report = append(report, *f)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Impressions == report[j].Impressions {
+			return report[i].Sponsor < report[j].Sponsor
+		}
+		return report[i].Impressions > report[j].Impressions
+	})
+	return report
+}
+
+// runSponsorReport prints the fulfillment of every sponsor of a trivia pack
+// in the quiz collection.
+func runSponsorReport(ctx context.Context, w io.Writer, args []string, cfg *Config) error {
+	fs := flag.NewFlagSet("sponsor-report", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := newFirestoreClient(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var sessions []QuizSession
+	iter := client.Collection(cfg.Collections.Quiz).Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error iterating through quiz sessions: %w", err)
+		}
+		var s QuizSession
+		if err := doc.DataTo(&s); err != nil {
+			return fmt.Errorf("error decoding quiz session %s: %w", doc.Ref.ID, err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	report := sponsorFulfillment(sessions)
+	fmt.Fprintf(w, "%d sponsors\n\n", len(report))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SPONSOR\tPACKS\tQUESTIONS\tIMPRESSIONS\tPLAYERS\tVOTES")
+	for _, f := range report {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\n", f.Sponsor, f.Packs, f.Questions, f.Impressions, f.Players, f.Votes)
+	}
+	return tw.Flush()
+}
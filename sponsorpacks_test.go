@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSponsorIntroQuestion(t *testing.T) {
+	open := map[string]QuestionStats{"q1": {Question: "Who?"}}
+	tests := []struct {
+		name    string
+		session QuizSession
+		want    string
+	}{
+		{"not sponsored", QuizSession{Current: "q1", Stats: open}, ""},
+		{"due", QuizSession{Sponsor: "Acme", Current: "q1", Stats: open}, "q1"},
+		{"introduced", QuizSession{Sponsor: "Acme", Current: "q1", Stats: open, Introduced: []string{"q1"}}, ""},
+		{"already closed", QuizSession{Sponsor: "Acme", Current: "q1", Stats: map[string]QuestionStats{"q1": {Closed: true}}}, ""},
+		{"poll missing", QuizSession{Sponsor: "Acme", Current: "q2", Stats: open}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sponsorIntroQuestion(&tt.session); got != tt.want {
+				t.Errorf("sponsorIntroQuestion = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSponsorFulfillment(t *testing.T) {
+	sessions := []QuizSession{
+		{Sponsor: "Acme", Introduced: []string{"q1", "q2"}, Impressions: 2,
+			Stats:  map[string]QuestionStats{"q1": {TotalVotes: 3}, "q2": {TotalVotes: 2}},
+			Scores: map[string]int{"ann": 20, "bob": 0, "cat": 10}},
+		{Sponsor: "Acme", Introduced: []string{"q3"}, Impressions: 1,
+			Stats:  map[string]QuestionStats{"q3": {TotalVotes: 2}},
+			Scores: map[string]int{"ann": 10, "dan": 0}},
+		{Sponsor: "Globex", Introduced: []string{"q4"}, Impressions: 4,
+			Stats:  map[string]QuestionStats{"q4": {TotalVotes: 1}},
+			Scores: map[string]int{"ann": 10}},
+		{Title: "Unsponsored", Impressions: 9, Scores: map[string]int{"eve": 10}},
+	}
+	want := []SponsorFulfillment{
+		{Sponsor: "Globex", Packs: 1, Questions: 1, Impressions: 4, Players: 1, Votes: 1},
+		{Sponsor: "Acme", Packs: 2, Questions: 3, Impressions: 3, Players: 4, Votes: 7},
+	}
+	if got := sponsorFulfillment(sessions); !reflect.DeepEqual(got, want) {
+		t.Errorf("sponsorFulfillment = %+v, want %+v", got, want)
+	}
+}
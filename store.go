@@ -0,0 +1,1284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Store is every store of the bot's state, which firestoreStore and
+// memoryStore implement alike.
+type Store interface {
+	MessageStore
+	PollStore
+	SummaryStore
+	AnnouncementStore
+	FailoverStore
+	BlockListStore
+	CostStore
+	CalendarStore
+	LeaderboardStore
+	FeedbackStore
+	ProfileStore
+	LifelineStore
+	ScheduleStore
+	BotStateStore
+	CatchUpStore
+	CounterStore
+	CheckinStore
+	PrizeStore
+}
+
+// MessageStore holds audience messages and the host's replies to them.
+type MessageStore interface {
+	// Unprocessed lists this instance's unprocessed audience messages.
+	Unprocessed(ctx context.Context) ([]*Message, error)
+	// Watch calls fn with every batch of unprocessed messages as they
+	// arrive, starting with those already waiting, until ctx is done or fn
+	// or the underlying stream fails. A batch may be empty.
+	Watch(ctx context.Context, fn func(batch []*Message) error) error
+	// Claim leases an unprocessed audience message to owner for lease,
+	// reporting false if it is processed or another owner's lease on it
+	// has not yet expired. Only the owner of a message should answer it;
+	// claiming it again renews the lease.
+	Claim(ctx context.Context, id, owner string, lease time.Duration) (bool, error)
+	// DeadLetter moves an audience message that keeps failing to the
+	// dead-letter collection, marking the original processed.
+	DeadLetter(ctx context.Context, dl DeadLetter) error
+	// WatchRequeues calls fn with the IDs of dead letters flagged for
+	// requeueing whenever the set changes, until ctx is done or the stream
+	// fails.
+	WatchRequeues(ctx context.Context, fn func(ids []string) error) error
+	// Requeue puts a dead-lettered message back in the queue as unprocessed
+	// and unclaimed, and removes its dead letter.
+	Requeue(ctx context.Context, id string) error
+	// MarkProcessed marks an audience message processed, storing userID in
+	// place of the sender's ID. It fails with errClaimLost if another
+	// owner has claimed the message since.
+	MarkProcessed(ctx context.Context, id, owner, userID string) error
+	// SaveTranscript stores what was said in voice note id as its message.
+	SaveTranscript(ctx context.Context, id, transcript string) error
+	// UserHistory returns up to limit of the user's answered messages,
+	// newest first, each with the host's public reply if there was one.
+	UserHistory(ctx context.Context, userID string, limit int) ([]answeredMessage, error)
+	// WriteReply stores a host message under reply.ID, along with the
+	// conversation summary it was generated from in reply.Context.
+	WriteReply(ctx context.Context, reply Message) error
+	// WritePrivateReply stores a reply only the sender of audience message
+	// reply.ID can see.
+	WritePrivateReply(ctx context.Context, reply Message) error
+	// Submit adds an audience message to the queue, unprocessed.
+	Submit(ctx context.Context, msg Message) error
+	// Enqueue adds a triaged audience message to the response queue,
+	// unprocessed, for the responders.
+	Enqueue(ctx context.Context, msg Message) error
+	// FindReply returns the host's reply to audience message id, public or
+	// private, or nil if there is none yet.
+	FindReply(ctx context.Context, id string) (reply *Message, private bool, err error)
+	// WriteReplyPair stores the two pings of a bilingual host message at
+	// once, each as WriteReply would.
+	WriteReplyPair(ctx context.Context, reply, paired Message) error
+	// SetReplyAudio stores the URL of the host message id read out.
+	SetReplyAudio(ctx context.Context, id, audioURL string) error
+	// SetReplyImage stores the URL of the picture drawn for host message
+	// id.
+	SetReplyImage(ctx context.Context, id, imageURL string) error
+	// RecentReplies returns up to limit public host messages written after
+	// since, newest first.
+	RecentReplies(ctx context.Context, since time.Time, limit int) ([]Message, error)
+	// AppendTranscript adds a host message to the public transcript.
+	AppendTranscript(ctx context.Context, entry TranscriptEntry) error
+	// Transcript returns up to limit transcript entries after the given
+	// time, oldest first.
+	Transcript(ctx context.Context, after time.Time, limit int) ([]TranscriptEntry, error)
+	// Ping checks that the store can be reached.
+	Ping(ctx context.Context) error
+}
+
+// PollStore holds the poll documents the host reports on.
+type PollStore interface {
+	Poll(ctx context.Context, id string) (*PollQuestion, error)
+	// SavePoll writes a new poll document.
+	SavePoll(ctx context.Context, id string, poll PollQuestion) error
+	// RecordIneligible stores the votes a poll's rules excluded.
+	RecordIneligible(ctx context.Context, id string, votes map[string]IneligibleVote) error
+	// ClosePoll sets a poll's closed flag, ending voting.
+	ClosePoll(ctx context.Context, id string) error
+	// MarkResultsAnnounced records that the host announced a poll's results.
+	MarkResultsAnnounced(ctx context.Context, id string) error
+	// SetOptionImage sets the image URL of a poll's option key.
+	SetOptionImage(ctx context.Context, id, key, imageURL string) error
+	// SetPollThemes records the themes found in an open-text poll's
+	// answers.
+	SetPollThemes(ctx context.Context, id string, themes []PollTheme) error
+	// Buzz records userID's buzz on buzzer question id, making them its
+	// owner if nobody buzzed before and there is no fairness window, else
+	// crediting it with latency; see buzzer.go.
+	Buzz(ctx context.Context, id, userID string, latency, window time.Duration) (*BuzzResult, error)
+	// AwardBuzz declares the owner of buzzer question id once its fairness
+	// window has passed, and returns how it was decided, or nil if it
+	// wasn't due.
+	AwardBuzz(ctx context.Context, id string, window time.Duration) (*BuzzArbitration, error)
+	// MarkBuzzAnnounced records that the host announced who buzzed in
+	// first.
+	MarkBuzzAnnounced(ctx context.Context, id string) error
+}
+
+// SummaryStore keeps every version of an instance's conversation summary.
+type SummaryStore interface {
+	// LatestSummary returns the newest version, or nil if there is none.
+	LatestSummary(ctx context.Context) (*SummaryVersion, error)
+	SaveSummary(ctx context.Context, v SummaryVersion) error
+}
+
+// SummaryVersion is one revision of the running conversation summary.
+type SummaryVersion struct {
+	Version int    `firestore:"version"`
+	Summary string `firestore:"summary"`
+	// Turns is how many turns this version folded in.
+	Turns     int       `firestore:"turns"`
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+// firestoreStore implements MessageStore, PollStore, SummaryStore,
+// AnnouncementStore, FailoverStore, BlockListStore, CostStore,
+// CalendarStore, LeaderboardStore, FeedbackStore, ProfileStore,
+// LifelineStore, CounterStore and PrizeStore on the configured Firestore
+// collections.
+type firestoreStore struct {
+	client *firestore.Client
+	cfg    *Config
+}
+
+func newFirestoreStore(client *firestore.Client, cfg *Config) *firestoreStore {
+	return &firestoreStore{client: client, cfg: cfg}
+}
+
+func (s *firestoreStore) Unprocessed(ctx context.Context) ([]*Message, error) {
+	iter := unprocessedMessages(s.client, s.cfg).Documents(ctx)
+	defer iter.Stop()
+
+	var messages []*Message
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return messages, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through unprocessed messages: %w", err)
+		}
+		msg, err := messageFromDoc(doc)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+}
+
+func (s *firestoreStore) Watch(ctx context.Context, fn func(batch []*Message) error) error {
+	it := unprocessedMessages(s.client, s.cfg).Snapshots(ctx)
+	defer it.Stop()
+	for {
+		snap, err := it.Next()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if status.Code(err) == codes.DeadlineExceeded {
+			return fmt.Errorf("snapshot stream timed out: %w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("Snapshots.Next: %w", err)
+		}
+		// Firestore charges a read for each document added or changed.
+		countOps(ctx, len(snap.Changes), 0)
+
+		var batch []*Message
+		for {
+			doc, err := snap.Documents.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("Documents.Next: %w", err)
+			}
+			msg, err := messageFromDoc(doc)
+			if err != nil {
+				return err
+			}
+			batch = append(batch, msg)
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *firestoreStore) Claim(ctx context.Context, id, owner string, lease time.Duration) (bool, error) {
+	ref := s.client.Collection(s.cfg.inbox()).Doc(id)
+	var claimed bool
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var msg Message
+		if err := doc.DataTo(&msg); err != nil {
+			return fmt.Errorf("error converting document to Message: %w", err)
+		}
+		// Leases are timed by the server's clock, which the replicas
+		// share, rather than by their own, which may drift apart.
+		if !claimable(&msg, owner, lease, doc.ReadTime) {
+			return nil
+		}
+		claimed = true
+		return tx.Update(ref, []firestore.Update{
+			{Path: "claimedBy", Value: owner},
+			{Path: "claimedAt", Value: firestore.ServerTimestamp},
+		})
+	})
+	if err != nil {
+		return false, fmt.Errorf("error claiming message %s: %w", id, err)
+	}
+	countOps(ctx, 1, 1)
+	return claimed, nil
+}
+
+// errClaimLost is returned for a message another owner claimed after its
+// lease expired.
+var errClaimLost = errors.New("message claimed by another owner")
+
+// ownsClaim reports whether owner may mark msg processed: it holds the
+// claim, or no one does.
+func ownsClaim(msg *Message, owner string) bool {
+	return msg.ClaimedBy == "" || msg.ClaimedBy == owner
+}
+
+// claimable reports whether owner may claim msg at now.
+func claimable(msg *Message, owner string, lease time.Duration, now time.Time) bool {
+	if msg.Processed {
+		return false
+	}
+	return msg.ClaimedBy == "" || msg.ClaimedBy == owner || now.Sub(msg.ClaimedAt) >= lease
+}
+
+func (s *firestoreStore) DeadLetter(ctx context.Context, dl DeadLetter) error {
+	countOps(ctx, 0, 2)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Set(s.client.Collection(s.cfg.Collections.DeadLetter).Doc(dl.ID), dl); err != nil {
+			return err
+		}
+		return tx.Update(s.client.Collection(s.cfg.inbox()).Doc(dl.ID), []firestore.Update{
+			{Path: "processed", Value: true},
+			{Path: "deadLettered", Value: true},
+		})
+	})
+}
+
+func (s *firestoreStore) WatchRequeues(ctx context.Context, fn func(ids []string) error) error {
+	it := s.client.Collection(s.cfg.Collections.DeadLetter).Where("requeue", "==", true).Snapshots(ctx)
+	defer it.Stop()
+	for {
+		snap, err := it.Next()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error watching dead letters: %w", err)
+		}
+		refs, err := snap.Documents.GetAll()
+		if err != nil {
+			return fmt.Errorf("error reading dead letters: %w", err)
+		}
+		ids := make([]string, len(refs))
+		for i, doc := range refs {
+			ids[i] = doc.Ref.ID
+		}
+		if err := fn(ids); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *firestoreStore) Requeue(ctx context.Context, id string) error {
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Update(s.client.Collection(s.cfg.inbox()).Doc(id), []firestore.Update{
+			{Path: "processed", Value: false},
+			{Path: "deadLettered", Value: firestore.Delete},
+			{Path: "claimedBy", Value: firestore.Delete},
+			{Path: "claimedAt", Value: firestore.Delete},
+		}); err != nil {
+			return err
+		}
+		return tx.Delete(s.client.Collection(s.cfg.Collections.DeadLetter).Doc(id))
+	})
+}
+
+func (s *firestoreStore) MarkProcessed(ctx context.Context, id, owner, userID string) error {
+	countOps(ctx, 1, 1)
+	ref := s.client.Collection(s.cfg.inbox()).Doc(id)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var msg Message
+		if err := doc.DataTo(&msg); err != nil {
+			return fmt.Errorf("error converting document to Message: %w", err)
+		}
+		if !ownsClaim(&msg, owner) {
+			return errClaimLost
+		}
+		return tx.Update(ref, []firestore.Update{
+			{Path: "processed", Value: true},
+			{Path: "userId", Value: userID},
+		})
+	})
+}
+
+func (s *firestoreStore) SaveTranscript(ctx context.Context, id, transcript string) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.inbox()).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "message", Value: transcript},
+	})
+	return err
+}
+
+func (s *firestoreStore) UserHistory(ctx context.Context, userID string, limit int) ([]answeredMessage, error) {
+	docs, err := s.client.Collection(s.cfg.Collections.User).
+		Where("userId", "==", userID).
+		Where("processed", "==", true).
+		OrderBy("timestamp", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user history: %w", err)
+	}
+	// A query that matches nothing is still charged a read.
+	countOps(ctx, max(len(docs), 1), 0)
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	refs := make([]*firestore.DocumentRef, len(docs))
+	for i, doc := range docs {
+		refs[i] = s.client.Collection(s.cfg.Collections.Ping).Doc(doc.Ref.ID)
+	}
+	replies, err := s.client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching replies: %w", err)
+	}
+	countOps(ctx, len(refs), 0)
+
+	history := make([]answeredMessage, len(docs))
+	for i, doc := range docs {
+		history[i].ID = doc.Ref.ID
+		if err := doc.DataTo(&history[i].Question); err != nil {
+			return nil, fmt.Errorf("error converting document to Message: %w", err)
+		}
+		if replies[i].Exists() {
+			if err := replies[i].DataTo(&history[i].Response); err != nil {
+				return nil, fmt.Errorf("error converting document to Message: %w", err)
+			}
+		}
+	}
+	return history, nil
+}
+
+func (s *firestoreStore) WriteReply(ctx context.Context, reply Message) error {
+	reply.Timestamp, reply.Processed = clock.Now(), false
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Ping).Doc(reply.ID).Set(ctx, reply)
+	return err
+}
+
+func (s *firestoreStore) WriteReplyPair(ctx context.Context, reply, paired Message) error {
+	now := clock.Now()
+	countOps(ctx, 0, 2)
+	pings := s.client.Collection(s.cfg.Collections.Ping)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		for _, m := range []Message{reply, paired} {
+			m.Timestamp, m.Processed = now, false
+			if err := tx.Set(pings.Doc(m.ID), m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *firestoreStore) WritePrivateReply(ctx context.Context, reply Message) error {
+	reply.Timestamp, reply.Processed = clock.Now(), false
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.PrivateReplies).Doc(reply.ID).Set(ctx, reply)
+	return err
+}
+
+func (s *firestoreStore) Submit(ctx context.Context, msg Message) error {
+	msg.Processed = false
+	_, err := s.client.Collection(s.cfg.Collections.User).Doc(msg.ID).Set(ctx, msg)
+	return err
+}
+
+func (s *firestoreStore) Enqueue(ctx context.Context, msg Message) error {
+	msg.Processed = false
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Queue).Doc(msg.ID).Set(ctx, msg)
+	return err
+}
+
+func (s *firestoreStore) FindReply(ctx context.Context, id string) (*Message, bool, error) {
+	for _, c := range []struct {
+		collection string
+		private    bool
+	}{{s.cfg.Collections.Ping, false}, {s.cfg.Collections.PrivateReplies, true}} {
+		doc, err := s.client.Collection(c.collection).Doc(id).Get(ctx)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		var reply Message
+		if err := doc.DataTo(&reply); err != nil {
+			return nil, false, fmt.Errorf("error decoding reply %s: %w", id, err)
+		}
+		return &reply, c.private, nil
+	}
+	return nil, false, nil
+}
+
+func (s *firestoreStore) SetReplyAudio(ctx context.Context, id, audioURL string) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Ping).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "audioUrl", Value: audioURL},
+	})
+	return err
+}
+
+func (s *firestoreStore) SetReplyImage(ctx context.Context, id, imageURL string) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Ping).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "imageUrl", Value: imageURL},
+	})
+	return err
+}
+
+func (s *firestoreStore) RecentReplies(ctx context.Context, since time.Time, limit int) ([]Message, error) {
+	docs, err := s.client.Collection(s.cfg.Collections.Ping).
+		Where("timestamp", ">", since).
+		OrderBy("timestamp", firestore.Desc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading replies: %w", err)
+	}
+	replies := make([]Message, 0, len(docs))
+	for _, doc := range docs {
+		var reply Message
+		if err := doc.DataTo(&reply); err != nil {
+			return nil, fmt.Errorf("error decoding reply %s: %w", doc.Ref.ID, err)
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+func (s *firestoreStore) AppendTranscript(ctx context.Context, entry TranscriptEntry) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Transcript).Doc(entry.ID).Set(ctx, entry)
+	return err
+}
+
+func (s *firestoreStore) Transcript(ctx context.Context, after time.Time, limit int) ([]TranscriptEntry, error) {
+	docs, err := s.client.Collection(s.cfg.Collections.Transcript).
+		Where("at", ">", after).
+		OrderBy("at", firestore.Asc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading transcript: %w", err)
+	}
+	entries := make([]TranscriptEntry, 0, len(docs))
+	for _, doc := range docs {
+		var e TranscriptEntry
+		if err := doc.DataTo(&e); err != nil {
+			return nil, fmt.Errorf("error decoding transcript entry %s: %w", doc.Ref.ID, err)
+		}
+		e.ID = doc.Ref.ID
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Ping reads at most one document of the inbox.
+func (s *firestoreStore) Ping(ctx context.Context) error {
+	_, err := s.client.Collection(s.cfg.inbox()).Limit(1).Documents(ctx).GetAll()
+	return err
+}
+
+func (s *firestoreStore) SaveAnnouncement(ctx context.Context, a ScheduledAnnouncement) error {
+	_, err := s.client.Collection(s.cfg.Collections.Announcements).Doc(a.ID).Set(ctx, a)
+	return err
+}
+
+// pendingAnnouncements are sorted here rather than by the query, which
+// would need a composite index.
+func (s *firestoreStore) pendingAnnouncements() firestore.Query {
+	return s.client.Collection(s.cfg.Collections.Announcements).Where("status", "==", announcementPending)
+}
+
+func (s *firestoreStore) Announcements(ctx context.Context) ([]ScheduledAnnouncement, error) {
+	docs, err := s.pendingAnnouncements().Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading announcements: %w", err)
+	}
+	return decodeAnnouncements(docs)
+}
+
+func (s *firestoreStore) UpdateAnnouncement(ctx context.Context, id string, fn func(a *ScheduledAnnouncement) error) (*ScheduledAnnouncement, error) {
+	ref := s.client.Collection(s.cfg.Collections.Announcements).Doc(id)
+	var a ScheduledAnnouncement
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errAnnouncementNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&a); err != nil {
+			return fmt.Errorf("error decoding announcement %s: %w", id, err)
+		}
+		if err := fn(&a); err != nil {
+			return err
+		}
+		return tx.Set(ref, a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *firestoreStore) WatchAnnouncements(ctx context.Context, fn func(pending []ScheduledAnnouncement) error) error {
+	it := s.pendingAnnouncements().Snapshots(ctx)
+	defer it.Stop()
+	for {
+		snap, err := it.Next()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error watching announcements: %w", err)
+		}
+		docs, err := snap.Documents.GetAll()
+		if err != nil {
+			return fmt.Errorf("error reading announcements: %w", err)
+		}
+		pending, err := decodeAnnouncements(docs)
+		if err != nil {
+			return err
+		}
+		if err := fn(pending); err != nil {
+			return err
+		}
+	}
+}
+
+func decodeAnnouncements(docs []*firestore.DocumentSnapshot) ([]ScheduledAnnouncement, error) {
+	out := make([]ScheduledAnnouncement, 0, len(docs))
+	for _, doc := range docs {
+		var a ScheduledAnnouncement
+		if err := doc.DataTo(&a); err != nil {
+			return nil, fmt.Errorf("error decoding announcement %s: %w", doc.Ref.ID, err)
+		}
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].At.Before(out[j].At) })
+	return out, nil
+}
+
+func (s *firestoreStore) SaveCostReport(ctx context.Context, r CostReport) error {
+	_, err := s.client.Collection(s.cfg.Collections.CostReports).Doc(r.ID).Set(ctx, r)
+	return err
+}
+
+// failoverDoc is the single failover document.
+func (s *firestoreStore) failoverDoc() *firestore.DocumentRef {
+	return s.client.Collection(s.cfg.Collections.Failover).Doc("active")
+}
+
+func (s *firestoreStore) Failover(ctx context.Context) (*FailoverState, error) {
+	doc, err := s.failoverDoc().Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading failover state: %w", err)
+	}
+	var state FailoverState
+	if err := doc.DataTo(&state); err != nil {
+		return nil, fmt.Errorf("error decoding failover state: %w", err)
+	}
+	return &state, nil
+}
+
+func (s *firestoreStore) UpdateFailover(ctx context.Context, fn func(s *FailoverState) error) error {
+	ref := s.failoverDoc()
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var state FailoverState
+		doc, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			if err := doc.DataTo(&state); err != nil {
+				return fmt.Errorf("error decoding failover state: %w", err)
+			}
+		}
+		if err := fn(&state); err != nil {
+			return err
+		}
+		return tx.Set(ref, state)
+	})
+}
+
+func (s *firestoreStore) BlockUser(ctx context.Context, u BlockedUser) error {
+	_, err := s.client.Collection(s.cfg.Collections.BlockedUsers).Doc(u.UserID).Set(ctx, u)
+	return err
+}
+
+func (s *firestoreStore) UnblockUser(ctx context.Context, userID string) error {
+	_, err := s.client.Collection(s.cfg.Collections.BlockedUsers).Doc(userID).Delete(ctx)
+	return err
+}
+
+func (s *firestoreStore) WatchBlockedUsers(ctx context.Context, fn func(blocked []BlockedUser) error) error {
+	it := s.client.Collection(s.cfg.Collections.BlockedUsers).Snapshots(ctx)
+	defer it.Stop()
+	for {
+		snap, err := it.Next()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error watching blocked users: %w", err)
+		}
+		docs, err := snap.Documents.GetAll()
+		if err != nil {
+			return fmt.Errorf("error reading blocked users: %w", err)
+		}
+		blocked := make([]BlockedUser, 0, len(docs))
+		for _, doc := range docs {
+			var u BlockedUser
+			if err := doc.DataTo(&u); err != nil {
+				return fmt.Errorf("error decoding blocked user %s: %w", doc.Ref.ID, err)
+			}
+			u.UserID = doc.Ref.ID
+			blocked = append(blocked, u)
+		}
+		if err := fn(blocked); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *firestoreStore) WatchCalendar(ctx context.Context, fn func(days []ContentDay) error) error {
+	it := s.client.Collection(s.cfg.Collections.Calendar).Snapshots(ctx)
+	defer it.Stop()
+	for {
+		snap, err := it.Next()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error watching the calendar: %w", err)
+		}
+		docs, err := snap.Documents.GetAll()
+		if err != nil {
+			return fmt.Errorf("error reading the calendar: %w", err)
+		}
+		days := make([]ContentDay, 0, len(docs))
+		for _, doc := range docs {
+			var d ContentDay
+			if err := doc.DataTo(&d); err != nil {
+				return fmt.Errorf("error decoding calendar day %s: %w", doc.Ref.ID, err)
+			}
+			d.ID = doc.Ref.ID
+			days = append(days, d)
+		}
+		if err := fn(days); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *firestoreStore) SetQuizActive(ctx context.Context, id string, active bool) error {
+	_, err := s.client.Collection(s.cfg.Collections.Quiz).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "active", Value: active},
+	})
+	return err
+}
+
+func (s *firestoreStore) RecordQuizScores(ctx context.Context, quizID string, entries []LeaderboardEntry) error {
+	col := s.client.Collection(s.cfg.Collections.Leaderboard)
+	refs := make([]*firestore.DocumentRef, len(entries))
+	for i, e := range entries {
+		refs[i] = col.Doc(e.UserID)
+	}
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snaps, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		for i, snap := range snaps {
+			var cur LeaderboardEntry
+			if snap.Exists() {
+				if err := snap.DataTo(&cur); err != nil {
+					return err
+				}
+			}
+			if cur.Quizzes == nil {
+				cur.Quizzes = map[string]int{}
+			}
+			cur.Quizzes[quizID] = entries[i].Points
+			cur.Points = cur.Wagers
+			for _, points := range cur.Quizzes {
+				cur.Points += points
+			}
+			if entries[i].DisplayName != "" {
+				cur.DisplayName = entries[i].DisplayName
+			}
+			cur.UpdatedAt = clock.Now()
+			if err := tx.Set(refs[i], cur); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *firestoreStore) SettleWagers(ctx context.Context, pollID string, outcome []string, anon idMapper) ([]WagerResult, error) {
+	pollRef := s.client.Collection(s.cfg.Collections.Poll).Doc(pollID)
+	col := s.client.Collection(s.cfg.Collections.Leaderboard)
+
+	var results []WagerResult
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(pollRef)
+		if err != nil {
+			return err
+		}
+		var poll PollQuestion
+		if err := snap.DataTo(&poll); err != nil {
+			return err
+		}
+		if poll.WagersSettled {
+			results = poll.WagerResults
+			return nil
+		}
+		// The wagers are read with the poll, so one placed after the
+		// tally is settled too rather than lost. The tally has mapped
+		// nearly all of their users already, so anon rarely writes.
+		wagers, err := anonymizeWagers(poll.Wagers, anon)
+		if err != nil {
+			return err
+		}
+		users := make([]string, 0, len(wagers))
+		for user := range wagers {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+		refs := make([]*firestore.DocumentRef, len(users))
+		for i, user := range users {
+			refs[i] = col.Doc(user)
+		}
+		snaps, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		players := map[string]LeaderboardEntry{}
+		for i, snap := range snaps {
+			var cur LeaderboardEntry
+			if snap.Exists() {
+				if err := snap.DataTo(&cur); err != nil {
+					return err
+				}
+			}
+			players[users[i]] = cur
+		}
+
+		results = settleWagers(wagers, poll.Options, outcome, players)
+		for _, r := range results {
+			if r.Net == 0 {
+				continue
+			}
+			cur := players[r.UserID]
+			cur.Wagers += r.Net
+			cur.Points += r.Net
+			cur.UpdatedAt = clock.Now()
+			if err := tx.Set(col.Doc(r.UserID), cur); err != nil {
+				return err
+			}
+		}
+		return tx.Update(pollRef, []firestore.Update{
+			{Path: "wagersSettled", Value: true},
+			{Path: "wagerResults", Value: results},
+		})
+	})
+	return results, err
+}
+
+func (s *firestoreStore) Leaderboard(ctx context.Context, n int) ([]LeaderboardEntry, error) {
+	docs, err := s.client.Collection(s.cfg.Collections.Leaderboard).OrderBy("points", firestore.Desc).Limit(n).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the leaderboard: %w", err)
+	}
+	top := make([]LeaderboardEntry, 0, len(docs))
+	for _, doc := range docs {
+		var e LeaderboardEntry
+		if err := doc.DataTo(&e); err != nil {
+			return nil, fmt.Errorf("error decoding leaderboard entry %s: %w", doc.Ref.ID, err)
+		}
+		e.UserID = doc.Ref.ID
+		top = append(top, e)
+	}
+	return top, nil
+}
+
+func (s *firestoreStore) VariantReplies(ctx context.Context) ([]*Message, error) {
+	docs, err := s.client.Collection(s.cfg.Collections.Ping).Where("variant", "!=", "").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching replies with a prompt variant: %w", err)
+	}
+	replies := make([]*Message, 0, len(docs))
+	for _, doc := range docs {
+		var m Message
+		if err := doc.DataTo(&m); err != nil {
+			return nil, fmt.Errorf("error decoding reply %s: %w", doc.Ref.ID, err)
+		}
+		replies = append(replies, &m)
+	}
+	return replies, nil
+}
+
+func (s *firestoreStore) SaveFeedback(ctx context.Context, r FeedbackReport) error {
+	_, err := s.client.Collection(s.cfg.Collections.Feedback).Doc(r.ID).Set(ctx, r)
+	return err
+}
+
+func (s *firestoreStore) Feedback(ctx context.Context) ([]FeedbackReport, error) {
+	docs, err := s.client.Collection(s.cfg.Collections.Feedback).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching reply feedback: %w", err)
+	}
+	reports := make([]FeedbackReport, 0, len(docs))
+	for _, doc := range docs {
+		var r FeedbackReport
+		if err := doc.DataTo(&r); err != nil {
+			return nil, fmt.Errorf("error decoding feedback report %s: %w", doc.Ref.ID, err)
+		}
+		r.ID = doc.Ref.ID
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+func (s *firestoreStore) Profiles(ctx context.Context, ids []string) ([]*Profile, error) {
+	col := s.client.Collection(s.cfg.Collections.Profiles)
+	refs := make([]*firestore.DocumentRef, len(ids))
+	for i, id := range ids {
+		refs[i] = col.Doc(id)
+	}
+	snaps, err := s.client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching profiles: %w", err)
+	}
+	profiles := make([]*Profile, len(snaps))
+	for i, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		var p Profile
+		if err := snap.DataTo(&p); err != nil {
+			return nil, fmt.Errorf("error decoding profile %s: %w", snap.Ref.ID, err)
+		}
+		profiles[i] = &p
+	}
+	return profiles, nil
+}
+
+func (s *firestoreStore) SetNickname(ctx context.Context, id, nickname string) error {
+	_, err := s.client.Collection(s.cfg.Collections.Profiles).Doc(id).Set(ctx, map[string]any{"nickname": nickname}, firestore.MergeAll)
+	return err
+}
+
+func (s *firestoreStore) SaveCheckin(ctx context.Context, key string, c Checkin) error {
+	_, err := s.client.Collection(s.cfg.Collections.Checkins).Doc(key).Set(ctx, c)
+	return err
+}
+
+func (s *firestoreStore) SavePrize(ctx context.Context, id string, p Prize) error {
+	_, err := s.client.Collection(s.cfg.Collections.Prizes).Doc(id).Set(ctx, p)
+	return err
+}
+
+func (s *firestoreStore) ClaimPrize(ctx context.Context, id, staff string) (*Prize, error) {
+	ref := s.client.Collection(s.cfg.Collections.Prizes).Doc(id)
+	var prize Prize
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return errPrizeNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := snap.DataTo(&prize); err != nil {
+			return fmt.Errorf("error decoding prize %s: %w", id, err)
+		}
+		if prize.Status == prizeClaimed {
+			return errPrizeClaimed
+		}
+		prize.Status = prizeClaimed
+		prize.ClaimedAt = clock.Now()
+		prize.HandedOverBy = staff
+		return tx.Set(ref, prize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &prize, nil
+}
+
+func (s *firestoreStore) Prizes(ctx context.Context, state string) ([]prizeWithID, error) {
+	q := s.client.Collection(s.cfg.Collections.Prizes).OrderBy("awardedAt", firestore.Asc)
+	if state != "" {
+		q = s.client.Collection(s.cfg.Collections.Prizes).Where("status", "==", state).OrderBy("awardedAt", firestore.Asc)
+	}
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+
+	prizes := []prizeWithID{}
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			return prizes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error iterating through prizes: %w", err)
+		}
+		p := prizeWithID{ID: doc.Ref.ID}
+		if err := doc.DataTo(&p.Prize); err != nil {
+			return nil, fmt.Errorf("error converting document to Prize: %w", err)
+		}
+		prizes = append(prizes, p)
+	}
+}
+
+func (s *firestoreStore) UseLifeline(ctx context.Context, user, lifeline string) (bool, error) {
+	_, err := s.client.Collection(s.cfg.Collections.Lifelines).Doc(user+"-"+lifeline).Create(ctx, map[string]any{
+		"user":     user,
+		"lifeline": lifeline,
+		"usedAt":   clock.Now(),
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *firestoreStore) Schedule(ctx context.Context) (*SessionSchedule, error) {
+	doc, err := s.client.Collection(s.cfg.Collections.Schedule).Doc("live").Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sched SessionSchedule
+	if err := doc.DataTo(&sched); err != nil {
+		return nil, fmt.Errorf("error decoding the session schedule: %w", err)
+	}
+	return &sched, nil
+}
+
+func (s *firestoreStore) SaveSchedule(ctx context.Context, sched SessionSchedule) error {
+	_, err := s.client.Collection(s.cfg.Collections.Schedule).Doc("live").Set(ctx, sched)
+	return err
+}
+
+func (s *firestoreStore) MessagesBetween(ctx context.Context, from, to time.Time, limit int) ([]*Message, error) {
+	docs, err := s.client.Collection(s.cfg.inbox()).
+		Where("timestamp", ">=", from).
+		Where("timestamp", "<", to).
+		OrderBy("timestamp", firestore.Asc).
+		Limit(limit).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading messages: %w", err)
+	}
+	countOps(ctx, len(docs), 0)
+	messages := make([]*Message, 0, len(docs))
+	for _, doc := range docs {
+		msg, err := messageFromDoc(doc)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func (s *firestoreStore) CatchUp(ctx context.Context, id string) (*Message, error) {
+	doc, err := s.client.Collection(s.cfg.Collections.CatchUp).Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var reply Message
+	if err := doc.DataTo(&reply); err != nil {
+		return nil, fmt.Errorf("error decoding catch-up answer %s: %w", id, err)
+	}
+	return &reply, nil
+}
+
+func (s *firestoreStore) WriteCatchUp(ctx context.Context, reply Message) error {
+	reply.Timestamp, reply.Processed = clock.Now(), false
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.CatchUp).Doc(reply.ID).Set(ctx, reply)
+	return err
+}
+
+func (s *firestoreStore) BotState(ctx context.Context) (*BotState, error) {
+	doc, err := s.botStateDoc().Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state BotState
+	if err := doc.DataTo(&state); err != nil {
+		return nil, fmt.Errorf("error decoding the bot state: %w", err)
+	}
+	return &state, nil
+}
+
+func (s *firestoreStore) SaveBotState(ctx context.Context, state BotState) error {
+	_, err := s.botStateDoc().Set(ctx, state)
+	return err
+}
+
+func (s *firestoreStore) AddCounts(ctx context.Context, doc string, shard int, deltas map[string]int64) error {
+	fields := make(map[string]any, len(deltas))
+	for field, n := range deltas {
+		fields[field] = firestore.Increment(n)
+	}
+	countOps(ctx, 0, 1)
+	_, err := s.counterShards(doc).Doc(strconv.Itoa(shard)).Set(ctx, fields, firestore.MergeAll)
+	return err
+}
+
+func (s *firestoreStore) Counts(ctx context.Context, doc string) (map[string]int64, error) {
+	docs, err := s.counterShards(doc).Documents(ctx).GetAll()
+	countOps(ctx, len(docs), 0)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{}
+	for _, d := range docs {
+		for field, v := range d.Data() {
+			if n, ok := v.(int64); ok {
+				counts[field] += n
+			}
+		}
+	}
+	return counts, nil
+}
+
+// counterShards holds the shards of counter document doc.
+func (s *firestoreStore) counterShards(doc string) *firestore.CollectionRef {
+	return s.client.Collection(s.cfg.Collections.Stats).Doc(doc).Collection("shards")
+}
+
+// botStateDoc is this shard's checkpoint.
+func (s *firestoreStore) botStateDoc() *firestore.DocumentRef {
+	return s.client.Collection(s.cfg.Collections.BotState).Doc(fmt.Sprintf("shard-%d", s.cfg.Shards.Index))
+}
+
+// summaryDoc is where this shard's latest summary lives; every version is
+// also kept in its versions subcollection.
+func (s *firestoreStore) summaryDoc() *firestore.DocumentRef {
+	return s.client.Collection(s.cfg.Collections.Summaries).Doc(fmt.Sprintf("shard-%d", s.cfg.Shards.Index))
+}
+
+func (s *firestoreStore) LatestSummary(ctx context.Context) (*SummaryVersion, error) {
+	countOps(ctx, 1, 0)
+	doc, err := s.summaryDoc().Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching summary: %w", err)
+	}
+	var v SummaryVersion
+	if err := doc.DataTo(&v); err != nil {
+		return nil, fmt.Errorf("error converting document to SummaryVersion: %w", err)
+	}
+	return &v, nil
+}
+
+func (s *firestoreStore) SaveSummary(ctx context.Context, v SummaryVersion) error {
+	latest := s.summaryDoc()
+	version := latest.Collection("versions").Doc(fmt.Sprintf("%06d", v.Version))
+	countOps(ctx, 0, 2)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(version, v); err != nil {
+			return err
+		}
+		return tx.Set(latest, v)
+	})
+}
+
+func (s *firestoreStore) Poll(ctx context.Context, id string) (*PollQuestion, error) {
+	countOps(ctx, 1, 0)
+	doc, err := s.client.Collection(s.cfg.Collections.Poll).Doc(id).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching poll document: %w", err)
+	}
+	var poll PollQuestion
+	if err := doc.DataTo(&poll); err != nil {
+		return nil, fmt.Errorf("error converting document to PollQuestion: %w", err)
+	}
+	return &poll, nil
+}
+
+func (s *firestoreStore) SavePoll(ctx context.Context, id string, poll PollQuestion) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Poll).Doc(id).Set(ctx, poll)
+	return err
+}
+
+func (s *firestoreStore) RecordIneligible(ctx context.Context, id string, votes map[string]IneligibleVote) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Poll).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "ineligibleVotes", Value: votes},
+	})
+	return err
+}
+
+func (s *firestoreStore) ClosePoll(ctx context.Context, id string) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Poll).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "closed", Value: true},
+	})
+	return err
+}
+
+func (s *firestoreStore) SetOptionImage(ctx context.Context, id, key, imageURL string) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Poll).Doc(id).Update(ctx, []firestore.Update{
+		{FieldPath: firestore.FieldPath{"options", key, "imageUrl"}, Value: imageURL},
+	})
+	return err
+}
+
+func (s *firestoreStore) SetPollThemes(ctx context.Context, id string, themes []PollTheme) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Poll).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "themes", Value: themes},
+	})
+	return err
+}
+
+func (s *firestoreStore) MarkResultsAnnounced(ctx context.Context, id string) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Poll).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "resultsAnnounced", Value: true},
+	})
+	return err
+}
+
+func (s *firestoreStore) Buzz(ctx context.Context, id, userID string, latency, window time.Duration) (*BuzzResult, error) {
+	ref := s.client.Collection(s.cfg.Collections.Poll).Doc(id)
+	var result *BuzzResult
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var poll PollQuestion
+		if err := snap.DataTo(&poll); err != nil {
+			return err
+		}
+		var buzz *Buzz
+		result, buzz, err = placeBuzz(poll, userID, clock.Now(), latency, window)
+		if err != nil || buzz == nil {
+			return err
+		}
+		// The commit's own timestamp, so the app's clock plays no part.
+		updates := []firestore.Update{{FieldPath: firestore.FieldPath{"buzzes", userID}, Value: map[string]any{"seq": buzz.Seq, "at": firestore.ServerTimestamp, "latencyMs": buzz.LatencyMillis}}}
+		if result.First {
+			updates = append(updates,
+				firestore.Update{Path: "buzzOwner", Value: userID},
+				firestore.Update{Path: "allowedVoters", Value: []string{userID}})
+		}
+		return tx.Update(ref, updates)
+	})
+	countOps(ctx, 1, 1)
+	return result, err
+}
+
+func (s *firestoreStore) AwardBuzz(ctx context.Context, id string, window time.Duration) (*BuzzArbitration, error) {
+	ref := s.client.Collection(s.cfg.Collections.Poll).Doc(id)
+	var a *BuzzArbitration
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		var poll PollQuestion
+		if err := snap.DataTo(&poll); err != nil {
+			return err
+		}
+		if a = arbitrateBuzzes(id, poll, window, clock.Now()); a == nil {
+			return nil
+		}
+		return tx.Update(ref, []firestore.Update{
+			{Path: "buzzOwner", Value: a.Winner},
+			{Path: "allowedVoters", Value: []string{a.Winner}},
+		})
+	})
+	countOps(ctx, 1, 1)
+	return a, err
+}
+
+func (s *firestoreStore) MarkBuzzAnnounced(ctx context.Context, id string) error {
+	countOps(ctx, 0, 1)
+	_, err := s.client.Collection(s.cfg.Collections.Poll).Doc(id).Update(ctx, []firestore.Update{
+		{Path: "buzzAnnounced", Value: true},
+	})
+	return err
+}
+
+// messageFromDoc decodes an audience message, keyed by its document ID.
+func messageFromDoc(doc *firestore.DocumentSnapshot) (*Message, error) {
+	var msg Message
+	if err := doc.DataTo(&msg); err != nil {
+		return nil, fmt.Errorf("error converting document to message: %w", err)
+	}
+	msg.ID = doc.Ref.ID
+	return &msg, nil
+}
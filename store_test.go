@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimable(t *testing.T) {
+	now := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	lease := 2 * time.Minute
+	tests := []struct {
+		name string
+		msg  Message
+		want bool
+	}{
+		{"unclaimed", Message{}, true},
+		{"processed", Message{Processed: true}, false},
+		{"leased to another replica", Message{ClaimedBy: "b", ClaimedAt: now.Add(-time.Minute)}, false},
+		{"lease expired", Message{ClaimedBy: "b", ClaimedAt: now.Add(-lease)}, true},
+		{"already ours", Message{ClaimedBy: "a", ClaimedAt: now}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claimable(&tt.msg, "a", lease, now); got != tt.want {
+				t.Errorf("claimable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// streamHeartbeat is how often an idle event stream sends a comment, so
+// proxies don't close it.
+const streamHeartbeat = 15 * time.Second
+
+// streamEvent is one Server-Sent Event: its event name and JSON data.
+func streamEvent(e Event) (name string, data any, ok bool) {
+	switch e.Kind {
+	case EventResponsePublished:
+		return "response", map[string]any{"id": e.MessageID, "message": e.Text, "question": e.Question, "at": e.At}, true
+	case EventResponsePartial:
+		return "response-partial", map[string]any{"id": e.MessageID, "message": e.Text, "at": e.At}, true
+	case EventPollUpdated:
+		return "poll", map[string]any{"id": e.PollID, "status": e.Text, "at": e.At}, true
+	case EventPollClosed:
+		return "poll-closed", map[string]any{"id": e.PollID, "at": e.At}, true
+	}
+	return "", nil, false
+}
+
+// serveStream streams host messages and poll updates to a client as
+// Server-Sent Events until it disconnects. A client too slow to keep up
+// misses events rather than holding up the bus; it can catch up from the
+// transcript.
+func (b *Bot) serveStream(w http.ResponseWriter, r *http.Request) {
+	events, unsubscribe := b.bus.Subscribe(EventResponsePublished, EventResponsePartial, EventPollUpdated, EventPollClosed)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if status := b.room.getPollStatus(); status != "" {
+		fmt.Fprintf(w, "event: poll\ndata: %s\n\n", mustJSON(map[string]any{"id": b.activePollID(), "status": status}))
+	}
+	rc.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-events:
+			name, data, ok := streamEvent(e)
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, mustJSON(data))
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// mustJSON encodes v, which is always a map of plain values.
+func mustJSON(v any) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamSendsResponses(t *testing.T) {
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	b.cfg.APIKeys = []string{"app-key"}
+	b.room.setPollStatus("Question: Best framework?\n")
+	srv := httptest.NewServer(b.apiHandler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stream?key=app-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("GET /stream = %d %s, want an event stream", resp.StatusCode, ct)
+	}
+
+	b.publishReply(context.Background(), Message{ID: "m1", Message: "Namaskar, devio aur sajjanon!"})
+
+	var names []string
+	lines := bufio.NewScanner(resp.Body)
+	for len(names) < 2 && lines.Scan() {
+		line := lines.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			names = append(names, strings.TrimPrefix(line, "event: "))
+		case strings.HasPrefix(line, "data: ") && names[len(names)-1] == "response" && !strings.Contains(line, "Namaskar"):
+			t.Errorf("response data = %s, want the published message", line)
+		}
+	}
+	if strings.Join(names, ",") != "poll,response" {
+		t.Errorf("events = %v, want the current poll, then the response", names)
+	}
+}
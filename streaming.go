@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// replyStreamer returns the onText callback that shows reply, addressed to
+// an audience message, as the model writes it: every update goes to the
+// event stream, and at most one per Streaming.Interval to the ping
+// document, marked streaming, keeping under Firestore's sustained write
+// rate for a single document. The final publishReply replaces it.
+func (b *Bot) replyStreamer(ctx context.Context, reply Message) func(partial string) {
+	var lastWrite atomicTime
+	var flagged atomic.Bool
+	return func(partial string) {
+		// The final reply is moderated in full; a partial one with a
+		// blocklisted word stops the live text until it arrives.
+		if flagged.Load() || b.moderator.containsBlocked(partial) {
+			flagged.Store(true)
+			return
+		}
+		b.bus.Publish(Event{Kind: EventResponsePartial, MessageID: reply.ID, Text: partial})
+		now := clock.Now()
+		if now.Sub(lastWrite.Load()) < b.cfg.Streaming.Interval.Duration {
+			return
+		}
+		lastWrite.Store(now)
+		partialReply := reply
+		partialReply.Message, partialReply.Streaming = partial, true
+		if err := b.messages.WriteReply(ctx, partialReply); err != nil {
+			loggerFrom(ctx).Error("error writing partial reply", "err", err)
+		}
+	}
+}
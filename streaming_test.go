@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamFunc is a streamingGenerator that sends words one at a time.
+type streamFunc []string
+
+func (f streamFunc) Generate(ctx context.Context, prompt string) (string, error) {
+	return f.GenerateStream(ctx, prompt, nil)
+}
+
+func (f streamFunc) GenerateStream(ctx context.Context, prompt string, onText func(string)) (string, error) {
+	var text strings.Builder
+	for _, w := range f {
+		text.WriteString(w)
+		if onText != nil {
+			onText(text.String())
+		}
+	}
+	return text.String(), nil
+}
+
+func TestStreamedReplyIsWrittenAsItGrows(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, streamFunc{"Gemini ", "is a family ", "of models, dost!"})
+	b.cfg.Streaming.Interval = Duration{time.Hour}
+	partials, unsubscribe := b.bus.Subscribe(EventResponsePartial)
+	defer unsubscribe()
+	ctx := context.Background()
+
+	text, err := b.generateResponse(ctx, "what is Gemini?", "", b.replyStreamer(ctx, Message{ID: "m1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Gemini is a family of models, dost!" {
+		t.Errorf("reply = %q, want the whole completion", text)
+	}
+	for _, want := range []string{"Gemini ", "Gemini is a family ", "Gemini is a family of models, dost!"} {
+		select {
+		case e := <-partials:
+			if e.MessageID != "m1" || e.Text != want {
+				t.Errorf("partial event = %+v, want %q for m1", e, want)
+			}
+		default:
+			t.Fatalf("no partial event for %q", want)
+		}
+	}
+	reply, _, err := store.FindReply(ctx, "m1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Message != "Gemini " || !reply.Streaming {
+		t.Errorf("ping document = %+v, want only the first chunk, marked streaming", reply)
+	}
+
+	if err := b.publishReply(ctx, Message{ID: "m1", Message: text}); err != nil {
+		t.Fatal(err)
+	}
+	if reply, _, _ = store.FindReply(ctx, "m1"); reply.Message != text || reply.Streaming {
+		t.Errorf("published reply = %+v, want the final text, not streaming", reply)
+	}
+}
+
+func TestNonStreamingModelIgnoresOnText(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "Namaste!", nil
+	}))
+	called := false
+	text, err := b.generateResponse(context.Background(), "hi", "", func(string) { called = true })
+	if err != nil || text != "Namaste!" || called {
+		t.Errorf("generateResponse = %q, %v, onText called %v; want the reply without streaming", text, err, called)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+	// A worker that ran this long before failing starts over at the minimum
+	// backoff instead of continuing to back off.
+	healthyRunTime = 5 * time.Minute
+	// restartJitter is the share by which a restart's wait is stretched or
+	// shrunk at random.
+	restartJitter = 0.2
+)
+
+// supervisor restarts a bot's workers and counts how often it had to.
+type supervisor struct {
+	mu       sync.Mutex
+	restarts map[string]int
+}
+
+func newSupervisor() *supervisor {
+	return &supervisor{restarts: map[string]int{}}
+}
+
+// supervise runs fn until ctx is cancelled, restarting it with jittered
+// exponential backoff whenever it returns or panics. Supervised workers are
+// meant to run for the life of ctx, so even a nil return while ctx is live
+// is treated as a failure rather than letting the worker silently
+// disappear.
+func (s *supervisor) supervise(ctx context.Context, name string, fn func(ctx context.Context) error) {
+	var backoff time.Duration
+	for {
+		start := clock.Now()
+		err := runRecovered(ctx, fn)
+		if ctx.Err() != nil {
+			slog.Info("worker stopped", "worker", name)
+			return
+		}
+		if err == nil {
+			err = errors.New("exited unexpectedly")
+		}
+
+		var wait time.Duration
+		wait, backoff = restartBackoff(backoff, clock.Now().Sub(start))
+		slog.Error("worker failed, restarting", "worker", name, "wait", wait.Round(time.Millisecond), "err", err)
+		s.mu.Lock()
+		s.restarts[name]++
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			slog.Info("worker stopped", "worker", name)
+			return
+		case <-clock.After(wait):
+		}
+	}
+}
+
+// restartBackoff returns how long to wait before restarting a worker that
+// failed after running for ran, given its backoff so far (zero before the
+// first failure), and the backoff for its next failure. A worker that ran
+// for healthyRunTime starts over at minRestartBackoff. Jitter keeps workers
+// that failed together, say on a Firestore outage, from retrying in
+// lockstep.
+func restartBackoff(backoff, ran time.Duration) (wait, next time.Duration) {
+	if backoff == 0 || ran >= healthyRunTime {
+		backoff = minRestartBackoff
+	}
+	return jitter(backoff, restartJitter), min(backoff*2, maxRestartBackoff)
+}
+
+func runRecovered(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return fn(ctx)
+}
+
+// restartCounts returns how often each supervised worker has been restarted.
+func (s *supervisor) restartCounts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int, len(s.restarts))
+	for name, n := range s.restarts {
+		counts[name] = n
+	}
+	return counts
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRestartBackoff(t *testing.T) {
+	defer seedRand(time.Now().UnixNano())
+	seedRand(1)
+
+	// Each failure doubles the backoff, up to the maximum, and each wait
+	// is within restartJitter of it.
+	var backoff time.Duration
+	var backoffs []time.Duration
+	for range 9 {
+		base := max(backoff, minRestartBackoff)
+		var wait time.Duration
+		wait, backoff = restartBackoff(backoff, time.Second)
+		if lo, hi := time.Duration(float64(base)*(1-restartJitter)), time.Duration(float64(base)*(1+restartJitter)); wait < lo || wait > hi {
+			t.Errorf("wait = %v with backoff %v, want within %v to %v", wait, base, lo, hi)
+		}
+		backoffs = append(backoffs, backoff)
+	}
+	want := []time.Duration{2, 4, 8, 16, 32, 60, 60, 60, 60}
+	for i := range want {
+		if backoffs[i] != want[i]*time.Second {
+			t.Fatalf("backoffs = %v, want doubling from 1s up to 1m", backoffs)
+		}
+	}
+
+	// A worker that ran long enough to be healthy starts over.
+	if wait, next := restartBackoff(maxRestartBackoff, healthyRunTime); wait > 2*minRestartBackoff || next != 2*minRestartBackoff {
+		t.Errorf("after a healthy run wait %v, next %v, want about %v then %v", wait, next, minRestartBackoff, 2*minRestartBackoff)
+	}
+}
+
+func TestJitterSpreadsRestarts(t *testing.T) {
+	defer seedRand(time.Now().UnixNano())
+	seedRand(1)
+	waits := map[time.Duration]bool{}
+	for range 20 {
+		wait, _ := restartBackoff(0, 0)
+		waits[wait] = true
+	}
+	if len(waits) < 15 {
+		t.Errorf("20 workers failing together wait %d distinct times, want them spread out", len(waits))
+	}
+}
+
+func TestSuperviseRestarts(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newSupervisor()
+	runs := make(chan int, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n := 0
+		s.supervise(ctx, "flaky", func(ctx context.Context) error {
+			n++
+			runs <- n
+			switch n {
+			case 1:
+				panic("boom")
+			case 2:
+				return errors.New("firestore unavailable")
+			case 3:
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	for want := 1; want <= 4; want++ {
+		waitFor(t, nil, "a restart", func() bool {
+			vc.Advance(maxRestartBackoff)
+			return len(runs) > 0
+		})
+		if got := <-runs; got != want {
+			t.Fatalf("run %d, want %d", got, want)
+		}
+	}
+	if got := s.restartCounts()["flaky"]; got != 3 {
+		t.Errorf("restarts = %d, want 3 after a panic, an error and a nil return", got)
+	}
+	cancel()
+	<-done
+	if got := s.restartCounts()["flaky"]; got != 3 {
+		t.Errorf("restarts after stopping = %d, want still 3", got)
+	}
+}
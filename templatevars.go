@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateVars are values the backend works out when a template is
+// rendered, for organizers to write dynamic messages with: prompt
+// templates get them as .Vars, scheduled announcements as the template's
+// own fields, e.g. "{{.Leader}} leads with {{.LeaderPoints}} points".
+// Values that don't apply right now are empty.
+type templateVars struct {
+	// Leader is the name of the player on top of the quiz leaderboard and
+	// LeaderPoints their points, once anyone has scored.
+	Leader       string
+	LeaderPoints int
+	// ActivePollID is the poll the host is reporting on.
+	ActivePollID string
+	// Persona is the name of the persona the host is playing, and Theme
+	// the theme of the content calendar day in effect.
+	Persona string
+	Theme   string
+	// Session is the title of the session on the schedule. NextSessionIn
+	// is how long until it starts, like "1 hour 5 minutes", while it is
+	// still to come, and SessionEndsIn how long until it ends once it is
+	// on, if it has an end.
+	Session       string
+	NextSessionIn string
+	SessionEndsIn string
+}
+
+// templateVars works out the template variables at now.
+func (b *Bot) templateVars(now time.Time) templateVars {
+	v := templateVars{
+		ActivePollID: b.activePollID(),
+		Persona:      b.personas.current().Name,
+		Theme:        b.pollTheme(),
+	}
+	if top := b.room.leaderboard.Load(); top != nil && len(*top) > 0 && (*top)[0].Points > 0 {
+		v.Leader, v.LeaderPoints = (*top)[0].name(), (*top)[0].Points
+	}
+	if s := b.room.schedule.Load(); s != nil {
+		v.Session = s.Title
+		switch {
+		case !s.StartsAt.IsZero() && now.Before(s.StartsAt):
+			v.NextSessionIn = spokenDuration(s.StartsAt.Sub(now))
+		case s.live(now) && !s.EndsAt.IsZero():
+			v.SessionEndsIn = spokenDuration(s.EndsAt.Sub(now))
+		}
+	}
+	return v
+}
+
+// spokenDuration says d the way the host would, to the minute.
+func spokenDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes < 1 {
+		return "less than a minute"
+	}
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	var parts []string
+	if h := minutes / 60; h > 0 {
+		parts = append(parts, plural(h, "hour"))
+	}
+	if m := minutes % 60; m > 0 {
+		parts = append(parts, plural(m, "minute"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseMessageTemplate parses an organizer's message as a template over
+// templateVars, and tries it once so a misspelt variable is caught when it
+// is saved rather than when it is sent.
+func parseMessageTemplate(text string) (*template.Template, error) {
+	t, err := template.New("message").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(&strings.Builder{}, templateVars{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// renderMessage renders an organizer's message with the template
+// variables at now. A message that isn't a valid template is sent as it
+// is, with the error.
+func (b *Bot) renderMessage(text string, now time.Time) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	t, err := parseMessageTemplate(text)
+	if err != nil {
+		return text, err
+	}
+	var out strings.Builder
+	if err := t.Execute(&out, b.templateVars(now)); err != nil {
+		return text, err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestTemplateVars(t *testing.T) {
+	t0 := time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC)
+	vc := newVirtualClock(t0)
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	var prompts []string
+	b := newTestBot(t, newMemoryStore(), generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		prompts = append(prompts, prompt)
+		return "Namaste!", nil
+	}))
+	b.room.leaderboard.Store(&[]LeaderboardEntry{{UserID: "u1", DisplayName: "Ann", Points: 120}, {UserID: "u2", Points: 80}})
+	b.room.schedule.Store(&SessionSchedule{Title: "Keynote", StartsAt: t0.Add(65 * time.Minute), EndsAt: t0.Add(3 * time.Hour)})
+	b.switchPoll("q7")
+
+	const message = "{{.Leader}} leads with {{.LeaderPoints}} points. {{.Session}} starts in {{.NextSessionIn}}; vote on {{.ActivePollID}}!"
+	got, err := b.renderMessage(message, clock.Now())
+	if err != nil || got != "Ann leads with 120 points. Keynote starts in 1 hour 5 minutes; vote on q7!" {
+		t.Errorf("renderMessage = %q, %v", got, err)
+	}
+	vc.Advance(2*time.Hour + 5*time.Minute)
+	if got, _ := b.renderMessage("Only {{.SessionEndsIn}} to go{{if .NextSessionIn}}?{{end}}.", clock.Now()); got != "Only 55 minutes to go." {
+		t.Errorf("renderMessage during the session = %q", got)
+	}
+
+	b.prompts = template.Must(b.prompts.New("reply.tmpl").Parse("{{.Message}} ({{.Vars.Leader}} leads)"))
+	if _, err := b.generateResponse(context.Background(), "Who's winning?", "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 1 || prompts[0] != "Who's winning? (Ann leads)" {
+		t.Errorf("prompts = %q, want the leader filled in", prompts)
+	}
+}
+
+func TestAnnouncementTemplateValidated(t *testing.T) {
+	b := newTestBot(t, newMemoryStore(), generatorFunc(nil))
+	b.cfg.AdminToken = "s3cret"
+	srv := httptest.NewServer(b.adminHandler())
+	defer srv.Close()
+	post := func(body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/admin/announcements", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(`{"message": "{{.Leeder}} is winning!", "in": "10m"}`); code != http.StatusBadRequest {
+		t.Errorf("POST with a misspelt variable = %d, want 400", code)
+	}
+	if code := post(`{"message": "{{.Leader}} is winning!", "in": "10m"}`); code != http.StatusCreated {
+		t.Errorf("POST with a template = %d, want 201", code)
+	}
+}
+
+func TestSpokenDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		20 * time.Second:                "less than a minute",
+		time.Minute:                     "1 minute",
+		90 * time.Minute:                "1 hour 30 minutes",
+		2*time.Hour + 29*time.Second:    "2 hours",
+		25*time.Minute + 40*time.Second: "26 minutes",
+	} {
+		if got := spokenDuration(d); got != want {
+			t.Errorf("spokenDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
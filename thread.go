@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+)
+
+// Host messages are threaded: a reply to an audience message carries the
+// message it answers, its sender and the thread it belongs to, so clients
+// can render conversations instead of one flat stream. A thread starts at
+// an audience message, or at a host prompt nobody asked for, and a
+// follow-up (a message with ReplyTo set) joins the thread of the reply it
+// follows up on.
+
+// hostPrompt returns a host message that answers nobody, under an ID of its
+// own so it does not replace the previous one, starting a thread.
+func hostPrompt(text, context string) Message {
+	id := newID("host-prompt")
+	return Message{ID: id, Message: text, Context: context, ThreadID: id}
+}
+
+// threadOf returns the thread msg belongs to: that of the host reply it
+// follows up on, or its own if it starts one. A reply that cannot be read
+// is taken to start its thread, as replies written before threading did.
+func (b *Bot) threadOf(ctx context.Context, msg *Message) string {
+	if msg.ReplyTo == "" {
+		return msg.ID
+	}
+	parent, _, err := b.messages.FindReply(ctx, msg.ReplyTo)
+	if err != nil {
+		loggerFrom(ctx).Error("error finding the thread of message", "err", err)
+	}
+	if parent != nil && parent.ThreadID != "" {
+		return parent.ThreadID
+	}
+	return msg.ReplyTo
+}
+
+// replyTo returns reply addressed to msg, under msg's ID and in its thread.
+func (b *Bot) replyTo(ctx context.Context, msg *Message, reply Message) Message {
+	reply.ID = msg.ID
+	reply.InReplyTo = msg.ID
+	reply.RecipientID = msg.UserID
+	reply.ThreadID = b.threadOf(ctx, msg)
+	return reply
+}
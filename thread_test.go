@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRepliesAreThreaded(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "Bilkul sahi!", nil
+	}))
+	ctx := context.Background()
+
+	answer := func(msg Message) Message {
+		t.Helper()
+		store.AddMessage(msg)
+		if err := b.handleUserMessage(ctx, &msg, answerPublic); err != nil {
+			t.Fatal(err)
+		}
+		reply, ok := store.Reply(msg.ID)
+		if !ok {
+			t.Fatalf("no reply to %s", msg.ID)
+		}
+		return reply
+	}
+
+	got := answer(Message{ID: "m1", UserID: "ann", Message: "What is Gemini?"})
+	if got.InReplyTo != "m1" || got.RecipientID != "ann" || got.ThreadID != "m1" {
+		t.Errorf("reply = %+v, want it to start thread m1 for ann", got)
+	}
+	got = answer(Message{ID: "m2", UserID: "bob", Message: "And Gemma?", ReplyTo: "m1"})
+	if got.InReplyTo != "m2" || got.RecipientID != "bob" || got.ThreadID != "m1" {
+		t.Errorf("follow-up reply = %+v, want it in thread m1 for bob", got)
+	}
+	got = answer(Message{ID: "m3", UserID: "ann", Message: "Thanks!", ReplyTo: "m2"})
+	if got.ThreadID != "m1" {
+		t.Errorf("second follow-up thread = %q, want m1", got.ThreadID)
+	}
+}
+
+func TestHostPromptsGetTheirOwnIDs(t *testing.T) {
+	first, second := hostPrompt("Kahan hain aap sab?", ""), hostPrompt("Kuch poochho!", "")
+	if first.ID == second.ID || !strings.HasPrefix(first.ID, "host-prompt-") {
+		t.Errorf("host prompt IDs = %q and %q, want distinct host-prompt IDs", first.ID, second.ID)
+	}
+	if first.ThreadID != first.ID || first.InReplyTo != "" {
+		t.Errorf("host prompt = %+v, want it to start its own thread", first)
+	}
+}
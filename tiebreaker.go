@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	tieBreakerDuration  = 60 * time.Second
+	tieBreakerMaxRounds = 3
+)
+
+// TieBreaker tracks the sudden-death round of a quiz that ended in a tie.
+type TieBreaker struct {
+	PollID   string    `firestore:"pollId"`
+	Players  []string  `firestore:"players"`
+	Round    int       `firestore:"round"`
+	ClosesAt time.Time `firestore:"closesAt"`
+}
+
+// generatedQuestion is the JSON shape the model is asked to produce.
+type generatedQuestion struct {
+	Question string            `json:"question"`
+	Options  map[string]string `json:"options"`
+	Correct  string            `json:"correct"`
+}
+
+// generateQuizQuestion asks the model for a multiple-choice question with
+// options keyed A to D.
+func generateQuizQuestion(ctx context.Context, model ResponseGenerator, instructions string) (*generatedQuestion, error) {
+	requestText := fmt.Sprintf(`Write one multiple-choice quiz question for a live Kaun Banega Crorepati style show. %s
+Reply with only JSON of the form {"question": "...", "options": {"A": "...", "B": "...", "C": "...", "D": "..."}, "correct": "A"}.`, instructions)
+
+	text, err := model.Generate(ctx, requestText)
+	if err != nil {
+		return nil, fmt.Errorf("model error: %w", err)
+	}
+
+	var q generatedQuestion
+	if err := json.Unmarshal([]byte(extractJSON(text)), &q); err != nil {
+		return nil, fmt.Errorf("error parsing generated question: %w", err)
+	}
+	if q.Question == "" || len(q.Options) < 2 || q.Options[q.Correct] == "" {
+		return nil, fmt.Errorf("model returned an incomplete question: %q", text)
+	}
+	return &q, nil
+}
+
+func (q *generatedQuestion) toPoll() PollQuestion {
+	poll := PollQuestion{Question: q.Question, Correct: q.Correct, Options: map[string]PollOption{}}
+	for key, text := range q.Options {
+		poll.Options[key] = PollOption{OpText: text, Label: key, Voters: []string{}}
+	}
+	return poll
+}
+
+// topPlayers returns every player sharing the highest score. Nobody tops a
+// quiz where no one scored, so that returns no players rather than a tie
+// between everyone who took part.
+func topPlayers(scores map[string]int) []string {
+	best := 0
+	var top []string
+	for player, score := range scores {
+		switch {
+		case score > best:
+			best, top = score, []string{player}
+		case score == best && score > 0:
+			top = append(top, player)
+		}
+	}
+	sort.Strings(top)
+	return top
+}
+
+// displayNames returns what the host calls each player: their profile
+// display name, or a nickname given to those without one, so user IDs
+// never reach the screen. If profiles cannot be read, the IDs the quiz
+// knows them by are returned.
+func (b *Bot) displayNames(ctx context.Context, players []string) []string {
+	names := append([]string(nil), players...)
+	if len(players) == 0 {
+		return names
+	}
+	ids := make([]string, len(players))
+	for i, player := range players {
+		ids[i] = b.profileID(ctx, player)
+	}
+	profiles, err := b.profiles.Profiles(ctx, ids)
+	if err != nil {
+		slog.Error("error fetching profiles for announcement", "err", err)
+		return names
+	}
+	for i, p := range profiles {
+		names[i] = b.profileName(ctx, ids[i], p)
+	}
+	return names
+}
+
+// advanceQuizEnding drives an ended quiz to a winner: it declares the top
+// scorer outright, or runs sudden-death rounds restricted to the tied
+// players until one of them answers correctly first.
+// A tie-breaker question that cannot be generated is retried next tick.
+func (b *Bot) advanceQuizEnding(ctx context.Context, ref *firestore.DocumentRef, session *QuizSession) (*hostAnnouncement, error) {
+	client, cols := b.client, b.cfg.Collections
+	if session.TieBreaker == nil {
+		top := topPlayers(session.Scores)
+		if len(top) < 2 {
+			return b.declareWinners(ctx, ref, top)
+		}
+		return b.startTieBreaker(ctx, ref, top, 1)
+	}
+
+	tb := session.TieBreaker
+	if clock.Now().Before(tb.ClosesAt) {
+		return nil, nil
+	}
+	b.notePollClosed(tb.PollID, tb.ClosesAt)
+
+	doc, err := client.Collection(cols.Poll).Doc(tb.PollID).Get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching tie-breaker poll: %w", err)
+	}
+	var poll PollQuestion
+	if err := doc.DataTo(&poll); err != nil {
+		return nil, fmt.Errorf("error converting document to PollQuestion: %w", err)
+	}
+	tally, err := tallyPoll(ctx, b.eligibility, b.pseudonyms.mapper(ctx, client, cols.Pseudonyms), poll)
+	if err != nil {
+		return nil, fmt.Errorf("error tallying tie-breaker poll: %w", err)
+	}
+	if len(tally.Ineligible) > 0 {
+		if _, err := doc.Ref.Update(ctx, tally.ineligibleUpdate()); err != nil {
+			return nil, fmt.Errorf("error recording ineligible votes: %w", err)
+		}
+	}
+
+	// Voters are appended in the order they voted, so the first correct
+	// voter left after the eligibility rules was the fastest.
+	if correct := tally.Poll.Options[poll.Correct].Voters; len(correct) > 0 {
+		return b.declareWinners(ctx, ref, correct[:1])
+	}
+	if tb.Round >= tieBreakerMaxRounds {
+		return b.declareWinners(ctx, ref, tb.Players)
+	}
+	return b.startTieBreaker(ctx, ref, tb.Players, tb.Round+1)
+}
+
+func (b *Bot) startTieBreaker(ctx context.Context, ref *firestore.DocumentRef, players []string, round int) (*hostAnnouncement, error) {
+	q, err := generateQuizQuestion(ctx, b.ladderModel(), "It is a sudden-death tie-breaker, so make it tricky but fair.")
+	if err != nil {
+		return nil, fmt.Errorf("error generating tie-breaker question: %w", err)
+	}
+
+	tb := TieBreaker{
+		PollID:   fmt.Sprintf("%s-tiebreak-%d", ref.ID, round),
+		Players:  players,
+		Round:    round,
+		ClosesAt: clock.Now().Add(tieBreakerDuration),
+	}
+	poll := q.toPoll()
+	poll.AllowedVoters = players
+	poll.ClosesAt = tb.ClosesAt
+	if _, err := b.client.Collection(b.cfg.Collections.Poll).Doc(tb.PollID).Set(ctx, poll); err != nil {
+		return nil, fmt.Errorf("error writing tie-breaker poll: %w", err)
+	}
+	if _, err := ref.Update(ctx, []firestore.Update{{Path: "tieBreaker", Value: tb}}); err != nil {
+		return nil, fmt.Errorf("error recording tie-breaker: %w", err)
+	}
+
+	return &hostAnnouncement{
+		Kind: "tie-breaker",
+		Text: fmt.Sprintf("We have a tie between %s! Sudden-death round %d, only they may answer, %d seconds on the clock: %s",
+			strings.Join(b.displayNames(ctx, players), ", "), round, int(tieBreakerDuration.Seconds()), q.Question),
+	}, nil
+}
+
+func (b *Bot) declareWinners(ctx context.Context, ref *firestore.DocumentRef, winners []string) (*hostAnnouncement, error) {
+	if winners == nil {
+		winners = []string{}
+	}
+	if _, err := ref.Update(ctx, []firestore.Update{{Path: "winners", Value: winners}}); err != nil {
+		return nil, fmt.Errorf("error recording quiz winners: %w", err)
+	}
+
+	// A settled quiz is the end of a show segment: publish its highlight
+	// reel.
+	b.publishHighlightReel(ctx, "quiz "+ref.ID)
+
+	names := b.displayNames(ctx, winners)
+	text := "The quiz is over, but nobody scored. Better luck next round!"
+	switch {
+	case len(names) == 1:
+		text = fmt.Sprintf("The quiz is over and our champion is %s!", names[0])
+	case len(names) > 1:
+		text = fmt.Sprintf("Even sudden death couldn't separate them: %s share the crown!", strings.Join(names, ", "))
+	}
+	return &hostAnnouncement{Kind: "quiz-winner", Text: text}, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopPlayers(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores map[string]int
+		want   []string
+	}{
+		{"no players", nil, nil},
+		{"nobody scored", map[string]int{"a": 0, "b": 0}, nil},
+		{"outright winner", map[string]int{"a": 10, "b": 20, "c": 0}, []string{"b"}},
+		{"tie", map[string]int{"c": 30, "a": 30, "b": 10}, []string{"a", "c"}},
+		{"single scorer among zeros", map[string]int{"a": 0, "b": 10}, []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := topPlayers(tt.scores); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("topPlayers(%v) = %v, want %v", tt.scores, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans makes the global tracer provider record every span until
+// the test ends.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func TestMessageTrace(t *testing.T) {
+	rec := recordSpans(t)
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		return "It is.", nil
+	}))
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Message: "Is the keynote recorded?"})
+	msg, _ := store.Message("m1")
+	received := time.Now().Add(-3 * time.Second)
+	b.processMessage(context.Background(), newWorkerPool(1), triagedMessage{Msg: &msg, Decision: answerPrivate, Received: received})
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	root, ok := spans["message"]
+	if !ok {
+		t.Fatalf("no message span in %v", spans)
+	}
+	if root.Parent().IsValid() || !root.StartTime().Equal(received) {
+		t.Errorf("message span starts at %v under %v, want a root starting at receipt", root.StartTime(), root.Parent())
+	}
+	for _, name := range []string{"firestore.claim", "handle", "moderation.screen", "model.generate", "firestore.write-private-reply", "firestore.mark-processed"} {
+		s, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span; got %v", name, spans)
+			continue
+		}
+		if s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("%s span is not in the message's trace", name)
+		}
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	rec := recordSpans(t)
+	ctx, parent := startSpan(context.Background(), "message")
+	_, child := startSpan(ctx, "model.generate")
+	child.SetAttributes(attribute.Int("attempts", 2))
+	endSpan(child, errors.New("model down"))
+	parent.End()
+
+	var got otlpRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("export to %s as %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+	if err := newOTLPExporter(srv.URL+"/").ExportSpans(context.Background(), rec.Ended()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.ResourceSpans) != 1 || len(got.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("request = %+v, want one resource and scope", got)
+	}
+	scope := got.ResourceSpans[0].ScopeSpans[0]
+	if scope.Scope.Name != tracerName || len(scope.Spans) != 2 {
+		t.Fatalf("scope = %+v, want both spans under %s", scope, tracerName)
+	}
+	gen, msg := scope.Spans[0], scope.Spans[1]
+	if len(gen.TraceID) != 32 || gen.TraceID != msg.TraceID || gen.ParentSpanID != msg.SpanID || msg.ParentSpanID != "" {
+		t.Errorf("spans = %+v, want model.generate a child of message", scope.Spans)
+	}
+	if gen.Status != (otlpStatus{Code: 2, Message: "model down"}) {
+		t.Errorf("status = %+v, want an error", gen.Status)
+	}
+	if len(gen.Attributes) != 1 || gen.Attributes[0].Value["intValue"] != "2" {
+		t.Errorf("attributes = %+v, want attempts as an intValue string", gen.Attributes)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/api/speech/v1"
+)
+
+// maxVoiceNoteBytes caps a voice note: Cloud Speech-to-Text transcribes
+// up to 10 MB, and about a minute, in one request.
+const maxVoiceNoteBytes = 10 << 20
+
+// voiceNoteTimeout is how long fetching a voice note may take.
+const voiceNoteTimeout = 30 * time.Second
+
+// maxAlternativeLanguages is how many languages besides the session's
+// Speech-to-Text listens for.
+const maxAlternativeLanguages = 3
+
+// voiceNoteEncodings are the audio types voice notes can be sent in, with
+// their Speech-to-Text encoding. WAV and FLAC carry theirs in the header.
+var voiceNoteEncodings = map[string]string{
+	"audio/webm":   "WEBM_OPUS",
+	"audio/ogg":    "OGG_OPUS",
+	"audio/opus":   "OGG_OPUS",
+	"audio/mpeg":   "MP3",
+	"audio/mp3":    "MP3",
+	"audio/amr":    "AMR",
+	"audio/flac":   "FLAC",
+	"audio/x-flac": "FLAC",
+	"audio/wav":    "ENCODING_UNSPECIFIED",
+	"audio/x-wav":  "ENCODING_UNSPECIFIED",
+	"audio/wave":   "ENCODING_UNSPECIFIED",
+}
+
+// TranscriptionConfig has voice notes transcribed with Cloud Speech-to-Text
+// before they are answered. Model, if set, is the Speech-to-Text model,
+// such as latest_short.
+type TranscriptionConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Model   string `json:"model" yaml:"model"`
+}
+
+// Transcriber turns voice notes into text.
+type Transcriber interface {
+	// Transcribe returns what is said in the audio at audioURL, spoken in
+	// languageCodes[0] or one of the others.
+	Transcribe(ctx context.Context, audioURL string, languageCodes []string) (string, error)
+}
+
+// cloudTranscriber fetches voice notes and transcribes them with Cloud
+// Speech-to-Text.
+type cloudTranscriber struct {
+	service *speech.Service
+	client  *http.Client
+	model   string
+}
+
+func newCloudTranscriber(ctx context.Context, cfg *Config) (*cloudTranscriber, error) {
+	service, err := speech.NewService(ctx, googleClientOptions(cfg)...)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing Speech-to-Text: %w", err)
+	}
+	return &cloudTranscriber{service: service, client: &http.Client{Timeout: voiceNoteTimeout}, model: cfg.Transcription.Model}, nil
+}
+
+func (t *cloudTranscriber) Transcribe(ctx context.Context, audioURL string, languageCodes []string) (string, error) {
+	audio, encoding, err := fetchVoiceNote(ctx, t.client, audioURL)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.service.Speech.Recognize(&speech.RecognizeRequest{
+		Audio: &speech.RecognitionAudio{Content: base64.StdEncoding.EncodeToString(audio)},
+		Config: &speech.RecognitionConfig{
+			Encoding:                   encoding,
+			LanguageCode:               languageCodes[0],
+			AlternativeLanguageCodes:   languageCodes[1:],
+			EnableAutomaticPunctuation: true,
+			Model:                      t.model,
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, r := range resp.Results {
+		if len(r.Alternatives) > 0 {
+			parts = append(parts, strings.TrimSpace(r.Alternatives[0].Transcript))
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// fetchVoiceNote downloads the voice note at url and returns it with its
+// Speech-to-Text encoding, going by its Content-Type.
+func fetchVoiceNote(ctx context.Context, client *http.Client, url string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("fetching voice note returned %d", resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	encoding, ok := voiceNoteEncodings[mediaType]
+	if !ok {
+		return nil, "", fmt.Errorf("voice note has unsupported type %q", mediaType)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxVoiceNoteBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxVoiceNoteBytes {
+		return nil, "", fmt.Errorf("voice note is larger than %d MB", maxVoiceNoteBytes>>20)
+	}
+	return data, encoding, nil
+}
+
+// transcriptionLanguages are the language codes voice notes are listened
+// for in: the session's first, then the other languages the host
+// answers in.
+func (b *Bot) transcriptionLanguages() []string {
+	names := append([]string{b.sessionLanguage()}, b.cfg.Language.Allowed...)
+	if b.bilingual() {
+		names = b.cfg.Language.Bilingual
+	}
+	var codes []string
+	for _, name := range names {
+		if code := speechLanguageCodes[name]; code != "" && !slices.Contains(codes, code) && len(codes) <= maxAlternativeLanguages {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// transcribeMessage fills in the text of a voice note from its audio and
+// saves it as the message. It reports false for a voice note that can't
+// be answered: transcription is off, or nothing was said.
+func (b *Bot) transcribeMessage(ctx context.Context, msg *Message) (bool, error) {
+	logger := loggerFrom(ctx)
+	if b.transcriber == nil {
+		logger.Warn("voice note dropped: transcription is off")
+		return false, nil
+	}
+	text, err := b.transcriber.Transcribe(ctx, msg.Audio, b.transcriptionLanguages())
+	if err != nil {
+		b.metrics.voiceNotes.inc("failed")
+		return false, fmt.Errorf("error transcribing voice note: %w", err)
+	}
+	if text = strings.TrimSpace(text); text == "" {
+		b.metrics.voiceNotes.inc("empty")
+		logger.Info("voice note dropped: nothing was said")
+		return false, nil
+	}
+	b.metrics.voiceNotes.inc("transcribed")
+	msg.Message = text
+	err = b.write(ctx, "save-transcript", func(ctx context.Context) error { return b.messages.SaveTranscript(ctx, msg.ID, text) })
+	if err != nil {
+		return false, fmt.Errorf("error saving transcript: %w", err)
+	}
+	logger.Debug("voice note transcribed", "transcript", text)
+	return true, nil
+}
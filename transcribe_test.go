@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// transcriberFunc adapts a function to Transcriber.
+type transcriberFunc func(ctx context.Context, audioURL string, languageCodes []string) (string, error)
+
+func (f transcriberFunc) Transcribe(ctx context.Context, audioURL string, languageCodes []string) (string, error) {
+	return f(ctx, audioURL, languageCodes)
+}
+
+func TestFetchVoiceNote(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/note.webm":
+			w.Header().Set("Content-Type", "audio/webm;codecs=opus")
+		case "/note.m4a":
+			w.Header().Set("Content-Type", "audio/mp4")
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("audio"))
+	}))
+	defer srv.Close()
+
+	data, encoding, err := fetchVoiceNote(context.Background(), srv.Client(), srv.URL+"/note.webm")
+	if err != nil || string(data) != "audio" || encoding != "WEBM_OPUS" {
+		t.Errorf("fetching a WebM voice note = %q, %q, %v, want the audio as WEBM_OPUS", data, encoding, err)
+	}
+	if _, _, err := fetchVoiceNote(context.Background(), srv.Client(), srv.URL+"/note.m4a"); err == nil {
+		t.Error("fetching an MP4 voice note succeeded, want an unsupported type")
+	}
+	if _, _, err := fetchVoiceNote(context.Background(), srv.Client(), srv.URL+"/gone.webm"); err == nil {
+		t.Error("fetching a missing voice note succeeded")
+	}
+}
+
+func TestVoiceNotes(t *testing.T) {
+	var mu sync.Mutex
+	var prompts []string
+	var languageCodes []string
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(func(ctx context.Context, prompt string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		prompts = append(prompts, prompt)
+		return "Gemini is Google's model.", nil
+	}))
+	b.cfg.Language.Allowed = []string{"hindi", "hinglish"}
+	b.transcriber = transcriberFunc(func(ctx context.Context, audioURL string, codes []string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		languageCodes = codes
+		if strings.Contains(audioURL, "silence") {
+			return "  ", nil
+		}
+		return "What is Gemini?", nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.listenForNewUserMessages(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	store.AddMessage(Message{ID: "m1", UserID: "ann", Audio: "https://example.com/m1.webm", Timestamp: time.Now()})
+	store.AddMessage(Message{ID: "m2", UserID: "bob", Audio: "https://example.com/silence.webm", Timestamp: time.Now()})
+	waitFor(t, nil, "both voice notes", func() bool {
+		m1, _ := store.Message("m1")
+		m2, _ := store.Message("m2")
+		return m1.Processed && m2.Processed
+	})
+
+	if m1, _ := store.Message("m1"); m1.Message != "What is Gemini?" {
+		t.Errorf("voice note message = %q, want its transcript", m1.Message)
+	}
+	if _, ok := store.Reply("m1"); !ok {
+		t.Error("transcribed voice note wasn't answered")
+	}
+	if _, ok := store.Reply("m2"); ok {
+		t.Error("silent voice note was answered")
+	}
+	voiceNotes := b.metrics.voiceNotes.snapshot()
+	if voiceNotes["transcribed"] != 1 || voiceNotes["empty"] != 1 {
+		t.Errorf("voice notes = %v, want one transcribed and one empty", voiceNotes)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(languageCodes, ",") != "en-IN,hi-IN" {
+		t.Errorf("voice notes listened for in %q, want en-IN then hi-IN", languageCodes)
+	}
+	found := false
+	for _, p := range prompts {
+		if strings.Contains(p, "User said: What is Gemini?") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no prompt answered the transcript: %q", prompts)
+	}
+}
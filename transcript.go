@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// maxTranscriptPage caps one page of the transcript.
+const maxTranscriptPage = 100
+
+// TranscriptEntry is one host message in the public transcript, with the
+// audience question it answered, if any.
+type TranscriptEntry struct {
+	ID        string    `firestore:"-" json:"id"`
+	MessageID string    `firestore:"messageId" json:"messageId"`
+	Message   string    `firestore:"message" json:"message"`
+	Question  string    `firestore:"question,omitempty" json:"question,omitempty"`
+	At        time.Time `firestore:"at" json:"at"`
+}
+
+// recordTranscript appends every published host message to the
+// transcript. Entries are separate documents ordered by At, so shards can
+// all append without coordinating and readers page through with a cursor.
+func (b *Bot) recordTranscript(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-b.transcript:
+			entry := TranscriptEntry{ID: newID("line"), MessageID: e.MessageID, Message: e.Text, Question: e.Question, At: e.At}
+			if err := b.retry.do(ctx, func(ctx context.Context) error { return b.messages.AppendTranscript(ctx, entry) }); err != nil {
+				slog.Error("error adding message to the transcript", "messageId", e.MessageID, "err", err)
+			}
+		}
+	}
+}
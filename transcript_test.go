@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTranscriptRecordsPublishedReplies(t *testing.T) {
+	store := newMemoryStore()
+	b := newTestBot(t, store, generatorFunc(nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- b.recordTranscript(ctx) }()
+
+	for _, reply := range []Message{
+		{ID: "m1", Message: "It's a family of models, dost!", Question: "What is Gemini?"},
+		{ID: "host-prompt", Message: "Kahan hain aap sab? Let's hear from you!"},
+	} {
+		if err := b.publishReply(ctx, reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var entries []TranscriptEntry
+	waitFor(t, done, "the transcript", func() bool {
+		entries, _ = store.Transcript(ctx, time.Time{}, maxTranscriptPage)
+		return len(entries) == 2
+	})
+	if e := entries[0]; e.MessageID != "m1" || e.Question != "What is Gemini?" || e.At.IsZero() {
+		t.Errorf("first entry = %+v, want the answer with its question", e)
+	}
+	if later, _ := store.Transcript(ctx, entries[0].At, maxTranscriptPage); len(later) != 1 || later[0].MessageID != "host-prompt" {
+		t.Errorf("entries after the first = %+v, want only the host prompt", later)
+	}
+}
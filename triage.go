@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// triageDecision is how the host handles one audience message.
+type triageDecision int
+
+const (
+	// answerPublic replies on the shared ping stream.
+	answerPublic triageDecision = iota
+	// answerPrivate replies only to the sender.
+	answerPrivate
+	// drop marks the message processed without replying.
+	drop
+)
+
+func (d triageDecision) String() string {
+	return [...]string{"public", "private", "drop"}[d]
+}
+
+// triagedMessage is a message with the decision made for it.
+type triagedMessage struct {
+	Msg      *Message
+	Decision triageDecision
+	// Received is when the snapshot listing the message arrived.
+	Received time.Time
+}
+
+// TriagePolicy decides which audience messages the host answers publicly,
+// which privately and which not at all. It receives every batch the
+// listener picks up and returns it in the order to answer it.
+type TriagePolicy interface {
+	Triage(batch []*Message) []triagedMessage
+}
+
+// newTriagePolicy returns the policy named in cfg; validate has already
+// checked the name.
+func newTriagePolicy(cfg TriageConfig) TriagePolicy {
+	switch cfg.Policy {
+	case "top-k":
+		return &topKPolicy{cfg: cfg}
+	case "vip-first":
+		vips := map[string]bool{}
+		for _, id := range cfg.VIPs {
+			vips[id] = true
+		}
+		return &vipFirstPolicy{budget: topKPolicy{cfg: cfg}, vips: vips}
+	default:
+		return answerAllPolicy{}
+	}
+}
+
+// answerAllPolicy answers every message publicly, in arrival order.
+type answerAllPolicy struct{}
+
+func (answerAllPolicy) Triage(batch []*Message) []triagedMessage {
+	out := make([]triagedMessage, len(batch))
+	for i, m := range batch {
+		out[i] = triagedMessage{Msg: m, Decision: answerPublic}
+	}
+	return out
+}
+
+// topKPolicy answers at most K messages publicly per Window, picking the
+// most question-like of each batch; the rest get cfg.Overflow.
+type topKPolicy struct {
+	cfg TriageConfig
+
+	mu     sync.Mutex
+	public []time.Time
+}
+
+func (p *topKPolicy) Triage(batch []*Message) []triagedMessage {
+	ranked := append([]*Message(nil), batch...)
+	sort.SliceStable(ranked, func(i, j int) bool { return questionScore(ranked[i].Message) > questionScore(ranked[j].Message) })
+
+	out := make([]triagedMessage, len(ranked))
+	for i, m := range ranked {
+		out[i] = triagedMessage{Msg: m, Decision: p.take()}
+	}
+	return out
+}
+
+// take spends one public answer from the window's budget, or returns the
+// overflow decision if none is left.
+func (p *topKPolicy) take() triageDecision {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := clock.Now()
+	cutoff := now.Add(-p.cfg.Window.Duration)
+	for len(p.public) > 0 && !p.public[0].After(cutoff) {
+		p.public = p.public[1:]
+	}
+	if len(p.public) >= p.cfg.K {
+		if p.cfg.Overflow == "drop" {
+			return drop
+		}
+		return answerPrivate
+	}
+	p.public = append(p.public, now)
+	return answerPublic
+}
+
+// vipFirstPolicy always answers VIPs publicly and ahead of everyone else in
+// the batch; other messages share a top-k budget.
+type vipFirstPolicy struct {
+	budget topKPolicy
+	vips   map[string]bool
+}
+
+func (p *vipFirstPolicy) Triage(batch []*Message) []triagedMessage {
+	var out []triagedMessage
+	var rest []*Message
+	for _, m := range batch {
+		if p.vips[m.UserID] {
+			out = append(out, triagedMessage{Msg: m, Decision: answerPublic})
+			continue
+		}
+		rest = append(rest, m)
+	}
+	return append(out, p.budget.Triage(rest)...)
+}
+
+// questionScore ranks how much a message deserves a public answer: real
+// questions first, then longer messages over one-word reactions.
+func questionScore(text string) int {
+	score := min(len(splitWords(text)), 20)
+	if strings.Contains(text, "?") {
+		score += 10
+	}
+	return score
+}
+
+// validateTriage checks cfg; it returns nil for the default policy.
+func validateTriage(cfg TriageConfig) error {
+	switch cfg.Policy {
+	case "answer-all":
+		return nil
+	case "top-k", "vip-first":
+	default:
+		return fmt.Errorf("triage.policy must be answer-all, top-k or vip-first, got %q", cfg.Policy)
+	}
+	if cfg.K < 1 {
+		return fmt.Errorf("triage.k must be positive")
+	}
+	if cfg.Overflow != "private" && cfg.Overflow != "drop" {
+		return fmt.Errorf("triage.overflow must be private or drop, got %q", cfg.Overflow)
+	}
+	return nil
+}
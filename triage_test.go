@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTriagePolicies(t *testing.T) {
+	batch := []*Message{
+		{ID: "wow", UserID: "ann", Message: "wow"},
+		{ID: "q", UserID: "bob", Message: "How does Gemini handle long context?"},
+		{ID: "vip", UserID: "speaker", Message: "great crowd"},
+		{ID: "long", UserID: "cat", Message: "loving the talk so far, the demos are great"},
+	}
+	tests := []struct {
+		name string
+		cfg  TriageConfig
+		want []string // "id:decision" in answering order
+	}{
+		{"answer-all keeps arrival order",
+			TriageConfig{Policy: "answer-all"},
+			[]string{"wow:public", "q:public", "vip:public", "long:public"}},
+		{"top-k answers questions first",
+			TriageConfig{Policy: "top-k", K: 2, Overflow: "private"},
+			[]string{"q:public", "long:public", "vip:private", "wow:private"}},
+		{"top-k can drop the overflow",
+			TriageConfig{Policy: "top-k", K: 1, Overflow: "drop"},
+			[]string{"q:public", "long:drop", "vip:drop", "wow:drop"}},
+		{"vip-first skips the budget",
+			TriageConfig{Policy: "vip-first", K: 1, Overflow: "private", VIPs: []string{"speaker"}},
+			[]string{"vip:public", "q:public", "long:private", "wow:private"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Window = Duration{time.Minute}
+			var got []string
+			for _, d := range newTriagePolicy(tt.cfg).Triage(batch) {
+				got = append(got, d.Msg.ID+":"+d.Decision.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Triage = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopKBudgetRefills(t *testing.T) {
+	vc := newVirtualClock(time.Date(2024, 12, 7, 10, 0, 0, 0, time.UTC))
+	defer func(prev Clock) { clock = prev }(clock)
+	clock = vc
+
+	p := newTriagePolicy(TriageConfig{Policy: "top-k", K: 1, Window: Duration{time.Minute}, Overflow: "private"})
+	steps := []struct {
+		advance time.Duration
+		want    triageDecision
+	}{
+		{0, answerPublic},
+		{30 * time.Second, answerPrivate},
+		{30 * time.Second, answerPublic},
+	}
+	for i, s := range steps {
+		vc.Advance(s.advance)
+		got := p.Triage([]*Message{{ID: "m", Message: "?"}})[0].Decision
+		if got != s.want {
+			t.Errorf("step %d: decision = %v, want %v", i, got, s.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// userContext adds the sender's own earlier questions, and the host's
+// answers to them, to the prompt context, so the host can pick up a
+// follow-up where it left off. Without a sender, or if the history can't
+// be read, the room context is used as is.
+func (b *Bot) userContext(ctx context.Context, promptContext string, msg *Message) string {
+	if msg.UserID == "" {
+		return promptContext
+	}
+	earlier, err := b.messages.UserHistory(ctx, msg.UserID, b.cfg.Monitor.UserHistoryTurns)
+	if err != nil {
+		loggerFrom(ctx).Error("error reading user history", "user", msg.UserID, "err", err)
+		return promptContext
+	}
+	var lines strings.Builder
+	for _, a := range earlier {
+		if a.ID == msg.ID {
+			continue
+		}
+		fmt.Fprintf(&lines, "- %q", strings.TrimSpace(a.Question.Message))
+		if a.Response.Message != "" {
+			fmt.Fprintf(&lines, " (you answered: %q)", strings.TrimSpace(a.Response.Message))
+		}
+		lines.WriteString("\n")
+	}
+	if lines.Len() == 0 {
+		return promptContext
+	}
+	return fmt.Sprintf("%s\nThis user asked before, most recent first; refer back to it if this is a follow-up:\n%s", promptContext, strings.TrimRight(lines.String(), "\n"))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestUserContext(t *testing.T) {
+	store := newMemoryStore()
+	ctx := context.Background()
+	for _, m := range []Message{
+		{ID: "a1", UserID: "ann", Message: "Is Gemini free?"},
+		{ID: "b1", UserID: "bob", Message: "Where is lunch?"},
+		{ID: "a2", UserID: "ann", Message: "Can it see images?"},
+		{ID: "a3", UserID: "ann", Message: "And video?"}, // not answered yet
+	} {
+		store.AddMessage(m)
+	}
+	for _, id := range []string{"a1", "b1", "a2"} {
+		m, _ := store.Message(id)
+		store.MarkProcessed(ctx, id, "", m.UserID)
+	}
+	store.WriteReply(ctx, Message{ID: "a2", Message: "Yes, devi ji!"})
+
+	tests := []struct {
+		name   string
+		msg    Message
+		want   []string
+		wantNo []string
+	}{
+		{"anonymous sender", Message{ID: "x", Message: "hi"}, nil, []string{"asked before"}},
+		{"first question", Message{ID: "c1", UserID: "cat", Message: "hi"}, nil, []string{"asked before"}},
+		{"follow-up", Message{ID: "a3", UserID: "ann", Message: "And video?"},
+			[]string{`- "Can it see images?" (you answered: "Yes, devi ji!")` + "\n" + `- "Is Gemini free?"`},
+			[]string{"lunch", "And video?"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBot(t, store, nil)
+			got := b.userContext(ctx, "room", &tt.msg)
+			if !strings.HasPrefix(got, "room") {
+				t.Errorf("userContext = %q, want the room context first", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("userContext = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, no := range tt.wantNo {
+				if strings.Contains(got, no) {
+					t.Errorf("userContext = %q, want no %q", got, no)
+				}
+			}
+		})
+	}
+}
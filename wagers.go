@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// wagerHighlights is how many of the biggest wins, and of the biggest
+// losses, the host calls out.
+const wagerHighlights = 3
+
+// Wager is a player's bet of leaderboard points on the option a poll will
+// be won by. The frontend writes it to the poll document's wagers map,
+// keyed by user ID.
+type Wager struct {
+	Option string `firestore:"option" json:"option"`
+	Points int    `firestore:"points" json:"points"`
+}
+
+// WagerResult is how a settled wager turned out: Stake is what was
+// actually staked, capped at the player's points, and Net the points won,
+// or lost if negative.
+type WagerResult struct {
+	UserID string `firestore:"userId" json:"userId"`
+	Name   string `firestore:"name" json:"name"`
+	Option string `firestore:"option" json:"option"`
+	Stake  int    `firestore:"stake" json:"stake"`
+	Net    int    `firestore:"net" json:"net"`
+}
+
+// awaitingSettlement reports whether poll is an option poll with wagers
+// yet to be settled. Numeric and open-text polls take no wagers.
+func (p PollQuestion) awaitingSettlement() bool {
+	return !p.numeric() && !p.textual() && len(p.Wagers) > 0 && !p.WagersSettled
+}
+
+// pollOutcome is the options a closed poll was won by: the right answer of
+// a quiz question, or the options with the most votes.
+func pollOutcome(poll PollQuestion) []string {
+	if poll.Correct != "" {
+		return []string{poll.Correct}
+	}
+	results, total := pollResults(poll)
+	var outcome []string
+	for _, r := range results {
+		if total > 0 && r.Votes == results[0].Votes {
+			outcome = append(outcome, r.Key)
+		}
+	}
+	return outcome
+}
+
+// settleWagers settles the wagers on a poll won by the options in outcome,
+// pari-mutuel: every stake goes into one pot, shared among those who
+// backed a winning option in proportion to their stakes. If nobody did,
+// every stake is returned. Wagers on unknown options, or from players
+// without points, are void. players holds the wagering players' entries.
+// The results are ordered biggest win first.
+func settleWagers(wagers map[string]Wager, options map[string]PollOption, outcome []string, players map[string]LeaderboardEntry) []WagerResult {
+	won := map[string]bool{}
+	for _, key := range outcome {
+		won[key] = true
+	}
+	var results []WagerResult
+	var pot, winning int
+	for user, w := range wagers {
+		if _, ok := options[w.Option]; !ok || w.Points <= 0 {
+			continue
+		}
+		player := players[user]
+		stake := min(w.Points, player.Points)
+		if stake <= 0 {
+			continue
+		}
+		player.UserID = user
+		results = append(results, WagerResult{UserID: user, Name: player.name(), Option: w.Option, Stake: stake})
+		pot += stake
+		if won[w.Option] {
+			winning += stake
+		}
+	}
+	if winning > 0 {
+		for i, r := range results {
+			if won[r.Option] {
+				results[i].Net = r.Stake*pot/winning - r.Stake
+			} else {
+				results[i].Net = -r.Stake
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Net == results[j].Net {
+			return results[i].UserID < results[j].UserID
+		}
+		return results[i].Net > results[j].Net
+	})
+	return results
+}
+
+// anonymizeWagers returns wagers keyed by the IDs anon maps their users
+// to.
+func anonymizeWagers(wagers map[string]Wager, anon idMapper) (map[string]Wager, error) {
+	if wagers == nil {
+		return nil, nil
+	}
+	mapped := make(map[string]Wager, len(wagers))
+	for user, w := range wagers {
+		id, err := anon(user)
+		if err != nil {
+			return nil, err
+		}
+		mapped[id] = w
+	}
+	return mapped, nil
+}
+
+// settlePollWagers settles the wagers on the closed poll of tally against
+// the leaderboard, so the results announcement can tell who won and lost.
+// A failure is retried on the next tick, before the results are announced.
+// It does nothing for open polls or ones already settled.
+func (b *Bot) settlePollWagers(ctx context.Context, tally *PollTally) error {
+	if closed, _ := pollClosed(tally.Poll, clock.Now()); !closed || !tally.Poll.awaitingSettlement() {
+		return nil
+	}
+	anon := b.pseudonyms.mapper(ctx, b.client, b.cfg.Collections.Pseudonyms)
+	results, err := b.leaderboard.SettleWagers(ctx, tally.ID, pollOutcome(tally.Poll), anon)
+	if err != nil {
+		return fmt.Errorf("error settling wagers: %w", err)
+	}
+	tally.Poll.WagersSettled, tally.Poll.WagerResults = true, results
+	b.leaderboardStale = true
+	return nil
+}
+
+// wagerSummary describes the wagers on an open poll for the prompt
+// context.
+func wagerSummary(poll PollQuestion) string {
+	if len(poll.Wagers) == 0 {
+		return ""
+	}
+	staked := map[string]int{}
+	var players, total int
+	for _, w := range poll.Wagers {
+		if _, ok := poll.Options[w.Option]; ok && w.Points > 0 {
+			staked[w.Option] += w.Points
+			players++
+			total += w.Points
+		}
+	}
+	if players == 0 {
+		return ""
+	}
+	var parts []string
+	for key, points := range staked {
+		parts = append(parts, fmt.Sprintf("%s: %d", poll.Options[key].Label, points))
+	}
+	sort.Strings(parts)
+	return fmt.Sprintf("%d players have wagered %d leaderboard points (%s)\n", players, total, strings.Join(parts, ", "))
+}
+
+// wagerResultsText adds how the wagers went to the results announcement of
+// a poll: the pot, and the biggest wins and losses.
+func wagerResultsText(poll PollQuestion) string {
+	results := poll.WagerResults
+	var pot int
+	for _, r := range results {
+		pot += r.Stake
+	}
+	option := func(key string) string {
+		return fmt.Sprintf("%s - %s", poll.Options[key].Label, poll.Options[key].OpText)
+	}
+	lines := []string{fmt.Sprintf("%d players wagered %d leaderboard points on the outcome.", len(results), pot)}
+	var wins, losses []string
+	for _, r := range results {
+		if r.Net > 0 && len(wins) < wagerHighlights {
+			wins = append(wins, fmt.Sprintf("%s won %d points backing %s", r.Name, r.Net, option(r.Option)))
+		}
+	}
+	for i := len(results) - 1; i >= 0; i-- {
+		if r := results[i]; r.Net < 0 && len(losses) < wagerHighlights {
+			losses = append(losses, fmt.Sprintf("%s lost %d points on %s", r.Name, -r.Net, option(r.Option)))
+		}
+	}
+	if len(wins) == 0 && len(losses) == 0 {
+		lines = append(lines, "Every stake came back as it was.")
+	}
+	if len(wins) > 0 {
+		lines = append(lines, "Biggest wins: "+strings.Join(wins, "; ")+".")
+	}
+	if len(losses) > 0 {
+		lines = append(lines, "Biggest losses: "+strings.Join(losses, "; ")+".")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSettleWagers(t *testing.T) {
+	options := map[string]PollOption{"A": {Label: "A"}, "B": {Label: "B"}, "C": {Label: "C"}}
+	players := map[string]LeaderboardEntry{
+		"ann": {Points: 100, DisplayName: "Ann"},
+		"bob": {Points: 50},
+		"cat": {Points: 0},
+		"dan": {Points: 30},
+	}
+	wagers := map[string]Wager{
+		"ann": {Option: "A", Points: 60},
+		"bob": {Option: "B", Points: 80}, // more than bob has
+		"cat": {Option: "A", Points: 10}, // cat has nothing to stake
+		"dan": {Option: "Z", Points: 10}, // no such option
+	}
+
+	got := settleWagers(wagers, options, []string{"A"}, players)
+	want := []WagerResult{
+		{UserID: "ann", Name: "Ann", Option: "A", Stake: 60, Net: 50},
+		{UserID: "bob", Name: "bob", Option: "B", Stake: 50, Net: -50},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("settled = %+v, want %+v", got, want)
+	}
+
+	got = settleWagers(wagers, options, []string{"C"}, players)
+	for _, r := range got {
+		if r.Net != 0 {
+			t.Errorf("nobody backed the winner, but %s got %d", r.UserID, r.Net)
+		}
+	}
+}
+
+func TestWagersSettleBeforeResults(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.RecordQuizScores(ctx, "round-1", []LeaderboardEntry{{UserID: "ann", Points: 40}, {UserID: "bob", Points: 40}})
+	store.SetPoll("q1", PollQuestion{Question: "Who wins the final?", Closed: true,
+		Options: map[string]PollOption{
+			"A": {Label: "A", OpText: "Team Go", Voters: []string{"ann", "cat"}},
+			"B": {Label: "B", OpText: "Team Rust", Voters: []string{"bob"}},
+		},
+		Wagers: map[string]Wager{"ann": {Option: "A", Points: 20}, "bob": {Option: "B", Points: 30}},
+	})
+	b := newTestBot(t, store, generatorFunc(nil))
+
+	for range 2 {
+		if _, err := b.fetchPollStatus(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	top, _ := store.Leaderboard(ctx, 10)
+	if len(top) != 2 || top[0].UserID != "ann" || top[0].Points != 70 || top[1].Points != 10 {
+		t.Errorf("leaderboard = %+v, want the wagers settled once", top)
+	}
+	got := b.pollResultsAnnouncements()
+	if len(got) != 1 || got[0].Kind != "wager-results" || !strings.Contains(got[0].Text, "The winner is A - Team Go") ||
+		!strings.Contains(got[0].Text, "ann won 30 points backing A - Team Go") || !strings.Contains(got[0].Text, "bob lost 30 points on B - Team Rust") {
+		t.Fatalf("announcements = %v, want the results and the wagers", got)
+	}
+	if b.prompts.Lookup("wager-results.tmpl") == nil {
+		t.Error("no prompt for wager results")
+	}
+
+	// Later quiz scores add to what was won.
+	store.RecordQuizScores(ctx, "round-2", []LeaderboardEntry{{UserID: "ann", Points: 5}})
+	if top, _ := store.Leaderboard(ctx, 1); top[0].Points != 75 {
+		t.Errorf("ann has %d points, want 75", top[0].Points)
+	}
+}
+
+func TestSettleWagersReadsThePoll(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.RecordQuizScores(ctx, "round-1", []LeaderboardEntry{{UserID: "anon-ann", Points: 40}, {UserID: "anon-bob", Points: 40}})
+	store.SetPoll("q1", PollQuestion{Question: "Who wins the final?", Closed: true,
+		Options: map[string]PollOption{"A": {Label: "A"}, "B": {Label: "B"}},
+		Wagers:  map[string]Wager{"ann": {Option: "A", Points: 20}, "bob": {Option: "B", Points: 30}},
+	})
+	anon := func(id string) (string, error) { return "anon-" + id, nil }
+
+	results, err := store.SettleWagers(ctx, "q1", []string{"A"}, anon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []WagerResult{
+		{UserID: "anon-ann", Name: "anon-ann", Option: "A", Stake: 20, Net: 30},
+		{UserID: "anon-bob", Name: "anon-bob", Option: "B", Stake: 30, Net: -30},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+	if again, _ := store.SettleWagers(ctx, "q1", []string{"B"}, anon); !reflect.DeepEqual(again, want) {
+		t.Errorf("settling again = %+v, want the first results kept", again)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	wordCloudDocID    = "live"
+	wordCloudHalfLife = 5 * time.Minute
+	wordCloudMinScore = 0.05
+	wordCloudMaxTerms = 100
+)
+
+var stopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "but": true,
+	"is": true, "are": true, "was": true, "were": true, "be": true, "been": true,
+	"am": true, "to": true, "of": true, "in": true, "on": true, "at": true,
+	"for": true, "with": true, "by": true, "from": true, "as": true, "it": true,
+	"its": true, "this": true, "that": true, "these": true, "those": true,
+	"i": true, "me": true, "my": true, "you": true, "your": true, "we": true,
+	"our": true, "he": true, "she": true, "they": true, "them": true, "his": true,
+	"her": true, "their": true, "what": true, "which": true, "who": true,
+	"how": true, "why": true, "when": true, "where": true, "do": true,
+	"does": true, "did": true, "have": true, "has": true, "had": true,
+	"can": true, "will": true, "would": true, "should": true, "could": true,
+	"not": true, "no": true, "yes": true, "so": true, "if": true, "just": true,
+	"about": true, "there": true, "here": true, "all": true, "any": true,
+	"some": true, "very": true, "too": true, "also": true, "than": true,
+	"then": true, "now": true, "sir": true, "hai": true, "hain": true,
+	"ka": true, "ki": true, "ke": true, "ko": true, "se": true, "aur": true,
+	"kya": true, "nahi": true,
+}
+
+// WordCloudTerm is a single entry of the word cloud document read by the frontend.
+type WordCloudTerm struct {
+	Text   string  `firestore:"text"`
+	Weight float64 `firestore:"weight"`
+}
+
+type WordCloud struct {
+	Terms     []WordCloudTerm `firestore:"terms"`
+	UpdatedAt time.Time       `firestore:"updatedAt"`
+}
+
+// wordCloudCounter keeps exponentially decaying term weights so that terms
+// which stop appearing in audience messages gradually fade out of the cloud.
+type wordCloudCounter struct {
+	// blocked reports words moderation blocks, which never enter the cloud.
+	blocked   func(word string) bool
+	mu        sync.Mutex
+	weights   map[string]float64
+	lastDecay time.Time
+}
+
+func newWordCloudCounter(blocked func(word string) bool) *wordCloudCounter {
+	return &wordCloudCounter{blocked: blocked, weights: map[string]float64{}}
+}
+
+func (c *wordCloudCounter) add(message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, w := range splitWords(message) {
+		if len([]rune(w)) < 3 || stopwords[w] || c.blocked(w) {
+			continue
+		}
+		c.weights[w]++
+	}
+}
+
+func (c *wordCloudCounter) decay(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lastDecay.IsZero() {
+		c.lastDecay = now
+		return
+	}
+	factor := math.Pow(0.5, now.Sub(c.lastDecay).Seconds()/wordCloudHalfLife.Seconds())
+	c.lastDecay = now
+	for term, weight := range c.weights {
+		weight *= factor
+		if weight < wordCloudMinScore {
+			delete(c.weights, term)
+			continue
+		}
+		c.weights[term] = weight
+	}
+}
+
+func (c *wordCloudCounter) top(n int) []WordCloudTerm {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	weights := make(map[string]float64, len(c.weights))
+	for term, weight := range c.weights {
+		weights[term] = weight
+	}
+	return topTerms(weights, n)
+}
+
+// mergeTerms adds up the weights of several top-term lists, such as those
+// of every shard, and keeps the n heaviest.
+func mergeTerms(n int, lists ...[]WordCloudTerm) []WordCloudTerm {
+	weights := map[string]float64{}
+	for _, terms := range lists {
+		for _, t := range terms {
+			weights[t.Text] += t.Weight
+		}
+	}
+	return topTerms(weights, n)
+}
+
+func topTerms(weights map[string]float64, n int) []WordCloudTerm {
+	terms := make([]WordCloudTerm, 0, len(weights))
+	for term, weight := range weights {
+		terms = append(terms, WordCloudTerm{Text: term, Weight: math.Round(weight*100) / 100})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Weight == terms[j].Weight {
+			return terms[i].Text < terms[j].Text
+		}
+		return terms[i].Weight > terms[j].Weight
+	})
+	if len(terms) > n {
+		terms = terms[:n]
+	}
+	return terms
+}
+
+// write applies decay and publishes the current top terms, merged with the
+// top terms of other shards, if any.
+func (c *wordCloudCounter) write(ctx context.Context, client *firestore.Client, collection string, others ...[]WordCloudTerm) error {
+	now := clock.Now()
+	c.decay(now)
+	_, err := client.Collection(collection).Doc(wordCloudDocID).Set(ctx, WordCloud{
+		Terms:     mergeTerms(wordCloudMaxTerms, append(others, c.top(wordCloudMaxTerms))...),
+		UpdatedAt: now,
+	})
+	return err
+}
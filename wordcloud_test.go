@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWordCloudFilters(t *testing.T) {
+	var cfg Config
+	cfg.applyDefaults()
+	cfg.Moderation.Blocklist = []string{"Bakwaas"}
+	c := newWordCloudCounter(newModerator(cfg.Moderation).blocked)
+
+	c.add("What is the Gemini API? Gemini on AI, fuck this bakwaas")
+	got := c.top(wordCloudMaxTerms)
+	want := []WordCloudTerm{{Text: "gemini", Weight: 2}, {Text: "api", Weight: 1}}
+	if len(got) != len(want) {
+		t.Fatalf("terms = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("term %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestWordCloudDecay(t *testing.T) {
+	start := time.Date(2024, 11, 16, 10, 0, 0, 0, time.UTC)
+	c := newWordCloudCounter(isProfane)
+	c.add("gemini gemini gemini gemini flutter")
+	c.decay(start)
+
+	c.decay(start.Add(wordCloudHalfLife))
+	if w := c.weights["gemini"]; math.Abs(w-2) > 1e-9 {
+		t.Errorf("gemini after one half-life = %v, want 2", w)
+	}
+	if w := c.weights["flutter"]; math.Abs(w-0.5) > 1e-9 {
+		t.Errorf("flutter after one half-life = %v, want 0.5", w)
+	}
+
+	// Four more half-lives take flutter below wordCloudMinScore.
+	c.decay(start.Add(5 * wordCloudHalfLife))
+	if _, ok := c.weights["flutter"]; ok {
+		t.Error("flutter is still in the cloud, want it dropped below the minimum score")
+	}
+	if got := c.top(1); len(got) != 1 || got[0].Text != "gemini" || got[0].Weight != 0.13 {
+		t.Errorf("top = %v, want gemini at 0.13", got)
+	}
+}